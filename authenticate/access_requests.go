@@ -0,0 +1,226 @@
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/handlers"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const (
+	accessRequestPath      = "/.pomerium/access_request"
+	maxAccessRequestReason = 1000
+)
+
+// accessRequestDurations are the durations users choose from, besides the
+// default and maximum duration.
+var accessRequestDurations = []time.Duration{
+	15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour, 24 * time.Hour,
+}
+
+// NewAccessRequest renders the page where users request temporary access to
+// the route they were denied access to, and creates the access request.
+func (a *Authenticate) NewAccessRequest(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+	if options.AccessRequests == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("access requests are not enabled"))
+	}
+
+	s, err := a.getSessionFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	routeURL, err := urlutil.ParseAndValidateURL(r.FormValue(urlutil.QueryRedirectURI))
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	policy := getRoutePolicy(options, routeURL)
+	if policy == nil {
+		return httputil.NewError(http.StatusBadRequest, errors.New("no route matches the url"))
+	}
+	routeID, err := policy.RouteID()
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	data := handlers.AccessRequestData{
+		RouteURL:        routeURL.String(),
+		Durations:       getAccessRequestDurations(options.AccessRequests),
+		DefaultDuration: options.AccessRequests.GetDefaultDuration(),
+	}
+	if r.Method != http.MethodPost {
+		handlers.AccessRequest(data).ServeHTTP(w, r)
+		return nil
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	var duration time.Duration
+	if v := r.FormValue("duration"); v != "" {
+		duration, err = time.ParseDuration(v)
+	}
+	if err != nil || len(reason) > maxAccessRequestReason {
+		data.Error = "Invalid access request."
+		handlers.AccessRequest(data).ServeHTTP(w, r)
+		return nil
+	}
+	pbDuration, err := accessrequest.NewDuration(duration,
+		options.AccessRequests.GetDefaultDuration(), options.AccessRequests.GetMaxDuration())
+	if err != nil {
+		data.Error = status.Convert(err).Message()
+		handlers.AccessRequest(data).ServeHTTP(w, r)
+		return nil
+	}
+
+	u, err := user.Get(ctx, state.dataBrokerClient, s.UserID())
+	if err != nil && status.Code(err) != codes.NotFound {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error loading user: %w", err))
+	}
+
+	req, err := accessrequest.Create(ctx, state.dataBrokerClient, &user.AccessRequest{
+		UserId:   s.UserID(),
+		Email:    u.GetEmail(),
+		RouteUrl: routeURL.String(),
+		RouteId:  strconv.FormatUint(routeID, 10),
+		Reason:   reason,
+		Duration: pbDuration,
+	}, time.Now())
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	log.FromRequest(r).Info().
+		Str("access_request_id", req.GetId()).
+		Str("user_id", req.GetUserId()).
+		Str("route_url", req.GetRouteUrl()).
+		Msg("authenticate: created access request")
+
+	authenticateURL, err := options.GetAuthenticateURL()
+	if err != nil {
+		return err
+	}
+	link := authenticateURL.ResolveReference(&url.URL{Path: accessRequestPath + "/" + req.GetId()})
+	if err := accessrequest.NotifyApprovers(options.AccessRequests, req, link.String()); err != nil {
+		log.FromRequest(r).Error().Err(err).Msg("authenticate: error notifying access request approvers")
+	}
+
+	httputil.Redirect(w, r, link.Path, http.StatusFound)
+	return nil
+}
+
+// AccessRequest renders an access request to the user who requested it and
+// to approvers, who approve or deny it.
+func (a *Authenticate) AccessRequest(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+	if options.AccessRequests == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("access requests are not enabled"))
+	}
+
+	s, err := a.getSessionFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	u, err := user.Get(ctx, state.dataBrokerClient, s.UserID())
+	if err != nil && status.Code(err) != codes.NotFound {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error loading user: %w", err))
+	}
+
+	req, err := accessrequest.Get(ctx, state.dataBrokerClient, mux.Vars(r)["id"])
+	if status.Code(err) == codes.NotFound {
+		return httputil.NewError(http.StatusNotFound, errors.New("access request not found"))
+	} else if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	isApprover := options.AccessRequests.IsApprover(s.UserID(), u.GetEmail())
+	if !isApprover && req.GetUserId() != s.UserID() {
+		return httputil.NewError(http.StatusNotFound, errors.New("access request not found"))
+	}
+
+	data := handlers.AccessRequestData{
+		AccessRequest: req,
+		CanDecide: isApprover && req.GetUserId() != s.UserID() &&
+			req.GetState() == user.AccessRequest_PENDING,
+	}
+	if r.Method != http.MethodPost {
+		handlers.AccessRequest(data).ServeHTTP(w, r)
+		return nil
+	}
+
+	if !data.CanDecide {
+		return httputil.NewError(http.StatusForbidden, errors.New("access request may not be decided"))
+	}
+	var approve bool
+	switch r.FormValue("action") {
+	case "approve":
+		approve = true
+	case "deny":
+	default:
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid action"))
+	}
+	req, err = accessrequest.Decide(ctx, state.dataBrokerClient, req.GetId(), approve, s.UserID(), time.Now())
+	if status.Code(err) == codes.FailedPrecondition {
+		return httputil.NewError(http.StatusConflict, errors.New(status.Convert(err).Message()))
+	} else if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	log.FromRequest(r).Info().
+		Str("access_request_id", req.GetId()).
+		Str("user_id", req.GetUserId()).
+		Str("route_url", req.GetRouteUrl()).
+		Str("approver_id", s.UserID()).
+		Str("state", req.GetState().String()).
+		Msg("authenticate: decided access request")
+
+	httputil.Redirect(w, r, r.URL.Path, http.StatusFound)
+	return nil
+}
+
+// getRoutePolicy returns the policy of the route which matches the url, or
+// nil if there is none.
+func getRoutePolicy(options *config.Options, u *url.URL) *config.Policy {
+	for _, p := range options.GetAllPolicies() {
+		if p.Matches(*u) {
+			p := p
+			return &p
+		}
+	}
+	return nil
+}
+
+// getAccessRequestDurations returns the durations users choose from when
+// they request access.
+func getAccessRequestDurations(options *config.AccessRequestOptions) []time.Duration {
+	seen := map[time.Duration]bool{}
+	var durations []time.Duration
+	candidates := append([]time.Duration{options.GetDefaultDuration(), options.GetMaxDuration()}, accessRequestDurations...)
+	for _, d := range candidates {
+		if d <= options.GetMaxDuration() && !seen[d] {
+			seen[d] = true
+			durations = append(durations, d)
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations
+}
@@ -0,0 +1,24 @@
+package authenticate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestGetAccessRequestDurations(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []time.Duration{
+		15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour,
+	}, getAccessRequestDurations(&config.AccessRequestOptions{}))
+	assert.Equal(t, []time.Duration{
+		15 * time.Minute, 30 * time.Minute, 45 * time.Minute, time.Hour, 90 * time.Minute,
+	}, getAccessRequestDurations(&config.AccessRequestOptions{
+		DefaultDuration: 45 * time.Minute,
+		MaxDuration:     90 * time.Minute,
+	}))
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/identity/healthcheck"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
@@ -38,17 +39,19 @@ func ValidateOptions(o *config.Options) error {
 
 // Authenticate contains data required to run the authenticate service.
 type Authenticate struct {
-	cfg     *authenticateConfig
-	options *atomicutil.Value[*config.Options]
-	state   *atomicutil.Value[*authenticateState]
+	cfg           *authenticateConfig
+	options       *atomicutil.Value[*config.Options]
+	state         *atomicutil.Value[*authenticateState]
+	healthChecker *healthcheck.Checker
 }
 
 // New validates and creates a new authenticate service from a set of Options.
 func New(cfg *config.Config, options ...Option) (*Authenticate, error) {
 	a := &Authenticate{
-		cfg:     getAuthenticateConfig(options...),
-		options: config.NewAtomicOptions(),
-		state:   atomicutil.NewValue(newAuthenticateState()),
+		cfg:           getAuthenticateConfig(options...),
+		options:       config.NewAtomicOptions(),
+		state:         atomicutil.NewValue(newAuthenticateState()),
+		healthChecker: healthcheck.New(),
 	}
 
 	a.options.Store(cfg.Options)
@@ -69,6 +72,7 @@ func (a *Authenticate) OnConfigChange(ctx context.Context, cfg *config.Config) {
 	}
 
 	a.options.Store(cfg.Options)
+	a.healthChecker.OnConfigChange(ctx, cfg)
 	if state, err := newAuthenticateStateFromConfig(cfg); err != nil {
 		log.Error(ctx).Err(err).Msg("authenticate: failed to update state")
 	} else {
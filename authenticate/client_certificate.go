@@ -0,0 +1,62 @@
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/clientcert"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// ClientCertificateSignIn signs in the user identified by the client
+// certificate. On success the user is redirected to the OAuth callback with a
+// code, like any other identity provider. Users without a valid client
+// certificate are sent to the fallback identity provider, if there is one.
+func (a *Authenticate) ClientCertificateSignIn(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	encodedState := r.FormValue("state")
+	redirectURL, err := a.getRedirectURLFromState(encodedState)
+	if err != nil {
+		return err
+	}
+
+	idpID := a.getIdentityProviderIDForURLValues(redirectURL.Query())
+	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
+	if err != nil {
+		return err
+	}
+	provider, ok := authenticator.(*clientcert.Provider)
+	if !ok {
+		return httputil.NewError(http.StatusNotFound, errors.New("identity provider is not client_certificate"))
+	}
+
+	cert, err := clientcert.ParseForwardedClientCert(r.Header.Get(httputil.HeaderForwardedClientCert))
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	code, err := provider.SignIn(r.Context(), cert)
+	if err != nil {
+		log.FromRequest(r).Info().Err(err).Msg("authenticate: client certificate sign in failed")
+		fallbackURL, fallbackErr := a.getIdentityProviderFallbackURL(redirectURL, idpID)
+		if fallbackErr != nil {
+			return httputil.NewError(http.StatusInternalServerError, fallbackErr)
+		}
+		if fallbackURL != "" {
+			httputil.Redirect(w, r, fallbackURL, http.StatusFound)
+			return nil
+		}
+		return httputil.NewError(httputil.StatusInvalidClientCertificate, err)
+	}
+
+	callbackURL := *state.redirectURL
+	callbackURL.RawQuery = url.Values{
+		"code":  {code},
+		"state": {encodedState},
+	}.Encode()
+	httputil.Redirect(w, r, callbackURL.String(), http.StatusFound)
+	return nil
+}
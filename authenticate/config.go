@@ -2,6 +2,7 @@ package authenticate
 
 import (
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/encoding/jwks"
 	"github.com/pomerium/pomerium/internal/identity"
 	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
 )
@@ -9,6 +10,7 @@ import (
 type authenticateConfig struct {
 	getIdentityProvider func(options *config.Options, idpID string) (identity.Authenticator, error)
 	profileTrimFn       func(*identitypb.Profile)
+	jwksFetcher         *jwks.Fetcher
 }
 
 // An Option customizes the Authenticate config.
@@ -17,6 +19,7 @@ type Option func(*authenticateConfig)
 func getAuthenticateConfig(options ...Option) *authenticateConfig {
 	cfg := new(authenticateConfig)
 	WithGetIdentityProvider(defaultGetIdentityProvider)(cfg)
+	WithJWKSFetcher(jwks.DefaultFetcher)(cfg)
 	for _, option := range options {
 		option(cfg)
 	}
@@ -36,3 +39,11 @@ func WithProfileTrimFn(profileTrimFn func(*identitypb.Profile)) Option {
 		cfg.profileTrimFn = profileTrimFn
 	}
 }
+
+// WithJWKSFetcher sets the fetcher of the keys security event tokens are
+// verified with.
+func WithJWKSFetcher(fetcher *jwks.Fetcher) Option {
+	return func(cfg *authenticateConfig) {
+		cfg.jwksFetcher = fetcher
+	}
+}
@@ -0,0 +1,368 @@
+package authenticate
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/dpop"
+	"github.com/pomerium/pomerium/internal/handlers"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// OAuth 2.0 device authorization grant (RFC 8628) paths.
+const (
+	deviceAuthorizationPath = "/oauth2/device_authorization"
+	deviceVerificationPath  = "/.pomerium/device"
+	deviceCompletePath      = "/.pomerium/device/complete"
+)
+
+const (
+	deviceCodeGrantType      = "urn:ietf:params:oauth:grant-type:device_code"
+	deviceAuthorizationTTL   = 10 * time.Minute
+	devicePollingInterval    = 5 * time.Second
+	deviceCodeSecretLength   = 32
+	deviceUserCodeLength     = 8
+	deviceUserCodeCharacters = "BCDFGHJKLMNPQRSTVWXZ" // no vowels, see rfc8628#section-6.1
+)
+
+// DeviceAuthorization handles device authorization requests from clients
+// without a browser. The resource parameter is the URL of the route the
+// client wants to access. The user approves the client by entering the user
+// code at the verification URI, and the client polls the token endpoint for
+// the session.
+//
+// https://datatracker.ietf.org/doc/html/rfc8628#section-3.1
+func (a *Authenticate) DeviceAuthorization(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	routeURL, err := urlutil.ParseAndValidateURL(r.FormValue("resource"))
+	if err != nil {
+		return renderOAuthError(w, "invalid_request", "resource must be the url of a route")
+	}
+	if !isRouteURL(options, routeURL) {
+		return renderOAuthError(w, "invalid_target", "resource is not the url of a route")
+	}
+	idp, err := options.GetIdentityProviderForRequestURL(routeURL.String())
+	if err != nil {
+		return renderOAuthError(w, "invalid_target", err.Error())
+	}
+
+	userCode := newDeviceUserCode()
+	deviceCode := userCode + "." + cryptutil.NewRandomStringN(deviceCodeSecretLength)
+	_, err = databroker.Put(ctx, state.dataBrokerClient, &session.DeviceAuthorization{
+		Id:                 userCode,
+		DeviceCodeHash:     hashDeviceCode(deviceCode),
+		RouteUrl:           routeURL.String(),
+		IdentityProviderId: idp.GetId(),
+		ExpiresAt:          timestamppb.New(time.Now().Add(deviceAuthorizationTTL)),
+	})
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error saving device authorization: %w", err))
+	}
+
+	authenticateURL, err := options.GetAuthenticateURL()
+	if err != nil {
+		return err
+	}
+	verificationURI := authenticateURL.ResolveReference(&url.URL{Path: deviceVerificationPath})
+	verificationURIComplete := *verificationURI
+	verificationURIComplete.RawQuery = url.Values{"user_code": {formatDeviceUserCode(userCode)}}.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.RenderJSON(w, http.StatusOK, map[string]any{
+		"device_code":               deviceCode,
+		"user_code":                 formatDeviceUserCode(userCode),
+		"verification_uri":          verificationURI.String(),
+		"verification_uri_complete": verificationURIComplete.String(),
+		"expires_in":                int(deviceAuthorizationTTL.Seconds()),
+		"interval":                  int(devicePollingInterval.Seconds()),
+	})
+	return nil
+}
+
+// DeviceToken handles device access token requests. Once the user has
+// approved the device, the access token is a session JWT, which clients send
+// to the route in a "Authorization: Pomerium" header.
+//
+// https://datatracker.ietf.org/doc/html/rfc8628#section-3.4
+func (a *Authenticate) DeviceToken(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	if r.FormValue("grant_type") != deviceCodeGrantType {
+		return renderOAuthError(w, "unsupported_grant_type", "")
+	}
+	deviceCode := r.FormValue("device_code")
+	userCode, _, _ := strings.Cut(deviceCode, ".")
+
+	authorization, err := a.getDeviceAuthorization(r, userCode)
+	if err != nil {
+		return err
+	} else if authorization == nil ||
+		subtle.ConstantTimeCompare(authorization.GetDeviceCodeHash(), hashDeviceCode(deviceCode)) != 1 {
+		return renderOAuthError(w, "invalid_grant", "")
+	}
+
+	now := time.Now()
+	if authorization.GetExpiresAt().AsTime().Before(now) {
+		return renderOAuthError(w, "expired_token", "")
+	}
+
+	if authorization.GetEncryptedSessionJwt() == nil {
+		pollTooSoon := authorization.GetPolledAt() != nil &&
+			now.Sub(authorization.GetPolledAt().AsTime()) < devicePollingInterval
+		authorization.PolledAt = timestamppb.New(now)
+		if _, err := databroker.Put(ctx, state.dataBrokerClient, authorization); err != nil {
+			return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error saving device authorization: %w", err))
+		}
+		if pollTooSoon {
+			return renderOAuthError(w, "slow_down", "")
+		}
+		return renderOAuthError(w, "authorization_pending", "")
+	}
+
+	rawJWT, err := cryptutil.Decrypt(state.sharedCipher, authorization.GetEncryptedSessionJwt(), []byte(authorization.GetId()))
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error decrypting device session: %w", err))
+	}
+
+	// a DPoP proof binds the session to the device's key (rfc9449 section 5)
+	if proof := r.Header.Get(dpop.HeaderName); proof != "" {
+		jkt, err := dpop.Verify(ctx, proof, dpop.Request{
+			Method:           r.Method,
+			URL:              *urlutil.GetAbsoluteURL(r),
+			DataBrokerClient: state.dataBrokerClient,
+		})
+		if errors.Is(err, dpop.ErrInvalidProof) {
+			return renderOAuthError(w, "invalid_dpop_proof", err.Error())
+		} else if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, err)
+		}
+		if err := a.bindDeviceSession(ctx, rawJWT, jkt); err != nil {
+			return httputil.NewError(http.StatusInternalServerError, err)
+		}
+	}
+
+	// the device code may only be used once
+	record := databroker.NewRecord(authorization)
+	record.DeletedAt = timestamppb.Now()
+	_, err = state.dataBrokerClient.Put(ctx, &databroker.PutRequest{Records: []*databroker.Record{record}})
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error deleting device authorization: %w", err))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.RenderJSON(w, http.StatusOK, map[string]any{
+		"access_token": string(rawJWT),
+		"token_type":   "Pomerium",
+		"expires_in":   int(options.CookieExpire.Seconds()),
+	})
+	return nil
+}
+
+// bindDeviceSession binds the session of the device session JWT to the DPoP
+// key.
+func (a *Authenticate) bindDeviceSession(ctx context.Context, rawJWT []byte, jkt string) error {
+	state := a.state.Load()
+
+	var deviceSession sessions.State
+	if err := state.sharedEncoder.Unmarshal(rawJWT, &deviceSession); err != nil {
+		return fmt.Errorf("authenticate: error decoding device session: %w", err)
+	}
+	s, err := session.Get(ctx, state.dataBrokerClient, deviceSession.ID)
+	if err != nil {
+		return fmt.Errorf("authenticate: error loading device session: %w", err)
+	}
+	s.DpopJkt = jkt
+	if _, err := session.Put(ctx, state.dataBrokerClient, s); err != nil {
+		return fmt.Errorf("authenticate: error binding device session: %w", err)
+	}
+	return nil
+}
+
+// DeviceVerification renders the page where users enter the user code of a
+// device. The user signs in to the device's route and is then redirected to
+// DeviceComplete with the new session.
+func (a *Authenticate) DeviceVerification(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	userCode := r.FormValue("user_code")
+	if r.Method != http.MethodPost {
+		handlers.DeviceAuthorization(handlers.DeviceAuthorizationData{
+			UserCode: userCode,
+		}).ServeHTTP(w, r)
+		return nil
+	}
+
+	authorization, err := a.getDeviceAuthorization(r, normalizeDeviceUserCode(userCode))
+	if err != nil {
+		return err
+	} else if authorization == nil || authorization.GetExpiresAt().AsTime().Before(time.Now()) ||
+		authorization.GetEncryptedSessionJwt() != nil {
+		handlers.DeviceAuthorization(handlers.DeviceAuthorizationData{
+			UserCode: userCode,
+			Error:    "Invalid or expired code.",
+		}).ServeHTTP(w, r)
+		return nil
+	}
+
+	routeURL, err := urlutil.ParseAndValidateURL(authorization.GetRouteUrl())
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	authenticateURL, err := options.GetAuthenticateURL()
+	if err != nil {
+		return err
+	}
+
+	// sign in to the route like the programmatic login does, and come back to
+	// complete the device authorization with the new session
+	callbackURL := routeURL.ResolveReference(&url.URL{Path: "/.pomerium/callback/"})
+	completeURL := authenticateURL.ResolveReference(&url.URL{Path: deviceCompletePath})
+	completeURL.RawQuery = url.Values{
+		"user_code":                     {authorization.GetId()},
+		urlutil.QueryIdentityProviderID: {authorization.GetIdentityProviderId()},
+	}.Encode()
+
+	signInURL := *authenticateURL
+	q := signInURL.Query()
+	q.Set(urlutil.QueryCallbackURI, callbackURL.String())
+	q.Set(urlutil.QueryIsProgrammatic, "true")
+	signInURL.RawQuery = q.Encode()
+
+	rawURL, err := urlutil.SignInURL(state.hpkePrivateKey, state.hpkePrivateKey.PublicKey(),
+		&signInURL, completeURL, authorization.GetIdentityProviderId())
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	httputil.Redirect(w, r, rawURL, http.StatusFound)
+	return nil
+}
+
+// DeviceComplete stores the session created for the device, so that the
+// device receives it when it next polls the token endpoint.
+func (a *Authenticate) DeviceComplete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+
+	s, err := a.getSessionFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the session must belong to the signed in user
+	rawJWT := r.FormValue(urlutil.QueryPomeriumJWT)
+	var deviceSession sessions.State
+	if err := state.sharedEncoder.Unmarshal([]byte(rawJWT), &deviceSession); err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid %s: %w", urlutil.QueryPomeriumJWT, err))
+	}
+	if deviceSession.UserID() != s.UserID() {
+		return httputil.NewError(http.StatusBadRequest, errors.New("device session belongs to another user"))
+	}
+
+	authorization, err := a.getDeviceAuthorization(r, r.FormValue("user_code"))
+	if err != nil {
+		return err
+	} else if authorization == nil || authorization.GetExpiresAt().AsTime().Before(time.Now()) ||
+		authorization.GetEncryptedSessionJwt() != nil {
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid or expired code"))
+	}
+
+	authorization.EncryptedSessionJwt = cryptutil.Encrypt(state.sharedCipher, []byte(rawJWT), []byte(authorization.GetId()))
+	if _, err := databroker.Put(ctx, state.dataBrokerClient, authorization); err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error saving device authorization: %w", err))
+	}
+
+	log.FromRequest(r).Info().
+		Str("user_id", s.UserID()).
+		Str("route_url", authorization.GetRouteUrl()).
+		Msg("authenticate: approved device authorization")
+	return httputil.NewError(http.StatusOK, errors.New("device approved, you may close this window"))
+}
+
+// getDeviceAuthorization returns the device authorization for the user code,
+// or nil if there is no such device authorization.
+func (a *Authenticate) getDeviceAuthorization(r *http.Request, userCode string) (*session.DeviceAuthorization, error) {
+	state := a.state.Load()
+	if userCode == "" {
+		return nil, nil
+	}
+
+	authorization := &session.DeviceAuthorization{Id: userCode}
+	err := databroker.Get(r.Context(), state.dataBrokerClient, authorization)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error loading device authorization: %w", err))
+	}
+	return authorization, nil
+}
+
+func isRouteURL(options *config.Options, u *url.URL) bool {
+	return getRoutePolicy(options, u) != nil
+}
+
+// renderOAuthError renders an OAuth 2.0 error response.
+//
+// https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+func renderOAuthError(w http.ResponseWriter, code, description string) error {
+	res := map[string]string{"error": code}
+	if description != "" {
+		res["error_description"] = description
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.RenderJSON(w, http.StatusBadRequest, res)
+	return nil
+}
+
+func newDeviceUserCode() string {
+	var sb strings.Builder
+	for i := 0; i < deviceUserCodeLength; i++ {
+		sb.WriteByte(deviceUserCodeCharacters[cryptutil.NewRandomUInt32()%uint32(len(deviceUserCodeCharacters))])
+	}
+	return sb.String()
+}
+
+// formatDeviceUserCode formats a user code for display, e.g. "WDJB-MJHT".
+func formatDeviceUserCode(userCode string) string {
+	return userCode[:deviceUserCodeLength/2] + "-" + userCode[deviceUserCodeLength/2:]
+}
+
+// normalizeDeviceUserCode normalizes a user code entered by a user, ignoring
+// case and punctuation.
+func normalizeDeviceUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if !strings.ContainsRune(deviceUserCodeCharacters, r) {
+			return -1
+		}
+		return r
+	}, userCode)
+}
+
+func hashDeviceCode(deviceCode string) []byte {
+	return cryptutil.Hash("device code", []byte(deviceCode))
+}
@@ -0,0 +1,212 @@
+package authenticate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/dpop"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestDeviceUserCode(t *testing.T) {
+	t.Parallel()
+
+	userCode := newDeviceUserCode()
+	assert.Len(t, userCode, deviceUserCodeLength)
+	assert.Equal(t, userCode, normalizeDeviceUserCode(userCode))
+	assert.Equal(t, userCode, normalizeDeviceUserCode(formatDeviceUserCode(userCode)))
+
+	assert.Equal(t, "WDJBMJHT", normalizeDeviceUserCode(" wdjb-mjht "))
+	assert.Equal(t, "WDJB-MJHT", formatDeviceUserCode("WDJBMJHT"))
+}
+
+func TestAuthenticate_DeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	records := map[string]*databroker.Record{}
+	leases := map[string]struct{}{}
+	client := mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			record, ok := records[in.GetId()]
+			if !ok {
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+			return &databroker.GetResponse{Record: record}, nil
+		},
+		put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+			for _, record := range in.GetRecords() {
+				if record.GetDeletedAt() != nil {
+					delete(records, record.GetId())
+				} else {
+					records[record.GetId()] = record
+				}
+			}
+			return &databroker.PutResponse{Records: in.GetRecords()}, nil
+		},
+		acquireLease: func(ctx context.Context, in *databroker.AcquireLeaseRequest, opts ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+			if _, ok := leases[in.GetName()]; ok {
+				return nil, status.Error(codes.AlreadyExists, "lease is already taken")
+			}
+			leases[in.GetName()] = struct{}{}
+			return &databroker.AcquireLeaseResponse{Id: in.GetName()}, nil
+		},
+	}
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	require.NoError(t, err)
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	policy := config.Policy{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com")}
+	require.NoError(t, policy.Validate())
+	options := config.NewAtomicOptions()
+	opts := options.Load()
+	opts.AuthenticateURLString = "https://authenticate.example.com"
+	opts.Policies = []config.Policy{policy}
+	options.Store(opts)
+
+	a := &Authenticate{
+		state: atomicutil.NewValue(&authenticateState{
+			sharedCipher:     aead,
+			sharedEncoder:    encoder,
+			dataBrokerClient: client,
+		}),
+		options: options,
+	}
+
+	var proof string
+	post := func(handler httputil.HandlerFunc, path string, form url.Values) map[string]any {
+		r := httptest.NewRequest(http.MethodPost, "https://authenticate.example.com"+path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if proof != "" {
+			r.Header.Set(dpop.HeaderName, proof)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		var res map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return res
+	}
+	poll := func(deviceCode string) map[string]any {
+		return post(a.DeviceToken, tokenPath, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {deviceCode},
+		})
+	}
+
+	res := post(a.DeviceAuthorization, deviceAuthorizationPath, url.Values{"resource": {"https://not-a-route.example.com"}})
+	assert.Equal(t, "invalid_target", res["error"])
+
+	res = post(a.DeviceAuthorization, deviceAuthorizationPath, url.Values{"resource": {"https://from.example.com"}})
+	require.NotNil(t, res["device_code"], res)
+	deviceCode := res["device_code"].(string)
+	userCode := normalizeDeviceUserCode(res["user_code"].(string))
+	assert.Equal(t, "https://authenticate.example.com/.pomerium/device", res["verification_uri"])
+	assert.Equal(t, "https://authenticate.example.com/.pomerium/device?user_code="+formatDeviceUserCode(userCode), res["verification_uri_complete"])
+	require.Contains(t, records, userCode)
+
+	assert.Equal(t, "unsupported_grant_type", post(a.DeviceToken, tokenPath, url.Values{"device_code": {deviceCode}})["error"])
+	assert.Equal(t, "invalid_grant", poll(userCode + ".WRONG")["error"])
+	assert.Equal(t, "authorization_pending", poll(deviceCode)["error"])
+	assert.Equal(t, "slow_down", poll(deviceCode)["error"])
+
+	// approve the device
+	var authorization session.DeviceAuthorization
+	require.NoError(t, records[userCode].GetData().UnmarshalTo(&authorization))
+	authorization.PolledAt = nil
+	authorization.EncryptedSessionJwt = cryptutil.Encrypt(aead, []byte("SESSION_JWT"), []byte(userCode))
+	records[userCode] = databroker.NewRecord(&authorization)
+
+	res = poll(deviceCode)
+	assert.Equal(t, "SESSION_JWT", res["access_token"])
+	assert.Equal(t, "Pomerium", res["token_type"])
+	assert.Equal(t, "invalid_grant", poll(deviceCode)["error"], "device codes should only be usable once")
+
+	t.Run("dpop", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			(&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt"))
+		require.NoError(t, err)
+		proof, err = jwt.Signed(signer).Claims(map[string]any{
+			"jti": "1",
+			"htm": http.MethodPost,
+			"htu": "https://authenticate.example.com" + tokenPath,
+			"iat": time.Now().Unix(),
+		}).CompactSerialize()
+		require.NoError(t, err)
+		t.Cleanup(func() { proof = "" })
+
+		approve := func() string {
+			res := post(a.DeviceAuthorization, deviceAuthorizationPath, url.Values{"resource": {"https://from.example.com"}})
+			deviceCode := res["device_code"].(string)
+			userCode := normalizeDeviceUserCode(res["user_code"].(string))
+
+			rawJWT, err := encoder.Marshal(&sessions.State{ID: "DPOP_SESSION"})
+			require.NoError(t, err)
+			var authorization session.DeviceAuthorization
+			require.NoError(t, records[userCode].GetData().UnmarshalTo(&authorization))
+			authorization.EncryptedSessionJwt = cryptutil.Encrypt(aead, rawJWT, []byte(userCode))
+			records[userCode] = databroker.NewRecord(&authorization)
+			return deviceCode
+		}
+		records["DPOP_SESSION"] = databroker.NewRecord(&session.Session{Id: "DPOP_SESSION"})
+
+		assert.NotNil(t, poll(approve())["access_token"])
+		var s session.Session
+		require.NoError(t, records["DPOP_SESSION"].GetData().UnmarshalTo(&s))
+		thumbprint, err := (&jose.JSONWebKey{Key: key.Public()}).Thumbprint(crypto.SHA256)
+		require.NoError(t, err)
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(thumbprint), s.GetDpopJkt(),
+			"should bind the session to the proof's key")
+
+		assert.Equal(t, "invalid_dpop_proof", poll(approve())["error"], "should reject replayed proofs")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		res := post(a.DeviceAuthorization, deviceAuthorizationPath, url.Values{"resource": {"https://from.example.com"}})
+		deviceCode := res["device_code"].(string)
+		userCode := normalizeDeviceUserCode(res["user_code"].(string))
+
+		var authorization session.DeviceAuthorization
+		require.NoError(t, records[userCode].GetData().UnmarshalTo(&authorization))
+		authorization.ExpiresAt = timestamppb.New(time.Now().Add(-time.Minute))
+		records[userCode] = databroker.NewRecord(&authorization)
+
+		assert.Equal(t, "expired_token", poll(deviceCode)["error"])
+	})
+}
+
+func mustParseWeightedURLs(t *testing.T, urls ...string) config.WeightedURLs {
+	wu, err := config.ParseWeightedUrls(urls...)
+	require.NoError(t, err)
+	return wu
+}
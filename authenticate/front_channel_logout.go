@@ -0,0 +1,107 @@
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// frontChannelLogoutPath is the path of the front-channel logout endpoint.
+const frontChannelLogoutPath = "/oauth2/frontchannel_logout"
+
+// FrontChannelLogout handles OpenID Connect front-channel logout requests. The
+// identity provider renders this endpoint in an iframe when the user signs out
+// at the identity provider.
+//
+// Browsers usually don't send the authenticate session cookies to third-party
+// iframes, so if the request has a sid parameter, every session created from
+// that identity provider session is revoked in the databroker. The local
+// session is cleared if it was sent and belongs to the identity provider
+// session.
+//
+// https://openid.net/specs/openid-connect-frontchannel-1_0.html
+func (a *Authenticate) FrontChannelLogout(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	idpID := a.getIdentityProviderIDForRequest(r)
+	idp, err := options.GetIdentityProviderForID(idpID)
+	if err != nil {
+		return err
+	}
+
+	iss, sid := r.FormValue("iss"), r.FormValue("sid")
+	if sid != "" && iss == "" {
+		return httputil.NewError(http.StatusBadRequest, errors.New("iss is required with sid"))
+	}
+	if iss != "" && !issuerMatches(iss, idp.GetUrl()) {
+		return httputil.NewError(http.StatusBadRequest, errors.New("iss does not match the identity provider"))
+	}
+
+	if sid != "" && state.sessionServiceClient != nil {
+		res, err := state.sessionServiceClient.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_IdentityProviderSession{
+				IdentityProviderSession: &session.IdentityProviderSession{Sid: sid},
+			},
+		})
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error revoking sessions: %w", err))
+		}
+
+		log.FromRequest(r).Info().
+			Str("idp_id", idpID).
+			Str("sid", sid).
+			Strs("session_ids", res.GetSessionIds()).
+			Msg("authenticate: revoked sessions via front-channel logout")
+	}
+
+	if profile, err := loadIdentityProfile(r, state.cookieCipher); err == nil {
+		claims := profile.GetClaims().AsMap()
+		if frontChannelLogoutMatches(claims, iss, sid) {
+			state.sessionStore.ClearSession(w, r)
+			a.forgetRememberedDevice(ctx, w, r)
+		}
+	}
+
+	// the identity provider must be able to frame the response
+	frameAncestors := "'self'"
+	if u, err := url.Parse(idp.GetUrl()); err == nil && u.Host != "" {
+		frameAncestors += " " + u.Scheme + "://" + u.Host
+	}
+	w.Header().Set("Content-Security-Policy", "frame-ancestors "+frameAncestors)
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("<!DOCTYPE html><html><head><title>Signed out</title></head><body></body></html>"))
+	return nil
+}
+
+// frontChannelLogoutMatches returns true if the claims of the local identity
+// profile match the iss and sid parameters of a front-channel logout request.
+// Requests without parameters match any profile.
+func frontChannelLogoutMatches(claims map[string]any, iss, sid string) bool {
+	if iss != "" {
+		if v, _ := claims["iss"].(string); !issuerMatches(iss, v) {
+			return false
+		}
+	}
+	if sid != "" {
+		if v, _ := claims["sid"].(string); v != sid {
+			return false
+		}
+	}
+	return true
+}
+
+// issuerMatches compares issuer urls, ignoring a trailing slash.
+func issuerMatches(a, b string) bool {
+	return a != "" && strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
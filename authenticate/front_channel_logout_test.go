@@ -0,0 +1,123 @@
+package authenticate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/httputil"
+	mstore "github.com/pomerium/pomerium/internal/sessions/mock"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestFrontChannelLogoutMatches(t *testing.T) {
+	t.Parallel()
+
+	claims := map[string]any{"iss": "https://idp.example.com/", "sid": "SID"}
+	assert.True(t, frontChannelLogoutMatches(claims, "", ""))
+	assert.True(t, frontChannelLogoutMatches(claims, "https://idp.example.com", "SID"))
+	assert.False(t, frontChannelLogoutMatches(claims, "https://other.example.com", "SID"))
+	assert.False(t, frontChannelLogoutMatches(claims, "https://idp.example.com", "OTHER"))
+	assert.False(t, frontChannelLogoutMatches(map[string]any{}, "https://idp.example.com", "SID"))
+}
+
+func TestAuthenticate_FrontChannelLogout(t *testing.T) {
+	t.Parallel()
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	claims, err := structpb.NewStruct(map[string]any{"iss": "https://idp.example.com", "sid": "SID"})
+	require.NoError(t, err)
+	profileRecorder := httptest.NewRecorder()
+	storeIdentityProfile(profileRecorder, aead, &identitypb.Profile{Claims: claims})
+
+	newAuthenticate := func(sessionStore *mstore.Store, revoked *[]string) *Authenticate {
+		options := config.NewAtomicOptions()
+		o := options.Load()
+		o.ProviderURL = "https://idp.example.com"
+		options.Store(o)
+		return &Authenticate{
+			cfg:     getAuthenticateConfig(),
+			options: options,
+			state: atomicutil.NewValue(&authenticateState{
+				cookieCipher: aead,
+				sessionStore: sessionStore,
+				sessionServiceClient: mockSessionServiceClient{
+					revokeSessions: func(ctx context.Context, in *session.RevokeSessionsRequest, opts ...grpc.CallOption) (*session.RevokeSessionsResponse, error) {
+						*revoked = append(*revoked, in.GetIdentityProviderSession().GetSid())
+						return &session.RevokeSessionsResponse{}, nil
+					},
+				},
+			}),
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		query       string
+		withProfile bool
+		wantCode    int
+		wantRevoked []string
+		wantCleared bool
+	}{
+		{"sid", "?iss=https://idp.example.com/&sid=SID", true, http.StatusOK, []string{"SID"}, true},
+		{"sid without cookies", "?iss=https://idp.example.com/&sid=SID", false, http.StatusOK, []string{"SID"}, false},
+		{"other sid", "?iss=https://idp.example.com&sid=OTHER", true, http.StatusOK, []string{"OTHER"}, false},
+		{"no parameters", "", true, http.StatusOK, nil, true},
+		{"sid without iss", "?sid=SID", true, http.StatusBadRequest, nil, false},
+		{"wrong iss", "?iss=https://other.example.com&sid=SID", true, http.StatusBadRequest, nil, false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var revoked []string
+			sessionStore := &mstore.Store{ResponseSession: "SESSION"}
+			a := newAuthenticate(sessionStore, &revoked)
+
+			r := httptest.NewRequest(http.MethodGet, frontChannelLogoutPath+tc.query, nil)
+			if tc.withProfile {
+				for _, c := range profileRecorder.Result().Cookies() {
+					r.AddCookie(c)
+				}
+			}
+			w := httptest.NewRecorder()
+			httputil.HandlerFunc(a.FrontChannelLogout).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code, w.Body.String())
+			assert.Equal(t, tc.wantRevoked, revoked)
+			assert.Equal(t, tc.wantCleared, sessionStore.ResponseSession == "")
+			if tc.wantCode == http.StatusOK {
+				assert.Equal(t, "frame-ancestors 'self' https://idp.example.com", w.Header().Get("Content-Security-Policy"))
+				assert.Contains(t, w.Header().Get("Cache-Control"), "no-store")
+			}
+		})
+	}
+}
+
+type mockSessionServiceClient struct {
+	session.SessionServiceClient
+
+	revokeSessions func(ctx context.Context, in *session.RevokeSessionsRequest, opts ...grpc.CallOption) (*session.RevokeSessionsResponse, error)
+	signOutAll     func(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error)
+}
+
+func (m mockSessionServiceClient) RevokeSessions(ctx context.Context, in *session.RevokeSessionsRequest, opts ...grpc.CallOption) (*session.RevokeSessionsResponse, error) {
+	return m.revokeSessions(ctx, in, opts...)
+}
+
+func (m mockSessionServiceClient) SignOutAll(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error) {
+	return m.signOutAll(ctx, in, opts...)
+}
@@ -17,13 +17,24 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/pomerium/csrf"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
 	"github.com/pomerium/pomerium/internal/handlers"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/clientcert"
+	"github.com/pomerium/pomerium/internal/identity/kerberos"
+	"github.com/pomerium/pomerium/internal/identity/ldap"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/identity/oauth/apple"
 	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/internal/identity/passkey"
+	"github.com/pomerium/pomerium/internal/identity/saml"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/middleware"
+	"github.com/pomerium/pomerium/internal/policynamespace"
+	"github.com/pomerium/pomerium/internal/scim"
+	"github.com/pomerium/pomerium/internal/serviceaccount"
 	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
@@ -59,7 +70,7 @@ func (a *Authenticate) Mount(r *mux.Router) {
 			csrf.ErrorHandler(httputil.HandlerFunc(httputil.CSRFFailureHandler)),
 		}
 
-		if options.Provider == apple.Name {
+		if options.HasIdentityProviderType(apple.Name) {
 			// csrf.SameSiteLaxMode will cause browsers to reset
 			// the session on POST. This breaks Appleid being able
 			// to verify the csrf token.
@@ -68,7 +79,49 @@ func (a *Authenticate) Mount(r *mux.Router) {
 			csrfOptions = append(csrfOptions, csrf.SameSite(csrf.SameSiteLaxMode))
 		}
 
-		return csrf.Protect(state.cookieSecret, csrfOptions...)(h)
+		protect := csrf.Protect(state.cookieSecret, csrfOptions...)(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// back-channel logout requests come directly from the identity
+			// provider and are authenticated by the signed logout token
+			if r.URL.Path == backChannelLogoutPath {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// saml responses are posted by the identity provider, the csrf
+			// nonce in the relay state is verified by the callback
+			if r.URL.Path == saml.ACSPath {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// scim requests are authenticated by the bearer token
+			if strings.HasPrefix(r.URL.Path, scim.PathPrefix+"/") {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// service account requests are authenticated by the api token
+			if r.URL.Path == serviceaccount.PathPrefix || strings.HasPrefix(r.URL.Path, serviceaccount.PathPrefix+"/") {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// policy namespace requests are authenticated by the bearer token
+			if strings.HasPrefix(r.URL.Path, policynamespace.PathPrefix+"/") {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// access request api requests are authenticated by the bearer token
+			if r.URL.Path == accessrequest.PathPrefix || strings.HasPrefix(r.URL.Path, accessrequest.PathPrefix+"/") {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// okta event hooks are authenticated by the event hook secret
+			if r.URL.Path == oktaEventHookPath {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// security event tokens are authenticated by their signature
+			if r.URL.Path == sharedSignalsPath {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			// device authorization and token requests come from clients
+			// without a browser and are authenticated by the grant
+			if r.URL.Path == deviceAuthorizationPath || r.URL.Path == tokenPath {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+			protect.ServeHTTP(w, r)
+		})
 	})
 
 	// redirect / to /.pomerium/
@@ -77,6 +130,23 @@ func (a *Authenticate) Mount(r *mux.Router) {
 	r.Path("/robots.txt").HandlerFunc(a.RobotsTxt).Methods(http.MethodGet)
 	// Identity Provider (IdP) endpoints
 	r.Path("/oauth2/callback").Handler(httputil.HandlerFunc(a.OAuthCallback)).Methods(http.MethodGet, http.MethodPost)
+	r.Path(backChannelLogoutPath).Handler(httputil.HandlerFunc(a.BackChannelLogout)).Methods(http.MethodPost)
+	r.Path(frontChannelLogoutPath).Handler(httputil.HandlerFunc(a.FrontChannelLogout)).Methods(http.MethodGet)
+	r.Path(clientcert.SignInPath).Handler(httputil.HandlerFunc(a.ClientCertificateSignIn)).Methods(http.MethodGet)
+	r.Path(kerberos.SignInPath).Handler(httputil.HandlerFunc(a.KerberosSignIn)).Methods(http.MethodGet)
+	r.Path(ldap.SignInPath).Handler(httputil.HandlerFunc(a.LDAPSignIn)).Methods(http.MethodGet, http.MethodPost)
+	r.Path(passkey.SignInPath).Handler(httputil.HandlerFunc(a.PasskeySignIn)).Methods(http.MethodGet, http.MethodPost)
+	r.Path(saml.ACSPath).Handler(httputil.HandlerFunc(a.SAMLAssertionConsumerService)).Methods(http.MethodPost)
+	r.Path(saml.MetadataPath).Handler(httputil.HandlerFunc(a.SAMLMetadata)).Methods(http.MethodGet)
+	r.PathPrefix(scim.PathPrefix + "/").Handler(httputil.HandlerFunc(a.SCIM))
+	r.PathPrefix(serviceaccount.PathPrefix).Handler(httputil.HandlerFunc(a.ServiceAccounts))
+	r.PathPrefix(policynamespace.PathPrefix + "/").Handler(httputil.HandlerFunc(a.PolicyNamespaces))
+	r.PathPrefix(accessrequest.PathPrefix).Handler(httputil.HandlerFunc(a.AccessRequests))
+	r.Path(oktaEventHookPath).Handler(httputil.HandlerFunc(a.OktaEventHook)).Methods(http.MethodGet, http.MethodPost)
+	r.Path(sharedSignalsPath).Handler(httputil.HandlerFunc(a.SharedSignalsEvents)).Methods(http.MethodPost)
+	// Device authorization grant and token exchange endpoints
+	r.Path(deviceAuthorizationPath).Handler(httputil.HandlerFunc(a.DeviceAuthorization)).Methods(http.MethodPost)
+	r.Path(tokenPath).Handler(httputil.HandlerFunc(a.Token)).Methods(http.MethodPost)
 
 	a.mountDashboard(r)
 }
@@ -99,6 +169,7 @@ func (a *Authenticate) mountDashboard(r *mux.Router) {
 
 	// routes that don't need a session:
 	sr.Path("/sign_out").Handler(httputil.HandlerFunc(a.SignOut))
+	sr.Path("/device").Handler(httputil.HandlerFunc(a.DeviceVerification)).Methods(http.MethodGet, http.MethodPost)
 
 	// routes that need a session:
 	sr = sr.NewRoute().Subrouter()
@@ -106,6 +177,12 @@ func (a *Authenticate) mountDashboard(r *mux.Router) {
 	sr.Use(a.VerifySession)
 	sr.Path("/").Handler(a.requireValidSignatureOnRedirect(a.userInfo))
 	sr.Path("/sign_in").Handler(httputil.HandlerFunc(a.SignIn))
+	sr.Path("/remember_device").Handler(httputil.HandlerFunc(a.RememberDevice)).Methods(http.MethodPost)
+	sr.Path("/impersonate").Handler(httputil.HandlerFunc(a.Impersonate)).Methods(http.MethodPost)
+	sr.Path("/impersonate/stop").Handler(httputil.HandlerFunc(a.StopImpersonating)).Methods(http.MethodPost)
+	sr.Path("/device/complete").Handler(httputil.HandlerFunc(a.DeviceComplete)).Methods(http.MethodGet)
+	sr.Path("/access_request").Handler(httputil.HandlerFunc(a.NewAccessRequest)).Methods(http.MethodGet, http.MethodPost)
+	sr.Path("/access_request/{id}").Handler(httputil.HandlerFunc(a.AccessRequest)).Methods(http.MethodGet, http.MethodPost)
 	sr.Path("/device-enrolled").Handler(httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		userInfoData, err := a.getUserInfoData(r)
 		if err != nil {
@@ -141,7 +218,7 @@ func (a *Authenticate) VerifySession(next http.Handler) http.Handler {
 				Err(err).
 				Str("idp_id", idpID).
 				Msg("authenticate: session load error")
-			return a.reauthenticateOrFail(w, r, err)
+			return a.reauthenticateOrRestore(w, r, err)
 		}
 
 		if sessionState.IdentityProviderID != idpID {
@@ -150,7 +227,7 @@ func (a *Authenticate) VerifySession(next http.Handler) http.Handler {
 				Str("session_idp_id", sessionState.IdentityProviderID).
 				Str("id", sessionState.ID).
 				Msg("authenticate: session not associated with identity provider")
-			return a.reauthenticateOrFail(w, r, err)
+			return a.reauthenticateOrRestore(w, r, err)
 		}
 
 		_, err = loadIdentityProfile(r, state.cookieCipher)
@@ -159,7 +236,26 @@ func (a *Authenticate) VerifySession(next http.Handler) http.Handler {
 				Err(err).
 				Str("idp_id", idpID).
 				Msg("authenticate: identity profile load error")
-			return a.reauthenticateOrFail(w, r, err)
+			return a.reauthenticateOrRestore(w, r, err)
+		}
+
+		signedOut, err := a.isSignedOut(ctx, sessionState)
+		if err != nil {
+			return err
+		} else if signedOut {
+			log.FromRequest(r).Info().
+				Str("idp_id", idpID).
+				Str("id", sessionState.ID).
+				Msg("authenticate: session user has been signed out everywhere")
+			return a.reauthenticateOrFail(w, r, errSignedOut)
+		}
+
+		if a.requiresIDPSignIn(r, sessionState) {
+			log.FromRequest(r).Info().
+				Str("idp_id", idpID).
+				Str("id", sessionState.ID).
+				Msg("authenticate: identity provider sign in requested")
+			return a.reauthenticateOrFail(w, r, errIDPSignInRequested)
 		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -189,7 +285,7 @@ func (a *Authenticate) SignIn(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	idpID := requestParams.Get(urlutil.QueryIdentityProviderID)
+	idpID := a.getIdentityProviderIDForURLValues(r.Form)
 
 	s, err := a.getSessionFromCtx(ctx)
 	if err != nil {
@@ -272,12 +368,18 @@ func (a *Authenticate) signOutRedirect(w http.ResponseWriter, r *http.Request) e
 		redirectString = uri
 	}
 
+	signOutOptions, err := options.GetIDPSignOutOptions(idpID)
+	if err != nil {
+		return err
+	}
+	idp, err := options.GetIdentityProviderForID(idpID)
+	if err != nil {
+		return err
+	}
+
 	endSessionURL, err := authenticator.LogOut()
-	if err == nil && redirectString != "" {
-		params := url.Values{}
-		params.Add("id_token_hint", rawIDToken)
-		params.Add("post_logout_redirect_uri", redirectString)
-		endSessionURL.RawQuery = params.Encode()
+	if err == nil && (redirectString != "" || signOutOptions.GetPostLogoutRedirectURI() != "") {
+		endSessionURL.RawQuery = getEndSessionParams(signOutOptions, idp.GetClientId(), rawIDToken, redirectString).Encode()
 		redirectString = endSessionURL.String()
 	} else if err != nil && !errors.Is(err, oidc.ErrSignoutNotImplemented) {
 		log.Warn(r.Context()).Err(err).Msg("authenticate.SignOut: failed getting session")
@@ -310,20 +412,47 @@ func (a *Authenticate) reauthenticateOrFail(w http.ResponseWriter, r *http.Reque
 	options := a.options.Load()
 	idpID := a.getIdentityProviderIDForRequest(r)
 
+	var authCodeOptions []oauth2.AuthCodeOption
+	if _, requestParams, err := hpke.DecryptURLValues(state.hpkePrivateKey, r.Form); err == nil {
+		// let the user choose the identity provider for routes with several
+		idps := a.getIdentityProviderChoices(requestParams)
+		if _, ok := a.getIdentityProviderChoice(r.Form, requestParams); len(idps) > 1 && !ok {
+			return a.selectIdentityProvider(w, r, idps)
+		}
+
+		authCodeOptions, err = getIDPAuthCodeOptions(requestParams)
+		if err != nil {
+			return httputil.NewError(http.StatusBadRequest, err)
+		}
+	}
+
+	redirectURL := state.redirectURL.ResolveReference(r.URL)
+
+	// sign in with the failover while the identity provider is down
+	if failoverURL, err := a.getIdentityProviderFailoverURL(redirectURL, idpID); err != nil {
+		return err
+	} else if failoverURL != "" {
+		log.FromRequest(r).Warn().
+			Str("idp_id", idpID).
+			Msg("authenticate: identity provider is down, signing in with the failover")
+		httputil.Redirect(w, r, failoverURL, http.StatusFound)
+		return nil
+	}
+
 	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
 	if err != nil {
 		return err
 	}
 
 	state.sessionStore.ClearSession(w, r)
-	redirectURL := state.redirectURL.ResolveReference(r.URL)
 	nonce := csrf.Token(r)
 	now := time.Now().Unix()
 	b := []byte(fmt.Sprintf("%s|%d|", nonce, now))
 	enc := cryptutil.Encrypt(state.cookieCipher, []byte(redirectURL.String()), b)
 	b = append(b, enc...)
 	encodedState := base64.URLEncoding.EncodeToString(b)
-	signinURL, err := authenticator.GetSignInURL(encodedState)
+	authCodeOptions = append(authCodeOptions, oauth.S256ChallengeOptions(a.getCodeVerifier(encodedState))...)
+	signinURL, err := authenticator.GetSignInURL(encodedState, authCodeOptions...)
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError,
 			fmt.Errorf("failed to get sign in url: %w", err))
@@ -374,42 +503,9 @@ func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request)
 		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("identity provider returned empty code"))
 	}
 
-	// state includes a csrf nonce (validated by middleware) and redirect uri
-	bytes, err := base64.URLEncoding.DecodeString(r.FormValue("state"))
-	if err != nil {
-		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("bad bytes: %w", err))
-	}
-
-	// split state into concat'd components
-	// (nonce|timestamp|redirect_url|encrypted_data(redirect_url)+mac(nonce,ts))
-	statePayload := strings.SplitN(string(bytes), "|", 3)
-	if len(statePayload) != 3 {
-		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("state malformed, size: %d", len(statePayload)))
-	}
-
-	// Use our AEAD construct to enforce secrecy and authenticity:
-	// mac: to validate the nonce again, and above timestamp
-	// decrypt: to prevent leaking 'redirect_uri' to IdP or logs
-	b := []byte(fmt.Sprint(statePayload[0], "|", statePayload[1], "|"))
-	redirectString, err := cryptutil.Decrypt(state.cookieCipher, []byte(statePayload[2]), b)
-	if err != nil {
-		return nil, httputil.NewError(http.StatusBadRequest, err)
-	}
-
-	redirectURL, err := urlutil.ParseAndValidateURL(string(redirectString))
+	redirectURL, err := a.getRedirectURLFromState(r.FormValue("state"))
 	if err != nil {
-		return nil, httputil.NewError(http.StatusBadRequest, err)
-	}
-
-	// verify that the returned timestamp is valid
-	if err := cryptutil.ValidTimestamp(statePayload[1]); err != nil {
-		return nil, httputil.NewError(http.StatusBadRequest, err).WithDescription(fmt.Sprintf(`
-The request expired. This may be because a login attempt took too long, or because the server's clock is out of sync.
-
-Try again by following this link: [%s](%s).
-
-Or contact your administrator.
-`, redirectURL.String(), redirectURL.String()))
+		return nil, err
 	}
 
 	idpID := a.getIdentityProviderIDForURLValues(redirectURL.Query())
@@ -423,11 +519,30 @@ Or contact your administrator.
 	//
 	// Exchange the supplied Authorization Code for a valid user session.
 	var claims identity.SessionClaims
-	accessToken, err := authenticator.Authenticate(ctx, code, &claims)
+	var accessToken *oauth2.Token
+	if provider, ok := authenticator.(*saml.Provider); ok {
+		// SAML codes are bound to the relay state
+		accessToken, err = provider.Redeem(ctx, a.getSAMLCodeOptions(), code, r.FormValue("state"), &claims)
+	} else {
+		accessToken, err = authenticator.Authenticate(ctx, code, &claims,
+			oauth.VerifierOption(a.getCodeVerifier(r.FormValue("state"))))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error redeeming authenticate code: %w", err)
 	}
 
+	claimsMapping, err := options.GetIDPClaimsMapping(idpID)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusInternalServerError, err)
+	}
+	if claims.Claims == nil {
+		claims.Claims = make(identity.Claims)
+	}
+	if rawUser := r.FormValue("user"); rawUser != "" && authenticator.Name() == apple.Name {
+		addAppleUserClaims(r, claims.Claims, rawUser)
+	}
+	claimsMapping.Apply(claims.Claims)
+
 	s := sessions.NewState(idpID)
 	err = claims.Claims.Claims(&s)
 	if err != nil {
@@ -440,7 +555,7 @@ Or contact your administrator.
 	}
 
 	// save the session and access token to the databroker
-	profile, err := a.buildIdentityProfile(ctx, r, &newState, claims, accessToken)
+	profile, err := a.buildIdentityProfile(ctx, idpID, &newState, claims, accessToken)
 	if err != nil {
 		return nil, httputil.NewError(http.StatusInternalServerError, err)
 	}
@@ -453,6 +568,76 @@ Or contact your administrator.
 	return redirectURL, nil
 }
 
+// addAppleUserClaims adds the name and email Apple posts to the callback the
+// first time a user signs in, which the id token doesn't have.
+func addAppleUserClaims(r *http.Request, claims identity.Claims, rawUser string) {
+	u, err := apple.ParseUser(rawUser)
+	if err != nil {
+		log.FromRequest(r).Warn().Err(err).Msg("authenticate: error parsing apple user")
+		return
+	}
+	for k, v := range u.Claims() {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+}
+
+// getCodeVerifier derives the PKCE code verifier of a sign in from its state,
+// so that it doesn't need to be stored until the callback.
+//
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.1
+func (a *Authenticate) getCodeVerifier(encodedState string) string {
+	state := a.state.Load()
+	mac := cryptutil.GenerateHMAC([]byte("pkce|"+encodedState), state.cookieSecret)
+	return base64.RawURLEncoding.EncodeToString(mac)
+}
+
+// getRedirectURLFromState decodes and validates the redirect url in the state
+// parameter created by reauthenticateOrFail.
+func (a *Authenticate) getRedirectURLFromState(encodedState string) (*url.URL, error) {
+	state := a.state.Load()
+
+	// state includes a csrf nonce (validated by middleware) and redirect uri
+	bytes, err := base64.URLEncoding.DecodeString(encodedState)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("bad bytes: %w", err))
+	}
+
+	// split state into concat'd components
+	// (nonce|timestamp|redirect_url|encrypted_data(redirect_url)+mac(nonce,ts))
+	statePayload := strings.SplitN(string(bytes), "|", 3)
+	if len(statePayload) != 3 {
+		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("state malformed, size: %d", len(statePayload)))
+	}
+
+	// Use our AEAD construct to enforce secrecy and authenticity:
+	// mac: to validate the nonce again, and above timestamp
+	// decrypt: to prevent leaking 'redirect_uri' to IdP or logs
+	b := []byte(fmt.Sprint(statePayload[0], "|", statePayload[1], "|"))
+	redirectString, err := cryptutil.Decrypt(state.cookieCipher, []byte(statePayload[2]), b)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	redirectURL, err := urlutil.ParseAndValidateURL(string(redirectString))
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	// verify that the returned timestamp is valid
+	if err := cryptutil.ValidTimestamp(statePayload[1]); err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, err).WithDescription(fmt.Sprintf(`
+The request expired. This may be because a login attempt took too long, or because the server's clock is out of sync.
+
+Try again by following this link: [%s](%s).
+
+Or contact your administrator.
+`, redirectURL.String(), redirectURL.String()))
+	}
+	return redirectURL, nil
+}
+
 func (a *Authenticate) getSessionFromCtx(ctx context.Context) (*sessions.State, error) {
 	state := a.state.Load()
 
@@ -523,6 +708,7 @@ func (a *Authenticate) revokeSession(ctx context.Context, w http.ResponseWriter,
 
 	// clear the user's local session no matter what
 	defer state.sessionStore.ClearSession(w, r)
+	a.forgetRememberedDevice(ctx, w, r)
 
 	idpID := r.FormValue(urlutil.QueryIdentityProviderID)
 
@@ -593,6 +779,31 @@ func (a *Authenticate) saveCallbackSession(w http.ResponseWriter, r *http.Reques
 	return rawJWT, nil
 }
 
+// getEndSessionParams returns the query params of an RP-initiated logout
+// request to the identity provider.
+func getEndSessionParams(options *config.IDPSignOutOptions, clientID, rawIDToken, redirectURI string) url.Values {
+	if options == nil {
+		options = new(config.IDPSignOutOptions)
+	}
+
+	params := url.Values{}
+	if !options.OmitIDTokenHint {
+		params.Add("id_token_hint", rawIDToken)
+	}
+	if options.IncludeClientID {
+		params.Add("client_id", clientID)
+	}
+	if options.PostLogoutRedirectURI != "" {
+		params.Add("post_logout_redirect_uri", options.PostLogoutRedirectURI)
+	} else {
+		params.Add("post_logout_redirect_uri", redirectURI)
+	}
+	if options.IncludeState && redirectURI != "" {
+		params.Add("state", redirectURI)
+	}
+	return params
+}
+
 func (a *Authenticate) getIdentityProviderIDForRequest(r *http.Request) string {
 	if err := r.ParseForm(); err != nil {
 		return ""
@@ -607,6 +818,10 @@ func (a *Authenticate) getIdentityProviderIDForURLValues(vs url.Values) string {
 		if idpID == "" {
 			idpID = requestParams.Get(urlutil.QueryIdentityProviderID)
 		}
+		// routes with several identity providers let the user choose
+		if choice, ok := a.getIdentityProviderChoice(vs, requestParams); ok {
+			idpID = choice
+		}
 	}
 	if idpID == "" {
 		idpID = vs.Get(urlutil.QueryIdentityProviderID)
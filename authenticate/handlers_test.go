@@ -259,6 +259,45 @@ func TestAuthenticate_SignOut(t *testing.T) {
 	}
 }
 
+func Test_getEndSessionParams(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		options *config.IDPSignOutOptions
+		want    url.Values
+	}{
+		{"default", nil, url.Values{
+			"id_token_hint":            {"ID_TOKEN"},
+			"post_logout_redirect_uri": {"https://app.example.com"},
+		}},
+		{"omit id token hint", &config.IDPSignOutOptions{OmitIDTokenHint: true}, url.Values{
+			"post_logout_redirect_uri": {"https://app.example.com"},
+		}},
+		{"client id", &config.IDPSignOutOptions{IncludeClientID: true}, url.Values{
+			"id_token_hint":            {"ID_TOKEN"},
+			"client_id":                {"CLIENT_ID"},
+			"post_logout_redirect_uri": {"https://app.example.com"},
+		}},
+		{"post logout redirect uri and state", &config.IDPSignOutOptions{
+			PostLogoutRedirectURI: "https://authenticate.example.com/signed_out",
+			IncludeState:          true,
+		}, url.Values{
+			"id_token_hint":            {"ID_TOKEN"},
+			"post_logout_redirect_uri": {"https://authenticate.example.com/signed_out"},
+			"state":                    {"https://app.example.com"},
+		}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := getEndSessionParams(tc.options, "CLIENT_ID", "ID_TOKEN", "https://app.example.com")
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
 func TestAuthenticate_OAuthCallback(t *testing.T) {
 	t.Parallel()
 
@@ -559,8 +598,10 @@ func TestAuthenticate_userInfo(t *testing.T) {
 type mockDataBrokerServiceClient struct {
 	databroker.DataBrokerServiceClient
 
-	get func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error)
-	put func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error)
+	get          func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error)
+	put          func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error)
+	query        func(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error)
+	acquireLease func(ctx context.Context, in *databroker.AcquireLeaseRequest, opts ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error)
 }
 
 func (m mockDataBrokerServiceClient) Get(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
@@ -571,6 +612,14 @@ func (m mockDataBrokerServiceClient) Put(ctx context.Context, in *databroker.Put
 	return m.put(ctx, in, opts...)
 }
 
+func (m mockDataBrokerServiceClient) Query(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+	return m.query(ctx, in, opts...)
+}
+
+func (m mockDataBrokerServiceClient) AcquireLease(ctx context.Context, in *databroker.AcquireLeaseRequest, opts ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+	return m.acquireLease(ctx, in, opts...)
+}
+
 func mustParseURL(rawurl string) *url.URL {
 	u, err := url.Parse(rawurl)
 	if err != nil {
@@ -578,3 +627,21 @@ func mustParseURL(rawurl string) *url.URL {
 	}
 	return u
 }
+
+func TestAddAppleUserClaims(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/callback", nil)
+	claims := identity.Claims{"email": "relay@privaterelay.appleid.com"}
+	addAppleUserClaims(r, claims, `{"name":{"firstName":"Jane","lastName":"Doe"},"email":"jane@example.com"}`)
+	assert.Equal(t, identity.Claims{
+		"email":       "relay@privaterelay.appleid.com",
+		"given_name":  "Jane",
+		"family_name": "Doe",
+		"name":        "Jane Doe",
+	}, claims)
+
+	claims = identity.Claims{}
+	addAppleUserClaims(r, claims, "not json")
+	assert.Empty(t, claims)
+}
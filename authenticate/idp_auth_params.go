@@ -0,0 +1,57 @@
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/hpke"
+)
+
+var errIDPSignInRequested = errors.New("authenticate: identity provider sign in requested")
+
+// getIDPAuthCodeOptions returns the identity provider parameters requested
+// in the encrypted sign in query as auth code options.
+func getIDPAuthCodeOptions(requestParams url.Values) ([]oauth2.AuthCodeOption, error) {
+	authParams, err := config.NewIDPAuthParamsOptionsFromQuery(requestParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []oauth2.AuthCodeOption
+	for k, v := range authParams.AuthURLParams() {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return opts, nil
+}
+
+// requiresIDPSignIn returns true if the sign in request asks for the user to
+// sign in with the identity provider again, e.g. with prompt=login or with a
+// max_age the session is older than.
+func (a *Authenticate) requiresIDPSignIn(r *http.Request, s *sessions.State) bool {
+	state := a.state.Load()
+
+	_, requestParams, err := hpke.DecryptURLValues(state.hpkePrivateKey, r.Form)
+	if err != nil {
+		return false
+	}
+	authParams, err := config.NewIDPAuthParamsOptionsFromQuery(requestParams)
+	if err != nil || authParams == nil || s.IssuedAt == nil {
+		return false
+	}
+	issuedMS, err := strconv.ParseInt(requestParams.Get(urlutil.QueryIssued), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	// session timestamps only have second precision
+	requestedAt := time.UnixMilli(issuedMS).Truncate(time.Second)
+	return authParams.RequiresSignIn(s.IssuedAt.Time(), requestedAt, time.Now())
+}
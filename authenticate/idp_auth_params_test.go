@@ -0,0 +1,67 @@
+package authenticate
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/hpke"
+)
+
+func TestAuthenticate_requiresIDPSignIn(t *testing.T) {
+	t.Parallel()
+
+	key, err := hpke.GeneratePrivateKey()
+	require.NoError(t, err)
+	a := &Authenticate{
+		state: atomicutil.NewValue(&authenticateState{hpkePrivateKey: key}),
+	}
+
+	newRequest := func(t *testing.T, params url.Values) *http.Request {
+		urlutil.BuildTimeParameters(params, time.Minute)
+		encrypted, err := hpke.EncryptURLValues(key, key.PublicKey(), params)
+		require.NoError(t, err)
+		return &http.Request{Form: encrypted}
+	}
+	staleSession := &sessions.State{IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Hour))}
+	freshSession := &sessions.State{IssuedAt: jwt.NewNumericDate(time.Now().Add(time.Second))}
+
+	r := newRequest(t, url.Values{urlutil.QueryIDPPrompt: {"login"}})
+	assert.True(t, a.requiresIDPSignIn(r, staleSession))
+	assert.False(t, a.requiresIDPSignIn(r, freshSession))
+
+	r = newRequest(t, url.Values{urlutil.QueryIDPMaxAge: {"60"}})
+	assert.True(t, a.requiresIDPSignIn(r, staleSession))
+
+	r = newRequest(t, url.Values{urlutil.QueryIDPLoginHint: {"user@example.com"}})
+	assert.False(t, a.requiresIDPSignIn(r, staleSession))
+
+	r = &http.Request{Form: url.Values{urlutil.QueryIDPPrompt: {"login"}}}
+	assert.False(t, a.requiresIDPSignIn(r, staleSession), "unencrypted parameters should be ignored")
+}
+
+func TestGetIDPAuthCodeOptions(t *testing.T) {
+	t.Parallel()
+
+	opts, err := getIDPAuthCodeOptions(url.Values{
+		urlutil.QueryIDPPrompt:    {"login"},
+		urlutil.QueryIDPACRValues: {"phr"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, opts, 2)
+
+	opts, err = getIDPAuthCodeOptions(url.Values{})
+	assert.NoError(t, err)
+	assert.Empty(t, opts)
+
+	_, err = getIDPAuthCodeOptions(url.Values{urlutil.QueryIDPPrompt: {"always"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package authenticate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+var (
+	errImpersonationNotAllowed  = errors.New("authenticate: impersonation is not allowed")
+	errImpersonationUnknownUser = errors.New("authenticate: unknown user")
+)
+
+// Impersonate starts a session as another user for troubleshooting. Only the
+// operators listed in impersonation_allowed_users may impersonate. Requests
+// are then authorized as the impersonated user until the impersonation is
+// stopped or times out, and the JWT assertion identifies the operator in an
+// act claim.
+func (a *Authenticate) Impersonate(w http.ResponseWriter, r *http.Request) error {
+	s, err := a.getSessionFromCtx(r.Context())
+	if err != nil {
+		return err
+	}
+
+	_, err = a.startImpersonation(r.Context(), s, r.FormValue("user_id"))
+	if errors.Is(err, errImpersonationNotAllowed) {
+		return httputil.NewError(http.StatusForbidden, err)
+	} else if errors.Is(err, errImpersonationUnknownUser) {
+		return httputil.NewError(http.StatusBadRequest, err)
+	} else if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	httputil.Redirect(w, r, "/.pomerium/", http.StatusFound)
+	return nil
+}
+
+// StopImpersonating stops impersonating another user.
+func (a *Authenticate) StopImpersonating(w http.ResponseWriter, r *http.Request) error {
+	s, err := a.getSessionFromCtx(r.Context())
+	if err != nil {
+		return err
+	}
+
+	if err := a.stopImpersonation(r.Context(), s); err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	httputil.Redirect(w, r, "/.pomerium/", http.StatusFound)
+	return nil
+}
+
+// startImpersonation creates a session for the impersonated user, which
+// expires after the impersonation timeout, and references it from the
+// operator's session.
+func (a *Authenticate) startImpersonation(ctx context.Context, s *sessions.State, userID string) (*session.Session, error) {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	operator, err := user.Get(ctx, state.dataBrokerClient, s.UserID())
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, fmt.Errorf("authenticate: error loading user: %w", err)
+	}
+	if !options.IsImpersonationAllowed(s.UserID(), operator.GetEmail()) {
+		log.Warn(ctx).
+			Str("user-id", s.UserID()).
+			Str("impersonate-user-id", userID).
+			Msg("authenticate: impersonation denied")
+		return nil, errImpersonationNotAllowed
+	}
+
+	if userID == "" || userID == s.UserID() {
+		return nil, errImpersonationUnknownUser
+	}
+	impersonated, err := user.Get(ctx, state.dataBrokerClient, userID)
+	if status.Code(err) == codes.NotFound {
+		return nil, errImpersonationUnknownUser
+	} else if err != nil {
+		return nil, fmt.Errorf("authenticate: error loading user: %w", err)
+	}
+
+	operatorSession, err := session.Get(ctx, state.dataBrokerClient, s.ID)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: error loading session: %w", err)
+	}
+
+	// the impersonation may not outlive the operator's session
+	now := time.Now()
+	expiresAt := now.Add(options.GetImpersonationTimeout())
+	if operatorSession.GetExpiresAt() != nil && operatorSession.GetExpiresAt().AsTime().Before(expiresAt) {
+		expiresAt = operatorSession.GetExpiresAt().AsTime()
+	}
+	impersonatedSession := &session.Session{
+		Id:        uuid.NewString(),
+		UserId:    impersonated.GetId(),
+		IssuedAt:  timestamppb.New(now),
+		ExpiresAt: timestamppb.New(expiresAt),
+		// the impersonated session is used with the operator's requests
+		ClientCertificateFingerprint: operatorSession.GetClientCertificateFingerprint(),
+		IpPrefix:                     operatorSession.GetIpPrefix(),
+		UserAgentHash:                operatorSession.GetUserAgentHash(),
+		DpopJkt:                      operatorSession.GetDpopJkt(),
+	}
+	if _, err := session.Put(ctx, state.dataBrokerClient, impersonatedSession); err != nil {
+		return nil, fmt.Errorf("authenticate: error saving impersonated session: %w", err)
+	}
+
+	previous := operatorSession.GetImpersonateSessionId()
+	operatorSession.ImpersonateSessionId = proto.String(impersonatedSession.GetId())
+	if _, err := session.Put(ctx, state.dataBrokerClient, operatorSession); err != nil {
+		return nil, fmt.Errorf("authenticate: error saving session: %w", err)
+	}
+	if previous != "" {
+		if err := session.Delete(ctx, state.dataBrokerClient, previous); err != nil {
+			log.Warn(ctx).Err(err).Msg("authenticate: error deleting previous impersonated session")
+		}
+	}
+
+	log.Info(ctx).
+		Str("session-id", operatorSession.GetId()).
+		Str("user-id", s.UserID()).
+		Str("email", operator.GetEmail()).
+		Str("impersonate-session-id", impersonatedSession.GetId()).
+		Str("impersonate-user-id", impersonated.GetId()).
+		Str("impersonate-email", impersonated.GetEmail()).
+		Time("expires-at", expiresAt).
+		Msg("authenticate: started impersonation")
+	return impersonatedSession, nil
+}
+
+// stopImpersonation removes the impersonated session from the operator's
+// session.
+func (a *Authenticate) stopImpersonation(ctx context.Context, s *sessions.State) error {
+	state := a.state.Load()
+
+	operatorSession, err := session.Get(ctx, state.dataBrokerClient, s.ID)
+	if status.Code(err) == codes.NotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("authenticate: error loading session: %w", err)
+	}
+
+	impersonateSessionID := operatorSession.GetImpersonateSessionId()
+	if impersonateSessionID == "" {
+		return nil
+	}
+	operatorSession.ImpersonateSessionId = nil
+	if _, err := session.Put(ctx, state.dataBrokerClient, operatorSession); err != nil {
+		return fmt.Errorf("authenticate: error saving session: %w", err)
+	}
+	if err := session.Delete(ctx, state.dataBrokerClient, impersonateSessionID); err != nil {
+		return fmt.Errorf("authenticate: error deleting impersonated session: %w", err)
+	}
+
+	log.Info(ctx).
+		Str("session-id", operatorSession.GetId()).
+		Str("user-id", s.UserID()).
+		Str("impersonate-session-id", impersonateSessionID).
+		Msg("authenticate: stopped impersonation")
+	return nil
+}
@@ -0,0 +1,104 @@
+package authenticate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestAuthenticate_Impersonation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	records := map[string]*databroker.Record{}
+	client := mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			record, ok := records[in.GetId()]
+			if !ok || record.GetType() != in.GetType() {
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+			return &databroker.GetResponse{Record: record}, nil
+		},
+		put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+			for _, record := range in.GetRecords() {
+				if record.GetDeletedAt() != nil {
+					delete(records, record.GetId())
+				} else {
+					records[record.GetId()] = record
+				}
+			}
+			return &databroker.PutResponse{Records: in.GetRecords()}, nil
+		},
+	}
+	for _, u := range []*user.User{
+		{Id: "OPERATOR", Email: "operator@example.com"},
+		{Id: "USER", Email: "user@example.com"},
+	} {
+		records[u.GetId()] = databroker.NewRecord(u)
+	}
+	records["SESSION"] = databroker.NewRecord(&session.Session{
+		Id:        "SESSION",
+		UserId:    "OPERATOR",
+		ExpiresAt: timestamppb.New(now.Add(8 * time.Hour)),
+	})
+
+	options := config.NewAtomicOptions()
+	opts := options.Load()
+	opts.ImpersonationAllowedUsers = []string{"operator@example.com"}
+	opts.ImpersonationTimeout = 15 * time.Minute
+	options.Store(opts)
+
+	a := &Authenticate{
+		state: atomicutil.NewValue(&authenticateState{
+			dataBrokerClient: client,
+		}),
+		options: options,
+	}
+	getSession := func(id string) *session.Session {
+		record, ok := records[id]
+		if !ok {
+			return nil
+		}
+		var s session.Session
+		require.NoError(t, record.GetData().UnmarshalTo(&s))
+		return &s
+	}
+
+	_, err := a.startImpersonation(ctx, &sessions.State{ID: "OTHER", Subject: "USER"}, "OPERATOR")
+	assert.ErrorIs(t, err, errImpersonationNotAllowed)
+	_, err = a.startImpersonation(ctx, &sessions.State{ID: "SESSION", Subject: "OPERATOR"}, "MISSING")
+	assert.ErrorIs(t, err, errImpersonationUnknownUser)
+	_, err = a.startImpersonation(ctx, &sessions.State{ID: "SESSION", Subject: "OPERATOR"}, "OPERATOR")
+	assert.ErrorIs(t, err, errImpersonationUnknownUser)
+
+	impersonated, err := a.startImpersonation(ctx, &sessions.State{ID: "SESSION", Subject: "OPERATOR"}, "USER")
+	require.NoError(t, err)
+	assert.Equal(t, "USER", impersonated.GetUserId())
+	assert.WithinDuration(t, now.Add(15*time.Minute), impersonated.GetExpiresAt().AsTime(), time.Second,
+		"impersonation should be time limited")
+	assert.Equal(t, impersonated.GetId(), getSession("SESSION").GetImpersonateSessionId())
+	assert.NotNil(t, getSession(impersonated.GetId()))
+
+	again, err := a.startImpersonation(ctx, &sessions.State{ID: "SESSION", Subject: "OPERATOR"}, "USER")
+	require.NoError(t, err)
+	assert.Nil(t, getSession(impersonated.GetId()), "should replace the previous impersonation")
+
+	require.NoError(t, a.stopImpersonation(ctx, &sessions.State{ID: "SESSION", Subject: "OPERATOR"}))
+	assert.Empty(t, getSession("SESSION").GetImpersonateSessionId())
+	assert.Nil(t, getSession(again.GetId()))
+}
@@ -0,0 +1,86 @@
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/kerberos"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// KerberosSignIn negotiates Kerberos with the browser (RFC 4559). On success
+// the user is redirected to the OAuth callback with a code, like any other
+// identity provider. Browsers which don't negotiate are sent to the fallback
+// identity provider, if there is one.
+func (a *Authenticate) KerberosSignIn(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	encodedState := r.FormValue("state")
+	redirectURL, err := a.getRedirectURLFromState(encodedState)
+	if err != nil {
+		return err
+	}
+
+	idpID := a.getIdentityProviderIDForURLValues(redirectURL.Query())
+	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
+	if err != nil {
+		return err
+	}
+	provider, ok := authenticator.(*kerberos.Provider)
+	if !ok {
+		return httputil.NewError(http.StatusNotFound, errors.New("identity provider is not kerberos"))
+	}
+
+	fallbackURL, err := a.getIdentityProviderFallbackURL(redirectURL, idpID)
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	token, ok := getNegotiateToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Negotiate")
+		if fallbackURL == "" {
+			return httputil.NewError(http.StatusUnauthorized, errors.New("kerberos authentication required"))
+		}
+		// browsers which negotiate retry the request, the others render the
+		// body of the challenge, which continues to the fallback
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `<!DOCTYPE html><meta http-equiv="refresh" content="0;url=%[1]s"><a href="%[1]s">Continue</a>`,
+			html.EscapeString(fallbackURL))
+		return nil
+	}
+
+	code, err := provider.Negotiate(r.Context(), token)
+	if err != nil {
+		log.FromRequest(r).Info().Err(err).Msg("authenticate: kerberos negotiation failed")
+		if fallbackURL != "" {
+			httputil.Redirect(w, r, fallbackURL, http.StatusFound)
+			return nil
+		}
+		return httputil.NewError(http.StatusUnauthorized, err)
+	}
+
+	callbackURL := *state.redirectURL
+	callbackURL.RawQuery = url.Values{
+		"code":  {code},
+		"state": {encodedState},
+	}.Encode()
+	httputil.Redirect(w, r, callbackURL.String(), http.StatusFound)
+	return nil
+}
+
+// getNegotiateToken returns the token of a Negotiate authorization header.
+func getNegotiateToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Negotiate") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,60 @@
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/pomerium/pomerium/internal/handlers"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/ldap"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// LDAPSignIn renders the sign in form of the LDAP identity provider and
+// verifies the submitted credentials. On success the user is redirected to the
+// OAuth callback with a code, like any other identity provider.
+func (a *Authenticate) LDAPSignIn(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	encodedState := r.FormValue("state")
+	redirectURL, err := a.getRedirectURLFromState(encodedState)
+	if err != nil {
+		return err
+	}
+
+	idpID := a.getIdentityProviderIDForURLValues(redirectURL.Query())
+	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
+	if err != nil {
+		return err
+	}
+	provider, ok := authenticator.(*ldap.Provider)
+	if !ok {
+		return httputil.NewError(http.StatusNotFound, errors.New("identity provider is not ldap"))
+	}
+
+	data := handlers.SignInData{State: encodedState}
+	if r.Method == http.MethodPost {
+		data.Username = r.FormValue("username")
+		code, err := provider.SignIn(r.Context(), data.Username, r.FormValue("password"))
+		switch {
+		case errors.Is(err, ldap.ErrInvalidCredentials):
+			log.FromRequest(r).Info().Str("username", data.Username).Msg("authenticate: invalid ldap credentials")
+			data.Error = "Invalid username or password."
+		case err != nil:
+			return httputil.NewError(http.StatusInternalServerError, err)
+		default:
+			callbackURL := *state.redirectURL
+			callbackURL.RawQuery = url.Values{
+				"code":  {code},
+				"state": {encodedState},
+			}.Encode()
+			httputil.Redirect(w, r, callbackURL.String(), http.StatusFound)
+			return nil
+		}
+	}
+
+	handlers.SignIn(data).ServeHTTP(w, r)
+	return nil
+}
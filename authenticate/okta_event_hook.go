@@ -0,0 +1,108 @@
+package authenticate
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// oktaEventHookPath is the path of the Okta event hook endpoint.
+const oktaEventHookPath = "/okta/event_hook"
+
+// maxOktaEventHookSize is the maximum size of an Okta event hook request.
+const maxOktaEventHookSize = 1 << 20
+
+// oktaRevokingEventTypes are the Okta event types which sign the target
+// users out everywhere.
+//
+// https://developer.okta.com/docs/reference/api/event-types/
+var oktaRevokingEventTypes = map[string]bool{
+	"user.lifecycle.deactivate":       true,
+	"user.lifecycle.suspend":          true,
+	"user.lifecycle.delete.initiated": true,
+	"user.session.clear":              true,
+	"user.account.update_password":    true,
+	"user.account.reset_password":     true,
+}
+
+type oktaEventHookRequest struct {
+	Data struct {
+		Events []struct {
+			UUID      string `json:"uuid"`
+			EventType string `json:"eventType"`
+			Target    []struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"target"`
+		} `json:"events"`
+	} `json:"data"`
+}
+
+// OktaEventHook handles Okta event hooks. Users who are deactivated, have
+// their Okta sessions cleared or change their password are signed out
+// everywhere immediately. Okta authenticates with the configured secret in the
+// Authorization header.
+//
+// https://developer.okta.com/docs/concepts/event-hooks/
+func (a *Authenticate) OktaEventHook(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	if options.OktaEventHookSecret == "" || state.sessionServiceClient == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("okta event hooks are not enabled"))
+	}
+	expected := sha256.Sum256([]byte(options.OktaEventHookSecret))
+	actual := sha256.Sum256([]byte(r.Header.Get("Authorization")))
+	if subtle.ConstantTimeCompare(expected[:], actual[:]) != 1 {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("invalid okta event hook secret"))
+	}
+
+	// one-time verification when the event hook is registered
+	if r.Method == http.MethodGet {
+		httputil.RenderJSON(w, http.StatusOK, map[string]string{
+			"verification": r.Header.Get("X-Okta-Verification-Challenge"),
+		})
+		return nil
+	}
+
+	var req oktaEventHookRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxOktaEventHookSize)).Decode(&req)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid okta event hook request: %w", err))
+	}
+
+	for _, event := range req.Data.Events {
+		if !oktaRevokingEventTypes[event.EventType] {
+			continue
+		}
+		for _, target := range event.Target {
+			if target.Type != "User" || target.ID == "" {
+				continue
+			}
+
+			res, err := state.sessionServiceClient.SignOutAll(ctx, &session.SignOutAllRequest{UserId: target.ID})
+			if err != nil {
+				return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error signing out user: %w", err))
+			}
+
+			log.FromRequest(r).Info().
+				Str("event_uuid", event.UUID).
+				Str("event_type", event.EventType).
+				Str("user_id", target.ID).
+				Strs("session_ids", res.GetSessionIds()).
+				Msg("authenticate: signed out user via okta event hook")
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
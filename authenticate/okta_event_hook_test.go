@@ -0,0 +1,69 @@
+package authenticate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestAuthenticate_OktaEventHook(t *testing.T) {
+	t.Parallel()
+
+	var signedOut []string
+	options := config.NewDefaultOptions()
+	options.OktaEventHookSecret = "SECRET"
+	a := &Authenticate{
+		state: atomicutil.NewValue(&authenticateState{
+			sessionServiceClient: mockSessionServiceClient{
+				signOutAll: func(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error) {
+					signedOut = append(signedOut, in.GetUserId())
+					return &session.SignOutAllResponse{}, nil
+				},
+			},
+		}),
+		options: config.NewAtomicOptions(),
+	}
+	a.options.Store(options)
+
+	do := func(method, secret, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "https://authenticate.example.com"+oktaEventHookPath, strings.NewReader(body))
+		r.Header.Set("Authorization", secret)
+		r.Header.Set("X-Okta-Verification-Challenge", "CHALLENGE")
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(a.OktaEventHook).ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "WRONG", "").Code)
+
+	w := do(http.MethodGet, "SECRET", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var verification map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &verification))
+	assert.Equal(t, "CHALLENGE", verification["verification"])
+
+	w = do(http.MethodPost, "SECRET", `{"data": {"events": [
+		{"eventType": "user.lifecycle.deactivate", "target": [{"id": "00u1", "type": "User"}]},
+		{"eventType": "user.session.start", "target": [{"id": "00u2", "type": "User"}]},
+		{"eventType": "user.account.update_password", "target": [{"id": "00g1", "type": "UserGroup"}, {"id": "00u3", "type": "User"}]}
+	]}}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"00u1", "00u3"}, signedOut)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "SECRET", "{").Code)
+
+	options = config.NewDefaultOptions()
+	a.options.Store(options)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "", "").Code)
+}
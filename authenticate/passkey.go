@@ -0,0 +1,307 @@
+package authenticate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/handlers"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/passkey"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/webauthnutil"
+	"github.com/pomerium/webauthn"
+)
+
+// passkeyError is an error shown to the user on the passkey sign in page.
+type passkeyError string
+
+func (err passkeyError) Error() string { return string(err) }
+
+const (
+	errPasskeyNotRegistered      passkeyError = "This passkey isn't registered."
+	errPasskeyUsernameRequired   passkeyError = "Enter a username."
+	errPasskeyRegistrationDenied passkeyError = "You aren't allowed to register a passkey."
+	errPasskeyInvalidRecovery    passkeyError = "Invalid recovery code."
+)
+
+// PasskeySignIn renders the sign in page of the passkey identity provider and
+// handles the WebAuthn ceremonies to sign in and to register passkeys. On
+// success the user is redirected to the OAuth callback with a code, like any
+// other identity provider.
+func (a *Authenticate) PasskeySignIn(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	encodedState := r.FormValue("state")
+	redirectURL, err := a.getRedirectURLFromState(encodedState)
+	if err != nil {
+		return err
+	}
+
+	idpID := a.getIdentityProviderIDForURLValues(redirectURL.Query())
+	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
+	if err != nil {
+		return err
+	}
+	provider, ok := authenticator.(*passkey.Provider)
+	if !ok {
+		return httputil.NewError(http.StatusNotFound, errors.New("identity provider is not passkey"))
+	}
+
+	selfURL := *r.URL
+	selfURL.RawQuery = url.Values{"state": {encodedState}}.Encode()
+	data := handlers.PasskeySignInData{
+		State:               encodedState,
+		SelfURL:             selfURL.String(),
+		RegistrationEnabled: provider.RegistrationEnabled(),
+	}
+	deviceType := webauthnutil.GetDeviceType(r.Context(), state.dataBrokerClient, webauthnutil.PasskeyDeviceType)
+
+	var u *passkey.User
+	switch r.FormValue("action") {
+	case "authenticate":
+		u, err = a.authenticatePasskey(r, deviceType)
+	case "begin_register":
+		data.Username = r.FormValue("username")
+		data.RecoveryCode = r.FormValue("recovery_code")
+		var pu *user.User
+		pu, _, err = a.getPasskeyRegistrationUser(r.Context(), provider, data.Username, data.RecoveryCode)
+		if err == nil {
+			data.CreationOptions = webauthnutil.GenerateCreationOptions(r, state.sharedKey, deviceType, pu)
+		}
+	case "register":
+		u, data.RecoveryCodes, err = a.registerPasskey(r, provider, deviceType)
+	}
+	var pkErr passkeyError
+	if errors.As(err, &pkErr) {
+		log.FromRequest(r).Info().Err(err).Str("username", data.Username).Msg("authenticate: passkey sign in failed")
+		data.Error = pkErr.Error()
+	} else if err != nil {
+		return err
+	}
+
+	if u != nil {
+		code, err := provider.IssueCode(u)
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, err)
+		}
+		callbackURL := *state.redirectURL
+		callbackURL.RawQuery = url.Values{
+			"code":  {code},
+			"state": {encodedState},
+		}.Encode()
+
+		// recovery codes are only shown once, before continuing
+		if len(data.RecoveryCodes) == 0 {
+			httputil.Redirect(w, r, callbackURL.String(), http.StatusFound)
+			return nil
+		}
+		data.ContinueURL = callbackURL.String()
+	}
+
+	data.RequestOptions = webauthnutil.GenerateRequestOptions(r, state.sharedKey, deviceType, nil)
+	handlers.PasskeySignIn(data).ServeHTTP(w, r)
+	return nil
+}
+
+// authenticatePasskey verifies a passkey assertion and returns the user who
+// owns the passkey.
+func (a *Authenticate) authenticatePasskey(r *http.Request, deviceType *device.Type) (*passkey.User, error) {
+	ctx := r.Context()
+	state := a.state.Load()
+
+	var credential webauthn.PublicKeyAssertionCredential
+	err := json.Unmarshal([]byte(r.FormValue("authenticate_response")), &credential)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, errors.New("invalid authenticate response"))
+	}
+
+	requestOptions, err := webauthnutil.GetRequestOptionsForCredential(r, state.sharedKey, deviceType, nil, &credential)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid request options: %w", err))
+	}
+
+	serverCredential, err := webauthnutil.GetRelyingParty(r, state.dataBrokerClient).
+		VerifyAuthenticationCeremony(ctx, requestOptions, &credential)
+	if errors.Is(err, webauthn.ErrCredentialNotFound) {
+		return nil, errPasskeyNotRegistered
+	} else if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("error verifying authentication: %w", err))
+	}
+
+	deviceCredentialID := webauthnutil.GetDeviceCredentialID(serverCredential.ID)
+	deviceCredential, err := device.GetCredential(ctx, state.dataBrokerClient, deviceCredentialID)
+	if status.Code(err) == codes.NotFound {
+		return nil, errPasskeyNotRegistered
+	} else if err != nil {
+		return nil, httputil.NewError(http.StatusInternalServerError, err)
+	}
+	// only passkeys can be used to sign in, not other device credentials
+	if deviceCredential.GetTypeId() != webauthnutil.PasskeyDeviceType {
+		return nil, errPasskeyNotRegistered
+	}
+
+	pu, err := user.Get(ctx, state.dataBrokerClient, deviceCredential.GetUserId())
+	if status.Code(err) == codes.NotFound {
+		return nil, errPasskeyNotRegistered
+	} else if err != nil {
+		return nil, httputil.NewError(http.StatusInternalServerError, err)
+	}
+	// the passkey may have been removed from the user
+	if !pu.HasDeviceCredentialID(deviceCredentialID) {
+		return nil, errPasskeyNotRegistered
+	}
+
+	return &passkey.User{ID: pu.GetId(), Name: pu.GetName(), Email: pu.GetEmail()}, nil
+}
+
+// registerPasskey verifies a passkey registration and saves the passkey. The
+// recovery codes of users registering their first passkey are returned.
+func (a *Authenticate) registerPasskey(r *http.Request, provider *passkey.Provider, deviceType *device.Type) (*passkey.User, []string, error) {
+	ctx := r.Context()
+	state := a.state.Load()
+
+	pu, recoveryCodes, err := a.getPasskeyRegistrationUser(ctx, provider, r.FormValue("username"), r.FormValue("recovery_code"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var credential webauthn.PublicKeyCreationCredential
+	err = json.Unmarshal([]byte(r.FormValue("register_response")), &credential)
+	if err != nil {
+		return nil, nil, httputil.NewError(http.StatusBadRequest, errors.New("invalid register response"))
+	}
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	creationOptions, err := webauthnutil.GetCreationOptionsForCredential(r, state.sharedKey, deviceType, pu, &credential)
+	if err != nil {
+		return nil, nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid register options: %w", err))
+	}
+	creationOptionsJSON, err := json.Marshal(creationOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverCredential, err := webauthnutil.GetRelyingParty(r, state.dataBrokerClient).
+		VerifyRegistrationCeremony(ctx, creationOptions, &credential)
+	if err != nil {
+		return nil, nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("error verifying registration: %w", err))
+	}
+
+	deviceCredentialID := webauthnutil.GetDeviceCredentialID(serverCredential.ID)
+	deviceEnrollment := &device.Enrollment{
+		Id:           uuid.New().String(),
+		TypeId:       deviceType.GetId(),
+		UserId:       pu.GetId(),
+		CredentialId: deviceCredentialID,
+		EnrolledAt:   timestamppb.Now(),
+		UserAgent:    r.UserAgent(),
+		IpAddress:    httputil.GetClientIPAddress(r),
+	}
+	err = device.PutEnrollment(ctx, state.dataBrokerClient, deviceEnrollment)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = device.PutCredential(ctx, state.dataBrokerClient, &device.Credential{
+		Id:           deviceCredentialID,
+		TypeId:       deviceType.GetId(),
+		EnrollmentId: deviceEnrollment.GetId(),
+		UserId:       pu.GetId(),
+		Specifier: &device.Credential_Webauthn{
+			Webauthn: &device.Credential_WebAuthn{
+				Id:        serverCredential.ID,
+				PublicKey: serverCredential.PublicKey,
+
+				RegisterOptions:  creationOptionsJSON,
+				RegisterResponse: credentialJSON,
+			},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// users registering their first passkey get new recovery codes
+	var codes []string
+	if recoveryCodes == nil {
+		var hashes [][]byte
+		codes, hashes, err = passkey.GenerateRecoveryCodes()
+		if err != nil {
+			return nil, nil, err
+		}
+		recoveryCodes = &user.PasskeyRecoveryCodes{Id: pu.GetId(), Hashes: hashes}
+	}
+
+	pu.AddDeviceCredentialID(deviceCredentialID)
+	_, err = databroker.Put(ctx, state.dataBrokerClient, pu, recoveryCodes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.FromRequest(r).Info().Str("user_id", pu.GetId()).Msg("authenticate: registered passkey")
+	return &passkey.User{ID: pu.GetId(), Name: pu.GetName(), Email: pu.GetEmail()}, codes, nil
+}
+
+// getPasskeyRegistrationUser returns the user a passkey may be registered
+// for. Users who already registered a passkey need a recovery code to
+// register another one, in which case the remaining recovery codes are also
+// returned.
+func (a *Authenticate) getPasskeyRegistrationUser(
+	ctx context.Context,
+	provider *passkey.Provider,
+	username, recoveryCode string,
+) (*user.User, *user.PasskeyRecoveryCodes, error) {
+	state := a.state.Load()
+
+	userID := passkey.NormalizeUsername(username)
+	if userID == "" {
+		return nil, nil, errPasskeyUsernameRequired
+	}
+
+	pu, err := user.Get(ctx, state.dataBrokerClient, userID)
+	if status.Code(err) == codes.NotFound {
+		pu = &user.User{Id: userID}
+	} else if err != nil {
+		return nil, nil, httputil.NewError(http.StatusInternalServerError, err)
+	}
+	if pu.Name == "" {
+		pu.Name = userID
+	}
+	if pu.Email == "" && strings.Contains(userID, "@") {
+		pu.Email = userID
+	}
+
+	recoveryCodes := &user.PasskeyRecoveryCodes{Id: userID}
+	err = databroker.Get(ctx, state.dataBrokerClient, recoveryCodes)
+	if status.Code(err) == codes.NotFound {
+		if !provider.CanRegister(userID) {
+			return nil, nil, errPasskeyRegistrationDenied
+		}
+		return pu, nil, nil
+	} else if err != nil {
+		return nil, nil, httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	var ok bool
+	recoveryCodes.Hashes, ok = passkey.UseRecoveryCode(recoveryCodes.GetHashes(), recoveryCode)
+	if !ok {
+		return nil, nil, errPasskeyInvalidRecovery
+	}
+	return pu, recoveryCodes, nil
+}
@@ -0,0 +1,38 @@
+package authenticate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// authenticateAPIUser returns the id and email of the user of a Pomerium
+// session or service account JWT, which policy namespace admins and access
+// request approvers authenticate with. The user id is empty if the JWT is
+// invalid, expired or revoked.
+func (state *authenticateState) authenticateAPIUser(ctx context.Context, token string) (userID, email string, err error) {
+	var subject sessions.State
+	if err := state.sharedEncoder.Unmarshal([]byte(token), &subject); err != nil {
+		return "", "", nil
+	}
+	userID, expiresAt, err := getSubjectUser(ctx, state.dataBrokerClient, subject.ID)
+	if err != nil {
+		return "", "", err
+	} else if userID == "" || (!expiresAt.IsZero() && !expiresAt.After(time.Now())) {
+		return "", "", nil
+	}
+
+	u, err := user.Get(ctx, state.dataBrokerClient, userID)
+	if err == nil {
+		email = u.GetEmail()
+	} else if status.Code(err) != codes.NotFound {
+		return "", "", fmt.Errorf("authenticate: error loading user: %w", err)
+	}
+	return userID, email, nil
+}
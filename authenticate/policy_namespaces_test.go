@@ -0,0 +1,80 @@
+package authenticate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestAuthenticateAPIUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	records := map[string]*databroker.Record{}
+	for _, msg := range []interface {
+		proto.Message
+		GetId() string
+	}{
+		&session.Session{Id: "SESSION", UserId: "USER", ExpiresAt: timestamppb.New(now.Add(time.Hour))},
+		&session.Session{Id: "EXPIRED", UserId: "USER", ExpiresAt: timestamppb.New(now.Add(-time.Minute))},
+		&user.ServiceAccount{Id: "SERVICE_ACCOUNT", UserId: "SERVICE"},
+		&user.User{Id: "USER", Email: "user@example.com"},
+	} {
+		records[msg.GetId()] = databroker.NewRecord(msg)
+	}
+
+	sharedEncoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+	state := &authenticateState{
+		sharedEncoder: sharedEncoder,
+		dataBrokerClient: mockDataBrokerServiceClient{
+			get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+				record, ok := records[in.GetId()]
+				if !ok || record.GetType() != in.GetType() {
+					return nil, status.Error(codes.NotFound, "not found")
+				}
+				return &databroker.GetResponse{Record: record}, nil
+			},
+		},
+	}
+	authenticate := func(sessionID string) (string, string) {
+		rawJWT, err := sharedEncoder.Marshal(&sessions.State{ID: sessionID})
+		require.NoError(t, err)
+		userID, email, err := state.authenticateAPIUser(ctx, string(rawJWT))
+		require.NoError(t, err)
+		return userID, email
+	}
+
+	userID, email := authenticate("SESSION")
+	assert.Equal(t, "USER", userID)
+	assert.Equal(t, "user@example.com", email)
+
+	userID, email = authenticate("SERVICE_ACCOUNT")
+	assert.Equal(t, "SERVICE", userID)
+	assert.Empty(t, email)
+
+	userID, _ = authenticate("EXPIRED")
+	assert.Empty(t, userID)
+	userID, _ = authenticate("MISSING")
+	assert.Empty(t, userID)
+
+	userID, _, err = state.authenticateAPIUser(ctx, "invalid")
+	assert.NoError(t, err)
+	assert.Empty(t, userID)
+}
@@ -0,0 +1,204 @@
+package authenticate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// rememberedDeviceIDLength is the number of random bytes used for a
+// remembered device id.
+const rememberedDeviceIDLength = 32
+
+// RememberDevice handles the opt-in to the "remember this device" flow. It
+// issues a long-lived remember me cookie for the current session.
+func (a *Authenticate) RememberDevice(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	if options.RememberMeExpire <= 0 {
+		return httputil.NewError(http.StatusNotFound, errors.New("remember me is not enabled"))
+	}
+
+	s, err := a.getSessionFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	profile, err := loadIdentityProfile(r, state.cookieCipher)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	if err := a.rememberDevice(ctx, w, r, s, profile); err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	httputil.Redirect(w, r, "/.pomerium/", http.StatusFound)
+	return nil
+}
+
+// rememberDevice persists the identity profile of the session in the
+// databroker and sets the remember me cookie referencing it.
+func (a *Authenticate) rememberDevice(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	s *sessions.State,
+	profile *identitypb.Profile,
+) error {
+	state := a.state.Load()
+
+	rawProfile, err := protojson.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("authenticate: error marshaling identity profile: %w", err)
+	}
+
+	now := time.Now()
+	id := cryptutil.NewRandomStringN(rememberedDeviceIDLength)
+	device := &session.RememberedDevice{
+		Id:                 id,
+		UserId:             s.UserID(),
+		IdentityProviderId: s.IdentityProviderID,
+		EncryptedProfile:   cryptutil.Encrypt(state.cookieCipher, rawProfile, []byte(id)),
+		CreatedAt:          timestamppb.New(now),
+		ExpiresAt:          timestamppb.New(now.Add(state.rememberMeOptions.Expire)),
+	}
+	_, err = databroker.Put(ctx, state.dataBrokerClient, device)
+	if err != nil {
+		return fmt.Errorf("authenticate: error saving remembered device: %w", err)
+	}
+
+	state.rememberMeOptions.SetCookie(w, state.rememberMeOptions.NewCookie(r, id))
+	return nil
+}
+
+// restoreRememberedDevice restores the session and identity profile cookies
+// from the remember me cookie. It returns sessions.ErrNoSessionFound if the
+// device isn't remembered for the identity provider.
+func (a *Authenticate) restoreRememberedDevice(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	idpID string,
+) error {
+	state := a.state.Load()
+	if state.rememberMeOptions.Expire <= 0 || state.dataBrokerClient == nil {
+		return sessions.ErrNoSessionFound
+	}
+
+	c, err := r.Cookie(state.rememberMeOptions.Name)
+	if err != nil || c.Value == "" {
+		return sessions.ErrNoSessionFound
+	}
+
+	device := &session.RememberedDevice{Id: c.Value}
+	err = databroker.Get(ctx, state.dataBrokerClient, device)
+	if status.Code(err) == codes.NotFound {
+		return sessions.ErrNoSessionFound
+	} else if err != nil {
+		return fmt.Errorf("authenticate: error loading remembered device: %w", err)
+	}
+
+	if device.GetExpiresAt().AsTime().Before(time.Now()) ||
+		device.GetIdentityProviderId() != idpID {
+		return sessions.ErrNoSessionFound
+	}
+
+	rawProfile, err := cryptutil.Decrypt(state.cookieCipher, device.GetEncryptedProfile(), []byte(device.GetId()))
+	if err != nil {
+		return fmt.Errorf("authenticate: error decrypting remembered device profile: %w", err)
+	}
+	var profile identitypb.Profile
+	err = protojson.Unmarshal(rawProfile, &profile)
+	if err != nil {
+		return fmt.Errorf("authenticate: error unmarshaling remembered device profile: %w", err)
+	}
+
+	s := sessions.NewState(idpID)
+	rawClaims, err := json.Marshal(profile.GetClaims().AsMap())
+	if err != nil {
+		return fmt.Errorf("authenticate: error marshaling remembered device claims: %w", err)
+	}
+	err = json.Unmarshal(rawClaims, s)
+	if err != nil {
+		return fmt.Errorf("authenticate: error unmarshaling session state: %w", err)
+	}
+	newState := s.WithNewIssuer(state.redirectURL.Hostname(), []string{state.redirectURL.Hostname()})
+
+	storeIdentityProfile(w, state.cookieCipher, &profile)
+	if err := state.sessionStore.SaveSession(w, r, &newState); err != nil {
+		return fmt.Errorf("authenticate: error saving remembered session: %w", err)
+	}
+	return nil
+}
+
+// forgetRememberedDevice revokes the remembered device, if any, and clears
+// the remember me cookie.
+func (a *Authenticate) forgetRememberedDevice(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	state := a.state.Load()
+
+	c, err := r.Cookie(state.rememberMeOptions.Name)
+	if err != nil || c.Value == "" {
+		return
+	}
+
+	if state.dataBrokerClient != nil {
+		any := protoutil.NewAny(&session.RememberedDevice{Id: c.Value})
+		_, err = state.dataBrokerClient.Put(ctx, &databroker.PutRequest{
+			Records: []*databroker.Record{{
+				Type:      any.GetTypeUrl(),
+				Id:        c.Value,
+				Data:      any,
+				DeletedAt: timestamppb.Now(),
+			}},
+		})
+		if err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("authenticate: failed to revoke remembered device")
+		}
+	}
+
+	cleared := state.rememberMeOptions.NewCookie(r, "")
+	cleared.MaxAge = -1
+	cleared.Expires = time.Unix(0, 0)
+	state.rememberMeOptions.SetCookie(w, cleared)
+}
+
+// reauthenticateOrRestore restores the session from a remembered device if
+// possible and otherwise starts the authenticate process.
+func (a *Authenticate) reauthenticateOrRestore(w http.ResponseWriter, r *http.Request, err error) error {
+	ctx := r.Context()
+	idpID := a.getIdentityProviderIDForRequest(r)
+
+	restoreErr := a.restoreRememberedDevice(ctx, w, r, idpID)
+	if restoreErr == nil {
+		// retry the request with the restored cookies
+		httputil.Redirect(w, r, r.URL.RequestURI(), http.StatusFound)
+		return nil
+	} else if !errors.Is(restoreErr, sessions.ErrNoSessionFound) {
+		log.FromRequest(r).Info().
+			Err(restoreErr).
+			Str("idp_id", idpID).
+			Msg("authenticate: remembered device restore error")
+	}
+
+	return a.reauthenticateOrFail(w, r, err)
+}
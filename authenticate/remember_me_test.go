@@ -0,0 +1,142 @@
+package authenticate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	mstore "github.com/pomerium/pomerium/internal/sessions/mock"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
+)
+
+func TestAuthenticate_RememberedDevice(t *testing.T) {
+	t.Parallel()
+
+	records := map[string]*databroker.Record{}
+	client := mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			record, ok := records[in.GetId()]
+			if !ok {
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+			return &databroker.GetResponse{Record: record}, nil
+		},
+		put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+			for _, record := range in.GetRecords() {
+				if record.GetDeletedAt() != nil {
+					delete(records, record.GetId())
+				} else {
+					records[record.GetId()] = record
+				}
+			}
+			return &databroker.PutResponse{Records: in.GetRecords()}, nil
+		},
+	}
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	require.NoError(t, err)
+	signer, err := jws.NewHS256Signer(nil)
+	require.NoError(t, err)
+
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(),
+		state: atomicutil.NewValue(&authenticateState{
+			redirectURL:   uriParseHelper("https://authenticate.example.com"),
+			sessionStore:  &mstore.Store{},
+			cookieCipher:  aead,
+			sharedEncoder: signer,
+			rememberMeOptions: cookie.Options{
+				Name:   "_pomerium_authenticate_remember",
+				Expire: time.Hour,
+			},
+			dataBrokerClient: client,
+		}),
+		options: config.NewAtomicOptions(),
+	}
+
+	claims, err := structpb.NewStruct(map[string]any{"sub": "USER_ID"})
+	require.NoError(t, err)
+	profile := &identitypb.Profile{ProviderId: "IDP", Claims: claims}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "https://authenticate.example.com/.pomerium/remember_device", nil)
+	err = a.rememberDevice(context.Background(), w, r, &sessions.State{Subject: "USER_ID", IdentityProviderID: "IDP"}, profile)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	rememberCookie := cookies[0]
+	assert.Equal(t, "_pomerium_authenticate_remember", rememberCookie.Name)
+
+	t.Run("restore", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/", nil)
+		r.AddCookie(rememberCookie)
+		err := a.restoreRememberedDevice(context.Background(), w, r, "IDP")
+		assert.NoError(t, err)
+
+		r = httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/", nil)
+		for _, c := range w.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		restored, err := loadIdentityProfile(r, aead)
+		require.NoError(t, err)
+		assert.Equal(t, "USER_ID", restored.GetClaims().AsMap()["sub"])
+	})
+	t.Run("other identity provider", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/", nil)
+		r.AddCookie(rememberCookie)
+		err := a.restoreRememberedDevice(context.Background(), w, r, "OTHER")
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+	t.Run("no cookie", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/", nil)
+		err := a.restoreRememberedDevice(context.Background(), w, r, "IDP")
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+	t.Run("verify session", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/?"+urlutil.QueryIdentityProviderID+"=IDP", nil)
+		r.AddCookie(rememberCookie)
+		r = r.WithContext(sessions.NewContext(r.Context(), "", sessions.ErrNoSessionFound))
+		a.VerifySession(http.NotFoundHandler()).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "/.pomerium/?"+urlutil.QueryIdentityProviderID+"=IDP", w.Header().Get("Location"))
+	})
+	t.Run("forget", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/sign_out", nil)
+		r.AddCookie(rememberCookie)
+		a.forgetRememberedDevice(context.Background(), w, r)
+		assert.Empty(t, records)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, -1, cookies[0].MaxAge)
+
+		w = httptest.NewRecorder()
+		err := a.restoreRememberedDevice(context.Background(), w, r, "IDP")
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+}
@@ -0,0 +1,84 @@
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/saml"
+)
+
+// SAMLMetadata serves the SAML service provider metadata of the identity
+// provider selected by the request.
+func (a *Authenticate) SAMLMetadata(w http.ResponseWriter, r *http.Request) error {
+	provider, err := a.getSAMLProvider(a.getIdentityProviderIDForRequest(r))
+	if err != nil {
+		return err
+	}
+
+	metadata, err := provider.Metadata()
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, err = w.Write(metadata)
+	return err
+}
+
+// SAMLAssertionConsumerService handles SAML responses posted by the identity
+// provider. The response is verified and the user is redirected to the OAuth
+// callback with a code, like any other identity provider.
+//
+// Identity providers post the response from their own origin, so the csrf
+// cookie isn't available. The relay state is the OAuth state, and its csrf
+// nonce is verified by the callback.
+func (a *Authenticate) SAMLAssertionConsumerService(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+
+	relayState := r.FormValue("RelayState")
+	redirectURL, err := a.getRedirectURLFromState(relayState)
+	if err != nil {
+		return err
+	}
+	provider, err := a.getSAMLProvider(a.getIdentityProviderIDForURLValues(redirectURL.Query()))
+	if err != nil {
+		return err
+	}
+
+	code, err := provider.NewCode(r.Context(), a.getSAMLCodeOptions(), r.FormValue("SAMLResponse"), relayState)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	callbackURL := *state.redirectURL
+	callbackURL.RawQuery = url.Values{
+		"code":  {code},
+		"state": {relayState},
+	}.Encode()
+	httputil.Redirect(w, r, callbackURL.String(), http.StatusFound)
+	return nil
+}
+
+func (a *Authenticate) getSAMLProvider(idpID string) (*saml.Provider, error) {
+	authenticator, err := a.cfg.getIdentityProvider(a.options.Load(), idpID)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := authenticator.(*saml.Provider)
+	if !ok {
+		return nil, httputil.NewError(http.StatusNotFound, errors.New("identity provider is not saml"))
+	}
+	return provider, nil
+}
+
+// getSAMLCodeOptions returns the options used to issue and redeem SAML codes.
+// Codes are sealed with the shared secret, so that any authenticate service
+// instance can redeem them.
+func (a *Authenticate) getSAMLCodeOptions() *saml.CodeOptions {
+	state := a.state.Load()
+	return &saml.CodeOptions{
+		Cipher:           state.sharedCipher,
+		DataBrokerClient: state.dataBrokerClient,
+	}
+}
@@ -0,0 +1,51 @@
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+// SCIM serves the SCIM provisioning endpoint, if it is enabled.
+func (a *Authenticate) SCIM(w http.ResponseWriter, r *http.Request) error {
+	h := a.state.Load().scimHandler
+	if h == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("scim provisioning is not enabled"))
+	}
+	h.ServeHTTP(w, r)
+	return nil
+}
+
+// ServiceAccounts serves the service account management API, if it is
+// enabled.
+func (a *Authenticate) ServiceAccounts(w http.ResponseWriter, r *http.Request) error {
+	h := a.state.Load().serviceAccountHandler
+	if h == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("service account api is not enabled"))
+	}
+	h.ServeHTTP(w, r)
+	return nil
+}
+
+// PolicyNamespaces serves the policy namespace API, if there are policy
+// namespaces.
+func (a *Authenticate) PolicyNamespaces(w http.ResponseWriter, r *http.Request) error {
+	h := a.state.Load().policyNamespaceHandler
+	if h == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("policy namespace api is not enabled"))
+	}
+	h.ServeHTTP(w, r)
+	return nil
+}
+
+// AccessRequests serves the access request API, if access requests are
+// enabled.
+func (a *Authenticate) AccessRequests(w http.ResponseWriter, r *http.Request) error {
+	h := a.state.Load().accessRequestHandler
+	if h == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("access requests are not enabled"))
+	}
+	h.ServeHTTP(w, r)
+	return nil
+}
@@ -0,0 +1,119 @@
+package authenticate
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pomerium/pomerium/internal/handlers"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
+)
+
+// getIdentityProviderChoices returns the identity providers users may choose
+// from to sign in to the route in the request params. nil is returned unless
+// there are several.
+func (a *Authenticate) getIdentityProviderChoices(requestParams url.Values) []*identitypb.Provider {
+	redirectURI := requestParams.Get(urlutil.QueryRedirectURI)
+	if redirectURI == "" {
+		return nil
+	}
+	idps, err := a.options.Load().GetIdentityProvidersForRequestURL(redirectURI)
+	if err != nil || len(idps) < 2 {
+		return nil
+	}
+	return idps
+}
+
+// getIdentityProviderChoice returns the identity provider the user chose, if
+// it is one of the choices for the route in the request params, or the
+// fallback of one of them.
+func (a *Authenticate) getIdentityProviderChoice(vs, requestParams url.Values) (string, bool) {
+	choice := vs.Get(urlutil.QueryIdentityProviderChoice)
+	if choice == "" {
+		return "", false
+	}
+	idpIDs := []string{requestParams.Get(urlutil.QueryIdentityProviderID)}
+	for _, idp := range a.getIdentityProviderChoices(requestParams) {
+		if idp.GetId() == choice {
+			return choice, true
+		}
+		idpIDs = append(idpIDs, idp.GetId())
+	}
+	// users who can't sign in with kerberos or a client certificate are sent
+	// to the fallback, and users of an identity provider which is down to the
+	// failover
+	for _, idpID := range idpIDs {
+		if fallback, err := a.options.Load().GetIdentityProviderFallback(idpID); err == nil && fallback == choice {
+			return choice, true
+		}
+		if failover, err := a.options.Load().GetIdentityProviderFailover(idpID); err == nil && failover == choice {
+			return choice, true
+		}
+	}
+	return "", false
+}
+
+// selectIdentityProvider renders a page for the user to choose an identity
+// provider. Each choice links back to the current request with the choice
+// added.
+func (a *Authenticate) selectIdentityProvider(w http.ResponseWriter, r *http.Request, idps []*identitypb.Provider) error {
+	options := a.options.Load()
+	state := a.state.Load()
+
+	var data handlers.SelectIdentityProviderData
+	for _, idp := range idps {
+		name, err := options.GetIdentityProviderName(idp.GetId())
+		if err != nil {
+			return err
+		}
+
+		u := state.redirectURL.ResolveReference(r.URL)
+		q := u.Query()
+		q.Set(urlutil.QueryIdentityProviderChoice, idp.GetId())
+		u.RawQuery = q.Encode()
+
+		data.IdentityProviders = append(data.IdentityProviders, handlers.IdentityProviderChoice{
+			Name: name,
+			URL:  u.String(),
+		})
+	}
+	handlers.SelectIdentityProvider(data).ServeHTTP(w, r)
+	return nil
+}
+
+// getIdentityProviderFallbackURL returns the URL which signs in with the
+// fallback of the identity provider with the given IDP id, given the sign in
+// URL stored in the state. An empty string is returned if there is none.
+func (a *Authenticate) getIdentityProviderFallbackURL(redirectURL *url.URL, idpID string) (string, error) {
+	fallbackID, err := a.options.Load().GetIdentityProviderFallback(idpID)
+	if err != nil || fallbackID == "" {
+		return "", err
+	}
+	u := *redirectURL
+	q := u.Query()
+	q.Set(urlutil.QueryIdentityProviderChoice, fallbackID)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// getIdentityProviderFailoverURL returns the URL which signs in with the
+// failover of the identity provider with the given IDP id, if it is down and
+// the failover isn't. An empty string is returned otherwise.
+func (a *Authenticate) getIdentityProviderFailoverURL(redirectURL *url.URL, idpID string) (string, error) {
+	if a.isIdentityProviderHealthy(idpID) {
+		return "", nil
+	}
+	failoverID, err := a.options.Load().GetIdentityProviderFailover(idpID)
+	if err != nil || failoverID == "" || !a.isIdentityProviderHealthy(failoverID) {
+		return "", err
+	}
+	u := *redirectURL
+	q := u.Query()
+	q.Set(urlutil.QueryIdentityProviderChoice, failoverID)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (a *Authenticate) isIdentityProviderHealthy(idpID string) bool {
+	return a.healthChecker == nil || a.healthChecker.IsHealthy(idpID)
+}
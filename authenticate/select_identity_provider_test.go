@@ -0,0 +1,74 @@
+package authenticate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/identity/healthcheck"
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+func TestAuthenticate_getIdentityProviderFailoverURL(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := config.NewDefaultOptions()
+	opts.Provider = "oidc"
+	opts.ProviderURL = srv.URL
+	opts.IDPHealthCheck = &config.IDPHealthCheckOptions{
+		Interval:           time.Hour,
+		UnhealthyThreshold: 1,
+		Failover:           "backup",
+	}
+	opts.IdentityProviders = []config.IdentityProviderOptions{{
+		Name:        "backup",
+		Provider:    "oidc",
+		ProviderURL: "https://backup.example.com",
+	}}
+	primary, err := opts.GetIdentityProviderForID("")
+	require.NoError(t, err)
+	backup, err := opts.GetIdentityProviderFailover(primary.GetId())
+	require.NoError(t, err)
+
+	options := config.NewAtomicOptions()
+	options.Store(opts)
+	a := &Authenticate{
+		options:       options,
+		state:         atomicutil.NewValue(newAuthenticateState()),
+		healthChecker: healthcheck.New(healthcheck.WithHTTPClient(srv.Client())),
+	}
+	redirectURL := &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/.pomerium/sign_in"}
+
+	failoverURL, err := a.getIdentityProviderFailoverURL(redirectURL, primary.GetId())
+	require.NoError(t, err)
+	assert.Empty(t, failoverURL, "should not fail over while the identity provider is healthy")
+
+	a.healthChecker.OnConfigChange(context.Background(), &config.Config{Options: opts})
+	t.Cleanup(func() {
+		a.healthChecker.OnConfigChange(context.Background(), &config.Config{Options: config.NewDefaultOptions()})
+	})
+	assert.Eventually(t, func() bool { return !a.isIdentityProviderHealthy(primary.GetId()) }, 5*time.Second, 10*time.Millisecond)
+
+	failoverURL, err = a.getIdentityProviderFailoverURL(redirectURL, primary.GetId())
+	require.NoError(t, err)
+	u, err := url.Parse(failoverURL)
+	require.NoError(t, err)
+	assert.Equal(t, backup, u.Query().Get(urlutil.QueryIdentityProviderChoice))
+
+	failoverURL, err = a.getIdentityProviderFailoverURL(redirectURL, backup)
+	require.NoError(t, err)
+	assert.Empty(t, failoverURL, "should not fail over from a healthy identity provider")
+}
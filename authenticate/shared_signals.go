@@ -0,0 +1,308 @@
+package authenticate
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// sharedSignalsPath is the path of the Shared Signals push delivery endpoint.
+const sharedSignalsPath = "/ssf/events"
+
+// maxSecurityEventTokenSize is the maximum size of a security event token.
+const maxSecurityEventTokenSize = 1 << 20
+
+// Shared Signals event types.
+//
+// https://openid.net/specs/openid-caep-specification-1_0.html
+// https://openid.net/specs/openid-risc-profile-specification-1_0.html
+const (
+	caepSessionRevoked         = "https://schemas.openid.net/secevent/caep/event-type/session-revoked"
+	caepCredentialChange       = "https://schemas.openid.net/secevent/caep/event-type/credential-change"
+	caepAssuranceLevelChange   = "https://schemas.openid.net/secevent/caep/event-type/assurance-level-change"
+	caepDeviceComplianceChange = "https://schemas.openid.net/secevent/caep/event-type/device-compliance-change"
+	riscAccountDisabled        = "https://schemas.openid.net/secevent/risc/event-type/account-disabled"
+	riscAccountPurged          = "https://schemas.openid.net/secevent/risc/event-type/account-purged"
+	riscCredentialCompromise   = "https://schemas.openid.net/secevent/risc/event-type/credential-compromise"
+	riscSessionsRevoked        = "https://schemas.openid.net/secevent/risc/event-type/sessions-revoked"
+)
+
+// A subjectIdentifier identifies the subject of a security event.
+//
+// https://www.rfc-editor.org/rfc/rfc9493.html
+type subjectIdentifier struct {
+	Format  string             `json:"format"`
+	Issuer  string             `json:"iss"`
+	Subject string             `json:"sub"`
+	Email   string             `json:"email"`
+	ID      string             `json:"id"`
+	User    *subjectIdentifier `json:"user"`
+	Session *subjectIdentifier `json:"session"`
+}
+
+type securityEvent struct {
+	Subject         *subjectIdentifier `json:"subject"`
+	CurrentStatus   string             `json:"current_status"`
+	ChangeDirection string             `json:"change_direction"`
+}
+
+type securityEventTokenClaims struct {
+	Issuer    string                   `json:"iss"`
+	Audience  jwt.Audience             `json:"aud"`
+	ID        string                   `json:"jti"`
+	SubjectID *subjectIdentifier       `json:"sub_id"`
+	Events    map[string]securityEvent `json:"events"`
+}
+
+// isRevoking returns true if the event revokes the sessions of its subject.
+// Events which lower the subject's assurance or device compliance revoke the
+// sessions too, so that the user signs in again and policies are evaluated
+// with the current claims.
+func (evt *securityEvent) isRevoking(eventType string) bool {
+	switch eventType {
+	case caepSessionRevoked, caepCredentialChange,
+		riscAccountDisabled, riscAccountPurged, riscCredentialCompromise, riscSessionsRevoked:
+		return true
+	case caepAssuranceLevelChange:
+		return evt.ChangeDirection == "decrease"
+	case caepDeviceComplianceChange:
+		return evt.CurrentStatus == "not-compliant"
+	}
+	return false
+}
+
+// SharedSignalsEvents receives Shared Signals (CAEP and RISC) security event
+// tokens pushed by identity providers. Events such as revoked sessions,
+// credential changes and compromised credentials revoke the sessions of their
+// subject immediately. Other events are acknowledged and ignored.
+//
+// https://www.rfc-editor.org/rfc/rfc8935.html
+func (a *Authenticate) SharedSignalsEvents(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	if len(options.SharedSignalsTransmitters) == 0 || state.sessionServiceClient == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("shared signals are not enabled"))
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxSecurityEventTokenSize))
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	rawSET := strings.TrimSpace(string(raw))
+
+	// the transmitter is found by the unverified issuer, then the token is
+	// verified with the transmitter's keys
+	tok, err := jwt.ParseSigned(rawSET)
+	if err != nil {
+		renderSharedSignalsError(w, http.StatusBadRequest, "invalid_request", "invalid security event token")
+		return nil
+	}
+	var unverified securityEventTokenClaims
+	if err := tok.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		renderSharedSignalsError(w, http.StatusBadRequest, "invalid_request", "invalid security event token claims")
+		return nil
+	}
+	transmitter := options.GetSharedSignalsTransmitter(unverified.Issuer)
+	if transmitter == nil {
+		renderSharedSignalsError(w, http.StatusBadRequest, "invalid_issuer", "unknown issuer")
+		return nil
+	}
+
+	if transmitter.AuthorizationHeader != "" {
+		expected := sha256.Sum256([]byte(transmitter.AuthorizationHeader))
+		actual := sha256.Sum256([]byte(r.Header.Get("Authorization")))
+		if subtle.ConstantTimeCompare(expected[:], actual[:]) != 1 {
+			renderSharedSignalsError(w, http.StatusUnauthorized, "authentication_failed", "invalid authorization")
+			return nil
+		}
+	}
+
+	var claims securityEventTokenClaims
+	if err := a.cfg.jwksFetcher.VerifyJWT(ctx, transmitter.JWKSURL, rawSET, &claims); err != nil {
+		log.FromRequest(r).Warn().Err(err).Str("issuer", transmitter.Issuer).
+			Msg("authenticate: invalid security event token")
+		renderSharedSignalsError(w, http.StatusBadRequest, "invalid_key", "invalid security event token signature")
+		return nil
+	}
+	audience, err := getSharedSignalsAudience(options, transmitter)
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	if !claims.Audience.Contains(audience) {
+		renderSharedSignalsError(w, http.StatusBadRequest, "invalid_audience", "unexpected audience")
+		return nil
+	}
+
+	eventTypes := make([]string, 0, len(claims.Events))
+	for eventType := range claims.Events {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	for _, eventType := range eventTypes {
+		evt := claims.Events[eventType]
+		if !evt.isRevoking(eventType) {
+			continue
+		}
+
+		subject := evt.Subject
+		if subject == nil {
+			subject = claims.SubjectID
+		}
+		sessionIDs, err := a.revokeSecurityEventSubject(ctx, subject)
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, err)
+		}
+
+		log.FromRequest(r).Info().
+			Str("issuer", claims.Issuer).
+			Str("jti", claims.ID).
+			Str("event_type", eventType).
+			Strs("session_ids", sessionIDs).
+			Msg("authenticate: revoked sessions via shared signals")
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// revokeSecurityEventSubject revokes the sessions of the subject of a
+// security event. A subject with a session only revokes the sessions created
+// from that identity provider session, otherwise the user is signed out
+// everywhere.
+func (a *Authenticate) revokeSecurityEventSubject(ctx context.Context, subject *subjectIdentifier) ([]string, error) {
+	state := a.state.Load()
+
+	var sid string
+	if subject != nil && subject.Format == "complex" {
+		if subject.Session != nil {
+			sid = subject.Session.ID
+		}
+		subject = subject.User
+	}
+
+	userIDs, err := a.getSecurityEventUserIDs(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionIDs []string
+	for _, userID := range userIDs {
+		if sid != "" {
+			res, err := state.sessionServiceClient.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+				Target: &session.RevokeSessionsRequest_IdentityProviderSession{
+					IdentityProviderSession: &session.IdentityProviderSession{
+						Sid:    sid,
+						UserId: userID,
+					},
+				},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("authenticate: error revoking sessions: %w", err)
+			}
+			sessionIDs = append(sessionIDs, res.GetSessionIds()...)
+			continue
+		}
+
+		res, err := state.sessionServiceClient.SignOutAll(ctx, &session.SignOutAllRequest{UserId: userID})
+		if err != nil {
+			return nil, fmt.Errorf("authenticate: error signing out user: %w", err)
+		}
+		sessionIDs = append(sessionIDs, res.GetSessionIds()...)
+	}
+	return sessionIDs, nil
+}
+
+// getSecurityEventUserIDs returns the ids of the users a subject identifier
+// refers to. Users are identified by their subject at the identity provider,
+// an opaque id or their email address.
+func (a *Authenticate) getSecurityEventUserIDs(ctx context.Context, subject *subjectIdentifier) ([]string, error) {
+	if subject == nil {
+		return nil, nil
+	}
+
+	switch subject.Format {
+	case "iss_sub":
+		if subject.Subject != "" {
+			return []string{subject.Subject}, nil
+		}
+	case "opaque":
+		if subject.ID != "" {
+			return []string{subject.ID}, nil
+		}
+	case "email":
+		if subject.Email != "" {
+			return a.getUserIDsByEmail(ctx, subject.Email)
+		}
+	}
+	return nil, nil
+}
+
+func (a *Authenticate) getUserIDsByEmail(ctx context.Context, email string) ([]string, error) {
+	state := a.state.Load()
+	if state.dataBrokerClient == nil {
+		return nil, nil
+	}
+
+	res, err := state.dataBrokerClient.Query(ctx, &databroker.QueryRequest{
+		Type:  grpcutil.GetTypeURL(new(user.User)),
+		Query: email,
+		Limit: 100,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: error querying users: %w", err)
+	}
+
+	var userIDs []string
+	for _, record := range res.GetRecords() {
+		var u user.User
+		if err := record.GetData().UnmarshalTo(&u); err != nil {
+			continue
+		}
+		if strings.EqualFold(u.GetEmail(), email) {
+			userIDs = append(userIDs, u.GetId())
+		}
+	}
+	return userIDs, nil
+}
+
+// getSharedSignalsAudience returns the expected audience of a transmitter's
+// security event tokens.
+func getSharedSignalsAudience(options *config.Options, transmitter *config.SharedSignalsTransmitterOptions) (string, error) {
+	if transmitter.Audience != "" {
+		return transmitter.Audience, nil
+	}
+	authenticateURL, err := options.GetAuthenticateURL()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(authenticateURL.String(), "/"), nil
+}
+
+// renderSharedSignalsError renders a push delivery error response.
+//
+// https://www.rfc-editor.org/rfc/rfc8935.html#section-2.3
+func renderSharedSignalsError(w http.ResponseWriter, code int, err, description string) {
+	httputil.RenderJSON(w, code, map[string]string{
+		"err":         err,
+		"description": description,
+	})
+}
@@ -0,0 +1,203 @@
+package authenticate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/encoding/jwks"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+func TestAuthenticate_SharedSignalsEvents(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "KEY", Algorithm: string(jose.ES256), Use: "sig"},
+		}})
+	}))
+	t.Cleanup(srv.Close)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	sign := func(key *ecdsa.PrivateKey, claims any) string {
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			(&jose.SignerOptions{}).WithType("secevent+jwt").WithHeader("kid", "KEY"))
+		require.NoError(t, err)
+		raw, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return raw
+	}
+
+	var signedOut []string
+	var revoked []*session.IdentityProviderSession
+	options := config.NewDefaultOptions()
+	options.AuthenticateURLString = "https://authenticate.example.com"
+	options.SharedSignalsTransmitters = []config.SharedSignalsTransmitterOptions{
+		{Issuer: "https://idp.example.com", JWKSURL: srv.URL},
+		{Issuer: "https://other.example.com", JWKSURL: srv.URL, Audience: "AUDIENCE", AuthorizationHeader: "Bearer SECRET"},
+	}
+	u := &user.User{Id: "u3", Email: "user@example.com"}
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(WithJWKSFetcher(jwks.NewFetcher(jwks.WithHTTPClient(srv.Client())))),
+		state: atomicutil.NewValue(&authenticateState{
+			sessionServiceClient: mockSessionServiceClient{
+				signOutAll: func(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error) {
+					signedOut = append(signedOut, in.GetUserId())
+					return &session.SignOutAllResponse{}, nil
+				},
+				revokeSessions: func(ctx context.Context, in *session.RevokeSessionsRequest, opts ...grpc.CallOption) (*session.RevokeSessionsResponse, error) {
+					revoked = append(revoked, in.GetIdentityProviderSession())
+					return &session.RevokeSessionsResponse{}, nil
+				},
+			},
+			dataBrokerClient: mockDataBrokerServiceClient{
+				query: func(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+					return &databroker.QueryResponse{Records: []*databroker.Record{
+						{Id: "u3", Data: protoutil.NewAny(u)},
+						{Id: "u4", Data: protoutil.NewAny(&user.User{Id: "u4", Email: "other-user@example.com"})},
+					}}, nil
+				},
+			},
+		}),
+		options: config.NewAtomicOptions(),
+	}
+	a.options.Store(options)
+
+	do := func(authorization, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "https://authenticate.example.com"+sharedSignalsPath, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/secevent+jwt")
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(a.SharedSignalsEvents).ServeHTTP(w, r)
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		var res map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return res["err"]
+	}
+
+	t.Run("revoke", func(t *testing.T) {
+		signedOut, revoked = nil, nil
+		w := do("", sign(key, map[string]any{
+			"iss": "https://idp.example.com",
+			"aud": "https://authenticate.example.com",
+			"jti": "1",
+			"events": map[string]any{
+				caepSessionRevoked: map[string]any{
+					"subject": map[string]any{
+						"format":  "complex",
+						"user":    map[string]any{"format": "iss_sub", "iss": "https://idp.example.com", "sub": "u1"},
+						"session": map[string]any{"format": "opaque", "id": "SID"},
+					},
+				},
+				riscCredentialCompromise: map[string]any{
+					"subject": map[string]any{"format": "opaque", "id": "u2"},
+				},
+				caepDeviceComplianceChange: map[string]any{
+					"subject":        map[string]any{"format": "email", "email": "USER@example.com"},
+					"current_status": "not-compliant",
+				},
+			},
+		}))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, []string{"u3", "u2"}, signedOut)
+		if assert.Len(t, revoked, 1) {
+			assert.Equal(t, "SID", revoked[0].GetSid())
+			assert.Equal(t, "u1", revoked[0].GetUserId())
+		}
+	})
+	t.Run("ignored", func(t *testing.T) {
+		signedOut, revoked = nil, nil
+		w := do("", sign(key, map[string]any{
+			"iss":    "https://idp.example.com",
+			"aud":    "https://authenticate.example.com",
+			"sub_id": map[string]any{"format": "opaque", "id": "u1"},
+			"events": map[string]any{
+				caepAssuranceLevelChange:   map[string]any{"change_direction": "increase"},
+				caepDeviceComplianceChange: map[string]any{"current_status": "compliant"},
+				"https://schemas.openid.net/secevent/ssf/event-type/verification": map[string]any{},
+			},
+		}))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Empty(t, signedOut)
+		assert.Empty(t, revoked)
+	})
+	t.Run("subject id", func(t *testing.T) {
+		signedOut, revoked = nil, nil
+		w := do("Bearer SECRET", sign(key, map[string]any{
+			"iss":    "https://other.example.com",
+			"aud":    []string{"AUDIENCE"},
+			"sub_id": map[string]any{"format": "iss_sub", "iss": "https://other.example.com", "sub": "u1"},
+			"events": map[string]any{
+				caepAssuranceLevelChange: map[string]any{"change_direction": "decrease"},
+			},
+		}))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, []string{"u1"}, signedOut)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		signedOut, revoked = nil, nil
+		events := map[string]any{
+			caepSessionRevoked: map[string]any{"subject": map[string]any{"format": "opaque", "id": "u1"}},
+		}
+
+		w := do("", "NOT A JWT")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "invalid_request", errorCode(w))
+
+		w = do("", sign(key, map[string]any{"iss": "https://unknown.example.com", "events": events}))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "invalid_issuer", errorCode(w))
+
+		w = do("", sign(otherKey, map[string]any{
+			"iss": "https://idp.example.com", "aud": "https://authenticate.example.com", "events": events,
+		}))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "invalid_key", errorCode(w))
+
+		w = do("", sign(key, map[string]any{
+			"iss": "https://idp.example.com", "aud": "https://other.example.com", "events": events,
+		}))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "invalid_audience", errorCode(w))
+
+		w = do("Bearer WRONG", sign(key, map[string]any{
+			"iss": "https://other.example.com", "aud": "AUDIENCE", "events": events,
+		}))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "authentication_failed", errorCode(w))
+
+		assert.Empty(t, signedOut)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		a.options.Store(config.NewDefaultOptions())
+		t.Cleanup(func() { a.options.Store(options) })
+		assert.Equal(t, http.StatusNotFound, do("", "").Code)
+	})
+}
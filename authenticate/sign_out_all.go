@@ -0,0 +1,163 @@
+package authenticate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	go_oidc "github.com/coreos/go-oidc/v3/oidc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// backChannelLogoutPath is the path of the back-channel logout endpoint.
+const backChannelLogoutPath = "/oauth2/backchannel_logout"
+
+// backChannelLogoutEvent is the event identifying an OpenID Connect
+// back-channel logout token.
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+var errSignedOut = errors.New("authenticate: user has been signed out everywhere")
+
+type logoutTokenClaims struct {
+	Subject string         `json:"sub"`
+	OID     string         `json:"oid"`
+	SID     string         `json:"sid"`
+	Events  map[string]any `json:"events"`
+	Nonce   *string        `json:"nonce"`
+}
+
+// BackChannelLogout handles OpenID Connect back-channel logout requests from
+// the identity provider. If the logout token has a sid claim, only the sessions
+// created from that identity provider session are revoked. Otherwise the user
+// identified by the logout token is signed out everywhere.
+//
+// https://openid.net/specs/openid-connect-backchannel-1_0.html
+func (a *Authenticate) BackChannelLogout(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	if state.sessionServiceClient == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("back-channel logout is not available"))
+	}
+
+	rawLogoutToken := r.FormValue("logout_token")
+	if rawLogoutToken == "" {
+		return httputil.NewError(http.StatusBadRequest, errors.New("logout_token is required"))
+	}
+
+	idpID := a.getIdentityProviderIDForRequest(r)
+	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
+	if err != nil {
+		return err
+	}
+	p, ok := authenticator.(interface {
+		GetVerifier() (*go_oidc.IDTokenVerifier, error)
+	})
+	if !ok {
+		return httputil.NewError(http.StatusNotFound, fmt.Errorf("back-channel logout is not supported by %s", authenticator.Name()))
+	}
+	verifier, err := p.GetVerifier()
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	logoutToken, err := verifier.Verify(ctx, rawLogoutToken)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid logout_token: %w", err))
+	}
+	var claims logoutTokenClaims
+	err = logoutToken.Claims(&claims)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid logout_token claims: %w", err))
+	}
+	userID, err := claims.getUserID()
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	if claims.SID != "" {
+		res, err := state.sessionServiceClient.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_IdentityProviderSession{
+				IdentityProviderSession: &session.IdentityProviderSession{
+					Sid:    claims.SID,
+					UserId: userID,
+				},
+			},
+		})
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error revoking sessions: %w", err))
+		}
+
+		log.FromRequest(r).Info().
+			Str("idp_id", idpID).
+			Str("user_id", userID).
+			Str("sid", claims.SID).
+			Strs("session_ids", res.GetSessionIds()).
+			Msg("authenticate: revoked sessions via back-channel logout")
+	} else {
+		_, err = state.sessionServiceClient.SignOutAll(ctx, &session.SignOutAllRequest{UserId: userID})
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error signing out user: %w", err))
+		}
+
+		log.FromRequest(r).Info().
+			Str("idp_id", idpID).
+			Str("user_id", userID).
+			Msg("authenticate: signed out user via back-channel logout")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getUserID validates the logout token claims and returns the id of the user
+// to sign out. The user id may be empty if the logout token has a sid claim.
+func (claims *logoutTokenClaims) getUserID() (string, error) {
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return "", errors.New("logout_token is missing the back-channel logout event")
+	}
+	if claims.Nonce != nil {
+		return "", errors.New("logout_token must not contain a nonce")
+	}
+
+	// user ids prefer the oid claim, see sessions.State.UserID
+	if claims.OID != "" {
+		return claims.OID, nil
+	}
+	if claims.Subject != "" {
+		return claims.Subject, nil
+	}
+	if claims.SID != "" {
+		return "", nil
+	}
+	return "", errors.New("logout_token is missing the sub or sid claim")
+}
+
+// isSignedOut returns true if the session's user has been signed out
+// everywhere since the session was issued.
+func (a *Authenticate) isSignedOut(ctx context.Context, s *sessions.State) (bool, error) {
+	state := a.state.Load()
+	if state.dataBrokerClient == nil {
+		return false, nil
+	}
+
+	revocation := &session.UserRevocation{Id: s.UserID()}
+	err := databroker.Get(ctx, state.dataBrokerClient, revocation)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("authenticate: error loading user revocation: %w", err)
+	}
+
+	return s.IssuedAt.Time().Before(revocation.GetRevokedAt().AsTime()), nil
+}
@@ -0,0 +1,81 @@
+package authenticate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+func TestLogoutTokenClaims_getUserID(t *testing.T) {
+	t.Parallel()
+
+	nonce := "NONCE"
+	events := map[string]any{backChannelLogoutEvent: map[string]any{}}
+	for _, tc := range []struct {
+		name    string
+		claims  logoutTokenClaims
+		want    string
+		wantErr bool
+	}{
+		{"sub", logoutTokenClaims{Subject: "SUB", Events: events}, "SUB", false},
+		{"oid", logoutTokenClaims{Subject: "SUB", OID: "OID", Events: events}, "OID", false},
+		{"missing event", logoutTokenClaims{Subject: "SUB"}, "", true},
+		{"nonce", logoutTokenClaims{Subject: "SUB", Events: events, Nonce: &nonce}, "", true},
+		{"sid", logoutTokenClaims{Subject: "SUB", SID: "SID", Events: events}, "SUB", false},
+		{"sid only", logoutTokenClaims{SID: "SID", Events: events}, "", false},
+		{"missing sub and sid", logoutTokenClaims{Events: events}, "", true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tc.claims.getUserID()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAuthenticate_isSignedOut(t *testing.T) {
+	t.Parallel()
+
+	revokedAt := time.Now()
+	client := mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			data := protoutil.NewAny(&session.UserRevocation{Id: in.GetId(), RevokedAt: timestamppb.New(revokedAt)})
+			return &databroker.GetResponse{Record: &databroker.Record{Type: data.GetTypeUrl(), Id: in.GetId(), Data: data}}, nil
+		},
+	}
+	a := &Authenticate{
+		state: atomicutil.NewValue(&authenticateState{dataBrokerClient: client}),
+	}
+
+	signedOut, err := a.isSignedOut(context.Background(), &sessions.State{
+		Subject:  "USER_ID",
+		IssuedAt: jwt.NewNumericDate(revokedAt.Add(-time.Minute)),
+	})
+	assert.NoError(t, err)
+	assert.True(t, signedOut)
+
+	signedOut, err = a.isSignedOut(context.Background(), &sessions.State{
+		Subject:  "USER_ID",
+		IssuedAt: jwt.NewNumericDate(revokedAt.Add(time.Minute)),
+	})
+	assert.NoError(t, err)
+	assert.False(t, signedOut)
+}
@@ -1,22 +1,34 @@
 package authenticate
 
 import (
+	"context"
 	"crypto/cipher"
 	"fmt"
+	"net/http"
 	"net/url"
 
 	"github.com/go-jose/go-jose/v3"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
 	"github.com/pomerium/pomerium/internal/encoding"
 	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/policynamespace"
+	"github.com/pomerium/pomerium/internal/scim"
+	"github.com/pomerium/pomerium/internal/serviceaccount"
 	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/sessions/cookie"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/hpke"
 )
 
+var outboundGRPCConnection = new(grpc.CachedOutboundGRPClientConn)
+
 type authenticateState struct {
 	redirectURL *url.URL
 	// sharedEncoder is the encoder to use to serialize data to be consumed
@@ -36,6 +48,29 @@ type authenticateState struct {
 	// a user's session state from
 	sessionLoader  sessions.SessionLoader
 	hpkePrivateKey *hpke.PrivateKey
+	// rememberMeOptions are the options for the long-lived remember me cookie
+	rememberMeOptions cookie.Options
+	// dataBrokerClient is used to persist and revoke remembered devices
+	dataBrokerClient databroker.DataBrokerServiceClient
+	// sessionServiceClient is used to sign users out everywhere
+	sessionServiceClient session.SessionServiceClient
+	// scimHandler serves the SCIM provisioning endpoint, if it is enabled
+	scimHandler http.Handler
+	// serviceAccountHandler serves the service account management API, if it
+	// is enabled
+	serviceAccountHandler http.Handler
+	// policyNamespaceHandler serves the policy namespace API, if there are
+	// policy namespaces
+	policyNamespaceHandler http.Handler
+	// accessRequestHandler serves the access request API, if access requests
+	// are enabled
+	accessRequestHandler http.Handler
+	// tokenExchangeSigner signs the JWTs issued by token exchange, it is nil
+	// when there is no signing key
+	tokenExchangeSigner encoding.MarshalUnmarshaler
+	// routePolicyEvaluators evaluate the policies of the routes tokens are
+	// exchanged for
+	routePolicyEvaluators routePolicyEvaluators
 
 	jwk *jose.JSONWebKeySet
 }
@@ -94,18 +129,39 @@ func newAuthenticateStateFromConfig(cfg *config.Config) (*authenticateState, err
 		return nil, err
 	}
 
-	cookieStore, err := cookie.NewStore(func() cookie.Options {
+	getCookieOptions := func() cookie.Options {
 		return cookie.Options{
-			Name:     cfg.Options.CookieName + "_authenticate",
-			Domain:   cfg.Options.CookieDomain,
-			Secure:   cfg.Options.CookieSecure,
-			HTTPOnly: cfg.Options.CookieHTTPOnly,
-			Expire:   cfg.Options.CookieExpire,
+			Name:        cfg.Options.CookieName + "_authenticate",
+			Domain:      cfg.Options.CookieDomain,
+			Secure:      cfg.Options.CookieSecure,
+			HTTPOnly:    cfg.Options.CookieHTTPOnly,
+			Expire:      cfg.Options.CookieExpire,
+			Partitioned: cfg.Options.CookiePartitioned,
+			SameSite:    cfg.Options.GetCookieSameSite(),
+			SharedKey:   state.sharedKey,
 		}
-	}, state.sharedEncoder)
+	}
+	var cookieStore sessions.SessionStore
+	var cookieStoreType string
+	if cfg.Options.SessionStore != "" {
+		cookieStoreType = cfg.Options.SessionStore
+		cookieStore, err = cfg.Options.NewRegisteredSessionStore(getCookieOptions, state.sharedEncoder)
+	} else if cfg.Options.CookieEncrypted {
+		cookieStoreType = "cookie_encrypted"
+		var encrypter encoding.MarshalUnmarshaler
+		encrypter, err = cfg.Options.GetCookieEncrypter()
+		if err != nil {
+			return nil, err
+		}
+		cookieStore, err = cookie.NewEncryptedStore(getCookieOptions, state.sharedEncoder, encrypter)
+	} else {
+		cookieStoreType = "cookie"
+		cookieStore, err = cookie.NewStore(getCookieOptions, state.sharedEncoder)
+	}
 	if err != nil {
 		return nil, err
 	}
+	cookieStore = sessions.NewInstrumentedStore(cookieStoreType, cookieStore)
 
 	state.sessionStore = cookieStore
 	state.sessionLoader = cookieStore
@@ -123,6 +179,20 @@ func newAuthenticateStateFromConfig(cfg *config.Config) (*authenticateState, err
 			state.jwk.Keys = append(state.jwk.Keys, *k)
 		}
 	}
+	// only the public key of a kms signing key is available
+	if len(signingKey) > 0 && cfg.Options.SigningKeyKMS == "" {
+		ks, err := cryptutil.PrivateJWKsFromBytes(signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("authenticate: invalid signing key: %w", err)
+		}
+		// the current signing key is first
+		if len(ks) > 0 {
+			state.tokenExchangeSigner, err = jws.NewKeyring(*ks[0])
+			if err != nil {
+				return nil, fmt.Errorf("authenticate: invalid signing key: %w", err)
+			}
+		}
+	}
 
 	sharedKey, err := cfg.Options.GetSharedKey()
 	if err != nil {
@@ -131,5 +201,43 @@ func newAuthenticateStateFromConfig(cfg *config.Config) (*authenticateState, err
 
 	state.hpkePrivateKey = hpke.DerivePrivateKey(sharedKey)
 
+	state.rememberMeOptions = cookie.Options{
+		Name:        cfg.Options.CookieName + "_authenticate_remember",
+		Domain:      cfg.Options.CookieDomain,
+		Secure:      cfg.Options.CookieSecure,
+		HTTPOnly:    true,
+		Expire:      cfg.Options.RememberMeExpire,
+		Partitioned: cfg.Options.CookiePartitioned,
+		SameSite:    cfg.Options.GetCookieSameSite(),
+	}
+
+	dataBrokerConn, err := outboundGRPCConnection.Get(context.Background(), &grpc.OutboundOptions{
+		OutboundPort:   cfg.OutboundPort,
+		InstallationID: cfg.Options.InstallationID,
+		ServiceName:    cfg.Options.Services,
+		SignedJWTKey:   sharedKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	state.dataBrokerClient = databroker.NewDataBrokerServiceClient(dataBrokerConn)
+	state.sessionServiceClient = session.NewSessionServiceClient(dataBrokerConn)
+
+	if cfg.Options.SCIMBearerToken != "" {
+		state.scimHandler = scim.New(cfg.Options.SCIMBearerToken, state.dataBrokerClient, state.sessionServiceClient)
+	}
+	if cfg.Options.ServiceAccountAPIToken != "" {
+		state.serviceAccountHandler = serviceaccount.New(cfg.Options.ServiceAccountAPIToken,
+			user.NewServiceAccountServiceClient(dataBrokerConn))
+	}
+	if len(cfg.Options.PolicyNamespaces) > 0 {
+		state.policyNamespaceHandler = policynamespace.New(cfg.Options,
+			state.authenticateAPIUser, state.dataBrokerClient)
+	}
+	if cfg.Options.AccessRequests != nil {
+		state.accessRequestHandler = accessrequest.New(cfg.Options.AccessRequests,
+			state.authenticateAPIUser, state.dataBrokerClient)
+	}
+
 	return state, nil
 }
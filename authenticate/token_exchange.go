@@ -0,0 +1,266 @@
+package authenticate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// tokenPath is the OAuth 2.0 token endpoint, shared by the device
+// authorization grant and token exchange.
+const tokenPath = "/oauth2/token"
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	jwtTokenType           = "urn:ietf:params:oauth:token-type:jwt"
+	tokenExchangeTTL       = 5 * time.Minute
+)
+
+// Token handles token requests, dispatching on the grant type.
+//
+// https://datatracker.ietf.org/doc/html/rfc6749#section-3.2
+func (a *Authenticate) Token(w http.ResponseWriter, r *http.Request) error {
+	switch r.FormValue("grant_type") {
+	case deviceCodeGrantType:
+		return a.DeviceToken(w, r)
+	case tokenExchangeGrantType:
+		return a.TokenExchange(w, r)
+	default:
+		return renderOAuthError(w, "unsupported_grant_type", "")
+	}
+}
+
+// tokenExchangeClaims are the claims of a JWT issued by token exchange.
+type tokenExchangeClaims struct {
+	jwt.Claims
+	User      string `json:"user"`
+	Email     string `json:"email,omitempty"`
+	SessionID string `json:"sid"`
+}
+
+// TokenExchange exchanges a Pomerium session or service account JWT for a
+// short-lived JWT whose audience is a single route, so that a service can
+// call another service on behalf of the user without forwarding the user's
+// session. The JWT is signed with the signing key and can be verified with
+// the keys published at /.well-known/pomerium/jwks.json.
+//
+// https://datatracker.ietf.org/doc/html/rfc8693#section-2
+func (a *Authenticate) TokenExchange(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := a.state.Load()
+	options := a.options.Load()
+
+	if state.tokenExchangeSigner == nil {
+		return renderOAuthError(w, "unsupported_grant_type", "token exchange requires a signing key")
+	}
+	if r.FormValue("subject_token_type") != jwtTokenType {
+		return renderOAuthError(w, "invalid_request", "subject_token_type must be "+jwtTokenType)
+	}
+	if t := r.FormValue("requested_token_type"); t != "" && t != jwtTokenType {
+		return renderOAuthError(w, "invalid_request", "requested_token_type must be "+jwtTokenType)
+	}
+	// the issued token grants the subject's access to the route, so there is
+	// nothing a scope could narrow
+	if r.FormValue("scope") != "" {
+		return renderOAuthError(w, "invalid_scope", "scopes are not supported")
+	}
+
+	// the target may be given as either the resource or the audience
+	target := r.Form["resource"]
+	target = append(target, r.Form["audience"]...)
+	if len(target) != 1 {
+		return renderOAuthError(w, "invalid_target", "exactly one resource or audience is required")
+	}
+	routeURL, err := urlutil.ParseAndValidateURL(target[0])
+	if err != nil {
+		return renderOAuthError(w, "invalid_target", "target is not the url of a route")
+	}
+	routePolicy := getRoutePolicy(options, routeURL)
+	if routePolicy == nil {
+		return renderOAuthError(w, "invalid_target", "target is not the url of a route")
+	}
+
+	var subject sessions.State
+	if err := state.sharedEncoder.Unmarshal([]byte(r.FormValue("subject_token")), &subject); err != nil {
+		return renderOAuthError(w, "invalid_grant", "invalid subject_token")
+	}
+	userID, expiresAt, err := getSubjectUser(ctx, state.dataBrokerClient, subject.ID)
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	now := time.Now()
+	if userID == "" || (!expiresAt.IsZero() && !expiresAt.After(now)) {
+		return renderOAuthError(w, "invalid_grant", "subject_token is expired or revoked")
+	}
+
+	allowed, err := state.routePolicyEvaluators.isAllowed(ctx, state.dataBrokerClient, routePolicy, routeURL, subject.ID)
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	if !allowed {
+		return renderOAuthError(w, "access_denied", "subject is not allowed to access the target")
+	}
+
+	var email string
+	u, err := user.Get(ctx, state.dataBrokerClient, userID)
+	if err == nil {
+		email = u.GetEmail()
+	} else if status.Code(err) != codes.NotFound {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error loading user: %w", err))
+	}
+
+	authenticateURL, err := options.GetAuthenticateURL()
+	if err != nil {
+		return err
+	}
+
+	expiry := now.Add(tokenExchangeTTL)
+	if !expiresAt.IsZero() && expiresAt.Before(expiry) {
+		expiry = expiresAt
+	}
+	rawJWT, err := state.tokenExchangeSigner.Marshal(tokenExchangeClaims{
+		Claims: jwt.Claims{
+			Issuer:    authenticateURL.Host,
+			Subject:   userID,
+			Audience:  jwt.Audience{routeURL.Host},
+			Expiry:    jwt.NewNumericDate(expiry),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+		User:      userID,
+		Email:     email,
+		SessionID: subject.ID,
+	})
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("authenticate: error signing token: %w", err))
+	}
+
+	log.FromRequest(r).Info().
+		Str("user_id", userID).
+		Str("session_id", subject.ID).
+		Str("audience", routeURL.Host).
+		Msg("authenticate: exchanged token")
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.RenderJSON(w, http.StatusOK, map[string]any{
+		"access_token":      string(rawJWT),
+		"issued_token_type": jwtTokenType,
+		"token_type":        "Bearer",
+		"expires_in":        int(time.Until(expiry).Seconds()),
+	})
+	return nil
+}
+
+// routePolicyEvaluators caches the policy evaluators of the routes tokens are
+// exchanged for. The authenticate state, and so the cache, is rebuilt when the
+// config changes.
+type routePolicyEvaluators struct {
+	mu         sync.Mutex
+	evaluators map[uint64]*evaluator.PolicyEvaluator
+}
+
+func (e *routePolicyEvaluators) get(ctx context.Context, policy *config.Policy) (*evaluator.PolicyEvaluator, error) {
+	routeID, err := policy.RouteID()
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: error computing route id: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if pe, ok := e.evaluators[routeID]; ok {
+		return pe, nil
+	}
+	pe, err := evaluator.NewPolicyEvaluator(ctx, nil, policy)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: error creating policy evaluator: %w", err)
+	}
+	if e.evaluators == nil {
+		e.evaluators = make(map[uint64]*evaluator.PolicyEvaluator)
+	}
+	e.evaluators[routeID] = pe
+	return pe, nil
+}
+
+// isAllowed returns true if the route's policy allows the session or service
+// account with the given id to access the route.
+func (e *routePolicyEvaluators) isAllowed(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	policy *config.Policy,
+	routeURL *url.URL,
+	sessionID string,
+) (bool, error) {
+	pe, err := e.get(ctx, policy)
+	if err != nil {
+		return false, err
+	}
+
+	ctx = storage.WithQuerier(ctx, storage.NewQuerier(client))
+	res, err := pe.Evaluate(ctx, &evaluator.PolicyRequest{
+		HTTP: evaluator.RequestHTTP{
+			Method: http.MethodGet,
+			Path:   routeURL.Path,
+			URL:    routeURL.String(),
+		},
+		Session: evaluator.RequestSession{
+			ID: sessionID,
+		},
+		// the caller presents any client certificate the route requires
+		// when it uses the token, the route checks it then
+		IsValidClientCertificate: true,
+	})
+	if err != nil {
+		return false, fmt.Errorf("authenticate: error evaluating policy: %w", err)
+	}
+	return res.Allow.Value && !res.Deny.Value, nil
+}
+
+// getSubjectUser returns the user and the expiry of the session or service
+// account with the given id. The user is empty if there is no such session or
+// service account, and the expiry is zero if it never expires.
+func getSubjectUser(ctx context.Context, client databroker.DataBrokerServiceClient, id string) (userID string, expiresAt time.Time, err error) {
+	if id == "" {
+		return "", time.Time{}, nil
+	}
+
+	var record interface {
+		GetUserId() string
+		GetExpiresAt() *timestamppb.Timestamp
+	}
+	record, err = session.Get(ctx, client, id)
+	if status.Code(err) == codes.NotFound {
+		record, err = user.GetServiceAccount(ctx, client, id)
+	}
+	if status.Code(err) == codes.NotFound {
+		return "", time.Time{}, nil
+	} else if err != nil {
+		return "", time.Time{}, fmt.Errorf("authenticate: error loading session: %w", err)
+	}
+
+	if record.GetExpiresAt() != nil {
+		expiresAt = record.GetExpiresAt().AsTime()
+	}
+	return record.GetUserId(), expiresAt, nil
+}
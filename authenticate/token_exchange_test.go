@@ -0,0 +1,161 @@
+package authenticate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestAuthenticate_TokenExchange(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	records := map[string]*databroker.Record{}
+	msgs := []interface {
+		proto.Message
+		GetId() string
+	}{
+		&session.Session{Id: "SESSION", UserId: "USER", ExpiresAt: timestamppb.New(now.Add(time.Hour))},
+		&session.Session{Id: "EXPIRING", UserId: "USER", ExpiresAt: timestamppb.New(now.Add(time.Minute))},
+		&session.Session{Id: "EXPIRED", UserId: "USER", ExpiresAt: timestamppb.New(now.Add(-time.Minute))},
+		&user.ServiceAccount{Id: "SERVICE_ACCOUNT", UserId: "SERVICE"},
+		&user.User{Id: "USER", Email: "user@example.com"},
+	}
+	var querierMsgs []proto.Message
+	for _, msg := range msgs {
+		records[msg.GetId()] = databroker.NewRecord(msg)
+		querierMsgs = append(querierMsgs, msg)
+	}
+	querier := storage.NewStaticQuerier(querierMsgs...)
+	client := mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			record, ok := records[in.GetId()]
+			if !ok || record.GetType() != in.GetType() {
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+			return &databroker.GetResponse{Record: record}, nil
+		},
+		query: querier.Query,
+	}
+
+	sharedEncoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+	signingKey, err := cryptutil.NewSigningKey()
+	require.NoError(t, err)
+	encodedSigningKey, err := cryptutil.EncodePrivateKey(signingKey)
+	require.NoError(t, err)
+	jwk, err := cryptutil.PrivateJWKFromBytes(encodedSigningKey)
+	require.NoError(t, err)
+	signer, err := jws.NewKeyring(*jwk)
+	require.NoError(t, err)
+	verifier, err := jws.NewES256Verifier(&signingKey.PublicKey)
+	require.NoError(t, err)
+
+	policy := config.Policy{
+		From:         "https://from.example.com",
+		To:           mustParseWeightedURLs(t, "https://to.example.com"),
+		AllowedUsers: []string{"USER", "SERVICE"},
+	}
+	require.NoError(t, policy.Validate())
+	restrictedPolicy := config.Policy{
+		From:         "https://restricted.example.com",
+		To:           mustParseWeightedURLs(t, "https://to.example.com"),
+		AllowedUsers: []string{"OTHER"},
+	}
+	require.NoError(t, restrictedPolicy.Validate())
+	options := config.NewAtomicOptions()
+	opts := options.Load()
+	opts.AuthenticateURLString = "https://authenticate.example.com"
+	opts.Policies = []config.Policy{policy, restrictedPolicy}
+	options.Store(opts)
+
+	a := &Authenticate{
+		state: atomicutil.NewValue(&authenticateState{
+			sharedEncoder:       sharedEncoder,
+			dataBrokerClient:    client,
+			tokenExchangeSigner: signer,
+		}),
+		options: options,
+	}
+
+	exchange := func(sessionID string, form url.Values) map[string]any {
+		rawJWT, err := sharedEncoder.Marshal(&sessions.State{ID: sessionID})
+		require.NoError(t, err)
+		values := url.Values{
+			"grant_type":         {tokenExchangeGrantType},
+			"subject_token":      {string(rawJWT)},
+			"subject_token_type": {jwtTokenType},
+			"resource":           {"https://from.example.com"},
+		}
+		for k, v := range form {
+			values[k] = v
+		}
+		r := httptest.NewRequest(http.MethodPost, "https://authenticate.example.com"+tokenPath, strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		a.Token(w, r)
+		var res map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return res
+	}
+	verify := func(res map[string]any) tokenExchangeClaims {
+		require.NotNil(t, res["access_token"], res)
+		assert.Equal(t, jwtTokenType, res["issued_token_type"])
+		var claims tokenExchangeClaims
+		require.NoError(t, verifier.Unmarshal([]byte(res["access_token"].(string)), &claims))
+		return claims
+	}
+
+	claims := verify(exchange("SESSION", nil))
+	assert.Equal(t, "authenticate.example.com", claims.Issuer)
+	assert.Equal(t, []string{"from.example.com"}, []string(claims.Audience))
+	assert.Equal(t, "USER", claims.Subject)
+	assert.Equal(t, "user@example.com", claims.Email)
+	assert.Equal(t, "SESSION", claims.SessionID)
+	assert.WithinDuration(t, now.Add(tokenExchangeTTL), claims.Expiry.Time(), 2*time.Second)
+
+	claims = verify(exchange("EXPIRING", nil))
+	assert.WithinDuration(t, now.Add(time.Minute), claims.Expiry.Time(), time.Second,
+		"tokens should not outlive the session")
+
+	claims = verify(exchange("SERVICE_ACCOUNT", url.Values{"resource": nil, "audience": {"https://from.example.com/path"}}))
+	assert.Equal(t, "SERVICE", claims.Subject)
+	assert.Empty(t, claims.Email)
+
+	assert.Equal(t, "invalid_grant", exchange("EXPIRED", nil)["error"])
+	assert.Equal(t, "invalid_grant", exchange("MISSING", nil)["error"])
+	assert.Equal(t, "invalid_grant", exchange("SESSION", url.Values{"subject_token": {"invalid"}})["error"])
+	assert.Equal(t, "invalid_target", exchange("SESSION", url.Values{"resource": {"https://not-a-route.example.com"}})["error"])
+	assert.Equal(t, "invalid_target", exchange("SESSION", url.Values{"audience": {"https://from.example.com"}})["error"],
+		"only a single target should be allowed")
+	assert.Equal(t, "access_denied", exchange("SESSION", url.Values{"resource": {"https://restricted.example.com"}})["error"],
+		"users without access to the route should be refused")
+	assert.Equal(t, "access_denied", exchange("SERVICE_ACCOUNT", url.Values{"resource": {"https://restricted.example.com"}})["error"],
+		"service accounts without access to the route should be refused")
+	assert.Equal(t, "invalid_scope", exchange("SESSION", url.Values{"scope": {"read"}})["error"])
+	assert.Equal(t, "invalid_request", exchange("SESSION", url.Values{"subject_token_type": {"urn:ietf:params:oauth:token-type:id_token"}})["error"])
+	assert.Equal(t, "unsupported_grant_type", exchange("SESSION", url.Values{"grant_type": {"password"}})["error"])
+}
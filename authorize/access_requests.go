@@ -0,0 +1,81 @@
+package authorize
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// checkAccessRequests allows a request which the policy of its route doesn't
+// allow if the user has an approved access request for the route which
+// hasn't expired yet. Requests which the policy denies stay denied.
+func (a *Authorize) checkAccessRequests(ctx context.Context, req *evaluator.Request, res *evaluator.Result, userID string) {
+	if !a.canRequestAccess(req, res, userID) {
+		return
+	}
+
+	routeID, err := req.Policy.RouteID()
+	if err != nil {
+		return
+	}
+
+	// approvals are looked up without the cache, so that they apply at once
+	q := storage.NewQuerier(a.state.Load().dataBrokerClient)
+	approved, err := accessrequest.FindApproved(ctx, q, userID, strconv.FormatUint(routeID, 10), time.Now())
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: error checking access requests")
+		return
+	} else if approved == nil {
+		return
+	}
+
+	log.Info(ctx).
+		Str("access_request_id", approved.GetId()).
+		Str("user_id", userID).
+		Msg("authorize: allowing request by approved access request")
+	res.Allow = evaluator.NewRuleResult(true, criteria.ReasonAccessRequestApproved)
+}
+
+// canRequestAccess returns true if the user may request access to the route
+// of a request which isn't allowed.
+func (a *Authorize) canRequestAccess(req *evaluator.Request, res *evaluator.Result, userID string) bool {
+	if a.currentOptions.Load().AccessRequests == nil || req.Policy == nil || userID == "" {
+		return false
+	}
+	if res.Allow.Value || res.Deny.Value {
+		return false
+	}
+	// users who have to sign in or register a device first may not
+	for _, reason := range []criteria.Reason{
+		criteria.ReasonUserUnauthenticated,
+		criteria.ReasonStepUpRequired,
+		criteria.ReasonDeviceUnauthenticated,
+	} {
+		if res.Allow.Reasons.Has(reason) {
+			return false
+		}
+	}
+	return true
+}
+
+// accessRequestURL returns the url of the authenticate service's page where
+// users request access to the route of a request.
+func (a *Authorize) accessRequestURL(req *evaluator.Request) *url.URL {
+	authenticateURL, err := a.currentOptions.Load().GetAuthenticateURL()
+	if err != nil {
+		return nil
+	}
+	u := authenticateURL.ResolveReference(&url.URL{Path: "/.pomerium/access_request"})
+	u.RawQuery = url.Values{
+		urlutil.QueryRedirectURI: {req.HTTP.URL},
+	}.Encode()
+	return u
+}
@@ -0,0 +1,85 @@
+package authorize
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestAuthorize_checkAccessRequests(t *testing.T) {
+	t.Parallel()
+
+	policy := &config.Policy{From: "https://a.example.com", To: mustParseWeightedURLs(t, "https://a.internal")}
+	routeID, err := policy.RouteID()
+	require.NoError(t, err)
+
+	now := time.Now()
+	accessRequests := []*user.AccessRequest{
+		{
+			Id: "approved", UserId: "u1", RouteId: strconv.FormatUint(routeID, 10),
+			State: user.AccessRequest_APPROVED, ExpiresAt: timestamppb.New(now.Add(time.Hour)),
+		},
+		{
+			Id: "expired", UserId: "u2", RouteId: strconv.FormatUint(routeID, 10),
+			State: user.AccessRequest_APPROVED, ExpiresAt: timestamppb.New(now.Add(-time.Hour)),
+		},
+		{
+			Id: "pending", UserId: "u3", RouteId: strconv.FormatUint(routeID, 10),
+			State: user.AccessRequest_PENDING,
+		},
+	}
+
+	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: atomicutil.NewValue(new(authorizeState))}
+	a.currentOptions.Store(&config.Options{
+		AuthenticateURLString: "https://authenticate.example.com",
+		AccessRequests:        &config.AccessRequestOptions{Approvers: []string{"approver"}},
+	})
+	a.state.Load().dataBrokerClient = mockDataBrokerServiceClient{
+		query: func(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+			var msgs []proto.Message
+			for _, accessRequest := range accessRequests {
+				msgs = append(msgs, accessRequest)
+			}
+			return storage.NewStaticQuerier(msgs...).Query(ctx, in, opts...)
+		},
+	}
+
+	check := func(userID string, allow, deny evaluator.RuleResult) *evaluator.Result {
+		res := &evaluator.Result{Allow: allow, Deny: deny}
+		a.checkAccessRequests(context.Background(), &evaluator.Request{Policy: policy}, res, userID)
+		return res
+	}
+
+	res := check("u1", evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized), evaluator.NewRuleResult(false))
+	assert.True(t, res.Allow.Value)
+	assert.True(t, res.Allow.Reasons.Has(criteria.ReasonAccessRequestApproved))
+
+	res = check("u1", evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized), evaluator.NewRuleResult(true, criteria.ReasonReject))
+	assert.False(t, res.Allow.Value, "deny rules should still apply")
+
+	res = check("u1", evaluator.NewRuleResult(false, criteria.ReasonUserUnauthenticated), evaluator.NewRuleResult(false))
+	assert.False(t, res.Allow.Value, "users should sign in first")
+
+	for _, userID := range []string{"u2", "u3", "u4"} {
+		res = check(userID, evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized), evaluator.NewRuleResult(false))
+		assert.False(t, res.Allow.Value, userID)
+	}
+
+	u := a.accessRequestURL(&evaluator.Request{HTTP: evaluator.RequestHTTP{URL: "https://a.example.com/path"}})
+	assert.Equal(t, "https://authenticate.example.com/.pomerium/access_request?pomerium_redirect_uri=https%3A%2F%2Fa.example.com%2Fpath", u.String())
+}
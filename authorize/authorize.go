@@ -15,6 +15,7 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/ratelimit"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
@@ -25,11 +26,18 @@ import (
 
 // Authorize struct holds
 type Authorize struct {
-	state          *atomicutil.Value[*authorizeState]
-	store          *store.Store
-	currentOptions *atomicutil.Value[*config.Options]
-	accessTracker  *AccessTracker
-	globalCache    storage.Cache
+	state           *atomicutil.Value[*authorizeState]
+	store           *store.Store
+	currentOptions  *atomicutil.Value[*config.Options]
+	accessTracker   *AccessTracker
+	revocations     *sessionRevocations
+	userRevocations *userRevocations
+	sessionCache    *sessionCache
+	rateLimiters    *rateLimiters
+	externalData    *externalData
+	policyRecords   *policyRecords
+	opaReporter     *opaReporter
+	globalCache     storage.Cache
 
 	// The stateLock prevents updating the evaluator store simultaneously with an evaluation.
 	// This should provide a consistent view of the data at a given server/record version and
@@ -45,8 +53,19 @@ func New(cfg *config.Config) (*Authorize, error) {
 		globalCache:    storage.NewGlobalCache(time.Minute),
 	}
 	a.accessTracker = NewAccessTracker(a, accessTrackerMaxSize, accessTrackerDebouncePeriod)
-
-	state, err := newAuthorizeStateFromConfig(cfg, a.store)
+	a.revocations = newSessionRevocations(a)
+	// signing out a user everywhere invalidates any cached policy inputs
+	a.userRevocations = newUserRevocations(a, a.globalCache.InvalidateAll)
+	a.sessionCache = newSessionCache(a, sessionCacheMaxSize)
+	a.rateLimiters = newRateLimiters(a.GetDataBrokerServiceClient)
+	a.externalData = newExternalData(a.store)
+	a.externalData.OnConfigChange(cfg.Options)
+	a.policyRecords = newPolicyRecords(a, a.store)
+	a.policyRecords.OnConfigChange(cfg.Options)
+	a.opaReporter = newOPAReporter()
+	a.opaReporter.OnConfigChange(cfg.Options)
+
+	state, err := newAuthorizeStateFromConfig(cfg, a.store, a.rateLimiters)
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +86,24 @@ func (a *Authorize) Run(ctx context.Context) error {
 		a.accessTracker.Run(ctx)
 		return nil
 	})
+	eg.Go(func() error {
+		return a.revocations.Run(ctx)
+	})
+	eg.Go(func() error {
+		return a.userRevocations.Run(ctx)
+	})
+	eg.Go(func() error {
+		return a.sessionCache.Run(ctx)
+	})
+	eg.Go(func() error {
+		return a.externalData.Run(ctx)
+	})
+	eg.Go(func() error {
+		return a.policyRecords.Run(ctx)
+	})
+	eg.Go(func() error {
+		return a.opaReporter.Run(ctx)
+	})
 	eg.Go(func() error {
 		_ = grpc.WaitForReady(ctx, a.state.Load().dataBrokerClientConnection, time.Second*10)
 		return nil
@@ -86,7 +123,11 @@ func validateOptions(o *config.Options) error {
 }
 
 // newPolicyEvaluator returns an policy evaluator.
-func newPolicyEvaluator(opts *config.Options, store *store.Store) (*evaluator.Evaluator, error) {
+func newPolicyEvaluator(
+	opts *config.Options,
+	store *store.Store,
+	rateLimiter *ratelimit.Limiter,
+) (*evaluator.Evaluator, error) {
 	metrics.AddPolicyCountCallback("pomerium-authorize", func() int64 {
 		return int64(len(opts.GetAllPolicies()))
 	})
@@ -104,25 +145,61 @@ func newPolicyEvaluator(opts *config.Options, store *store.Store) (*evaluator.Ev
 		return nil, fmt.Errorf("authorize: invalid authenticate url: %w", err)
 	}
 
-	signingKey, err := opts.GetSigningKey()
+	signingKeyOption, err := getSigningKeyOption(opts)
 	if err != nil {
-		return nil, fmt.Errorf("authorize: invalid signing key: %w", err)
+		return nil, err
+	}
+
+	geoIPDatabase, err := opts.GetGeoIPDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("authorize: invalid geoip database: %w", err)
 	}
 
 	return evaluator.New(ctx, store,
 		evaluator.WithPolicies(opts.GetAllPolicies()),
 		evaluator.WithClientCA(clientCA),
-		evaluator.WithSigningKey(signingKey),
+		signingKeyOption,
 		evaluator.WithAuthenticateURL(authenticateURL.String()),
 		evaluator.WithGoogleCloudServerlessAuthenticationServiceAccount(opts.GetGoogleCloudServerlessAuthenticationServiceAccount()),
 		evaluator.WithJWTClaimsHeaders(opts.JWTClaimsHeaders),
+		evaluator.WithGeoIPDatabase(geoIPDatabase),
+		evaluator.WithRateLimiter(rateLimiter),
+		evaluator.WithDecisionCache(opts.AuthorizeDecisionCacheSize, opts.GetAuthorizeDecisionCacheTTL()),
+		evaluator.WithRegoLibraries(opts.RegoLibraries),
 	)
 }
 
+func getSigningKeyOption(opts *config.Options) (evaluator.Option, error) {
+	if opts.SigningKeyAlgorithm == string(cryptutil.HybridSignatureAlgorithm) {
+		signer, err := opts.GetHybridSigner()
+		if err != nil {
+			return nil, fmt.Errorf("authorize: invalid hybrid signing key: %w", err)
+		}
+		return evaluator.WithHybridSigner(signer), nil
+	}
+
+	if opts.SigningKeyKMS != "" {
+		signer, err := opts.GetSigningKeyKMSSigner()
+		if err != nil {
+			return nil, fmt.Errorf("authorize: invalid kms signing key: %w", err)
+		}
+		return evaluator.WithKMSSigner(signer), nil
+	}
+
+	signingKey, err := opts.GetSigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("authorize: invalid signing key: %w", err)
+	}
+	return evaluator.WithSigningKey(signingKey), nil
+}
+
 // OnConfigChange updates internal structures based on config.Options
 func (a *Authorize) OnConfigChange(ctx context.Context, cfg *config.Config) {
 	a.currentOptions.Store(cfg.Options)
-	if state, err := newAuthorizeStateFromConfig(cfg, a.store); err != nil {
+	a.externalData.OnConfigChange(cfg.Options)
+	a.policyRecords.OnConfigChange(cfg.Options)
+	a.opaReporter.OnConfigChange(cfg.Options)
+	if state, err := newAuthorizeStateFromConfig(cfg, a.store, a.rateLimiters); err != nil {
 		log.Error(ctx).Err(err).Msg("authorize: error updating state")
 	} else {
 		a.state.Store(state)
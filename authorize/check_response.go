@@ -18,10 +18,12 @@ import (
 	"google.golang.org/grpc/codes"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/contextutil"
 	"github.com/pomerium/pomerium/pkg/policy/criteria"
 	"github.com/pomerium/pomerium/pkg/webauthnutil"
 )
@@ -36,7 +38,14 @@ func (a *Authorize) handleResult(
 	// logged in yet, so redirect to authenticate
 	if result.Allow.Reasons.Has(criteria.ReasonUserUnauthenticated) ||
 		result.Deny.Reasons.Has(criteria.ReasonUserUnauthenticated) {
-		return a.requireLoginResponse(ctx, in, request)
+		return a.requireLoginResponse(ctx, in, request, request.Policy.GetIDPAuthParams())
+	}
+
+	// when a step-up is required it means the user has to sign in again
+	// before they may access the route
+	if result.Allow.Reasons.Has(criteria.ReasonStepUpRequired) ||
+		result.Deny.Reasons.Has(criteria.ReasonStepUpRequired) {
+		return a.requireLoginResponse(ctx, in, request, getStepUpIDPAuthParams(request.Policy))
 	}
 
 	// when the user's device is unauthenticated it means they haven't
@@ -92,9 +101,92 @@ func (a *Authorize) handleResultDenied(
 		denyStatusText = httputil.DetailsText(httputil.StatusInvalidClientCertificate)
 	}
 
+	if result.ResponseBody != "" {
+		return a.customDeniedResponse(denyStatusCode, result.ResponseContentType, result.ResponseBody), nil
+	}
+
+	if opts := request.Policy.GetDenyResponse(); opts != nil {
+		res, err := a.policyDeniedResponse(ctx, opts, request, reasons, denyStatusCode, denyStatusText)
+		if err == nil {
+			return res, nil
+		}
+		log.Error(ctx).Err(err).Msg("authorize: error rendering deny response, using the error page")
+	}
+
 	return a.deniedResponse(ctx, in, denyStatusCode, denyStatusText, nil)
 }
 
+// denyResponseData is the data of the deny response templates of a route.
+type denyResponseData struct {
+	Status           int
+	StatusText       string
+	Reasons          []string
+	URL              string
+	RequestID        string
+	AccessRequestURL string
+}
+
+// policyDeniedResponse returns the deny response configured for the route,
+// rendered with the details of the denial.
+func (a *Authorize) policyDeniedResponse(
+	ctx context.Context,
+	opts *config.DenyResponseOptions,
+	request *evaluator.Request,
+	reasons criteria.Reasons,
+	code int32,
+	reason string,
+) (*envoy_service_auth_v3.CheckResponse, error) {
+	if opts.StatusCode != 0 {
+		code = int32(opts.StatusCode)
+	}
+	data := denyResponseData{
+		Status:     int(code),
+		StatusText: reason,
+		Reasons:    reasons.Strings(),
+		URL:        request.HTTP.URL,
+		RequestID:  requestid.FromContext(ctx),
+	}
+	if u := contextutil.GetAccessRequestURL(ctx); u != nil {
+		data.AccessRequestURL = u.String()
+	}
+
+	body, headers, err := opts.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	return &envoy_service_auth_v3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.PermissionDenied), Message: "Access Denied"},
+		HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
+			DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
+				Status: &envoy_type_v3.HttpStatus{
+					Code: envoy_type_v3.StatusCode(code),
+				},
+				Headers: toEnvoyHeaders(headers),
+				Body:    body,
+			},
+		},
+	}, nil
+}
+
+// customDeniedResponse returns a denied response with the body custom rego
+// returned instead of the error page.
+func (a *Authorize) customDeniedResponse(code int32, contentType, body string) *envoy_service_auth_v3.CheckResponse {
+	return &envoy_service_auth_v3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.PermissionDenied), Message: "Access Denied"},
+		HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
+			DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
+				Status: &envoy_type_v3.HttpStatus{
+					Code: envoy_type_v3.StatusCode(code),
+				},
+				Headers: []*envoy_config_core_v3.HeaderValueOption{
+					mkHeader("Content-Type", contentType),
+				},
+				Body: body,
+			},
+		},
+	}
+}
+
 func (a *Authorize) okResponse(headers http.Header) *envoy_service_auth_v3.CheckResponse {
 	var requestHeaders []*envoy_config_core_v3.HeaderValueOption
 	for k, vs := range headers {
@@ -173,6 +265,7 @@ func (a *Authorize) requireLoginResponse(
 	ctx context.Context,
 	in *envoy_service_auth_v3.CheckRequest,
 	request *evaluator.Request,
+	idpAuthParams *config.IDPAuthParamsOptions,
 ) (*envoy_service_auth_v3.CheckResponse, error) {
 	options := a.currentOptions.Load()
 	state := a.state.Load()
@@ -200,10 +293,18 @@ func (a *Authorize) requireLoginResponse(
 	checkRequestURL := getCheckRequestURL(in)
 	checkRequestURL.Scheme = "https"
 
+	// pass the identity provider parameters in the encrypted query
+	signInURL := *authenticateURL
+	if idpAuthParams != nil {
+		q := signInURL.Query()
+		idpAuthParams.SetQuery(q)
+		signInURL.RawQuery = q.Encode()
+	}
+
 	redirectTo, err := urlutil.SignInURL(
 		state.hpkePrivateKey,
 		authenticateHPKEPublicKey,
-		authenticateURL,
+		&signInURL,
 		&checkRequestURL,
 		idp.GetId(),
 	)
@@ -216,6 +317,19 @@ func (a *Authorize) requireLoginResponse(
 	})
 }
 
+// getStepUpIDPAuthParams returns the route's identity provider parameters
+// changed so that the user signs in with the identity provider again.
+func getStepUpIDPAuthParams(policy *config.Policy) *config.IDPAuthParamsOptions {
+	var params config.IDPAuthParamsOptions
+	if p := policy.GetIDPAuthParams(); p != nil {
+		params = *p
+	}
+	maxAge := 0
+	params.Prompt = "login"
+	params.MaxAge = &maxAge
+	return &params
+}
+
 func (a *Authorize) requireWebAuthnResponse(
 	ctx context.Context,
 	in *envoy_service_auth_v3.CheckRequest,
@@ -21,6 +21,7 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
 	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/contextutil"
 	hpke_handlers "github.com/pomerium/pomerium/pkg/hpke/handlers"
 	"github.com/pomerium/pomerium/pkg/policy/criteria"
 )
@@ -59,6 +60,26 @@ func TestAuthorize_handleResult(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, 302, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
+	t.Run("step-up-required", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Allow: evaluator.NewRuleResult(false, criteria.ReasonStepUpRequired),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, 302, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		res, err = a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Allow: evaluator.NewRuleResult(true, criteria.ReasonEmailOK),
+				Deny:  evaluator.NewRuleResult(true, criteria.ReasonStepUpRequired),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, 302, int(res.GetDeniedResponse().GetStatus().GetCode()))
+	})
 	t.Run("device-unauthenticated", func(t *testing.T) {
 		res, err := a.handleResult(context.Background(),
 			&envoy_service_auth_v3.CheckRequest{},
@@ -89,6 +110,62 @@ func TestAuthorize_handleResult(t *testing.T) {
 			assert.NotNil(t, res.GetOkResponse())
 		})
 	})
+	t.Run("custom response body", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Deny:                evaluator.NewRuleResult(true),
+				ResponseBody:        `{"error":"ticket required"}`,
+				ResponseContentType: "application/json",
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, 403, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		assert.Equal(t, `{"error":"ticket required"}`, res.GetDeniedResponse().GetBody())
+		assert.Equal(t, []*envoy_config_core_v3.HeaderValueOption{
+			mkHeader("Content-Type", "application/json"),
+		}, res.GetDeniedResponse().GetHeaders())
+	})
+	t.Run("policy deny response", func(t *testing.T) {
+		ctx := contextutil.WithAccessRequestURL(context.Background(), &url.URL{Scheme: "https", Host: "access.example.com", Path: "/request"})
+		res, err := a.handleResult(ctx,
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{
+				Policy: &config.Policy{DenyResponse: &config.DenyResponseOptions{
+					StatusCode:  401,
+					ContentType: "application/json",
+					Body:        `{"status":{{.Status}},"reasons":"{{range .Reasons}}{{.}}{{end}}","url":"{{.URL}}"}`,
+					Headers:     map[string]string{"Link": `<{{.AccessRequestURL}}>; rel="access-request"`},
+				}},
+				HTTP: evaluator.RequestHTTP{URL: "https://from.example.com/path"},
+			},
+			&evaluator.Result{
+				Allow: evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, 401, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		assert.Equal(t, `{"status":401,"reasons":"email-unauthorized","url":"https://from.example.com/path"}`, res.GetDeniedResponse().GetBody())
+		assert.Equal(t, []*envoy_config_core_v3.HeaderValueOption{
+			mkHeader("Content-Type", "application/json"),
+			mkHeader("Link", `<https://access.example.com/request>; rel="access-request"`),
+		}, res.GetDeniedResponse().GetHeaders())
+	})
+	t.Run("policy deny response html", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{
+				Policy: &config.Policy{DenyResponse: &config.DenyResponseOptions{
+					Body: `<p>{{.URL}}</p>`,
+				}},
+				HTTP: evaluator.RequestHTTP{URL: "https://from.example.com/<script>"},
+			},
+			&evaluator.Result{
+				Deny: evaluator.NewRuleResult(true),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, 403, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		assert.Equal(t, `<p>https://from.example.com/&lt;script&gt;</p>`, res.GetDeniedResponse().GetBody())
+	})
 }
 
 func TestAuthorize_okResponse(t *testing.T) {
@@ -106,7 +183,7 @@ func TestAuthorize_okResponse(t *testing.T) {
 	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: atomicutil.NewValue(new(authorizeState))}
 	a.currentOptions.Store(opt)
 	a.store = store.New()
-	pe, err := newPolicyEvaluator(opt, a.store)
+	pe, err := newPolicyEvaluator(opt, a.store, nil)
 	require.NoError(t, err)
 	a.state.Load().evaluator = pe
 
@@ -238,7 +315,7 @@ func TestRequireLogin(t *testing.T) {
 	t.Run("accept empty", func(t *testing.T) {
 		res, err := a.requireLoginResponse(context.Background(),
 			&envoy_service_auth_v3.CheckRequest{},
-			&evaluator.Request{})
+			&evaluator.Request{}, nil)
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
@@ -255,7 +332,7 @@ func TestRequireLogin(t *testing.T) {
 					},
 				},
 			},
-			&evaluator.Request{})
+			&evaluator.Request{}, nil)
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
@@ -272,8 +349,29 @@ func TestRequireLogin(t *testing.T) {
 					},
 				},
 			},
-			&evaluator.Request{})
+			&evaluator.Request{}, nil)
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusUnauthorized, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
 }
+
+func TestGetStepUpIDPAuthParams(t *testing.T) {
+	t.Parallel()
+
+	maxAge := 3600
+	policy := &config.Policy{IDPAuthParams: &config.IDPAuthParamsOptions{
+		Prompt:    "consent",
+		ACRValues: "urn:mace:incommon:iap:silver",
+		MaxAge:    &maxAge,
+	}}
+	params := getStepUpIDPAuthParams(policy)
+	assert.Equal(t, "login", params.Prompt)
+	assert.Equal(t, "urn:mace:incommon:iap:silver", params.ACRValues)
+	assert.Equal(t, 0, *params.MaxAge)
+	assert.Equal(t, "consent", policy.IDPAuthParams.Prompt, "should not change the route's parameters")
+	assert.Equal(t, 3600, *policy.IDPAuthParams.MaxAge, "should not change the route's parameters")
+
+	params = getStepUpIDPAuthParams(nil)
+	assert.Equal(t, "login", params.Prompt)
+	assert.Equal(t, 0, *params.MaxAge)
+}
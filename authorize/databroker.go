@@ -2,6 +2,10 @@ package authorize
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
@@ -64,7 +68,10 @@ func (a *Authorize) getDataBrokerSessionOrServiceAccount(
 	ctx, span := trace.StartSpan(ctx, "authorize.getDataBrokerSessionOrServiceAccount")
 	defer span.End()
 
-	record, err := getDataBrokerRecord(ctx, grpcutil.GetTypeURL(new(session.Session)), sessionID, dataBrokerRecordVersion)
+	record, ok, err := a.sessionCache.GetSessionRecord(ctx, sessionID, dataBrokerRecordVersion)
+	if !ok {
+		record, err = getDataBrokerRecord(ctx, grpcutil.GetTypeURL(new(session.Session)), sessionID, dataBrokerRecordVersion)
+	}
 	if storage.IsNotFound(err) {
 		record, err = getDataBrokerRecord(ctx, grpcutil.GetTypeURL(new(user.ServiceAccount)), sessionID, dataBrokerRecordVersion)
 	}
@@ -106,3 +113,34 @@ func (a *Authorize) getDataBrokerUser(
 	}
 	return &u, nil
 }
+
+// getSessionVersion returns a hash of the session or service account and the
+// user, which identifies the version of the records policy decisions are
+// cached for. Decisions for impersonated sessions depend on other records,
+// so an empty string, which disables caching, is returned for them.
+func getSessionVersion(s sessionOrServiceAccount, u *user.User) string {
+	if s, ok := s.(*session.Session); ok && s.GetImpersonateSessionId() != "" {
+		return ""
+	}
+
+	var msgs []proto.Message
+	if s, ok := s.(proto.Message); ok {
+		msgs = append(msgs, s)
+	}
+	if u != nil {
+		msgs = append(msgs, u)
+	}
+
+	h := xxhash.New()
+	for _, msg := range msgs {
+		bs, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return ""
+		}
+		// prefix the records with their type and length, so that they
+		// can't be confused
+		_, _ = fmt.Fprintf(h, "%s:%d:", msg.ProtoReflect().Descriptor().FullName(), len(bs))
+		_, _ = h.Write(bs)
+	}
+	return fmt.Sprintf("%x", h.Sum64())
+}
@@ -7,8 +7,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
@@ -54,3 +56,17 @@ func Test_getDataBrokerRecord(t *testing.T) {
 		})
 	}
 }
+
+func Test_getSessionVersion(t *testing.T) {
+	s := &session.Session{Id: "s1", UserId: "u1"}
+	u := &user.User{Id: "u1", Email: "a@example.com"}
+
+	v := getSessionVersion(s, u)
+	assert.NotEmpty(t, v)
+	assert.Equal(t, v, getSessionVersion(&session.Session{Id: "s1", UserId: "u1"}, &user.User{Id: "u1", Email: "a@example.com"}))
+	assert.NotEqual(t, v, getSessionVersion(s, &user.User{Id: "u1", Email: "b@example.com"}))
+	assert.NotEqual(t, v, getSessionVersion(s, nil))
+	assert.NotEmpty(t, getSessionVersion(nil, nil))
+	assert.Empty(t, getSessionVersion(&session.Session{Id: "s1", ImpersonateSessionId: proto.String("s2")}, u),
+		"should not cache decisions for impersonated sessions")
+}
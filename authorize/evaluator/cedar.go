@@ -0,0 +1,215 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/policy/cedar"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// Cedar entity types.
+const (
+	cedarAnonymousType      = "Anonymous"
+	cedarActionType         = "Action"
+	cedarGroupType          = "Group"
+	cedarRouteType          = "Route"
+	cedarServiceAccountType = "ServiceAccount"
+	cedarUserType           = "User"
+)
+
+// A cedarPolicy evaluates the Cedar policies of a route. The principal is
+// the user or service account of the session, with entity data from the
+// databroker, the action is the http method and the resource is the route.
+type cedarPolicy struct {
+	policies cedar.PolicySet
+	resource *cedar.Entity
+}
+
+func newCedarPolicy(configPolicy *config.Policy) (*cedarPolicy, error) {
+	policies, err := cedar.Parse(configPolicy.CedarPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: invalid cedar policy: %w", err)
+	}
+	return &cedarPolicy{
+		policies: policies,
+		resource: &cedar.Entity{
+			UID:        cedar.NewEntityUID(cedarRouteType, configPolicy.From),
+			Attributes: cedar.Record{"from": cedar.String(configPolicy.From)},
+		},
+	}, nil
+}
+
+// evaluate authorizes the request with the Cedar policies, and returns the
+// decision in place of the result of a rego query.
+func (c *cedarPolicy) evaluate(ctx context.Context, req *PolicyRequest) (rego.Vars, error) {
+	ctx, span := trace.StartSpan(ctx, "authorize.cedarPolicy.evaluate")
+	defer span.End()
+
+	entities := cedar.Entities{}
+	entities.Add(c.resource)
+	principal, err := loadCedarPrincipal(ctx, entities, req.Session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the context is the policy input, as rego sees it
+	var input interface{}
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, &input); err != nil {
+		return nil, err
+	}
+	cedarContext, _ := cedar.ValueFromInterface(input)
+	record, _ := cedarContext.(cedar.Record)
+
+	d := c.policies.IsAuthorized(entities, cedar.Request{
+		Principal: principal,
+		Action:    cedar.NewEntityUID(cedarActionType, req.HTTP.Method),
+		Resource:  c.resource.UID,
+		Context:   record,
+	})
+	for _, err := range d.Errors {
+		log.Warn(ctx).Err(err).Msg("authorize: skipped cedar policy")
+	}
+
+	allowReason := criteria.ReasonCedarPolicyOK
+	if !d.Allow {
+		allowReason = criteria.ReasonCedarPolicyUnauthorized
+	}
+	allowReasons := []interface{}{allowReason}
+	if !d.Allow && principal.Type == cedarAnonymousType {
+		allowReasons = append(allowReasons, criteria.ReasonUserUnauthenticated)
+	}
+	deny := []interface{}{false, []interface{}{}}
+	if len(d.Forbids) > 0 {
+		deny = []interface{}{true, []interface{}{criteria.ReasonCedarPolicyForbidden}}
+	}
+	return rego.Vars{"result": map[string]interface{}{
+		"allow": []interface{}{d.Allow, allowReasons},
+		"deny":  deny,
+	}}, nil
+}
+
+// loadCedarPrincipal adds the user or service account of the session, and
+// its parents, to the entities and returns its uid. Requests without a
+// session have an anonymous principal.
+func loadCedarPrincipal(ctx context.Context, entities cedar.Entities, sessionID string) (cedar.EntityUID, error) {
+	anonymous := cedar.NewEntityUID(cedarAnonymousType, "")
+	if sessionID == "" {
+		return anonymous, nil
+	}
+
+	msg, err := getCedarRecord(ctx, new(session.Session), sessionID)
+	if err != nil {
+		return anonymous, err
+	} else if msg == nil {
+		msg, err = getCedarRecord(ctx, new(user.ServiceAccount), sessionID)
+		if err != nil {
+			return anonymous, err
+		}
+	}
+
+	switch s := msg.(type) {
+	case *session.Session:
+		u, err := getCedarRecord(ctx, new(user.User), s.GetUserId())
+		if err != nil {
+			return anonymous, err
+		}
+		pbUser, _ := u.(*user.User)
+		return addCedarUser(entities, s.GetUserId(), pbUser, s.GetClaims()), nil
+	case *user.ServiceAccount:
+		uid := cedar.NewEntityUID(cedarServiceAccountType, s.GetId())
+		entities.Add(&cedar.Entity{
+			UID: uid,
+			Attributes: cedar.Record{
+				"id":      cedar.String(s.GetId()),
+				"user_id": cedar.String(s.GetUserId()),
+			},
+			Parents: []cedar.EntityUID{cedar.NewEntityUID(cedarUserType, s.GetUserId())},
+		})
+		return uid, nil
+	}
+	return anonymous, nil
+}
+
+// addCedarUser adds the user, with the claims of the user and the session,
+// to the entities. The user is in a group for each of its groups claims.
+func addCedarUser(entities cedar.Entities, userID string, u *user.User, sessionClaims map[string]*structpb.ListValue) cedar.EntityUID {
+	claims := cedar.Record{}
+	for _, m := range []map[string]*structpb.ListValue{u.GetClaims(), sessionClaims} {
+		for k, vs := range m {
+			if v, ok := cedar.ValueFromInterface(vs.AsSlice()); ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	entity := &cedar.Entity{
+		UID: cedar.NewEntityUID(cedarUserType, userID),
+		Attributes: cedar.Record{
+			"id":     cedar.String(userID),
+			"claims": claims,
+		},
+	}
+	if u.GetEmail() != "" {
+		entity.Attributes["email"] = cedar.String(u.GetEmail())
+	}
+	if u.GetName() != "" {
+		entity.Attributes["name"] = cedar.String(u.GetName())
+	}
+	if groups, ok := claims["groups"].(cedar.Set); ok {
+		for _, g := range groups {
+			if s, ok := g.(cedar.String); ok {
+				entity.Parents = append(entity.Parents, cedar.NewEntityUID(cedarGroupType, string(s)))
+			}
+		}
+	}
+	entities.Add(entity)
+	return entity.UID
+}
+
+// getCedarRecord returns the data of the record with the id, or nil if there
+// is no such record or it expired.
+func getCedarRecord(ctx context.Context, msgType proto.Message, id string) (proto.Message, error) {
+	req := &databroker.QueryRequest{
+		Type:  grpcutil.GetTypeURL(msgType),
+		Limit: 1,
+	}
+	req.SetFilterByID(id)
+
+	res, err := storage.GetQuerier(ctx).Query(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: error retrieving record for cedar policy: %w", err)
+	}
+	if len(res.GetRecords()) == 0 {
+		return nil, nil
+	}
+
+	msg, err := res.GetRecords()[0].GetData().UnmarshalNew()
+	if err != nil {
+		return nil, nil
+	}
+	if hasExpiresAt, ok := msg.(interface{ GetExpiresAt() *timestamppb.Timestamp }); ok &&
+		hasExpiresAt.GetExpiresAt() != nil && hasExpiresAt.GetExpiresAt().AsTime().Before(time.Now()) {
+		return nil, nil
+	}
+	return msg, nil
+}
@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ClientCertificateInfo are the attributes of a client certificate which
+// policies can match.
+type ClientCertificateInfo struct {
+	Subject             string   `json:"subject"`
+	Issuer              string   `json:"issuer"`
+	OrganizationalUnits []string `json:"organizational_units"`
+	// Serial is the serial number in lowercase hex.
+	Serial string `json:"serial"`
+	// Fingerprint is the SHA-256 hash of the certificate in lowercase hex.
+	Fingerprint string   `json:"fingerprint"`
+	SANURIs     []string `json:"san_uris"`
+	SANDNSNames []string `json:"san_dns_names"`
+	SANEmails   []string `json:"san_emails"`
+}
+
+// getClientCertificateInfo returns the attributes of the client certificate,
+// or nil if no valid certificate was supplied.
+func getClientCertificateInfo(cert string) *ClientCertificateInfo {
+	if cert == "" {
+		return nil
+	}
+	xcert, err := parseCertificate(cert)
+	if err != nil {
+		return nil
+	}
+
+	fingerprint := sha256.Sum256(xcert.Raw)
+	info := &ClientCertificateInfo{
+		Subject:             xcert.Subject.String(),
+		Issuer:              xcert.Issuer.String(),
+		OrganizationalUnits: append([]string{}, xcert.Subject.OrganizationalUnit...),
+		Serial:              xcert.SerialNumber.Text(16),
+		Fingerprint:         hex.EncodeToString(fingerprint[:]),
+		SANURIs:             []string{},
+		SANDNSNames:         append([]string{}, xcert.DNSNames...),
+		SANEmails:           append([]string{}, xcert.EmailAddresses...),
+	}
+	for _, u := range xcert.URIs {
+		info.SANURIs = append(info.SANURIs, u.String())
+	}
+	return info
+}
@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+func TestGetClientCertificateInfo(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	spiffeID, err := url.Parse("spiffe://example.com/ns/prod/sa/billing")
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(0x0a1b),
+		Subject: pkix.Name{
+			CommonName:         "billing",
+			OrganizationalUnit: []string{"payments"},
+		},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+		URIs:           []*url.URL{spiffeID},
+		DNSNames:       []string{"billing.example.com"},
+		EmailAddresses: []string{"billing@example.com"},
+	}, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Example CA"},
+	}, key.Public(), key)
+	require.NoError(t, err)
+
+	info := getClientCertificateInfo(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	require.NotNil(t, info)
+	assert.Equal(t, "CN=billing,OU=payments", info.Subject)
+	assert.Equal(t, "CN=Example CA", info.Issuer)
+	assert.Equal(t, []string{"payments"}, info.OrganizationalUnits)
+	assert.Equal(t, "a1b", info.Serial)
+	assert.Len(t, info.Fingerprint, 64)
+	assert.Equal(t, []string{"spiffe://example.com/ns/prod/sa/billing"}, info.SANURIs)
+	assert.Equal(t, []string{"billing.example.com"}, info.SANDNSNames)
+	assert.Equal(t, []string{"billing@example.com"}, info.SANEmails)
+
+	assert.Nil(t, getClientCertificateInfo(""))
+	assert.Nil(t, getClientCertificateInfo("invalid"))
+}
+
+func TestClientCertificateCriterion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	e, err := NewPolicyEvaluator(ctx, store.New(), &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		Policy: &config.PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					And: []parser.Criterion{{
+						Name: "client_certificate", Data: parser.Object{
+							"fingerprint": parser.String("B8:8B:1E:6D:FE:21:F2:CE:58:2A:8B:9E:33:7E:AF:66:4D:6D:86:F5:0F:6B:93:40:CE:6D:D9:DE:7E:D7:E1:99"),
+							"san_dns":     parser.Object{"is": parser.String("example-subject")},
+						},
+					}},
+				}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		cert    string
+		isValid bool
+		allow   bool
+	}{
+		{"matching", testValidCert, true, true},
+		{"unverified", testValidCert, false, false},
+		{"other certificate", testUnsignedCert, true, false},
+		{"no certificate", "", true, false},
+	} {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP:                     RequestHTTP{Method: "GET", URL: "https://from.example.com/", ClientCertificate: tc.cert},
+			IsValidClientCertificate: tc.isValid,
+			ClientCertificate:        getClientCertificateInfo(tc.cert),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, tc.allow, output.Allow.Value, tc.name)
+		if !tc.allow {
+			assert.True(t, output.Allow.Reasons.Has(criteria.ReasonClientCertificateUnauthorized), tc.name)
+		}
+	}
+}
@@ -1,16 +1,28 @@
 package evaluator
 
 import (
+	"time"
+
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/geoip"
+	"github.com/pomerium/pomerium/internal/ratelimit"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/kms"
 )
 
 type evaluatorConfig struct {
 	policies                                          []config.Policy
 	clientCA                                          []byte
 	signingKey                                        []byte
+	kmsSigner                                         kms.Signer
 	authenticateURL                                   string
 	googleCloudServerlessAuthenticationServiceAccount string
 	jwtClaimsHeaders                                  config.JWTClaimHeaders
+	geoIPDatabase                                     *geoip.Database
+	rateLimiter                                       *ratelimit.Limiter
+	decisionCacheSize                                 int
+	decisionCacheTTL                                  time.Duration
+	regoLibraries                                     []string
 }
 
 // An Option customizes the evaluator config.
@@ -45,6 +57,23 @@ func WithSigningKey(signingKey []byte) Option {
 	}
 }
 
+// WithKMSSigner sets the signer for a signing key stored in a key management
+// service in the config. It takes precedence over the signing key.
+func WithKMSSigner(signer kms.Signer) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.kmsSigner = signer
+	}
+}
+
+// WithHybridSigner sets the signer for an experimental hybrid post-quantum
+// signing key in the config. Rego doesn't support hybrid keys, so JWTs are
+// signed the same way as with a key management service.
+func WithHybridSigner(signer *cryptutil.HybridSigner) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.kmsSigner = signer
+	}
+}
+
 // WithAuthenticateURL sets the authenticate URL in the config.
 func WithAuthenticateURL(authenticateURL string) Option {
 	return func(cfg *evaluatorConfig) {
@@ -66,3 +95,36 @@ func WithJWTClaimsHeaders(headers config.JWTClaimHeaders) Option {
 		cfg.jwtClaimsHeaders = headers
 	}
 }
+
+// WithGeoIPDatabase sets the geoip database client IP addresses are looked up
+// in by the geoip policy criteria.
+func WithGeoIPDatabase(db *geoip.Database) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.geoIPDatabase = db
+	}
+}
+
+// WithRateLimiter sets the rate limiter which counts the requests for the
+// rate_limit policy criterion.
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.rateLimiter = limiter
+	}
+}
+
+// WithDecisionCache sets the maximum number of policy decisions which are
+// cached, and for how long, in the config.
+func WithDecisionCache(size int, ttl time.Duration) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.decisionCacheSize = size
+		cfg.decisionCacheTTL = ttl
+	}
+}
+
+// WithRegoLibraries sets the rego helper modules which are loaded along with
+// the custom rego of every route in the config.
+func WithRegoLibraries(modules []string) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.regoLibraries = modules
+	}
+}
@@ -0,0 +1,137 @@
+package evaluator
+
+import (
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/pomerium/pomerium/internal/hashutil"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+// cacheableCriteria are the criteria which only depend on the session, the
+// user and the request method, url and client IP address, and the validity of
+// the client certificate.
+var cacheableCriteria = map[string]bool{
+	"accept":                     true,
+	"acr":                        true,
+	"amr":                        true,
+	"authenticated_user":         true,
+	"claim":                      true,
+	"domain":                     true,
+	"email":                      true,
+	"geoip_asn":                  true,
+	"geoip_country":              true,
+	"http_method":                true,
+	"http_path":                  true,
+	"invalid_client_certificate": true,
+	"pomerium_routes":            true,
+	"reject":                     true,
+	"user":                       true,
+}
+
+// isCacheablePolicy returns true if all the criteria of the policies are
+// cacheable.
+func isCacheablePolicy(policies ...*parser.Policy) bool {
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		for _, r := range p.Rules {
+			for _, cs := range [][]parser.Criterion{r.And, r.Or, r.Not, r.Nor} {
+				for _, c := range cs {
+					if !cacheableCriteria[c.Name] {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+type decisionCacheEntry struct {
+	output    *PolicyResponse
+	expiresAt time.Time
+}
+
+// A decisionCache is a bounded LRU cache of policy decisions. The cache
+// belongs to an Evaluator, so that decisions are invalidated when the
+// policies change.
+type decisionCache struct {
+	lru *lru.Cache[uint64, decisionCacheEntry]
+	ttl time.Duration
+	now func() time.Time
+}
+
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	if size <= 0 {
+		return nil
+	}
+	c, err := lru.New[uint64, decisionCacheEntry](size)
+	if err != nil {
+		// only fails for a non-positive size
+		panic(err)
+	}
+	return &decisionCache{
+		lru: c,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// get returns the cached decision for the key, if it hasn't expired.
+func (c *decisionCache) get(key uint64) (*PolicyResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	entry, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		c.lru.Remove(key)
+		return nil, false
+	}
+	return entry.output, true
+}
+
+func (c *decisionCache) add(key uint64, output *PolicyResponse) {
+	if c == nil {
+		return
+	}
+	c.lru.Add(key, decisionCacheEntry{
+		output:    output,
+		expiresAt: c.now().Add(c.ttl),
+	})
+}
+
+// getDecisionCacheKey returns the key of the decision for a request to a
+// route. It includes the version of the session, so that decisions are
+// invalidated when the session or user change, and the fingerprint of the
+// client certificate, which policies can match.
+func getDecisionCacheKey(routeID uint64, req *Request, isValidClientCertificate bool, clientCertificate *ClientCertificateInfo) uint64 {
+	var fingerprint string
+	if clientCertificate != nil {
+		fingerprint = clientCertificate.Fingerprint
+	}
+	return hashutil.MustHash(struct {
+		RouteID                  uint64
+		SessionID                string
+		SessionVersion           string
+		Method                   string
+		URL                      string
+		IP                       string
+		IsValidClientCertificate bool
+		ClientCertificate        string
+	}{
+		RouteID:                  routeID,
+		SessionID:                req.Session.ID,
+		SessionVersion:           req.SessionVersion,
+		Method:                   req.HTTP.Method,
+		URL:                      req.HTTP.URL,
+		IP:                       req.HTTP.IP,
+		IsValidClientCertificate: isValidClientCertificate,
+		ClientCertificate:        fingerprint,
+	})
+}
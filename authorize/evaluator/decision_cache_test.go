@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestIsCacheablePolicy(t *testing.T) {
+	policy := func(names ...string) *parser.Policy {
+		r := parser.Rule{Action: parser.ActionAllow}
+		for _, name := range names {
+			r.Not = append(r.Not, parser.Criterion{Name: name})
+		}
+		return &parser.Policy{Rules: []parser.Rule{r}}
+	}
+
+	assert.True(t, isCacheablePolicy())
+	assert.True(t, isCacheablePolicy(policy("user", "http_path"), nil))
+	assert.False(t, isCacheablePolicy(policy("user", "rate_limit")))
+	assert.False(t, isCacheablePolicy(policy("user"), policy("time_of_day")))
+}
+
+func TestDecisionCache(t *testing.T) {
+	assert.Nil(t, newDecisionCache(0, time.Minute))
+
+	var nilCache *decisionCache
+	nilCache.add(1, NewPolicyResponse())
+	_, ok := nilCache.get(1)
+	assert.False(t, ok)
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newDecisionCache(1, time.Minute)
+	c.now = func() time.Time { return now }
+
+	output := NewPolicyResponse()
+	c.add(1, output)
+	cached, ok := c.get(1)
+	assert.True(t, ok)
+	assert.Same(t, output, cached)
+
+	c.add(2, NewPolicyResponse())
+	_, ok = c.get(1)
+	assert.False(t, ok, "should evict the least recently used decision")
+
+	now = now.Add(time.Minute)
+	_, ok = c.get(2)
+	assert.False(t, ok, "should expire decisions after the ttl")
+}
+
+func TestEvaluator_decisionCache(t *testing.T) {
+	policies := []config.Policy{
+		{
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to1.example.com")}},
+			AllowedUsers: []string{"a@example.com"},
+		},
+		{
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to2.example.com")}},
+			AllowedUsers: []string{"a@example.com"},
+			Policy: &config.PPLPolicy{
+				Policy: &parser.Policy{
+					Rules: []parser.Rule{{
+						Action: parser.ActionDeny,
+						Not: []parser.Criterion{{
+							Name: "rate_limit", Data: parser.Object{"requests": parser.Number("100")},
+						}},
+					}},
+				},
+			},
+		},
+	}
+	e, err := New(context.Background(), store.New(),
+		WithPolicies(policies),
+		WithDecisionCache(10, time.Minute))
+	require.NoError(t, err)
+
+	withUser := func(email string) context.Context {
+		return storage.WithQuerier(context.Background(), storage.NewStaticQuerier(
+			&session.Session{Id: "s1", UserId: "u1"},
+			&user.User{Id: "u1", Email: email},
+		))
+	}
+	eval := func(ctx context.Context, policy *config.Policy, sessionVersion string) bool {
+		res, err := e.Evaluate(ctx, &Request{
+			Policy:         policy,
+			Session:        RequestSession{ID: "s1"},
+			SessionVersion: sessionVersion,
+			HTTP: NewRequestHTTP("GET", *mustParseURL("https://from.example.com/path"),
+				nil, "", "1.1.1.1"),
+		})
+		require.NoError(t, err)
+		return res.Allow.Value && !res.Deny.Value
+	}
+
+	assert.True(t, eval(withUser("a@example.com"), &policies[0], "v1"))
+	assert.True(t, eval(withUser("b@example.com"), &policies[0], "v1"),
+		"should use the cached decision for the same session version")
+	assert.False(t, eval(withUser("b@example.com"), &policies[0], "v2"),
+		"should evaluate the policy for a new session version")
+	assert.False(t, eval(withUser("b@example.com"), &policies[0], ""),
+		"should not cache decisions without a session version")
+
+	assert.True(t, eval(withUser("a@example.com"), &policies[1], "v1"))
+	assert.False(t, eval(withUser("b@example.com"), &policies[1], "v1"),
+		"should not cache decisions for policies with uncacheable criteria")
+}
@@ -33,6 +33,12 @@ type Request struct {
 	Policy  *config.Policy
 	HTTP    RequestHTTP
 	Session RequestSession
+	// SessionVersion identifies the contents of the session and user
+	// records. Policy decisions are only cached if it is set.
+	SessionVersion string
+	// Explain adds the result of each criterion of the route's policy to the
+	// result. Explained requests are never cached.
+	Explain bool
 }
 
 // RequestHTTP is the HTTP field in the request.
@@ -43,6 +49,9 @@ type RequestHTTP struct {
 	Headers           map[string]string `json:"headers"`
 	ClientCertificate string            `json:"client_certificate"`
 	IP                string            `json:"ip"`
+	Body              string            `json:"body"`
+	BodySize          int64             `json:"body_size"`
+	BodyTruncated     bool              `json:"body_truncated"`
 }
 
 // NewRequestHTTP creates a new RequestHTTP.
@@ -74,6 +83,16 @@ type Result struct {
 	Deny    RuleResult
 	Headers http.Header
 	Traces  []contextutil.PolicyEvaluationTrace
+	// Shadow is the result of evaluating the route's shadow policy, if it
+	// has one. It is only logged.
+	Shadow *ShadowResult
+	// ResponseBody and ResponseContentType are the body custom rego returns
+	// for denied requests.
+	ResponseBody        string
+	ResponseContentType string
+	// Criteria are the results of the criteria of the route's policy, if
+	// the request asked for an explanation.
+	Criteria []CriterionResult
 }
 
 // An Evaluator evaluates policies.
@@ -82,6 +101,7 @@ type Evaluator struct {
 	policyEvaluators  map[uint64]*PolicyEvaluator
 	headersEvaluators *HeadersEvaluator
 	clientCA          []byte
+	decisionCache     *decisionCache
 }
 
 // New creates a new Evaluator.
@@ -95,7 +115,7 @@ func New(ctx context.Context, store *store.Store, options ...Option) (*Evaluator
 		return nil, err
 	}
 
-	e.headersEvaluators, err = NewHeadersEvaluator(ctx, store)
+	e.headersEvaluators, err = NewHeadersEvaluator(ctx, store, cfg.kmsSigner)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +126,7 @@ func New(ctx context.Context, store *store.Store, options ...Option) (*Evaluator
 		if err != nil {
 			return nil, fmt.Errorf("authorize: error computing policy route id: %w", err)
 		}
-		policyEvaluator, err := NewPolicyEvaluator(ctx, store, &configPolicy) //nolint
+		policyEvaluator, err := newPolicyEvaluator(ctx, store, &configPolicy, cfg.regoLibraries) //nolint
 		if err != nil {
 			return nil, err
 		}
@@ -114,6 +134,7 @@ func New(ctx context.Context, store *store.Store, options ...Option) (*Evaluator
 	}
 
 	e.clientCA = cfg.clientCA
+	e.decisionCache = newDecisionCache(cfg.decisionCacheSize, cfg.decisionCacheTTL)
 
 	return e, nil
 }
@@ -147,18 +168,36 @@ func (e *Evaluator) Evaluate(ctx context.Context, req *Request) (*Result, error)
 		return nil, fmt.Errorf("authorize: error validating client certificate: %w", err)
 	}
 
+	clientCertificate := getClientCertificateInfo(req.HTTP.ClientCertificate)
+
 	eg, ectx := errgroup.WithContext(ctx)
 
 	var policyOutput *PolicyResponse
-	eg.Go(func() error {
-		var err error
-		policyOutput, err = policyEvaluator.Evaluate(ectx, &PolicyRequest{
-			HTTP:                     req.HTTP,
-			Session:                  req.Session,
-			IsValidClientCertificate: isValidClientCertificate,
+	var decisionCacheKey uint64
+	cacheable := e.decisionCache != nil && req.SessionVersion != "" && policyEvaluator.cacheable && !req.Explain
+	if cacheable {
+		decisionCacheKey = getDecisionCacheKey(id, req, isValidClientCertificate, clientCertificate)
+		policyOutput, _ = e.decisionCache.get(decisionCacheKey)
+	}
+	if policyOutput == nil {
+		eg.Go(func() error {
+			output, err := policyEvaluator.Evaluate(ectx, &PolicyRequest{
+				HTTP:                     req.HTTP,
+				Session:                  req.Session,
+				IsValidClientCertificate: isValidClientCertificate,
+				ClientCertificate:        clientCertificate,
+				Explain:                  req.Explain,
+			})
+			if err != nil {
+				return err
+			}
+			if cacheable {
+				e.decisionCache.add(decisionCacheKey, output)
+			}
+			policyOutput = output
+			return nil
 		})
-		return err
-	})
+	}
 
 	var headersOutput *HeadersResponse
 	eg.Go(func() error {
@@ -176,11 +215,22 @@ func (e *Evaluator) Evaluate(ctx context.Context, req *Request) (*Result, error)
 
 	carryOverJWTAssertion(headersOutput.Headers, req.HTTP.Headers)
 
+	// the identity headers take precedence over the headers custom rego sets
+	for k, vs := range policyOutput.Headers {
+		if _, ok := headersOutput.Headers[k]; !ok {
+			headersOutput.Headers[k] = vs
+		}
+	}
+
 	res := &Result{
-		Allow:   policyOutput.Allow,
-		Deny:    policyOutput.Deny,
-		Headers: headersOutput.Headers,
-		Traces:  policyOutput.Traces,
+		Allow:               policyOutput.Allow,
+		Deny:                policyOutput.Deny,
+		Headers:             headersOutput.Headers,
+		Traces:              policyOutput.Traces,
+		Shadow:              policyOutput.Shadow,
+		ResponseBody:        policyOutput.ResponseBody,
+		ResponseContentType: policyOutput.ResponseContentType,
+		Criteria:            policyOutput.Criteria,
 	}
 	return res, nil
 }
@@ -208,12 +258,39 @@ func (e *Evaluator) updateStore(cfg *evaluatorConfig) error {
 	)
 	e.store.UpdateJWTClaimHeaders(cfg.jwtClaimsHeaders)
 	e.store.UpdateRoutePolicies(cfg.policies)
-	e.store.UpdateSigningKey(jwk)
+	if cfg.kmsSigner != nil {
+		// hybrid public keys can't be stored as JSON
+		e.store.UpdateSigningKeyID(jwk.Algorithm, jwk.KeyID)
+	} else {
+		e.store.UpdateSigningKey(jwk)
+	}
+	e.store.UpdateSigningKeyKMS(cfg.kmsSigner != nil)
+	e.store.UpdateGeoIPDatabase(cfg.geoIPDatabase)
+	e.store.UpdateRateLimiter(cfg.rateLimiter)
 
 	return nil
 }
 
 func getJWK(cfg *evaluatorConfig) (*jose.JSONWebKey, error) {
+	// the private key of a kms signing key isn't available, so the public key is
+	// used for the JWT headers
+	if hybridSigner, ok := cfg.kmsSigner.(*cryptutil.HybridSigner); ok {
+		jwk := hybridSigner.PublicJWK()
+		log.Info(context.TODO()).Str("Algorithm", jwk.Algorithm).
+			Str("KeyID", jwk.KeyID).
+			Interface("Public Key", jwk).
+			Msg("authorize: hybrid signing key")
+		return hybridSigner.Public(), nil
+	}
+	if cfg.kmsSigner != nil {
+		jwk := cfg.kmsSigner.Public()
+		log.Info(context.TODO()).Str("Algorithm", jwk.Algorithm).
+			Str("KeyID", jwk.KeyID).
+			Interface("Public Key", jwk).
+			Msg("authorize: kms signing key")
+		return jwk, nil
+	}
+
 	var decodedCert []byte
 	// if we don't have a signing key, generate one
 	if len(cfg.signingKey) == 0 {
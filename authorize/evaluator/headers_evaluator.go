@@ -14,6 +14,7 @@ import (
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/kms"
 )
 
 // HeadersRequest is the input to the headers.rego script.
@@ -26,6 +27,7 @@ type HeadersRequest struct {
 	Session                                   RequestSession `json:"session"`
 	PassAccessToken                           bool           `json:"pass_access_token"`
 	PassIDToken                               bool           `json:"pass_id_token"`
+	JWTClaims                                 []string       `json:"jwt_claims,omitempty"`
 }
 
 // NewHeadersRequestFromPolicy creates a new HeadersRequest from a policy.
@@ -43,6 +45,7 @@ func NewHeadersRequestFromPolicy(policy *config.Policy) *HeadersRequest {
 	}
 	input.PassAccessToken = policy.GetSetAuthorizationHeader() == configpb.Route_ACCESS_TOKEN
 	input.PassIDToken = policy.GetSetAuthorizationHeader() == configpb.Route_ID_TOKEN
+	input.JWTClaims = policy.JWTClaims
 	return input
 }
 
@@ -56,13 +59,15 @@ type HeadersEvaluator struct {
 	q rego.PreparedEvalQuery
 }
 
-// NewHeadersEvaluator creates a new HeadersEvaluator.
-func NewHeadersEvaluator(ctx context.Context, store *store.Store) (*HeadersEvaluator, error) {
+// NewHeadersEvaluator creates a new HeadersEvaluator. The kms signer is optional
+// and only used when the signing key is stored in a key management service.
+func NewHeadersEvaluator(ctx context.Context, store *store.Store, kmsSigner kms.Signer) (*HeadersEvaluator, error) {
 	r := rego.New(
 		rego.Store(store),
 		rego.Module("pomerium.headers", opa.HeadersRego),
 		rego.Query("result = data.pomerium.headers"),
 		getGoogleCloudServerlessHeadersRegoOption,
+		getKMSSignJWTRegoOption(kmsSigner),
 		store.GetDataBrokerRecordOption(),
 	)
 
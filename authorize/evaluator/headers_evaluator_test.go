@@ -2,10 +2,14 @@ package evaluator
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
 	"math"
 	"testing"
 	"time"
 
+	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,6 +20,7 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
 
@@ -55,7 +60,7 @@ func TestHeadersEvaluator(t *testing.T) {
 		store := store.New()
 		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
 		store.UpdateSigningKey(privateJWK)
-		e, err := NewHeadersEvaluator(ctx, store)
+		e, err := NewHeadersEvaluator(ctx, store, nil)
 		require.NoError(t, err)
 		return e.Evaluate(ctx, input)
 	}
@@ -69,6 +74,7 @@ func TestHeadersEvaluator(t *testing.T) {
 						structpb.NewStringValue("n1"),
 					}},
 				}},
+				&user.User{Id: "u1", Email: "operator@example.com"},
 			},
 			&HeadersRequest{
 				Issuer:     "from.example.com",
@@ -95,6 +101,100 @@ func TestHeadersEvaluator(t *testing.T) {
 		assert.Equal(t, "u2", claims["sub"], "should set subject to user id")
 		assert.Equal(t, "u2", claims["user"], "should set user to user id")
 		assert.Equal(t, "n1", claims["name"], "should set name")
+		assert.Equal(t, map[string]any{"sub": "u1", "email": "operator@example.com"}, claims["act"],
+			"should set actor to the impersonating user")
+	})
+
+	t.Run("selected jwt claims", func(t *testing.T) {
+		output, err := eval(t,
+			[]proto.Message{
+				&session.Session{Id: "s1", UserId: "u1", Claims: map[string]*structpb.ListValue{
+					"name":   {Values: []*structpb.Value{structpb.NewStringValue("n1")}},
+					"groups": {Values: []*structpb.Value{structpb.NewStringValue("g1")}},
+				}},
+				&user.User{Id: "u1", Email: "u1@example.com"},
+			},
+			&HeadersRequest{
+				Issuer:     "from.example.com",
+				ToAudience: "to.example.com",
+				Session:    RequestSession{ID: "s1"},
+				JWTClaims:  []string{"email"},
+			})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+
+		var claims M
+		err = rawJWT.Claims(publicJWK, &claims)
+		require.NoError(t, err)
+
+		assert.Equal(t, "u1@example.com", claims["email"])
+		assert.Equal(t, "from.example.com", claims["iss"], "should always include registered claims")
+		assert.NotContains(t, claims, "sub")
+		assert.NotContains(t, claims, "groups")
+		assert.NotContains(t, claims, "name")
+
+		assert.Equal(t, "u1@example.com", output.Headers.Get("X-Pomerium-Claim-Email"))
+		assert.NotContains(t, output.Headers, "X-Pomerium-Claim-Groups")
+		assert.NotContains(t, output.Headers, "X-Pomerium-Claim-User")
+	})
+
+	t.Run("kms jwt", func(t *testing.T) {
+		ctx := context.Background()
+		ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(&session.Session{Id: "s1", UserId: "u1"}))
+		signer := &testKMSSigner{key: signingKey, jwk: publicJWK}
+		store := store.New()
+		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
+		store.UpdateSigningKey(publicJWK)
+		store.UpdateSigningKeyKMS(true)
+		e, err := NewHeadersEvaluator(ctx, store, signer)
+		require.NoError(t, err)
+		output, err := e.Evaluate(ctx, &HeadersRequest{
+			Issuer:  "from.example.com",
+			Session: RequestSession{ID: "s1"},
+		})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+		assert.Equal(t, publicJWK.KeyID, rawJWT.Headers[0].KeyID)
+
+		var claims M
+		err = rawJWT.Claims(publicJWK, &claims)
+		require.NoError(t, err)
+		assert.Equal(t, "u1", claims["sub"])
+	})
+
+	t.Run("hybrid jwt", func(t *testing.T) {
+		ctx := context.Background()
+		ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(&session.Session{Id: "s1", UserId: "u1"}))
+		rawHybridKey, err := cryptutil.GenerateHybridSigningKey()
+		require.NoError(t, err)
+		signer, err := cryptutil.NewHybridSigner(rawHybridKey)
+		require.NoError(t, err)
+		store := store.New()
+		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
+		store.UpdateSigningKeyID(signer.Public().Algorithm, signer.Public().KeyID)
+		store.UpdateSigningKeyKMS(true)
+		e, err := NewHeadersEvaluator(ctx, store, signer)
+		require.NoError(t, err)
+		output, err := e.Evaluate(ctx, &HeadersRequest{
+			Issuer:  "from.example.com",
+			Session: RequestSession{ID: "s1"},
+		})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+		assert.Equal(t, string(cryptutil.HybridSignatureAlgorithm), rawJWT.Headers[0].Algorithm)
+
+		verifier, err := cryptutil.NewHybridVerifier(signer.PublicJWK())
+		require.NoError(t, err)
+		var claims M
+		err = rawJWT.Claims(verifier, &claims)
+		require.NoError(t, err)
+		assert.Equal(t, "u1", claims["sub"])
 	})
 
 	t.Run("access token", func(t *testing.T) {
@@ -133,3 +233,28 @@ func TestHeadersEvaluator(t *testing.T) {
 		assert.Equal(t, "Bearer ID_TOKEN", output.Headers.Get("Authorization"))
 	})
 }
+
+type testKMSSigner struct {
+	key *ecdsa.PrivateKey
+	jwk *jose.JSONWebKey
+}
+
+func (s *testKMSSigner) Public() *jose.JSONWebKey {
+	return s.jwk
+}
+
+func (s *testKMSSigner) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{jose.ES256}
+}
+
+func (s *testKMSSigner) SignPayload(payload []byte, _ jose.SignatureAlgorithm) ([]byte, error) {
+	digest := sha256.Sum256(payload)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+	return sig, nil
+}
@@ -0,0 +1,47 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+
+	"github.com/pomerium/pomerium/internal/encoding/jwks"
+)
+
+// verifyJWTRegoOption is the verify_jwt function, which verifies a third-party
+// JWT with the keys published at a JWKS URL and returns its claims.
+var verifyJWTRegoOption = getVerifyJWTRegoOption(jwks.DefaultFetcher)
+
+func getVerifyJWTRegoOption(fetcher *jwks.Fetcher) func(*rego.Rego) {
+	return rego.Function2(&rego.Function{
+		Name: "verify_jwt",
+		Decl: types.NewFunction(
+			types.Args(types.S, types.S),
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+		),
+	}, func(bctx rego.BuiltinContext, op1 *ast.Term, op2 *ast.Term) (*ast.Term, error) {
+		rawJWT, ok := op1.Value.(ast.String)
+		if !ok {
+			return nil, fmt.Errorf("invalid jwt type: %T", op1)
+		}
+
+		jwksURL, ok := op2.Value.(ast.String)
+		if !ok {
+			return nil, fmt.Errorf("invalid jwks url type: %T", op2)
+		}
+
+		var claims map[string]interface{}
+		err := fetcher.VerifyJWT(bctx.Context, string(jwksURL), string(rawJWT), &claims)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt: %w", err)
+		}
+
+		value, err := ast.InterfaceToValue(claims)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewTerm(value), nil
+	})
+}
@@ -0,0 +1,138 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	signingKey, err := cryptutil.NewSigningKey()
+	require.NoError(t, err)
+	jwk := jose.JSONWebKey{Key: signingKey.Public(), KeyID: "k1", Algorithm: string(jose.ES256), Use: "sig"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	}))
+	defer srv.Close()
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signingKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "k1"))
+	require.NoError(t, err)
+	rawJWT, err := jwt.Signed(sig).Claims(map[string]interface{}{"sub": "service-1"}).CompactSerialize()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	e, err := NewPolicyEvaluator(ctx, store.New(), &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		SubPolicies: []config.SubPolicy{
+			{ID: "p1", Rego: []string{`
+				package pomerium.policy
+
+				allow {
+					claims := verify_jwt(input.http.headers["X-Upstream-Jwt"], "` + srv.URL + `")
+					claims.sub == "service-1"
+				}
+			`}},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		jwt    string
+		expect bool
+	}{
+		{"valid", rawJWT, true},
+		{"invalid", rawJWT + "x", false},
+		{"missing", "", false},
+	} {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP: RequestHTTP{
+				Method:  "GET",
+				URL:     "https://from.example.com/path",
+				Headers: map[string]string{"X-Upstream-Jwt": tc.jwt},
+			},
+		})
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expect, output.Allow.Value, tc.name)
+	}
+}
+
+func TestJWTCriterion(t *testing.T) {
+	signingKey, err := cryptutil.NewSigningKey()
+	require.NoError(t, err)
+	jwk := jose.JSONWebKey{Key: signingKey.Public(), KeyID: "k1", Algorithm: string(jose.ES256), Use: "sig"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	}))
+	defer srv.Close()
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signingKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "k1"))
+	require.NoError(t, err)
+	sign := func(claims map[string]interface{}) string {
+		rawJWT, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return rawJWT
+	}
+
+	ctx := context.Background()
+	e, err := NewPolicyEvaluator(ctx, store.New(), &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		Policy: &config.PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					And: []parser.Criterion{{
+						Name: "jwt", Data: parser.Object{
+							"jwks_url": parser.String(srv.URL),
+							"claims": parser.Object{
+								"iss":   parser.String("https://partner.example.com"),
+								"scope": parser.String("orders:read"),
+							},
+						},
+					}},
+				}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		jwt    string
+		expect bool
+	}{
+		{"valid", sign(map[string]interface{}{"iss": "https://partner.example.com", "scope": "orders:read orders:write"}), true},
+		{"wrong scope", sign(map[string]interface{}{"iss": "https://partner.example.com", "scope": "orders:write"}), false},
+		{"expired", sign(map[string]interface{}{"iss": "https://partner.example.com", "scope": "orders:read", "exp": 1}), false},
+		{"invalid", "x", false},
+	} {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP: RequestHTTP{
+				Method:  "GET",
+				URL:     "https://from.example.com/path",
+				Headers: map[string]string{"Authorization": "Bearer " + tc.jwt},
+			},
+			IsValidClientCertificate: true,
+		})
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expect, output.Allow.Value, tc.name)
+	}
+}
@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+
+	"github.com/pomerium/pomerium/pkg/kms"
+)
+
+// getKMSSignJWTRegoOption returns the kms_sign_jwt function, which signs a JWT
+// with a signing key stored in a key management service.
+func getKMSSignJWTRegoOption(signer kms.Signer) func(*rego.Rego) {
+	return rego.Function2(&rego.Function{
+		Name: "kms_sign_jwt",
+		Decl: types.NewFunction(
+			types.Args(types.A, types.A),
+			types.S,
+		),
+	}, func(bctx rego.BuiltinContext, op1 *ast.Term, op2 *ast.Term) (*ast.Term, error) {
+		if signer == nil {
+			return nil, errors.New("no kms signer configured")
+		}
+
+		headers, err := ast.JSON(op1.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt headers: %w", err)
+		}
+		payload, err := ast.JSON(op2.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt payload: %w", err)
+		}
+
+		jwt, err := kmsSignJWT(signer, headers, payload)
+		if err != nil {
+			return nil, err
+		}
+		return ast.StringTerm(jwt), nil
+	})
+}
+
+func kmsSignJWT(signer kms.Signer, headers, payload any) (string, error) {
+	rawHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return "", fmt.Errorf("invalid jwt headers: %w", err)
+	}
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid jwt payload: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(rawHeaders) +
+		"." + base64.RawURLEncoding.EncodeToString(rawPayload)
+	sig, err := signer.SignPayload([]byte(signingInput), jose.SignatureAlgorithm(signer.Public().Algorithm))
+	if err != nil {
+		return "", fmt.Errorf("error signing jwt: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -10,16 +10,19 @@ package pomerium.headers
 #   to_audience: string
 #   pass_access_token: boolean
 #   pass_id_token: boolean
+#   jwt_claims: []string
 #
 # data:
 #   jwt_claim_headers: map[string]string
 #   signing_key:
 #     alg: string
 #     kid: string
+#   signing_key_kms: boolean
 #
 # functions:
 #   get_databroker_record
 #   get_google_cloud_serverless_headers
+#   kms_sign_jwt
 #
 #
 # output:
@@ -156,6 +159,31 @@ jwt_payload_name = v {
 # the session id is always set to the input session id, even if impersonating
 jwt_payload_sid := input.session.id
 
+# when impersonating, the actor is the operator who started the impersonation
+# https://datatracker.ietf.org/doc/html/rfc8693#section-4.1
+jwt_payload_act = v {
+	s = get_databroker_record("type.googleapis.com/session.Session", input.session.id)
+	s != null
+	object.get(s, "impersonate_session_id", "") != ""
+	session.id == s.impersonate_session_id
+
+	u = get_databroker_record("type.googleapis.com/user.User", s.user_id)
+	u != null
+	v = {
+		"sub": s.user_id,
+		"email": object.get(u, "email", ""),
+	}
+} else = v {
+	s = get_databroker_record("type.googleapis.com/session.Session", input.session.id)
+	s != null
+	object.get(s, "impersonate_session_id", "") != ""
+	session.id == s.impersonate_session_id
+
+	v = {"sub": s.user_id}
+} else = null {
+	true
+}
+
 base_jwt_claims := [
 	["iss", jwt_payload_iss],
 	["aud", jwt_payload_aud],
@@ -168,6 +196,7 @@ base_jwt_claims := [
 	["groups", jwt_payload_groups],
 	["sid", jwt_payload_sid],
 	["name", jwt_payload_name],
+	["act", jwt_payload_act],
 ]
 
 additional_jwt_claims := [[k, v] |
@@ -187,7 +216,26 @@ additional_jwt_claims := [[k, v] |
 	v := get_header_string_value(claim_value)
 ]
 
-jwt_claims := array.concat(base_jwt_claims, additional_jwt_claims)
+# claims which are always included in the JWT
+required_jwt_claims := {"iss", "aud", "jti", "exp", "iat", "act"}
+
+# routes may select the claims passed in the identity headers
+is_selected_jwt_claim(k) {
+	not input.jwt_claims
+}
+
+is_selected_jwt_claim(k) {
+	required_jwt_claims[k]
+}
+
+is_selected_jwt_claim(k) {
+	input.jwt_claims[_] == k
+}
+
+jwt_claims := [[k, v] |
+	[k, v] := array.concat(base_jwt_claims, additional_jwt_claims)[_]
+	is_selected_jwt_claim(k)
+]
 
 jwt_payload = {key: value |
 	# use a comprehension over an array to remove nil values
@@ -195,7 +243,12 @@ jwt_payload = {key: value |
 	value != null
 }
 
-signed_jwt = io.jwt.encode_sign(jwt_headers, jwt_payload, data.signing_key)
+signed_jwt = v {
+	data.signing_key_kms
+	v := kms_sign_jwt(jwt_headers, jwt_payload)
+} else = v {
+	v := io.jwt.encode_sign(jwt_headers, jwt_payload, data.signing_key)
+}
 
 kubernetes_headers = h {
 	input.kubernetes_service_account_token != ""
@@ -247,6 +300,7 @@ identity_headers := {key: values |
 	h2 := [[header_name, header_value] |
 		some header_name
 		k := data.jwt_claim_headers[header_name]
+		is_selected_jwt_claim(k)
 		raw_header_value := array.concat(
 			[cv |
 				[ck, cv] := jwt_claims[_]
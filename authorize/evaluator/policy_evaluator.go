@@ -3,6 +3,7 @@ package evaluator
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/open-policy-agent/opa/rego"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/contextutil"
@@ -23,12 +25,42 @@ type PolicyRequest struct {
 	HTTP                     RequestHTTP    `json:"http"`
 	Session                  RequestSession `json:"session"`
 	IsValidClientCertificate bool           `json:"is_valid_client_certificate"`
+	// ClientCertificate are the attributes of the client certificate, if one
+	// was supplied.
+	ClientCertificate *ClientCertificateInfo `json:"client_certificate,omitempty"`
+	// Explain adds the result of each criterion of the PPL policy to the
+	// response.
+	Explain bool `json:"-"`
 }
 
 // PolicyResponse is the result of evaluating a policy.
 type PolicyResponse struct {
 	Allow, Deny RuleResult
 	Traces      []contextutil.PolicyEvaluationTrace
+	// Headers are the headers custom rego sets on allowed requests.
+	Headers http.Header
+	// ResponseBody and ResponseContentType are the body custom rego returns
+	// for denied requests.
+	ResponseBody        string
+	ResponseContentType string
+	// Shadow is the result of evaluating the shadow policy, if the route has
+	// one.
+	Shadow *ShadowResult
+	// Criteria are the results of the criteria of the PPL policy, if the
+	// request asked for an explanation.
+	Criteria []CriterionResult
+}
+
+// A CriterionResult is the result of evaluating a criterion of a PPL policy.
+type CriterionResult struct {
+	policy.CriterionRule
+	Result RuleResult
+}
+
+// ShadowResult is the result of evaluating a shadow policy, which is logged
+// but not enforced.
+type ShadowResult struct {
+	Allow, Deny RuleResult
 }
 
 // NewPolicyResponse creates a new PolicyResponse.
@@ -91,10 +123,23 @@ func MergeRuleResultsWithOr(results ...RuleResult) RuleResult {
 
 type policyQuery struct {
 	rego.PreparedEvalQuery
-	script      string
-	id          string
-	explanation string
-	remediation string
+	script string
+	// criterionRules are the rules generated for the criteria of a PPL
+	// policy.
+	criterionRules []policy.CriterionRule
+	entrypoint     string
+	id             string
+	explanation    string
+	remediation    string
+	// evaluator evaluates the query instead of the script, e.g. with a
+	// remote OPA instance.
+	evaluator policyQueryEvaluator
+}
+
+// A policyQueryEvaluator evaluates a query which isn't a rego script, and
+// returns the result like a rego query does.
+type policyQueryEvaluator interface {
+	evaluate(ctx context.Context, req *PolicyRequest) (rego.Vars, error)
 }
 
 func (q policyQuery) checksum() string {
@@ -104,21 +149,48 @@ func (q policyQuery) checksum() string {
 // A PolicyEvaluator evaluates policies.
 type PolicyEvaluator struct {
 	queries []policyQuery
+	// shadow is the query for the route's base policy with the shadow
+	// policy in place of the embedded PPL policy.
+	shadow *policyQuery
+	// cacheable is true if the decisions for the policy may be cached.
+	cacheable bool
+}
+
+// NewPolicyEvaluator creates a new PolicyEvaluator. If s is nil an empty
+// store is used, in which case records are only read from the databroker via
+// the querier in the context.
+func NewPolicyEvaluator(ctx context.Context, s *store.Store, configPolicy *config.Policy) (*PolicyEvaluator, error) {
+	if s == nil {
+		s = store.New()
+	}
+	return newPolicyEvaluator(ctx, s, configPolicy, nil)
 }
 
-// NewPolicyEvaluator creates a new PolicyEvaluator.
-func NewPolicyEvaluator(ctx context.Context, store *store.Store, configPolicy *config.Policy) (*PolicyEvaluator, error) {
+// newPolicyEvaluator creates a new PolicyEvaluator. The rego libraries, and
+// the route's rego modules, are loaded along with the route's custom rego.
+func newPolicyEvaluator(
+	ctx context.Context,
+	store *store.Store,
+	configPolicy *config.Policy,
+	regoLibraries []string,
+) (*PolicyEvaluator, error) {
 	e := new(PolicyEvaluator)
 
+	routeID, err := configPolicy.RouteID()
+	if err != nil {
+		return nil, fmt.Errorf("authorize: error computing policy route id: %w", err)
+	}
+
 	// generate the base rego script for the policy
 	ppl := configPolicy.ToPPL()
-	base, err := policy.GenerateRegoFromPolicy(ppl)
+	base, criterionRules, err := policy.GenerateRegoAndCriterionRules(ppl)
 	if err != nil {
 		return nil, err
 	}
 
 	e.queries = []policyQuery{{
-		script: base,
+		script:         base,
+		criterionRules: criterionRules,
 	}}
 
 	// add any custom rego
@@ -130,6 +202,7 @@ func NewPolicyEvaluator(ctx context.Context, store *store.Store, configPolicy *c
 
 			e.queries = append(e.queries, policyQuery{
 				script:      src,
+				entrypoint:  sp.RegoEntrypoint,
 				id:          sp.ID,
 				explanation: sp.Explanation,
 				remediation: sp.Remediation,
@@ -137,34 +210,41 @@ func NewPolicyEvaluator(ctx context.Context, store *store.Store, configPolicy *c
 		}
 	}
 
+	// cedar policies, and remote OPA instances, are evaluated like custom rego
+	if configPolicy.CedarPolicy != "" {
+		cedarPolicy, err := newCedarPolicy(configPolicy)
+		if err != nil {
+			return nil, err
+		}
+		e.queries = append(e.queries, policyQuery{
+			id:        "cedar_policy",
+			evaluator: cedarPolicy,
+		})
+	}
+	if configPolicy.RemoteOPA != nil {
+		e.queries = append(e.queries, policyQuery{
+			id:        "remote_opa",
+			evaluator: newRemoteOPA(configPolicy.RemoteOPA),
+		})
+	}
+
 	// for each script, create a rego and prepare a query.
 	for i := range e.queries {
+		if e.queries[i].evaluator != nil {
+			continue
+		}
+
 		log.Debug(ctx).
 			Str("script", e.queries[i].script).
 			Str("from", configPolicy.From).
 			Interface("to", configPolicy.To).
 			Msg("authorize: rego script for policy evaluation")
 
-		r := rego.New(
-			rego.Store(store),
-			rego.Module("pomerium.policy", e.queries[i].script),
-			rego.Query("result = data.pomerium.policy"),
-			getGoogleCloudServerlessHeadersRegoOption,
-			store.GetDataBrokerRecordOption(),
-		)
-
-		q, err := r.PrepareForEval(ctx)
-		// if no package is in the src, add it
-		if err != nil && strings.Contains(err.Error(), "package expected") {
-			r := rego.New(
-				rego.Store(store),
-				rego.Module("pomerium.policy", "package pomerium.policy\n\n"+e.queries[i].script),
-				rego.Query("result = data.pomerium.policy"),
-				getGoogleCloudServerlessHeadersRegoOption,
-				store.GetDataBrokerRecordOption(),
-			)
-			q, err = r.PrepareForEval(ctx)
+		var modules []string
+		if i > 0 {
+			modules = append(append(modules, regoLibraries...), configPolicy.RegoModules...)
 		}
+		q, err := prepareQuery(ctx, store, e.queries[i].script, e.queries[i].entrypoint, modules, routeID)
 		if err != nil {
 			return nil, err
 		}
@@ -172,20 +252,96 @@ func NewPolicyEvaluator(ctx context.Context, store *store.Store, configPolicy *c
 		e.queries[i].PreparedEvalQuery = q
 	}
 
+	shadowPPL := configPolicy.ToShadowPPL()
+	e.cacheable = len(e.queries) == 1 && isCacheablePolicy(ppl, shadowPPL)
+
+	if shadowPPL != nil {
+		script, err := policy.GenerateRegoFromPolicy(shadowPPL)
+		if err != nil {
+			return nil, fmt.Errorf("authorize: invalid shadow policy: %w", err)
+		}
+
+		log.Debug(ctx).
+			Str("script", script).
+			Str("from", configPolicy.From).
+			Interface("to", configPolicy.To).
+			Msg("authorize: rego script for shadow policy evaluation")
+
+		// requests are counted separately for the shadow policy's rate limits
+		q, err := prepareQuery(ctx, store, script, "", nil, hashutil.MustHash([]any{"shadow", routeID}))
+		if err != nil {
+			return nil, fmt.Errorf("authorize: invalid shadow policy: %w", err)
+		}
+		e.shadow = &policyQuery{PreparedEvalQuery: q, script: script}
+	}
+
 	return e, nil
 }
 
+// prepareQuery prepares the query for the result of the entrypoint of a rego
+// script, which defaults to pomerium.policy. The modules are loaded along with
+// the script.
+func prepareQuery(
+	ctx context.Context,
+	store *store.Store,
+	script, entrypoint string,
+	modules []string,
+	routeID uint64,
+) (rego.PreparedEvalQuery, error) {
+	if entrypoint == "" {
+		entrypoint = "pomerium.policy"
+	}
+	newRego := func(script string) *rego.Rego {
+		options := []func(*rego.Rego){
+			rego.Store(store),
+			rego.Module("pomerium.policy", script),
+			rego.Query("result = data." + entrypoint),
+			getGoogleCloudServerlessHeadersRegoOption,
+			verifyJWTRegoOption,
+			store.GetDataBrokerRecordOption(),
+			store.GetGeoIPLookupOption(),
+			store.GetRateLimitOption(routeID),
+			store.GetGroupAncestorsOption(),
+		}
+		for i, module := range modules {
+			options = append(options, rego.Module(fmt.Sprintf("pomerium.module.%d", i), module))
+		}
+		return rego.New(options...)
+	}
+
+	q, err := newRego(script).PrepareForEval(ctx)
+	// if no package is in the src, add it
+	if err != nil && strings.Contains(err.Error(), "package expected") {
+		q, err = newRego("package pomerium.policy\n\n" + script).PrepareForEval(ctx)
+	}
+	return q, err
+}
+
 // Evaluate evaluates the policy rego scripts.
 func (e *PolicyEvaluator) Evaluate(ctx context.Context, req *PolicyRequest) (*PolicyResponse, error) {
 	res := NewPolicyResponse()
+	// the custom rego results are merged into the shadow result too
+	custom := NewPolicyResponse()
 	// run each query and merge the results
-	for _, query := range e.queries {
+	for i, query := range e.queries {
 		o, err := e.evaluateQuery(ctx, req, query)
 		if err != nil {
 			return nil, err
 		}
 		res.Allow = MergeRuleResultsWithOr(res.Allow, o.Allow)
 		res.Deny = MergeRuleResultsWithOr(res.Deny, o.Deny)
+		for k, vs := range o.Headers {
+			if res.Headers == nil {
+				res.Headers = make(http.Header)
+			}
+			for _, v := range vs {
+				res.Headers.Add(k, v)
+			}
+		}
+		if res.ResponseBody == "" {
+			res.ResponseBody, res.ResponseContentType = o.ResponseBody, o.ResponseContentType
+		}
+		res.Criteria = append(res.Criteria, o.Criteria...)
 		res.Traces = append(res.Traces, contextutil.PolicyEvaluationTrace{
 			ID:          query.id,
 			Explanation: query.explanation,
@@ -193,6 +349,23 @@ func (e *PolicyEvaluator) Evaluate(ctx context.Context, req *PolicyRequest) (*Po
 			Allow:       o.Allow.Value,
 			Deny:        o.Deny.Value,
 		})
+		if i > 0 {
+			custom.Allow = MergeRuleResultsWithOr(custom.Allow, o.Allow)
+			custom.Deny = MergeRuleResultsWithOr(custom.Deny, o.Deny)
+		}
+	}
+
+	if e.shadow != nil {
+		// the shadow policy is never enforced, so errors are only logged
+		o, err := e.evaluateQuery(ctx, req, *e.shadow)
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("authorize: error evaluating shadow policy")
+		} else {
+			res.Shadow = &ShadowResult{
+				Allow: MergeRuleResultsWithOr(custom.Allow, o.Allow),
+				Deny:  MergeRuleResultsWithOr(custom.Deny, o.Deny),
+			}
+		}
 	}
 	return res, nil
 }
@@ -202,18 +375,38 @@ func (e *PolicyEvaluator) evaluateQuery(ctx context.Context, req *PolicyRequest,
 	defer span.End()
 	span.AddAttributes(octrace.StringAttribute("script_checksum", query.checksum()))
 
-	rs, err := safeEval(ctx, query.PreparedEvalQuery, rego.EvalInput(req))
-	if err != nil {
-		return nil, fmt.Errorf("authorize: error evaluating policy.rego: %w", err)
-	}
+	var vars rego.Vars
+	if query.evaluator != nil {
+		var err error
+		vars, err = query.evaluator.evaluate(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("authorize: error evaluating %s: %w", query.id, err)
+		}
+	} else {
+		rs, err := safeEval(ctx, query.PreparedEvalQuery, rego.EvalInput(req))
+		if err != nil {
+			return nil, fmt.Errorf("authorize: error evaluating policy.rego: %w", err)
+		}
 
-	if len(rs) == 0 {
-		return nil, fmt.Errorf("authorize: unexpected empty result from evaluating policy.rego")
+		if len(rs) == 0 {
+			return nil, fmt.Errorf("authorize: unexpected empty result from evaluating policy.rego")
+		}
+		vars = rs[0].Bindings
 	}
 
 	res := &PolicyResponse{
-		Allow: e.getRuleResult("allow", rs[0].Bindings),
-		Deny:  e.getRuleResult("deny", rs[0].Bindings),
+		Allow:   e.getRuleResult("allow", vars),
+		Deny:    e.getRuleResult("deny", vars),
+		Headers: e.getHeaders(vars),
+	}
+	res.ResponseBody, res.ResponseContentType = e.getResponseBody(vars)
+	if req.Explain {
+		for _, rule := range query.criterionRules {
+			res.Criteria = append(res.Criteria, CriterionResult{
+				CriterionRule: rule,
+				Result:        e.getRuleResult(rule.Name, vars),
+			})
+		}
 	}
 	return res, nil
 }
@@ -261,3 +454,51 @@ func (e *PolicyEvaluator) getRuleResult(name string, vars rego.Vars) (result Rul
 
 	return result
 }
+
+// getHeaders gets the headers var. It expects an object of strings or arrays
+// of strings.
+func (e *PolicyEvaluator) getHeaders(vars rego.Vars) http.Header {
+	m, ok := vars["result"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	obj, ok := m["headers"].(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		return nil
+	}
+
+	headers := make(http.Header)
+	for k, v := range obj {
+		switch t := v.(type) {
+		case string:
+			headers.Add(k, t)
+		case []interface{}:
+			for _, vv := range t {
+				if s, ok := vv.(string); ok {
+					headers.Add(k, s)
+				}
+			}
+		}
+	}
+	return headers
+}
+
+// getResponseBody gets the response_body and response_content_type vars.
+// The content type defaults to text/plain.
+func (e *PolicyEvaluator) getResponseBody(vars rego.Vars) (body, contentType string) {
+	m, ok := vars["result"].(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+
+	body, _ = m["response_body"].(string)
+	if body == "" {
+		return "", ""
+	}
+	contentType, _ = m["response_content_type"].(string)
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	return body, contentType
+}
@@ -2,6 +2,10 @@ package evaluator
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -14,12 +18,17 @@ import (
 
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/geoip"
+	"github.com/pomerium/pomerium/internal/geoip/geoiptest"
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/ratelimit"
 	"github.com/pomerium/pomerium/pkg/contextutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/policy"
 	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
 
@@ -115,6 +124,27 @@ func TestPolicyEvaluator(t *testing.T) {
 			Traces: []contextutil.PolicyEvaluationTrace{{}},
 		}, output)
 	})
+	t.Run("explain", func(t *testing.T) {
+		output, err := eval(t,
+			p1,
+			[]proto.Message{s1, u1, s2, u2},
+			&PolicyRequest{
+				HTTP:    RequestHTTP{Method: "GET", URL: "https://from.example.com/path"},
+				Session: RequestSession{ID: "s2"},
+
+				IsValidClientCertificate: true,
+				Explain:                  true,
+			})
+		require.NoError(t, err)
+
+		results := map[string]RuleResult{}
+		for _, c := range output.Criteria {
+			results[string(c.Action)+"/"+c.Criterion.Name] = c.Result
+		}
+		assert.Equal(t, NewRuleResult(false, criteria.ReasonEmailUnauthorized), results["allow/email"])
+		assert.Equal(t, NewRuleResult(false, criteria.ReasonNonPomeriumRoute), results["allow/pomerium_routes"])
+		assert.Equal(t, NewRuleResult(false, criteria.ReasonValidClientCertificateOrNoneRequired), results["deny/invalid_client_certificate"])
+	})
 	t.Run("ppl", func(t *testing.T) {
 		t.Run("allow", func(t *testing.T) {
 			rego, err := policy.GenerateRegoFromReader(strings.NewReader(`
@@ -294,3 +324,366 @@ func TestPolicyEvaluator(t *testing.T) {
 		}, output)
 	})
 }
+
+func TestPolicyEvaluator_geoIP(t *testing.T) {
+	bs, err := geoiptest.Build(24, map[string]map[string]any{
+		"1.1.1.0/24": {
+			"country":                        map[string]any{"iso_code": "AU"},
+			"autonomous_system_number":       uint64(13335),
+			"autonomous_system_organization": "CLOUDFLARENET",
+		},
+	})
+	require.NoError(t, err)
+	r, err := geoip.NewReader(bs)
+	require.NoError(t, err)
+
+	store := store.New()
+	store.UpdateGeoIPDatabase(geoip.NewDatabase(r))
+
+	p := &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		Policy: &config.PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					And: []parser.Criterion{
+						{Name: "geoip_country", Data: parser.String("AU")},
+						{Name: "geoip_asn", Data: parser.Number("13335")},
+					},
+				}},
+			},
+		},
+	}
+	ctx := context.Background()
+	e, err := NewPolicyEvaluator(ctx, store, p)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		ip     string
+		expect RuleResult
+	}{
+		{"1.1.1.1", NewRuleResult(true, criteria.ReasonGeoIPASNOK, criteria.ReasonGeoIPCountryOK)},
+		{"8.8.8.8", NewRuleResult(false, criteria.ReasonGeoIPASNUnauthorized, criteria.ReasonGeoIPCountryUnauthorized, criteria.ReasonNonPomeriumRoute)},
+		{"", NewRuleResult(false, criteria.ReasonGeoIPASNUnauthorized, criteria.ReasonGeoIPCountryUnauthorized, criteria.ReasonNonPomeriumRoute)},
+	} {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP:                     RequestHTTP{Method: "GET", URL: "https://from.example.com/path", IP: tc.ip},
+			IsValidClientCertificate: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, output.Allow, tc.ip)
+	}
+}
+
+func TestPolicyEvaluator_rateLimit(t *testing.T) {
+	store := store.New()
+	store.UpdateRateLimiter(ratelimit.New(ratelimit.NewMemoryCounter()))
+
+	newPolicy := func(from string) *config.Policy {
+		p := &config.Policy{
+			From: from,
+			To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			Policy: &config.PPLPolicy{
+				Policy: &parser.Policy{
+					Rules: []parser.Rule{{
+						Action: parser.ActionAllow,
+						And: []parser.Criterion{
+							{Name: "rate_limit", Data: parser.Object{
+								"requests": parser.Number("2"),
+								"window":   parser.String("1h"),
+							}},
+						},
+					}},
+				},
+			},
+		}
+		require.NoError(t, p.Validate())
+		return p
+	}
+	ctx := context.Background()
+	e1, err := NewPolicyEvaluator(ctx, store, newPolicy("https://from1.example.com"))
+	require.NoError(t, err)
+	e2, err := NewPolicyEvaluator(ctx, store, newPolicy("https://from2.example.com"))
+	require.NoError(t, err)
+
+	eval := func(e *PolicyEvaluator, ip string) bool {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP:                     RequestHTTP{Method: "GET", URL: "https://from.example.com/path", IP: ip},
+			IsValidClientCertificate: true,
+		})
+		require.NoError(t, err)
+		return output.Allow.Value
+	}
+
+	assert.True(t, eval(e1, "1.1.1.1"))
+	assert.True(t, eval(e1, "1.1.1.1"))
+	assert.False(t, eval(e1, "1.1.1.1"), "should deny requests over the limit")
+	assert.True(t, eval(e1, "8.8.8.8"), "should count clients separately")
+	assert.True(t, eval(e2, "1.1.1.1"), "should count routes separately")
+}
+
+func TestPolicyEvaluator_shadow(t *testing.T) {
+	pathStartsWith := func(prefix string) *config.PPLPolicy {
+		return &config.PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					And: []parser.Criterion{
+						{Name: "http_path", Data: parser.Object{"starts_with": parser.String(prefix)}},
+					},
+				}},
+			},
+		}
+	}
+
+	ctx := context.Background()
+	p := &config.Policy{
+		From:   "https://from.example.com",
+		To:     config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		Policy: pathStartsWith("/"),
+	}
+	e, err := NewPolicyEvaluator(ctx, store.New(), p)
+	require.NoError(t, err)
+
+	eval := func(e *PolicyEvaluator, path string) *PolicyResponse {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP:                     RequestHTTP{Method: "GET", Path: path, URL: "https://from.example.com" + path},
+			IsValidClientCertificate: true,
+		})
+		require.NoError(t, err)
+		return output
+	}
+
+	output := eval(e, "/private")
+	assert.True(t, output.Allow.Value)
+	assert.Nil(t, output.Shadow, "should not evaluate a shadow policy without one")
+
+	p.ShadowPolicy = pathStartsWith("/public")
+	e, err = NewPolicyEvaluator(ctx, store.New(), p)
+	require.NoError(t, err)
+
+	output = eval(e, "/public/index.html")
+	assert.True(t, output.Allow.Value)
+	if assert.NotNil(t, output.Shadow) {
+		assert.True(t, output.Shadow.Allow.Value)
+		assert.False(t, output.Shadow.Deny.Value)
+	}
+
+	output = eval(e, "/private")
+	assert.True(t, output.Allow.Value, "should not enforce the shadow policy")
+	if assert.NotNil(t, output.Shadow) {
+		assert.Equal(t, NewRuleResult(false, criteria.ReasonHTTPPathUnauthorized, criteria.ReasonNonPomeriumRoute), output.Shadow.Allow)
+	}
+
+	p.ShadowPolicy = &config.PPLPolicy{
+		Policy: &parser.Policy{
+			Rules: []parser.Rule{{
+				Action: parser.ActionAllow,
+				And:    []parser.Criterion{{Name: "not_a_criterion"}},
+			}},
+		},
+	}
+	_, err = NewPolicyEvaluator(ctx, store.New(), p)
+	assert.Error(t, err, "should reject an invalid shadow policy")
+}
+
+func TestPolicyEvaluator_customRego(t *testing.T) {
+	libraries := []string{`
+package lib.tickets
+
+approved := {"T-1"}
+`}
+	p := &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		RegoModules: []string{`
+package lib.route
+
+ticket := input.http.headers["X-Ticket"]
+`},
+		SubPolicies: []config.SubPolicy{{
+			Rego: []string{`
+package example.authz
+
+import data.lib.route
+import data.lib.tickets
+
+default allow := false
+
+allow {
+	tickets.approved[route.ticket]
+}
+
+headers["X-Ticket-Approved"] := route.ticket {
+	allow
+}
+
+response_body := "an approved ticket is required" {
+	not allow
+}
+`},
+			RegoEntrypoint: "example.authz",
+		}},
+	}
+
+	ctx := context.Background()
+	e, err := newPolicyEvaluator(ctx, store.New(), p, libraries)
+	require.NoError(t, err)
+
+	eval := func(ticket string) *PolicyResponse {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP: RequestHTTP{
+				Method:  "GET",
+				URL:     "https://from.example.com/path",
+				Headers: map[string]string{"X-Ticket": ticket},
+			},
+			IsValidClientCertificate: true,
+		})
+		require.NoError(t, err)
+		return output
+	}
+
+	output := eval("T-1")
+	assert.True(t, output.Allow.Value)
+	assert.Equal(t, http.Header{"X-Ticket-Approved": {"T-1"}}, output.Headers)
+	assert.Empty(t, output.ResponseBody)
+
+	output = eval("T-2")
+	assert.False(t, output.Allow.Value)
+	assert.Nil(t, output.Headers)
+	assert.Equal(t, "an approved ticket is required", output.ResponseBody)
+	assert.Equal(t, "text/plain; charset=utf-8", output.ResponseContentType)
+
+	e, err = NewPolicyEvaluator(ctx, store.New(), p)
+	require.NoError(t, err)
+	assert.False(t, eval("T-1").Allow.Value, "should not load the rego libraries")
+}
+
+func TestPolicyEvaluator_remoteOPA(t *testing.T) {
+	var inputs []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/data/pomerium/policy", r.URL.Path)
+		assert.Equal(t, "Bearer TOKEN", r.Header.Get("Authorization"))
+
+		var body struct {
+			Input map[string]interface{} `json:"input"`
+		}
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&body)) {
+			return
+		}
+		inputs = append(inputs, body.Input)
+
+		if body.Input["http"].(map[string]interface{})["method"] == "GET" {
+			_, _ = io.WriteString(w, `{"result":{"allow":[true,["remote-allow"]],"headers":{"X-Remote":"1"}}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"result":{"allow":false,"deny":[true,["remote-deny"]]}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	p := &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		RemoteOPA: &config.RemoteOPAOptions{
+			URL:         srv.URL + "/v1/data/pomerium/policy",
+			BearerToken: "TOKEN",
+		},
+	}
+
+	ctx := context.Background()
+	e, err := NewPolicyEvaluator(ctx, store.New(), p)
+	require.NoError(t, err)
+	assert.False(t, e.cacheable, "remote decisions should not be cached")
+
+	output, err := e.Evaluate(ctx, &PolicyRequest{
+		HTTP:                     RequestHTTP{Method: "GET", URL: "https://from.example.com/path"},
+		Session:                  RequestSession{ID: "s1"},
+		IsValidClientCertificate: true,
+	})
+	require.NoError(t, err)
+	assert.True(t, output.Allow.Value)
+	assert.True(t, output.Allow.Reasons.Has("remote-allow"))
+	assert.Equal(t, http.Header{"X-Remote": {"1"}}, output.Headers)
+	require.Len(t, inputs, 1)
+	assert.Equal(t, map[string]interface{}{"id": "s1"}, inputs[0]["session"])
+	assert.Equal(t, true, inputs[0]["is_valid_client_certificate"])
+
+	output, err = e.Evaluate(ctx, &PolicyRequest{
+		HTTP:                     RequestHTTP{Method: "POST", URL: "https://from.example.com/path"},
+		IsValidClientCertificate: true,
+	})
+	require.NoError(t, err)
+	assert.False(t, output.Allow.Value)
+	assert.True(t, output.Deny.Value)
+	assert.True(t, output.Deny.Reasons.Has("remote-deny"))
+
+	srv.Close()
+	_, err = e.Evaluate(ctx, &PolicyRequest{
+		HTTP:                     RequestHTTP{Method: "GET", URL: "https://from.example.com/path"},
+		IsValidClientCertificate: true,
+	})
+	assert.Error(t, err, "should fail closed when opa is unavailable")
+}
+
+func TestPolicyEvaluator_cedar(t *testing.T) {
+	p := &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		CedarPolicy: `
+permit (principal in Group::"admins", action, resource);
+
+permit (principal is User, action == Action::"GET", resource == Route::"https://from.example.com")
+when { principal.email like "*@example.com" && context.http.path like "/public/*" };
+
+permit (principal in User::"u1", action, resource);
+
+forbid (principal, action == Action::"DELETE", resource)
+unless { principal has claims && principal.claims has groups && principal.claims.groups.contains("admins") };
+`,
+	}
+
+	ctx := context.Background()
+	ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(
+		&session.Session{Id: "s1", UserId: "u1", Claims: identity.FlattenedClaims{"groups": {"admins"}}.ToPB()},
+		&session.Session{Id: "s2", UserId: "u2"},
+		&user.User{Id: "u2", Email: "u2@example.com"},
+		&user.ServiceAccount{Id: "sa1", UserId: "u1"},
+	))
+	e, err := NewPolicyEvaluator(ctx, store.New(), p)
+	require.NoError(t, err)
+
+	eval := func(sessionID, method, path string) *PolicyResponse {
+		output, err := e.Evaluate(ctx, &PolicyRequest{
+			HTTP:                     RequestHTTP{Method: method, Path: path, URL: "https://from.example.com" + path},
+			Session:                  RequestSession{ID: sessionID},
+			IsValidClientCertificate: true,
+		})
+		require.NoError(t, err)
+		return output
+	}
+
+	output := eval("s1", "DELETE", "/")
+	assert.True(t, output.Allow.Value, "groups claims should make users members of groups")
+	assert.False(t, output.Deny.Value)
+
+	output = eval("s2", "GET", "/public/x")
+	assert.True(t, output.Allow.Value)
+	assert.True(t, output.Allow.Reasons.Has(criteria.ReasonCedarPolicyOK))
+
+	output = eval("s2", "GET", "/private")
+	assert.False(t, output.Allow.Value)
+	assert.True(t, output.Allow.Reasons.Has(criteria.ReasonCedarPolicyUnauthorized))
+	assert.False(t, output.Allow.Reasons.Has(criteria.ReasonUserUnauthenticated))
+
+	output = eval("sa1", "DELETE", "/")
+	assert.True(t, output.Deny.Value, "forbid policies should deny requests")
+	assert.True(t, output.Deny.Reasons.Has(criteria.ReasonCedarPolicyForbidden))
+
+	output = eval("sa1", "GET", "/")
+	assert.True(t, output.Allow.Value, "service accounts should be in their user")
+
+	output = eval("", "GET", "/public/x")
+	assert.False(t, output.Allow.Value)
+	assert.True(t, output.Allow.Reasons.Has(criteria.ReasonUserUnauthenticated))
+}
@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+const maxRemoteOPAResponseSize = 1 << 20
+
+var remoteOPAHTTPClient = httputil.NewLoggingClient(http.DefaultClient, "remote_opa_http_client")
+
+// A remoteOPA evaluates policy input with an external OPA instance.
+type remoteOPA struct {
+	options *config.RemoteOPAOptions
+	client  *http.Client
+}
+
+func newRemoteOPA(options *config.RemoteOPAOptions) *remoteOPA {
+	return &remoteOPA{options: options, client: remoteOPAHTTPClient}
+}
+
+// evaluate posts the policy input to OPA's data API, and returns the result
+// document in place of the result of a rego query.
+func (r *remoteOPA) evaluate(ctx context.Context, req *PolicyRequest) (rego.Vars, error) {
+	ctx, span := trace.StartSpan(ctx, "authorize.remoteOPA.evaluate")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.options.GetTimeout())
+	defer cancel()
+
+	body, err := json.Marshal(map[string]interface{}{"input": req})
+	if err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Accept", "application/json")
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("User-Agent", version.UserAgent())
+	if r.options.BearerToken != "" {
+		hreq.Header.Set("Authorization", "Bearer "+r.options.BearerToken)
+	}
+
+	res, err := r.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	var doc struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, maxRemoteOPAResponseSize)).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	// an undefined document has no result, which allows nothing
+	return rego.Vars{"result": doc.Result}, nil
+}
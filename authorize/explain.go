@@ -0,0 +1,213 @@
+package authorize
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const (
+	explainPath           = "/.pomerium/explain"
+	explainRequestMaxSize = 1 << 20
+)
+
+// An explainRequest is a request to explain the policy decision for a
+// request to a route.
+type explainRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	IP      string            `json:"ip"`
+	// SessionID is the session the request is made with. If only UserID is
+	// set, the user's most recent session is used. If neither is set, the
+	// request is unauthenticated.
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+}
+
+type explainRuleResult struct {
+	Value   bool     `json:"value"`
+	Reasons []string `json:"reasons"`
+}
+
+type explainCriterion struct {
+	Action    string `json:"action"`
+	Operator  string `json:"operator"`
+	Criterion string `json:"criterion"`
+	Data      any    `json:"data,omitempty"`
+	explainRuleResult
+}
+
+type explainCustomPolicy struct {
+	ID          string `json:"id,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+	Allow       bool   `json:"allow"`
+	Deny        bool   `json:"deny"`
+}
+
+type explainResponse struct {
+	Route          string                `json:"route,omitempty"`
+	SessionID      string                `json:"session_id,omitempty"`
+	Allowed        bool                  `json:"allowed"`
+	Allow          explainRuleResult     `json:"allow"`
+	Deny           explainRuleResult     `json:"deny"`
+	Criteria       []explainCriterion    `json:"criteria"`
+	CustomPolicies []explainCustomPolicy `json:"custom_policies,omitempty"`
+}
+
+// Mount mounts the authorize service's HTTP endpoints to a mux router.
+func (a *Authorize) Mount(r *mux.Router) {
+	r.Path(explainPath).Handler(httputil.HandlerFunc(a.Explain)).Methods(http.MethodPost)
+}
+
+// Explain evaluates the policy of the route matching a request, as made by
+// a user or session, and returns which criteria of the policy matched or
+// failed. Session revocation and binding checks are not explained.
+func (a *Authorize) Explain(w http.ResponseWriter, r *http.Request) error {
+	options := a.currentOptions.Load()
+	if options.ExplainAPIToken == "" {
+		return httputil.NewError(http.StatusNotFound, errors.New("the explain api is not enabled"))
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	tokenHash, expectedHash := sha256.Sum256([]byte(token)), sha256.Sum256([]byte(options.ExplainAPIToken))
+	if subtle.ConstantTimeCompare(tokenHash[:], expectedHash[:]) != 1 {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("invalid bearer token"))
+	}
+
+	var in explainRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, explainRequestMaxSize)).Decode(&in); err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+	}
+	requestURL, err := url.Parse(in.URL)
+	if err != nil || requestURL.Host == "" {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid url: %s", in.URL))
+	}
+	method := in.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	state := a.state.Load()
+	ctx := storage.WithQuerier(r.Context(), storage.NewQuerier(state.dataBrokerClient))
+
+	sessionID := in.SessionID
+	if sessionID == "" && in.UserID != "" {
+		sessionID, err = getLatestUserSessionID(ctx, state.sessionServiceClient, in.UserID)
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, err)
+		} else if sessionID == "" {
+			return httputil.NewError(http.StatusNotFound, fmt.Errorf("no sessions found for user: %s", in.UserID))
+		}
+	}
+
+	req := &evaluator.Request{
+		Policy:  a.getMatchingPolicy(*requestURL),
+		HTTP:    evaluator.NewRequestHTTP(method, *requestURL, in.Headers, "", in.IP),
+		Session: evaluator.RequestSession{ID: sessionID},
+		Explain: true,
+	}
+	req.HTTP.Body, req.HTTP.BodySize = in.Body, int64(len(in.Body))
+	if req.Policy == nil {
+		return httputil.NewError(http.StatusNotFound, fmt.Errorf("no route matches url: %s", in.URL))
+	}
+
+	a.stateLock.RLock()
+	res, err := a.state.Load().evaluator.Evaluate(ctx, req)
+	a.stateLock.RUnlock()
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
+	out := explainResponse{
+		Route:     req.Policy.From,
+		SessionID: sessionID,
+		Allowed:   res.Allow.Value && !res.Deny.Value,
+		Allow:     newExplainRuleResult(res.Allow),
+		Deny:      newExplainRuleResult(res.Deny),
+		Criteria:  make([]explainCriterion, 0, len(res.Criteria)),
+	}
+	for _, c := range res.Criteria {
+		name := c.Criterion.Name
+		if c.Criterion.SubPath != "" {
+			name += "/" + c.Criterion.SubPath
+		}
+		var data any
+		if c.Criterion.Data != nil {
+			data, _ = ast.JSON(c.Criterion.Data.RegoValue())
+		}
+		out.Criteria = append(out.Criteria, explainCriterion{
+			Action:            string(c.Action),
+			Operator:          c.Operator,
+			Criterion:         name,
+			Data:              data,
+			explainRuleResult: newExplainRuleResult(c.Result),
+		})
+	}
+	// the first trace is the PPL policy, the rest are the custom rego
+	// policies
+	for i, t := range res.Traces {
+		if i == 0 {
+			continue
+		}
+		out.CustomPolicies = append(out.CustomPolicies, explainCustomPolicy{
+			ID:          t.ID,
+			Explanation: t.Explanation,
+			Remediation: t.Remediation,
+			Allow:       t.Allow,
+			Deny:        t.Deny,
+		})
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, out)
+	return nil
+}
+
+func newExplainRuleResult(result evaluator.RuleResult) explainRuleResult {
+	reasons := make([]string, 0, len(result.Reasons))
+	for reason := range result.Reasons {
+		reasons = append(reasons, string(reason))
+	}
+	sort.Strings(reasons)
+	return explainRuleResult{Value: result.Value, Reasons: reasons}
+}
+
+// getLatestUserSessionID returns the id of the most recently issued session
+// of a user, or an empty string if the user has no sessions.
+func getLatestUserSessionID(ctx context.Context, client session.SessionServiceClient, userID string) (string, error) {
+	res, err := client.ListUserSessions(ctx, &session.ListUserSessionsRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("authorize: error listing user sessions: %w", err)
+	}
+
+	var latest *session.SessionInfo
+	for _, s := range res.GetSessions() {
+		if latest == nil || s.GetIssuedAt().AsTime().After(latest.GetIssuedAt().AsTime()) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+	return latest.GetId(), nil
+}
@@ -0,0 +1,115 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestAuthorize_Explain(t *testing.T) {
+	t.Parallel()
+
+	o := &config.Options{
+		AuthenticateURLString: "https://authN.example.com",
+		DataBrokerURLString:   "https://databroker.example.com",
+		SharedKey:             "gXK6ggrlIW2HyKyUF9rUO4azrDgxhDPWqw9y+lJU7B8=",
+		Policies:              testPolicies(t),
+		ExplainAPIToken:       "TOKEN",
+	}
+	a, err := New(&config.Config{Options: o})
+	require.NoError(t, err)
+	a.OnConfigChange(context.Background(), &config.Config{Options: o})
+
+	now := time.Now()
+	records := []proto.Message{
+		&session.Session{Id: "s2", UserId: "u1", IssuedAt: timestamppb.New(now)},
+		&session.Session{Id: "s3", UserId: "u2", IssuedAt: timestamppb.New(now)},
+		&user.User{Id: "u1", Email: "test@gmail.com"},
+		&user.User{Id: "u2", Email: "other@gmail.com"},
+	}
+	a.state.Load().dataBrokerClient = mockDataBrokerServiceClient{
+		query: func(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+			return storage.NewStaticQuerier(records...).Query(ctx, in, opts...)
+		},
+	}
+	a.state.Load().sessionServiceClient = mockSessionServiceClient{
+		listUserSessions: func(ctx context.Context, in *session.ListUserSessionsRequest, opts ...grpc.CallOption) (*session.ListUserSessionsResponse, error) {
+			res := new(session.ListUserSessionsResponse)
+			if in.GetUserId() == "u1" {
+				res.Sessions = []*session.SessionInfo{
+					{Id: "s1", IssuedAt: timestamppb.New(now.Add(-time.Hour))},
+					{Id: "s2", IssuedAt: timestamppb.New(now)},
+				}
+			}
+			return res, nil
+		},
+	}
+
+	do := func(token, body string) (*httptest.ResponseRecorder, explainResponse) {
+		r := httptest.NewRequest(http.MethodPost, "https://pomerium.io"+explainPath, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(a.Explain).ServeHTTP(w, r)
+		var res explainResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		w, res := do("TOKEN", `{"url": "https://pomerium.io/path", "user_id": "u1"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.True(t, res.Allowed)
+		assert.Equal(t, "s2", res.SessionID)
+		assert.Equal(t, "https://pomerium.io", res.Route)
+		assert.Contains(t, res.Criteria, explainCriterion{
+			Action:            "allow",
+			Operator:          "or",
+			Criterion:         "email",
+			Data:              map[string]any{"is": "test@gmail.com"},
+			explainRuleResult: explainRuleResult{Value: true, Reasons: []string{"email-ok"}},
+		})
+	})
+	t.Run("denied", func(t *testing.T) {
+		w, res := do("TOKEN", `{"url": "https://pomerium.io/path", "session_id": "s3"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.False(t, res.Allowed)
+		assert.Contains(t, res.Allow.Reasons, "email-unauthorized")
+	})
+	t.Run("errors", func(t *testing.T) {
+		w, _ := do("WRONG", `{"url": "https://pomerium.io/path"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w, _ = do("TOKEN", `{"url": "https://unknown.example.com"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w, _ = do("TOKEN", `{"url": "https://pomerium.io", "user_id": "u3"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w, _ = do("TOKEN", `{"url": "/path"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+type mockSessionServiceClient struct {
+	session.SessionServiceClient
+
+	listUserSessions func(ctx context.Context, in *session.ListUserSessionsRequest, opts ...grpc.CallOption) (*session.ListUserSessionsResponse, error)
+}
+
+func (m mockSessionServiceClient) ListUserSessions(ctx context.Context, in *session.ListUserSessionsRequest, opts ...grpc.CallOption) (*session.ListUserSessionsResponse, error) {
+	return m.listUserSessions(ctx, in, opts...)
+}
@@ -0,0 +1,179 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const (
+	externalDataCheckInterval = time.Second
+	externalDataTimeout       = 30 * time.Second
+	externalDataMaxSize       = 10 << 20
+)
+
+type externalDataSource struct {
+	options     config.ExternalDataSourceOptions
+	nextRefresh time.Time
+	etag        string
+}
+
+// externalData fetches the documents of the external data sources and stores
+// them for policy evaluation. If a document can't be fetched, the last one
+// is kept.
+type externalData struct {
+	store      *store.Store
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	sources   map[string]*externalDataSource
+	documents map[string]any
+}
+
+func newExternalData(store *store.Store) *externalData {
+	return &externalData{
+		store:      store,
+		httpClient: http.DefaultClient,
+		sources:    make(map[string]*externalDataSource),
+		documents:  make(map[string]any),
+	}
+}
+
+// OnConfigChange updates the external data sources. Sources whose options
+// changed are fetched again.
+func (d *externalData) OnConfigChange(options *config.Options) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current := make(map[string]bool)
+	for _, o := range options.ExternalDataSources {
+		current[o.Name] = true
+		if src, ok := d.sources[o.Name]; ok && src.options.Equal(&o) {
+			continue
+		}
+		d.sources[o.Name] = &externalDataSource{options: o}
+		delete(d.documents, o.Name)
+	}
+	for name := range d.sources {
+		if !current[name] {
+			delete(d.sources, name)
+			delete(d.documents, name)
+		}
+	}
+	d.store.UpdateExternalData(d.copyDocuments())
+}
+
+// Run fetches the documents of the external data sources when they are due.
+func (d *externalData) Run(ctx context.Context) error {
+	ticker := time.NewTicker(externalDataCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *externalData) refresh(ctx context.Context, now time.Time) {
+	d.mu.Lock()
+	var due []externalDataSource
+	for _, src := range d.sources {
+		if !now.Before(src.nextRefresh) {
+			src.nextRefresh = now.Add(src.options.GetRefreshInterval())
+			due = append(due, *src)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, src := range due {
+		document, etag, err := d.fetch(ctx, &src.options, src.etag)
+		if err != nil {
+			log.Error(ctx).Err(err).
+				Str("source", src.options.Name).
+				Str("url", src.options.URL).
+				Msg("authorize: error fetching external data")
+			continue
+		} else if document == nil {
+			continue
+		}
+
+		d.mu.Lock()
+		// the options changed while fetching
+		if cur, ok := d.sources[src.options.Name]; !ok || !cur.options.Equal(&src.options) {
+			d.mu.Unlock()
+			continue
+		}
+		d.sources[src.options.Name].etag = etag
+		d.documents[src.options.Name] = document
+		d.store.UpdateExternalData(d.copyDocuments())
+		d.mu.Unlock()
+	}
+}
+
+// fetch fetches a document. If the document hasn't changed since the etag, nil
+// is returned.
+func (d *externalData) fetch(ctx context.Context, o *config.ExternalDataSourceOptions, etag string) (any, string, error) {
+	ctx, clearTimeout := context.WithTimeout(ctx, externalDataTimeout)
+	defer clearTimeout()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, etag, nil
+	default:
+		return nil, "", fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	bs, err := io.ReadAll(io.LimitReader(res.Body, externalDataMaxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(bs) > externalDataMaxSize {
+		return nil, "", fmt.Errorf("document exceeds %d bytes", externalDataMaxSize)
+	}
+
+	var document any
+	if err := json.Unmarshal(bs, &document); err != nil {
+		return nil, "", fmt.Errorf("invalid json document: %w", err)
+	}
+	return document, res.Header.Get("ETag"), nil
+}
+
+func (d *externalData) copyDocuments() map[string]any {
+	documents := make(map[string]any, len(d.documents))
+	for k, v := range d.documents {
+		documents[k] = v
+	}
+	return documents
+}
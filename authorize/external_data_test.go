@@ -0,0 +1,83 @@
+package authorize
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestExternalData(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	var requests int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/oncall":
+			if r.Header.Get("Authorization") != "Bearer TOKEN" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte(`{"engineers": ["u1@example.com"]}`))
+		default:
+			_, _ = w.Write([]byte(`not json`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	s := store.New()
+	d := newExternalData(s)
+	d.httpClient = srv.Client()
+
+	getExternalData := func() any {
+		rs, err := rego.New(rego.Store(s), rego.Query("data.external")).Eval(ctx)
+		require.NoError(t, err)
+		require.Len(t, rs, 1)
+		return rs[0].Expressions[0].Value
+	}
+
+	d.OnConfigChange(&config.Options{
+		ExternalDataSources: []config.ExternalDataSourceOptions{
+			{Name: "oncall", URL: srv.URL + "/oncall", Headers: map[string]string{"Authorization": "Bearer TOKEN"}},
+			{Name: "invalid", URL: srv.URL + "/invalid"},
+		},
+	})
+	assert.Equal(t, map[string]any{}, getExternalData())
+
+	now := time.Now()
+	d.refresh(ctx, now)
+	assert.Equal(t, map[string]any{
+		"oncall": map[string]any{"engineers": []any{"u1@example.com"}},
+	}, getExternalData())
+	assert.Equal(t, 2, requests)
+
+	// sources are only fetched again after the refresh interval
+	d.refresh(ctx, now.Add(time.Second))
+	assert.Equal(t, 2, requests)
+
+	// an unchanged document is kept
+	d.refresh(ctx, now.Add(config.DefaultExternalDataSourceRefreshInterval))
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, map[string]any{
+		"oncall": map[string]any{"engineers": []any{"u1@example.com"}},
+	}, getExternalData())
+
+	// removed sources are removed
+	d.OnConfigChange(&config.Options{})
+	assert.Equal(t, map[string]any{}, getExternalData())
+}
@@ -5,8 +5,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
@@ -17,6 +20,7 @@ import (
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/contextutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
@@ -43,7 +47,16 @@ func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRe
 	hreq := getHTTPRequestFromCheckRequest(in)
 	ctx = requestid.WithValue(ctx, requestid.FromHTTPHeader(hreq.Header))
 
-	sessionState, _ := state.sessionStore.LoadSessionState(hreq)
+	sessionState, sessionHeaders, _ := state.sessionStore.ExchangeSessionState(hreq)
+	if sessionState != nil && a.revocations.IsRevoked(sessionState.ID) {
+		log.Info(ctx).Str("session-id", sessionState.ID).Msg("clearing revoked session")
+		sessionState = nil
+	}
+	if sessionState != nil && (a.userRevocations.IsRevoked(sessionState.UserID(), sessionState.IssuedAt.Time()) ||
+		a.userRevocations.IsRevoked(sessionState.IdentityProviderUserID(), sessionState.IssuedAt.Time())) {
+		log.Info(ctx).Str("session-id", sessionState.ID).Msg("clearing session of signed out user")
+		sessionState = nil
+	}
 
 	var s sessionOrServiceAccount
 	var u *user.User
@@ -55,6 +68,33 @@ func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRe
 			sessionState = nil
 		}
 	}
+	if sa, ok := s.(*user.ServiceAccount); ok && sessionState != nil {
+		u := getCheckRequestURL(in)
+		if reason := checkServiceAccount(sa, sessionState, u.Hostname(), time.Now()); reason != "" {
+			log.Info(ctx).Str("service-account-id", sa.GetId()).Str("reason", reason).
+				Msg("clearing invalid service account")
+			sessionState, s = nil, nil
+		}
+	}
+	if pbSession, ok := s.(*session.Session); ok && sessionState != nil {
+		a.checkImpersonation(ctx, state, pbSession)
+
+		options := a.currentOptions.Load()
+		binding := getSessionBinding(options, getPeerCertificate(in),
+			in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress(),
+			hreq.UserAgent())
+		binding.dpopKeyThumbprint, err = verifyDPoPProof(ctx, state, in, hreq)
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("invalid dpop proof")
+		}
+		if !a.checkSessionBinding(ctx, options, pbSession, binding) {
+			log.Warn(ctx).Str("session-id", sessionState.ID).Msg("clearing session due to session binding violation")
+			sessionState, s = nil, nil
+		} else if pbSession.GetDpopJkt() == "" && a.getMatchingPolicy(getCheckRequestURL(in)).GetRequireDPoP() {
+			log.Warn(ctx).Str("session-id", sessionState.ID).Msg("clearing session due to missing dpop binding")
+			sessionState, s = nil, nil
+		}
+	}
 	if sessionState != nil && s != nil {
 		u, _ = a.getDataBrokerUser(ctx, s.GetUserId()) // ignore any missing user error
 	}
@@ -64,29 +104,103 @@ func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRe
 		log.Warn(ctx).Err(err).Msg("error building evaluator request")
 		return nil, err
 	}
+	req.SessionVersion = getSessionVersion(s, u)
+
+	// a truncated body can't be matched reliably, so routes which match the
+	// body reject it rather than let it bypass a deny rule
+	if req.HTTP.BodyTruncated && req.Policy != nil && req.Policy.UsesRequestBody() {
+		return a.deniedResponse(ctx, in, http.StatusRequestEntityTooLarge,
+			http.StatusText(http.StatusRequestEntityTooLarge), nil)
+	}
 
 	// take the state lock here so we don't update while evaluating
 	a.stateLock.RLock()
+	evalStart := time.Now()
 	res, err := state.evaluator.Evaluate(ctx, req)
+	evalDuration := time.Since(evalStart)
 	a.stateLock.RUnlock()
 	if err != nil {
 		log.Error(ctx).Err(err).Msg("error during OPA evaluation")
 		return nil, err
 	}
+	if sessionState != nil && s != nil {
+		a.checkAccessRequests(ctx, req, res, s.GetUserId())
+		// if the request is still not allowed, offer to request access
+		if a.canRequestAccess(req, res, s.GetUserId()) {
+			ctx = contextutil.WithAccessRequestURL(ctx, a.accessRequestURL(req))
+		}
+	}
+	a.opaReporter.logDecision(req, res, evalDuration)
 
 	// if show error details is enabled, attach the policy evaluation traces
 	if req.Policy != nil && req.Policy.ShowErrorDetails {
 		ctx = contextutil.WithPolicyEvaluationTraces(ctx, res.Traces)
 	}
 
-	resp, err := a.handleResult(ctx, in, req, res)
+	var resp *envoy_service_auth_v3.CheckResponse
+	now := time.Now()
+	quota := checkQuota(ctx, state.rateLimiter, req, res, s, now)
+	if quota != nil && quota.exceeded() {
+		resp, err = a.deniedResponse(ctx, in, http.StatusTooManyRequests,
+			http.StatusText(http.StatusTooManyRequests), quota.headers(now))
+	} else {
+		resp, err = a.handleResult(ctx, in, req, res)
+	}
 	if err != nil {
 		log.Error(ctx).Err(err).Str("request-id", requestid.FromContext(ctx)).Msg("grpc check ext_authz_error")
 	}
+	if sessionState != nil && resp.GetOkResponse() != nil {
+		// sessions loaded from one-time tokens are exchanged for a cookie
+		appendSetCookieHeaders(resp.GetOkResponse(), sessionHeaders)
+		a.refreshSessionActivity(ctx, state, hreq, sessionState, resp.GetOkResponse())
+	}
+	if quota != nil && resp.GetOkResponse() != nil {
+		appendQuotaHeaders(resp.GetOkResponse(), quota.headers(now))
+	}
 	a.logAuthorizeCheck(ctx, in, resp, res, s, u)
 	return resp, err
 }
 
+// refreshSessionActivity updates the last activity timestamp of the session
+// cookie so that active sessions are not expired by the idle timeout.
+func (a *Authorize) refreshSessionActivity(
+	ctx context.Context,
+	state *authorizeState,
+	hreq *http.Request,
+	sessionState *sessions.State,
+	okResponse *envoy_service_auth_v3.OkHttpResponse,
+) {
+	hdrs, err := state.sessionStore.RefreshSessionState(hreq, sessionState)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("authorize: error refreshing session activity")
+		return
+	}
+	appendSetCookieHeaders(okResponse, hdrs)
+}
+
+// appendSetCookieHeaders adds the Set-Cookie headers to the response sent
+// to the client.
+func appendSetCookieHeaders(okResponse *envoy_service_auth_v3.OkHttpResponse, hdrs http.Header) {
+	for _, v := range hdrs.Values("Set-Cookie") {
+		h := mkHeader("Set-Cookie", v)
+		h.AppendAction = envoy_config_core_v3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD
+		okResponse.ResponseHeadersToAdd = append(okResponse.ResponseHeadersToAdd, h)
+	}
+}
+
+// appendQuotaHeaders adds the quota headers to the response sent to the
+// client.
+func appendQuotaHeaders(okResponse *envoy_service_auth_v3.OkHttpResponse, hdrs map[string]string) {
+	keys := make([]string, 0, len(hdrs))
+	for k := range hdrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		okResponse.ResponseHeadersToAdd = append(okResponse.ResponseHeadersToAdd, mkHeader(k, hdrs[k]))
+	}
+}
+
 func (a *Authorize) getEvaluatorRequestFromCheckRequest(
 	in *envoy_service_auth_v3.CheckRequest,
 	sessionState *sessions.State,
@@ -107,6 +221,7 @@ func (a *Authorize) getEvaluatorRequestFromCheckRequest(
 		}
 	}
 	req.Policy = a.getMatchingPolicy(requestURL)
+	req.HTTP.Body, req.HTTP.BodySize, req.HTTP.BodyTruncated = getCheckRequestBody(in, req.Policy)
 	return req, nil
 }
 
@@ -139,6 +254,28 @@ func getHTTPRequestFromCheckRequest(req *envoy_service_auth_v3.CheckRequest) *ht
 	return hreq
 }
 
+// partialBodyHeader is set by envoy when a request body exceeds the buffer.
+const partialBodyHeader = "x-envoy-auth-partial-body"
+
+// getCheckRequestBody returns the request body envoy buffered, the size of
+// the body, or -1 if it's unknown, and whether the body was truncated. Bodies
+// are only buffered for policies which inspect them.
+func getCheckRequestBody(in *envoy_service_auth_v3.CheckRequest, policy *config.Policy) (string, int64, bool) {
+	hattrs := in.GetAttributes().GetRequest().GetHttp()
+	if policy == nil || !policy.InspectRequestBody {
+		return "", hattrs.GetSize(), false
+	}
+
+	body := hattrs.GetRawBody()
+	if body == nil {
+		body = []byte(hattrs.GetBody())
+	}
+	if hattrs.GetHeaders()[partialBodyHeader] == "true" {
+		return string(body), hattrs.GetSize(), true
+	}
+	return string(body), int64(len(body)), false
+}
+
 func getCheckRequestHeaders(req *envoy_service_auth_v3.CheckRequest) map[string]string {
 	hdrs := make(map[string]string)
 	ch := req.GetAttributes().GetRequest().GetHttp().GetHeaders()
@@ -148,11 +148,49 @@ func Test_getEvaluatorRequestWithPortInHostHeader(t *testing.T) {
 	assert.Equal(t, expect, actual)
 }
 
+func Test_getCheckRequestBody(t *testing.T) {
+	newCheckRequest := func(size int64, body string, headers map[string]string) *envoy_service_auth_v3.CheckRequest {
+		return &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Headers: headers,
+						Size:    size,
+						RawBody: []byte(body),
+					},
+				},
+			},
+		}
+	}
+	inspect := &config.Policy{InspectRequestBody: true}
+
+	for _, tc := range []struct {
+		name      string
+		in        *envoy_service_auth_v3.CheckRequest
+		policy    *config.Policy
+		body      string
+		size      int64
+		truncated bool
+	}{
+		{"no policy", newCheckRequest(-1, "", nil), nil, "", -1, false},
+		{"not inspected", newCheckRequest(4, "BODY", nil), &config.Policy{}, "", 4, false},
+		{"chunked", newCheckRequest(-1, "BODY", nil), inspect, "BODY", 4, false},
+		{"empty", newCheckRequest(-1, "", nil), inspect, "", 0, false},
+		{"truncated", newCheckRequest(10, "BODY", map[string]string{"x-envoy-auth-partial-body": "true"}), inspect, "BODY", 10, true},
+	} {
+		body, size, truncated := getCheckRequestBody(tc.in, tc.policy)
+		assert.Equal(t, tc.body, body, tc.name)
+		assert.Equal(t, tc.size, size, tc.name)
+		assert.Equal(t, tc.truncated, truncated, tc.name)
+	}
+}
+
 type mockDataBrokerServiceClient struct {
 	databroker.DataBrokerServiceClient
 
-	get func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error)
-	put func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error)
+	get   func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error)
+	put   func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error)
+	query func(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error)
 }
 
 func (m mockDataBrokerServiceClient) Get(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
@@ -163,6 +201,10 @@ func (m mockDataBrokerServiceClient) Put(ctx context.Context, in *databroker.Put
 	return m.put(ctx, in, opts...)
 }
 
+func (m mockDataBrokerServiceClient) Query(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+	return m.query(ctx, in, opts...)
+}
+
 func mustParseURL(rawURL string) url.URL {
 	u, err := url.Parse(rawURL)
 	if err != nil {
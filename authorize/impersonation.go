@@ -0,0 +1,71 @@
+package authorize
+
+import (
+	"context"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// checkImpersonation ends the impersonation of a session once the
+// impersonated session has expired or been deleted, so that the operator is
+// authorized as themselves again.
+func (a *Authorize) checkImpersonation(ctx context.Context, state *authorizeState, s *session.Session) {
+	impersonateSessionID := s.GetImpersonateSessionId()
+	if impersonateSessionID == "" {
+		return
+	}
+
+	record, err := getDataBrokerRecord(ctx, grpcutil.GetTypeURL(new(session.Session)), impersonateSessionID, 0)
+	if err != nil && !storage.IsNotFound(err) {
+		log.Warn(ctx).Err(err).Msg("authorize: error loading impersonated session")
+		return
+	}
+	var impersonated session.Session
+	if err == nil {
+		if err := record.GetData().UnmarshalTo(&impersonated); err != nil {
+			log.Warn(ctx).Err(err).Msg("authorize: invalid impersonated session")
+			return
+		}
+		if impersonated.GetExpiresAt() == nil || impersonated.GetExpiresAt().AsTime().After(time.Now()) {
+			return
+		}
+	}
+
+	// re-load the session so that a cached copy doesn't overwrite newer data
+	current, err := session.Get(ctx, state.dataBrokerClient, s.GetId())
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("authorize: error loading session to end impersonation")
+		return
+	}
+	if current.GetImpersonateSessionId() == impersonateSessionID {
+		current.ImpersonateSessionId = nil
+		if _, err := session.Put(ctx, state.dataBrokerClient, current); err != nil {
+			log.Warn(ctx).Err(err).Msg("authorize: error ending impersonation")
+			return
+		}
+		if err := session.Delete(ctx, state.dataBrokerClient, impersonateSessionID); err != nil {
+			log.Warn(ctx).Err(err).Msg("authorize: error deleting impersonated session")
+		}
+	}
+
+	// policies must not see the cached impersonating session
+	req := &databroker.QueryRequest{
+		Type:  grpcutil.GetTypeURL(new(session.Session)),
+		Limit: 1,
+	}
+	req.SetFilterByIDOrIndex(s.GetId())
+	storage.GetQuerier(ctx).InvalidateCache(ctx, req)
+
+	log.Info(ctx).
+		Str("service", "authorize").
+		Str("session-id", s.GetId()).
+		Str("user-id", s.GetUserId()).
+		Str("impersonate-session-id", impersonateSessionID).
+		Msg("impersonation expired")
+	s.ImpersonateSessionId = nil
+}
@@ -0,0 +1,67 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestAuthorize_checkImpersonation(t *testing.T) {
+	t.Parallel()
+
+	records := map[string]*databroker.Record{}
+	state := &authorizeState{
+		dataBrokerClient: mockDataBrokerServiceClient{
+			get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+				record, ok := records[in.GetId()]
+				if !ok {
+					return nil, status.Error(codes.NotFound, "not found")
+				}
+				return &databroker.GetResponse{Record: record}, nil
+			},
+			put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+				for _, record := range in.GetRecords() {
+					if record.GetDeletedAt() != nil {
+						delete(records, record.GetId())
+					} else {
+						records[record.GetId()] = record
+					}
+				}
+				return &databroker.PutResponse{}, nil
+			},
+		},
+	}
+	a := &Authorize{}
+
+	check := func(impersonated *session.Session) *session.Session {
+		s := &session.Session{Id: "s1", UserId: "operator", ImpersonateSessionId: proto.String("s2")}
+		records["s1"] = databroker.NewRecord(s)
+		records["s2"] = databroker.NewRecord(impersonated)
+		ctx := storage.WithQuerier(context.Background(), storage.NewStaticQuerier(impersonated))
+		a.checkImpersonation(ctx, state, s)
+		return s
+	}
+
+	s := check(&session.Session{Id: "s2", UserId: "user", ExpiresAt: timestamppb.New(time.Now().Add(time.Minute))})
+	assert.Equal(t, "s2", s.GetImpersonateSessionId(), "should keep an active impersonation")
+	assert.Contains(t, records, "s2")
+
+	s = check(&session.Session{Id: "s2", UserId: "user", ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute))})
+	assert.Empty(t, s.GetImpersonateSessionId(), "should end an expired impersonation")
+	assert.NotContains(t, records, "s2")
+	var stored session.Session
+	require.NoError(t, records["s1"].GetData().UnmarshalTo(&stored))
+	assert.Empty(t, stored.GetImpersonateSessionId())
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+	"github.com/pomerium/datasource/pkg/directory"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// MaxGroupDepth is the maximum number of levels of the group hierarchy
+// get_group_ancestors follows.
+const MaxGroupDepth = 32
+
+// A directoryGroup is a group of the group hierarchy.
+type directoryGroup struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	ParentIDs []string `json:"parent_ids"`
+}
+
+// A groupLookup returns the directory group with the id, or nil if there is
+// no such group.
+type groupLookup func(ctx context.Context, id string) (*directoryGroup, error)
+
+// GetGroupAncestorsOption returns a function option that returns the groups
+// and all of their ancestors, up to a maximum depth, in the group hierarchy.
+// If the hierarchy can't be loaded, only the groups are returned.
+func (s *Store) GetGroupAncestorsOption() func(*rego.Rego) {
+	return rego.Function2(&rego.Function{
+		Name: "get_group_ancestors",
+		Decl: types.NewFunction(
+			types.Args(types.NewArray(nil, types.A), types.N),
+			types.NewArray(nil, types.S),
+		),
+	}, func(bctx rego.BuiltinContext, op1, op2 *ast.Term) (*ast.Term, error) {
+		ctx, span := trace.StartSpan(bctx.Context, "rego.get_group_ancestors")
+		defer span.End()
+
+		arr, ok := op1.Value.(*ast.Array)
+		if !ok {
+			return nil, fmt.Errorf("invalid groups: %T", op1)
+		}
+		var groups []string
+		arr.Foreach(func(t *ast.Term) {
+			if s, ok := t.Value.(ast.String); ok {
+				groups = append(groups, string(s))
+			}
+		})
+		depth, ok := op2.Value.(ast.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid max depth: %T", op2)
+		}
+		maxDepth, ok := depth.Int()
+		if !ok || maxDepth < 0 || maxDepth > MaxGroupDepth {
+			return nil, fmt.Errorf("invalid max depth: %s", depth)
+		}
+
+		ancestors, err := getGroupAncestors(ctx, getDirectoryGroup, groups, maxDepth)
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("authorize/store: error loading group hierarchy")
+			ancestors = groups
+		}
+
+		terms := make([]*ast.Term, 0, len(ancestors))
+		for _, g := range ancestors {
+			terms = append(terms, ast.StringTerm(g))
+		}
+		return ast.ArrayTerm(terms...), nil
+	})
+}
+
+// getGroupAncestors returns the groups and their ancestors, by id and name.
+// The parents of a group are the parents of its directory group, and the
+// group of its path, without the last element, for groups like eng/platform.
+// Groups are visited once, so cycles in the hierarchy end the walk, and
+// ancestors more than maxDepth levels up aren't returned.
+func getGroupAncestors(ctx context.Context, lookup groupLookup, groups []string, maxDepth int) ([]string, error) {
+	var ancestors []string
+	seen := make(map[string]struct{})
+	visit := func(g string, level []string) []string {
+		if _, ok := seen[g]; ok || g == "" {
+			return level
+		}
+		seen[g] = struct{}{}
+		ancestors = append(ancestors, g)
+		return append(level, g)
+	}
+
+	var level []string
+	for _, g := range groups {
+		level = visit(g, level)
+	}
+	for depth := 0; len(level) > 0; depth++ {
+		var next []string
+		// names are added to the level as they're found
+		for i := 0; i < len(level); i++ {
+			g := level[i]
+			dg, err := lookup(ctx, g)
+			if err != nil {
+				return nil, err
+			}
+			if dg != nil {
+				level = visit(dg.Name, level)
+			}
+			if depth == maxDepth {
+				continue
+			}
+			if dg != nil {
+				for _, parentID := range dg.ParentIDs {
+					next = visit(parentID, next)
+				}
+			}
+			if j := strings.LastIndex(strings.TrimSuffix(g, "/"), "/"); j > 0 {
+				next = visit(g[:j], next)
+			}
+		}
+		level = next
+	}
+	return ancestors, nil
+}
+
+func getDirectoryGroup(ctx context.Context, id string) (*directoryGroup, error) {
+	req := &databroker.QueryRequest{
+		Type:  directory.GroupRecordType,
+		Limit: 1,
+	}
+	req.SetFilterByID(id)
+
+	res, err := storage.GetQuerier(ctx).Query(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.GetRecords()) == 0 {
+		return nil, nil
+	}
+
+	msg, err := res.GetRecords()[0].GetData().UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	bs, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var g directoryGroup
+	if err := json.Unmarshal(bs, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
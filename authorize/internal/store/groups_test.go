@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetGroupAncestors(t *testing.T) {
+	t.Parallel()
+
+	directory := map[string]*directoryGroup{
+		"g-infra":    {ID: "g-infra", Name: "infra", ParentIDs: []string{"g-platform"}},
+		"g-platform": {ID: "g-platform", Name: "platform", ParentIDs: []string{"g-eng"}},
+		"g-eng":      {ID: "g-eng", Name: "eng"},
+		"g-a":        {ID: "g-a", ParentIDs: []string{"g-b"}},
+		"g-b":        {ID: "g-b", ParentIDs: []string{"g-a"}},
+	}
+	lookup := func(ctx context.Context, id string) (*directoryGroup, error) {
+		return directory[id], nil
+	}
+
+	for _, tc := range []struct {
+		name     string
+		groups   []string
+		maxDepth int
+		expect   []string
+	}{
+		{"directory", []string{"g-infra"}, 10, []string{"g-infra", "infra", "g-platform", "platform", "g-eng", "eng"}},
+		{"depth limit", []string{"g-infra"}, 1, []string{"g-infra", "infra", "g-platform", "platform"}},
+		{"no ancestors", []string{"g-infra"}, 0, []string{"g-infra", "infra"}},
+		{"paths", []string{"eng/platform/infra", "/ops/oncall"}, 10, []string{"eng/platform/infra", "/ops/oncall", "eng/platform", "/ops", "eng"}},
+		{"path depth limit", []string{"eng/platform/infra"}, 1, []string{"eng/platform/infra", "eng/platform"}},
+		{"cycle", []string{"g-a"}, 10, []string{"g-a", "g-b"}},
+		{"unknown", []string{"x", ""}, 10, []string{"x"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ancestors, err := getGroupAncestors(context.Background(), lookup, tc.groups, tc.maxDepth)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, ancestors)
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := getGroupAncestors(context.Background(), func(ctx context.Context, id string) (*directoryGroup, error) {
+			return nil, errors.New("unavailable")
+		}, []string{"g-eng"}, 10)
+		assert.Error(t, err)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/go-jose/go-jose/v3"
@@ -18,7 +19,10 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/geoip"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/ratelimit"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/storage"
@@ -27,12 +31,17 @@ import (
 // A Store stores data for the OPA rego policy evaluation.
 type Store struct {
 	opastorage.Store
+
+	geoIPDatabase *atomicutil.Value[*geoip.Database]
+	rateLimiter   *atomicutil.Value[*ratelimit.Limiter]
 }
 
 // New creates a new Store.
 func New() *Store {
 	return &Store{
-		Store: inmem.New(),
+		Store:         inmem.New(),
+		geoIPDatabase: atomicutil.NewValue[*geoip.Database](nil),
+		rateLimiter:   atomicutil.NewValue[*ratelimit.Limiter](nil),
 	}
 }
 
@@ -58,6 +67,76 @@ func (s *Store) UpdateSigningKey(signingKey *jose.JSONWebKey) {
 	s.write("/signing_key", signingKey)
 }
 
+// UpdateSigningKeyID updates the algorithm and key id of a signing key whose
+// private key isn't available. Only these are needed to sign JWTs with the
+// kms_sign_jwt function.
+func (s *Store) UpdateSigningKeyID(alg, kid string) {
+	s.write("/signing_key", map[string]string{"alg": alg, "kid": kid})
+}
+
+// UpdateSigningKeyKMS updates whether the signing key is stored in a key
+// management service, in which case JWTs are signed by the kms_sign_jwt function.
+func (s *Store) UpdateSigningKeyKMS(enabled bool) {
+	s.write("/signing_key_kms", enabled)
+}
+
+// UpdateGeoIPDatabase updates the geoip database client IP addresses are
+// looked up in.
+func (s *Store) UpdateGeoIPDatabase(db *geoip.Database) {
+	s.geoIPDatabase.Store(db)
+}
+
+// UpdateExternalData updates the documents of the external data sources,
+// which policies refer to as data.external.<name>.
+func (s *Store) UpdateExternalData(documents map[string]any) {
+	s.write("/external", documents)
+}
+
+// UpdateDataBrokerRecords updates the records of a databroker record type,
+// which policies refer to as data.databroker.<name>[<record id>]. Records
+// with a nil value are removed.
+func (s *Store) UpdateDataBrokerRecords(name string, records map[string]any) {
+	ctx := context.TODO()
+	err := opastorage.Txn(ctx, s.Store, opastorage.WriteParams, func(txn opastorage.Transaction) error {
+		for id, value := range records {
+			// record ids may contain slashes, so the path isn't parsed
+			p := opastorage.Path{"databroker", name, id}
+			if value != nil {
+				if err := s.writePath(txn, p, value); err != nil {
+					return err
+				}
+				continue
+			}
+
+			err := s.Write(ctx, txn, opastorage.RemoveOp, p, nil)
+			if err != nil && !opastorage.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("opa-store: error writing databroker records")
+	}
+}
+
+// ClearDataBrokerRecords removes all the records of a databroker record type.
+func (s *Store) ClearDataBrokerRecords(name string) {
+	s.write("/databroker/"+name, map[string]any{})
+}
+
+// ReplaceDataBrokerRecords replaces all the records of the databroker record
+// types, which removes the record types which aren't in the map.
+func (s *Store) ReplaceDataBrokerRecords(recordTypes map[string]any) {
+	s.write("/databroker", recordTypes)
+}
+
+// UpdateRateLimiter updates the rate limiter which counts the requests for
+// the rate_limit policy criterion.
+func (s *Store) UpdateRateLimiter(limiter *ratelimit.Limiter) {
+	s.rateLimiter.Store(limiter)
+}
+
 func (s *Store) write(rawPath string, value interface{}) {
 	ctx := context.TODO()
 	err := opastorage.Txn(ctx, s.Store, opastorage.WriteParams, func(txn opastorage.Transaction) error {
@@ -74,7 +153,10 @@ func (s *Store) writeTxn(txn opastorage.Transaction, rawPath string, value inter
 	if !ok {
 		return fmt.Errorf("invalid path")
 	}
+	return s.writePath(txn, p, value)
+}
 
+func (s *Store) writePath(txn opastorage.Transaction, p opastorage.Path, value interface{}) error {
 	if len(p) > 1 {
 		err := opastorage.MakeDir(context.Background(), s, txn, p[:len(p)-1])
 		if err != nil {
@@ -157,6 +239,92 @@ func (s *Store) GetDataBrokerRecordOption() func(*rego.Rego) {
 	})
 }
 
+// GetGeoIPLookupOption returns a function option that looks up the country
+// and autonomous system of an IP address. If the address isn't found, the
+// object is empty.
+func (s *Store) GetGeoIPLookupOption() func(*rego.Rego) {
+	return rego.Function1(&rego.Function{
+		Name: "geoip_lookup",
+		Decl: types.NewFunction(
+			types.Args(types.S),
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+		),
+	}, func(bctx rego.BuiltinContext, op1 *ast.Term) (*ast.Term, error) {
+		rawIP, ok := op1.Value.(ast.String)
+		if !ok {
+			return nil, fmt.Errorf("invalid ip: %T", op1)
+		}
+
+		obj := ast.NewObject()
+		ip := net.ParseIP(string(rawIP))
+		if ip == nil {
+			return ast.NewTerm(obj), nil
+		}
+
+		res, err := s.geoIPDatabase.Load().Lookup(ip)
+		if err != nil {
+			log.Error(bctx.Context).Err(err).Msg("authorize/store: error looking up ip address")
+			return ast.NewTerm(obj), nil
+		}
+
+		if res.Country != "" {
+			obj.Insert(ast.StringTerm("country"), ast.StringTerm(res.Country))
+		}
+		if res.ASN != 0 {
+			obj.Insert(ast.StringTerm("asn"), ast.UIntNumberTerm(res.ASN))
+			obj.Insert(ast.StringTerm("as_organization"), ast.StringTerm(res.ASOrganization))
+		}
+		return ast.NewTerm(obj), nil
+	})
+}
+
+// GetRateLimitOption returns a function option that counts a request for a
+// subject on the route and returns whether the number of requests in the
+// window is within the limit. If the count can't be stored, the request is
+// allowed.
+func (s *Store) GetRateLimitOption(routeID uint64) func(*rego.Rego) {
+	return rego.Function3(&rego.Function{
+		Name: "rate_limit",
+		Decl: types.NewFunction(
+			types.Args(types.S, types.N, types.N),
+			types.B,
+		),
+	}, func(bctx rego.BuiltinContext, op1, op2, op3 *ast.Term) (*ast.Term, error) {
+		ctx, span := trace.StartSpan(bctx.Context, "rego.rate_limit")
+		defer span.End()
+
+		subject, ok := op1.Value.(ast.String)
+		if !ok {
+			return nil, fmt.Errorf("invalid subject: %T", op1)
+		}
+		limit, ok := op2.Value.(ast.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid limit: %T", op2)
+		}
+		requests, ok := limit.Int64()
+		if !ok || requests < 0 {
+			return nil, fmt.Errorf("invalid limit: %s", limit)
+		}
+		window, ok := op3.Value.(ast.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid window: %T", op3)
+		}
+		seconds, ok := window.Int64()
+		if !ok {
+			return nil, fmt.Errorf("invalid window: %s", window)
+		}
+
+		// rate limits with different limits or windows are counted separately
+		key := fmt.Sprintf("%x/%d/%d/%s", routeID, requests, seconds, subject)
+		allowed, err := s.rateLimiter.Load().Allow(ctx, key, uint64(requests), time.Duration(seconds)*time.Second)
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("authorize/store: error checking rate limit")
+			return ast.BooleanTerm(true), nil
+		}
+		return ast.BooleanTerm(allowed), nil
+	})
+}
+
 func toMap(msg proto.Message) map[string]interface{} {
 	bs, _ := json.Marshal(msg)
 	var obj map[string]interface{}
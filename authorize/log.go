@@ -61,6 +61,9 @@ func (a *Authorize) logAuthorizeCheck(
 		} else {
 			evt = evt.Strs("deny-why-false", res.Deny.Reasons.Strings())
 		}
+		if res.Shadow != nil {
+			evt = populateLogShadowResult(evt, res)
+		}
 		evt = evt.Str("user", u.GetId())
 		evt = evt.Str("email", u.GetEmail())
 	}
@@ -72,6 +75,11 @@ func (a *Authorize) logAuthorizeCheck(
 
 	evt.Msg("authorize check")
 
+	// requests made while impersonating are always audited
+	if s, ok := s.(*session.Session); ok && s.GetImpersonateSessionId() != "" {
+		a.logImpersonation(ctx, in, res, s, u)
+	}
+
 	if enc := a.state.Load().auditEncryptor; enc != nil {
 		ctx, span := trace.StartSpan(ctx, "authorize.grpc.AuditAuthorizeCheck")
 		defer span.End()
@@ -98,9 +106,71 @@ func (a *Authorize) populateLogSessionDetails(ctx context.Context, evt *zerolog.
 		return evt
 	}
 
+	evt = evt.Str("impersonate-session-id", s.GetImpersonateSessionId())
+	impersonatedSession, impersonatedUser := getImpersonated(ctx, s)
+	if impersonatedSession == nil {
+		return evt
+	}
+	evt = evt.Str("impersonate-user-id", impersonatedSession.GetUserId())
+	if impersonatedUser == nil {
+		return evt
+	}
+	evt = evt.Str("impersonate-email", impersonatedUser.GetEmail())
+
+	return evt
+}
+
+// populateLogShadowResult adds the result of the shadow policy, and whether
+// it differs from the result of the enforced policy, to the log event.
+func populateLogShadowResult(evt *zerolog.Event, res *evaluator.Result) *zerolog.Event {
+	evt = evt.Bool("shadow-allow", res.Shadow.Allow.Value)
+	if res.Shadow.Allow.Value {
+		evt = evt.Strs("shadow-allow-why-true", res.Shadow.Allow.Reasons.Strings())
+	} else {
+		evt = evt.Strs("shadow-allow-why-false", res.Shadow.Allow.Reasons.Strings())
+	}
+	evt = evt.Bool("shadow-deny", res.Shadow.Deny.Value)
+	if res.Shadow.Deny.Value {
+		evt = evt.Strs("shadow-deny-why-true", res.Shadow.Deny.Reasons.Strings())
+	} else {
+		evt = evt.Strs("shadow-deny-why-false", res.Shadow.Deny.Reasons.Strings())
+	}
+	allowed := res.Allow.Value && !res.Deny.Value
+	shadowAllowed := res.Shadow.Allow.Value && !res.Shadow.Deny.Value
+	return evt.Bool("shadow-mismatch", allowed != shadowAllowed)
+}
+
+// logImpersonation logs an audit event for a request made by an operator
+// impersonating another user.
+func (a *Authorize) logImpersonation(
+	ctx context.Context,
+	in *envoy_service_auth_v3.CheckRequest,
+	res *evaluator.Result, s *session.Session, u *user.User,
+) {
+	hattrs := in.GetAttributes().GetRequest().GetHttp()
+	evt := log.Info(ctx).Str("service", "authorize").
+		Str("request-id", requestid.FromContext(ctx)).
+		Str("method", hattrs.GetMethod()).
+		Str("host", hattrs.GetHost()).
+		Str("path", stripQueryString(hattrs.GetPath())).
+		Str("session-id", s.GetId()).
+		Str("impersonator-user-id", s.GetUserId()).
+		Str("impersonator-email", u.GetEmail()).
+		Str("impersonate-session-id", s.GetImpersonateSessionId())
+	impersonatedSession, impersonatedUser := getImpersonated(ctx, s)
+	evt = evt.Str("impersonate-user-id", impersonatedSession.GetUserId()).
+		Str("impersonate-email", impersonatedUser.GetEmail())
+	if res != nil {
+		evt = evt.Bool("allow", res.Allow.Value).Bool("deny", res.Deny.Value)
+	}
+	evt.Msg("impersonated request")
+}
+
+// getImpersonated returns the session and user impersonated by a session.
+// Either is nil when it can't be found.
+func getImpersonated(ctx context.Context, s *session.Session) (*session.Session, *user.User) {
 	querier := storage.GetQuerier(ctx)
 
-	evt = evt.Str("impersonate-session-id", s.GetImpersonateSessionId())
 	req := &databroker.QueryRequest{
 		Type:  grpcutil.GetTypeURL(new(session.Session)),
 		Limit: 1,
@@ -108,18 +178,17 @@ func (a *Authorize) populateLogSessionDetails(ctx context.Context, evt *zerolog.
 	req.SetFilterByID(s.GetImpersonateSessionId())
 	res, err := querier.Query(ctx, req)
 	if err != nil || len(res.GetRecords()) == 0 {
-		return evt
+		return nil, nil
 	}
 
 	impersonatedSessionMsg, err := res.GetRecords()[0].GetData().UnmarshalNew()
 	if err != nil {
-		return evt
+		return nil, nil
 	}
 	impersonatedSession, ok := impersonatedSessionMsg.(*session.Session)
 	if !ok {
-		return evt
+		return nil, nil
 	}
-	evt = evt.Str("impersonate-user-id", impersonatedSession.GetUserId())
 
 	req = &databroker.QueryRequest{
 		Type:  grpcutil.GetTypeURL(new(user.User)),
@@ -128,20 +197,15 @@ func (a *Authorize) populateLogSessionDetails(ctx context.Context, evt *zerolog.
 	req.SetFilterByID(impersonatedSession.GetUserId())
 	res, err = querier.Query(ctx, req)
 	if err != nil || len(res.GetRecords()) == 0 {
-		return evt
+		return impersonatedSession, nil
 	}
 
 	impersonatedUserMsg, err := res.GetRecords()[0].GetData().UnmarshalNew()
 	if err != nil {
-		return evt
+		return impersonatedSession, nil
 	}
-	impersonatedUser, ok := impersonatedUserMsg.(*user.User)
-	if !ok {
-		return evt
-	}
-	evt = evt.Str("impersonate-email", impersonatedUser.GetEmail())
-
-	return evt
+	impersonatedUser, _ := impersonatedUserMsg.(*user.User)
+	return impersonatedSession, impersonatedUser
 }
 
 func stripQueryString(str string) string {
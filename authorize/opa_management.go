@@ -0,0 +1,289 @@
+package authorize
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+const (
+	opaManagementTimeout          = 30 * time.Second
+	opaDecisionLogsMaxBufferSize  = 10000
+	opaDecisionLogsPath           = "/logs"
+	opaStatusPath                 = "/status"
+	opaDecisionPath               = "pomerium/policy"
+	opaPluginStateOK              = "OK"
+	opaPluginStateError           = "ERROR"
+	opaDecisionLogsErrorCode      = "decision_logs_error"
+	opaDecisionLogsMetricsDropped = "counter_decision_logs_dropped"
+)
+
+// opaSensitiveHeaders are the request headers which are never reported in
+// decision logs.
+var opaSensitiveHeaders = map[string]bool{
+	"Authorization":             true,
+	"Cookie":                    true,
+	"Proxy-Authorization":       true,
+	"X-Pomerium-Authorization":  true,
+	"X-Pomerium-Jwt-Assertion":  true,
+	"X-Pomerium-Identity-Token": true,
+}
+
+// An opaDecisionLogEvent is a decision in OPA's decision log format.
+type opaDecisionLogEvent struct {
+	Labels      map[string]string `json:"labels"`
+	DecisionID  string            `json:"decision_id"`
+	Path        string            `json:"path"`
+	Input       map[string]any    `json:"input"`
+	Result      map[string]any    `json:"result"`
+	RequestedBy string            `json:"requested_by,omitempty"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Metrics     map[string]any    `json:"metrics,omitempty"`
+}
+
+// opaReporter reports authorization decisions and status to a service which
+// implements the OPA management APIs. Decisions are buffered and uploaded in
+// batches. If an upload fails, the decisions are kept for the next one,
+// dropping the oldest once the buffer is full.
+type opaReporter struct {
+	httpClient *http.Client
+	id         string
+
+	mu      sync.Mutex
+	options *config.OPAManagementOptions
+	events  []opaDecisionLogEvent
+	dropped int
+	logsErr error
+}
+
+func newOPAReporter() *opaReporter {
+	return &opaReporter{
+		httpClient: http.DefaultClient,
+		id:         uuid.New().String(),
+	}
+}
+
+// OnConfigChange updates the OPA management options. Buffered decisions are
+// discarded when decision logs are disabled.
+func (r *opaReporter) OnConfigChange(options *config.Options) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.options = options.OPAManagement
+	if !r.options.GetDecisionLogs() {
+		r.events = nil
+	}
+}
+
+// Run reports the buffered decisions and status periodically.
+func (r *opaReporter) Run(ctx context.Context) error {
+	timer := time.NewTimer(r.getReportingInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		r.report(ctx)
+		timer.Reset(r.getReportingInterval())
+	}
+}
+
+// logDecision buffers a decision, if decision logs are enabled.
+func (r *opaReporter) logDecision(req *evaluator.Request, res *evaluator.Result, evalDuration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.options.GetDecisionLogs() {
+		return
+	}
+
+	headers := make(map[string]string, len(req.HTTP.Headers))
+	for k, v := range req.HTTP.Headers {
+		if !opaSensitiveHeaders[k] {
+			headers[k] = v
+		}
+	}
+	input := map[string]any{
+		"http": map[string]any{
+			"method":  req.HTTP.Method,
+			"path":    req.HTTP.Path,
+			"url":     req.HTTP.URL,
+			"ip":      req.HTTP.IP,
+			"headers": headers,
+		},
+		"session": map[string]any{
+			"id": req.Session.ID,
+		},
+	}
+	if req.Policy != nil {
+		input["route"] = req.Policy.From
+	}
+
+	r.events = append(r.events, opaDecisionLogEvent{
+		Labels:     r.getLabelsLocked(),
+		DecisionID: uuid.New().String(),
+		Path:       opaDecisionPath,
+		Input:      input,
+		Result: map[string]any{
+			"allow": []any{res.Allow.Value, append([]string{}, res.Allow.Reasons.Strings()...)},
+			"deny":  []any{res.Deny.Value, append([]string{}, res.Deny.Reasons.Strings()...)},
+		},
+		RequestedBy: req.HTTP.IP,
+		Timestamp:   time.Now().UTC(),
+		Metrics: map[string]any{
+			"timer_rego_query_eval_ns": evalDuration.Nanoseconds(),
+		},
+	})
+	if n := len(r.events) - opaDecisionLogsMaxBufferSize; n > 0 {
+		r.events = r.events[n:]
+		r.dropped += n
+	}
+}
+
+// report uploads the buffered decisions and reports the status.
+func (r *opaReporter) report(ctx context.Context) {
+	r.mu.Lock()
+	options := r.options
+	events := r.events
+	r.events = nil
+	r.mu.Unlock()
+
+	if options == nil {
+		return
+	}
+
+	if options.DecisionLogs && len(events) > 0 {
+		err := r.post(ctx, options, opaDecisionLogsPath, events, true)
+		if err != nil {
+			log.Error(ctx).Err(err).Int("decisions", len(events)).
+				Msg("authorize: error uploading opa decision logs")
+		}
+
+		r.mu.Lock()
+		r.logsErr = err
+		if err != nil && r.options.GetDecisionLogs() {
+			// keep the decisions for the next upload
+			r.events = append(events, r.events...)
+			if n := len(r.events) - opaDecisionLogsMaxBufferSize; n > 0 {
+				r.events = r.events[n:]
+				r.dropped += n
+			}
+		}
+		r.mu.Unlock()
+	}
+
+	if options.Status {
+		if err := r.post(ctx, options, opaStatusPath, r.getStatus(), false); err != nil {
+			log.Error(ctx).Err(err).Msg("authorize: error reporting opa status")
+		}
+	}
+}
+
+// getStatus returns the status in OPA's status format.
+func (r *opaReporter) getStatus() map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plugins := map[string]any{
+		"status": map[string]any{"state": opaPluginStateOK},
+	}
+	status := map[string]any{
+		"labels":  r.getLabelsLocked(),
+		"plugins": plugins,
+	}
+	if r.options.GetDecisionLogs() {
+		plugins["decision_logs"] = map[string]any{"state": opaPluginStateOK}
+		decisionLogs := map[string]any{}
+		if r.logsErr != nil {
+			plugins["decision_logs"] = map[string]any{"state": opaPluginStateError, "message": r.logsErr.Error()}
+			decisionLogs["code"] = opaDecisionLogsErrorCode
+			decisionLogs["message"] = r.logsErr.Error()
+		}
+		decisionLogs["metrics"] = map[string]any{
+			opaDecisionLogsMetricsDropped: r.dropped,
+		}
+		status["decision_logs"] = decisionLogs
+	}
+	return status
+}
+
+func (r *opaReporter) getLabelsLocked() map[string]string {
+	labels := make(map[string]string)
+	if r.options != nil {
+		for k, v := range r.options.Labels {
+			labels[k] = v
+		}
+	}
+	labels["id"] = r.id
+	labels["version"] = version.FullVersion()
+	return labels
+}
+
+func (r *opaReporter) getReportingInterval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.options.GetReportingInterval()
+}
+
+func (r *opaReporter) post(ctx context.Context, options *config.OPAManagementOptions, path string, body any, compress bool) error {
+	ctx, clearTimeout := context.WithTimeout(ctx, opaManagementTimeout)
+	defer clearTimeout()
+
+	var buf bytes.Buffer
+	w := io.Writer(&buf)
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(options.URL, "/")+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+options.Token)
+	}
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package authorize
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+)
+
+func TestOPAReporter(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var logs []opaDecisionLogEvent
+	var statuses []map[string]any
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Equal(t, "Bearer TOKEN", r.Header.Get("Authorization"))
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/logs":
+			assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			var events []opaDecisionLogEvent
+			require.NoError(t, json.NewDecoder(zr).Decode(&events))
+			logs = append(logs, events...)
+		case "/v1/status":
+			var status map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+			statuses = append(statuses, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	options := config.NewDefaultOptions()
+	options.OPAManagement = &config.OPAManagementOptions{
+		URL:          srv.URL + "/v1/",
+		Token:        "TOKEN",
+		DecisionLogs: true,
+		Status:       true,
+		Labels:       map[string]string{"environment": "test"},
+	}
+	r := newOPAReporter()
+	r.OnConfigChange(options)
+
+	req := &evaluator.Request{
+		Policy: &config.Policy{From: "https://from.example.com"},
+		HTTP: evaluator.RequestHTTP{
+			Method:  http.MethodGet,
+			Path:    "/path",
+			URL:     "https://from.example.com/path",
+			IP:      "1.2.3.4",
+			Headers: map[string]string{"Accept": "text/html", "Cookie": "SECRET"},
+		},
+		Session: evaluator.RequestSession{ID: "s1"},
+	}
+	res := &evaluator.Result{
+		Allow: evaluator.NewRuleResult(true, criteria.ReasonEmailOK),
+		Deny:  evaluator.NewRuleResult(false),
+	}
+
+	ctx := context.Background()
+	fail = true
+	r.logDecision(req, res, time.Millisecond)
+	r.report(ctx)
+	fail = false
+	r.logDecision(req, res, time.Millisecond)
+	r.report(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, logs, 2, "should keep the decisions of a failed upload") {
+		evt := logs[0]
+		assert.Equal(t, "pomerium/policy", evt.Path)
+		assert.Equal(t, "test", evt.Labels["environment"])
+		assert.NotEmpty(t, evt.Labels["id"])
+		assert.NotEmpty(t, evt.DecisionID)
+		assert.NotEqual(t, logs[0].DecisionID, logs[1].DecisionID)
+		assert.Equal(t, "1.2.3.4", evt.RequestedBy)
+		assert.Equal(t, "https://from.example.com", evt.Input["route"])
+		assert.Equal(t, map[string]any{"Accept": "text/html"}, evt.Input["http"].(map[string]any)["headers"])
+		assert.Equal(t, []any{true, []any{"email-ok"}}, evt.Result["allow"])
+		assert.Equal(t, []any{false, []any{}}, evt.Result["deny"])
+	}
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, map[string]any{"state": "OK"}, statuses[0]["plugins"].(map[string]any)["decision_logs"])
+	}
+
+	options = config.NewDefaultOptions()
+	r.OnConfigChange(options)
+	r.logDecision(req, res, time.Millisecond)
+	assert.Empty(t, r.events, "should not log decisions when disabled")
+}
@@ -0,0 +1,173 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// policyRecords syncs the databroker record types policies refer to, and
+// stores them as data.databroker.<name>[<record id>].
+type policyRecords struct {
+	provider dataBrokerServiceClientProvider
+	store    *store.Store
+
+	mu sync.Mutex
+	// types are the record types by name
+	types map[string]string
+	// changed is closed when the record types change
+	changed chan struct{}
+}
+
+func newPolicyRecords(provider dataBrokerServiceClientProvider, store *store.Store) *policyRecords {
+	return &policyRecords{
+		provider: provider,
+		store:    store,
+		types:    make(map[string]string),
+		changed:  make(chan struct{}),
+	}
+}
+
+// OnConfigChange updates the record types. If they changed, the records are
+// removed and synced again.
+func (r *policyRecords) OnConfigChange(options *config.Options) {
+	types := make(map[string]string, len(options.PolicyRecordTypes))
+	for _, o := range options.PolicyRecordTypes {
+		types[o.Name] = o.Type
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if mapsEqual(r.types, types) {
+		return
+	}
+
+	r.types = types
+	close(r.changed)
+	r.changed = make(chan struct{})
+
+	recordTypes := make(map[string]any, len(types))
+	for name := range types {
+		recordTypes[name] = map[string]any{}
+	}
+	r.store.ReplaceDataBrokerRecords(recordTypes)
+}
+
+// Run syncs the records of the record types from the databroker, and
+// restarts syncing when the record types change.
+func (r *policyRecords) Run(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		types, changed := r.types, r.changed
+		r.mu.Unlock()
+
+		syncCtx, cancel := context.WithCancel(ctx)
+		eg, ectx := errgroup.WithContext(syncCtx)
+		for name, recordType := range types {
+			h := &policyRecordsHandler{policyRecords: r, name: name, recordType: recordType}
+			eg.Go(func() error {
+				return databroker.NewSyncer("authorize_policy_records_"+h.name, h,
+					databroker.WithTypeURL(h.recordType)).Run(ectx)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			_ = eg.Wait()
+			return ctx.Err()
+		case <-changed:
+			cancel()
+			_ = eg.Wait()
+		}
+	}
+}
+
+// current returns true if the record type is still configured with the name,
+// so that syncers which were stopped don't write records.
+func (r *policyRecords) current(name, recordType string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.types[name] == recordType
+}
+
+type policyRecordsHandler struct {
+	*policyRecords
+	name       string
+	recordType string
+}
+
+// ClearRecords removes all the records of the record type.
+func (h *policyRecordsHandler) ClearRecords(ctx context.Context) {
+	if !h.current(h.name, h.recordType) {
+		return
+	}
+	h.store.ClearDataBrokerRecords(h.name)
+}
+
+// GetDataBrokerServiceClient returns the databroker service client.
+func (h *policyRecordsHandler) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return h.provider.GetDataBrokerServiceClient()
+}
+
+// UpdateRecords updates or removes the records of the record type.
+func (h *policyRecordsHandler) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
+	if !h.current(h.name, h.recordType) {
+		return
+	}
+
+	values := make(map[string]any, len(records))
+	for _, record := range records {
+		if record.GetDeletedAt() != nil {
+			values[record.GetId()] = nil
+			continue
+		}
+
+		value, err := policyRecordValue(record)
+		if err != nil {
+			log.Warn(ctx).Err(err).
+				Str("type", record.GetType()).
+				Str("id", record.GetId()).
+				Msg("authorize: error converting databroker record for policy evaluation")
+			continue
+		}
+		values[record.GetId()] = value
+	}
+	h.store.UpdateDataBrokerRecords(h.name, values)
+}
+
+// policyRecordValue converts the data of a record to JSON values.
+func policyRecordValue(record *databroker.Record) (any, error) {
+	msg, err := record.GetData().UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	bs, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	err = json.Unmarshal(bs, &value)
+	return value, err
+}
+
+func mapsEqual(x, y map[string]string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for k, v := range x {
+		if yv, ok := y[k]; !ok || yv != v {
+			return false
+		}
+	}
+	return true
+}
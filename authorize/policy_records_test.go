@@ -0,0 +1,65 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+func TestPolicyRecords(t *testing.T) {
+	ctx := context.Background()
+	s := store.New()
+	r := newPolicyRecords(nil, s)
+
+	getData := func() any {
+		rs, err := rego.New(rego.Store(s), rego.Query("data.databroker")).Eval(ctx)
+		require.NoError(t, err)
+		require.Len(t, rs, 1)
+		return rs[0].Expressions[0].Value
+	}
+	newRecord := func(id string, compliant bool) *databroker.Record {
+		data := protoutil.NewAny(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"compliant": structpb.NewBoolValue(compliant),
+		}})
+		return &databroker.Record{Type: "example.com/Device", Id: id, Data: data}
+	}
+
+	r.OnConfigChange(&config.Options{PolicyRecordTypes: []config.PolicyRecordTypeOptions{
+		{Name: "devices", Type: "example.com/Device"},
+	}})
+	assert.Equal(t, map[string]any{"devices": map[string]any{}}, getData())
+
+	h := &policyRecordsHandler{policyRecords: r, name: "devices", recordType: "example.com/Device"}
+	h.UpdateRecords(ctx, 1, []*databroker.Record{newRecord("d1", true), newRecord("d/2", false)})
+	assert.Equal(t, map[string]any{"devices": map[string]any{
+		"d1":  map[string]any{"compliant": true},
+		"d/2": map[string]any{"compliant": false},
+	}}, getData())
+
+	deleted := newRecord("d1", true)
+	deleted.DeletedAt = timestamppb.Now()
+	h.UpdateRecords(ctx, 1, []*databroker.Record{deleted, newRecord("d/2", true)})
+	assert.Equal(t, map[string]any{"devices": map[string]any{
+		"d/2": map[string]any{"compliant": true},
+	}}, getData())
+
+	h.ClearRecords(ctx)
+	assert.Equal(t, map[string]any{"devices": map[string]any{}}, getData())
+
+	r.OnConfigChange(&config.Options{PolicyRecordTypes: []config.PolicyRecordTypeOptions{
+		{Name: "laptops", Type: "example.com/Device"},
+	}})
+	h.UpdateRecords(ctx, 1, []*databroker.Record{newRecord("d1", true)})
+	assert.Equal(t, map[string]any{"laptops": map[string]any{}}, getData(),
+		"should ignore records from a removed record type")
+}
@@ -0,0 +1,269 @@
+// Package policytest evaluates the policies of routes against test cases, so
+// that policy changes can be checked without a running cluster.
+package policytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const (
+	// ExpectAllow expects the request to be allowed.
+	ExpectAllow = "allow"
+	// ExpectDeny expects the request to be denied.
+	ExpectDeny = "deny"
+
+	testSessionID = "policytest-session"
+)
+
+// A Suite is a set of test cases.
+type Suite struct {
+	Tests []Case `yaml:"tests"`
+}
+
+// A Case is a request and whether the policy of its route is expected to
+// allow it.
+type Case struct {
+	Name string `yaml:"name"`
+	// URL is the request URL, which selects the route.
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	// Body is the request body, for routes which inspect request bodies.
+	Body string `yaml:"body"`
+	// IP is the client IP address.
+	IP string `yaml:"ip"`
+	// User is the id of the signed in user. If empty, the request is
+	// unauthenticated.
+	User   string         `yaml:"user"`
+	Email  string         `yaml:"email"`
+	Groups []string       `yaml:"groups"`
+	Claims map[string]any `yaml:"claims"`
+	// Expect is either allow or deny.
+	Expect string `yaml:"expect"`
+}
+
+// A Result is the result of a test case.
+type Result struct {
+	Case    *Case
+	Allowed bool
+	// Reasons are the reasons of the deny rule if it matched, otherwise of
+	// the allow rule.
+	Reasons []string
+	Err     error
+}
+
+// Passed returns true if the test case passed.
+func (r *Result) Passed() bool {
+	return r.Err == nil && r.Allowed == (r.Case.Expect == ExpectAllow)
+}
+
+// LoadSuite loads a test suite from a YAML file.
+func LoadSuite(path string) (*Suite, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("policytest: error reading test file: %w", err)
+	}
+	return ParseSuite(bs)
+}
+
+// ParseSuite parses a YAML test suite.
+func ParseSuite(bs []byte) (*Suite, error) {
+	var s Suite
+	if err := yaml.Unmarshal(bs, &s); err != nil {
+		return nil, fmt.Errorf("policytest: error parsing test file: %w", err)
+	}
+	if len(s.Tests) == 0 {
+		return nil, fmt.Errorf("policytest: no tests defined")
+	}
+	for i := range s.Tests {
+		tc := &s.Tests[i]
+		if tc.Name == "" {
+			tc.Name = fmt.Sprintf("test %d", i+1)
+		}
+		if tc.URL == "" {
+			return nil, fmt.Errorf("policytest: %s: url is required", tc.Name)
+		}
+		if tc.Expect != ExpectAllow && tc.Expect != ExpectDeny {
+			return nil, fmt.Errorf("policytest: %s: expect must be %s or %s", tc.Name, ExpectAllow, ExpectDeny)
+		}
+		if tc.User == "" && (tc.Email != "" || len(tc.Groups) > 0 || len(tc.Claims) > 0) {
+			return nil, fmt.Errorf("policytest: %s: user is required with email, groups or claims", tc.Name)
+		}
+	}
+	return &s, nil
+}
+
+// A Runner evaluates test cases against the policies of the routes.
+type Runner struct {
+	policies  []config.Policy
+	evaluator *evaluator.Evaluator
+}
+
+// NewRunner creates a new Runner for the routes of the options.
+func NewRunner(ctx context.Context, options *config.Options) (*Runner, error) {
+	policies := options.GetAllPolicies()
+	for i := range policies {
+		if err := policies[i].Validate(); err != nil {
+			return nil, fmt.Errorf("policytest: invalid policy %s: %w", policies[i].From, err)
+		}
+	}
+
+	clientCA, err := options.GetClientCA()
+	if err != nil {
+		return nil, fmt.Errorf("policytest: invalid client CA: %w", err)
+	}
+
+	// the signed identity headers aren't tested, so a throwaway signing key
+	// avoids needing access to the real one
+	signingKey, err := cryptutil.NewSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	encodedSigningKey, err := cryptutil.EncodePrivateKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	geoIPDatabase, err := options.GetGeoIPDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("policytest: invalid geoip database: %w", err)
+	}
+
+	e, err := evaluator.New(ctx, store.New(),
+		evaluator.WithPolicies(policies),
+		evaluator.WithClientCA(clientCA),
+		evaluator.WithSigningKey(encodedSigningKey),
+		evaluator.WithJWTClaimsHeaders(options.JWTClaimsHeaders),
+		evaluator.WithGeoIPDatabase(geoIPDatabase),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("policytest: error creating policy evaluator: %w", err)
+	}
+
+	return &Runner{
+		policies:  policies,
+		evaluator: e,
+	}, nil
+}
+
+// Run evaluates the test cases, writes their results to w and returns
+// whether they all passed.
+func (r *Runner) Run(ctx context.Context, s *Suite, w io.Writer) bool {
+	passed := 0
+	for i := range s.Tests {
+		res := r.Evaluate(ctx, &s.Tests[i])
+		if res.Passed() {
+			passed++
+			fmt.Fprintf(w, "PASS  %s\n", res.Case.Name)
+			continue
+		}
+
+		if res.Err != nil {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", res.Case.Name, res.Err)
+			continue
+		}
+		got := ExpectDeny
+		if res.Allowed {
+			got = ExpectAllow
+		}
+		fmt.Fprintf(w, "FAIL  %s: expected %s, got %s (%s)\n",
+			res.Case.Name, res.Case.Expect, got, strings.Join(res.Reasons, ", "))
+	}
+	fmt.Fprintf(w, "%d passed, %d failed\n", passed, len(s.Tests)-passed)
+	return passed == len(s.Tests)
+}
+
+// Evaluate evaluates a test case.
+func (r *Runner) Evaluate(ctx context.Context, tc *Case) *Result {
+	res := &Result{Case: tc}
+
+	u, err := url.Parse(tc.URL)
+	if err != nil {
+		res.Err = fmt.Errorf("invalid url: %w", err)
+		return res
+	}
+	method := tc.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req := &evaluator.Request{
+		Policy: r.getMatchingPolicy(*u),
+		HTTP:   evaluator.NewRequestHTTP(method, *u, tc.Headers, "", tc.IP),
+	}
+	req.HTTP.Body, req.HTTP.BodySize = tc.Body, int64(len(tc.Body))
+	if tc.User != "" {
+		req.Session = evaluator.RequestSession{ID: testSessionID}
+	}
+	ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(newRecords(tc)...))
+
+	out, err := r.evaluator.Evaluate(ctx, req)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.Allowed = out.Allow.Value && !out.Deny.Value
+	reasons := out.Allow.Reasons
+	if out.Deny.Value {
+		reasons = out.Deny.Reasons
+	}
+	for reason := range reasons {
+		res.Reasons = append(res.Reasons, string(reason))
+	}
+	sort.Strings(res.Reasons)
+	return res
+}
+
+func (r *Runner) getMatchingPolicy(requestURL url.URL) *config.Policy {
+	for _, p := range r.policies {
+		if p.Matches(requestURL) {
+			return &p
+		}
+	}
+	return nil
+}
+
+// newRecords returns the databroker records of the signed in user of the test
+// case.
+func newRecords(tc *Case) []proto.Message {
+	if tc.User == "" {
+		return nil
+	}
+
+	claims := identity.Claims{}
+	for k, v := range tc.Claims {
+		claims[k] = v
+	}
+	if tc.Email != "" {
+		claims["email"] = tc.Email
+	}
+	if len(tc.Groups) > 0 {
+		claims["groups"] = tc.Groups
+	}
+
+	s := &session.Session{Id: testSessionID, UserId: tc.User}
+	s.AddClaims(claims.Flatten())
+	u := &user.User{Id: tc.User, Email: tc.Email}
+	u.AddClaims(claims.Flatten())
+	return []proto.Message{s, u}
+}
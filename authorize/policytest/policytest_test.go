@@ -0,0 +1,123 @@
+package policytest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+func TestParseSuite(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSuite([]byte(`
+tests:
+  - url: https://a.example.com
+    expect: allow
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "test 1", s.Tests[0].Name)
+
+	for _, raw := range []string{
+		`tests: []`,
+		`tests: [{expect: allow}]`,
+		`tests: [{url: "https://a.example.com", expect: maybe}]`,
+		`tests: [{url: "https://a.example.com", expect: deny, groups: [admins]}]`,
+	} {
+		_, err := ParseSuite([]byte(raw))
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	t.Parallel()
+
+	ppl, err := parser.ParseYAML(bytes.NewReader([]byte(`
+allow:
+  and:
+    - claim/groups: admins
+    - http_method:
+        is: GET
+`)))
+	require.NoError(t, err)
+
+	options := config.NewDefaultOptions()
+	options.Policies = []config.Policy{
+		{From: "https://admin.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), Policy: &config.PPLPolicy{Policy: ppl}},
+		{From: "https://public.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), AllowPublicUnauthenticatedAccess: true},
+		{From: "https://email.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), AllowedUsers: []string{"user@example.com"}},
+	}
+
+	runner, err := NewRunner(context.Background(), options)
+	require.NoError(t, err)
+
+	suite, err := ParseSuite([]byte(`
+tests:
+  - name: admins can read
+    url: https://admin.example.com/settings
+    user: u1
+    groups: [admins]
+    expect: allow
+  - name: admins can't write
+    url: https://admin.example.com/settings
+    method: POST
+    user: u1
+    groups: [admins]
+    expect: deny
+  - name: other groups are denied
+    url: https://admin.example.com/settings
+    user: u2
+    groups: [users]
+    expect: deny
+  - name: public routes are allowed
+    url: https://public.example.com
+    expect: allow
+  - name: allowed users
+    url: https://email.example.com
+    user: u3
+    email: user@example.com
+    expect: allow
+  - name: unauthenticated users are denied
+    url: https://email.example.com
+    expect: deny
+  - name: unknown routes are denied
+    url: https://unknown.example.com
+    expect: deny
+`))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.True(t, runner.Run(context.Background(), suite, &out), out.String())
+	assert.Contains(t, out.String(), "7 passed, 0 failed")
+
+	t.Run("failure", func(t *testing.T) {
+		suite, err := ParseSuite([]byte(`
+tests:
+  - name: admins can write
+    url: https://admin.example.com/settings
+    method: POST
+    user: u1
+    groups: [admins]
+    expect: allow
+`))
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		assert.False(t, runner.Run(context.Background(), suite, &out))
+		assert.Contains(t, out.String(), "FAIL  admins can write: expected allow, got deny")
+		assert.Contains(t, out.String(), "0 passed, 1 failed")
+	})
+}
+
+func mustParseWeightedURLs(t *testing.T, urls ...string) config.WeightedURLs {
+	t.Helper()
+
+	wu, err := config.ParseWeightedUrls(urls...)
+	require.NoError(t, err)
+	return wu
+}
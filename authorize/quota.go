@@ -0,0 +1,116 @@
+package authorize
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/ratelimit"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// quotaUsage is the usage of the most restrictive quota of a route.
+type quotaUsage struct {
+	limit   uint64
+	used    uint64
+	resetAt time.Time
+}
+
+func (q *quotaUsage) exceeded() bool {
+	return q.used > q.limit
+}
+
+func (q *quotaUsage) remaining() uint64 {
+	if q.used >= q.limit {
+		return 0
+	}
+	return q.limit - q.used
+}
+
+// moreRestrictive returns true if the usage limits requests for longer than
+// other does.
+func (q *quotaUsage) moreRestrictive(other *quotaUsage) bool {
+	switch {
+	case q.exceeded() != other.exceeded():
+		return q.exceeded()
+	case q.exceeded():
+		return q.resetAt.After(other.resetAt)
+	default:
+		return q.remaining() < other.remaining()
+	}
+}
+
+// headers returns the response headers which describe the quota usage.
+func (q *quotaUsage) headers(now time.Time) map[string]string {
+	reset := strconv.FormatInt(int64(q.resetAt.Sub(now).Seconds()), 10)
+	hdrs := map[string]string{
+		"X-Quota-Limit":     strconv.FormatUint(q.limit, 10),
+		"X-Quota-Remaining": strconv.FormatUint(q.remaining(), 10),
+		"X-Quota-Reset":     reset,
+	}
+	if q.exceeded() {
+		hdrs["Retry-After"] = reset
+	}
+	return hdrs
+}
+
+// checkQuota counts an allowed request against the quotas of its route, and
+// returns the usage of the most restrictive quota, or nil if the route has
+// no quota. Requests are counted per user or service account. Errors are
+// logged and the request isn't limited.
+func checkQuota(
+	ctx context.Context,
+	limiter *ratelimit.Limiter,
+	req *evaluator.Request,
+	res *evaluator.Result,
+	s sessionOrServiceAccount,
+	now time.Time,
+) *quotaUsage {
+	quota := req.Policy.GetQuota()
+	if limiter == nil || quota == nil || s == nil || !res.Allow.Value || res.Deny.Value {
+		return nil
+	}
+
+	routeID, err := req.Policy.RouteID()
+	if err != nil {
+		return nil
+	}
+
+	var subject string
+	if sa, ok := s.(*user.ServiceAccount); ok {
+		subject = "service_account/" + sa.GetId()
+	} else {
+		subject = "user/" + s.GetUserId()
+	}
+
+	var usage *quotaUsage
+	for _, q := range []struct {
+		period string
+		limit  uint64
+	}{
+		{config.QuotaPeriodDaily, quota.Daily},
+		{config.QuotaPeriodMonthly, quota.Monthly},
+	} {
+		if q.limit == 0 {
+			continue
+		}
+
+		start, end := config.GetQuotaPeriod(q.period, now)
+		key := fmt.Sprintf("quota/%x/%s/%s", routeID, q.period, subject)
+		used, err := limiter.Increment(ctx, key, start, end)
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("authorize: error checking quota")
+			return nil
+		}
+
+		u := &quotaUsage{limit: q.limit, used: used, resetAt: end}
+		if usage == nil || u.moreRestrictive(usage) {
+			usage = u
+		}
+	}
+	return usage
+}
@@ -0,0 +1,67 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/ratelimit"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestCheckQuota(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(ratelimit.NewMemoryCounter())
+	req := &evaluator.Request{Policy: &config.Policy{
+		From:  "https://a.example.com",
+		To:    mustParseWeightedURLs(t, "https://a.internal"),
+		Quota: &config.QuotaOptions{Daily: 2, Monthly: 10},
+	}}
+	allowed := &evaluator.Result{Allow: evaluator.NewRuleResult(true), Deny: evaluator.NewRuleResult(false)}
+	s := &session.Session{UserId: "u1"}
+
+	usage := checkQuota(ctx, limiter, req, allowed, s, now)
+	require.NotNil(t, usage)
+	assert.Equal(t, map[string]string{
+		"X-Quota-Limit":     "2",
+		"X-Quota-Remaining": "1",
+		"X-Quota-Reset":     "43200",
+	}, usage.headers(now))
+
+	usage = checkQuota(ctx, limiter, req, allowed, s, now)
+	require.NotNil(t, usage)
+	assert.False(t, usage.exceeded(), "the last request within the quota should be allowed")
+
+	usage = checkQuota(ctx, limiter, req, allowed, s, now)
+	require.NotNil(t, usage)
+	assert.True(t, usage.exceeded())
+	assert.Equal(t, map[string]string{
+		"X-Quota-Limit":     "2",
+		"X-Quota-Remaining": "0",
+		"X-Quota-Reset":     "43200",
+		"Retry-After":       "43200",
+	}, usage.headers(now))
+
+	usage = checkQuota(ctx, limiter, req, allowed, &user.ServiceAccount{Id: "sa1", UserId: "u1"}, now)
+	require.NotNil(t, usage)
+	assert.False(t, usage.exceeded(), "service accounts should be counted separately")
+
+	usage = checkQuota(ctx, limiter, req, allowed, s, now.Add(24*time.Hour))
+	require.NotNil(t, usage)
+	assert.False(t, usage.exceeded(), "the daily quota should reset the next day")
+	assert.Equal(t, "2", usage.headers(now)["X-Quota-Limit"])
+
+	denied := &evaluator.Result{Allow: evaluator.NewRuleResult(false), Deny: evaluator.NewRuleResult(false)}
+	assert.Nil(t, checkQuota(ctx, limiter, req, denied, s, now), "denied requests should not be counted")
+	assert.Nil(t, checkQuota(ctx, limiter, req, allowed, nil, now), "anonymous requests should not be counted")
+	assert.Nil(t, checkQuota(ctx, limiter, &evaluator.Request{Policy: &config.Policy{}}, allowed, s, now))
+}
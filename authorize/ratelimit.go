@@ -0,0 +1,69 @@
+package authorize
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/ratelimit"
+	"github.com/pomerium/pomerium/internal/redisutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// rateLimiters returns the rate limiter for the rate_limit policy criterion,
+// which counts requests in redis if a redis url is configured and in the
+// databroker otherwise.
+type rateLimiters struct {
+	dataBroker *ratelimit.Limiter
+
+	mu          sync.Mutex
+	redisURL    string
+	redisClient redis.UniversalClient
+	redis       *ratelimit.Limiter
+}
+
+func newRateLimiters(getDataBrokerClient func() databroker.DataBrokerServiceClient) *rateLimiters {
+	return &rateLimiters{
+		dataBroker: ratelimit.New(ratelimit.NewDataBrokerCounter(getDataBrokerClient)),
+	}
+}
+
+// get returns the rate limiter for the options. The redis client is only
+// replaced when the redis url changes.
+func (rl *rateLimiters) get(opts *config.Options) (*ratelimit.Limiter, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if opts.RateLimitRedisURL == rl.redisURL {
+		if rl.redis != nil {
+			return rl.redis, nil
+		}
+		return rl.dataBroker, nil
+	}
+
+	var client redis.UniversalClient
+	var limiter *ratelimit.Limiter
+	if opts.RateLimitRedisURL != "" {
+		var err error
+		client, err = redisutil.NewClientFromURL(opts.RateLimitRedisURL, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("authorize: invalid rate limit redis url: %w", err)
+		}
+		limiter = ratelimit.New(ratelimit.NewRedisCounter(client))
+	}
+
+	if rl.redisClient != nil {
+		_ = rl.redisClient.Close()
+	}
+	rl.redisURL, rl.redisClient, rl.redis = opts.RateLimitRedisURL, client, limiter
+
+	if limiter != nil {
+		return limiter, nil
+	}
+	return rl.dataBroker, nil
+}
@@ -0,0 +1,191 @@
+package authorize
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+type dataBrokerServiceClientProvider interface {
+	GetDataBrokerServiceClient() databroker.DataBrokerServiceClient
+}
+
+// sessionRevocations tracks the sessions that have been revoked via the
+// databroker. Revocations are synced so that they take effect immediately
+// rather than once the cached session records expire. Revocations are dropped
+// once they expire, as the revoked sessions have expired by then.
+type sessionRevocations struct {
+	provider dataBrokerServiceClientProvider
+
+	mu sync.RWMutex
+	// expiresAt maps session ids to the time their revocation expires, which
+	// is zero for revocations stored without an expiry
+	expiresAt map[string]time.Time
+}
+
+func newSessionRevocations(provider dataBrokerServiceClientProvider) *sessionRevocations {
+	return &sessionRevocations{
+		provider:  provider,
+		expiresAt: make(map[string]time.Time),
+	}
+}
+
+// IsRevoked returns true if the given session has been revoked.
+func (r *sessionRevocations) IsRevoked(sessionID string) bool {
+	r.mu.RLock()
+	expiresAt, ok := r.expiresAt[sessionID]
+	r.mu.RUnlock()
+	return ok && (expiresAt.IsZero() || time.Now().Before(expiresAt))
+}
+
+// Run syncs session revocations from the databroker.
+func (r *sessionRevocations) Run(ctx context.Context) error {
+	return databroker.NewSyncer("authorize_session_revocations", r,
+		databroker.WithTypeURL(grpcutil.GetTypeURL(new(session.SessionRevocation)))).Run(ctx)
+}
+
+// ClearRecords clears all the session revocations.
+func (r *sessionRevocations) ClearRecords(ctx context.Context) {
+	r.mu.Lock()
+	r.expiresAt = make(map[string]time.Time)
+	r.mu.Unlock()
+}
+
+// GetDataBrokerServiceClient returns the databroker service client.
+func (r *sessionRevocations) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return r.provider.GetDataBrokerServiceClient()
+}
+
+// UpdateRecords updates the session revocations, and drops any revocations
+// which have expired.
+func (r *sessionRevocations) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range records {
+		if record.GetDeletedAt() != nil {
+			delete(r.expiresAt, record.GetId())
+			continue
+		}
+
+		var revocation session.SessionRevocation
+		err := record.GetData().UnmarshalTo(&revocation)
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("authorize: error unmarshaling session revocation")
+			continue
+		}
+		var expiresAt time.Time
+		if revocation.GetExpiresAt() != nil {
+			expiresAt = revocation.GetExpiresAt().AsTime()
+		}
+		r.expiresAt[revocation.GetId()] = expiresAt
+	}
+
+	now := time.Now()
+	for sessionID, expiresAt := range r.expiresAt {
+		if !expiresAt.IsZero() && !now.Before(expiresAt) {
+			delete(r.expiresAt, sessionID)
+		}
+	}
+}
+
+// userRevocations tracks the users who have been signed out everywhere. All
+// the sessions of such a user issued before the revocation are rejected.
+// Revocations are dropped once they expire, as the sessions issued before
+// the revocation have expired by then.
+type userRevocations struct {
+	provider dataBrokerServiceClientProvider
+	// onRevoke is called whenever new revocations are synced
+	onRevoke func()
+
+	mu          sync.RWMutex
+	revocations map[string]userRevocation
+}
+
+type userRevocation struct {
+	revokedAt time.Time
+	// expiresAt is zero for revocations stored without an expiry
+	expiresAt time.Time
+}
+
+func newUserRevocations(provider dataBrokerServiceClientProvider, onRevoke func()) *userRevocations {
+	return &userRevocations{
+		provider:    provider,
+		onRevoke:    onRevoke,
+		revocations: make(map[string]userRevocation),
+	}
+}
+
+// IsRevoked returns true if the user's sessions issued at the given time have
+// been revoked.
+func (r *userRevocations) IsRevoked(userID string, issuedAt time.Time) bool {
+	r.mu.RLock()
+	revocation, ok := r.revocations[userID]
+	r.mu.RUnlock()
+	return ok && issuedAt.Before(revocation.revokedAt) &&
+		(revocation.expiresAt.IsZero() || time.Now().Before(revocation.expiresAt))
+}
+
+// Run syncs user revocations from the databroker.
+func (r *userRevocations) Run(ctx context.Context) error {
+	return databroker.NewSyncer("authorize_user_revocations", r,
+		databroker.WithTypeURL(grpcutil.GetTypeURL(new(session.UserRevocation)))).Run(ctx)
+}
+
+// ClearRecords clears all the user revocations.
+func (r *userRevocations) ClearRecords(ctx context.Context) {
+	r.mu.Lock()
+	r.revocations = make(map[string]userRevocation)
+	r.mu.Unlock()
+}
+
+// GetDataBrokerServiceClient returns the databroker service client.
+func (r *userRevocations) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return r.provider.GetDataBrokerServiceClient()
+}
+
+// UpdateRecords updates the user revocations, and drops any revocations
+// which have expired.
+func (r *userRevocations) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
+	r.mu.Lock()
+	revoked := false
+	for _, record := range records {
+		if record.GetDeletedAt() != nil {
+			delete(r.revocations, record.GetId())
+			continue
+		}
+
+		var revocation session.UserRevocation
+		err := record.GetData().UnmarshalTo(&revocation)
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("authorize: error unmarshaling user revocation")
+			continue
+		}
+		var expiresAt time.Time
+		if revocation.GetExpiresAt() != nil {
+			expiresAt = revocation.GetExpiresAt().AsTime()
+		}
+		r.revocations[revocation.GetId()] = userRevocation{
+			revokedAt: revocation.GetRevokedAt().AsTime(),
+			expiresAt: expiresAt,
+		}
+		revoked = true
+	}
+
+	now := time.Now()
+	for userID, revocation := range r.revocations {
+		if !revocation.expiresAt.IsZero() && !now.Before(revocation.expiresAt) {
+			delete(r.revocations, userID)
+		}
+	}
+	r.mu.Unlock()
+
+	if revoked && r.onRevoke != nil {
+		r.onRevoke()
+	}
+}
@@ -0,0 +1,85 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+func TestSessionRevocations(t *testing.T) {
+	ctx := context.Background()
+	r := newSessionRevocations(nil)
+
+	newRecord := func(id string) *databroker.Record {
+		data := protoutil.NewAny(&session.SessionRevocation{Id: id})
+		return &databroker.Record{Type: data.GetTypeUrl(), Id: id, Data: data}
+	}
+
+	r.UpdateRecords(ctx, 1, []*databroker.Record{newRecord("s1"), newRecord("s2")})
+	assert.True(t, r.IsRevoked("s1"))
+	assert.True(t, r.IsRevoked("s2"))
+	assert.False(t, r.IsRevoked("s3"))
+
+	deleted := newRecord("s1")
+	deleted.DeletedAt = timestamppb.Now()
+	r.UpdateRecords(ctx, 1, []*databroker.Record{deleted})
+	assert.False(t, r.IsRevoked("s1"))
+	assert.True(t, r.IsRevoked("s2"))
+
+	r.ClearRecords(ctx)
+	assert.False(t, r.IsRevoked("s2"))
+
+	t.Run("expiry", func(t *testing.T) {
+		newExpiringRecord := func(id string, expiresAt time.Time) *databroker.Record {
+			data := protoutil.NewAny(&session.SessionRevocation{Id: id, ExpiresAt: timestamppb.New(expiresAt)})
+			return &databroker.Record{Type: data.GetTypeUrl(), Id: id, Data: data}
+		}
+
+		r.UpdateRecords(ctx, 1, []*databroker.Record{
+			newExpiringRecord("s4", time.Now().Add(time.Hour)),
+			newExpiringRecord("s5", time.Now().Add(-time.Minute)),
+		})
+		assert.True(t, r.IsRevoked("s4"))
+		assert.False(t, r.IsRevoked("s5"))
+		assert.NotContains(t, r.expiresAt, "s5", "expired revocations should be dropped")
+	})
+}
+
+func TestUserRevocations(t *testing.T) {
+	ctx := context.Background()
+	revokedCount := 0
+	r := newUserRevocations(nil, func() { revokedCount++ })
+
+	revokedAt := time.Now()
+	data := protoutil.NewAny(&session.UserRevocation{Id: "u1", RevokedAt: timestamppb.New(revokedAt)})
+	record := &databroker.Record{Type: data.GetTypeUrl(), Id: "u1", Data: data}
+
+	r.UpdateRecords(ctx, 1, []*databroker.Record{record})
+	assert.Equal(t, 1, revokedCount)
+	assert.True(t, r.IsRevoked("u1", revokedAt.Add(-time.Minute)))
+	assert.False(t, r.IsRevoked("u1", revokedAt.Add(time.Minute)))
+	assert.False(t, r.IsRevoked("u2", revokedAt.Add(-time.Minute)))
+
+	record.DeletedAt = timestamppb.Now()
+	r.UpdateRecords(ctx, 1, []*databroker.Record{record})
+	assert.Equal(t, 1, revokedCount)
+	assert.False(t, r.IsRevoked("u1", revokedAt.Add(-time.Minute)))
+
+	t.Run("expiry", func(t *testing.T) {
+		data := protoutil.NewAny(&session.UserRevocation{
+			Id:        "u3",
+			RevokedAt: timestamppb.New(revokedAt.Add(-2 * time.Hour)),
+			ExpiresAt: timestamppb.New(revokedAt.Add(-time.Hour)),
+		})
+		r.UpdateRecords(ctx, 1, []*databroker.Record{{Type: data.GetTypeUrl(), Id: "u3", Data: data}})
+		assert.False(t, r.IsRevoked("u3", revokedAt.Add(-3*time.Hour)))
+		assert.NotContains(t, r.revocations, "u3", "expired revocations should be dropped")
+	})
+}
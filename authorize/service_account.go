@@ -0,0 +1,34 @@
+package authorize
+
+import (
+	"time"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// checkServiceAccount returns an empty string if the service account JWT may
+// be used to access a route with the given hostname, or otherwise the reason
+// it may not.
+func checkServiceAccount(sa *user.ServiceAccount, s *sessions.State, hostname string, now time.Time) string {
+	if sa.GetExpiresAt() != nil && !sa.GetExpiresAt().AsTime().After(now) {
+		return "expired"
+	}
+
+	// rotating a service account updates its issued at time, which
+	// invalidates the JWTs issued before
+	if sa.GetIssuedAt() != nil &&
+		(s.IssuedAt == nil || s.IssuedAt.Time().Before(sa.GetIssuedAt().AsTime().Truncate(time.Second))) {
+		return "rotated"
+	}
+
+	if len(sa.GetAudiences()) == 0 {
+		return ""
+	}
+	for _, audience := range sa.GetAudiences() {
+		if audience == hostname {
+			return ""
+		}
+	}
+	return "audience"
+}
@@ -0,0 +1,39 @@
+package authorize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestCheckServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	issuedAt := now.Add(-time.Hour).Truncate(time.Second)
+	sa := &user.ServiceAccount{
+		Id:        "sa1",
+		IssuedAt:  timestamppb.New(issuedAt),
+		ExpiresAt: timestamppb.New(now.Add(time.Hour)),
+		Audiences: []string{"from.example.com"},
+	}
+	s := &sessions.State{ID: "sa1", IssuedAt: jwt.NewNumericDate(issuedAt)}
+
+	assert.Empty(t, checkServiceAccount(sa, s, "from.example.com", now))
+	assert.Equal(t, "audience", checkServiceAccount(sa, s, "other.example.com", now))
+	assert.Equal(t, "expired", checkServiceAccount(sa, s, "from.example.com", now.Add(2*time.Hour)))
+	assert.Equal(t, "rotated", checkServiceAccount(sa, &sessions.State{
+		ID:       "sa1",
+		IssuedAt: jwt.NewNumericDate(issuedAt.Add(-time.Second)),
+	}, "from.example.com", now))
+	assert.Equal(t, "rotated", checkServiceAccount(sa, &sessions.State{ID: "sa1"}, "from.example.com", now))
+
+	// service accounts created before audiences, expiry or rotation
+	assert.Empty(t, checkServiceAccount(&user.ServiceAccount{Id: "sa2"}, &sessions.State{ID: "sa2"}, "other.example.com", now))
+}
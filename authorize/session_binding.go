@@ -0,0 +1,141 @@
+package authorize
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/dpop"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessionbinding"
+	"github.com/pomerium/pomerium/internal/sessions/header"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// A sessionBinding contains the attributes of a request a session is bound
+// to.
+type sessionBinding struct {
+	sessionbinding.Binding
+	dpopKeyThumbprint string
+}
+
+// getSessionBinding returns the session binding attributes of a request.
+func getSessionBinding(options *config.Options, clientCertificate, ip, userAgent string) sessionBinding {
+	return sessionBinding{
+		Binding: sessionbinding.Get(options, getClientCertificateDER(clientCertificate), ip, userAgent),
+	}
+}
+
+// checkSessionBinding verifies that the session is bound to the attributes
+// of the current request. Sessions are bound when they're created at sign-in,
+// so a session without binding attributes is treated as a violation. Sessions
+// are bound to a DPoP key when the token is issued.
+//
+// A client certificate mismatch always invalidates the session. IP and
+// User-Agent mismatches are logged, and only invalidate the session when the
+// session binding mode is enforce.
+func (a *Authorize) checkSessionBinding(
+	ctx context.Context,
+	options *config.Options,
+	s *session.Session,
+	binding sessionBinding,
+) bool {
+	if options.SessionBindClientCertificate &&
+		(s.GetClientCertificateFingerprint() == "" ||
+			s.GetClientCertificateFingerprint() != binding.ClientCertificateFingerprint) {
+		return false
+	}
+
+	// sessions bound to a DPoP key are sender-constrained on every route
+	if s.GetDpopJkt() != "" && s.GetDpopJkt() != binding.dpopKeyThumbprint {
+		return false
+	}
+
+	mode := options.GetSessionBindingMode()
+	if mode == config.SessionBindingModeOff {
+		return true
+	}
+
+	var violations []string
+	switch {
+	case s.GetIpPrefix() == "" && binding.IPPrefix != "":
+		violations = append(violations, "ip-unbound")
+	case s.GetIpPrefix() != "" && !sessionbinding.IPPrefixContains(s.GetIpPrefix(), binding.IPPrefix):
+		violations = append(violations, "ip")
+	}
+	switch {
+	case s.GetUserAgentHash() == "":
+		violations = append(violations, "user-agent-unbound")
+	case s.GetUserAgentHash() != binding.UserAgentHash:
+		violations = append(violations, "user-agent")
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	log.Warn(ctx).
+		Str("service", "authorize").
+		Str("session-id", s.GetId()).
+		Str("user-id", s.GetUserId()).
+		Str("ip-prefix", binding.IPPrefix).
+		Strs("violations", violations).
+		Str("session-binding", string(mode)).
+		Msg("session binding violation")
+	return mode != config.SessionBindingModeEnforce
+}
+
+// getClientCertificateDER returns the DER encoding of a PEM-encoded
+// certificate, or nil if there is none.
+func getClientCertificateDER(clientCertificate string) []byte {
+	block, _ := pem.Decode([]byte(clientCertificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	return block.Bytes
+}
+
+// verifyDPoPProof verifies the DPoP proof of a request, if there is one, and
+// returns the thumbprint of the key it was signed with. Proofs are only
+// accepted with the access token they're bound to, so sessions bound to a
+// DPoP key can't be used without one.
+func verifyDPoPProof(
+	ctx context.Context,
+	state *authorizeState,
+	in *envoy_service_auth_v3.CheckRequest,
+	hreq *http.Request,
+) (string, error) {
+	proof := hreq.Header.Get(dpop.HeaderName)
+	if proof == "" {
+		return "", nil
+	}
+	accessToken := getRequestAccessToken(hreq)
+	if accessToken == "" {
+		return "", fmt.Errorf("%w: no access token", dpop.ErrInvalidProof)
+	}
+	return dpop.Verify(ctx, proof, dpop.Request{
+		Method:           hreq.Method,
+		URL:              getCheckRequestURL(in),
+		AccessToken:      accessToken,
+		DataBrokerClient: state.dataBrokerClient,
+	})
+}
+
+// getRequestAccessToken returns the token the session was loaded from, so
+// that DPoP proofs can be bound to it.
+func getRequestAccessToken(hreq *http.Request) string {
+	if token := header.TokenFromHeaders(hreq); token != "" {
+		return token
+	}
+	// Authorization: DPoP <token>
+	_, token, ok := strings.Cut(hreq.Header.Get(httputil.HeaderAuthorization), " ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,114 @@
+package authorize
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/dpop"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestAuthorize_checkSessionBinding_ClientCertificate(t *testing.T) {
+	ctx := context.Background()
+	options := config.NewDefaultOptions()
+	options.SessionBindClientCertificate = true
+
+	a := &Authorize{}
+	check := func(s *session.Session, clientCertificate string) bool {
+		return a.checkSessionBinding(ctx, options, s,
+			getSessionBinding(options, clientCertificate, "10.0.0.1", "agent"))
+	}
+
+	assert.False(t, check(&session.Session{Id: "s1"}, ""), "should reject unbound sessions")
+	assert.False(t, check(&session.Session{Id: "s1"}, certPEM), "should reject unbound sessions")
+
+	bound := &session.Session{Id: "s1"}
+	getSessionBinding(options, certPEM, "10.0.0.1", "agent").Apply(bound)
+	assert.Len(t, bound.GetClientCertificateFingerprint(), 64)
+	assert.True(t, check(bound, certPEM))
+	assert.False(t, check(bound, ""), "should reject bound sessions without a certificate")
+}
+
+func TestAuthorize_checkSessionBinding_IPAndUserAgent(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		mode      config.SessionBindingMode
+		ip        string
+		userAgent string
+		expect    bool
+	}{
+		{config.SessionBindingModeWarn, "10.0.0.2", "agent", true},
+		{config.SessionBindingModeWarn, "10.0.1.1", "agent", true},
+		{config.SessionBindingModeEnforce, "10.0.0.2", "agent", true},
+		{config.SessionBindingModeEnforce, "10.0.1.1", "agent", false},
+		{config.SessionBindingModeEnforce, "10.0.0.2", "other", false},
+		{config.SessionBindingModeEnforce, "::ffff:10.0.0.3", "agent", true},
+	} {
+		options := config.NewDefaultOptions()
+		options.SessionBinding = tc.mode
+
+		a := &Authorize{}
+
+		assert.Equal(t, tc.mode != config.SessionBindingModeEnforce,
+			a.checkSessionBinding(ctx, options, &session.Session{Id: "s1"},
+				getSessionBinding(options, "", tc.ip, tc.userAgent)),
+			"should only allow unbound sessions when not enforced")
+
+		bound := &session.Session{Id: "s1"}
+		getSessionBinding(options, "", "10.0.0.1", "agent").Apply(bound)
+		assert.Equal(t, "10.0.0.0/24", bound.GetIpPrefix())
+
+		actual := a.checkSessionBinding(ctx, options, bound,
+			getSessionBinding(options, "", tc.ip, tc.userAgent))
+		assert.Equal(t, tc.expect, actual, "mode=%s ip=%s user-agent=%s", tc.mode, tc.ip, tc.userAgent)
+	}
+}
+
+func TestAuthorize_checkSessionBinding_DPoP(t *testing.T) {
+	ctx := context.Background()
+	options := config.NewDefaultOptions()
+	a := &Authorize{}
+	check := func(s *session.Session, thumbprint string) bool {
+		binding := getSessionBinding(options, "", "10.0.0.1", "agent")
+		binding.dpopKeyThumbprint = thumbprint
+		return a.checkSessionBinding(ctx, options, s, binding)
+	}
+
+	assert.True(t, check(&session.Session{Id: "s1"}, ""),
+		"should allow unbound sessions without a proof")
+	assert.True(t, check(&session.Session{Id: "s1"}, "jkt1"),
+		"should allow unbound sessions with a proof")
+
+	bound := &session.Session{Id: "s1", DpopJkt: "jkt1"}
+	assert.True(t, check(bound, "jkt1"))
+	assert.False(t, check(bound, "jkt2"), "should reject proofs from other keys")
+	assert.False(t, check(bound, ""), "should reject bound sessions without a proof")
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	hreq := &http.Request{Method: http.MethodGet, Header: http.Header{}}
+	hreq.Header.Set(dpop.HeaderName, "PROOF")
+	_, err := verifyDPoPProof(context.Background(), &authorizeState{}, &envoy_service_auth_v3.CheckRequest{}, hreq)
+	assert.ErrorIs(t, err, dpop.ErrInvalidProof, "should reject proofs without an access token")
+}
+
+func TestGetRequestAccessToken(t *testing.T) {
+	for _, tc := range []struct {
+		header, value, expect string
+	}{
+		{"X-Pomerium-Authorization", "t1", "t1"},
+		{"Authorization", "Pomerium t2", "t2"},
+		{"Authorization", "DPoP t3", "t3"},
+		{"Authorization", "t4", ""},
+	} {
+		hreq := &http.Request{Header: http.Header{}}
+		hreq.Header.Set(tc.header, tc.value)
+		assert.Equal(t, tc.expect, getRequestAccessToken(hreq), "%s: %s", tc.header, tc.value)
+	}
+}
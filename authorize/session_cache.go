@@ -0,0 +1,127 @@
+package authorize
+
+import (
+	"context"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const sessionCacheMaxSize = 10_000
+
+// sessionCache is a bounded LRU cache of session records in front of the
+// databroker. Session records are synced from the databroker so that cached
+// entries are updated or removed as soon as the record changes. Until the
+// initial sync completes the cache is bypassed.
+type sessionCache struct {
+	provider dataBrokerServiceClientProvider
+	lru      *lru.Cache[string, *databroker.Record]
+
+	mu    sync.Mutex
+	ready bool
+	// generation is incremented on every synced change, so that records
+	// fetched concurrently with a change aren't cached
+	generation uint64
+}
+
+func newSessionCache(provider dataBrokerServiceClientProvider, size int) *sessionCache {
+	c, err := lru.New[string, *databroker.Record](size)
+	if err != nil {
+		// only fails for a non-positive size
+		panic(err)
+	}
+	return &sessionCache{
+		provider: provider,
+		lru:      c,
+	}
+}
+
+// GetSessionRecord gets the session record with the given id. The record is
+// returned from the cache if its version is at least the lowest record
+// version, and is fetched from the databroker otherwise. The second return
+// value is false if the cache isn't ready, in which case the caller should
+// query the databroker itself.
+func (c *sessionCache) GetSessionRecord(
+	ctx context.Context,
+	sessionID string,
+	lowestRecordVersion uint64,
+) (*databroker.Record, bool, error) {
+	if c == nil {
+		return nil, false, nil
+	}
+
+	c.mu.Lock()
+	ready, generation := c.ready, c.generation
+	c.mu.Unlock()
+	if !ready {
+		return nil, false, nil
+	}
+
+	if record, ok := c.lru.Get(sessionID); ok && record.GetVersion() >= lowestRecordVersion {
+		return record, true, nil
+	}
+
+	res, err := c.provider.GetDataBrokerServiceClient().Get(ctx, &databroker.GetRequest{
+		Type: grpcutil.GetTypeURL(new(session.Session)),
+		Id:   sessionID,
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, true, storage.ErrNotFound
+	} else if err != nil {
+		return nil, true, err
+	}
+	record := res.GetRecord()
+
+	c.mu.Lock()
+	if c.ready && c.generation == generation {
+		c.lru.Add(sessionID, record)
+	}
+	c.mu.Unlock()
+
+	return record, true, nil
+}
+
+// Run syncs session records from the databroker.
+func (c *sessionCache) Run(ctx context.Context) error {
+	return databroker.NewSyncer("authorize_session_cache", c,
+		databroker.WithTypeURL(grpcutil.GetTypeURL(new(session.Session)))).Run(ctx)
+}
+
+// ClearRecords clears the cache and bypasses it until the next sync.
+func (c *sessionCache) ClearRecords(ctx context.Context) {
+	c.mu.Lock()
+	c.ready = false
+	c.generation++
+	c.lru.Purge()
+	c.mu.Unlock()
+}
+
+// GetDataBrokerServiceClient returns the databroker service client.
+func (c *sessionCache) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return c.provider.GetDataBrokerServiceClient()
+}
+
+// UpdateRecords updates or removes the cached session records.
+func (c *sessionCache) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ready = true
+	c.generation++
+	for _, record := range records {
+		if record.GetDeletedAt() != nil {
+			c.lru.Remove(record.GetId())
+			continue
+		}
+		if c.lru.Contains(record.GetId()) {
+			c.lru.Add(record.GetId(), record)
+		}
+	}
+}
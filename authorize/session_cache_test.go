@@ -0,0 +1,101 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker/mock_databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+type mockDataBrokerServiceClientProvider struct {
+	client databroker.DataBrokerServiceClient
+}
+
+func (p mockDataBrokerServiceClientProvider) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return p.client
+}
+
+func TestSessionCache(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	c := newSessionCache(mockDataBrokerServiceClientProvider{client}, 10)
+
+	newRecord := func(id string, version uint64) *databroker.Record {
+		record := databroker.NewRecord(&session.Session{Id: id})
+		record.Version = version
+		return record
+	}
+
+	// bypassed until synced
+	_, ok, err := c.GetSessionRecord(ctx, "s1", 0)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	c.UpdateRecords(ctx, 1, nil)
+
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).
+		Return(&databroker.GetResponse{Record: newRecord("s1", 1)}, nil)
+	record, ok, err := c.GetSessionRecord(ctx, "s1", 0)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), record.GetVersion())
+
+	// cached
+	record, _, _ = c.GetSessionRecord(ctx, "s1", 1)
+	assert.Equal(t, uint64(1), record.GetVersion())
+
+	// a newer version is fetched
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).
+		Return(&databroker.GetResponse{Record: newRecord("s1", 2)}, nil)
+	record, _, _ = c.GetSessionRecord(ctx, "s1", 2)
+	assert.Equal(t, uint64(2), record.GetVersion())
+
+	// synced changes replace cached records
+	c.UpdateRecords(ctx, 1, []*databroker.Record{newRecord("s1", 3), newRecord("s2", 4)})
+	record, _, _ = c.GetSessionRecord(ctx, "s1", 0)
+	assert.Equal(t, uint64(3), record.GetVersion())
+	assert.False(t, c.lru.Contains("s2"))
+
+	// deleted records are removed
+	deleted := newRecord("s1", 5)
+	deleted.DeletedAt = timestamppb.Now()
+	c.UpdateRecords(ctx, 1, []*databroker.Record{deleted})
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).
+		Return(nil, status.Error(codes.NotFound, "not found"))
+	_, ok, err = c.GetSessionRecord(ctx, "s1", 0)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	c.ClearRecords(ctx)
+	_, ok, _ = c.GetSessionRecord(ctx, "s1", 0)
+	assert.False(t, ok)
+}
+
+func TestSessionCache_staleFetch(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	c := newSessionCache(mockDataBrokerServiceClientProvider{client}, 10)
+	c.UpdateRecords(ctx, 1, nil)
+
+	// a change synced while the record is being fetched prevents caching it
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *databroker.GetRequest, _ ...any) (*databroker.GetResponse, error) {
+			c.UpdateRecords(ctx, 1, nil)
+			return &databroker.GetResponse{Record: databroker.NewRecord(&session.Session{Id: "s1"})}, nil
+		})
+	_, ok, err := c.GetSessionRecord(ctx, "s1", 0)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.False(t, c.lru.Contains("s1"))
+}
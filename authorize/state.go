@@ -9,8 +9,10 @@ import (
 	"github.com/pomerium/pomerium/authorize/evaluator"
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/ratelimit"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/hpke"
 	"github.com/pomerium/pomerium/pkg/protoutil"
 )
@@ -20,15 +22,21 @@ var outboundGRPCConnection = new(grpc.CachedOutboundGRPClientConn)
 type authorizeState struct {
 	sharedKey                  []byte
 	evaluator                  *evaluator.Evaluator
+	rateLimiter                *ratelimit.Limiter
 	dataBrokerClientConnection *googlegrpc.ClientConn
 	dataBrokerClient           databroker.DataBrokerServiceClient
+	sessionServiceClient       session.SessionServiceClient
 	auditEncryptor             *protoutil.Encryptor
 	sessionStore               *config.SessionStore
 	hpkePrivateKey             *hpke.PrivateKey
 	authenticateKeyFetcher     hpke.KeyFetcher
 }
 
-func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*authorizeState, error) {
+func newAuthorizeStateFromConfig(
+	cfg *config.Config,
+	store *store.Store,
+	rateLimiters *rateLimiters,
+) (*authorizeState, error) {
 	if err := validateOptions(cfg.Options); err != nil {
 		return nil, fmt.Errorf("authorize: bad options: %w", err)
 	}
@@ -36,8 +44,12 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*autho
 	state := new(authorizeState)
 
 	var err error
+	state.rateLimiter, err = rateLimiters.get(cfg.Options)
+	if err != nil {
+		return nil, err
+	}
 
-	state.evaluator, err = newPolicyEvaluator(cfg.Options, store)
+	state.evaluator, err = newPolicyEvaluator(cfg.Options, store, state.rateLimiter)
 	if err != nil {
 		return nil, fmt.Errorf("authorize: failed to update policy with options: %w", err)
 	}
@@ -63,6 +75,7 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*autho
 	}
 	state.dataBrokerClientConnection = cc
 	state.dataBrokerClient = databroker.NewDataBrokerServiceClient(cc)
+	state.sessionServiceClient = session.NewSessionServiceClient(cc)
 
 	auditKey, err := cfg.Options.GetAuditKey()
 	if err != nil {
@@ -72,7 +85,7 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*autho
 		state.auditEncryptor = protoutil.NewEncryptor(auditKey)
 	}
 
-	state.sessionStore, err = config.NewSessionStore(cfg.Options)
+	state.sessionStore, err = config.NewSessionStore(cfg.Options, state.dataBrokerClient)
 	if err != nil {
 		return nil, fmt.Errorf("authorize: invalid session store: %w", err)
 	}
@@ -6,9 +6,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/rs/zerolog"
 
+	"github.com/pomerium/pomerium/authorize/policytest"
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/version"
@@ -19,6 +21,9 @@ import (
 var (
 	versionFlag = flag.Bool("version", false, "prints the version")
 	configFile  = flag.String("config", "", "Specify configuration file location")
+
+	exportTinkKeysetFlag = flag.String("export-tink-keyset", "",
+		"prints the shared_secret, cookie_secret or signing_key as a Tink keyset")
 )
 
 func main() {
@@ -29,6 +34,24 @@ func main() {
 		return
 	}
 
+	if *exportTinkKeysetFlag != "" {
+		if err := exportTinkKeyset(*exportTinkKeysetFlag); err != nil {
+			log.Fatal().Err(err).Msg("cmd/pomerium")
+		}
+		return
+	}
+
+	if flag.Arg(0) == "policy" && flag.Arg(1) == "test" {
+		passed, err := runPolicyTest(context.Background(), flag.Args()[2:])
+		if err != nil {
+			log.Fatal().Err(err).Msg("cmd/pomerium")
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx := context.Background()
 	if err := run(ctx); !errors.Is(err, context.Canceled) {
 		log.Fatal().Err(err).Msg("cmd/pomerium")
@@ -50,3 +73,49 @@ func run(ctx context.Context) error {
 
 	return pomerium.Run(ctx, src)
 }
+
+func exportTinkKeyset(name string) error {
+	src, err := config.NewFileOrEnvironmentSource(*configFile, files.FullVersion())
+	if err != nil {
+		return err
+	}
+
+	keyset, err := src.GetConfig().Options.ExportTinkKeyset(name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(keyset))
+	return nil
+}
+
+// runPolicyTest evaluates the policies of the configured routes against the
+// test cases of a YAML file:
+//
+//	pomerium -config config.yaml policy test -tests policy_test.yaml
+func runPolicyTest(ctx context.Context, args []string) (bool, error) {
+	fs := flag.NewFlagSet("policy test", flag.ExitOnError)
+	testsFile := fs.String("tests", "", "Specify the policy test cases file location")
+	_ = fs.Parse(args)
+	if *testsFile == "" {
+		return false, errors.New("policy test: -tests is required")
+	}
+
+	suite, err := policytest.LoadSuite(*testsFile)
+	if err != nil {
+		return false, err
+	}
+
+	src, err := config.NewFileOrEnvironmentSource(*configFile, files.FullVersion())
+	if err != nil {
+		return false, err
+	}
+
+	// keep the evaluator's logs out of the results
+	log.SetLevel("warn")
+
+	runner, err := policytest.NewRunner(ctx, src.GetConfig().Options)
+	if err != nil {
+		return false, err
+	}
+	return runner.Run(ctx, suite, os.Stdout), nil
+}
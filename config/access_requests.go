@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Default access request options.
+const (
+	DefaultAccessRequestDuration    = time.Hour
+	DefaultAccessRequestMaxDuration = 8 * time.Hour
+)
+
+// AccessRequestOptions enable users who are denied access to a route to
+// request temporary access, which approvers grant or deny.
+type AccessRequestOptions struct {
+	// Approvers are the ids or emails of the users who may approve access
+	// requests.
+	Approvers []string `mapstructure:"approvers" yaml:"approvers,omitempty"`
+	// DefaultDuration is the duration of access requests if users don't
+	// choose one.
+	DefaultDuration time.Duration `mapstructure:"default_duration" yaml:"default_duration,omitempty"`
+	// MaxDuration is the longest duration users may request access for.
+	MaxDuration time.Duration `mapstructure:"max_duration" yaml:"max_duration,omitempty"`
+	// SMTP configures the mail server with which approvers whose approver
+	// entry is an email are notified of new access requests.
+	SMTP *SMTPOptions `mapstructure:"smtp" yaml:"smtp,omitempty"`
+}
+
+// SMTPOptions configure a mail server.
+type SMTPOptions struct {
+	// Address is the host and port of the mail server.
+	Address  string `mapstructure:"address" yaml:"address,omitempty"`
+	Username string `mapstructure:"username" yaml:"username,omitempty"`
+	Password string `mapstructure:"password" yaml:"password,omitempty"`
+	// From is the sender address of the mails.
+	From string `mapstructure:"from" yaml:"from,omitempty"`
+}
+
+// Validate validates the access request options.
+func (o *AccessRequestOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.Approvers) == 0 {
+		return fmt.Errorf("config: access_requests requires at least one approver")
+	}
+	if o.DefaultDuration < 0 || o.MaxDuration < 0 {
+		return fmt.Errorf("config: access_requests durations must not be negative")
+	}
+	if o.GetDefaultDuration() > o.GetMaxDuration() {
+		return fmt.Errorf("config: access_requests default_duration must not exceed max_duration")
+	}
+	if o.SMTP != nil {
+		if _, _, err := net.SplitHostPort(o.SMTP.Address); err != nil {
+			return fmt.Errorf("config: invalid access_requests smtp address: %w", err)
+		}
+		if _, err := mail.ParseAddress(o.SMTP.From); err != nil {
+			return fmt.Errorf("config: invalid access_requests smtp from address: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetDefaultDuration returns the duration of access requests if users don't
+// choose one.
+func (o *AccessRequestOptions) GetDefaultDuration() time.Duration {
+	if o.DefaultDuration == 0 {
+		return minDuration(DefaultAccessRequestDuration, o.GetMaxDuration())
+	}
+	return o.DefaultDuration
+}
+
+// GetMaxDuration returns the longest duration users may request access for.
+func (o *AccessRequestOptions) GetMaxDuration() time.Duration {
+	if o.MaxDuration == 0 {
+		return DefaultAccessRequestMaxDuration
+	}
+	return o.MaxDuration
+}
+
+// IsApprover returns true if the user with the given id and email may
+// approve access requests.
+func (o *AccessRequestOptions) IsApprover(userID, email string) bool {
+	for _, approver := range o.Approvers {
+		if (userID != "" && approver == userID) || (email != "" && strings.EqualFold(approver, email)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetApproverEmails returns the approvers which are emails.
+func (o *AccessRequestOptions) GetApproverEmails() []string {
+	var emails []string
+	for _, approver := range o.Approvers {
+		if strings.Contains(approver, "@") {
+			emails = append(emails, approver)
+		}
+	}
+	return emails
+}
+
+func minDuration(x, y time.Duration) time.Duration {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -231,6 +231,8 @@ func (src *FileWatcherSource) check(ctx context.Context, cfg *Config) {
 		cfg.Options.DataBrokerStorageCAFile,
 		cfg.Options.DataBrokerStorageCertFile,
 		cfg.Options.DataBrokerStorageCertKeyFile,
+		cfg.Options.GeoIPASNDatabasePath,
+		cfg.Options.GeoIPDatabasePath,
 		cfg.Options.KeyFile,
 		cfg.Options.MetricsCertificateFile,
 		cfg.Options.MetricsCertificateKeyFile,
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/internal/encoding/jwe"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// ParseSameSite parses the SameSite attribute of a cookie. An empty string
+// results in the default mode, which omits the attribute.
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, fmt.Errorf("config: invalid cookie same site: %s", s)
+}
+
+// GetCookieSameSite gets the SameSite attribute for session cookies.
+func (o *Options) GetCookieSameSite() http.SameSite {
+	sameSite, _ := ParseSameSite(o.CookieSameSite)
+	return sameSite
+}
+
+// GetCookieOptionsByHost gets the per-route overrides of session cookie
+// attributes, keyed by the route's host. If multiple routes share a host the
+// first route to override an attribute wins.
+func (o *Options) GetCookieOptionsByHost() map[string]cookie.HostOptions {
+	var m map[string]cookie.HostOptions
+	for _, p := range o.GetAllPolicies() {
+		if p.Source == nil {
+			continue
+		}
+		sameSite, _ := ParseSameSite(p.CookieSameSite)
+		if p.CookiePath == "" && p.CookieDomain == "" && sameSite == http.SameSiteDefaultMode {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]cookie.HostOptions)
+		}
+		hostOpts := m[p.Source.Host]
+		if hostOpts.Path == "" {
+			hostOpts.Path = p.CookiePath
+		}
+		if hostOpts.Domain == "" {
+			hostOpts.Domain = p.CookieDomain
+		}
+		if hostOpts.SameSite == 0 && sameSite != http.SameSiteDefaultMode {
+			hostOpts.SameSite = sameSite
+		}
+		m[p.Source.Host] = hostOpts
+	}
+	return m
+}
+
+// cookieDomainMatches returns true if a cookie with the given domain can be
+// set by the host.
+func cookieDomainMatches(domain, host string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	host = strings.ToLower(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// GetCookieEncrypter gets the encrypter used for encrypted session cookies.
+// The key is derived from the cookie secret.
+func (o *Options) GetCookieEncrypter() (encoding.MarshalUnmarshaler, error) {
+	cookieSecret, err := o.GetCookieSecret()
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid cookie secret: %w", err)
+	}
+	return jwe.NewA256GCMEncrypter(cryptutil.Hash("session cookie encryption", cookieSecret))
+}
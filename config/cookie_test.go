@@ -0,0 +1,56 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+)
+
+func TestParseSameSite(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		expect http.SameSite
+	}{
+		{"", http.SameSiteDefaultMode},
+		{"lax", http.SameSiteLaxMode},
+		{"Strict", http.SameSiteStrictMode},
+		{"NONE", http.SameSiteNoneMode},
+	} {
+		actual, err := ParseSameSite(tc.in)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, actual, tc.in)
+	}
+
+	_, err := ParseSameSite("sometimes")
+	assert.Error(t, err)
+}
+
+func TestOptions_GetCookieOptionsByHost(t *testing.T) {
+	o := NewDefaultOptions()
+	o.Policies = []Policy{
+		{From: "https://a.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), CookieSameSite: "none"},
+		{From: "https://a.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), Prefix: "/b", CookieSameSite: "strict", CookiePath: "/b"},
+		{From: "https://c.example.com", To: mustParseWeightedURLs(t, "https://to.example.com")},
+		{From: "https://d.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), CookieDomain: "d.example.com"},
+	}
+	for i := range o.Policies {
+		require.NoError(t, o.Policies[i].Validate())
+	}
+
+	assert.Equal(t, map[string]cookie.HostOptions{
+		"a.example.com": {SameSite: http.SameSiteNoneMode, Path: "/b"},
+		"d.example.com": {Domain: "d.example.com"},
+	}, o.GetCookieOptionsByHost())
+}
+
+func TestCookieDomainMatches(t *testing.T) {
+	assert.True(t, cookieDomainMatches("example.com", "example.com"))
+	assert.True(t, cookieDomainMatches(".example.com", "app.example.com"))
+	assert.True(t, cookieDomainMatches("Example.com", "app.example.com"))
+	assert.False(t, cookieDomainMatches("example.com", "badexample.com"))
+	assert.False(t, cookieDomainMatches("app.example.com", "example.com"))
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"strings"
+	texttemplate "text/template"
+)
+
+const defaultDenyResponseContentType = "text/html; charset=utf-8"
+
+// DenyResponseOptions customize the response to requests a route's policy
+// denies, in place of the error page. The body and header values are go
+// templates. HTML bodies are escaped with html/template.
+type DenyResponseOptions struct {
+	// StatusCode is the status code of the response. It defaults to the
+	// status code of the denial, usually 403.
+	StatusCode int `mapstructure:"status_code" yaml:"status_code,omitempty" json:"status_code,omitempty"`
+	// ContentType is the content type of the body. It defaults to
+	// text/html; charset=utf-8.
+	ContentType string `mapstructure:"content_type" yaml:"content_type,omitempty" json:"content_type,omitempty"`
+	// Body is the template of the body.
+	Body string `mapstructure:"body" yaml:"body,omitempty" json:"body,omitempty"`
+	// Headers are the templates of extra response headers.
+	Headers map[string]string `mapstructure:"headers" yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// Validate validates the deny response options.
+func (o *DenyResponseOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.StatusCode != 0 && (o.StatusCode < 300 || o.StatusCode > 599) {
+		return fmt.Errorf("config: invalid deny_response status_code: %d", o.StatusCode)
+	}
+	if _, err := o.parseBody(); err != nil {
+		return fmt.Errorf("config: invalid deny_response body: %w", err)
+	}
+	for k, v := range o.Headers {
+		if _, err := texttemplate.New(k).Parse(v); err != nil {
+			return fmt.Errorf("config: invalid deny_response header %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// GetContentType returns the content type of the body.
+func (o *DenyResponseOptions) GetContentType() string {
+	if o.ContentType == "" {
+		return defaultDenyResponseContentType
+	}
+	return o.ContentType
+}
+
+// Render executes the body and header templates with the data.
+func (o *DenyResponseOptions) Render(data interface{}) (body string, headers http.Header, err error) {
+	tpl, err := o.parseBody()
+	if err != nil {
+		return "", nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", nil, err
+	}
+
+	headers = make(http.Header)
+	headers.Set("Content-Type", o.GetContentType())
+	for k, v := range o.Headers {
+		var hbuf bytes.Buffer
+		tpl, err := texttemplate.New(k).Parse(v)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := tpl.Execute(&hbuf, data); err != nil {
+			return "", nil, err
+		}
+		headers.Set(k, hbuf.String())
+	}
+	return buf.String(), headers, nil
+}
+
+type denyResponseTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+func (o *DenyResponseOptions) parseBody() (denyResponseTemplate, error) {
+	if strings.Contains(o.GetContentType(), "html") {
+		return htmltemplate.New("body").Parse(o.Body)
+	}
+	return texttemplate.New("body").Parse(o.Body)
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultDevicePostureRefreshInterval is how often device posture providers
+// are synced by default.
+const DefaultDevicePostureRefreshInterval = 15 * time.Minute
+
+// Device posture provider types.
+const (
+	DevicePostureProviderIntune      = "intune"
+	DevicePostureProviderJamf        = "jamf"
+	DevicePostureProviderCrowdStrike = "crowdstrike"
+)
+
+// DevicePostureProviderOptions configure a device management or endpoint
+// security provider, whose devices the databroker syncs so that policies can
+// require a managed, healthy device with the device_posture criterion.
+type DevicePostureProviderOptions struct {
+	// Name is the name policies refer to the provider by.
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+	// Type is one of intune, jamf or crowdstrike.
+	Type string `mapstructure:"type" yaml:"type,omitempty"`
+	// URL is the url of the provider's API. It is required for jamf. For
+	// intune it defaults to the Microsoft Graph API, and for crowdstrike to
+	// the US-1 cloud.
+	URL string `mapstructure:"url" yaml:"url,omitempty"`
+	// TenantID is the Azure AD tenant of intune.
+	TenantID string `mapstructure:"tenant_id" yaml:"tenant_id,omitempty"`
+	// ClientID and ClientSecret are the OAuth 2.0 client credentials of the
+	// API client.
+	ClientID     string `mapstructure:"client_id" yaml:"client_id,omitempty"`
+	ClientSecret string `mapstructure:"client_secret" yaml:"client_secret,omitempty"`
+	// RefreshInterval is how often the devices are synced.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" yaml:"refresh_interval,omitempty"`
+}
+
+// Validate validates the device posture provider options.
+func (o *DevicePostureProviderOptions) Validate() error {
+	if !externalDataSourceNameRE.MatchString(o.Name) {
+		return fmt.Errorf("config: invalid device posture provider name: %q", o.Name)
+	}
+	switch o.Type {
+	case DevicePostureProviderIntune:
+		if o.TenantID == "" {
+			return fmt.Errorf("config: device posture provider %s requires a tenant_id", o.Name)
+		}
+	case DevicePostureProviderJamf:
+		if o.URL == "" {
+			return fmt.Errorf("config: device posture provider %s requires a url", o.Name)
+		}
+	case DevicePostureProviderCrowdStrike:
+	default:
+		return fmt.Errorf("config: device posture provider %s has an unknown type: %q", o.Name, o.Type)
+	}
+	if o.URL != "" {
+		u, err := url.Parse(o.URL)
+		if err != nil {
+			return fmt.Errorf("config: device posture provider %s has an invalid url: %w", o.Name, err)
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("config: device posture provider %s url must be an https url: %s", o.Name, o.URL)
+		}
+	}
+	if o.ClientID == "" || o.ClientSecret == "" {
+		return fmt.Errorf("config: device posture provider %s requires a client_id and client_secret", o.Name)
+	}
+	if o.RefreshInterval < 0 {
+		return fmt.Errorf("config: device posture provider %s refresh_interval must not be negative", o.Name)
+	}
+	return nil
+}
+
+// GetRefreshInterval returns how often the devices are synced.
+func (o *DevicePostureProviderOptions) GetRefreshInterval() time.Duration {
+	if o.RefreshInterval == 0 {
+		return DefaultDevicePostureRefreshInterval
+	}
+	return o.RefreshInterval
+}
+
+func (o *Options) validateDevicePostureProviders() error {
+	names := make(map[string]bool)
+	for i := range o.DevicePostureProviders {
+		dpp := &o.DevicePostureProviders[i]
+		if err := dpp.Validate(); err != nil {
+			return err
+		}
+		if names[dpp.Name] {
+			return fmt.Errorf("config: duplicate device posture provider: %s", dpp.Name)
+		}
+		names[dpp.Name] = true
+	}
+	return nil
+}
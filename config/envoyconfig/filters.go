@@ -16,8 +16,12 @@ import (
 	"github.com/pomerium/pomerium/pkg/protoutil"
 )
 
-// ExtAuthzFilter creates an ext authz filter.
-func ExtAuthzFilter(grpcClientTimeout *durationpb.Duration) *envoy_extensions_filters_network_http_connection_manager.HttpFilter {
+// ExtAuthzFilter creates an ext authz filter. If withRequestBody is set,
+// request bodies are buffered and sent to authorize.
+func ExtAuthzFilter(
+	grpcClientTimeout *durationpb.Duration,
+	withRequestBody *envoy_extensions_filters_http_ext_authz_v3.BufferSettings,
+) *envoy_extensions_filters_network_http_connection_manager.HttpFilter {
 	return &envoy_extensions_filters_network_http_connection_manager.HttpFilter{
 		Name: "envoy.filters.http.ext_authz",
 		ConfigType: &envoy_extensions_filters_network_http_connection_manager.HttpFilter_TypedConfig{
@@ -37,6 +41,7 @@ func ExtAuthzFilter(grpcClientTimeout *durationpb.Duration) *envoy_extensions_fi
 				},
 				IncludePeerCertificate: true,
 				TransportApiVersion:    envoy_config_core_v3.ApiVersion_V3,
+				WithRequestBody:        withRequestBody,
 			}),
 		},
 	}
@@ -33,8 +33,9 @@ import (
 const listenerBufferLimit uint32 = 32 * 1024
 
 var (
-	disableExtAuthz *any.Any
-	tlsParams       = &envoy_extensions_transport_sockets_tls_v3.TlsParameters{
+	disableExtAuthz             *any.Any
+	disableRequestBodyBuffering *any.Any
+	tlsParams                   = &envoy_extensions_transport_sockets_tls_v3.TlsParameters{
 		CipherSuites: []string{
 			"ECDHE-ECDSA-AES256-GCM-SHA384",
 			"ECDHE-RSA-AES256-GCM-SHA384",
@@ -53,6 +54,13 @@ func init() {
 			Disabled: true,
 		},
 	})
+	disableRequestBodyBuffering = marshalAny(&envoy_extensions_filters_http_ext_authz_v3.ExtAuthzPerRoute{
+		Override: &envoy_extensions_filters_http_ext_authz_v3.ExtAuthzPerRoute_CheckSettings{
+			CheckSettings: &envoy_extensions_filters_http_ext_authz_v3.CheckSettings{
+				DisableRequestBodyBuffering: true,
+			},
+		},
+	})
 }
 
 // BuildListeners builds envoy listeners from the given config.
@@ -319,9 +327,18 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		grpcClientTimeout = durationpb.New(30 * time.Second)
 	}
 
+	var withRequestBody *envoy_extensions_filters_http_ext_authz_v3.BufferSettings
+	if options.HasInspectRequestBodyPolicy() {
+		withRequestBody = &envoy_extensions_filters_http_ext_authz_v3.BufferSettings{
+			MaxRequestBytes:     options.GetInspectRequestBodyMaxBytes(),
+			AllowPartialMessage: true,
+			PackAsBytes:         true,
+		}
+	}
+
 	filters := []*envoy_http_connection_manager.HttpFilter{
 		LuaFilter(luascripts.RemoveImpersonateHeaders),
-		ExtAuthzFilter(grpcClientTimeout),
+		ExtAuthzFilter(grpcClientTimeout, withRequestBody),
 		LuaFilter(luascripts.ExtAuthzSetCookie),
 		LuaFilter(luascripts.CleanUpstream),
 		LuaFilter(luascripts.RewriteHeaders),
@@ -342,7 +359,7 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		return nil, err
 	}
 
-	return HTTPConnectionManagerFilter(&envoy_http_connection_manager.HttpConnectionManager{
+	hcm := &envoy_http_connection_manager.HttpConnectionManager{
 		AlwaysSetRequestIdInResponse: true,
 
 		CodecType:  options.GetCodecType().ToEnvoy(),
@@ -367,7 +384,17 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		SkipXffAppend:     options.SkipXffAppend,
 		XffNumTrustedHops: options.XffNumTrustedHops,
 		LocalReplyConfig:  b.buildLocalReplyConfig(options, false),
-	}), nil
+	}
+	// the client certificate identity provider and session binding read the
+	// certificate from the x-forwarded-client-cert header, which is removed
+	// from requests to upstreams
+	if forwardClientCertificate(options) {
+		hcm.ForwardClientCertDetails = envoy_http_connection_manager.HttpConnectionManager_SANITIZE_SET
+		hcm.SetCurrentClientCertDetails = &envoy_http_connection_manager.HttpConnectionManager_SetCurrentClientCertDetails{
+			Cert: true,
+		}
+	}
+	return HTTPConnectionManagerFilter(hcm), nil
 }
 
 func (b *Builder) buildMetricsHTTPConnectionManagerFilter() (*envoy_config_listener_v3.Filter, error) {
@@ -11,11 +11,13 @@ import (
 	"text/template"
 
 	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/identity/clientcert"
 	"github.com/pomerium/pomerium/internal/testutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
@@ -68,6 +70,17 @@ func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 	filter, err := b.buildMainHTTPConnectionManagerFilter(options)
 	require.NoError(t, err)
 	testutil.AssertProtoJSONEqual(t, testData(t, "main_http_connection_manager_filter.json", nil), filter)
+
+	t.Run("client certificate identity provider", func(t *testing.T) {
+		options.Provider = clientcert.Name
+		filter, err := b.buildMainHTTPConnectionManagerFilter(options)
+		require.NoError(t, err)
+
+		var hcm envoy_http_connection_manager.HttpConnectionManager
+		require.NoError(t, filter.GetTypedConfig().UnmarshalTo(&hcm))
+		assert.Equal(t, envoy_http_connection_manager.HttpConnectionManager_SANITIZE_SET, hcm.GetForwardClientCertDetails())
+		assert.True(t, hcm.GetSetCurrentClientCertDetails().GetCert())
+	})
 }
 
 func Test_buildDownstreamTLSContext(t *testing.T) {
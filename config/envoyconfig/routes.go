@@ -17,6 +17,7 @@ import (
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/clientcert"
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
 
@@ -172,6 +173,7 @@ func getClusterStatsName(policy *config.Policy) string {
 func (b *Builder) buildPolicyRoutes(options *config.Options, host string) ([]*envoy_config_route_v3.Route, error) {
 	var routes []*envoy_config_route_v3.Route
 
+	inspectRequestBody := options.HasInspectRequestBodyPolicy()
 	for i, p := range options.GetAllPolicies() {
 		policy := p
 		if !urlMatchesHost(policy.Source.URL, host) {
@@ -215,6 +217,12 @@ func (b *Builder) buildPolicyRoutes(options *config.Options, host string) ([]*en
 				"envoy.filters.http.ext_authz": disableExtAuthz,
 			}
 		} else {
+			// only buffer the request bodies of routes which inspect them
+			if inspectRequestBody && !policy.InspectRequestBody {
+				envoyRoute.TypedPerFilterConfig = map[string]*any.Any{
+					"envoy.filters.http.ext_authz": disableRequestBodyBuffering,
+				}
+			}
 			luaMetadata["remove_pomerium_cookie"] = &structpb.Value{
 				Kind: &structpb.Value_StringValue{
 					StringValue: options.CookieName,
@@ -421,9 +429,19 @@ func getRequestHeadersToRemove(options *config.Options, policy *config.Policy) [
 		httputil.HeaderPomeriumReproxyPolicy,
 		httputil.HeaderPomeriumReproxyPolicyHMAC,
 	)
+	if forwardClientCertificate(options) {
+		requestHeadersToRemove = append(requestHeadersToRemove, httputil.HeaderForwardedClientCert)
+	}
 	return requestHeadersToRemove
 }
 
+// forwardClientCertificate returns true if the client certificate is needed
+// by the control plane, in which case envoy sets the
+// x-forwarded-client-cert header.
+func forwardClientCertificate(options *config.Options) bool {
+	return options.HasIdentityProviderType(clientcert.Name) || options.SessionBindClientCertificate
+}
+
 func getRouteTimeout(options *config.Options, policy *config.Policy) *durationpb.Duration {
 	var routeTimeout *durationpb.Duration
 	if policy.UpstreamTimeout != nil {
@@ -1403,6 +1403,31 @@ func Test_buildPolicyRouteRedirectAction(t *testing.T) {
 	})
 }
 
+func Test_buildPolicyRoutesInspectRequestBody(t *testing.T) {
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(&config.Options{
+		Policies: []config.Policy{
+			{
+				Source: &config.StringURL{URL: mustParseURL(t, "https://example.com")},
+				Path:   "/api",
+				To:     mustParseWeightedURLs(t, "https://to.example.com"),
+			},
+			{
+				Source:             &config.StringURL{URL: mustParseURL(t, "https://example.com")},
+				Path:               "/api/sensitive",
+				To:                 mustParseWeightedURLs(t, "https://to.example.com"),
+				InspectRequestBody: true,
+			},
+		},
+	}, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+
+	// only the routes which don't inspect request bodies disable buffering
+	assert.Equal(t, disableRequestBodyBuffering, routes[0].GetTypedPerFilterConfig()["envoy.filters.http.ext_authz"])
+	assert.Nil(t, routes[1].GetTypedPerFilterConfig()["envoy.filters.http.ext_authz"])
+}
+
 func TestPolicyName(t *testing.T) {
 	// policy names should form a unique ID when converted to envoy cluster names
 	// however for metrics purposes we keep original name if present
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// DefaultExternalDataSourceRefreshInterval is how often external data
+// sources are refreshed by default.
+const DefaultExternalDataSourceRefreshInterval = time.Minute
+
+var externalDataSourceNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ExternalDataSourceOptions configure a JSON document which authorize fetches
+// from an HTTPS endpoint and policies refer to as data.external.<name>.
+type ExternalDataSourceOptions struct {
+	// Name is the name of the document under data.external. It must be a
+	// valid rego identifier.
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+	// URL is the https url the document is fetched from.
+	URL string `mapstructure:"url" yaml:"url,omitempty"`
+	// Headers are added to the requests, e.g. for authorization.
+	Headers map[string]string `mapstructure:"headers" yaml:"headers,omitempty"`
+	// RefreshInterval is how often the document is fetched.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" yaml:"refresh_interval,omitempty"`
+}
+
+// Validate validates the external data source options.
+func (o *ExternalDataSourceOptions) Validate() error {
+	if !externalDataSourceNameRE.MatchString(o.Name) {
+		return fmt.Errorf("config: invalid external data source name: %q", o.Name)
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("config: external data source %s has an invalid url: %w", o.Name, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("config: external data source %s url must be an https url: %s", o.Name, o.URL)
+	}
+	if o.RefreshInterval < 0 {
+		return fmt.Errorf("config: external data source %s refresh_interval must not be negative", o.Name)
+	}
+	return nil
+}
+
+// GetRefreshInterval returns how often the document is fetched.
+func (o *ExternalDataSourceOptions) GetRefreshInterval() time.Duration {
+	if o.RefreshInterval == 0 {
+		return DefaultExternalDataSourceRefreshInterval
+	}
+	return o.RefreshInterval
+}
+
+// Equal returns true if the options are the same.
+func (o *ExternalDataSourceOptions) Equal(other *ExternalDataSourceOptions) bool {
+	if o.Name != other.Name || o.URL != other.URL || o.RefreshInterval != other.RefreshInterval ||
+		len(o.Headers) != len(other.Headers) {
+		return false
+	}
+	for k, v := range o.Headers {
+		if ov, ok := other.Headers[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Options) validateExternalDataSources() error {
+	names := make(map[string]bool)
+	for i := range o.ExternalDataSources {
+		eds := &o.ExternalDataSources[i]
+		if err := eds.Validate(); err != nil {
+			return err
+		}
+		if names[eds.Name] {
+			return fmt.Errorf("config: duplicate external data source: %s", eds.Name)
+		}
+		names[eds.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Default gitops options.
+const (
+	DefaultGitOpsBranch       = "main"
+	DefaultGitOpsPollInterval = time.Minute
+)
+
+// GitOpsOptions configure a git repository whose route definitions the
+// databroker synchronizes into the databroker config.
+type GitOpsOptions struct {
+	// Repository is the url of the git repository. Credentials may be part
+	// of the url or come from the git configuration, e.g. ssh keys.
+	Repository string `mapstructure:"repository" yaml:"repository,omitempty"`
+	// Branch is the branch whose latest commit is applied.
+	Branch string `mapstructure:"branch" yaml:"branch,omitempty"`
+	// Path is the file or directory in the repository with the route
+	// definitions. Every .yaml, .yml and .json file of a directory is read.
+	Path string `mapstructure:"path" yaml:"path,omitempty"`
+	// PollInterval is how often the branch is checked for new commits.
+	PollInterval time.Duration `mapstructure:"poll_interval" yaml:"poll_interval,omitempty"`
+}
+
+// Validate validates the gitops options.
+func (o *GitOpsOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Repository == "" || strings.HasPrefix(o.Repository, "-") {
+		return fmt.Errorf("config: invalid gitops repository: %q", o.Repository)
+	}
+	if strings.HasPrefix(o.Branch, "-") || strings.ContainsAny(o.Branch, " ~^:?*[\\") || strings.Contains(o.Branch, "..") {
+		return fmt.Errorf("config: invalid gitops branch: %q", o.Branch)
+	}
+	if p := path.Clean(o.Path); path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("config: gitops path must be relative to the repository: %q", o.Path)
+	}
+	if o.PollInterval < 0 {
+		return fmt.Errorf("config: gitops poll_interval must not be negative")
+	}
+	return nil
+}
+
+// GetBranch returns the branch whose latest commit is applied.
+func (o *GitOpsOptions) GetBranch() string {
+	if o.Branch == "" {
+		return DefaultGitOpsBranch
+	}
+	return o.Branch
+}
+
+// GetPollInterval returns how often the branch is checked for new commits.
+func (o *GitOpsOptions) GetPollInterval() time.Duration {
+	if o.PollInterval == 0 {
+		return DefaultGitOpsPollInterval
+	}
+	return o.PollInterval
+}
+
+// ParseRoutes parses a YAML or JSON document with a routes block, in the
+// format of the config file.
+func ParseRoutes(data []byte) ([]Policy, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("config: invalid routes document: %w", err)
+	}
+	var routes []Policy
+	if err := v.UnmarshalKey("routes", &routes, ViperPolicyHooks); err != nil {
+		return nil, fmt.Errorf("config: invalid routes: %w", err)
+	}
+	return routes, nil
+}
@@ -1,30 +1,276 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/identity/claimmap"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oauth/generic"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/grpc/identity"
 )
 
+// DefaultIdentityProviderName is the name routes use to refer to the
+// identity provider configured by the idp_* options.
+const DefaultIdentityProviderName = "default"
+
+// IdentityProviderOptions configure an additional identity provider, which
+// routes select by name.
+type IdentityProviderOptions struct {
+	Name             string                   `mapstructure:"name" yaml:"name,omitempty"`
+	Provider         string                   `mapstructure:"idp_provider" yaml:"idp_provider,omitempty"`
+	ProviderURL      string                   `mapstructure:"idp_provider_url" yaml:"idp_provider_url,omitempty"`
+	ProviderAPIURL   string                   `mapstructure:"idp_api_url" yaml:"idp_api_url,omitempty"`
+	ClientID         string                   `mapstructure:"idp_client_id" yaml:"idp_client_id,omitempty"`
+	ClientSecret     string                   `mapstructure:"idp_client_secret" yaml:"idp_client_secret,omitempty"`
+	Scopes           []string                 `mapstructure:"idp_scopes" yaml:"idp_scopes,omitempty"`
+	RequestParams    map[string]string        `mapstructure:"idp_request_params" yaml:"idp_request_params,omitempty"`
+	IDPOAuth2        *IDPOAuth2Options        `mapstructure:"idp_oauth2" yaml:"idp_oauth2,omitempty"`
+	RequirePKCE      bool                     `mapstructure:"idp_require_pkce" yaml:"idp_require_pkce,omitempty"`
+	IDPDirectorySync *IDPDirectorySyncOptions `mapstructure:"idp_directory_sync" yaml:"idp_directory_sync,omitempty"`
+	IDPKeycloak      *IDPKeycloakOptions      `mapstructure:"idp_keycloak" yaml:"idp_keycloak,omitempty"`
+	IDPPasskey       *IDPPasskeyOptions       `mapstructure:"idp_passkey" yaml:"idp_passkey,omitempty"`
+	IDPKerberos      *IDPKerberosOptions      `mapstructure:"idp_kerberos" yaml:"idp_kerberos,omitempty"`
+	IDPApple         *IDPAppleOptions         `mapstructure:"idp_apple" yaml:"idp_apple,omitempty"`
+	IDPClientCert    *IDPClientCertOptions    `mapstructure:"idp_client_certificate" yaml:"idp_client_certificate,omitempty"`
+	IDPHealthCheck   *IDPHealthCheckOptions   `mapstructure:"idp_health_check" yaml:"idp_health_check,omitempty"`
+	ClaimsMapping    map[string]string        `mapstructure:"idp_claims_mapping" yaml:"idp_claims_mapping,omitempty"`
+}
+
+// configuredIdentityProvider is an identity provider along with the options
+// which are not part of its protobuf representation.
+type configuredIdentityProvider struct {
+	name          string
+	provider      *identity.Provider
+	apiURL        string
+	oauth2        *IDPOAuth2Options
+	requirePKCE   bool
+	directorySync *IDPDirectorySyncOptions
+	keycloak      *IDPKeycloakOptions
+	passkey       *IDPPasskeyOptions
+	kerberos      *IDPKerberosOptions
+	apple         *IDPAppleOptions
+	clientCert    *IDPClientCertOptions
+	healthCheck   *IDPHealthCheckOptions
+	claimsMapping map[string]string
+}
+
 // GetIdentityProviderForID returns the identity provider associated with the given IDP id.
 // If none is found the default provider is returned.
 func (o *Options) GetIdentityProviderForID(idpID string) (*identity.Provider, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return nil, err
+	}
+	return idp.provider, nil
+}
+
+// GetIdentityProviderForPolicy gets the identity provider associated with the given policy.
+// If policy is nil, or changes none of the default settings, the default provider is returned.
+// For policies with several identity providers, the first is returned.
+func (o *Options) GetIdentityProviderForPolicy(policy *Policy) (*identity.Provider, error) {
+	idps, err := o.GetIdentityProvidersForPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	return idps[0], nil
+}
+
+// GetIdentityProvidersForPolicy gets the identity providers users may sign in
+// to the given policy with. There is always at least one.
+func (o *Options) GetIdentityProvidersForPolicy(policy *Policy) ([]*identity.Provider, error) {
+	idps, err := o.getIdentityProvidersForPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	providers := make([]*identity.Provider, 0, len(idps))
+	for _, idp := range idps {
+		providers = append(providers, idp.provider)
+	}
+	return providers, nil
+}
+
+// GetIdentityProviderForRequestURL gets the identity provider associated with the given request URL.
+func (o *Options) GetIdentityProviderForRequestURL(requestURL string) (*identity.Provider, error) {
+	idps, err := o.GetIdentityProvidersForRequestURL(requestURL)
+	if err != nil {
+		return nil, err
+	}
+	return idps[0], nil
+}
+
+// GetIdentityProvidersForRequestURL gets the identity providers users may
+// sign in to the given request URL with.
+func (o *Options) GetIdentityProvidersForRequestURL(requestURL string) ([]*identity.Provider, error) {
+	u, err := urlutil.ParseAndValidateURL(requestURL)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, p := range o.GetAllPolicies() {
 		p := p
-		idp, err := o.GetIdentityProviderForPolicy(&p)
+		if p.Matches(*u) {
+			return o.GetIdentityProvidersForPolicy(&p)
+		}
+	}
+	return o.GetIdentityProvidersForPolicy(nil)
+}
+
+// GetAllIdentityProviders returns all the identity providers used by the
+// default settings or any policy.
+func (o *Options) GetAllIdentityProviders() ([]*identity.Provider, error) {
+	idps, err := o.getAllIdentityProviders()
+	if err != nil {
+		return nil, err
+	}
+	providers := make([]*identity.Provider, 0, len(idps))
+	for _, idp := range idps {
+		providers = append(providers, idp.provider)
+	}
+	return providers, nil
+}
+
+// GetIdentityProviderName returns the name of the identity provider with the
+// given IDP id, as shown to users choosing an identity provider. The default
+// identity provider is named after its type.
+func (o *Options) GetIdentityProviderName(idpID string) (string, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return "", err
+	}
+	if idp.name == DefaultIdentityProviderName {
+		return idp.provider.GetType(), nil
+	}
+	return idp.name, nil
+}
+
+// HasIdentityProviderType returns true if the default settings or any named
+// identity provider use the given type of identity provider.
+func (o *Options) HasIdentityProviderType(typ string) bool {
+	if o.Provider == typ {
+		return true
+	}
+	for _, ipo := range o.IdentityProviders {
+		if ipo.Provider == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOauthOptionsForIdentityProvider gets the oauth.Options for the identity
+// provider with the given IDP id.
+func (o *Options) GetOauthOptionsForIdentityProvider(idpID string) (oauth.Options, error) {
+	defaultOptions, err := o.GetOauthOptions()
+	if err != nil {
+		return oauth.Options{}, err
+	}
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return oauth.Options{}, err
+	}
+	oauthOptions := oauth.Options{
+		RedirectURL:     defaultOptions.RedirectURL,
+		ProviderName:    idp.provider.GetType(),
+		ProviderURL:     idp.provider.GetUrl(),
+		ClientID:        idp.provider.GetClientId(),
+		ClientSecret:    idp.provider.GetClientSecret(),
+		Scopes:          idp.provider.GetScopes(),
+		AuthCodeOptions: idp.provider.GetRequestParams(),
+		APIURL:          idp.apiURL,
+		RequirePKCE:     idp.requirePKCE,
+	}
+	idp.oauth2.ApplyTo(&oauthOptions)
+	idp.keycloak.ApplyTo(&oauthOptions)
+	idp.passkey.ApplyTo(&oauthOptions)
+	idp.kerberos.ApplyTo(&oauthOptions)
+	idp.apple.ApplyTo(&oauthOptions)
+	oauthOptions.ClientCA = defaultOptions.ClientCA
+	return oauthOptions, nil
+}
+
+func (o *Options) getIdentityProviderForID(idpID string) (*configuredIdentityProvider, error) {
+	idps, err := o.getAllIdentityProviders()
+	if err != nil {
+		return nil, err
+	}
+	for _, idp := range idps {
+		if idp.provider.GetId() == idpID {
+			return idp, nil
+		}
+	}
+	return o.getDefaultIdentityProvider()
+}
+
+func (o *Options) getAllIdentityProviders() ([]*configuredIdentityProvider, error) {
+	var all []*configuredIdentityProvider
+	seen := make(map[string]bool)
+	add := func(idps ...*configuredIdentityProvider) {
+		for _, idp := range idps {
+			if !seen[idp.provider.GetId()] {
+				seen[idp.provider.GetId()] = true
+				all = append(all, idp)
+			}
+		}
+	}
+
+	idp, err := o.getDefaultIdentityProvider()
+	if err != nil {
+		return nil, err
+	}
+	add(idp)
+	for _, ipo := range o.IdentityProviders {
+		idp, err := o.getNamedIdentityProvider(ipo.Name)
 		if err != nil {
 			return nil, err
 		}
-		if idp.GetId() == idpID {
-			return idp, nil
+		add(idp)
+	}
+	for _, p := range o.GetAllPolicies() {
+		p := p
+		idps, err := o.getIdentityProvidersForPolicy(&p)
+		if err != nil {
+			return nil, err
 		}
+		add(idps...)
 	}
+	return all, nil
+}
 
-	return o.GetIdentityProviderForPolicy(nil)
+func (o *Options) getIdentityProvidersForPolicy(policy *Policy) ([]*configuredIdentityProvider, error) {
+	if policy != nil && len(policy.IdentityProviders) > 0 {
+		idps := make([]*configuredIdentityProvider, 0, len(policy.IdentityProviders))
+		for _, name := range policy.IdentityProviders {
+			idp, err := o.getNamedIdentityProvider(name)
+			if err != nil {
+				return nil, err
+			}
+			idps = append(idps, idp)
+		}
+		return idps, nil
+	}
+
+	idp, err := o.getDefaultIdentityProvider()
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		if policy.IDPClientID != "" {
+			idp.provider.ClientId = policy.IDPClientID
+		}
+		if policy.IDPClientSecret != "" {
+			idp.provider.ClientSecret = policy.IDPClientSecret
+		}
+	}
+	idp.provider.Id = idp.provider.Hash()
+	return []*configuredIdentityProvider{idp}, nil
 }
 
-// GetIdentityProviderForPolicy gets the identity provider associated with the given policy.
-// If policy is nil, or changes none of the default settings, the default provider is returned.
-func (o *Options) GetIdentityProviderForPolicy(policy *Policy) (*identity.Provider, error) {
+func (o *Options) getDefaultIdentityProvider() (*configuredIdentityProvider, error) {
 	clientSecret, err := o.GetClientSecret()
 	if err != nil {
 		return nil, err
@@ -38,30 +284,669 @@ func (o *Options) GetIdentityProviderForPolicy(policy *Policy) (*identity.Provid
 		Url:           o.ProviderURL,
 		RequestParams: o.RequestParams,
 	}
-	if policy != nil {
-		if policy.IDPClientID != "" {
-			idp.ClientId = policy.IDPClientID
+	idp.Id = idp.Hash()
+	return &configuredIdentityProvider{
+		name:          DefaultIdentityProviderName,
+		provider:      idp,
+		apiURL:        o.ProviderAPIURL,
+		oauth2:        o.IDPOAuth2,
+		requirePKCE:   o.IDPRequirePKCE,
+		directorySync: o.IDPDirectorySync,
+		keycloak:      o.IDPKeycloak,
+		passkey:       o.IDPPasskey,
+		kerberos:      o.IDPKerberos,
+		apple:         o.IDPApple,
+		clientCert:    o.IDPClientCert,
+		healthCheck:   o.IDPHealthCheck,
+		claimsMapping: o.IDPClaimsMapping,
+	}, nil
+}
+
+func (o *Options) getNamedIdentityProvider(name string) (*configuredIdentityProvider, error) {
+	if name == DefaultIdentityProviderName {
+		return o.getDefaultIdentityProvider()
+	}
+	for _, ipo := range o.IdentityProviders {
+		if ipo.Name != name {
+			continue
 		}
-		if policy.IDPClientSecret != "" {
-			idp.ClientSecret = policy.IDPClientSecret
+		idp := &identity.Provider{
+			ClientId:      ipo.ClientID,
+			ClientSecret:  ipo.ClientSecret,
+			Type:          ipo.Provider,
+			Scopes:        ipo.Scopes,
+			Url:           ipo.ProviderURL,
+			RequestParams: ipo.RequestParams,
 		}
+		idp.Id = idp.Hash()
+		return &configuredIdentityProvider{
+			name:          name,
+			provider:      idp,
+			apiURL:        ipo.ProviderAPIURL,
+			oauth2:        ipo.IDPOAuth2,
+			requirePKCE:   ipo.RequirePKCE,
+			directorySync: ipo.IDPDirectorySync,
+			keycloak:      ipo.IDPKeycloak,
+			passkey:       ipo.IDPPasskey,
+			kerberos:      ipo.IDPKerberos,
+			apple:         ipo.IDPApple,
+			clientCert:    ipo.IDPClientCert,
+			healthCheck:   ipo.IDPHealthCheck,
+			claimsMapping: ipo.ClaimsMapping,
+		}, nil
 	}
-	idp.Id = idp.Hash()
-	return idp, nil
+	return nil, fmt.Errorf("config: unknown identity provider: %s", name)
 }
 
-// GetIdentityProviderForRequestURL gets the identity provider associated with the given request URL.
-func (o *Options) GetIdentityProviderForRequestURL(requestURL string) (*identity.Provider, error) {
-	u, err := urlutil.ParseAndValidateURL(requestURL)
+// validateIdentityProviders validates the named identity providers and their
+// use by policies.
+func (o *Options) validateIdentityProviders() error {
+	names := map[string]bool{DefaultIdentityProviderName: true}
+	for _, ipo := range o.IdentityProviders {
+		if ipo.Name == "" {
+			return fmt.Errorf("config: identity provider name is required")
+		}
+		if names[ipo.Name] {
+			return fmt.Errorf("config: duplicate identity provider name: %s", ipo.Name)
+		}
+		names[ipo.Name] = true
+		if ipo.Provider == "" {
+			return fmt.Errorf("config: identity provider %s: idp_provider is required", ipo.Name)
+		}
+		if ipo.Provider == generic.Name {
+			if err := ipo.IDPOAuth2.Validate(); err != nil {
+				return fmt.Errorf("config: identity provider %s: %w", ipo.Name, err)
+			}
+		}
+		if err := ipo.IDPDirectorySync.Validate(); err != nil {
+			return fmt.Errorf("config: identity provider %s: %w", ipo.Name, err)
+		}
+		if err := ipo.IDPHealthCheck.Validate(); err != nil {
+			return fmt.Errorf("config: identity provider %s: %w", ipo.Name, err)
+		}
+		if _, err := claimmap.Compile(ipo.ClaimsMapping); err != nil {
+			return fmt.Errorf("config: identity provider %s: bad idp_claims_mapping: %w", ipo.Name, err)
+		}
+		if ipo.ProviderAPIURL != "" {
+			if _, err := urlutil.ParseAndValidateURL(ipo.ProviderAPIURL); err != nil {
+				return fmt.Errorf("config: identity provider %s: bad idp_api_url %s: %w", ipo.Name, ipo.ProviderAPIURL, err)
+			}
+		}
+	}
+	for _, p := range o.GetAllPolicies() {
+		for _, name := range p.IdentityProviders {
+			if !names[name] {
+				return fmt.Errorf("config: route %s: unknown identity provider: %s", p.From, name)
+			}
+		}
+	}
+	for _, fallback := range []string{o.IDPKerberos.getFallback(), o.IDPClientCert.getFallback()} {
+		if fallback != "" && !names[fallback] {
+			return fmt.Errorf("config: unknown fallback identity provider: %s", fallback)
+		}
+	}
+	if failover := o.IDPHealthCheck.getFailover(); failover != "" && !names[failover] {
+		return fmt.Errorf("config: unknown failover identity provider: %s", failover)
+	}
+	for _, ipo := range o.IdentityProviders {
+		for _, fallback := range []string{ipo.IDPKerberos.getFallback(), ipo.IDPClientCert.getFallback()} {
+			if fallback != "" && !names[fallback] {
+				return fmt.Errorf("config: identity provider %s: unknown fallback identity provider: %s", ipo.Name, fallback)
+			}
+		}
+		if failover := ipo.IDPHealthCheck.getFailover(); failover != "" && !names[failover] {
+			return fmt.Errorf("config: identity provider %s: unknown failover identity provider: %s", ipo.Name, failover)
+		}
+	}
+	return nil
+}
+
+// GetIDPClaimsMapping returns the compiled claims mapping of the identity
+// provider with the given IDP id.
+func (o *Options) GetIDPClaimsMapping(idpID string) (*claimmap.Mapping, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
 	if err != nil {
 		return nil, err
 	}
+	return claimmap.Compile(idp.claimsMapping)
+}
+
+// GetUserAttributes returns the compiled user attributes mapping.
+func (o *Options) GetUserAttributes() (*claimmap.Mapping, error) {
+	return claimmap.Compile(o.UserAttributes)
+}
+
+// IDPSignOutOptions customize RP-initiated logout with an identity provider.
+// Identity providers differ in which end session parameters they accept.
+type IDPSignOutOptions struct {
+	// PostLogoutRedirectURI overrides the post_logout_redirect_uri sent to
+	// the identity provider, for identity providers which only accept a
+	// registered URI.
+	PostLogoutRedirectURI string `mapstructure:"post_logout_redirect_uri" yaml:"post_logout_redirect_uri,omitempty" json:"post_logout_redirect_uri,omitempty"`
+	// OmitIDTokenHint omits the id_token_hint parameter.
+	OmitIDTokenHint bool `mapstructure:"omit_id_token_hint" yaml:"omit_id_token_hint,omitempty" json:"omit_id_token_hint,omitempty"`
+	// IncludeClientID adds the client_id parameter.
+	IncludeClientID bool `mapstructure:"include_client_id" yaml:"include_client_id,omitempty" json:"include_client_id,omitempty"`
+	// IncludeState passes the requested redirect URI as the state parameter,
+	// so that it can be recovered by a fixed post logout redirect URI.
+	IncludeState bool `mapstructure:"include_state" yaml:"include_state,omitempty" json:"include_state,omitempty"`
+}
+
+// Validate validates the identity provider sign out options.
+func (o *IDPSignOutOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.PostLogoutRedirectURI != "" {
+		_, err := urlutil.ParseAndValidateURL(o.PostLogoutRedirectURI)
+		if err != nil {
+			return fmt.Errorf("config: bad idp_sign_out post_logout_redirect_uri %s: %w", o.PostLogoutRedirectURI, err)
+		}
+	}
+	return nil
+}
 
+// GetPostLogoutRedirectURI returns the post logout redirect URI override, if
+// any.
+func (o *IDPSignOutOptions) GetPostLogoutRedirectURI() string {
+	if o == nil {
+		return ""
+	}
+	return o.PostLogoutRedirectURI
+}
+
+// GetIDPSignOutOptions returns the sign out options of the identity provider
+// with the given IDP id. Options set on a route using the identity provider
+// take precedence over the global options. nil is returned if none are set.
+func (o *Options) GetIDPSignOutOptions(idpID string) (*IDPSignOutOptions, error) {
+	for _, p := range o.GetAllPolicies() {
+		p := p
+		if p.IDPSignOut == nil {
+			continue
+		}
+		idp, err := o.GetIdentityProviderForPolicy(&p)
+		if err != nil {
+			return nil, err
+		}
+		if idp.GetId() == idpID {
+			return p.IDPSignOut, nil
+		}
+	}
+	return o.IDPSignOut, nil
+}
+
+// IDPAuthParamsOptions are OpenID Connect authentication request parameters
+// passed to the identity provider when signing in to a route.
+type IDPAuthParamsOptions struct {
+	// Prompt is one of none, login, consent or select_account. Any prompt
+	// other than none signs the user in with the identity provider again.
+	Prompt string `mapstructure:"prompt" yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	// LoginHint hints the identity provider about the user's login name.
+	LoginHint string `mapstructure:"login_hint" yaml:"login_hint,omitempty" json:"login_hint,omitempty"`
+	// ACRValues are the requested authentication context class references.
+	ACRValues string `mapstructure:"acr_values" yaml:"acr_values,omitempty" json:"acr_values,omitempty"`
+	// MaxAge is the maximum number of seconds since the user last signed in
+	// with the identity provider.
+	MaxAge *int `mapstructure:"max_age" yaml:"max_age,omitempty" json:"max_age,omitempty"`
+}
+
+var validIDPPrompts = map[string]bool{
+	"none":           true,
+	"login":          true,
+	"consent":        true,
+	"select_account": true,
+}
+
+// NewIDPAuthParamsOptionsFromQuery reads the identity provider
+// authentication request parameters from a query string. nil is returned if
+// none are set.
+func NewIDPAuthParamsOptionsFromQuery(q url.Values) (*IDPAuthParamsOptions, error) {
+	o := &IDPAuthParamsOptions{
+		Prompt:    q.Get(urlutil.QueryIDPPrompt),
+		LoginHint: q.Get(urlutil.QueryIDPLoginHint),
+		ACRValues: q.Get(urlutil.QueryIDPACRValues),
+	}
+	if q.Has(urlutil.QueryIDPMaxAge) {
+		maxAge, err := strconv.Atoi(q.Get(urlutil.QueryIDPMaxAge))
+		if err != nil {
+			return nil, fmt.Errorf("config: invalid %s: %w", urlutil.QueryIDPMaxAge, err)
+		}
+		o.MaxAge = &maxAge
+	}
+	if *o == (IDPAuthParamsOptions{}) {
+		return nil, nil
+	}
+	return o, o.Validate()
+}
+
+// Validate validates the identity provider authentication request parameters.
+func (o *IDPAuthParamsOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, prompt := range strings.Fields(o.Prompt) {
+		if !validIDPPrompts[prompt] {
+			return fmt.Errorf("config: invalid idp_auth_params prompt: %q", prompt)
+		}
+	}
+	if strings.Contains(o.Prompt, "none") && len(strings.Fields(o.Prompt)) > 1 {
+		return fmt.Errorf("config: idp_auth_params prompt none cannot be combined with other values")
+	}
+	if o.MaxAge != nil && *o.MaxAge < 0 {
+		return fmt.Errorf("config: idp_auth_params max_age must not be negative")
+	}
+	return nil
+}
+
+// Merge returns the parameters with those set in other taking precedence.
+func (o *IDPAuthParamsOptions) Merge(other *IDPAuthParamsOptions) *IDPAuthParamsOptions {
+	if o == nil {
+		return other
+	} else if other == nil {
+		return o
+	}
+	merged := *o
+	if other.Prompt != "" {
+		merged.Prompt = other.Prompt
+	}
+	if other.LoginHint != "" {
+		merged.LoginHint = other.LoginHint
+	}
+	if other.ACRValues != "" {
+		merged.ACRValues = other.ACRValues
+	}
+	if other.MaxAge != nil {
+		merged.MaxAge = other.MaxAge
+	}
+	return &merged
+}
+
+// SetQuery sets the parameters in a query string, so that they can be
+// passed to the authenticate service in an encrypted sign in URL.
+func (o *IDPAuthParamsOptions) SetQuery(q url.Values) {
+	if o == nil {
+		return
+	}
+	for k, v := range map[string]string{
+		urlutil.QueryIDPPrompt:    o.Prompt,
+		urlutil.QueryIDPLoginHint: o.LoginHint,
+		urlutil.QueryIDPACRValues: o.ACRValues,
+	} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if o.MaxAge != nil {
+		q.Set(urlutil.QueryIDPMaxAge, strconv.Itoa(*o.MaxAge))
+	}
+}
+
+// AuthURLParams returns the parameters as they are added to the identity
+// provider's authorization URL.
+func (o *IDPAuthParamsOptions) AuthURLParams() map[string]string {
+	params := make(map[string]string)
+	if o == nil {
+		return params
+	}
+	if o.Prompt != "" {
+		params["prompt"] = o.Prompt
+	}
+	if o.LoginHint != "" {
+		params["login_hint"] = o.LoginHint
+	}
+	if o.ACRValues != "" {
+		params["acr_values"] = o.ACRValues
+	}
+	if o.MaxAge != nil {
+		params["max_age"] = strconv.Itoa(*o.MaxAge)
+	}
+	return params
+}
+
+// RequiresSignIn returns true if a user who last signed in with the identity
+// provider at signedInAt has to sign in again, for a sign in requested at
+// requestedAt.
+func (o *IDPAuthParamsOptions) RequiresSignIn(signedInAt, requestedAt, now time.Time) bool {
+	if o == nil {
+		return false
+	}
+	if o.Prompt != "" && o.Prompt != "none" && signedInAt.Before(requestedAt) {
+		return true
+	}
+	if o.MaxAge != nil && now.Sub(signedInAt) > time.Duration(*o.MaxAge)*time.Second {
+		return true
+	}
+	return false
+}
+
+// GetIDPAuthParamsForRequestURL returns the identity provider authentication
+// request parameters of the route matching the given request URL. nil is
+// returned if none are set.
+func (o *Options) GetIDPAuthParamsForRequestURL(requestURL string) (*IDPAuthParamsOptions, error) {
+	u, err := urlutil.ParseAndValidateURL(requestURL)
+	if err != nil {
+		return nil, err
+	}
 	for _, p := range o.GetAllPolicies() {
 		p := p
 		if p.Matches(*u) {
-			return o.GetIdentityProviderForPolicy(&p)
+			return p.IDPAuthParams, nil
 		}
 	}
-	return o.GetIdentityProviderForPolicy(nil)
+	return nil, nil
+}
+
+// IDPOAuth2Options configure the endpoints and claims of a generic OAuth2
+// identity provider, for identity providers without a discovery document.
+type IDPOAuth2Options struct {
+	// AuthURL is the authorization endpoint. It may be relative to the
+	// provider url.
+	AuthURL string `mapstructure:"auth_url" yaml:"auth_url,omitempty"`
+	// TokenURL is the token endpoint. It may be relative to the provider url.
+	TokenURL string `mapstructure:"token_url" yaml:"token_url,omitempty"`
+	// UserInfoURL is the user info endpoint. It is a template executed with
+	// the OAuth2 token, e.g. /api/users/{{.Extra "user_id" | urlquery}}.
+	UserInfoURL string `mapstructure:"userinfo_url" yaml:"userinfo_url,omitempty"`
+	// Claims maps claim names to JSONPath expressions selecting them from the
+	// user info response, e.g. groups: $.teams[*].name.
+	Claims map[string]string `mapstructure:"claims" yaml:"claims,omitempty"`
+}
+
+// Validate validates the generic OAuth2 identity provider options.
+func (o *IDPOAuth2Options) Validate() error {
+	if o == nil {
+		return fmt.Errorf("config: idp_oauth2 is required for the oauth2 identity provider")
+	}
+	if o.AuthURL == "" || o.TokenURL == "" || o.UserInfoURL == "" {
+		return fmt.Errorf("config: idp_oauth2 auth_url, token_url and userinfo_url are required")
+	}
+	return nil
+}
+
+// ApplyTo sets the generic OAuth2 endpoints and claims of the oauth options.
+func (o *IDPOAuth2Options) ApplyTo(dst *oauth.Options) {
+	if o == nil {
+		return
+	}
+	dst.AuthURL = o.AuthURL
+	dst.TokenURL = o.TokenURL
+	dst.UserInfoURL = o.UserInfoURL
+	dst.ClaimPaths = o.Claims
+}
+
+// IDPDirectorySyncOptions customize how often the information and groups of
+// users are refreshed from an identity provider.
+type IDPDirectorySyncOptions struct {
+	// Interval is the time between refreshes of a user. It defaults to 10
+	// minutes.
+	Interval time.Duration `mapstructure:"interval" yaml:"interval,omitempty"`
+	// Jitter is the maximum random amount of time added to the interval, to
+	// spread out the refreshes of many users.
+	Jitter time.Duration `mapstructure:"jitter" yaml:"jitter,omitempty"`
+	// ErrorBackoff is the time to wait before retrying a refresh which failed
+	// with a temporary error, such as a rate limit. It doubles with every
+	// consecutive error, up to the interval.
+	ErrorBackoff time.Duration `mapstructure:"error_backoff" yaml:"error_backoff,omitempty"`
+}
+
+// Validate validates the identity provider directory sync options.
+func (o *IDPDirectorySyncOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Interval < 0 || o.Jitter < 0 || o.ErrorBackoff < 0 {
+		return fmt.Errorf("config: idp_directory_sync durations must not be negative")
+	}
+	return nil
+}
+
+// GetIDPDirectorySyncOptions returns the directory sync options of the
+// identity provider with the given IDP id. nil is returned if none are set.
+func (o *Options) GetIDPDirectorySyncOptions(idpID string) (*IDPDirectorySyncOptions, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return nil, err
+	}
+	return idp.directorySync, nil
+}
+
+// IDPKeycloakOptions customize how the roles of Keycloak users are mapped to
+// the groups claim.
+type IDPKeycloakOptions struct {
+	// SkipRealmRoles doesn't add realm roles (realm_access.roles) to the
+	// groups claim.
+	SkipRealmRoles bool `mapstructure:"skip_realm_roles" yaml:"skip_realm_roles,omitempty"`
+	// ClientRoles are the ids of the clients whose roles (resource_access) are
+	// added to the groups claim, as <client id>/<role>. "*" selects every
+	// client. It defaults to the client pomerium signs in with.
+	ClientRoles []string `mapstructure:"client_roles" yaml:"client_roles,omitempty"`
+}
+
+// ApplyTo sets the Keycloak role mapping of the oauth options.
+func (o *IDPKeycloakOptions) ApplyTo(dst *oauth.Options) {
+	if o == nil {
+		return
+	}
+	dst.KeycloakSkipRealmRoles = o.SkipRealmRoles
+	dst.KeycloakClientRoles = o.ClientRoles
+}
+
+// IDPPasskeyOptions customize the passkey identity provider.
+type IDPPasskeyOptions struct {
+	// AllowedUsers are the usernames of the users who may register a passkey
+	// without a recovery code. "*" allows anyone to register. Registration is
+	// disabled by default.
+	AllowedUsers []string `mapstructure:"allowed_users" yaml:"allowed_users,omitempty"`
+}
+
+// ApplyTo sets the passkey options of the oauth options.
+func (o *IDPPasskeyOptions) ApplyTo(dst *oauth.Options) {
+	if o == nil {
+		return
+	}
+	dst.PasskeyAllowedUsers = o.AllowedUsers
+}
+
+// IDPKerberosOptions customize the Kerberos identity provider.
+type IDPKerberosOptions struct {
+	// Keytab is the base64 encoded keytab of the service principal, e.g.
+	// HTTP/authenticate.example.com@EXAMPLE.COM.
+	Keytab string `mapstructure:"keytab" yaml:"keytab,omitempty"`
+	// KeytabFile is the path of the keytab, instead of Keytab.
+	KeytabFile string `mapstructure:"keytab_file" yaml:"keytab_file,omitempty"`
+	// Fallback is the name of the identity provider users are sent to when
+	// their browser doesn't negotiate Kerberos, such as off the corporate
+	// network. Without one, sign in fails.
+	Fallback string `mapstructure:"fallback" yaml:"fallback,omitempty"`
+}
+
+// ApplyTo sets the Kerberos options of the oauth options.
+func (o *IDPKerberosOptions) ApplyTo(dst *oauth.Options) {
+	if o == nil {
+		return
+	}
+	dst.KerberosKeytab = o.Keytab
+	dst.KerberosKeytabFile = o.KeytabFile
+}
+
+func (o *IDPKerberosOptions) getFallback() string {
+	if o == nil {
+		return ""
+	}
+	return o.Fallback
+}
+
+// IDPAppleOptions customize the Sign in with Apple identity provider.
+type IDPAppleOptions struct {
+	// TeamID, KeyID and PrivateKey generate the client secret, a JWT signed
+	// with the private key downloaded from the Apple developer account,
+	// instead of idp_client_secret.
+	TeamID string `mapstructure:"team_id" yaml:"team_id,omitempty"`
+	KeyID  string `mapstructure:"key_id" yaml:"key_id,omitempty"`
+	// PrivateKey is the base64 encoded .p8 private key.
+	PrivateKey string `mapstructure:"private_key" yaml:"private_key,omitempty"`
+	// PrivateKeyFile is the path of the .p8 private key, instead of
+	// PrivateKey.
+	PrivateKeyFile string `mapstructure:"private_key_file" yaml:"private_key_file,omitempty"`
+}
+
+// ApplyTo sets the Apple options of the oauth options.
+func (o *IDPAppleOptions) ApplyTo(dst *oauth.Options) {
+	if o == nil {
+		return
+	}
+	dst.AppleTeamID = o.TeamID
+	dst.AppleKeyID = o.KeyID
+	dst.ApplePrivateKey = o.PrivateKey
+	dst.ApplePrivateKeyFile = o.PrivateKeyFile
+}
+
+// IDPClientCertOptions customize the client certificate identity provider.
+type IDPClientCertOptions struct {
+	// Fallback is the name of the identity provider users are sent to when
+	// they don't have a valid client certificate. Without one, sign in fails.
+	Fallback string `mapstructure:"fallback" yaml:"fallback,omitempty"`
+}
+
+func (o *IDPClientCertOptions) getFallback() string {
+	if o == nil {
+		return ""
+	}
+	return o.Fallback
+}
+
+// GetIdentityProviderFallback returns the IDP id of the identity provider
+// users are sent to when they can't sign in with the Kerberos or client
+// certificate identity provider with the given IDP id. An empty string is
+// returned if there is none.
+func (o *Options) GetIdentityProviderFallback(idpID string) (string, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return "", err
+	}
+	name := idp.kerberos.getFallback()
+	if name == "" {
+		name = idp.clientCert.getFallback()
+	}
+	if name == "" {
+		return "", nil
+	}
+	fallback, err := o.getNamedIdentityProvider(name)
+	if err != nil {
+		return "", err
+	}
+	return fallback.provider.GetId(), nil
+}
+
+// default identity provider health check options
+const (
+	DefaultIDPHealthCheckInterval           = 30 * time.Second
+	DefaultIDPHealthCheckTimeout            = 5 * time.Second
+	DefaultIDPHealthCheckUnhealthyThreshold = 3
+)
+
+// IDPHealthCheckOptions configure health checks of an identity provider. Its
+// discovery document and token endpoint are probed periodically, and it is
+// considered down after several consecutive failures, until a probe
+// succeeds.
+type IDPHealthCheckOptions struct {
+	// Interval is the time between probes. It defaults to 30 seconds.
+	Interval time.Duration `mapstructure:"interval" yaml:"interval,omitempty"`
+	// Timeout is the timeout of a probe. It defaults to 5 seconds.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty"`
+	// UnhealthyThreshold is the number of consecutive failed probes after
+	// which the identity provider is considered down. It defaults to 3.
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold" yaml:"unhealthy_threshold,omitempty"`
+	// Failover is the name of the identity provider users sign in with while
+	// the identity provider is down.
+	Failover string `mapstructure:"failover" yaml:"failover,omitempty"`
+	// RefreshGracePeriod is how long sessions which can't be refreshed while
+	// the identity provider is down are kept past their expiry, instead of
+	// being deleted.
+	RefreshGracePeriod time.Duration `mapstructure:"refresh_grace_period" yaml:"refresh_grace_period,omitempty"`
+}
+
+// Validate validates the identity provider health check options.
+func (o *IDPHealthCheckOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Interval < 0 || o.Timeout < 0 || o.RefreshGracePeriod < 0 {
+		return fmt.Errorf("config: idp_health_check durations must not be negative")
+	}
+	if o.UnhealthyThreshold < 0 {
+		return fmt.Errorf("config: idp_health_check unhealthy_threshold must not be negative")
+	}
+	return nil
+}
+
+// GetInterval returns the time between probes.
+func (o *IDPHealthCheckOptions) GetInterval() time.Duration {
+	if o == nil || o.Interval == 0 {
+		return DefaultIDPHealthCheckInterval
+	}
+	return o.Interval
+}
+
+// GetTimeout returns the timeout of a probe.
+func (o *IDPHealthCheckOptions) GetTimeout() time.Duration {
+	if o == nil || o.Timeout == 0 {
+		return DefaultIDPHealthCheckTimeout
+	}
+	return o.Timeout
+}
+
+// GetUnhealthyThreshold returns the number of consecutive failed probes
+// after which the identity provider is considered down.
+func (o *IDPHealthCheckOptions) GetUnhealthyThreshold() int {
+	if o == nil || o.UnhealthyThreshold == 0 {
+		return DefaultIDPHealthCheckUnhealthyThreshold
+	}
+	return o.UnhealthyThreshold
+}
+
+// GetRefreshGracePeriod returns how long sessions are kept past their expiry
+// while the identity provider is down.
+func (o *IDPHealthCheckOptions) GetRefreshGracePeriod() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.RefreshGracePeriod
+}
+
+func (o *IDPHealthCheckOptions) getFailover() string {
+	if o == nil {
+		return ""
+	}
+	return o.Failover
+}
+
+// GetIDPHealthCheckOptions returns the health check options of the identity
+// provider with the given IDP id. nil is returned if health checks are not
+// enabled.
+func (o *Options) GetIDPHealthCheckOptions(idpID string) (*IDPHealthCheckOptions, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return nil, err
+	}
+	return idp.healthCheck, nil
+}
+
+// GetIdentityProviderFailover returns the IDP id of the identity provider
+// users sign in with while the identity provider with the given IDP id is
+// down. An empty string is returned if there is none.
+func (o *Options) GetIdentityProviderFailover(idpID string) (string, error) {
+	idp, err := o.getIdentityProviderForID(idpID)
+	if err != nil {
+		return "", err
+	}
+	name := idp.healthCheck.getFailover()
+	if name == "" {
+		return "", nil
+	}
+	failover, err := o.getNamedIdentityProvider(name)
+	if err != nil {
+		return "", err
+	}
+	return failover.provider.GetId(), nil
 }
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultImpersonationTimeout is the default time limit of an impersonation.
+const DefaultImpersonationTimeout = time.Hour
+
+// GetImpersonationTimeout gets the time limit of an impersonation.
+func (o *Options) GetImpersonationTimeout() time.Duration {
+	if o.ImpersonationTimeout <= 0 {
+		return DefaultImpersonationTimeout
+	}
+	return o.ImpersonationTimeout
+}
+
+// IsImpersonationAllowed returns true if the user with the given id and email
+// may impersonate other users.
+func (o *Options) IsImpersonationAllowed(userID, email string) bool {
+	for _, allowed := range o.ImpersonationAllowedUsers {
+		if (userID != "" && allowed == userID) || (email != "" && strings.EqualFold(allowed, email)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) validateImpersonation() error {
+	if o.ImpersonationTimeout < 0 {
+		return fmt.Errorf("config: impersonation_timeout must not be negative")
+	}
+	return nil
+}
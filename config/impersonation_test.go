@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonation(t *testing.T) {
+	t.Parallel()
+
+	o := NewDefaultOptions()
+	assert.Equal(t, DefaultImpersonationTimeout, o.GetImpersonationTimeout())
+	assert.False(t, o.IsImpersonationAllowed("USER", "user@example.com"))
+
+	o.ImpersonationTimeout = 15 * time.Minute
+	o.ImpersonationAllowedUsers = []string{"ADMIN", "Operator@Example.com"}
+	assert.Equal(t, 15*time.Minute, o.GetImpersonationTimeout())
+	assert.True(t, o.IsImpersonationAllowed("ADMIN", ""))
+	assert.True(t, o.IsImpersonationAllowed("OPERATOR", "operator@example.com"))
+	assert.False(t, o.IsImpersonationAllowed("USER", "user@example.com"))
+	assert.False(t, o.IsImpersonationAllowed("", ""))
+
+	o.ImpersonationTimeout = -time.Minute
+	assert.Error(t, o.validateImpersonation())
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultOPAManagementReportingInterval is how often decision logs and
+// status are reported by default.
+const DefaultOPAManagementReportingInterval = 30 * time.Second
+
+// OPAManagementOptions configure reporting authorization decisions and status
+// to a service which implements the OPA management APIs, such as Styra DAS,
+// in OPA's decision log and status formats.
+//
+// https://www.openpolicyagent.org/docs/latest/management-decision-logs/
+// https://www.openpolicyagent.org/docs/latest/management-status/
+type OPAManagementOptions struct {
+	// URL is the url of the service. Decision logs are posted to /logs and
+	// status to /status.
+	URL string `mapstructure:"url" yaml:"url,omitempty"`
+	// Token is sent as a bearer token.
+	Token string `mapstructure:"token" yaml:"token,omitempty"`
+	// DecisionLogs enables reporting decision logs.
+	DecisionLogs bool `mapstructure:"decision_logs" yaml:"decision_logs,omitempty"`
+	// Status enables reporting status.
+	Status bool `mapstructure:"status" yaml:"status,omitempty"`
+	// Labels are added to the labels of every decision log and status
+	// report.
+	Labels map[string]string `mapstructure:"labels" yaml:"labels,omitempty"`
+	// ReportingInterval is how often decision logs and status are reported.
+	ReportingInterval time.Duration `mapstructure:"reporting_interval" yaml:"reporting_interval,omitempty"`
+}
+
+// Validate validates the OPA management options.
+func (o *OPAManagementOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("config: opa_management has an invalid url: %w", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("config: opa_management url must be an http or https url: %s", o.URL)
+	}
+	if !o.DecisionLogs && !o.Status {
+		return fmt.Errorf("config: opa_management requires decision_logs or status")
+	}
+	if o.ReportingInterval < 0 {
+		return fmt.Errorf("config: opa_management reporting_interval must not be negative")
+	}
+	return nil
+}
+
+// GetReportingInterval returns how often decision logs and status are
+// reported.
+func (o *OPAManagementOptions) GetReportingInterval() time.Duration {
+	if o == nil || o.ReportingInterval == 0 {
+		return DefaultOPAManagementReportingInterval
+	}
+	return o.ReportingInterval
+}
+
+// GetDecisionLogs returns true if decision logs are reported.
+func (o *OPAManagementOptions) GetDecisionLogs() bool {
+	return o != nil && o.DecisionLogs
+}
@@ -22,10 +22,15 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/geoip"
 	"github.com/pomerium/pomerium/internal/hashutil"
 	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/claimmap"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oauth/generic"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/redisutil"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
 	"github.com/pomerium/pomerium/internal/sets"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
@@ -34,6 +39,8 @@ import (
 	"github.com/pomerium/pomerium/pkg/grpc/config"
 	"github.com/pomerium/pomerium/pkg/grpc/crypt"
 	"github.com/pomerium/pomerium/pkg/hpke"
+	"github.com/pomerium/pomerium/pkg/kms"
+	"github.com/pomerium/pomerium/pkg/sessionstore"
 )
 
 // DisableHeaderKey is the key used to check whether to disable setting header
@@ -136,6 +143,71 @@ type Options struct {
 	CookieHTTPOnly   bool          `mapstructure:"cookie_http_only" yaml:"cookie_http_only,omitempty"`
 	CookieExpire     time.Duration `mapstructure:"cookie_expire" yaml:"cookie_expire,omitempty"`
 
+	// CookiePartitioned adds the Partitioned attribute to session cookies so
+	// that they can be used when embedded in third-party iframes.
+	CookiePartitioned bool `mapstructure:"cookie_partitioned" yaml:"cookie_partitioned,omitempty"`
+
+	// CookieSameSite sets the SameSite attribute of session cookies. One of
+	// "lax", "strict" or "none". It can be overridden per route.
+	CookieSameSite string `mapstructure:"cookie_same_site" yaml:"cookie_same_site,omitempty"`
+
+	// CookieOpaque stores only a random session reference in the session
+	// cookie and persists the session itself in the databroker.
+	CookieOpaque bool `mapstructure:"cookie_opaque" yaml:"cookie_opaque,omitempty"`
+
+	// CookieEncrypted encrypts the session cookie (JWE, A256GCM) so that
+	// claims such as email and groups can't be read client-side.
+	CookieEncrypted bool `mapstructure:"cookie_encrypted" yaml:"cookie_encrypted,omitempty"`
+
+	// SessionStore selects a session store registered with the sessionstore
+	// package in place of the built-in cookie session store.
+	SessionStore string `mapstructure:"session_store" yaml:"session_store,omitempty"`
+	// SessionStoreURL is the URL of the server used by the session_store,
+	// such as redis://localhost:6379 for the redis session store or
+	// memcached://host1:11211,host2:11211 for the memcached session store.
+	SessionStoreURL string `mapstructure:"session_store_url" yaml:"session_store_url,omitempty"`
+
+	// SessionEventsWebhookURL is a URL which receives session lifecycle
+	// events (created, refreshed, revoked and expired) as JSON POST requests.
+	SessionEventsWebhookURL string `mapstructure:"session_events_webhook_url" yaml:"session_events_webhook_url,omitempty"`
+
+	// SessionIdleTimeout expires a session after a period of inactivity,
+	// independent of the session's absolute expiry. Disabled when zero.
+	SessionIdleTimeout time.Duration `mapstructure:"session_idle_timeout" yaml:"session_idle_timeout,omitempty"`
+
+	// RememberMeExpire enables the "remember this device" flow. Devices which
+	// opt in receive a long-lived cookie, with this expiry, which can be used
+	// to sign in again after the session cookie has expired. Disabled when
+	// zero.
+	RememberMeExpire time.Duration `mapstructure:"remember_me_expire" yaml:"remember_me_expire,omitempty"`
+
+	// SessionMaxPerUser limits the number of concurrent sessions a user may
+	// have. When exceeded the oldest sessions are revoked at sign-in.
+	// Unlimited when zero.
+	SessionMaxPerUser int `mapstructure:"session_max_per_user" yaml:"session_max_per_user,omitempty"`
+
+	// SessionBindClientCertificate binds sessions to the client certificate
+	// presented at sign-in. Requests presenting a different certificate, or
+	// using a session without one, are treated as unauthenticated.
+	SessionBindClientCertificate bool `mapstructure:"session_bind_client_certificate" yaml:"session_bind_client_certificate,omitempty"`
+
+	// SessionBinding binds sessions to the source IP prefix and User-Agent
+	// they're created with at sign-in. One of "off", "warn" or "enforce".
+	SessionBinding SessionBindingMode `mapstructure:"session_binding" yaml:"session_binding,omitempty"`
+	// SessionBindingIPv4PrefixLength is the IPv4 prefix length sessions are
+	// bound to. Zero disables IPv4 binding.
+	SessionBindingIPv4PrefixLength int `mapstructure:"session_binding_ipv4_prefix_length" yaml:"session_binding_ipv4_prefix_length,omitempty"`
+	// SessionBindingIPv6PrefixLength is the IPv6 prefix length sessions are
+	// bound to. Zero disables IPv6 binding.
+	SessionBindingIPv6PrefixLength int `mapstructure:"session_binding_ipv6_prefix_length" yaml:"session_binding_ipv6_prefix_length,omitempty"`
+
+	// ImpersonationAllowedUsers are the ids or email addresses of the
+	// operators who may start a session as another user for troubleshooting.
+	ImpersonationAllowedUsers []string `mapstructure:"impersonation_allowed_users" yaml:"impersonation_allowed_users,omitempty"`
+	// ImpersonationTimeout is the time limit of an impersonation. Defaults to
+	// one hour.
+	ImpersonationTimeout time.Duration `mapstructure:"impersonation_timeout" yaml:"impersonation_timeout,omitempty"`
+
 	// Identity provider configuration variables as specified by RFC6749
 	// https://openid.net/specs/openid-connect-basic-1_0.html#RFC6749
 	ClientID         string   `mapstructure:"idp_client_id" yaml:"idp_client_id,omitempty"`
@@ -145,6 +217,12 @@ type Options struct {
 	ProviderURL      string   `mapstructure:"idp_provider_url" yaml:"idp_provider_url,omitempty"`
 	Scopes           []string `mapstructure:"idp_scopes" yaml:"idp_scopes,omitempty"`
 
+	// ProviderAPIURL is the base URL of the identity provider's REST API, for
+	// identity providers which serve it separately, such as GitHub Enterprise
+	// Server (https://github.example.com/api/v3) or Microsoft Graph in a
+	// national cloud.
+	ProviderAPIURL string `mapstructure:"idp_api_url" yaml:"idp_api_url,omitempty"`
+
 	// RequestParams are custom request params added to the signin request as
 	// part of an Oauth2 code flow.
 	//
@@ -152,6 +230,155 @@ type Options struct {
 	// https://openid.net/specs/openid-connect-basic-1_0.html#RequestParameters
 	RequestParams map[string]string `mapstructure:"idp_request_params" yaml:"idp_request_params,omitempty"`
 
+	// IDPSignOut customizes RP-initiated logout with the identity provider.
+	IDPSignOut *IDPSignOutOptions `mapstructure:"idp_sign_out" yaml:"idp_sign_out,omitempty"`
+
+	// IDPOAuth2 configures the generic oauth2 identity provider.
+	IDPOAuth2 *IDPOAuth2Options `mapstructure:"idp_oauth2" yaml:"idp_oauth2,omitempty"`
+
+	// IDPRequirePKCE requires the identity provider to support PKCE with the
+	// S256 code challenge method. PKCE is always used, but sign in fails
+	// rather than continuing without it when the identity provider's discovery
+	// document doesn't advertise S256.
+	IDPRequirePKCE bool `mapstructure:"idp_require_pkce" yaml:"idp_require_pkce,omitempty"`
+
+	// IDPDirectorySync customizes how often users' information and groups
+	// are refreshed from the identity provider.
+	IDPDirectorySync *IDPDirectorySyncOptions `mapstructure:"idp_directory_sync" yaml:"idp_directory_sync,omitempty"`
+
+	// IDPKeycloak customizes how Keycloak roles are mapped to groups.
+	IDPKeycloak *IDPKeycloakOptions `mapstructure:"idp_keycloak" yaml:"idp_keycloak,omitempty"`
+
+	// IDPPasskey customizes the passkey identity provider.
+	IDPPasskey *IDPPasskeyOptions `mapstructure:"idp_passkey" yaml:"idp_passkey,omitempty"`
+
+	// IDPKerberos customizes the Kerberos identity provider.
+	IDPKerberos *IDPKerberosOptions `mapstructure:"idp_kerberos" yaml:"idp_kerberos,omitempty"`
+
+	// IDPApple customizes the Sign in with Apple identity provider.
+	IDPApple *IDPAppleOptions `mapstructure:"idp_apple" yaml:"idp_apple,omitempty"`
+
+	// IDPClientCert customizes the client certificate identity provider.
+	IDPClientCert *IDPClientCertOptions `mapstructure:"idp_client_certificate" yaml:"idp_client_certificate,omitempty"`
+
+	// IDPHealthCheck enables health checks of the identity provider, and
+	// customizes what happens while it is down.
+	IDPHealthCheck *IDPHealthCheckOptions `mapstructure:"idp_health_check" yaml:"idp_health_check,omitempty"`
+
+	// IDPClaimsMapping maps claim names to expressions which are evaluated
+	// against the identity provider's claims at sign in, e.g.
+	// name: given_name + " " + family_name, or
+	// department: default(department, regex(dn, "OU=([^,]+)")).
+	IDPClaimsMapping map[string]string `mapstructure:"idp_claims_mapping" yaml:"idp_claims_mapping,omitempty"`
+
+	// UserAttributes maps user attribute names to expressions, with the
+	// syntax of IDPClaimsMapping, which are evaluated against the identity
+	// provider's claims whenever a user signs in. Attributes are stored as
+	// claims of the databroker user record, so that policies and JWT claim
+	// headers can reference them. Attributes which evaluate to nothing keep
+	// their previous value.
+	UserAttributes map[string]string `mapstructure:"user_attributes" yaml:"user_attributes,omitempty"`
+
+	// IDPAccountLinking links the accounts of users at several identity
+	// providers which share a verified email address, so that a user has a
+	// single user record regardless of the identity provider used to sign in.
+	// An email address is verified when the email_verified claim is true.
+	IDPAccountLinking bool `mapstructure:"idp_account_linking" yaml:"idp_account_linking,omitempty"`
+
+	// IdentityProviders are additional identity providers, which routes
+	// select by name.
+	IdentityProviders []IdentityProviderOptions `mapstructure:"identity_providers" yaml:"identity_providers,omitempty"`
+
+	// SCIMBearerToken enables the SCIM provisioning endpoint of the
+	// authenticate service. Identity providers authenticate with the token.
+	SCIMBearerToken string `mapstructure:"scim_bearer_token" yaml:"scim_bearer_token,omitempty"`
+
+	// PolicyBundles are signed rego policy bundles pulled from OCI
+	// registries, which routes refer to by name.
+	PolicyBundles []PolicyBundleOptions `mapstructure:"policy_bundles" yaml:"policy_bundles,omitempty"`
+
+	// ExternalDataSources are JSON documents authorize fetches from HTTPS
+	// endpoints, which policies refer to under data.external.
+	ExternalDataSources []ExternalDataSourceOptions `mapstructure:"external_data_sources" yaml:"external_data_sources,omitempty"`
+
+	// PolicyRecordTypes are databroker record types authorize syncs, which
+	// policies refer to under data.databroker.
+	PolicyRecordTypes []PolicyRecordTypeOptions `mapstructure:"policy_record_types" yaml:"policy_record_types,omitempty"`
+
+	// DevicePostureProviders are device management and endpoint security
+	// providers whose devices the databroker syncs for the device_posture
+	// policy criterion.
+	DevicePostureProviders []DevicePostureProviderOptions `mapstructure:"device_posture_providers" yaml:"device_posture_providers,omitempty"`
+
+	// OPAManagement reports authorization decisions and status to a service
+	// which implements the OPA management APIs, in OPA's formats.
+	OPAManagement *OPAManagementOptions `mapstructure:"opa_management" yaml:"opa_management,omitempty"`
+
+	// RegoLibraries are rego helper modules, with packages under data.lib,
+	// which the custom rego of every route may import.
+	RegoLibraries []string `mapstructure:"rego_libraries" yaml:"rego_libraries,omitempty"`
+
+	// GeoIPDatabasePath is the path of a MaxMind database, e.g.
+	// GeoLite2-Country, which the geoip_country and geoip_asn policy
+	// criteria look up client IP addresses in. GeoIPASNDatabasePath is the
+	// path of an additional database, e.g. GeoLite2-ASN. The databases are
+	// reloaded when their files change.
+	GeoIPDatabasePath    string `mapstructure:"geoip_database_path" yaml:"geoip_database_path,omitempty"`
+	GeoIPASNDatabasePath string `mapstructure:"geoip_asn_database_path" yaml:"geoip_asn_database_path,omitempty"`
+
+	// RateLimitRedisURL is the URL of a redis server the requests for the
+	// rate_limit policy criterion are counted in. If not set, the requests
+	// are counted in the databroker.
+	RateLimitRedisURL string `mapstructure:"rate_limit_redis_url" yaml:"rate_limit_redis_url,omitempty"`
+
+	// InspectRequestBodyMaxBytes is the maximum number of bytes of a request
+	// body which are buffered and sent to authorize for routes with
+	// inspect_request_body set. Larger bodies are truncated.
+	InspectRequestBodyMaxBytes uint32 `mapstructure:"inspect_request_body_max_bytes" yaml:"inspect_request_body_max_bytes,omitempty"`
+
+	// AuthorizeDecisionCacheSize is the maximum number of policy decisions
+	// authorize caches. Decisions are cached for routes whose policies only
+	// depend on the session, the user and the request method, url and
+	// client IP address, and are invalidated when the session, user or
+	// policies change. If 0, decisions aren't cached.
+	AuthorizeDecisionCacheSize int `mapstructure:"authorize_decision_cache_size" yaml:"authorize_decision_cache_size,omitempty"`
+	// AuthorizeDecisionCacheTTL is how long cached policy decisions are
+	// used, which bounds how long changes to other records, such as the
+	// directory, take to apply.
+	AuthorizeDecisionCacheTTL time.Duration `mapstructure:"authorize_decision_cache_ttl" yaml:"authorize_decision_cache_ttl,omitempty"`
+
+	// ServiceAccountAPIToken enables the service account management API of
+	// the authenticate service. Clients authenticate with the token.
+	ServiceAccountAPIToken string `mapstructure:"service_account_api_token" yaml:"service_account_api_token,omitempty"`
+
+	// ExplainAPIToken enables the /.pomerium/explain API of the authorize
+	// service, which explains policy decisions. Clients authenticate with
+	// the token.
+	ExplainAPIToken string `mapstructure:"explain_api_token" yaml:"explain_api_token,omitempty"`
+
+	// OktaEventHookSecret enables the Okta event hook endpoint of the
+	// authenticate service, which signs out users as soon as they are
+	// deactivated in Okta. Okta sends the secret in the Authorization header.
+	OktaEventHookSecret string `mapstructure:"okta_event_hook_secret" yaml:"okta_event_hook_secret,omitempty"`
+
+	// SharedSignalsTransmitters enable the Shared Signals receiver endpoint
+	// of the authenticate service. Identity providers push CAEP and RISC
+	// security event tokens, which revoke the sessions of their subjects.
+	SharedSignalsTransmitters []SharedSignalsTransmitterOptions `mapstructure:"shared_signals_transmitters" yaml:"shared_signals_transmitters,omitempty"`
+
+	// PolicyNamespaces delegate the administration of the routes of some
+	// domains to namespace admins, who manage them with the policy namespace
+	// API of the authenticate service.
+	PolicyNamespaces []PolicyNamespaceOptions `mapstructure:"policy_namespaces" yaml:"policy_namespaces,omitempty"`
+
+	// GitOps synchronizes the routes defined in a git repository into the
+	// databroker config.
+	GitOps *GitOpsOptions `mapstructure:"gitops" yaml:"gitops,omitempty"`
+
+	// AccessRequests enable users who are denied access to a route to request
+	// temporary access from an approver.
+	AccessRequests *AccessRequestOptions `mapstructure:"access_requests" yaml:"access_requests,omitempty"`
+
 	// AuthorizeURLString is the routable destination of the authorize service's
 	// gRPC endpoint. NOTE: As many load balancers do not support
 	// externally routed gRPC so this may be an internal location.
@@ -172,6 +399,25 @@ type Options struct {
 	// https://www.pomerium.com/docs/topics/getting-users-identity.html
 	SigningKey     string `mapstructure:"signing_key" yaml:"signing_key,omitempty"`
 	SigningKeyFile string `mapstructure:"signing_key_file" yaml:"signing_key_file,omitempty"`
+	// SigningKeyKMS is the URL of a signing key stored in AWS KMS (awskms://),
+	// Google Cloud KMS (gcpkms://), Vault Transit (hashivault://) or a PKCS #11
+	// module (pkcs11:). The private key never leaves the key management service.
+	SigningKeyKMS string `mapstructure:"signing_key_kms" yaml:"signing_key_kms,omitempty"`
+	// SigningKeyAlgorithm can be set to the experimental Ed25519-Dilithium2
+	// hybrid post-quantum algorithm, in which case the signing key must be a
+	// hybrid key. If no signing key is set, one is generated. It only applies
+	// to the JWT assertion: JWTs between services are always signed with the
+	// shared secret.
+	SigningKeyAlgorithm string `mapstructure:"signing_key_algorithm" yaml:"signing_key_algorithm,omitempty"`
+	// SigningKeyRotationInterval enables automated signing key rotation. A new
+	// signing key is generated by the databroker every interval.
+	SigningKeyRotationInterval time.Duration `mapstructure:"signing_key_rotation_interval" yaml:"signing_key_rotation_interval,omitempty"`
+	// SigningKeyRotationOverlap is how long a superseded signing key is still
+	// published in the JWKS after it has been rotated.
+	SigningKeyRotationOverlap time.Duration `mapstructure:"signing_key_rotation_overlap" yaml:"signing_key_rotation_overlap,omitempty"`
+	// RotatedSigningKeys are the PEM encoded signing keys generated by the
+	// signing key rotator, newest first. They are populated from the databroker.
+	RotatedSigningKeys []byte `yaml:"-"`
 
 	HeadersEnv string `yaml:",omitempty"`
 	// SetResponseHeaders to set on all proxied requests. Add a 'disable' key map to turn off.
@@ -239,9 +485,11 @@ type Options struct {
 	// DataBrokerStorageConnectionString is the data source name for storage backend.
 	DataBrokerStorageConnectionString string `mapstructure:"databroker_storage_connection_string" yaml:"databroker_storage_connection_string,omitempty"`
 	DataBrokerStorageCertFile         string `mapstructure:"databroker_storage_cert_file" yaml:"databroker_storage_cert_file,omitempty"`
-	DataBrokerStorageCertKeyFile      string `mapstructure:"databroker_storage_key_file" yaml:"databroker_storage_key_file,omitempty"`
-	DataBrokerStorageCAFile           string `mapstructure:"databroker_storage_ca_file" yaml:"databroker_storage_ca_file,omitempty"`
-	DataBrokerStorageCertSkipVerify   bool   `mapstructure:"databroker_storage_tls_skip_verify" yaml:"databroker_storage_tls_skip_verify,omitempty"`
+	// DataBrokerStorageCertKeyFile is the client certificate key file, or a
+	// PKCS #11 URI (pkcs11:) of a key stored in a hardware security module.
+	DataBrokerStorageCertKeyFile    string `mapstructure:"databroker_storage_key_file" yaml:"databroker_storage_key_file,omitempty"`
+	DataBrokerStorageCAFile         string `mapstructure:"databroker_storage_ca_file" yaml:"databroker_storage_ca_file,omitempty"`
+	DataBrokerStorageCertSkipVerify bool   `mapstructure:"databroker_storage_tls_skip_verify" yaml:"databroker_storage_tls_skip_verify,omitempty"`
 
 	// ClientCA is the base64-encoded certificate authority to validate client mTLS certificates against.
 	ClientCA string `mapstructure:"client_ca" yaml:"client_ca,omitempty"`
@@ -294,6 +542,14 @@ type certificateFilePair struct {
 	KeyFile  string `mapstructure:"key" yaml:"key,omitempty"`
 }
 
+// DefaultInspectRequestBodyMaxBytes is the default maximum number of bytes of
+// a request body sent to authorize.
+const DefaultInspectRequestBodyMaxBytes = 8 * 1024
+
+// DefaultAuthorizeDecisionCacheTTL is how long cached policy decisions are
+// used by default.
+const DefaultAuthorizeDecisionCacheTTL = 30 * time.Second
+
 // DefaultOptions are the default configuration options for pomerium
 var defaultOptions = Options{
 	Debug:                    false,
@@ -314,6 +570,11 @@ var defaultOptions = Options{
 	AuthenticateCallbackPath: "/oauth2/callback",
 	TracingSampleRate:        0.0001,
 
+	SigningKeyRotationOverlap: time.Hour,
+
+	SessionBindingIPv4PrefixLength: DefaultSessionBindingIPv4PrefixLength,
+	SessionBindingIPv6PrefixLength: DefaultSessionBindingIPv6PrefixLength,
+
 	AutocertOptions: AutocertOptions{
 		Folder: dataDir(),
 	},
@@ -575,6 +836,39 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if err := o.IDPSignOut.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.IDPDirectorySync.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.IDPHealthCheck.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := claimmap.Compile(o.IDPClaimsMapping); err != nil {
+		return fmt.Errorf("config: bad idp_claims_mapping: %w", err)
+	}
+
+	if _, err := claimmap.Compile(o.UserAttributes); err != nil {
+		return fmt.Errorf("config: bad user_attributes: %w", err)
+	}
+
+	if o.ProviderAPIURL != "" {
+		_, err := urlutil.ParseAndValidateURL(o.ProviderAPIURL)
+		if err != nil {
+			return fmt.Errorf("config: bad idp_api_url %s: %w", o.ProviderAPIURL, err)
+		}
+	}
+
+	if o.Provider == generic.Name {
+		if err := o.IDPOAuth2.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if o.AuthorizeURLString != "" {
 		_, err := urlutil.ParseAndValidateURL(o.AuthorizeURLString)
 		if err != nil {
@@ -608,6 +902,50 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("config: failed to parse policy: %w", err)
 	}
 
+	if err := o.validateIdentityProviders(); err != nil {
+		return err
+	}
+
+	if err := o.validatePolicyBundles(); err != nil {
+		return err
+	}
+
+	if err := o.validateExternalDataSources(); err != nil {
+		return err
+	}
+
+	if err := o.validatePolicyRecordTypes(); err != nil {
+		return err
+	}
+
+	if err := o.validateDevicePostureProviders(); err != nil {
+		return err
+	}
+
+	if err := o.OPAManagement.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.validateSharedSignalsTransmitters(); err != nil {
+		return err
+	}
+
+	if err := o.validatePolicyNamespaces(); err != nil {
+		return err
+	}
+
+	if err := o.GitOps.Validate(); err != nil {
+		return err
+	}
+
+	if err := o.AccessRequests.Validate(); err != nil {
+		return err
+	}
+
+	if err := validateRegoLibraries(o.RegoLibraries); err != nil {
+		return fmt.Errorf("config: rego_libraries: %w", err)
+	}
+
 	if err := o.parseHeaders(ctx); err != nil {
 		return fmt.Errorf("config: failed to parse headers: %w", err)
 	}
@@ -642,7 +980,12 @@ func (o *Options) Validate() error {
 	}
 
 	if o.DataBrokerStorageCertFile != "" || o.DataBrokerStorageCertKeyFile != "" {
-		_, err := cryptutil.CertificateFromFile(o.DataBrokerStorageCertFile, o.DataBrokerStorageCertKeyFile)
+		var err error
+		if kms.IsPKCS11URI(o.DataBrokerStorageCertKeyFile) {
+			_, err = kms.LoadX509KeyPair(o.DataBrokerStorageCertFile, o.DataBrokerStorageCertKeyFile)
+		} else {
+			_, err = cryptutil.CertificateFromFile(o.DataBrokerStorageCertFile, o.DataBrokerStorageCertKeyFile)
+		}
 		if err != nil {
 			return fmt.Errorf("config: bad databroker cert file %w", err)
 		}
@@ -681,6 +1024,25 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if _, err := o.GetGeoIPDatabase(); err != nil {
+		return fmt.Errorf("config: bad geoip database: %w", err)
+	}
+
+	if o.RateLimitRedisURL != "" {
+		client, err := redisutil.NewClientFromURL(o.RateLimitRedisURL, nil)
+		if err != nil {
+			return fmt.Errorf("config: bad rate limit redis url: %w", err)
+		}
+		_ = client.Close()
+	}
+
+	if o.AuthorizeDecisionCacheSize < 0 {
+		return fmt.Errorf("config: authorize_decision_cache_size must not be negative")
+	}
+	if o.AuthorizeDecisionCacheTTL < 0 {
+		return fmt.Errorf("config: authorize_decision_cache_ttl must not be negative")
+	}
+
 	// strip quotes from redirect address (#811)
 	o.HTTPRedirectAddr = strings.Trim(o.HTTPRedirectAddr, `"'`)
 
@@ -725,6 +1087,93 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.SessionIdleTimeout < 0 {
+		return fmt.Errorf("config: session_idle_timeout must not be negative")
+	}
+
+	if o.RememberMeExpire < 0 {
+		return fmt.Errorf("config: remember_me_expire must not be negative")
+	}
+
+	if _, err := ParseSameSite(o.CookieSameSite); err != nil {
+		return err
+	}
+
+	err = cookie.Options{
+		Name:        o.CookieName,
+		Domain:      o.CookieDomain,
+		Secure:      o.CookieSecure,
+		Partitioned: o.CookiePartitioned,
+		SameSite:    o.GetCookieSameSite(),
+		ByHost:      o.GetCookieOptionsByHost(),
+	}.Validate()
+	if err != nil {
+		return fmt.Errorf("config: invalid cookie options: %w", err)
+	}
+
+	if o.CookieEncrypted && o.CookieOpaque {
+		return fmt.Errorf("config: cookie_encrypted and cookie_opaque are mutually exclusive")
+	}
+
+	if o.SessionEventsWebhookURL != "" {
+		if _, err := urlutil.ParseAndValidateURL(o.SessionEventsWebhookURL); err != nil {
+			return fmt.Errorf("config: invalid session_events_webhook_url: %w", err)
+		}
+	}
+
+	if o.SessionStore != "" {
+		if _, ok := sessionstore.Get(o.SessionStore); !ok {
+			return fmt.Errorf("config: unknown session_store: %s", o.SessionStore)
+		}
+		if o.CookieEncrypted || o.CookieOpaque {
+			return fmt.Errorf("config: session_store cannot be used with cookie_encrypted or cookie_opaque")
+		}
+	}
+
+	if o.SigningKeyKMS != "" {
+		if o.SigningKey != "" || o.SigningKeyFile != "" {
+			return fmt.Errorf("config: signing_key_kms cannot be used with signing_key or signing_key_file")
+		}
+		if err := kms.ValidateURL(o.SigningKeyKMS); err != nil {
+			return fmt.Errorf("config: invalid signing_key_kms: %w", err)
+		}
+	}
+
+	switch o.SigningKeyAlgorithm {
+	case "":
+	case string(cryptutil.HybridSignatureAlgorithm):
+		if o.SigningKeyKMS != "" || o.SigningKeyRotationInterval > 0 {
+			return fmt.Errorf("config: signing_key_algorithm %s cannot be used with signing_key_kms or signing_key_rotation_interval",
+				o.SigningKeyAlgorithm)
+		}
+	default:
+		return fmt.Errorf("config: unsupported signing_key_algorithm: %s", o.SigningKeyAlgorithm)
+	}
+
+	if o.SigningKeyRotationInterval < 0 {
+		return fmt.Errorf("config: signing_key_rotation_interval must not be negative")
+	}
+	if o.SigningKeyRotationInterval > 0 {
+		if o.SigningKey != "" || o.SigningKeyFile != "" || o.SigningKeyKMS != "" {
+			return fmt.Errorf("config: signing_key_rotation_interval cannot be used with signing_key, signing_key_file or signing_key_kms")
+		}
+		if o.SigningKeyRotationOverlap <= 0 {
+			return fmt.Errorf("config: signing_key_rotation_overlap must be positive")
+		}
+	}
+
+	if o.SessionMaxPerUser < 0 {
+		return fmt.Errorf("config: session_max_per_user must not be negative")
+	}
+
+	if err := o.validateImpersonation(); err != nil {
+		return err
+	}
+
+	if err := o.validateSessionBinding(); err != nil {
+		return err
+	}
+
 	// validate the Autocert options
 	err = o.AutocertOptions.Validate()
 	if err != nil {
@@ -877,14 +1326,27 @@ func (o *Options) GetOauthOptions() (oauth.Options, error) {
 	if err != nil {
 		return oauth.Options{}, err
 	}
-	return oauth.Options{
+	clientCA, err := o.GetClientCA()
+	if err != nil {
+		return oauth.Options{}, err
+	}
+	oauthOptions := oauth.Options{
 		RedirectURL:  redirectURL,
 		ProviderName: o.Provider,
 		ProviderURL:  o.ProviderURL,
 		ClientID:     o.ClientID,
 		ClientSecret: clientSecret,
 		Scopes:       o.Scopes,
-	}, nil
+		APIURL:       o.ProviderAPIURL,
+		RequirePKCE:  o.IDPRequirePKCE,
+		ClientCA:     clientCA,
+	}
+	o.IDPOAuth2.ApplyTo(&oauthOptions)
+	o.IDPKeycloak.ApplyTo(&oauthOptions)
+	o.IDPPasskey.ApplyTo(&oauthOptions)
+	o.IDPKerberos.ApplyTo(&oauthOptions)
+	o.IDPApple.ApplyTo(&oauthOptions)
+	return oauthOptions, nil
 }
 
 // GetAllPolicies gets all the policies in the options.
@@ -930,12 +1392,50 @@ func (o *Options) GetClientCA() ([]byte, error) {
 	return nil, nil
 }
 
+// GetInspectRequestBodyMaxBytes returns the maximum number of bytes of a
+// request body sent to authorize.
+func (o *Options) GetInspectRequestBodyMaxBytes() uint32 {
+	if o.InspectRequestBodyMaxBytes == 0 {
+		return DefaultInspectRequestBodyMaxBytes
+	}
+	return o.InspectRequestBodyMaxBytes
+}
+
+// GetAuthorizeDecisionCacheTTL returns how long cached policy decisions are
+// used.
+func (o *Options) GetAuthorizeDecisionCacheTTL() time.Duration {
+	if o.AuthorizeDecisionCacheTTL == 0 {
+		return DefaultAuthorizeDecisionCacheTTL
+	}
+	return o.AuthorizeDecisionCacheTTL
+}
+
+// HasInspectRequestBodyPolicy returns true if any route inspects request
+// bodies.
+func (o *Options) HasInspectRequestBodyPolicy() bool {
+	for _, p := range o.GetAllPolicies() {
+		if p.InspectRequestBody {
+			return true
+		}
+	}
+	return false
+}
+
+// GetGeoIPDatabase returns the geoip databases. If none are configured, the
+// database has no results.
+func (o *Options) GetGeoIPDatabase() (*geoip.Database, error) {
+	return geoip.Open(o.GeoIPDatabasePath, o.GeoIPASNDatabasePath)
+}
+
 // GetDataBrokerCertificate gets the optional databroker certificate. This method will return nil if no certificate is
 // specified.
 func (o *Options) GetDataBrokerCertificate() (*tls.Certificate, error) {
 	if o.DataBrokerStorageCertFile == "" || o.DataBrokerStorageCertKeyFile == "" {
 		return nil, nil
 	}
+	if kms.IsPKCS11URI(o.DataBrokerStorageCertKeyFile) {
+		return kms.LoadX509KeyPair(o.DataBrokerStorageCertFile, o.DataBrokerStorageCertKeyFile)
+	}
 	return cryptutil.CertificateFromFile(o.DataBrokerStorageCertFile, o.DataBrokerStorageCertKeyFile)
 }
 
@@ -986,6 +1486,9 @@ func (o *Options) GetSharedKey() ([]byte, error) {
 	if sharedKey == "" {
 		return nil, errors.New("empty shared secret")
 	}
+	if cryptutil.IsTinkKeyset([]byte(sharedKey)) {
+		return getPrimaryTinkAEADKey(sharedKey)
+	}
 	if strings.TrimSpace(sharedKey) != sharedKey {
 		return nil, errors.New("shared secret contains whitespace")
 	}
@@ -1218,16 +1721,34 @@ func (o *Options) GetCookieSecret() ([]byte, error) {
 	if cookieSecret == "" {
 		return nil, errors.New("empty cookie secret")
 	}
+	if cryptutil.IsTinkKeyset([]byte(cookieSecret)) {
+		return getPrimaryTinkAEADKey(cookieSecret)
+	}
 
 	return base64.StdEncoding.DecodeString(cookieSecret)
 }
 
-// GetSigningKey gets the signing key.
+// GetSigningKey gets the signing key. When the signing key is stored in a key
+// management service, the PEM encoded public key is returned instead. When
+// signing key rotation is enabled, all the published keys are returned, with
+// the current signing key first.
 func (o *Options) GetSigningKey() ([]byte, error) {
 	if o == nil {
 		return nil, nil
 	}
 
+	if o.SigningKeyRotationInterval > 0 {
+		return o.RotatedSigningKeys, nil
+	}
+
+	if o.SigningKeyKMS != "" {
+		signer, err := o.GetSigningKeyKMSSigner()
+		if err != nil {
+			return nil, err
+		}
+		return kms.EncodePublicKey(signer)
+	}
+
 	rawSigningKey := o.SigningKey
 	if o.SigningKeyFile != "" {
 		bs, err := os.ReadFile(o.SigningKeyFile)
@@ -1239,11 +1760,90 @@ func (o *Options) GetSigningKey() ([]byte, error) {
 
 	rawSigningKey = strings.TrimSpace(rawSigningKey)
 
+	signingKey := []byte(rawSigningKey)
 	if bs, err := base64.StdEncoding.DecodeString(rawSigningKey); err == nil {
-		return bs, nil
+		signingKey = bs
+	}
+
+	// tink keysets are converted to PEM, with the primary key first
+	if cryptutil.IsTinkKeyset(signingKey) {
+		return cryptutil.SigningKeysFromTinkKeyset(signingKey)
 	}
 
-	return []byte(rawSigningKey), nil
+	return signingKey, nil
+}
+
+// ExportTinkKeyset exports the shared_secret, cookie_secret or signing_key as
+// a cleartext Tink JSON keyset, so that it can be managed by Tink tooling.
+func (o *Options) ExportTinkKeyset(name string) ([]byte, error) {
+	switch name {
+	case "shared_secret":
+		// a random shared secret is used if it isn't set
+		if o.SharedKey == "" && o.SharedSecretFile == "" {
+			return nil, errors.New("config: shared_secret is not set")
+		}
+		sharedKey, err := o.GetSharedKey()
+		if err != nil {
+			return nil, err
+		}
+		return cryptutil.AEADKeysToTinkKeyset(sharedKey)
+	case "cookie_secret":
+		if o.CookieSecret == "" && o.CookieSecretFile == "" {
+			return nil, errors.New("config: cookie_secret is not set")
+		}
+		cookieSecret, err := o.GetCookieSecret()
+		if err != nil {
+			return nil, err
+		}
+		return cryptutil.AEADKeysToTinkKeyset(cookieSecret)
+	case "signing_key":
+		signingKey, err := o.GetSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		if len(signingKey) == 0 {
+			return nil, errors.New("config: signing_key is not set")
+		}
+		return cryptutil.SigningKeysToTinkKeyset(signingKey)
+	}
+	return nil, fmt.Errorf("config: unsupported key for tink keyset export: %s", name)
+}
+
+func getPrimaryTinkAEADKey(rawKeyset string) ([]byte, error) {
+	keys, err := cryptutil.AEADKeysFromTinkKeyset([]byte(rawKeyset))
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// GetHybridSigner gets the signer for a hybrid signing key. If no signing key
+// is set, a new one is generated.
+func (o *Options) GetHybridSigner() (*cryptutil.HybridSigner, error) {
+	if o == nil || o.SigningKeyAlgorithm != string(cryptutil.HybridSignatureAlgorithm) {
+		return nil, errors.New("config: signing_key_algorithm is not a hybrid algorithm")
+	}
+
+	signingKey, err := o.GetSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(signingKey) == 0 {
+		signingKey, err = cryptutil.GenerateHybridSigningKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cryptutil.NewHybridSigner(signingKey)
+}
+
+// GetSigningKeyKMSSigner gets the signer for the signing key stored in a key
+// management service.
+func (o *Options) GetSigningKeyKMSSigner() (kms.Signer, error) {
+	if o == nil || o.SigningKeyKMS == "" {
+		return nil, errors.New("config: signing_key_kms is not set")
+	}
+	return kms.GetSigner(context.TODO(), o.SigningKeyKMS)
 }
 
 // Checksum returns the checksum of the current options struct
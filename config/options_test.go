@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -19,6 +20,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/pomerium/pomerium/internal/geoip/geoiptest"
+	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/config"
 )
@@ -53,6 +56,52 @@ func Test_Validate(t *testing.T) {
 	missingStorageDSN.DataBrokerStorageType = "redis"
 	badSignoutRedirectURL := testOptions()
 	badSignoutRedirectURL.SignOutRedirectURLString = "--"
+	hostCookiePrefix := testOptions()
+	hostCookiePrefix.CookieName = "__Host-pomerium"
+	badHostCookiePrefix := testOptions()
+	badHostCookiePrefix.CookieName = "__Host-pomerium"
+	badHostCookiePrefix.CookieDomain = "example.com"
+	badSecureCookiePrefix := testOptions()
+	badSecureCookiePrefix.CookieName = "__Secure-pomerium"
+	badSecureCookiePrefix.CookieSecure = false
+	encryptedOpaqueCookie := testOptions()
+	encryptedOpaqueCookie.CookieEncrypted = true
+	encryptedOpaqueCookie.CookieOpaque = true
+	negativeRememberMeExpire := testOptions()
+	negativeRememberMeExpire.RememberMeExpire = -time.Hour
+	unknownSessionStore := testOptions()
+	unknownSessionStore.SessionStore = "unknown"
+	badSessionEventsWebhookURL := testOptions()
+	badSessionEventsWebhookURL.SessionEventsWebhookURL = "--"
+	badIDPSignOutRedirectURI := testOptions()
+	badIDPSignOutRedirectURI.IDPSignOut = &IDPSignOutOptions{PostLogoutRedirectURI: "--"}
+	genericOAuth2 := testOptions()
+	genericOAuth2.Provider = "oauth2"
+	genericOAuth2.IDPOAuth2 = &IDPOAuth2Options{AuthURL: "/authorize", TokenURL: "/token", UserInfoURL: "/user"}
+	missingGenericOAuth2 := testOptions()
+	missingGenericOAuth2.Provider = "oauth2"
+	signingKeyKMS := testOptions()
+	signingKeyKMS.SigningKeyKMS = "hashivault://pomerium"
+	badSigningKeyKMS := testOptions()
+	badSigningKeyKMS.SigningKeyKMS = "file:///signing-key.pem"
+	signingKeyAndKMS := testOptions()
+	signingKeyAndKMS.SigningKeyKMS = "hashivault://pomerium"
+	signingKeyAndKMS.SigningKeyFile = "./testdata/example-key.pem"
+	signingKeyRotation := testOptions()
+	signingKeyRotation.SigningKeyRotationInterval = 24 * time.Hour
+	signingKeyAndRotation := testOptions()
+	signingKeyAndRotation.SigningKeyRotationInterval = 24 * time.Hour
+	signingKeyAndRotation.SigningKeyFile = "./testdata/example-key.pem"
+	badSigningKeyRotationOverlap := testOptions()
+	badSigningKeyRotationOverlap.SigningKeyRotationInterval = 24 * time.Hour
+	badSigningKeyRotationOverlap.SigningKeyRotationOverlap = 0
+	hybridSigningKey := testOptions()
+	hybridSigningKey.SigningKeyAlgorithm = "Ed25519-Dilithium2"
+	hybridSigningKeyAndRotation := testOptions()
+	hybridSigningKeyAndRotation.SigningKeyAlgorithm = "Ed25519-Dilithium2"
+	hybridSigningKeyAndRotation.SigningKeyRotationInterval = 24 * time.Hour
+	unknownSigningKeyAlgorithm := testOptions()
+	unknownSigningKeyAlgorithm.SigningKeyAlgorithm = "ES256"
 
 	tests := []struct {
 		name     string
@@ -67,6 +116,25 @@ func Test_Validate(t *testing.T) {
 		{"invalid databroker storage type", invalidStorageType, true},
 		{"missing databroker storage dsn", missingStorageDSN, true},
 		{"invalid signout redirect url", badSignoutRedirectURL, true},
+		{"host cookie prefix", hostCookiePrefix, false},
+		{"host cookie prefix with domain", badHostCookiePrefix, true},
+		{"secure cookie prefix without secure", badSecureCookiePrefix, true},
+		{"encrypted opaque cookie", encryptedOpaqueCookie, true},
+		{"negative remember me expire", negativeRememberMeExpire, true},
+		{"unknown session store", unknownSessionStore, true},
+		{"invalid session events webhook url", badSessionEventsWebhookURL, true},
+		{"invalid idp sign out redirect uri", badIDPSignOutRedirectURI, true},
+		{"generic oauth2 provider", genericOAuth2, false},
+		{"generic oauth2 provider without endpoints", missingGenericOAuth2, true},
+		{"signing key kms", signingKeyKMS, false},
+		{"invalid signing key kms", badSigningKeyKMS, true},
+		{"signing key and signing key kms", signingKeyAndKMS, true},
+		{"signing key rotation", signingKeyRotation, false},
+		{"signing key and signing key rotation", signingKeyAndRotation, true},
+		{"invalid signing key rotation overlap", badSigningKeyRotationOverlap, true},
+		{"hybrid signing key", hybridSigningKey, false},
+		{"hybrid signing key and signing key rotation", hybridSigningKeyAndRotation, true},
+		{"unknown signing key algorithm", unknownSigningKeyAlgorithm, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -79,6 +147,315 @@ func Test_Validate(t *testing.T) {
 	}
 }
 
+func TestOptions_GetIDPSignOutOptions(t *testing.T) {
+	t.Parallel()
+
+	global := &IDPSignOutOptions{IncludeClientID: true}
+	route := &IDPSignOutOptions{OmitIDTokenHint: true}
+	o := NewDefaultOptions()
+	o.IDPSignOut = global
+	o.Policies = []Policy{
+		{From: "https://a.example.com", To: mustParseWeightedURLs(t, "https://a.internal"), IDPClientID: "a", IDPSignOut: route},
+		{From: "https://b.example.com", To: mustParseWeightedURLs(t, "https://b.internal"), IDPClientID: "b"},
+	}
+
+	idpA, err := o.GetIdentityProviderForPolicy(&o.Policies[0])
+	require.NoError(t, err)
+	idpB, err := o.GetIdentityProviderForPolicy(&o.Policies[1])
+	require.NoError(t, err)
+
+	got, err := o.GetIDPSignOutOptions(idpA.GetId())
+	require.NoError(t, err)
+	assert.Equal(t, route, got)
+
+	got, err = o.GetIDPSignOutOptions(idpB.GetId())
+	require.NoError(t, err)
+	assert.Equal(t, global, got)
+}
+
+func TestIDPAuthParamsOptions(t *testing.T) {
+	t.Parallel()
+
+	maxAge := 300
+	route := &IDPAuthParamsOptions{Prompt: "consent", ACRValues: "urn:mace:incommon:iap:silver", MaxAge: &maxAge}
+
+	q := url.Values{
+		urlutil.QueryIDPPrompt:    {"login"},
+		urlutil.QueryIDPLoginHint: {"user@example.com"},
+	}
+	requested, err := NewIDPAuthParamsOptionsFromQuery(q)
+	require.NoError(t, err)
+	assert.Equal(t, &IDPAuthParamsOptions{Prompt: "login", LoginHint: "user@example.com"}, requested)
+
+	merged := route.Merge(requested)
+	assert.Equal(t, map[string]string{
+		"prompt":     "login",
+		"login_hint": "user@example.com",
+		"acr_values": "urn:mace:incommon:iap:silver",
+		"max_age":    "300",
+	}, merged.AuthURLParams())
+
+	q = url.Values{}
+	merged.SetQuery(q)
+	roundTripped, err := NewIDPAuthParamsOptionsFromQuery(q)
+	require.NoError(t, err)
+	assert.Equal(t, merged, roundTripped)
+
+	got, err := NewIDPAuthParamsOptionsFromQuery(url.Values{})
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	for _, q := range []url.Values{
+		{urlutil.QueryIDPPrompt: {"always"}},
+		{urlutil.QueryIDPPrompt: {"none login"}},
+		{urlutil.QueryIDPMaxAge: {"soon"}},
+		{urlutil.QueryIDPMaxAge: {"-1"}},
+	} {
+		_, err := NewIDPAuthParamsOptionsFromQuery(q)
+		assert.Error(t, err, q)
+	}
+
+	now := time.Now()
+	assert.True(t, requested.RequiresSignIn(now.Add(-time.Minute), now, now))
+	assert.False(t, requested.RequiresSignIn(now, now.Add(-time.Minute), now))
+	assert.False(t, (&IDPAuthParamsOptions{Prompt: "none"}).RequiresSignIn(now.Add(-time.Minute), now, now))
+	assert.True(t, (&IDPAuthParamsOptions{MaxAge: &maxAge}).RequiresSignIn(now.Add(-time.Hour), now, now))
+	assert.False(t, (&IDPAuthParamsOptions{MaxAge: &maxAge}).RequiresSignIn(now.Add(-time.Minute), now, now))
+	assert.False(t, (*IDPAuthParamsOptions)(nil).RequiresSignIn(now.Add(-time.Hour), now, now))
+}
+
+func TestOptions_GetIDPAuthParamsForRequestURL(t *testing.T) {
+	t.Parallel()
+
+	route := &IDPAuthParamsOptions{Prompt: "login"}
+	o := NewDefaultOptions()
+	o.Policies = []Policy{
+		{From: "https://a.example.com", To: mustParseWeightedURLs(t, "https://a.internal"), IDPAuthParams: route},
+		{From: "https://b.example.com", To: mustParseWeightedURLs(t, "https://b.internal")},
+	}
+	for i := range o.Policies {
+		require.NoError(t, o.Policies[i].Validate())
+	}
+
+	got, err := o.GetIDPAuthParamsForRequestURL("https://a.example.com/.pomerium/api/v1/login")
+	require.NoError(t, err)
+	assert.Equal(t, route, got)
+
+	got, err = o.GetIDPAuthParamsForRequestURL("https://b.example.com/.pomerium/api/v1/login")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestOptions_validatePolicyBundles(t *testing.T) {
+	t.Parallel()
+
+	bundle := PolicyBundleOptions{Name: "security", Reference: "ghcr.io/example/policies:latest", PublicKey: "KEY"}
+	for _, tc := range []struct {
+		name    string
+		bundles []PolicyBundleOptions
+		policy  string
+		wantErr bool
+	}{
+		{"ok", []PolicyBundleOptions{bundle}, "security", false},
+		{"unknown bundle", []PolicyBundleOptions{bundle}, "other", true},
+		{"duplicate", []PolicyBundleOptions{bundle, bundle}, "", true},
+		{"missing reference", []PolicyBundleOptions{{Name: "security", PublicKey: "KEY"}}, "", true},
+		{"missing public key", []PolicyBundleOptions{{Name: "security", Reference: bundle.Reference}}, "", true},
+		{"invalid digest", []PolicyBundleOptions{{Name: "security", Reference: bundle.Reference, PublicKey: "KEY", Digest: "sha256:abc"}}, "", true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			o := NewDefaultOptions()
+			o.PolicyBundles = tc.bundles
+			o.Policies = []Policy{{From: "https://a.example.com", PolicyBundle: tc.policy}}
+			err := o.validatePolicyBundles()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOptions_GetGeoIPDatabase(t *testing.T) {
+	t.Parallel()
+
+	bs, err := geoiptest.Build(24, map[string]map[string]any{
+		"1.1.1.0/24": {"country": map[string]any{"iso_code": "AU"}},
+	})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "country.mmdb"), bs, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.mmdb"), []byte("INVALID"), 0o600))
+
+	o := NewDefaultOptions()
+	o.GeoIPDatabasePath = filepath.Join(dir, "country.mmdb")
+	db, err := o.GetGeoIPDatabase()
+	require.NoError(t, err)
+	res, err := db.Lookup(net.ParseIP("1.1.1.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "AU", res.Country)
+
+	o.GeoIPASNDatabasePath = filepath.Join(dir, "invalid.mmdb")
+	_, err = o.GetGeoIPDatabase()
+	assert.Error(t, err)
+}
+
+func TestOptions_GetIDPDirectorySyncOptions(t *testing.T) {
+	t.Parallel()
+
+	global := &IDPDirectorySyncOptions{Interval: time.Hour}
+	named := &IDPDirectorySyncOptions{Interval: time.Minute, ErrorBackoff: time.Second}
+	o := NewDefaultOptions()
+	o.Provider = "okta"
+	o.IDPDirectorySync = global
+	o.IdentityProviders = []IdentityProviderOptions{{
+		Name:             "github",
+		Provider:         "github",
+		IDPDirectorySync: named,
+	}}
+
+	idps, err := o.GetAllIdentityProviders()
+	require.NoError(t, err)
+	require.Len(t, idps, 2)
+
+	got, err := o.GetIDPDirectorySyncOptions(idps[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, global, got)
+
+	got, err = o.GetIDPDirectorySyncOptions(idps[1].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, named, got)
+
+	o.IdentityProviders[0].IDPDirectorySync = &IDPDirectorySyncOptions{Interval: -time.Minute}
+	assert.Error(t, o.validateIdentityProviders())
+}
+
+func TestOptions_GetIDPClaimsMapping(t *testing.T) {
+	t.Parallel()
+
+	o := NewDefaultOptions()
+	o.Provider = "oidc"
+	o.IDPClaimsMapping = map[string]string{"name": `given_name + " " + family_name`}
+	idp, err := o.GetIdentityProviderForID("")
+	require.NoError(t, err)
+
+	m, err := o.GetIDPClaimsMapping(idp.GetId())
+	require.NoError(t, err)
+	claims := map[string]any{"given_name": "Alice", "family_name": "Smith"}
+	m.Apply(claims)
+	assert.Equal(t, "Alice Smith", claims["name"])
+
+	o.IDPClaimsMapping = map[string]string{"name": `lower(`}
+	assert.ErrorContains(t, o.Validate(), "idp_claims_mapping")
+
+	o.IDPClaimsMapping = nil
+	o.UserAttributes = map[string]string{"department": `regex(dn`}
+	assert.ErrorContains(t, o.Validate(), "user_attributes")
+}
+
+func TestOptions_GetIdentityProvidersForPolicy(t *testing.T) {
+	t.Parallel()
+
+	o := NewDefaultOptions()
+	o.AuthenticateURLString = "https://authenticate.example.com"
+	o.Provider = "okta"
+	o.ProviderURL = "https://staff.okta.example.com"
+	o.ClientID = "staff"
+	o.ClientSecret = "staff-secret"
+	o.IdentityProviders = []IdentityProviderOptions{{
+		Name:         "contractors",
+		Provider:     "oauth2",
+		ProviderURL:  "https://contractors.example.com",
+		ClientID:     "contractors",
+		ClientSecret: "contractors-secret",
+		IDPOAuth2:    &IDPOAuth2Options{AuthURL: "/authorize", TokenURL: "/token", UserInfoURL: "/user"},
+	}}
+	o.Policies = []Policy{
+		{From: "https://staff.example.com", To: mustParseWeightedURLs(t, "https://staff.internal")},
+		{From: "https://contractors.example.com", To: mustParseWeightedURLs(t, "https://contractors.internal"), IdentityProviders: []string{"contractors"}},
+		{From: "https://shared.example.com", To: mustParseWeightedURLs(t, "https://shared.internal"), IdentityProviders: []string{"default", "contractors"}},
+	}
+	for i := range o.Policies {
+		require.NoError(t, o.Policies[i].Validate())
+	}
+
+	staff, err := o.GetIdentityProvidersForPolicy(&o.Policies[0])
+	require.NoError(t, err)
+	require.Len(t, staff, 1)
+	assert.Equal(t, "staff", staff[0].GetClientId())
+
+	contractors, err := o.GetIdentityProvidersForPolicy(&o.Policies[1])
+	require.NoError(t, err)
+	require.Len(t, contractors, 1)
+	assert.Equal(t, "contractors", contractors[0].GetClientId())
+	assert.NotEqual(t, staff[0].GetId(), contractors[0].GetId())
+
+	shared, err := o.GetIdentityProvidersForRequestURL("https://shared.example.com/path")
+	require.NoError(t, err)
+	assert.Equal(t, []string{staff[0].GetId(), contractors[0].GetId()},
+		[]string{shared[0].GetId(), shared[1].GetId()})
+
+	all, err := o.GetAllIdentityProviders()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	name, err := o.GetIdentityProviderName(contractors[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, "contractors", name)
+	name, err = o.GetIdentityProviderName(staff[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, "okta", name)
+
+	oauthOptions, err := o.GetOauthOptionsForIdentityProvider(contractors[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, "oauth2", oauthOptions.ProviderName)
+	assert.Equal(t, "contractors-secret", oauthOptions.ClientSecret)
+	assert.Equal(t, "/user", oauthOptions.UserInfoURL)
+	assert.Equal(t, "authenticate.example.com", oauthOptions.RedirectURL.Host)
+
+	idp, err := o.GetIdentityProviderForID("unknown")
+	require.NoError(t, err)
+	assert.Equal(t, staff[0].GetId(), idp.GetId(), "should fall back to the default identity provider")
+
+	fallback, err := o.GetIdentityProviderFallback(staff[0].GetId())
+	require.NoError(t, err)
+	assert.Empty(t, fallback)
+	o.IDPKerberos = &IDPKerberosOptions{Fallback: "contractors"}
+	fallback, err = o.GetIdentityProviderFallback(staff[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, contractors[0].GetId(), fallback)
+	o.IDPKerberos.Fallback = "unknown"
+	assert.Error(t, o.validateIdentityProviders())
+	o.IDPKerberos = nil
+	o.IDPClientCert = &IDPClientCertOptions{Fallback: "unknown"}
+	assert.Error(t, o.validateIdentityProviders())
+	o.IDPClientCert = nil
+
+	failover, err := o.GetIdentityProviderFailover(staff[0].GetId())
+	require.NoError(t, err)
+	assert.Empty(t, failover)
+	o.IDPHealthCheck = &IDPHealthCheckOptions{Failover: "contractors"}
+	failover, err = o.GetIdentityProviderFailover(staff[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, contractors[0].GetId(), failover)
+	healthCheck, err := o.GetIDPHealthCheckOptions(staff[0].GetId())
+	require.NoError(t, err)
+	assert.Equal(t, DefaultIDPHealthCheckInterval, healthCheck.GetInterval())
+	o.IDPHealthCheck.Failover = "unknown"
+	assert.Error(t, o.validateIdentityProviders())
+	o.IDPHealthCheck = nil
+
+	o.Policies[1].IdentityProviders = []string{"unknown"}
+	assert.Error(t, o.validateIdentityProviders())
+	o.Policies[1].IdentityProviders = []string{"contractors"}
+	o.IdentityProviders = append(o.IdentityProviders, IdentityProviderOptions{Name: "contractors", Provider: "okta"})
+	assert.Error(t, o.validateIdentityProviders())
+}
+
 func Test_bindEnvs(t *testing.T) {
 	o := new(Options)
 	o.viper = viper.New()
@@ -303,6 +680,11 @@ func TestOptionsFromViper(t *testing.T) {
 				DataBrokerStorageType:    "memory",
 				EnvoyAdminAccessLogPath:  os.DevNull,
 				EnvoyAdminProfilePath:    os.DevNull,
+
+				SessionBindingIPv4PrefixLength: DefaultSessionBindingIPv4PrefixLength,
+				SessionBindingIPv6PrefixLength: DefaultSessionBindingIPv6PrefixLength,
+
+				SigningKeyRotationOverlap: time.Hour,
 			},
 			false,
 		},
@@ -320,6 +702,11 @@ func TestOptionsFromViper(t *testing.T) {
 				DataBrokerStorageType:    "memory",
 				EnvoyAdminAccessLogPath:  os.DevNull,
 				EnvoyAdminProfilePath:    os.DevNull,
+
+				SessionBindingIPv4PrefixLength: DefaultSessionBindingIPv4PrefixLength,
+				SessionBindingIPv6PrefixLength: DefaultSessionBindingIPv6PrefixLength,
+
+				SigningKeyRotationOverlap: time.Hour,
 			},
 			false,
 		},
@@ -779,6 +1166,51 @@ func TestOptions_GetSharedKey(t *testing.T) {
 		_, err := o.GetSharedKey()
 		assert.Error(t, err)
 	})
+	t.Run("tink", func(t *testing.T) {
+		key := cryptutil.NewKey()
+		keyset, err := cryptutil.AEADKeysToTinkKeyset(key, cryptutil.NewKey())
+		require.NoError(t, err)
+
+		o := NewDefaultOptions()
+		o.SharedKey = string(keyset)
+		bs, err := o.GetSharedKey()
+		assert.NoError(t, err)
+		assert.Equal(t, key, bs, "should use the primary key")
+	})
+}
+
+func TestOptions_ExportTinkKeyset(t *testing.T) {
+	t.Parallel()
+
+	signingKey, err := cryptutil.NewSigningKey()
+	require.NoError(t, err)
+	rawSigningKey, err := cryptutil.EncodePrivateKey(signingKey)
+	require.NoError(t, err)
+
+	o := NewDefaultOptions()
+	o.SharedKey = cryptutil.NewBase64Key()
+	o.SigningKey = base64.StdEncoding.EncodeToString(rawSigningKey)
+
+	keyset, err := o.ExportTinkKeyset("shared_secret")
+	require.NoError(t, err)
+	sharedKey, err := o.GetSharedKey()
+	require.NoError(t, err)
+	o.SharedKey = string(keyset)
+	imported, err := o.GetSharedKey()
+	require.NoError(t, err)
+	assert.Equal(t, sharedKey, imported)
+
+	keyset, err = o.ExportTinkKeyset("signing_key")
+	require.NoError(t, err)
+	o.SigningKey = string(keyset)
+	imported, err = o.GetSigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, rawSigningKey, imported)
+
+	_, err = o.ExportTinkKeyset("cookie_secret")
+	assert.Error(t, err, "should not export a random cookie secret")
+	_, err = o.ExportTinkKeyset("unknown")
+	assert.Error(t, err)
 }
 
 func TestOptions_GetSigningKey(t *testing.T) {
@@ -909,3 +1341,298 @@ func mustParseWeightedURLs(t *testing.T, urls ...string) []WeightedURL {
 	require.NoError(t, err)
 	return wu
 }
+
+func TestOptions_SessionBinding(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	assert.Equal(t, SessionBindingModeOff, o.GetSessionBindingMode())
+	assert.NoError(t, o.Validate())
+
+	o.SessionBinding = "Enforce"
+	assert.Equal(t, SessionBindingModeEnforce, o.GetSessionBindingMode())
+	assert.NoError(t, o.Validate())
+
+	o.SessionBinding = "sometimes"
+	assert.Error(t, o.Validate())
+
+	o.SessionBinding = SessionBindingModeWarn
+	o.SessionBindingIPv4PrefixLength = 33
+	assert.Error(t, o.Validate())
+}
+
+func TestOptions_ExternalDataSources(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.ExternalDataSources = []ExternalDataSourceOptions{
+		{Name: "oncall", URL: "https://oncall.example.com/current.json"},
+		{Name: "cmdb_hosts", URL: "https://cmdb.example.com/hosts", RefreshInterval: time.Hour},
+	}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, DefaultExternalDataSourceRefreshInterval, o.ExternalDataSources[0].GetRefreshInterval())
+	assert.Equal(t, time.Hour, o.ExternalDataSources[1].GetRefreshInterval())
+
+	for _, eds := range []ExternalDataSourceOptions{
+		{Name: "on-call", URL: "https://oncall.example.com/current.json"},
+		{Name: "oncall2", URL: "http://oncall.example.com/current.json"},
+		{Name: "oncall2", URL: "https:///current.json"},
+		{Name: "oncall2", URL: "https://oncall.example.com/current.json", RefreshInterval: -time.Second},
+		{Name: "oncall", URL: "https://oncall.example.com/other.json"},
+	} {
+		o.ExternalDataSources = []ExternalDataSourceOptions{
+			{Name: "oncall", URL: "https://oncall.example.com/current.json"},
+			eds,
+		}
+		assert.Error(t, o.Validate(), eds)
+	}
+}
+
+func TestOptions_OPAManagement(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	assert.Equal(t, DefaultOPAManagementReportingInterval, o.OPAManagement.GetReportingInterval())
+
+	o.OPAManagement = &OPAManagementOptions{URL: "https://das.example.com/v1", DecisionLogs: true}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, DefaultOPAManagementReportingInterval, o.OPAManagement.GetReportingInterval())
+
+	for _, opa := range []OPAManagementOptions{
+		{URL: "das.example.com", DecisionLogs: true},
+		{URL: "https://das.example.com"},
+		{URL: "https://das.example.com", Status: true, ReportingInterval: -time.Second},
+	} {
+		opa := opa
+		o.OPAManagement = &opa
+		assert.Error(t, o.Validate(), opa)
+	}
+}
+
+func TestOptions_DevicePostureProviders(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.DevicePostureProviders = []DevicePostureProviderOptions{
+		{Name: "intune", Type: "intune", TenantID: "TENANT_ID", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+		{Name: "jamf", Type: "jamf", URL: "https://example.jamfcloud.com", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET", RefreshInterval: time.Hour},
+	}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, DefaultDevicePostureRefreshInterval, o.DevicePostureProviders[0].GetRefreshInterval())
+	assert.Equal(t, time.Hour, o.DevicePostureProviders[1].GetRefreshInterval())
+
+	for _, dpp := range []DevicePostureProviderOptions{
+		{Name: "falcon-us", Type: "crowdstrike", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+		{Name: "falcon", Type: "sentinelone", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+		{Name: "falcon", Type: "crowdstrike", ClientID: "CLIENT_ID"},
+		{Name: "falcon", Type: "crowdstrike", URL: "http://api.crowdstrike.com", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+		{Name: "falcon", Type: "crowdstrike", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET", RefreshInterval: -time.Second},
+		{Name: "falcon", Type: "intune", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+		{Name: "falcon", Type: "jamf", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+		{Name: "intune", Type: "crowdstrike", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+	} {
+		o.DevicePostureProviders = []DevicePostureProviderOptions{
+			{Name: "intune", Type: "intune", TenantID: "TENANT_ID", ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"},
+			dpp,
+		}
+		assert.Error(t, o.Validate(), dpp)
+	}
+}
+
+func TestOptions_SharedSignalsTransmitters(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.SharedSignalsTransmitters = []SharedSignalsTransmitterOptions{
+		{Issuer: "https://idp.example.com", JWKSURL: "https://idp.example.com/jwks"},
+	}
+	assert.NoError(t, o.Validate())
+	assert.NotNil(t, o.GetSharedSignalsTransmitter("https://idp.example.com"))
+	assert.Nil(t, o.GetSharedSignalsTransmitter("https://other.example.com"))
+
+	for _, sst := range []SharedSignalsTransmitterOptions{
+		{JWKSURL: "https://other.example.com/jwks"},
+		{Issuer: "https://other.example.com"},
+		{Issuer: "https://other.example.com", JWKSURL: "http://other.example.com/jwks"},
+		{Issuer: "https://idp.example.com", JWKSURL: "https://idp.example.com/jwks"},
+	} {
+		o.SharedSignalsTransmitters = []SharedSignalsTransmitterOptions{
+			{Issuer: "https://idp.example.com", JWKSURL: "https://idp.example.com/jwks"},
+			sst,
+		}
+		assert.Error(t, o.Validate(), sst)
+	}
+}
+
+func TestOptions_PolicyNamespaces(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.PolicyNamespaces = []PolicyNamespaceOptions{
+		{Name: "payments", Domains: []string{"payments.example.com", "*.payments.example.com"}, Upstreams: []string{"*.internal"}, Admins: []string{"admin@example.com"}},
+	}
+	assert.NoError(t, o.Validate())
+
+	pn := o.GetPolicyNamespace("payments")
+	if assert.NotNil(t, pn) {
+		assert.True(t, pn.HasDomain("payments.example.com"))
+		assert.True(t, pn.HasDomain("api.payments.example.com"))
+		assert.True(t, pn.HasDomain("*.payments.example.com"))
+		assert.False(t, pn.HasDomain("example.com"))
+		assert.False(t, pn.HasDomain("notpayments.example.com"))
+		assert.True(t, pn.HasUpstream("api.internal"))
+		assert.False(t, pn.HasUpstream("169.254.169.254"))
+		assert.True(t, pn.IsAdmin("", "Admin@example.com"))
+		assert.False(t, pn.IsAdmin("user-1", "other@example.com"))
+	}
+	assert.Nil(t, o.GetPolicyNamespace("billing"))
+
+	ns, ok := o.GetPolicyNamespaceForRecord("policy-namespace/payments")
+	assert.True(t, ok)
+	assert.Equal(t, pn, ns)
+	ns, ok = o.GetPolicyNamespaceForRecord("policy-namespace/billing")
+	assert.True(t, ok)
+	assert.Nil(t, ns)
+	_, ok = o.GetPolicyNamespaceForRecord("routes")
+	assert.False(t, ok)
+
+	for _, pn := range []PolicyNamespaceOptions{
+		{Name: "billing", Admins: []string{"admin@example.com"}},
+		{Name: "billing", Domains: []string{"billing.example.com"}},
+		{Name: "billing", Domains: []string{"https://billing.example.com"}, Admins: []string{"admin@example.com"}},
+		{Name: "billing", Domains: []string{"billing.*.example.com"}, Admins: []string{"admin@example.com"}},
+		{Name: "billing", Domains: []string{"billing.example.com"}, Upstreams: []string{"http://billing.internal"}, Admins: []string{"admin@example.com"}},
+		{Name: "billing team", Domains: []string{"billing.example.com"}, Admins: []string{"admin@example.com"}},
+		{Name: "payments", Domains: []string{"billing.example.com"}, Admins: []string{"admin@example.com"}},
+	} {
+		o.PolicyNamespaces = []PolicyNamespaceOptions{
+			{Name: "payments", Domains: []string{"payments.example.com"}, Admins: []string{"admin@example.com"}},
+			pn,
+		}
+		assert.Error(t, o.Validate(), pn)
+	}
+}
+
+func TestOptions_GitOps(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.GitOps = &GitOpsOptions{Repository: "https://git.example.com/routes.git", Path: "routes"}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, DefaultGitOpsBranch, o.GitOps.GetBranch())
+	assert.Equal(t, DefaultGitOpsPollInterval, o.GitOps.GetPollInterval())
+
+	for _, gitOps := range []GitOpsOptions{
+		{},
+		{Repository: "--upload-pack=evil"},
+		{Repository: "https://git.example.com/routes.git", Branch: "-b"},
+		{Repository: "https://git.example.com/routes.git", Branch: "main..dev"},
+		{Repository: "https://git.example.com/routes.git", Path: "/etc"},
+		{Repository: "https://git.example.com/routes.git", Path: "routes/../.."},
+		{Repository: "https://git.example.com/routes.git", PollInterval: -time.Second},
+	} {
+		gitOps := gitOps
+		o.GitOps = &gitOps
+		assert.Error(t, o.Validate(), gitOps)
+	}
+}
+
+func TestOptions_AccessRequests(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.AccessRequests = &AccessRequestOptions{
+		Approvers: []string{"USER_ID", "Approver@example.com"},
+		SMTP:      &SMTPOptions{Address: "smtp.example.com:587", From: "Pomerium <pomerium@example.com>"},
+	}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, DefaultAccessRequestDuration, o.AccessRequests.GetDefaultDuration())
+	assert.Equal(t, DefaultAccessRequestMaxDuration, o.AccessRequests.GetMaxDuration())
+	assert.True(t, o.AccessRequests.IsApprover("USER_ID", ""))
+	assert.True(t, o.AccessRequests.IsApprover("OTHER", "approver@example.com"))
+	assert.False(t, o.AccessRequests.IsApprover("OTHER", "other@example.com"))
+	assert.Equal(t, []string{"Approver@example.com"}, o.AccessRequests.GetApproverEmails())
+
+	o.AccessRequests = &AccessRequestOptions{Approvers: []string{"USER_ID"}, MaxDuration: 30 * time.Minute}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, 30*time.Minute, o.AccessRequests.GetDefaultDuration())
+
+	for _, accessRequests := range []AccessRequestOptions{
+		{},
+		{Approvers: []string{"USER_ID"}, DefaultDuration: -time.Hour},
+		{Approvers: []string{"USER_ID"}, DefaultDuration: 2 * time.Hour, MaxDuration: time.Hour},
+		{Approvers: []string{"USER_ID"}, SMTP: &SMTPOptions{Address: "smtp.example.com", From: "pomerium@example.com"}},
+		{Approvers: []string{"USER_ID"}, SMTP: &SMTPOptions{Address: "smtp.example.com:25", From: "pomerium"}},
+	} {
+		accessRequests := accessRequests
+		o.AccessRequests = &accessRequests
+		assert.Error(t, o.Validate(), accessRequests)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes([]byte(`
+routes:
+  - from: https://from.example.com
+    to: https://to.example.com
+    timeout: 10s
+    policy:
+      - allow:
+          or:
+            - domain:
+                is: example.com
+`))
+	require.NoError(t, err)
+	if assert.Len(t, routes, 1) {
+		assert.Equal(t, "https://from.example.com", routes[0].From)
+		assert.Equal(t, 10*time.Second, *routes[0].UpstreamTimeout)
+		assert.NotNil(t, routes[0].Policy)
+	}
+
+	routes, err = ParseRoutes([]byte(`{"routes": [{"from": "https://from.example.com", "to": ["https://to.example.com"]}]}`))
+	require.NoError(t, err)
+	assert.Len(t, routes, 1)
+
+	_, err = ParseRoutes([]byte(`routes: [`))
+	assert.Error(t, err)
+}
+
+func TestOptions_PolicyRecordTypes(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SharedKey = "test"
+	o.Services = "all"
+	o.CertFile = "./testdata/example-cert.pem"
+	o.KeyFile = "./testdata/example-key.pem"
+	o.PolicyRecordTypes = []PolicyRecordTypeOptions{
+		{Name: "devices", Type: "example.com/Device"},
+	}
+	assert.NoError(t, o.Validate())
+
+	for _, prt := range []PolicyRecordTypeOptions{
+		{Name: "managed-devices", Type: "example.com/Device"},
+		{Name: "laptops"},
+		{Name: "devices", Type: "example.com/Laptop"},
+	} {
+		o.PolicyRecordTypes = []PolicyRecordTypeOptions{
+			{Name: "devices", Type: "example.com/Device"},
+			prt,
+		}
+		assert.Error(t, o.Validate(), prt)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/policy/cedar"
 )
 
 // Policy contains route specific configuration and access settings.
@@ -152,6 +153,13 @@ type Policy struct {
 	//
 	PassIdentityHeaders bool `mapstructure:"pass_identity_headers" yaml:"pass_identity_headers,omitempty"`
 
+	// JWTClaims selects the identity claims passed in the identity headers,
+	// e.g. [sub, email], so that group lists and other personal information
+	// aren't passed to upstreams which don't need them. All claims are passed
+	// when empty. The iss, aud, jti, exp and iat claims of the JWT, and the act
+	// claim of impersonated requests, are always included.
+	JWTClaims []string `mapstructure:"jwt_claims" yaml:"jwt_claims,omitempty" json:"jwt_claims,omitempty"`
+
 	// KubernetesServiceAccountToken is the kubernetes token to use for upstream requests.
 	KubernetesServiceAccountToken string `mapstructure:"kubernetes_service_account_token" yaml:"kubernetes_service_account_token,omitempty"`
 	// KubernetesServiceAccountTokenFile contains the kubernetes token to use for upstream requests.
@@ -162,6 +170,16 @@ type Policy struct {
 	EnableGoogleCloudServerlessAuthentication bool `mapstructure:"enable_google_cloud_serverless_authentication" yaml:"enable_google_cloud_serverless_authentication,omitempty"` //nolint
 
 	SubPolicies []SubPolicy `mapstructure:"sub_policies" yaml:"sub_policies,omitempty" json:"sub_policies,omitempty"`
+	// RegoModules are rego helper modules, with packages under data.lib,
+	// which the route's custom rego may import, along with the global
+	// rego_libraries.
+	RegoModules []string `mapstructure:"rego_modules" yaml:"rego_modules,omitempty" json:"rego_modules,omitempty"`
+	// PolicyBundle is the name of a policy bundle whose rego modules are
+	// evaluated along with the route's policy.
+	PolicyBundle string `mapstructure:"policy_bundle" yaml:"policy_bundle,omitempty" json:"policy_bundle,omitempty"`
+	// CedarPolicy is a set of Cedar policies which are evaluated along with
+	// the route's policy.
+	CedarPolicy string `mapstructure:"cedar_policy" yaml:"cedar_policy,omitempty" json:"cedar_policy,omitempty"`
 
 	EnvoyOpts *envoy_config_cluster_v3.Cluster `mapstructure:"_envoy_opts" yaml:"-" json:"-"`
 
@@ -175,11 +193,66 @@ type Policy struct {
 	IDPClientID string `mapstructure:"idp_client_id" yaml:"idp_client_id,omitempty"`
 	// IDPClientSecret is the client secret used for the identity provider.
 	IDPClientSecret string `mapstructure:"idp_client_secret" yaml:"idp_client_secret,omitempty"`
+	// IDPSignOut overrides the global sign out options for the identity
+	// provider of this route.
+	IDPSignOut *IDPSignOutOptions `mapstructure:"idp_sign_out" yaml:"idp_sign_out,omitempty" json:"idp_sign_out,omitempty"`
+	// IDPAuthParams are passed to the identity provider when users sign in
+	// to this route, e.g. to force reauthentication.
+	IDPAuthParams *IDPAuthParamsOptions `mapstructure:"idp_auth_params" yaml:"idp_auth_params,omitempty" json:"idp_auth_params,omitempty"`
+	// IdentityProviders are the names of the identity providers users sign
+	// in to this route with. When there are several, users choose one.
+	IdentityProviders []string `mapstructure:"identity_providers" yaml:"identity_providers,omitempty" json:"identity_providers,omitempty"`
 
 	// ShowErrorDetails indicates whether or not additional error details should be displayed.
 	ShowErrorDetails bool `mapstructure:"show_error_details" yaml:"show_error_details" json:"show_error_details"`
 
+	// CookieSameSite overrides the global SameSite attribute of the session
+	// cookie for requests to this route's host.
+	CookieSameSite string `mapstructure:"cookie_same_site" yaml:"cookie_same_site,omitempty" json:"cookie_same_site,omitempty"`
+	// CookiePath restricts the session cookie of the route's host to a path,
+	// so that routes sharing a host can have isolated sessions.
+	CookiePath string `mapstructure:"cookie_path" yaml:"cookie_path,omitempty" json:"cookie_path,omitempty"`
+	// CookieDomain overrides the global cookie domain for the route's host,
+	// so that sibling routes under one domain can have isolated sessions.
+	CookieDomain string `mapstructure:"cookie_domain" yaml:"cookie_domain,omitempty" json:"cookie_domain,omitempty"`
+
+	// SessionHeaderName is an additional header, such as Authorization, from
+	// which sessions are loaded for this route.
+	SessionHeaderName string `mapstructure:"session_header_name" yaml:"session_header_name,omitempty" json:"session_header_name,omitempty"`
+	// SessionHeaderSchemes are the accepted schemes for the session header,
+	// such as Bearer. An empty scheme accepts the raw header value.
+	SessionHeaderSchemes []string `mapstructure:"session_header_schemes" yaml:"session_header_schemes,omitempty" json:"session_header_schemes,omitempty"`
+	// SessionLoaders are the sources sessions are loaded from, in order of
+	// precedence. One of "cookie", "header" or "query_param". Defaults to all
+	// of them, in that order.
+	SessionLoaders []string `mapstructure:"session_loaders" yaml:"session_loaders,omitempty" json:"session_loaders,omitempty"`
+
+	// RequireDPoP requires requests to this route to use a session which was
+	// bound to a DPoP key (rfc9449) when its token was issued, and to include
+	// a valid proof for that key.
+	RequireDPoP bool `mapstructure:"require_dpop" yaml:"require_dpop,omitempty" json:"require_dpop,omitempty"`
+
+	// InspectRequestBody buffers request bodies to this route, up to
+	// inspect_request_body_max_bytes, so that policies can match on them.
+	InspectRequestBody bool `mapstructure:"inspect_request_body" yaml:"inspect_request_body,omitempty" json:"inspect_request_body,omitempty"`
+
+	// Quota limits the number of requests each user or service account may
+	// make to this route per day or month.
+	Quota *QuotaOptions `mapstructure:"quota" yaml:"quota,omitempty" json:"quota,omitempty"`
+
+	// RemoteOPA delegates the authorization of requests to this route to an
+	// external OPA instance.
+	RemoteOPA *RemoteOPAOptions `mapstructure:"remote_opa" yaml:"remote_opa,omitempty" json:"remote_opa,omitempty"`
+
+	// DenyResponse customizes the response to denied requests to this route.
+	DenyResponse *DenyResponseOptions `mapstructure:"deny_response" yaml:"deny_response,omitempty" json:"deny_response,omitempty"`
+
 	Policy *PPLPolicy `mapstructure:"policy" yaml:"policy,omitempty" json:"policy,omitempty"`
+
+	// ShadowPolicy is evaluated in place of Policy for every request and
+	// its result is logged, but not enforced, so that a new policy can be
+	// validated against live traffic.
+	ShadowPolicy *PPLPolicy `mapstructure:"shadow_policy" yaml:"shadow_policy,omitempty" json:"shadow_policy,omitempty"`
 }
 
 // RewriteHeader is a policy configuration option to rewrite an HTTP header.
@@ -197,6 +270,9 @@ type SubPolicy struct {
 	AllowedDomains   []string                 `mapstructure:"allowed_domains" yaml:"allowed_domains,omitempty" json:"allowed_domains,omitempty"`
 	AllowedIDPClaims identity.FlattenedClaims `mapstructure:"allowed_idp_claims" yaml:"allowed_idp_claims,omitempty" json:"allowed_idp_claims,omitempty"`
 	Rego             []string                 `mapstructure:"rego" yaml:"rego" json:"rego,omitempty"`
+	// RegoEntrypoint is the package or rule, e.g. example.authz, whose
+	// result is evaluated for the rego. It defaults to pomerium.policy.
+	RegoEntrypoint string `mapstructure:"rego_entrypoint" yaml:"rego_entrypoint,omitempty" json:"rego_entrypoint,omitempty"`
 
 	// Explanation is the explanation for why a policy failed.
 	Explanation string `mapstructure:"explanation" yaml:"explanation" json:"explanation,omitempty"`
@@ -472,6 +548,58 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("config: policy route marked accessible for any authenticated user but contains whitelists")
 	}
 
+	if _, err := ParseSameSite(p.CookieSameSite); err != nil {
+		return err
+	}
+	if p.CookiePath != "" && !strings.HasPrefix(p.CookiePath, "/") {
+		return fmt.Errorf("config: cookie_path must start with /: %s", p.CookiePath)
+	}
+	if p.CookieDomain != "" && !cookieDomainMatches(p.CookieDomain, source.Hostname()) {
+		return fmt.Errorf("config: cookie_domain %s does not match route host %s", p.CookieDomain, source.Hostname())
+	}
+
+	if len(p.SessionHeaderSchemes) > 0 && p.SessionHeaderName == "" {
+		return fmt.Errorf("config: session_header_schemes requires session_header_name")
+	}
+	for _, scheme := range p.SessionHeaderSchemes {
+		if strings.ContainsAny(scheme, " \t") {
+			return fmt.Errorf("config: invalid session header scheme: %q", scheme)
+		}
+	}
+
+	if err := p.validateSessionLoaders(); err != nil {
+		return err
+	}
+
+	if err := p.IDPSignOut.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.IDPAuthParams.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.Quota.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.RemoteOPA.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.DenyResponse.Validate(); err != nil {
+		return err
+	}
+
+	// without inspect_request_body the body is always empty
+	if !p.InspectRequestBody && p.UsesRequestBody() {
+		return fmt.Errorf("config: http_body_json requires inspect_request_body")
+	}
+
+	if len(p.IdentityProviders) > 0 && (p.IDPClientID != "" || p.IDPClientSecret != "") {
+		return fmt.Errorf("config: idp_client_id and idp_client_secret cannot be used with identity_providers")
+	}
+
 	if (p.TLSClientCert == "" && p.TLSClientKey != "") || (p.TLSClientCert != "" && p.TLSClientKey == "") ||
 		(p.TLSClientCertFile == "" && p.TLSClientKeyFile != "") || (p.TLSClientCertFile != "" && p.TLSClientKeyFile == "") {
 		return fmt.Errorf("config: client certificate key and cert both must be non-empty")
@@ -547,6 +675,18 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("config: invalid policy set_authorization_header: %v", p.SetAuthorizationHeader)
 	}
 
+	if err := validateRegoLibraries(p.RegoModules); err != nil {
+		return fmt.Errorf("config: policy rego_modules: %w", err)
+	}
+	for _, sp := range p.SubPolicies {
+		if err := validateRegoEntrypoint(sp.RegoEntrypoint); err != nil {
+			return fmt.Errorf("config: policy rego_entrypoint: %w", err)
+		}
+	}
+	if _, err := cedar.Parse(p.CedarPolicy); err != nil {
+		return fmt.Errorf("config: policy cedar_policy: %w", err)
+	}
+
 	return nil
 }
 
@@ -668,6 +808,39 @@ func (p *Policy) AllAllowedUsers() []string {
 	return aus
 }
 
+// GetRequireDPoP returns true if the policy requires DPoP proofs.
+func (p *Policy) GetRequireDPoP() bool {
+	if p == nil {
+		return false
+	}
+	return p.RequireDPoP
+}
+
+// GetQuota returns the quota of the policy.
+func (p *Policy) GetQuota() *QuotaOptions {
+	if p == nil {
+		return nil
+	}
+	return p.Quota
+}
+
+// GetDenyResponse returns the custom deny response of the policy.
+func (p *Policy) GetDenyResponse() *DenyResponseOptions {
+	if p == nil {
+		return nil
+	}
+	return p.DenyResponse
+}
+
+// GetIDPAuthParams returns the identity provider authentication request
+// parameters of the policy.
+func (p *Policy) GetIDPAuthParams() *IDPAuthParamsOptions {
+	if p == nil {
+		return nil
+	}
+	return p.IDPAuthParams
+}
+
 // GetSetAuthorizationHeader gets the set authorization header mode.
 func (p *Policy) GetSetAuthorizationHeader() configpb.Route_AuthorizationHeaderMode {
 	mode, _ := configpb.Route_AuthorizationHeaderModeFromString(p.SetAuthorizationHeader)
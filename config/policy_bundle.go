@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// DefaultPolicyBundleRefreshInterval is how often policy bundles are
+// refreshed by default.
+const DefaultPolicyBundleRefreshInterval = 5 * time.Minute
+
+var policyBundleDigestRE = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// PolicyBundleOptions configure a signed rego policy bundle, in the OPA bundle
+// format, pulled from an OCI registry. Routes evaluate the rego modules of the
+// bundle they refer to by name, along with their own policy.
+type PolicyBundleOptions struct {
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+	// Reference is the OCI reference of the bundle, e.g.
+	// ghcr.io/example/policies:latest. It may be pinned to a manifest
+	// digest with @sha256:...
+	Reference string `mapstructure:"reference" yaml:"reference,omitempty"`
+	// Digest pins the manifest digest of a tagged reference, so that the
+	// bundle only changes with the config.
+	Digest string `mapstructure:"digest" yaml:"digest,omitempty"`
+	// Username and Password are the registry credentials, if any.
+	Username string `mapstructure:"username" yaml:"username,omitempty"`
+	Password string `mapstructure:"password" yaml:"password,omitempty"`
+	// PublicKey is the base64 encoded PEM public key the bundle signature is
+	// verified with. PublicKeyFile is the path of the public key instead.
+	PublicKey     string `mapstructure:"public_key" yaml:"public_key,omitempty"`
+	PublicKeyFile string `mapstructure:"public_key_file" yaml:"public_key_file,omitempty"`
+	// KeyID is the id of the public key, "default" if unset.
+	KeyID string `mapstructure:"key_id" yaml:"key_id,omitempty"`
+	// SigningAlgorithm is the algorithm of the bundle signature, RS256 if
+	// unset.
+	SigningAlgorithm string `mapstructure:"signing_algorithm" yaml:"signing_algorithm,omitempty"`
+	// RefreshInterval is how often the bundle is checked for changes.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" yaml:"refresh_interval,omitempty"`
+}
+
+// Validate validates the policy bundle options.
+func (o *PolicyBundleOptions) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("config: policy bundle name is required")
+	}
+	if o.Reference == "" {
+		return fmt.Errorf("config: policy bundle %s reference is required", o.Name)
+	}
+	if o.Digest != "" && !policyBundleDigestRE.MatchString(o.Digest) {
+		return fmt.Errorf("config: policy bundle %s has an invalid digest: %s", o.Name, o.Digest)
+	}
+	if o.PublicKey == "" && o.PublicKeyFile == "" {
+		return fmt.Errorf("config: policy bundle %s requires a public key to verify its signature", o.Name)
+	}
+	if o.RefreshInterval < 0 {
+		return fmt.Errorf("config: policy bundle %s refresh_interval must not be negative", o.Name)
+	}
+	return nil
+}
+
+// GetPublicKey returns the PEM public key the bundle signature is verified
+// with.
+func (o *PolicyBundleOptions) GetPublicKey() (string, error) {
+	if o.PublicKey != "" {
+		bs, err := base64.StdEncoding.DecodeString(o.PublicKey)
+		if err != nil {
+			return "", fmt.Errorf("config: invalid policy bundle %s public key: %w", o.Name, err)
+		}
+		return string(bs), nil
+	}
+	bs, err := os.ReadFile(o.PublicKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("config: error reading policy bundle %s public key: %w", o.Name, err)
+	}
+	return string(bs), nil
+}
+
+// GetKeyID returns the id of the public key.
+func (o *PolicyBundleOptions) GetKeyID() string {
+	if o.KeyID == "" {
+		return "default"
+	}
+	return o.KeyID
+}
+
+// GetRefreshInterval returns how often the bundle is checked for changes.
+func (o *PolicyBundleOptions) GetRefreshInterval() time.Duration {
+	if o.RefreshInterval == 0 {
+		return DefaultPolicyBundleRefreshInterval
+	}
+	return o.RefreshInterval
+}
+
+// validatePolicyBundles validates the policy bundles and their use by
+// policies.
+func (o *Options) validatePolicyBundles() error {
+	names := make(map[string]bool)
+	for i := range o.PolicyBundles {
+		pb := &o.PolicyBundles[i]
+		if err := pb.Validate(); err != nil {
+			return err
+		}
+		if names[pb.Name] {
+			return fmt.Errorf("config: duplicate policy bundle: %s", pb.Name)
+		}
+		names[pb.Name] = true
+	}
+	for _, p := range o.GetAllPolicies() {
+		if p.PolicyBundle != "" && !names[p.PolicyBundle] {
+			return fmt.Errorf("config: policy %s refers to an unknown policy bundle: %s", p.From, p.PolicyBundle)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+)
+
+// policyNamespaceRecordIDPrefix is the prefix of the ids of the databroker
+// config records which store the routes of policy namespaces.
+const policyNamespaceRecordIDPrefix = "policy-namespace/"
+
+// policyNamespaceRouteFields are the route fields the admins of a policy
+// namespace may set. Fields which read files on the host, bypass
+// authentication, use Pomerium's own credentials or configure envoy directly
+// are reserved to the global admins.
+var policyNamespaceRouteFields = map[protoreflect.Name]bool{
+	"name":                                 true,
+	"from":                                 true,
+	"to":                                   true,
+	"load_balancing_weights":               true,
+	"redirect":                             true,
+	"allowed_users":                        true,
+	"allowed_domains":                      true,
+	"allowed_idp_claims":                   true,
+	"prefix":                               true,
+	"path":                                 true,
+	"regex":                                true,
+	"prefix_rewrite":                       true,
+	"regex_rewrite_pattern":                true,
+	"regex_rewrite_substitution":           true,
+	"cors_allow_preflight":                 true,
+	"allow_any_authenticated_user":         true,
+	"timeout":                              true,
+	"idle_timeout":                         true,
+	"allow_websockets":                     true,
+	"allow_spdy":                           true,
+	"tls_server_name":                      true,
+	"tls_upstream_server_name":             true,
+	"tls_downstream_server_name":           true,
+	"tls_custom_ca":                        true,
+	"tls_client_cert":                      true,
+	"tls_client_key":                       true,
+	"tls_downstream_client_ca":             true,
+	"set_request_headers":                  true,
+	"remove_request_headers":               true,
+	"set_response_headers":                 true,
+	"rewrite_response_headers":             true,
+	"set_authorization_header":             true,
+	"preserve_host_header":                 true,
+	"pass_identity_headers":                true,
+	"policies":                             true,
+	"id":                                   true,
+	"host_rewrite":                         true,
+	"host_rewrite_header":                  true,
+	"host_path_regex_rewrite_pattern":      true,
+	"host_path_regex_rewrite_substitution": true,
+	"show_error_details":                   true,
+}
+
+// policyNamespacePolicyFields are the fields of the policies of a route the
+// admins of a policy namespace may set. Custom rego is reserved to the global
+// admins.
+var policyNamespacePolicyFields = map[protoreflect.Name]bool{
+	"id":                 true,
+	"name":               true,
+	"allowed_users":      true,
+	"allowed_domains":    true,
+	"allowed_idp_claims": true,
+	"explanation":        true,
+	"remediation":        true,
+}
+
+// PolicyNamespaceOptions configure a policy namespace, which delegates the
+// administration of the routes of some domains to an application team. The
+// admins of a namespace manage its routes with the policy namespace API of
+// the authenticate service, without global admin rights.
+type PolicyNamespaceOptions struct {
+	// Name is the name of the namespace in the API.
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+	// Domains are the hosts the routes of the namespace may be served from.
+	// A domain starting with "*." also matches all of its subdomains.
+	Domains []string `mapstructure:"domains" yaml:"domains,omitempty"`
+	// Upstreams are the hosts the routes of the namespace may proxy to. An
+	// upstream starting with "*." also matches all of its subdomains. Without
+	// upstreams the routes of the namespace may only redirect.
+	Upstreams []string `mapstructure:"upstreams" yaml:"upstreams,omitempty"`
+	// Admins are the ids or emails of the users, including the users of
+	// service accounts, who administer the namespace.
+	Admins []string `mapstructure:"admins" yaml:"admins,omitempty"`
+}
+
+// Validate validates the policy namespace options.
+func (o *PolicyNamespaceOptions) Validate() error {
+	if !externalDataSourceNameRE.MatchString(o.Name) {
+		return fmt.Errorf("config: invalid policy namespace name: %q", o.Name)
+	}
+	if len(o.Domains) == 0 {
+		return fmt.Errorf("config: policy namespace %s requires at least one domain", o.Name)
+	}
+	for _, domain := range o.Domains {
+		if !isValidHostPattern(domain) {
+			return fmt.Errorf("config: policy namespace %s has an invalid domain: %q", o.Name, domain)
+		}
+	}
+	for _, upstream := range o.Upstreams {
+		if !isValidHostPattern(upstream) {
+			return fmt.Errorf("config: policy namespace %s has an invalid upstream: %q", o.Name, upstream)
+		}
+	}
+	if len(o.Admins) == 0 {
+		return fmt.Errorf("config: policy namespace %s requires at least one admin", o.Name)
+	}
+	return nil
+}
+
+// HasDomain returns true if routes served from the host belong to the
+// namespace. The host may itself be a wildcard.
+func (o *PolicyNamespaceOptions) HasDomain(host string) bool {
+	return matchesHostPattern(o.Domains, host)
+}
+
+// HasUpstream returns true if the routes of the namespace may proxy to the
+// host.
+func (o *PolicyNamespaceOptions) HasUpstream(host string) bool {
+	return matchesHostPattern(o.Upstreams, host)
+}
+
+// CheckRoute returns an error if the admins of the namespace may not add the
+// route. Only the fields in the allowlist may be set, the route must be
+// served from one of the domains of the namespace and may only proxy to its
+// upstreams. The fields are checked before the route is converted to a
+// policy, since validating a policy reads the files it refers to.
+func (o *PolicyNamespaceOptions) CheckRoute(pb *configpb.Route) error {
+	var err error
+	pb.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !policyNamespaceRouteFields[fd.Name()] {
+			err = fmt.Errorf("%s may not be set in namespace %s", fd.Name(), o.Name)
+		}
+		return err == nil
+	})
+	for _, sp := range pb.GetPolicies() {
+		sp.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if err == nil && !policyNamespacePolicyFields[fd.Name()] {
+				err = fmt.Errorf("policies.%s may not be set in namespace %s", fd.Name(), o.Name)
+			}
+			return err == nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	policy, err := NewPolicyFromProto(pb)
+	if err != nil {
+		return err
+	}
+	if !o.HasDomain(policy.Source.Hostname()) {
+		return fmt.Errorf("%s is not a domain of namespace %s", policy.Source.Hostname(), o.Name)
+	}
+	for _, u := range policy.To {
+		if !o.HasUpstream(u.URL.Hostname()) {
+			return fmt.Errorf("%s is not an upstream of namespace %s", u.URL.Hostname(), o.Name)
+		}
+	}
+	return nil
+}
+
+// IsAdmin returns true if the user with the id or email administers the
+// namespace.
+func (o *PolicyNamespaceOptions) IsAdmin(userID, email string) bool {
+	for _, admin := range o.Admins {
+		if (userID != "" && admin == userID) || (email != "" && strings.EqualFold(admin, email)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRecordID returns the id of the databroker config record which stores
+// the routes of the namespace.
+func (o *PolicyNamespaceOptions) GetRecordID() string {
+	return policyNamespaceRecordIDPrefix + o.Name
+}
+
+// GetPolicyNamespace returns the policy namespace with the name, or nil if
+// there is none.
+func (o *Options) GetPolicyNamespace(name string) *PolicyNamespaceOptions {
+	for i := range o.PolicyNamespaces {
+		if o.PolicyNamespaces[i].Name == name {
+			return &o.PolicyNamespaces[i]
+		}
+	}
+	return nil
+}
+
+// GetPolicyNamespaceForRecord returns the policy namespace whose routes the
+// databroker config record with the id stores. ok is false if the record
+// doesn't belong to a namespace, and the namespace is nil if it belongs to
+// one which no longer exists.
+func (o *Options) GetPolicyNamespaceForRecord(id string) (namespace *PolicyNamespaceOptions, ok bool) {
+	if !strings.HasPrefix(id, policyNamespaceRecordIDPrefix) {
+		return nil, false
+	}
+	return o.GetPolicyNamespace(strings.TrimPrefix(id, policyNamespaceRecordIDPrefix)), true
+}
+
+func isValidHostPattern(pattern string) bool {
+	host := strings.TrimPrefix(pattern, "*.")
+	return host != "" && !strings.ContainsAny(host, "*:/")
+}
+
+func matchesHostPattern(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if strings.EqualFold(host, pattern) {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && len(host) > len(pattern)-1 &&
+			strings.EqualFold(host[len(host)-len(pattern)+1:], pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) validatePolicyNamespaces() error {
+	names := make(map[string]bool)
+	for i := range o.PolicyNamespaces {
+		pn := &o.PolicyNamespaces[i]
+		if err := pn.Validate(); err != nil {
+			return err
+		}
+		if names[pn.Name] {
+			return fmt.Errorf("config: duplicate policy namespace: %s", pn.Name)
+		}
+		names[pn.Name] = true
+	}
+	return nil
+}
@@ -97,3 +97,42 @@ func (p *Policy) ToPPL() *parser.Policy {
 
 	return ppl
 }
+
+// requestBodyCriteria are the PPL criteria which match the content of request
+// bodies, which is only available with inspect_request_body.
+var requestBodyCriteria = map[string]bool{
+	"http_body_json": true,
+}
+
+// UsesRequestBody returns true if the PPL policy, or the shadow policy, of the
+// route matches the content of request bodies.
+func (p *Policy) UsesRequestBody() bool {
+	for _, ppl := range []*parser.Policy{p.ToPPL(), p.ToShadowPPL()} {
+		if ppl == nil {
+			continue
+		}
+		for _, rule := range ppl.Rules {
+			for _, criteria := range [][]parser.Criterion{rule.And, rule.Or, rule.Not, rule.Nor} {
+				for _, c := range criteria {
+					if requestBodyCriteria[c.Name] {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ToShadowPPL converts a policy, with the shadow policy in place of the
+// embedded PPL policy, into Pomerium Policy Language. If the policy has no
+// shadow policy, nil is returned.
+func (p *Policy) ToShadowPPL() *parser.Policy {
+	if p.ShadowPolicy == nil || p.ShadowPolicy.Policy == nil {
+		return nil
+	}
+
+	shadow := *p
+	shadow.Policy = p.ShadowPolicy
+	return shadow.ToPPL()
+}
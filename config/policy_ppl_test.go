@@ -568,3 +568,54 @@ else = value {
 }
 `, str)
 }
+
+func TestPolicy_ToShadowPPL(t *testing.T) {
+	userIs := func(user string) *PPLPolicy {
+		return &PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					Or: []parser.Criterion{{
+						Name: "user",
+						Data: parser.Object{"is": parser.String(user)},
+					}},
+				}},
+			},
+		}
+	}
+
+	p := &Policy{AllowedUsers: []string{"user1"}, Policy: userIs("user2")}
+	assert.Nil(t, p.ToShadowPPL())
+
+	p.ShadowPolicy = userIs("user3")
+	ppl := p.ToShadowPPL()
+	require.NotNil(t, ppl)
+	assert.Equal(t, p.ShadowPolicy.Rules[0], ppl.Rules[len(ppl.Rules)-1])
+	assert.NotContains(t, ppl.Rules, p.Policy.Rules[0])
+	assert.Equal(t, p.ToPPL().Rules[:len(ppl.Rules)-1], ppl.Rules[:len(ppl.Rules)-1],
+		"the rest of the route's policy should be unchanged")
+}
+
+func TestPolicy_UsesRequestBody(t *testing.T) {
+	bodyJSON := &PPLPolicy{
+		Policy: &parser.Policy{
+			Rules: []parser.Rule{{
+				Action: parser.ActionDeny,
+				Or: []parser.Criterion{{
+					Name:    "http_body_json",
+					SubPath: "action",
+					Data:    parser.String("delete"),
+				}},
+			}},
+		},
+	}
+
+	assert.False(t, (&Policy{AllowedUsers: []string{"user1"}}).UsesRequestBody())
+	assert.True(t, (&Policy{Policy: bodyJSON}).UsesRequestBody())
+	assert.True(t, (&Policy{ShadowPolicy: bodyJSON}).UsesRequestBody())
+
+	p := &Policy{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), Policy: bodyJSON}
+	assert.ErrorContains(t, p.Validate(), "http_body_json requires inspect_request_body")
+	p.InspectRequestBody = true
+	assert.NoError(t, p.Validate())
+}
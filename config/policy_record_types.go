@@ -0,0 +1,40 @@
+package config
+
+import "fmt"
+
+// PolicyRecordTypeOptions configure a databroker record type which authorize
+// syncs and policies refer to as data.databroker.<name>[<record id>].
+type PolicyRecordTypeOptions struct {
+	// Name is the name of the records under data.databroker. It must be a
+	// valid rego identifier.
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+	// Type is the databroker record type, e.g.
+	// type.googleapis.com/google.protobuf.Struct or example.com/Device.
+	Type string `mapstructure:"type" yaml:"type,omitempty"`
+}
+
+// Validate validates the policy record type options.
+func (o *PolicyRecordTypeOptions) Validate() error {
+	if !externalDataSourceNameRE.MatchString(o.Name) {
+		return fmt.Errorf("config: invalid policy record type name: %q", o.Name)
+	}
+	if o.Type == "" {
+		return fmt.Errorf("config: policy record type %s requires a type", o.Name)
+	}
+	return nil
+}
+
+func (o *Options) validatePolicyRecordTypes() error {
+	names := make(map[string]bool)
+	for i := range o.PolicyRecordTypes {
+		prt := &o.PolicyRecordTypes[i]
+		if err := prt.Validate(); err != nil {
+			return err
+		}
+		if names[prt.Name] {
+			return fmt.Errorf("config: duplicate policy record type: %s", prt.Name)
+		}
+		names[prt.Name] = true
+	}
+	return nil
+}
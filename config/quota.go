@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Quota periods.
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+// QuotaOptions limit the number of requests each user or service account may
+// make to a route per calendar day and month, in UTC.
+type QuotaOptions struct {
+	// Daily is the number of requests per day. There's no daily limit if 0.
+	Daily uint64 `mapstructure:"daily" yaml:"daily,omitempty" json:"daily,omitempty"`
+	// Monthly is the number of requests per month. There's no monthly limit
+	// if 0.
+	Monthly uint64 `mapstructure:"monthly" yaml:"monthly,omitempty" json:"monthly,omitempty"`
+}
+
+// Validate validates the quota options.
+func (o *QuotaOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Daily == 0 && o.Monthly == 0 {
+		return fmt.Errorf("config: quota requires a daily or monthly limit")
+	}
+	return nil
+}
+
+// GetQuotaPeriod returns the start and end of the calendar period, in UTC,
+// which contains t.
+func GetQuotaPeriod(period string, t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	switch period {
+	case QuotaPeriodMonthly:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
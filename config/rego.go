@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+var regoEntrypointRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+
+// regoLibraryRoot is the root of the packages of rego libraries, e.g.
+// data.lib.tickets.
+var regoLibraryRoot = ast.Ref{ast.DefaultRootDocument, ast.StringTerm("lib")}
+
+// validateRegoLibraries checks that the rego modules parse and that their
+// packages are under data.lib, so they can't conflict with the policies.
+func validateRegoLibraries(modules []string) error {
+	for i, src := range modules {
+		m, err := ast.ParseModule(fmt.Sprintf("library%d.rego", i), src)
+		if err != nil {
+			return fmt.Errorf("invalid rego library: %w", err)
+		}
+		if m == nil {
+			return fmt.Errorf("invalid rego library: empty module")
+		}
+		if !m.Package.Path.HasPrefix(regoLibraryRoot) {
+			return fmt.Errorf("invalid rego library: package %s must be under %s",
+				m.Package.Path, regoLibraryRoot)
+		}
+	}
+	return nil
+}
+
+// validateRegoEntrypoint checks that the entrypoint is a dotted path, e.g.
+// example.authz.
+func validateRegoEntrypoint(entrypoint string) error {
+	if entrypoint != "" && !regoEntrypointRE.MatchString(entrypoint) {
+		return fmt.Errorf("invalid rego entrypoint: %s", entrypoint)
+	}
+	return nil
+}
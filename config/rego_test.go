@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRegoLibraries(t *testing.T) {
+	assert.NoError(t, validateRegoLibraries(nil))
+	assert.NoError(t, validateRegoLibraries([]string{
+		"package lib.tickets\n\napproved := {\"T-1\"}",
+		"package lib\n\nx := 1",
+	}))
+	for _, src := range []string{
+		"",
+		"package lib.tickets\n\napproved := ",
+		"package pomerium.policy\n\nallow := true",
+		"package library\n\nx := 1",
+	} {
+		assert.Error(t, validateRegoLibraries([]string{src}), src)
+	}
+}
+
+func TestValidateRegoEntrypoint(t *testing.T) {
+	for _, entrypoint := range []string{"", "example", "example.authz", "example.authz.allow_2"} {
+		assert.NoError(t, validateRegoEntrypoint(entrypoint), entrypoint)
+	}
+	for _, entrypoint := range []string{".example", "example.", "example..authz", "example/authz", "data[0]"} {
+		assert.Error(t, validateRegoEntrypoint(entrypoint), entrypoint)
+	}
+}
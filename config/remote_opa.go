@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const defaultRemoteOPATimeout = 5 * time.Second
+
+// RemoteOPAOptions delegate the authorization of a route to an external OPA
+// instance. The policy input is posted to OPA's data API, and the result of
+// the document is merged with the route's policy like custom rego.
+type RemoteOPAOptions struct {
+	// URL is the url of the policy document in OPA's data API, e.g.
+	// http://opa:8181/v1/data/pomerium/policy.
+	URL string `mapstructure:"url" yaml:"url,omitempty" json:"url,omitempty"`
+	// BearerToken authenticates requests to OPA, if set.
+	BearerToken string `mapstructure:"bearer_token" yaml:"bearer_token,omitempty" json:"bearer_token,omitempty"`
+	// Timeout is the timeout of requests to OPA. It defaults to 5s.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Validate validates the remote OPA options.
+func (o *RemoteOPAOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("config: invalid remote_opa url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("config: remote_opa url must be an http or https url: %q", o.URL)
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("config: invalid remote_opa timeout: %s", o.Timeout)
+	}
+	return nil
+}
+
+// GetTimeout returns the timeout of requests to OPA.
+func (o *RemoteOPAOptions) GetTimeout() time.Duration {
+	if o.Timeout == 0 {
+		return defaultRemoteOPATimeout
+	}
+	return o.Timeout
+}
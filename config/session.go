@@ -1,29 +1,49 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"time"
 
 	"github.com/pomerium/pomerium/internal/encoding"
 	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/sessions/cookie"
 	"github.com/pomerium/pomerium/internal/sessions/header"
+	_ "github.com/pomerium/pomerium/internal/sessions/memcachedstore" // register the memcached session store
 	"github.com/pomerium/pomerium/internal/sessions/queryparam"
+	_ "github.com/pomerium/pomerium/internal/sessions/redisstore" // register the redis session store
 	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/sessionstore"
 )
 
+// sessionActivityRefreshInterval is the minimum amount of time between
+// updates to a session's last activity timestamp.
+const sessionActivityRefreshInterval = time.Minute
+
 // A SessionStore saves and loads sessions based on the options.
 type SessionStore struct {
-	options *Options
-	encoder encoding.MarshalUnmarshaler
-	loader  sessions.SessionLoader
+	options         *Options
+	policies        []Policy
+	encoder         encoding.MarshalUnmarshaler
+	cookieStore     sessions.SessionStore
+	headerStore     sessions.SessionLoader
+	queryParamStore sessions.SessionLoader
+	// oneTimeQueryParamStore is only set when a databroker client is
+	// available
+	oneTimeQueryParamStore sessions.SessionLoader
 }
 
-// NewSessionStore creates a new SessionStore from the Options.
-func NewSessionStore(options *Options) (*SessionStore, error) {
+// NewSessionStore creates a new SessionStore from the Options. The databroker
+// client is only used when opaque session cookies are enabled and for one-time
+// query param session tokens.
+func NewSessionStore(options *Options, dataBrokerClient databroker.DataBrokerServiceClient) (*SessionStore, error) {
 	store := &SessionStore{
-		options: options,
+		options:  options,
+		policies: options.GetAllPolicies(),
 	}
 
 	sharedKey, err := options.GetSharedKey()
@@ -36,50 +56,250 @@ func NewSessionStore(options *Options) (*SessionStore, error) {
 		return nil, fmt.Errorf("config/sessions: invalid session encoder: %w", err)
 	}
 
-	cookieStore, err := cookie.NewStore(func() cookie.Options {
+	cookieSameSite := options.GetCookieSameSite()
+	cookieOptionsByHost := options.GetCookieOptionsByHost()
+	getCookieOptions := func() cookie.Options {
 		return cookie.Options{
-			Name:     options.CookieName,
-			Domain:   options.CookieDomain,
-			Secure:   options.CookieSecure,
-			HTTPOnly: options.CookieHTTPOnly,
-			Expire:   options.CookieExpire,
+			Name:        options.CookieName,
+			Domain:      options.CookieDomain,
+			Secure:      options.CookieSecure,
+			HTTPOnly:    options.CookieHTTPOnly,
+			Expire:      options.CookieExpire,
+			Partitioned: options.CookiePartitioned,
+			SameSite:    cookieSameSite,
+			ByHost:      cookieOptionsByHost,
+			SharedKey:   sharedKey,
+		}
+	}
+	var cookieStoreType string
+	if options.SessionStore != "" {
+		cookieStoreType = options.SessionStore
+		store.cookieStore, err = options.NewRegisteredSessionStore(getCookieOptions, store.encoder)
+	} else if options.CookieOpaque {
+		cookieStoreType = "cookie_opaque"
+		store.cookieStore, err = cookie.NewOpaqueStore(getCookieOptions, store.encoder, dataBrokerClient)
+	} else if options.CookieEncrypted {
+		cookieStoreType = "cookie_encrypted"
+		var encrypter encoding.MarshalUnmarshaler
+		encrypter, err = options.GetCookieEncrypter()
+		if err != nil {
+			return nil, err
 		}
-	}, store.encoder)
+		store.cookieStore, err = cookie.NewEncryptedStore(getCookieOptions, store.encoder, encrypter)
+	} else {
+		cookieStoreType = string(SessionLoaderTypeCookie)
+		store.cookieStore, err = cookie.NewStore(getCookieOptions, store.encoder)
+	}
 	if err != nil {
 		return nil, err
 	}
-	headerStore := header.NewStore(store.encoder)
-	queryParamStore := queryparam.NewStore(store.encoder, urlutil.QuerySession)
-	store.loader = sessions.MultiSessionLoader(cookieStore, headerStore, queryParamStore)
+	store.cookieStore = sessions.NewInstrumentedStore(cookieStoreType, store.cookieStore)
+	store.headerStore = sessions.NewInstrumentedLoader(string(SessionLoaderTypeHeader),
+		header.NewStore(store.encoder, header.WithGetScheme(getSessionHeaderScheme(options))))
+	store.queryParamStore = sessions.NewInstrumentedLoader(string(SessionLoaderTypeQueryParam),
+		queryparam.NewStore(store.encoder, urlutil.QuerySession))
+	if dataBrokerClient != nil {
+		store.oneTimeQueryParamStore = sessions.NewInstrumentedStore(string(SessionLoaderTypeOneTimeQueryParam),
+			queryparam.NewOneTimeStore(store.encoder, dataBrokerClient,
+				urlutil.QuerySessionToken, queryparam.DefaultOneTimeTokenExpire))
+	}
 
 	return store, nil
 }
 
+// NewRegisteredSessionStore creates the session store registered under the
+// name given by the session_store option.
+func (o *Options) NewRegisteredSessionStore(
+	getCookieOptions cookie.GetOptionsFunc,
+	encoder encoding.MarshalUnmarshaler,
+) (sessions.SessionStore, error) {
+	constructor, ok := sessionstore.Get(o.SessionStore)
+	if !ok {
+		return nil, fmt.Errorf("config: unknown session_store: %s", o.SessionStore)
+	}
+	cookieOptions := getCookieOptions()
+	return constructor(sessionstore.Options{
+		Name:             cookieOptions.Name,
+		Expire:           cookieOptions.Expire,
+		Encoder:          encoder,
+		URL:              o.SessionStoreURL,
+		GetCookieOptions: getCookieOptions,
+	})
+}
+
 // LoadSessionState loads the session state from a request.
 func (store *SessionStore) LoadSessionState(r *http.Request) (*sessions.State, error) {
-	rawJWT, err := store.loader.LoadSession(r)
+	state, _, err := store.loadSessionState(r)
+	return state, err
+}
+
+// ExchangeSessionState loads the session state from a request. If the session
+// was loaded from a one-time query param token, which is invalidated by
+// loading it, the response headers needed to persist the session as a
+// cookie are also returned.
+func (store *SessionStore) ExchangeSessionState(r *http.Request) (*sessions.State, http.Header, error) {
+	state, loader, err := store.loadSessionState(r)
+	if err != nil || loader != SessionLoaderTypeOneTimeQueryParam {
+		return state, nil, err
+	}
+
+	rec := httptest.NewRecorder()
+	err = store.cookieStore.SaveSession(rec, r, state)
 	if err != nil {
-		return nil, err
+		return state, nil, err
+	}
+	return state, rec.Header(), nil
+}
+
+func (store *SessionStore) loadSessionState(r *http.Request) (*sessions.State, SessionLoaderType, error) {
+	// the first loader with a session takes precedence, even if it's invalid
+	rawJWT, err := "", sessions.ErrNoSessionFound
+	var loadedFrom SessionLoaderType
+	for _, loader := range store.getSessionLoaders(r) {
+		l := store.getSessionLoader(loader)
+		if l == nil {
+			continue
+		}
+		rawJWT, err = l.LoadSession(r)
+		if !errors.Is(err, sessions.ErrNoSessionFound) {
+			loadedFrom = loader
+			break
+		}
+	}
+	if err != nil {
+		return nil, "", err
 	}
 
 	var state sessions.State
 	err = store.encoder.Unmarshal([]byte(rawJWT), &state)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	// only cookie based sessions are subject to the idle timeout, as they are
+	// the only sessions whose last activity can be refreshed
+	if loadedFrom == SessionLoaderTypeCookie && state.IsIdle(store.options.SessionIdleTimeout) {
+		return nil, "", sessions.ErrIdleTimeout
 	}
 
 	// confirm that the identity provider id matches the state
 	if state.IdentityProviderID != "" {
-		idp, err := store.options.GetIdentityProviderForRequestURL(urlutil.GetAbsoluteURL(r).String())
+		idps, err := store.options.GetIdentityProvidersForRequestURL(urlutil.GetAbsoluteURL(r).String())
 		if err != nil {
-			return nil, err
+			return nil, "", err
+		}
+
+		var ok bool
+		for _, idp := range idps {
+			ok = ok || idp.GetId() == state.IdentityProviderID
+		}
+		if !ok {
+			return nil, "", fmt.Errorf("unexpected session state identity provider id: %s != %s",
+				idps[0].GetId(), state.IdentityProviderID)
+		}
+	}
+
+	return &state, loadedFrom, nil
+}
+
+// RefreshSessionState updates the last activity of a cookie based session and
+// returns the response headers needed to persist it. No headers are returned
+// when the idle timeout is disabled, the session did not come from a cookie or
+// the session was refreshed recently.
+func (store *SessionStore) RefreshSessionState(r *http.Request, state *sessions.State) (http.Header, error) {
+	if store.options.SessionIdleTimeout <= 0 {
+		return nil, nil
+	}
+	// avoid re-issuing the cookie on every request
+	if !state.IsIdle(sessionActivityRefreshInterval) {
+		return nil, nil
+	}
+	if !store.hasSessionLoader(r, SessionLoaderTypeCookie) {
+		return nil, nil
+	}
+
+	rawJWT, err := store.cookieStore.LoadSession(r)
+	if errors.Is(err, sessions.ErrNoSessionFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cookieState sessions.State
+	err = store.encoder.Unmarshal([]byte(rawJWT), &cookieState)
+	if err != nil {
+		return nil, err
+	}
+	if cookieState.ID != state.ID {
+		return nil, nil
+	}
+
+	cookieState.Touch()
+	rec := httptest.NewRecorder()
+	err = store.cookieStore.SaveSession(rec, r, &cookieState)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Header(), nil
+}
+
+// getSessionLoaders returns the session loaders of the route matching a
+// request, in order of precedence.
+func (store *SessionStore) getSessionLoaders(r *http.Request) []SessionLoaderType {
+	requestURL := urlutil.GetAbsoluteURL(r)
+	for i := range store.policies {
+		p := &store.policies[i]
+		if p.Matches(*requestURL) {
+			return p.GetSessionLoaders()
 		}
+	}
+	return DefaultSessionLoaders
+}
 
-		if idp.GetId() != state.IdentityProviderID {
-			return nil, fmt.Errorf("unexpected session state identity provider id: %s != %s",
-				idp.GetId(), state.IdentityProviderID)
+func (store *SessionStore) hasSessionLoader(r *http.Request, loader SessionLoaderType) bool {
+	for _, l := range store.getSessionLoaders(r) {
+		if l == loader {
+			return true
 		}
 	}
+	return false
+}
 
-	return &state, nil
+func (store *SessionStore) getSessionLoader(loader SessionLoaderType) sessions.SessionLoader {
+	switch loader {
+	case SessionLoaderTypeHeader:
+		return store.headerStore
+	case SessionLoaderTypeQueryParam:
+		return store.queryParamStore
+	case SessionLoaderTypeOneTimeQueryParam:
+		return store.oneTimeQueryParamStore
+	}
+	return store.cookieStore
+}
+
+// getSessionHeaderScheme returns a function which looks up the session header
+// scheme of the route matching a request.
+func getSessionHeaderScheme(options *Options) header.GetSchemeFunc {
+	policies := options.GetAllPolicies()
+	hasScheme := false
+	for i := range policies {
+		hasScheme = hasScheme || policies[i].SessionHeaderName != ""
+	}
+	if !hasScheme {
+		return nil
+	}
+
+	return func(r *http.Request) (header.Scheme, bool) {
+		requestURL := urlutil.GetAbsoluteURL(r)
+		for i := range policies {
+			p := &policies[i]
+			if p.Matches(*requestURL) {
+				return header.Scheme{
+					Header:   p.SessionHeaderName,
+					Prefixes: p.SessionHeaderSchemes,
+				}, p.SessionHeaderName != ""
+			}
+		}
+		return header.Scheme{}, false
+	}
 }
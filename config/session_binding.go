@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The SessionBindingMode specifies how violations of a session's IP and
+// User-Agent binding are handled.
+type SessionBindingMode string
+
+// SessionBindingModes
+const (
+	SessionBindingModeOff     SessionBindingMode = "off"
+	SessionBindingModeWarn    SessionBindingMode = "warn"
+	SessionBindingModeEnforce SessionBindingMode = "enforce"
+)
+
+// Default session binding IP prefix lengths.
+const (
+	DefaultSessionBindingIPv4PrefixLength = 24
+	DefaultSessionBindingIPv6PrefixLength = 64
+)
+
+// ParseSessionBindingMode parses the session binding mode. An empty string
+// results in the off mode.
+func ParseSessionBindingMode(raw string) (SessionBindingMode, error) {
+	switch SessionBindingMode(strings.TrimSpace(strings.ToLower(raw))) {
+	case "", SessionBindingModeOff:
+		return SessionBindingModeOff, nil
+	case SessionBindingModeWarn:
+		return SessionBindingModeWarn, nil
+	case SessionBindingModeEnforce:
+		return SessionBindingModeEnforce, nil
+	}
+	return SessionBindingModeOff, fmt.Errorf("invalid session binding mode: %s", raw)
+}
+
+// GetSessionBindingMode gets the session binding mode.
+func (o *Options) GetSessionBindingMode() SessionBindingMode {
+	mode, _ := ParseSessionBindingMode(string(o.SessionBinding))
+	return mode
+}
+
+func (o *Options) validateSessionBinding() error {
+	if _, err := ParseSessionBindingMode(string(o.SessionBinding)); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if o.SessionBindingIPv4PrefixLength < 0 || o.SessionBindingIPv4PrefixLength > 32 {
+		return fmt.Errorf("config: session_binding_ipv4_prefix_length must be between 0 and 32")
+	}
+	if o.SessionBindingIPv6PrefixLength < 0 || o.SessionBindingIPv6PrefixLength > 128 {
+		return fmt.Errorf("config: session_binding_ipv6_prefix_length must be between 0 and 128")
+	}
+	return nil
+}
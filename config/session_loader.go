@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The SessionLoaderType specifies a source from which sessions are loaded.
+type SessionLoaderType string
+
+// SessionLoaderTypes
+const (
+	SessionLoaderTypeCookie     SessionLoaderType = "cookie"
+	SessionLoaderTypeHeader     SessionLoaderType = "header"
+	SessionLoaderTypeQueryParam SessionLoaderType = "query_param"
+	// SessionLoaderTypeOneTimeQueryParam loads sessions from single-use
+	// tokens, which are exchanged for a session cookie on first use.
+	SessionLoaderTypeOneTimeQueryParam SessionLoaderType = "one_time_query_param"
+)
+
+// DefaultSessionLoaders are the session loaders used by routes which don't
+// specify any, in order of precedence.
+var DefaultSessionLoaders = []SessionLoaderType{
+	SessionLoaderTypeCookie,
+	SessionLoaderTypeHeader,
+	SessionLoaderTypeQueryParam,
+}
+
+// ParseSessionLoaderType parses the session loader type.
+func ParseSessionLoaderType(raw string) (SessionLoaderType, error) {
+	switch SessionLoaderType(strings.TrimSpace(strings.ToLower(raw))) {
+	case SessionLoaderTypeCookie:
+		return SessionLoaderTypeCookie, nil
+	case SessionLoaderTypeHeader:
+		return SessionLoaderTypeHeader, nil
+	case SessionLoaderTypeQueryParam:
+		return SessionLoaderTypeQueryParam, nil
+	case SessionLoaderTypeOneTimeQueryParam:
+		return SessionLoaderTypeOneTimeQueryParam, nil
+	}
+	return "", fmt.Errorf("invalid session loader: %s", raw)
+}
+
+// GetSessionLoaders gets the session loaders of the route in order of
+// precedence.
+func (p *Policy) GetSessionLoaders() []SessionLoaderType {
+	if p == nil || len(p.SessionLoaders) == 0 {
+		return DefaultSessionLoaders
+	}
+	loaders := make([]SessionLoaderType, 0, len(p.SessionLoaders))
+	for _, raw := range p.SessionLoaders {
+		if loader, err := ParseSessionLoaderType(raw); err == nil {
+			loaders = append(loaders, loader)
+		}
+	}
+	return loaders
+}
+
+func (p *Policy) validateSessionLoaders() error {
+	seen := make(map[SessionLoaderType]struct{}, len(p.SessionLoaders))
+	for _, raw := range p.SessionLoaders {
+		loader, err := ParseSessionLoaderType(raw)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		if _, ok := seen[loader]; ok {
+			return fmt.Errorf("config: duplicate session loader: %s", loader)
+		}
+		seen[loader] = struct{}{}
+	}
+	return nil
+}
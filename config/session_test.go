@@ -1,20 +1,31 @@
 package config
 
 import (
+	"context"
 	"encoding/base64"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/sessions"
+	mstore "github.com/pomerium/pomerium/internal/sessions/mock"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/sessionstore"
 )
 
 func TestSessionStore_LoadSessionState(t *testing.T) {
@@ -35,14 +46,26 @@ func TestSessionStore_LoadSessionState(t *testing.T) {
 			IDPClientSecret: "client_secret_1",
 		},
 		Policy{
-			From:            "https://p2.example.com",
-			To:              mustParseWeightedURLs(t, "https://p2"),
-			IDPClientID:     "client_id_2",
-			IDPClientSecret: "client_secret_2",
+			From:                 "https://p2.example.com",
+			To:                   mustParseWeightedURLs(t, "https://p2"),
+			IDPClientID:          "client_id_2",
+			IDPClientSecret:      "client_secret_2",
+			SessionHeaderName:    "Authorization",
+			SessionHeaderSchemes: []string{"Bearer"},
+		},
+		Policy{
+			From:           "https://p3.example.com",
+			To:             mustParseWeightedURLs(t, "https://p3"),
+			SessionLoaders: []string{"header", "cookie"},
+		},
+		Policy{
+			From:           "https://p4.example.com",
+			To:             mustParseWeightedURLs(t, "https://p4"),
+			SessionLoaders: []string{"cookie"},
 		})
 	require.NoError(t, options.Validate())
 
-	store, err := NewSessionStore(options)
+	store, err := NewSessionStore(options, nil)
 	require.NoError(t, err)
 
 	idp1, err := options.GetIdentityProviderForPolicy(nil)
@@ -111,6 +134,50 @@ func TestSessionStore_LoadSessionState(t *testing.T) {
 			IdentityProviderID: idp3.GetId(),
 		}, s))
 	})
+	t.Run("route header scheme", func(t *testing.T) {
+		rawJWS := makeJWS(t, &sessions.State{
+			Issuer:             "authenticate.example.com",
+			ID:                 "example",
+			IdentityProviderID: idp3.GetId(),
+		})
+
+		r, err := http.NewRequest(http.MethodGet, "https://p2.example.com", nil)
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+rawJWS)
+		s, err := store.LoadSessionState(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "example", s.ID)
+
+		r, err = http.NewRequest(http.MethodGet, "https://p1.example.com", nil)
+		require.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+rawJWS)
+		_, err = store.LoadSessionState(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound, "scheme should only apply to the configured route")
+	})
+	t.Run("session loader order", func(t *testing.T) {
+		cookieJWS := makeJWS(t, &sessions.State{Issuer: "authenticate.example.com", ID: "cookie"})
+		headerJWS := makeJWS(t, &sessions.State{Issuer: "authenticate.example.com", ID: "header"})
+		makeRequest := func(t *testing.T, rawURL string) *http.Request {
+			r, err := http.NewRequest(http.MethodGet, rawURL, nil)
+			require.NoError(t, err)
+			r.AddCookie(&http.Cookie{Name: options.CookieName, Value: cookieJWS})
+			r.Header.Set(httputil.HeaderPomeriumAuthorization, headerJWS)
+			return r
+		}
+
+		s, err := store.LoadSessionState(makeRequest(t, "https://p1.example.com"))
+		assert.NoError(t, err)
+		assert.Equal(t, "cookie", s.ID, "cookies should take precedence by default")
+
+		s, err = store.LoadSessionState(makeRequest(t, "https://p3.example.com"))
+		assert.NoError(t, err)
+		assert.Equal(t, "header", s.ID)
+
+		r := makeRequest(t, "https://p4.example.com")
+		r.Header.Del("Cookie")
+		_, err = store.LoadSessionState(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound, "header should be ignored")
+	})
 	t.Run("wrong idp", func(t *testing.T) {
 		rawJWS := makeJWS(t, &sessions.State{
 			Issuer:             "authenticate.example.com",
@@ -142,3 +209,271 @@ func TestSessionStore_LoadSessionState(t *testing.T) {
 		}, s))
 	})
 }
+
+func TestSessionStore_EncryptedCookie(t *testing.T) {
+	t.Parallel()
+
+	options := NewDefaultOptions()
+	options.SharedKey = base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	options.CookieSecret = base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	options.CookieEncrypted = true
+
+	store, err := NewSessionStore(options, nil)
+	require.NoError(t, err)
+
+	r, err := http.NewRequest(http.MethodGet, "https://p1.example.com", nil)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	require.NoError(t, store.cookieStore.SaveSession(rec, r, &sessions.State{
+		ID:      "example",
+		Subject: "user@example.com",
+	}))
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.NotContains(t, cookies[0].Value, base64.RawURLEncoding.EncodeToString([]byte(`"sub":"user@example.com"`)))
+
+	r.AddCookie(cookies[0])
+	s, err := store.LoadSessionState(r)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", s.Subject)
+}
+
+func TestSessionStore_Registered(t *testing.T) {
+	t.Parallel()
+
+	sharedKey := cryptutil.NewKey()
+	var got sessionstore.Options
+	sessionstore.Register("config-test", func(options sessionstore.Options) (sessionstore.SessionStore, error) {
+		got = options
+		return &mstore.Store{Session: &sessions.State{ID: "example", Subject: "user@example.com"}, Secret: sharedKey}, nil
+	})
+
+	options := NewDefaultOptions()
+	options.SharedKey = base64.StdEncoding.EncodeToString(sharedKey)
+	options.SessionStore = "config-test"
+	options.CookieDomain = "example.com"
+	options.CookieSecure = true
+	options.CookieHTTPOnly = true
+	options.CookieSameSite = "strict"
+
+	store, err := NewSessionStore(options, nil)
+	require.NoError(t, err)
+	assert.Equal(t, options.CookieName, got.Name)
+	assert.Equal(t, options.CookieExpire, got.Expire)
+	if assert.NotNil(t, got.GetCookieOptions) {
+		cookieOptions := got.GetCookieOptions()
+		assert.Equal(t, options.CookieName, cookieOptions.Name)
+		assert.Equal(t, "example.com", cookieOptions.Domain)
+		assert.True(t, cookieOptions.Secure)
+		assert.True(t, cookieOptions.HTTPOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookieOptions.SameSite)
+	}
+
+	r, err := http.NewRequest(http.MethodGet, "https://p1.example.com", nil)
+	require.NoError(t, err)
+	s, err := store.LoadSessionState(r)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", s.Subject)
+
+	options.SessionStore = "unknown"
+	_, err = NewSessionStore(options, nil)
+	assert.Error(t, err)
+}
+
+func TestSessionStore_Redis(t *testing.T) {
+	t.Parallel()
+
+	options := NewDefaultOptions()
+	options.SharedKey = base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	options.SessionStore = "redis"
+	options.SessionStoreURL = "redis://localhost:6379"
+	require.NoError(t, options.Validate())
+
+	_, err := NewSessionStore(options, nil)
+	assert.NoError(t, err)
+
+	options.SessionStoreURL = ""
+	_, err = NewSessionStore(options, nil)
+	assert.Error(t, err)
+}
+
+func TestSessionStore_Memcached(t *testing.T) {
+	t.Parallel()
+
+	options := NewDefaultOptions()
+	options.SharedKey = base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	options.SessionStore = "memcached"
+	options.SessionStoreURL = "memcached://127.0.0.1:11211,127.0.0.2:11211"
+	require.NoError(t, options.Validate())
+
+	_, err := NewSessionStore(options, nil)
+	assert.NoError(t, err)
+
+	options.SessionStoreURL = "127.0.0.1:11211"
+	_, err = NewSessionStore(options, nil)
+	assert.Error(t, err)
+}
+
+func TestSessionStore_OneTimeToken(t *testing.T) {
+	t.Parallel()
+
+	options := NewDefaultOptions()
+	options.SharedKey = base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	options.Policies = append(options.Policies,
+		Policy{
+			From:           "https://p1.example.com",
+			To:             mustParseWeightedURLs(t, "https://p1"),
+			SessionLoaders: []string{"cookie", "one_time_query_param"},
+		})
+	require.NoError(t, options.Validate())
+
+	store, err := NewSessionStore(options, newMockDataBrokerClient())
+	require.NoError(t, err)
+
+	r, err := http.NewRequest(http.MethodGet, "https://p1.example.com/", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.oneTimeQueryParamStore.(sessions.SessionStore).SaveSession(nil, r, &sessions.State{
+		ID:      "example",
+		Subject: "user@example.com",
+	}))
+	require.NotEmpty(t, r.URL.Query().Get(urlutil.QuerySessionToken))
+
+	s, hdrs, err := store.ExchangeSessionState(r)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", s.Subject)
+	require.NotEmpty(t, hdrs.Values("Set-Cookie"))
+
+	// the token can only be used once
+	_, _, err = store.ExchangeSessionState(r)
+	assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+
+	// the exchanged cookie is used instead
+	cookies := (&http.Response{Header: hdrs}).Cookies()
+	require.Len(t, cookies, 1)
+	r.AddCookie(cookies[0])
+	s, hdrs, err = store.ExchangeSessionState(r)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", s.Subject)
+	assert.Empty(t, hdrs)
+
+	// routes without the one-time loader ignore the token
+	store, err = NewSessionStore(options, nil)
+	require.NoError(t, err)
+	r, err = http.NewRequest(http.MethodGet, "https://p1.example.com/?"+urlutil.QuerySessionToken+"=TOKEN", nil)
+	require.NoError(t, err)
+	_, err = store.LoadSessionState(r)
+	assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+}
+
+type mockDataBrokerClient struct {
+	databroker.DataBrokerServiceClient
+	mu      sync.Mutex
+	records map[string]*databroker.Record
+	leases  map[string]struct{}
+}
+
+func newMockDataBrokerClient() *mockDataBrokerClient {
+	return &mockDataBrokerClient{
+		records: make(map[string]*databroker.Record),
+		leases:  make(map[string]struct{}),
+	}
+}
+
+func (m *mockDataBrokerClient) AcquireLease(_ context.Context, in *databroker.AcquireLeaseRequest, _ ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.leases[in.GetName()]; ok {
+		return nil, status.Error(codes.AlreadyExists, "lease is already taken")
+	}
+	m.leases[in.GetName()] = struct{}{}
+	return &databroker.AcquireLeaseResponse{Id: in.GetName()}, nil
+}
+
+func (m *mockDataBrokerClient) Get(_ context.Context, in *databroker.GetRequest, _ ...grpc.CallOption) (*databroker.GetResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[in.GetType()+"/"+in.GetId()]
+	if !ok || record.GetDeletedAt() != nil {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &databroker.GetResponse{Record: record}, nil
+}
+
+func (m *mockDataBrokerClient) Put(_ context.Context, in *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range in.GetRecords() {
+		m.records[record.GetType()+"/"+record.GetId()] = record
+	}
+	return &databroker.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func TestSessionStore_IdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	sharedKey := cryptutil.NewKey()
+	options := NewDefaultOptions()
+	options.SharedKey = base64.StdEncoding.EncodeToString(sharedKey)
+	options.SessionIdleTimeout = time.Hour
+
+	store, err := NewSessionStore(options, nil)
+	require.NoError(t, err)
+
+	makeRequest := func(t *testing.T, state *sessions.State) *http.Request {
+		e, err := jws.NewHS256Signer(sharedKey)
+		require.NoError(t, err)
+
+		rawJWS, err := e.Marshal(state)
+		require.NoError(t, err)
+
+		r, err := http.NewRequest(http.MethodGet, "https://p1.example.com", nil)
+		require.NoError(t, err)
+		r.AddCookie(&http.Cookie{Name: options.CookieName, Value: string(rawJWS)})
+		return r
+	}
+
+	t.Run("active", func(t *testing.T) {
+		r := makeRequest(t, &sessions.State{
+			ID:           "example",
+			IssuedAt:     jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			LastActivity: jwt.NewNumericDate(time.Now().Add(-time.Second)),
+		})
+		s, err := store.LoadSessionState(r)
+		require.NoError(t, err)
+
+		hdrs, err := store.RefreshSessionState(r, s)
+		assert.NoError(t, err)
+		assert.Empty(t, hdrs, "should not refresh a recently refreshed session")
+	})
+	t.Run("idle", func(t *testing.T) {
+		r := makeRequest(t, &sessions.State{
+			ID:           "example",
+			IssuedAt:     jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			LastActivity: jwt.NewNumericDate(time.Now().Add(-90 * time.Minute)),
+		})
+		s, err := store.LoadSessionState(r)
+		assert.ErrorIs(t, err, sessions.ErrIdleTimeout)
+		assert.Nil(t, s)
+	})
+	t.Run("refresh", func(t *testing.T) {
+		r := makeRequest(t, &sessions.State{
+			ID:           "example",
+			IssuedAt:     jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			LastActivity: jwt.NewNumericDate(time.Now().Add(-30 * time.Minute)),
+		})
+		s, err := store.LoadSessionState(r)
+		require.NoError(t, err)
+
+		hdrs, err := store.RefreshSessionState(r, s)
+		require.NoError(t, err)
+		cookies := (&http.Response{Header: hdrs}).Cookies()
+		require.Len(t, cookies, 1)
+
+		r, err = http.NewRequest(http.MethodGet, "https://p1.example.com", nil)
+		require.NoError(t, err)
+		r.AddCookie(cookies[0])
+		s, err = store.LoadSessionState(r)
+		require.NoError(t, err)
+		assert.False(t, s.IsIdle(time.Minute))
+	})
+}
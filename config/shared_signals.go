@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// SharedSignalsTransmitterOptions configure an identity provider which pushes
+// Shared Signals (CAEP and RISC) security event tokens to the authenticate
+// service.
+type SharedSignalsTransmitterOptions struct {
+	// Issuer is the iss claim of the transmitter's security event tokens.
+	Issuer string `mapstructure:"issuer" yaml:"issuer,omitempty"`
+	// JWKSURL is the https url of the keys the security event tokens are
+	// signed with.
+	JWKSURL string `mapstructure:"jwks_url" yaml:"jwks_url,omitempty"`
+	// Audience is the expected aud claim. It defaults to the authenticate
+	// service url.
+	Audience string `mapstructure:"audience" yaml:"audience,omitempty"`
+	// AuthorizationHeader, if set, is the Authorization header the
+	// transmitter authenticates its requests with.
+	AuthorizationHeader string `mapstructure:"authorization_header" yaml:"authorization_header,omitempty"`
+}
+
+// Validate validates the shared signals transmitter options.
+func (o *SharedSignalsTransmitterOptions) Validate() error {
+	if o.Issuer == "" {
+		return fmt.Errorf("config: shared signals transmitter issuer is required")
+	}
+	u, err := url.Parse(o.JWKSURL)
+	if err != nil {
+		return fmt.Errorf("config: shared signals transmitter %s has an invalid jwks_url: %w", o.Issuer, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("config: shared signals transmitter %s jwks_url must be an https url: %s", o.Issuer, o.JWKSURL)
+	}
+	return nil
+}
+
+// GetSharedSignalsTransmitter returns the shared signals transmitter with the
+// given issuer, or nil if there is none.
+func (o *Options) GetSharedSignalsTransmitter(issuer string) *SharedSignalsTransmitterOptions {
+	for i := range o.SharedSignalsTransmitters {
+		if o.SharedSignalsTransmitters[i].Issuer == issuer {
+			return &o.SharedSignalsTransmitters[i]
+		}
+	}
+	return nil
+}
+
+func (o *Options) validateSharedSignalsTransmitters() error {
+	issuers := make(map[string]bool)
+	for i := range o.SharedSignalsTransmitters {
+		sst := &o.SharedSignalsTransmitters[i]
+		if err := sst.Validate(); err != nil {
+			return err
+		}
+		if issuers[sst.Issuer] {
+			return fmt.Errorf("config: duplicate shared signals transmitter: %s", sst.Issuer)
+		}
+		issuers[sst.Issuer] = true
+	}
+	return nil
+}
@@ -15,16 +15,23 @@ import (
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/deviceposture"
 	"github.com/pomerium/pomerium/internal/events"
+	"github.com/pomerium/pomerium/internal/gitops"
 	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/healthcheck"
 	"github.com/pomerium/pomerium/internal/identity/manager"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions/webhook"
+	"github.com/pomerium/pomerium/internal/signingkey"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/version"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/envoy/files"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/registry"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
@@ -33,7 +40,11 @@ import (
 type DataBroker struct {
 	dataBrokerServer *dataBrokerServer
 	manager          *manager.Manager
+	rotator          *signingkey.Rotator
+	devicePosture    *deviceposture.Syncer
+	gitOps           *gitops.Syncer
 	eventsMgr        *events.Manager
+	healthChecker    *healthcheck.Checker
 
 	localListener       net.Listener
 	localGRPCServer     *grpc.Server
@@ -97,6 +108,7 @@ func New(cfg *config.Config, eventsMgr *events.Manager) (*DataBroker, error) {
 		localGRPCConnection: localGRPCConnection,
 		sharedKey:           sharedKeyValue,
 		eventsMgr:           eventsMgr,
+		healthChecker:       healthcheck.New(),
 	}
 	c.Register(c.localGRPCServer)
 
@@ -122,6 +134,8 @@ func (c *DataBroker) OnConfigChange(ctx context.Context, cfg *config.Config) {
 func (c *DataBroker) Register(grpcServer *grpc.Server) {
 	databroker.RegisterDataBrokerServiceServer(grpcServer, c.dataBrokerServer)
 	registry.RegisterRegistryServer(grpcServer, c.dataBrokerServer)
+	session.RegisterSessionServiceServer(grpcServer, c.dataBrokerServer)
+	user.RegisterServiceAccountServiceServer(grpcServer, c.dataBrokerServer)
 }
 
 // Run runs the databroker components.
@@ -138,6 +152,15 @@ func (c *DataBroker) Run(ctx context.Context) error {
 	eg.Go(func() error {
 		return c.manager.Run(ctx)
 	})
+	eg.Go(func() error {
+		return c.rotator.Run(ctx)
+	})
+	eg.Go(func() error {
+		return c.devicePosture.Run(ctx)
+	})
+	eg.Go(func() error {
+		return c.gitOps.Run(ctx)
+	})
 	return eg.Wait()
 }
 
@@ -159,9 +182,18 @@ func (c *DataBroker) update(ctx context.Context, cfg *config.Config) error {
 
 	dataBrokerClient := databroker.NewDataBrokerServiceClient(c.localGRPCConnection)
 
+	// sessions which fail to refresh while their identity provider is down
+	// may be kept for a grace period
+	c.healthChecker.OnConfigChange(ctx, cfg)
+
 	options := []manager.Option{
 		manager.WithDataBrokerClient(dataBrokerClient),
 		manager.WithEventManager(c.eventsMgr),
+		manager.WithIdentityProviderHealth(c.healthChecker.IsHealthy),
+	}
+
+	if cfg.Options.SessionEventsWebhookURL != "" {
+		options = append(options, manager.WithSessionLifecycleHook(webhook.New(cfg.Options.SessionEventsWebhookURL).Hook()))
 	}
 
 	if cfg.Options.Provider != "" {
@@ -173,15 +205,95 @@ func (c *DataBroker) update(ctx context.Context, cfg *config.Config) error {
 		}
 	}
 
+	// sessions created with other identity providers are refreshed with
+	// their own authenticator
+	idps, err := cfg.Options.GetAllIdentityProviders()
+	if err != nil {
+		return fmt.Errorf("databroker: invalid identity providers: %w", err)
+	}
+	if o := cfg.Options.IDPDirectorySync; o != nil {
+		options = append(options, manager.WithDirectorySyncOptions("", toDirectorySyncOptions(o)))
+	}
+	authenticators := make(map[string]manager.Authenticator, len(idps))
+	for _, idp := range idps {
+		if idp.GetType() == "" {
+			continue
+		}
+		directorySyncOptions, err := cfg.Options.GetIDPDirectorySyncOptions(idp.GetId())
+		if err != nil {
+			return fmt.Errorf("databroker: invalid directory sync options: %w", err)
+		}
+		if directorySyncOptions != nil {
+			options = append(options, manager.WithDirectorySyncOptions(idp.GetId(), toDirectorySyncOptions(directorySyncOptions)))
+		}
+		healthCheckOptions, err := cfg.Options.GetIDPHealthCheckOptions(idp.GetId())
+		if err != nil {
+			return fmt.Errorf("databroker: invalid health check options: %w", err)
+		}
+		if gracePeriod := healthCheckOptions.GetRefreshGracePeriod(); gracePeriod > 0 {
+			options = append(options, manager.WithIdentityProviderDownGracePeriod(idp.GetId(), gracePeriod))
+		}
+		idpOptions, err := cfg.Options.GetOauthOptionsForIdentityProvider(idp.GetId())
+		if err != nil {
+			return fmt.Errorf("databroker: invalid oauth options: %w", err)
+		}
+		authenticator, err := identity.NewAuthenticator(idpOptions)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("idp_id", idp.GetId()).Msg("databroker: failed to create authenticator")
+			continue
+		}
+		authenticators[idp.GetId()] = authenticator
+	}
+	options = append(options, manager.WithAuthenticators(authenticators))
+
 	if c.manager == nil {
 		c.manager = manager.New(options...)
 	} else {
 		c.manager.UpdateConfig(options...)
 	}
 
+	rotatorOptions := []signingkey.Option{
+		signingkey.WithDataBrokerClient(dataBrokerClient),
+		signingkey.WithRotationInterval(cfg.Options.SigningKeyRotationInterval),
+		signingkey.WithRotationOverlap(cfg.Options.SigningKeyRotationOverlap),
+	}
+	if c.rotator == nil {
+		c.rotator = signingkey.NewRotator(rotatorOptions...)
+	} else {
+		c.rotator.UpdateConfig(rotatorOptions...)
+	}
+
+	devicePostureOptions := []deviceposture.Option{
+		deviceposture.WithDataBrokerClient(dataBrokerClient),
+		deviceposture.WithProviders(cfg.Options.DevicePostureProviders),
+	}
+	if c.devicePosture == nil {
+		c.devicePosture = deviceposture.NewSyncer(devicePostureOptions...)
+	} else {
+		c.devicePosture.UpdateConfig(devicePostureOptions...)
+	}
+
+	gitOpsOptions := []gitops.Option{
+		gitops.WithDataBrokerClient(dataBrokerClient),
+		gitops.WithOptions(cfg.Options.GitOps),
+	}
+	if c.gitOps == nil {
+		c.gitOps = gitops.NewSyncer(gitOpsOptions...)
+	} else {
+		c.gitOps.UpdateConfig(gitOpsOptions...)
+	}
+
 	return nil
 }
 
+func toDirectorySyncOptions(o *config.IDPDirectorySyncOptions) manager.DirectorySyncOptions {
+	return manager.DirectorySyncOptions{
+		Interval:     o.Interval,
+		Jitter:       o.Jitter,
+		ErrorBackoff: o.ErrorBackoff,
+	}
+}
+
 // validate checks that proper configuration settings are set to create
 // a databroker instance
 func validate(o *config.Options) error {
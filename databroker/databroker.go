@@ -3,6 +3,8 @@ package databroker
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"google.golang.org/protobuf/types/known/emptypb"
 
@@ -18,12 +20,18 @@ import (
 type dataBrokerServer struct {
 	server    *databroker.Server
 	sharedKey *atomicutil.Value[[]byte]
+	// sessionLifetime is the maximum lifetime of a session
+	sessionLifetime *atomicutil.Value[time.Duration]
+
+	// userSessionIndexMu serializes updates to user session indexes
+	userSessionIndexMu sync.Mutex
 }
 
 // newDataBrokerServer creates a new databroker service server.
 func newDataBrokerServer(cfg *config.Config) *dataBrokerServer {
 	srv := &dataBrokerServer{
-		sharedKey: atomicutil.NewValue([]byte{}),
+		sharedKey:       atomicutil.NewValue([]byte{}),
+		sessionLifetime: atomicutil.NewValue(cfg.Options.CookieExpire),
 	}
 	srv.server = databroker.New(srv.getOptions(cfg)...)
 	srv.setKey(cfg)
@@ -34,6 +42,7 @@ func newDataBrokerServer(cfg *config.Config) *dataBrokerServer {
 func (srv *dataBrokerServer) OnConfigChange(ctx context.Context, cfg *config.Config) {
 	srv.server.UpdateConfig(srv.getOptions(cfg)...)
 	srv.setKey(cfg)
+	srv.sessionLifetime.Store(cfg.Options.CookieExpire)
 }
 
 func (srv *dataBrokerServer) getOptions(cfg *config.Config) []databroker.ServerOption {
@@ -90,7 +99,12 @@ func (srv *dataBrokerServer) Put(ctx context.Context, req *databrokerpb.PutReque
 	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
 		return nil, err
 	}
-	return srv.server.Put(ctx, req)
+	res, err := srv.server.Put(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	srv.indexUserSessions(ctx, req.GetRecords())
+	return res, nil
 }
 
 func (srv *dataBrokerServer) ReleaseLease(ctx context.Context, req *databrokerpb.ReleaseLeaseRequest) (*emptypb.Empty, error) {
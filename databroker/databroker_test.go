@@ -5,6 +5,7 @@ import (
 	"net"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,8 +31,14 @@ func init() {
 	lis = bufconn.Listen(bufSize)
 	s := grpc.NewServer()
 	internalSrv := internal_databroker.New()
-	srv := &dataBrokerServer{server: internalSrv, sharedKey: atomicutil.NewValue([]byte{})}
+	srv := &dataBrokerServer{
+		server:          internalSrv,
+		sharedKey:       atomicutil.NewValue([]byte{}),
+		sessionLifetime: atomicutil.NewValue(time.Hour),
+	}
 	databroker.RegisterDataBrokerServiceServer(s, srv)
+	session.RegisterSessionServiceServer(s, srv)
+	user.RegisterServiceAccountServiceServer(s, srv)
 
 	go func() {
 		if err := s.Serve(lis); err != nil {
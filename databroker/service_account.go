@@ -0,0 +1,211 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// Service account functions
+
+// CreateServiceAccount creates a service account for a user and returns its
+// JWT. Requests with the JWT are authorized as the user.
+func (srv *dataBrokerServer) CreateServiceAccount(ctx context.Context, req *user.CreateServiceAccountRequest) (*user.CreateServiceAccountResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetExpiresAt() != nil && !req.GetExpiresAt().AsTime().After(time.Now()) {
+		return nil, status.Error(codes.InvalidArgument, "expires_at must be in the future")
+	}
+
+	sa := &user.ServiceAccount{
+		Id:        uuid.NewString(),
+		UserId:    req.GetUserId(),
+		Audiences: req.GetAudiences(),
+		ExpiresAt: req.GetExpiresAt(),
+		IssuedAt:  timestamppb.New(time.Now().Truncate(time.Second)),
+	}
+	if req.GetDescription() != "" {
+		sa.Description = &req.Description
+	}
+	rawJWT, err := srv.putServiceAccount(ctx, sa)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx).
+		Str("service-account-id", sa.GetId()).
+		Str("user-id", sa.GetUserId()).
+		Msg("databroker: created service account")
+	return &user.CreateServiceAccountResponse{ServiceAccount: sa, Jwt: rawJWT}, nil
+}
+
+// ListServiceAccounts lists service accounts, optionally only those of a
+// user.
+func (srv *dataBrokerServer) ListServiceAccounts(ctx context.Context, req *user.ListServiceAccountsRequest) (*user.ListServiceAccountsResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	res := new(user.ListServiceAccountsResponse)
+	for offset := int64(0); ; offset += revokeSessionsQueryLimit {
+		qres, err := srv.server.Query(ctx, &databrokerpb.QueryRequest{
+			Type:   grpcutil.GetTypeURL(new(user.ServiceAccount)),
+			Offset: offset,
+			Limit:  revokeSessionsQueryLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range qres.GetRecords() {
+			var sa user.ServiceAccount
+			err = record.GetData().UnmarshalTo(&sa)
+			if err != nil {
+				log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("databroker: error unmarshaling service account")
+				continue
+			}
+			if req.GetUserId() == "" || sa.GetUserId() == req.GetUserId() {
+				res.ServiceAccounts = append(res.ServiceAccounts, &sa)
+			}
+		}
+
+		if offset+revokeSessionsQueryLimit >= qres.GetTotalCount() {
+			break
+		}
+	}
+	return res, nil
+}
+
+// RotateServiceAccount returns a new JWT for a service account. The issued at
+// time of the service account is updated, so that JWTs issued before are
+// rejected by authorize.
+func (srv *dataBrokerServer) RotateServiceAccount(ctx context.Context, req *user.RotateServiceAccountRequest) (*user.RotateServiceAccountResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	sa, err := srv.getServiceAccount(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetExpiresAt() != nil {
+		if !req.GetExpiresAt().AsTime().After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expires_at must be in the future")
+		}
+		sa.ExpiresAt = req.GetExpiresAt()
+	}
+
+	// JWT issued at times have a precision of a second, so a JWT issued
+	// within the same second as the previous one would still be accepted
+	issuedAt := time.Now().Truncate(time.Second)
+	if !issuedAt.After(sa.GetIssuedAt().AsTime()) {
+		issuedAt = sa.GetIssuedAt().AsTime().Add(time.Second)
+	}
+	sa.IssuedAt = timestamppb.New(issuedAt)
+	rawJWT, err := srv.putServiceAccount(ctx, sa)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx).
+		Str("service-account-id", sa.GetId()).
+		Str("user-id", sa.GetUserId()).
+		Msg("databroker: rotated service account")
+	return &user.RotateServiceAccountResponse{ServiceAccount: sa, Jwt: rawJWT}, nil
+}
+
+// RevokeServiceAccount deletes a service account.
+func (srv *dataBrokerServer) RevokeServiceAccount(ctx context.Context, req *user.RevokeServiceAccountRequest) (*user.RevokeServiceAccountResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	sa, err := srv.getServiceAccount(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	any := protoutil.NewAny(sa)
+	_, err = srv.server.Put(ctx, &databrokerpb.PutRequest{
+		Records: []*databrokerpb.Record{{
+			Type:      any.GetTypeUrl(),
+			Id:        sa.GetId(),
+			Data:      any,
+			DeletedAt: timestamppb.Now(),
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx).
+		Str("service-account-id", sa.GetId()).
+		Str("user-id", sa.GetUserId()).
+		Msg("databroker: revoked service account")
+	return &user.RevokeServiceAccountResponse{}, nil
+}
+
+func (srv *dataBrokerServer) getServiceAccount(ctx context.Context, serviceAccountID string) (*user.ServiceAccount, error) {
+	if serviceAccountID == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	res, err := srv.server.Get(ctx, &databrokerpb.GetRequest{
+		Type: grpcutil.GetTypeURL(new(user.ServiceAccount)),
+		Id:   serviceAccountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sa user.ServiceAccount
+	err = res.GetRecord().GetData().UnmarshalTo(&sa)
+	if err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+// putServiceAccount stores a service account and returns its JWT.
+func (srv *dataBrokerServer) putServiceAccount(ctx context.Context, sa *user.ServiceAccount) (string, error) {
+	signer, err := jws.NewHS256Signer(srv.sharedKey.Load())
+	if err != nil {
+		return "", err
+	}
+	rawJWT, err := signer.Marshal(&sessions.State{
+		ID:       sa.GetId(),
+		Subject:  sa.GetUserId(),
+		Audience: sa.GetAudiences(),
+		IssuedAt: jwt.NewNumericDate(sa.GetIssuedAt().AsTime()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("databroker: error signing service account jwt: %w", err)
+	}
+
+	_, err = srv.server.Put(ctx, &databrokerpb.PutRequest{
+		Records: []*databrokerpb.Record{databrokerpb.NewRecord(sa)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(rawJWT), nil
+}
@@ -0,0 +1,81 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := user.NewServiceAccountServiceClient(conn)
+
+	verifier, err := jws.NewHS256Signer([]byte{})
+	require.NoError(t, err)
+	parse := func(t *testing.T, rawJWT string) *sessions.State {
+		var s sessions.State
+		require.NoError(t, verifier.Unmarshal([]byte(rawJWT), &s))
+		return &s
+	}
+
+	_, err = c.CreateServiceAccount(ctx, &user.CreateServiceAccountRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.CreateServiceAccount(ctx, &user.CreateServiceAccountRequest{
+		UserId:    "sa-u1",
+		ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute)),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	created, err := c.CreateServiceAccount(ctx, &user.CreateServiceAccountRequest{
+		UserId:      "sa-u1",
+		Description: "ci",
+		Audiences:   []string{"from.example.com"},
+		ExpiresAt:   timestamppb.New(time.Now().Add(time.Hour)),
+	})
+	require.NoError(t, err)
+	sa := created.GetServiceAccount()
+	assert.Equal(t, "ci", sa.GetDescription())
+	s := parse(t, created.GetJwt())
+	assert.Equal(t, sa.GetId(), s.ID)
+	assert.Equal(t, "sa-u1", s.Subject)
+	assert.Equal(t, []string{"from.example.com"}, []string(s.Audience))
+	assert.Equal(t, sa.GetIssuedAt().AsTime().Unix(), s.IssuedAt.Time().Unix())
+
+	_, err = c.CreateServiceAccount(ctx, &user.CreateServiceAccountRequest{UserId: "sa-u2"})
+	require.NoError(t, err)
+
+	list, err := c.ListServiceAccounts(ctx, &user.ListServiceAccountsRequest{UserId: "sa-u1"})
+	require.NoError(t, err)
+	if assert.Len(t, list.GetServiceAccounts(), 1) {
+		assert.Equal(t, sa.GetId(), list.GetServiceAccounts()[0].GetId())
+	}
+
+	rotated, err := c.RotateServiceAccount(ctx, &user.RotateServiceAccountRequest{Id: sa.GetId()})
+	require.NoError(t, err)
+	assert.True(t, rotated.GetServiceAccount().GetIssuedAt().AsTime().After(sa.GetIssuedAt().AsTime()),
+		"should reject JWTs issued before the rotation")
+	assert.Equal(t, sa.GetExpiresAt().AsTime(), rotated.GetServiceAccount().GetExpiresAt().AsTime())
+	assert.Equal(t, rotated.GetServiceAccount().GetIssuedAt().AsTime().Unix(), parse(t, rotated.GetJwt()).IssuedAt.Time().Unix())
+
+	_, err = c.RevokeServiceAccount(ctx, &user.RevokeServiceAccountRequest{Id: sa.GetId()})
+	require.NoError(t, err)
+	_, err = c.RotateServiceAccount(ctx, &user.RotateServiceAccountRequest{Id: sa.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	list, err = c.ListServiceAccounts(ctx, &user.ListServiceAccountsRequest{UserId: "sa-u1"})
+	require.NoError(t, err)
+	assert.Empty(t, list.GetServiceAccounts())
+}
@@ -0,0 +1,518 @@
+package databroker
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+	"github.com/pomerium/pomerium/pkg/slices"
+)
+
+const revokeSessionsQueryLimit = 100
+
+// Session functions
+
+// RevokeSessions revokes sessions by session id, by user id or by identity
+// provider session. Revoked
+// sessions are deleted and a revocation record is stored for each of them so
+// that the authorize service can reject the sessions immediately.
+func (srv *dataBrokerServer) RevokeSessions(ctx context.Context, req *session.RevokeSessionsRequest) (*session.RevokeSessionsResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	var sessions []*session.Session
+	switch target := req.GetTarget().(type) {
+	case *session.RevokeSessionsRequest_SessionId:
+		if target.SessionId == "" {
+			return nil, status.Error(codes.InvalidArgument, "session_id is required")
+		}
+		s, err := srv.getSession(ctx, target.SessionId)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			// the session may not have been stored yet, revoke it anyway
+			s = &session.Session{Id: target.SessionId}
+		}
+		sessions = append(sessions, s)
+	case *session.RevokeSessionsRequest_UserId:
+		if target.UserId == "" {
+			return nil, status.Error(codes.InvalidArgument, "user_id is required")
+		}
+		var err error
+		sessions, err = srv.getUserSessions(ctx, target.UserId)
+		if err != nil {
+			return nil, err
+		}
+	case *session.RevokeSessionsRequest_IdentityProviderSession:
+		if target.IdentityProviderSession.GetSid() == "" {
+			return nil, status.Error(codes.InvalidArgument, "sid is required")
+		}
+		var err error
+		sessions, err = srv.getIdentityProviderSessions(ctx, target.IdentityProviderSession)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "session_id, user_id or identity_provider_session is required")
+	}
+
+	sessionIDs, err := srv.revokeSessions(ctx, sessions, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &session.RevokeSessionsResponse{SessionIds: sessionIDs}, nil
+}
+
+// SignOutAll revokes every session of a user. A user revocation is stored so
+// that sessions issued before now are rejected even if they haven't been
+// stored in the databroker, and the user's remembered devices are deleted so
+// that they can't be used to sign in again.
+func (srv *dataBrokerServer) SignOutAll(ctx context.Context, req *session.SignOutAllRequest) (*session.SignOutAllResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	sessions, err := srv.getUserSessions(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	now := timestamppb.Now()
+	revocationAny := protoutil.NewAny(&session.UserRevocation{
+		Id:        req.GetUserId(),
+		RevokedAt: now,
+		// sessions issued before now have all expired by then
+		ExpiresAt: timestamppb.New(now.AsTime().Add(srv.sessionLifetime.Load())),
+	})
+	records := []*databrokerpb.Record{{
+		Type: revocationAny.GetTypeUrl(),
+		Id:   req.GetUserId(),
+		Data: revocationAny,
+	}}
+
+	deviceIDs, err := srv.getUserRememberedDeviceIDs(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	for _, deviceID := range deviceIDs {
+		deviceAny := protoutil.NewAny(&session.RememberedDevice{Id: deviceID})
+		records = append(records, &databrokerpb.Record{
+			Type:      deviceAny.GetTypeUrl(),
+			Id:        deviceID,
+			Data:      deviceAny,
+			DeletedAt: now,
+		})
+	}
+
+	sessionIDs, err := srv.revokeSessions(ctx, sessions, records)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx).Str("user-id", req.GetUserId()).Msg("databroker: signed out user everywhere")
+	return &session.SignOutAllResponse{SessionIds: sessionIDs}, nil
+}
+
+// SyncDirectory requests the identity manager to refresh the users of an
+// identity provider now. The request is stored as a record, as the identity
+// manager only runs on the databroker holding its lease.
+func (srv *dataBrokerServer) SyncDirectory(ctx context.Context, req *session.SyncDirectoryRequest) (*session.SyncDirectoryResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	_, err := srv.Put(ctx, &databrokerpb.PutRequest{Records: []*databrokerpb.Record{
+		databrokerpb.NewRecord(&session.DirectorySync{
+			Id:          req.GetIdentityProviderId(),
+			RequestedAt: timestamppb.Now(),
+		}),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx).Str("idp_id", req.GetIdentityProviderId()).Msg("databroker: requested directory sync")
+	return &session.SyncDirectoryResponse{}, nil
+}
+
+// revokeSessions deletes the given sessions and stores a revocation record
+// for each of them, along with any additional records. Revocations expire
+// along with the session they revoke, and any expired session or user
+// revocations are pruned.
+func (srv *dataBrokerServer) revokeSessions(
+	ctx context.Context,
+	sessions []*session.Session,
+	records []*databrokerpb.Record,
+) ([]string, error) {
+	var sessionIDs []string
+	now := timestamppb.Now()
+	for _, s := range sessions {
+		sessionAny := protoutil.NewAny(s)
+		records = append(records, &databrokerpb.Record{
+			Type:      sessionAny.GetTypeUrl(),
+			Id:        s.GetId(),
+			Data:      sessionAny,
+			DeletedAt: now,
+		})
+		expiresAt := s.GetExpiresAt()
+		if expiresAt == nil {
+			// the session may not have been stored yet, so it can be used until
+			// the maximum session lifetime has passed
+			expiresAt = timestamppb.New(now.AsTime().Add(srv.sessionLifetime.Load()))
+		}
+		revocationAny := protoutil.NewAny(&session.SessionRevocation{
+			Id:        s.GetId(),
+			UserId:    s.GetUserId(),
+			RevokedAt: now,
+			ExpiresAt: expiresAt,
+		})
+		records = append(records, &databrokerpb.Record{
+			Type: revocationAny.GetTypeUrl(),
+			Id:   s.GetId(),
+			Data: revocationAny,
+		})
+		sessionIDs = append(sessionIDs, s.GetId())
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	for _, revocation := range []revocation{new(session.SessionRevocation), new(session.UserRevocation)} {
+		expired, err := srv.getExpiredRevocations(ctx, revocation, now.AsTime())
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range expired {
+			if !containsRecord(records, record) {
+				record.DeletedAt = now
+				records = append(records, record)
+			}
+		}
+	}
+
+	_, err := srv.server.Put(ctx, &databrokerpb.PutRequest{Records: records})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sessionIDs) > 0 {
+		log.Info(ctx).Strs("session-ids", sessionIDs).Msg("databroker: revoked sessions")
+	}
+	return sessionIDs, nil
+}
+
+// A revocation is a session or user revocation.
+type revocation interface {
+	proto.Message
+	GetRevokedAt() *timestamppb.Timestamp
+	GetExpiresAt() *timestamppb.Timestamp
+}
+
+// getExpiredRevocations returns the revocation records of the given type
+// which have expired. Revocations stored without an expiry expire once the
+// maximum session lifetime has passed since the revocation.
+func (srv *dataBrokerServer) getExpiredRevocations(ctx context.Context, revocation revocation, now time.Time) ([]*databrokerpb.Record, error) {
+	var records []*databrokerpb.Record
+	for offset := int64(0); ; offset += revokeSessionsQueryLimit {
+		res, err := srv.server.Query(ctx, &databrokerpb.QueryRequest{
+			Type:   grpcutil.GetTypeURL(revocation),
+			Offset: offset,
+			Limit:  revokeSessionsQueryLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range res.GetRecords() {
+			err = record.GetData().UnmarshalTo(revocation)
+			if err != nil {
+				log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("databroker: error unmarshaling revocation")
+				continue
+			}
+			expiresAt := revocation.GetRevokedAt().AsTime().Add(srv.sessionLifetime.Load())
+			if revocation.GetExpiresAt() != nil {
+				expiresAt = revocation.GetExpiresAt().AsTime()
+			}
+			if expiresAt.Before(now) {
+				records = append(records, record)
+			}
+		}
+
+		if offset+revokeSessionsQueryLimit >= res.GetTotalCount() {
+			break
+		}
+	}
+	return records, nil
+}
+
+// containsRecord returns true if a record of the same type and id as the
+// given record is in the list of records.
+func containsRecord(records []*databrokerpb.Record, record *databrokerpb.Record) bool {
+	for _, r := range records {
+		if r.GetType() == record.GetType() && r.GetId() == record.GetId() {
+			return true
+		}
+	}
+	return false
+}
+
+// ListUserSessions lists the active sessions of a user.
+func (srv *dataBrokerServer) ListUserSessions(ctx context.Context, req *session.ListUserSessionsRequest) (*session.ListUserSessionsResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load()); err != nil {
+		return nil, err
+	}
+
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	sessions, err := srv.getUserSessions(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(session.ListUserSessionsResponse)
+	for _, s := range sessions {
+		res.Sessions = append(res.Sessions, &session.SessionInfo{
+			Id:         s.GetId(),
+			UserAgent:  s.GetUserAgent(),
+			IpAddress:  s.GetIpAddress(),
+			IssuedAt:   s.GetIssuedAt(),
+			AccessedAt: s.GetAccessedAt(),
+			ExpiresAt:  s.GetExpiresAt(),
+		})
+	}
+	return res, nil
+}
+
+// getUserSessions returns the sessions of a user listed in the user's session
+// index, and prunes the ids of removed sessions from the index.
+func (srv *dataBrokerServer) getUserSessions(ctx context.Context, userID string) ([]*session.Session, error) {
+	srv.userSessionIndexMu.Lock()
+	defer srv.userSessionIndexMu.Unlock()
+
+	index, err := srv.getUserSessionIndex(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*session.Session
+	var sessionIDs []string
+	for _, sessionID := range index.GetSessionIds() {
+		s, err := srv.getSession(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		// the session was deleted or now belongs to another user
+		if s == nil || s.GetUserId() != userID {
+			continue
+		}
+
+		sessionIDs = append(sessionIDs, sessionID)
+		sessions = append(sessions, s)
+	}
+
+	// prune the ids of removed sessions
+	if len(sessionIDs) != len(index.GetSessionIds()) {
+		index.SessionIds = sessionIDs
+		err = srv.putUserSessionIndex(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sessions, nil
+}
+
+// indexUserSessions adds the ids of any stored sessions to the session index
+// of their user. Ids of deleted sessions are pruned by ListUserSessions, as
+// deleted records don't necessarily include the user id.
+func (srv *dataBrokerServer) indexUserSessions(ctx context.Context, records []*databrokerpb.Record) {
+	sessionIDsByUserID := map[string][]string{}
+	for _, record := range records {
+		if record.GetType() != grpcutil.GetTypeURL(new(session.Session)) || record.GetDeletedAt() != nil {
+			continue
+		}
+		var s session.Session
+		if err := record.GetData().UnmarshalTo(&s); err != nil || s.GetUserId() == "" {
+			continue
+		}
+		sessionIDsByUserID[s.GetUserId()] = append(sessionIDsByUserID[s.GetUserId()], record.GetId())
+	}
+	if len(sessionIDsByUserID) == 0 {
+		return
+	}
+
+	srv.userSessionIndexMu.Lock()
+	defer srv.userSessionIndexMu.Unlock()
+
+	for userID, sessionIDs := range sessionIDsByUserID {
+		index, err := srv.getUserSessionIndex(ctx, userID)
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("user-id", userID).Msg("databroker: error getting user session index")
+			continue
+		}
+
+		changed := false
+		for _, sessionID := range sessionIDs {
+			if !slices.Contains(index.SessionIds, sessionID) {
+				index.SessionIds = append(index.SessionIds, sessionID)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		err = srv.putUserSessionIndex(ctx, index)
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("user-id", userID).Msg("databroker: error updating user session index")
+		}
+	}
+}
+
+func (srv *dataBrokerServer) getUserSessionIndex(ctx context.Context, userID string) (*session.UserSessionIndex, error) {
+	res, err := srv.server.Get(ctx, &databrokerpb.GetRequest{
+		Type: grpcutil.GetTypeURL(new(session.UserSessionIndex)),
+		Id:   userID,
+	})
+	if status.Code(err) == codes.NotFound {
+		return &session.UserSessionIndex{UserId: userID}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var index session.UserSessionIndex
+	err = res.GetRecord().GetData().UnmarshalTo(&index)
+	if err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+func (srv *dataBrokerServer) putUserSessionIndex(ctx context.Context, index *session.UserSessionIndex) error {
+	any := protoutil.NewAny(index)
+	_, err := srv.server.Put(ctx, &databrokerpb.PutRequest{
+		Records: []*databrokerpb.Record{{
+			Type: any.GetTypeUrl(),
+			Id:   index.GetUserId(),
+			Data: any,
+		}},
+	})
+	return err
+}
+
+func (srv *dataBrokerServer) getSession(ctx context.Context, sessionID string) (*session.Session, error) {
+	res, err := srv.server.Get(ctx, &databrokerpb.GetRequest{
+		Type: grpcutil.GetTypeURL(new(session.Session)),
+		Id:   sessionID,
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var s session.Session
+	err = res.GetRecord().GetData().UnmarshalTo(&s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (srv *dataBrokerServer) getUserRememberedDeviceIDs(ctx context.Context, userID string) ([]string, error) {
+	var deviceIDs []string
+	for offset := int64(0); ; offset += revokeSessionsQueryLimit {
+		res, err := srv.server.Query(ctx, &databrokerpb.QueryRequest{
+			Type:   grpcutil.GetTypeURL(new(session.RememberedDevice)),
+			Offset: offset,
+			Limit:  revokeSessionsQueryLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range res.GetRecords() {
+			var device session.RememberedDevice
+			err = record.GetData().UnmarshalTo(&device)
+			if err != nil {
+				log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("databroker: error unmarshaling remembered device")
+				continue
+			}
+			if device.GetUserId() == userID {
+				deviceIDs = append(deviceIDs, device.GetId())
+			}
+		}
+
+		if offset+revokeSessionsQueryLimit >= res.GetTotalCount() {
+			break
+		}
+	}
+	return deviceIDs, nil
+}
+
+// getIdentityProviderSessions returns the sessions whose sid claim matches the
+// identity provider session.
+func (srv *dataBrokerServer) getIdentityProviderSessions(
+	ctx context.Context,
+	idpSession *session.IdentityProviderSession,
+) ([]*session.Session, error) {
+	return srv.querySessions(ctx, func(s *session.Session) bool {
+		if idpSession.GetUserId() != "" && s.GetUserId() != idpSession.GetUserId() {
+			return false
+		}
+		for _, v := range s.GetClaims()["sid"].GetValues() {
+			if v.GetStringValue() == idpSession.GetSid() {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (srv *dataBrokerServer) querySessions(ctx context.Context, match func(*session.Session) bool) ([]*session.Session, error) {
+	var sessions []*session.Session
+	for offset := int64(0); ; offset += revokeSessionsQueryLimit {
+		res, err := srv.server.Query(ctx, &databrokerpb.QueryRequest{
+			Type:   grpcutil.GetTypeURL(new(session.Session)),
+			Offset: offset,
+			Limit:  revokeSessionsQueryLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range res.GetRecords() {
+			var s session.Session
+			err = record.GetData().UnmarshalTo(&s)
+			if err != nil {
+				log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("databroker: error unmarshaling session")
+				continue
+			}
+			if match(&s) {
+				sessions = append(sessions, &s)
+			}
+		}
+
+		if offset+revokeSessionsQueryLimit >= res.GetTotalCount() {
+			break
+		}
+	}
+	return sessions, nil
+}
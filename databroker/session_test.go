@@ -0,0 +1,251 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+func TestRevokeSessions(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := databroker.NewDataBrokerServiceClient(conn)
+	sc := session.NewSessionServiceClient(conn)
+
+	for _, s := range []*session.Session{
+		{Id: "revoke-s1", UserId: "revoke-u1"},
+		{Id: "revoke-s2", UserId: "revoke-u1"},
+		{Id: "revoke-s3", UserId: "revoke-u2"},
+		{Id: "revoke-s4", UserId: "revoke-u3", Claims: identity.FlattenedClaims{"sid": {"SID1"}}.ToPB()},
+		{Id: "revoke-s5", UserId: "revoke-u3", Claims: identity.FlattenedClaims{"sid": {"SID2"}}.ToPB()},
+		{Id: "revoke-s6", UserId: "revoke-u4", Claims: identity.FlattenedClaims{"sid": {"SID2"}}.ToPB()},
+	} {
+		_, err := databroker.Put(ctx, c, s)
+		require.NoError(t, err)
+	}
+
+	isRevoked := func(t *testing.T, sessionID string) bool {
+		_, err := c.Get(ctx, &databroker.GetRequest{
+			Type: grpcutil.GetTypeURL(new(session.Session)),
+			Id:   sessionID,
+		})
+		if status.Code(err) != codes.NotFound {
+			require.NoError(t, err)
+			return false
+		}
+		res, err := c.Get(ctx, &databroker.GetRequest{
+			Type: grpcutil.GetTypeURL(new(session.SessionRevocation)),
+			Id:   sessionID,
+		})
+		require.NoError(t, err)
+		return res.GetRecord().GetDeletedAt() == nil
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := sc.RevokeSessions(ctx, &session.RevokeSessionsRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("by session id", func(t *testing.T) {
+		res, err := sc.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_SessionId{SessionId: "revoke-s3"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"revoke-s3"}, res.GetSessionIds())
+		assert.True(t, isRevoked(t, "revoke-s3"))
+		assert.False(t, isRevoked(t, "revoke-s1"))
+	})
+	t.Run("by user id", func(t *testing.T) {
+		res, err := sc.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_UserId{UserId: "revoke-u1"},
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"revoke-s1", "revoke-s2"}, res.GetSessionIds())
+		assert.True(t, isRevoked(t, "revoke-s1"))
+		assert.True(t, isRevoked(t, "revoke-s2"))
+	})
+	t.Run("by identity provider session", func(t *testing.T) {
+		res, err := sc.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_IdentityProviderSession{
+				IdentityProviderSession: &session.IdentityProviderSession{Sid: "SID2", UserId: "revoke-u3"},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"revoke-s5"}, res.GetSessionIds())
+		assert.False(t, isRevoked(t, "revoke-s4"))
+		assert.False(t, isRevoked(t, "revoke-s6"))
+
+		res, err = sc.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_IdentityProviderSession{
+				IdentityProviderSession: &session.IdentityProviderSession{Sid: "SID1"},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"revoke-s4"}, res.GetSessionIds())
+		assert.True(t, isRevoked(t, "revoke-s4"))
+	})
+	t.Run("expiry", func(t *testing.T) {
+		expiresAt := timestamppb.New(time.Now().Add(time.Minute).Truncate(time.Second))
+		_, err := databroker.Put(ctx, c, &session.Session{Id: "revoke-s7", UserId: "revoke-u5", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+		_, err = databroker.Put(ctx, c, &session.SessionRevocation{
+			Id:        "revoke-expired",
+			RevokedAt: timestamppb.New(time.Now().Add(-2 * time.Hour)),
+			ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+		})
+		require.NoError(t, err)
+		_, err = databroker.Put(ctx, c, &session.SessionRevocation{
+			Id:        "revoke-legacy",
+			RevokedAt: timestamppb.New(time.Now().Add(-2 * time.Hour)),
+		})
+		require.NoError(t, err)
+
+		_, err = sc.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_SessionId{SessionId: "revoke-s7"},
+		})
+		require.NoError(t, err)
+		assert.True(t, isRevoked(t, "revoke-s7"))
+
+		revocation := &session.SessionRevocation{Id: "revoke-s7"}
+		require.NoError(t, databroker.Get(ctx, c, revocation))
+		assert.Equal(t, expiresAt.AsTime(), revocation.GetExpiresAt().AsTime(),
+			"revocations should expire with the session")
+
+		// expired revocations are pruned
+		for _, id := range []string{"revoke-expired", "revoke-legacy"} {
+			err := databroker.Get(ctx, c, &session.SessionRevocation{Id: id})
+			assert.Equal(t, codes.NotFound, status.Code(err), id)
+		}
+	})
+}
+
+func TestListUserSessions(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := databroker.NewDataBrokerServiceClient(conn)
+	sc := session.NewSessionServiceClient(conn)
+
+	for _, s := range []*session.Session{
+		{Id: "list-s1", UserId: "list-u1", UserAgent: "ua1", IpAddress: "127.0.0.1"},
+		{Id: "list-s2", UserId: "list-u1", UserAgent: "ua2"},
+		{Id: "list-s3", UserId: "list-u2"},
+	} {
+		_, err := databroker.Put(ctx, c, s)
+		require.NoError(t, err)
+	}
+
+	listSessionIDs := func(t *testing.T, userID string) []string {
+		res, err := sc.ListUserSessions(ctx, &session.ListUserSessionsRequest{UserId: userID})
+		require.NoError(t, err)
+		var ids []string
+		for _, s := range res.GetSessions() {
+			ids = append(ids, s.GetId())
+		}
+		return ids
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := sc.ListUserSessions(ctx, &session.ListUserSessionsRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("list", func(t *testing.T) {
+		res, err := sc.ListUserSessions(ctx, &session.ListUserSessionsRequest{UserId: "list-u1"})
+		require.NoError(t, err)
+		if assert.Len(t, res.GetSessions(), 2) {
+			assert.Equal(t, "list-s1", res.GetSessions()[0].GetId())
+			assert.Equal(t, "ua1", res.GetSessions()[0].GetUserAgent())
+			assert.Equal(t, "127.0.0.1", res.GetSessions()[0].GetIpAddress())
+		}
+		assert.Equal(t, []string{"list-s3"}, listSessionIDs(t, "list-u2"))
+		assert.Empty(t, listSessionIDs(t, "list-u3"))
+	})
+	t.Run("deleted", func(t *testing.T) {
+		require.NoError(t, session.Delete(ctx, c, "list-s1"))
+		assert.Equal(t, []string{"list-s2"}, listSessionIDs(t, "list-u1"))
+
+		res, err := c.Get(ctx, &databroker.GetRequest{
+			Type: grpcutil.GetTypeURL(new(session.UserSessionIndex)),
+			Id:   "list-u1",
+		})
+		require.NoError(t, err)
+		var index session.UserSessionIndex
+		require.NoError(t, res.GetRecord().GetData().UnmarshalTo(&index))
+		assert.Equal(t, []string{"list-s2"}, index.GetSessionIds())
+	})
+}
+
+func TestSignOutAll(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := databroker.NewDataBrokerServiceClient(conn)
+	sc := session.NewSessionServiceClient(conn)
+
+	for _, s := range []*session.Session{
+		{Id: "sign-out-s1", UserId: "sign-out-u1"},
+		{Id: "sign-out-s2", UserId: "sign-out-u2"},
+	} {
+		_, err := databroker.Put(ctx, c, s)
+		require.NoError(t, err)
+	}
+	_, err = databroker.Put(ctx, c, &session.RememberedDevice{Id: "sign-out-d1", UserId: "sign-out-u1"})
+	require.NoError(t, err)
+	_, err = databroker.Put(ctx, c, &session.UserRevocation{
+		Id:        "sign-out-expired",
+		RevokedAt: timestamppb.New(time.Now().Add(-2 * time.Hour)),
+		ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+	})
+	require.NoError(t, err)
+
+	_, err = sc.SignOutAll(ctx, &session.SignOutAllRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	res, err := sc.SignOutAll(ctx, &session.SignOutAllRequest{UserId: "sign-out-u1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sign-out-s1"}, res.GetSessionIds())
+
+	revocation := &session.UserRevocation{Id: "sign-out-u1"}
+	assert.NoError(t, databroker.Get(ctx, c, revocation))
+	assert.True(t, revocation.GetRevokedAt().IsValid())
+	assert.Equal(t, time.Hour, revocation.GetExpiresAt().AsTime().Sub(revocation.GetRevokedAt().AsTime()),
+		"user revocations should expire after the maximum session lifetime")
+
+	err = databroker.Get(ctx, c, &session.UserRevocation{Id: "sign-out-expired"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "expired user revocations should be pruned")
+
+	err = databroker.Get(ctx, c, &session.RememberedDevice{Id: "sign-out-d1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NoError(t, databroker.Get(ctx, c, &session.Session{Id: "sign-out-s2"}))
+}
+
+func TestSyncDirectory(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := databroker.NewDataBrokerServiceClient(conn)
+	sc := session.NewSessionServiceClient(conn)
+
+	_, err = sc.SyncDirectory(ctx, &session.SyncDirectoryRequest{IdentityProviderId: "sync-idp1"})
+	require.NoError(t, err)
+
+	directorySync := &session.DirectorySync{Id: "sync-idp1"}
+	assert.NoError(t, databroker.Get(ctx, c, directorySync))
+	assert.True(t, directorySync.GetRequestedAt().IsValid())
+}
@@ -0,0 +1,157 @@
+// Package accessrequest implements just-in-time access: users who are denied
+// access to a route request temporary access, which approvers grant or deny
+// with a REST API or the authenticate service's pages.
+package accessrequest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// maxRecords is the maximum number of access requests which are queried.
+const maxRecords = 10000
+
+// Create stores a new pending access request.
+func Create(ctx context.Context, client databroker.DataBrokerServiceClient, req *user.AccessRequest, now time.Time) (*user.AccessRequest, error) {
+	req.Id = uuid.NewString()
+	req.State = user.AccessRequest_PENDING
+	req.CreatedAt = timestamppb.New(now)
+	req.DecidedAt, req.DecidedBy, req.ExpiresAt = nil, "", nil
+	if _, err := databroker.Put(ctx, client, req); err != nil {
+		return nil, fmt.Errorf("accessrequest: error saving access request: %w", err)
+	}
+	return req, nil
+}
+
+// Get returns the access request with the given id.
+func Get(ctx context.Context, client databroker.DataBrokerServiceClient, id string) (*user.AccessRequest, error) {
+	req := &user.AccessRequest{Id: id}
+	err := databroker.Get(ctx, client, req)
+	if status.Code(err) == codes.NotFound {
+		return nil, status.Errorf(codes.NotFound, "access request not found: %s", id)
+	} else if err != nil {
+		return nil, fmt.Errorf("accessrequest: error loading access request: %w", err)
+	}
+	return req, nil
+}
+
+// Decide approves or denies a pending access request. Approved requests
+// expire once their duration has passed.
+func Decide(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	id string,
+	approve bool,
+	approverID string,
+	now time.Time,
+) (*user.AccessRequest, error) {
+	req, err := Get(ctx, client, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetState() != user.AccessRequest_PENDING {
+		return nil, status.Errorf(codes.FailedPrecondition, "access request is already %s",
+			req.GetState().String())
+	}
+	if req.GetUserId() == approverID {
+		return nil, status.Error(codes.PermissionDenied, "users may not decide their own access requests")
+	}
+
+	req.DecidedAt = timestamppb.New(now)
+	req.DecidedBy = approverID
+	if approve {
+		req.State = user.AccessRequest_APPROVED
+		req.ExpiresAt = timestamppb.New(now.Add(req.GetDuration().AsDuration()))
+	} else {
+		req.State = user.AccessRequest_DENIED
+	}
+	if _, err := databroker.Put(ctx, client, req); err != nil {
+		return nil, fmt.Errorf("accessrequest: error saving access request: %w", err)
+	}
+	return req, nil
+}
+
+// List returns the access requests, optionally of a single user or in a
+// single state.
+func List(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	userID string,
+	state *user.AccessRequest_State,
+) ([]*user.AccessRequest, error) {
+	return query(ctx, storage.NewQuerier(client), userID, func(req *user.AccessRequest) bool {
+		return state == nil || req.GetState() == *state
+	})
+}
+
+// FindApproved returns an approved access request of the user for the route
+// which hasn't expired yet, or nil if there is none.
+func FindApproved(
+	ctx context.Context,
+	q storage.Querier,
+	userID, routeID string,
+	now time.Time,
+) (*user.AccessRequest, error) {
+	reqs, err := query(ctx, q, userID, func(req *user.AccessRequest) bool {
+		return req.GetState() == user.AccessRequest_APPROVED &&
+			req.GetRouteId() == routeID &&
+			req.GetExpiresAt().AsTime().After(now)
+	})
+	if err != nil || len(reqs) == 0 {
+		return nil, err
+	}
+	return reqs[0], nil
+}
+
+func query(
+	ctx context.Context,
+	q storage.Querier,
+	userID string,
+	filter func(req *user.AccessRequest) bool,
+) ([]*user.AccessRequest, error) {
+	res, err := q.Query(ctx, &databroker.QueryRequest{
+		Type:  grpcutil.GetTypeURL(new(user.AccessRequest)),
+		Query: userID,
+		Limit: maxRecords,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("accessrequest: error querying access requests: %w", err)
+	}
+
+	var reqs []*user.AccessRequest
+	for _, record := range res.GetRecords() {
+		req := new(user.AccessRequest)
+		if err := record.GetData().UnmarshalTo(req); err != nil {
+			continue
+		}
+		if (userID == "" || req.GetUserId() == userID) && filter(req) {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs, nil
+}
+
+// NewDuration returns the duration of an access request, which is the
+// default duration if none is given. An error is returned if the duration
+// exceeds the maximum duration.
+func NewDuration(duration, defaultDuration, maxDuration time.Duration) (*durationpb.Duration, error) {
+	if duration == 0 {
+		duration = defaultDuration
+	}
+	if duration < 0 || duration > maxDuration {
+		return nil, status.Errorf(codes.InvalidArgument, "duration must be between 0 and %s", maxDuration)
+	}
+	return durationpb.New(duration), nil
+}
@@ -0,0 +1,145 @@
+package accessrequest
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/pomerium/pomerium/config"
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func newTestDataBrokerClient(t *testing.T) databroker.DataBrokerServiceClient {
+	t.Helper()
+
+	li := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(s, internal_databroker.New())
+	go s.Serve(li)
+	t.Cleanup(s.Stop)
+	cc, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	return databroker.NewDataBrokerServiceClient(cc)
+}
+
+func TestAccessRequests(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newTestDataBrokerClient(t)
+	q := storage.NewQuerier(client)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	req, err := Create(ctx, client, &user.AccessRequest{
+		UserId:   "USER",
+		RouteUrl: "https://a.example.com",
+		RouteId:  "ROUTE",
+		Duration: durationpb.New(time.Hour),
+	}, now)
+	require.NoError(t, err)
+	assert.NotEmpty(t, req.GetId())
+	assert.Equal(t, user.AccessRequest_PENDING, req.GetState())
+
+	found, err := FindApproved(ctx, q, "USER", "ROUTE", now)
+	assert.NoError(t, err)
+	assert.Nil(t, found, "pending requests should not grant access")
+
+	_, err = Decide(ctx, client, req.GetId(), true, "USER", now)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = Decide(ctx, client, "MISSING", true, "APPROVER", now)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	req, err = Decide(ctx, client, req.GetId(), true, "APPROVER", now)
+	require.NoError(t, err)
+	assert.Equal(t, user.AccessRequest_APPROVED, req.GetState())
+	assert.Equal(t, now.Add(time.Hour), req.GetExpiresAt().AsTime())
+
+	_, err = Decide(ctx, client, req.GetId(), false, "APPROVER", now)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	found, err = FindApproved(ctx, q, "USER", "ROUTE", now.Add(time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, req.GetId(), found.GetId())
+	}
+	found, err = FindApproved(ctx, q, "USER", "OTHER", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = FindApproved(ctx, q, "OTHER", "ROUTE", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = FindApproved(ctx, q, "USER", "ROUTE", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, found, "expired requests should not grant access")
+
+	pending := user.AccessRequest_PENDING
+	reqs, err := List(ctx, client, "", &pending)
+	assert.NoError(t, err)
+	assert.Empty(t, reqs)
+	reqs, err = List(ctx, client, "USER", nil)
+	assert.NoError(t, err)
+	assert.Len(t, reqs, 1)
+}
+
+func TestNewDuration(t *testing.T) {
+	t.Parallel()
+
+	d, err := NewDuration(0, time.Hour, 8*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, d.AsDuration())
+	d, err = NewDuration(2*time.Hour, time.Hour, 8*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, d.AsDuration())
+	_, err = NewDuration(9*time.Hour, time.Hour, 8*time.Hour)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = NewDuration(-time.Hour, time.Hour, 8*time.Hour)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestNotifyApprovers(t *testing.T) {
+	var addr string
+	var to []string
+	var msg []byte
+	sendMail = func(a string, _ smtp.Auth, _ string, t []string, m []byte) error {
+		addr, to, msg = a, t, m
+		return nil
+	}
+	t.Cleanup(func() { sendMail = smtp.SendMail })
+
+	req := &user.AccessRequest{
+		Email:    "user@example.com",
+		RouteUrl: "https://a.example.com",
+		Reason:   "incident 123",
+		Duration: durationpb.New(time.Hour),
+	}
+
+	options := &config.AccessRequestOptions{Approvers: []string{"USER_ID", "approver@example.com"}}
+	assert.NoError(t, NotifyApprovers(options, req, "https://authenticate.example.com/.pomerium/access_request/1"))
+	assert.Nil(t, msg, "no mail should be sent without a mail server")
+
+	options.SMTP = &config.SMTPOptions{Address: "smtp.example.com:25", From: "pomerium@example.com"}
+	assert.NoError(t, NotifyApprovers(options, req, "https://authenticate.example.com/.pomerium/access_request/1"))
+	assert.Equal(t, "smtp.example.com:25", addr)
+	assert.Equal(t, []string{"approver@example.com"}, to)
+	assert.Contains(t, string(msg), "Subject: Access request from user@example.com\r\n")
+	assert.Contains(t, string(msg), "user@example.com requests access to https://a.example.com for 1h0m0s.")
+	assert.Contains(t, string(msg), "Reason: incident 123")
+	assert.Contains(t, string(msg), "https://authenticate.example.com/.pomerium/access_request/1")
+}
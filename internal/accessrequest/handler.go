@@ -0,0 +1,185 @@
+package accessrequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// PathPrefix is the path prefix of the access request endpoints.
+const PathPrefix = "/api/v1/access_requests"
+
+// An Authenticator returns the id and email of the user a bearer token was
+// issued to. The user id is empty if the token is invalid, expired or
+// revoked.
+type Authenticator func(ctx context.Context, token string) (userID, email string, err error)
+
+type handler struct {
+	options       *config.AccessRequestOptions
+	authenticator Authenticator
+	client        databroker.DataBrokerServiceClient
+	router        *mux.Router
+	now           func() time.Time
+}
+
+type approverKey struct{}
+
+// New creates a new access request handler. Requests must be authenticated
+// with a Pomerium session or service account JWT as a bearer token, whose
+// user is an approver.
+//
+//	GET  /api/v1/access_requests?user_id=...&state=...   lists access requests
+//	GET  /api/v1/access_requests/{id}                    returns an access request
+//	POST /api/v1/access_requests/{id}/approve            approves an access request
+//	POST /api/v1/access_requests/{id}/deny               denies an access request
+func New(options *config.AccessRequestOptions, authenticator Authenticator, client databroker.DataBrokerServiceClient) http.Handler {
+	h := &handler{
+		options:       options,
+		authenticator: authenticator,
+		client:        client,
+		now:           time.Now,
+	}
+
+	h.router = mux.NewRouter()
+	r := h.router.PathPrefix(PathPrefix).Subrouter()
+	r.Path("").Handler(handlerFunc(h.list)).Methods(http.MethodGet)
+	r.Path("/{id}").Handler(handlerFunc(h.get)).Methods(http.MethodGet)
+	r.Path("/{id}/approve").Handler(handlerFunc(h.decide(true))).Methods(http.MethodPost)
+	r.Path("/{id}/deny").Handler(handlerFunc(h.decide(false))).Methods(http.MethodPost)
+	r.NotFoundHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return status.Error(codes.NotFound, "not found")
+	})
+	r.MethodNotAllowedHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return nil
+	})
+	return h
+}
+
+// ServeHTTP serves an access request request.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	userID, email, err := h.authenticator(r.Context(), token)
+	if err != nil {
+		log.Error(r.Context()).Err(err).Msg("accessrequest: error authenticating request")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	} else if token == "" || userID == "" {
+		writeError(w, r, http.StatusUnauthorized, "invalid bearer token")
+		return
+	} else if !h.options.IsApprover(userID, email) {
+		writeError(w, r, http.StatusForbidden, "not an approver")
+		return
+	}
+	ctx := context.WithValue(r.Context(), approverKey{}, userID)
+	h.router.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) error {
+	var state *user.AccessRequest_State
+	if v := r.FormValue("state"); v != "" {
+		s, ok := user.AccessRequest_State_value[strings.ToUpper(v)]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "invalid state: %s", v)
+		}
+		state = (*user.AccessRequest_State)(&s)
+	}
+
+	reqs, err := List(r.Context(), h.client, r.FormValue("user_id"), state)
+	if err != nil {
+		return err
+	}
+
+	// there's no list message, so the requests are marshaled one by one
+	res := struct {
+		AccessRequests []json.RawMessage `json:"accessRequests"`
+	}{AccessRequests: []json.RawMessage{}}
+	for _, req := range reqs {
+		bs, err := protojson.Marshal(req)
+		if err != nil {
+			return err
+		}
+		res.AccessRequests = append(res.AccessRequests, bs)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) error {
+	req, err := Get(r.Context(), h.client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	return writeProto(w, http.StatusOK, req)
+}
+
+func (h *handler) decide(approve bool) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		approverID := r.Context().Value(approverKey{}).(string)
+		req, err := Decide(r.Context(), h.client, mux.Vars(r)["id"], approve, approverID, h.now())
+		if err != nil {
+			return err
+		}
+		log.Info(r.Context()).
+			Str("access_request_id", req.GetId()).
+			Str("user_id", req.GetUserId()).
+			Str("route_url", req.GetRouteUrl()).
+			Str("approver_id", approverID).
+			Str("state", req.GetState().String()).
+			Msg("accessrequest: decided access request")
+		return writeProto(w, http.StatusOK, req)
+	}
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f handlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := f(w, r)
+	if err == nil {
+		return
+	}
+
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		writeError(w, r, http.StatusBadRequest, status.Convert(err).Message())
+	case codes.PermissionDenied:
+		writeError(w, r, http.StatusForbidden, status.Convert(err).Message())
+	case codes.NotFound:
+		writeError(w, r, http.StatusNotFound, status.Convert(err).Message())
+	case codes.FailedPrecondition:
+		writeError(w, r, http.StatusConflict, status.Convert(err).Message())
+	default:
+		log.Error(r.Context()).Err(err).Msg("accessrequest: error handling request")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, _ *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": message})
+}
+
+func writeProto(w http.ResponseWriter, status int, msg proto.Message) error {
+	bs, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(bs)
+	return err
+}
@@ -0,0 +1,94 @@
+package accessrequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newTestDataBrokerClient(t)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := New(&config.AccessRequestOptions{Approvers: []string{"approver@example.com"}},
+		func(_ context.Context, token string) (string, string, error) {
+			switch token {
+			case "APPROVER":
+				return "approver", "approver@example.com", nil
+			case "USER":
+				return "user", "user@example.com", nil
+			}
+			return "", "", nil
+		}, client)
+	h.(*handler).now = func() time.Time { return now }
+
+	do := func(token, method, path string) (int, map[string]any) {
+		r := httptest.NewRequest(method, "https://authenticate.example.com"+PathPrefix+path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var res map[string]any
+		if w.Body.Len() > 0 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w.Code, res
+	}
+
+	req1, err := Create(ctx, client, &user.AccessRequest{UserId: "user", RouteId: "ROUTE", Duration: durationpb.New(time.Hour)}, now)
+	require.NoError(t, err)
+	req2, err := Create(ctx, client, &user.AccessRequest{UserId: "user", RouteId: "ROUTE", Duration: durationpb.New(time.Hour)}, now)
+	require.NoError(t, err)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		code, _ := do("WRONG", http.MethodGet, "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+	t.Run("forbidden", func(t *testing.T) {
+		code, _ := do("USER", http.MethodPost, "/"+req1.GetId()+"/approve")
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+	t.Run("list", func(t *testing.T) {
+		code, res := do("APPROVER", http.MethodGet, "?state=pending")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, res["accessRequests"], 2)
+
+		code, _ = do("APPROVER", http.MethodGet, "?state=unknown")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	t.Run("approve", func(t *testing.T) {
+		code, res := do("APPROVER", http.MethodPost, "/"+req1.GetId()+"/approve")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "APPROVED", res["state"])
+		assert.Equal(t, "approver", res["decidedBy"])
+		assert.Equal(t, "2023-01-01T01:00:00Z", res["expiresAt"])
+
+		code, _ = do("APPROVER", http.MethodPost, "/"+req1.GetId()+"/deny")
+		assert.Equal(t, http.StatusConflict, code)
+	})
+	t.Run("deny", func(t *testing.T) {
+		code, res := do("APPROVER", http.MethodPost, "/"+req2.GetId()+"/deny")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "DENIED", res["state"])
+
+		code, res = do("APPROVER", http.MethodGet, "/"+req2.GetId())
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "DENIED", res["state"])
+	})
+	t.Run("not found", func(t *testing.T) {
+		code, _ := do("APPROVER", http.MethodGet, "/MISSING")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
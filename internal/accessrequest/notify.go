@@ -0,0 +1,60 @@
+package accessrequest
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// sendMail is replaced in tests.
+var sendMail = smtp.SendMail
+
+// NotifyApprovers sends a mail about a new access request to the approvers
+// which are emails, with a link to the page where they approve or deny it.
+// Nothing is sent if no mail server is configured.
+func NotifyApprovers(options *config.AccessRequestOptions, req *user.AccessRequest, link string) error {
+	to := options.GetApproverEmails()
+	if options.SMTP == nil || len(to) == 0 {
+		return nil
+	}
+
+	from, err := mail.ParseAddress(options.SMTP.From)
+	if err != nil {
+		return fmt.Errorf("accessrequest: invalid from address: %w", err)
+	}
+
+	requester := req.GetEmail()
+	if requester == "" {
+		requester = req.GetUserId()
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Access request from "+requester))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%s requests access to %s for %s.\r\n\r\n", requester, req.GetRouteUrl(), req.GetDuration().AsDuration())
+	if req.GetReason() != "" {
+		fmt.Fprintf(&msg, "Reason: %s\r\n\r\n", req.GetReason())
+	}
+	fmt.Fprintf(&msg, "Approve or deny the request at %s\r\n", link)
+
+	var auth smtp.Auth
+	if options.SMTP.Username != "" {
+		host, _, _ := net.SplitHostPort(options.SMTP.Address)
+		auth = smtp.PlainAuth("", options.SMTP.Username, options.SMTP.Password, host)
+	}
+	if err := sendMail(options.SMTP.Address, auth, from.Address, to, msg.Bytes()); err != nil {
+		return fmt.Errorf("accessrequest: error sending mail: %w", err)
+	}
+	return nil
+}
@@ -65,6 +65,7 @@ type Server struct {
 
 	httpRouter      *atomicutil.Value[*mux.Router]
 	authenticateSvc Service
+	authorizeSvc    Service
 	proxySvc        Service
 
 	haveSetCapacity map[string]bool
@@ -277,6 +278,12 @@ func (srv *Server) EnableAuthenticate(svc Service) error {
 	return srv.updateRouter(srv.currentConfig.Load().Config)
 }
 
+// EnableAuthorize enables the authorize service's HTTP endpoints.
+func (srv *Server) EnableAuthorize(svc Service) error {
+	srv.authorizeSvc = svc
+	return srv.updateRouter(srv.currentConfig.Load().Config)
+}
+
 // EnableProxy enables the proxy service.
 func (srv *Server) EnableProxy(svc Service) error {
 	srv.proxySvc = svc
@@ -289,6 +296,11 @@ func (srv *Server) updateRouter(cfg *config.Config) error {
 	if err := srv.mountCommonEndpoints(httpRouter, cfg); err != nil {
 		return err
 	}
+	// the authorize endpoints are served on every host, so they are mounted
+	// before the authenticate and proxy handlers
+	if srv.authorizeSvc != nil {
+		srv.authorizeSvc.Mount(httpRouter)
+	}
 	if srv.authenticateSvc != nil {
 		seen := make(map[string]struct{})
 		// mount auth handler for both internal and external endpoints
@@ -2,16 +2,19 @@ package databroker
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/hashutil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/signingkey"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/grpc/crypt"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
@@ -24,6 +27,7 @@ type ConfigSource struct {
 	computedConfig         *config.Config
 	underlyingConfig       *config.Config
 	dbConfigs              map[string]dbConfig
+	signingKeys            map[string]*crypt.SigningKey
 	updaterHash            uint64
 	cancel                 func()
 
@@ -39,6 +43,7 @@ type dbConfig struct {
 func NewConfigSource(ctx context.Context, underlying config.Source, listeners ...config.ChangeListener) *ConfigSource {
 	src := &ConfigSource{
 		dbConfigs:              map[string]dbConfig{},
+		signingKeys:            map[string]*crypt.SigningKey{},
 		outboundGRPCConnection: new(grpc.CachedOutboundGRPClientConn),
 	}
 	for _, li := range listeners {
@@ -94,7 +99,12 @@ func (src *ConfigSource) rebuild(ctx context.Context, firstTime firstTime) {
 
 	// add all the config policies to the list
 	for id, cfgpb := range src.dbConfigs {
-		cfg.Options.ApplySettings(ctx, cfgpb.Settings)
+		// the routes of a policy namespace are managed by its admins, who
+		// may not change the settings or add routes for other domains
+		namespace, isNamespace := cfg.Options.GetPolicyNamespaceForRecord(id)
+		if !isNamespace {
+			cfg.Options.ApplySettings(ctx, cfgpb.Settings)
+		}
 		var errCount uint64
 
 		err := cfg.Options.Validate()
@@ -104,6 +114,23 @@ func (src *ConfigSource) rebuild(ctx context.Context, firstTime firstTime) {
 		}
 
 		for _, routepb := range cfgpb.GetRoutes() {
+			// the routes of a namespace are checked before they are
+			// converted, since converting a route reads the files it refers to
+			if isNamespace {
+				err := errors.New("databroker: policy namespace no longer exists")
+				if namespace != nil {
+					err = namespace.CheckRoute(routepb)
+				}
+				if err != nil {
+					errCount++
+					log.Warn(ctx).Err(err).
+						Str("db_config_id", id).
+						Str("from", routepb.GetFrom()).
+						Msg("databroker: policy is not allowed in its namespace, ignoring")
+					continue
+				}
+			}
+
 			policy, err := config.NewPolicyFromProto(routepb)
 			if err != nil {
 				errCount++
@@ -151,6 +178,15 @@ func (src *ConfigSource) rebuild(ctx context.Context, firstTime firstTime) {
 	// add the additional policies here since calling `Validate` will reset them.
 	cfg.Options.AdditionalPolicies = append(cfg.Options.AdditionalPolicies, additionalPolicies...)
 
+	// add the signing keys generated by the signing key rotator
+	if cfg.Options.SigningKeyRotationInterval > 0 {
+		keys := make([]*crypt.SigningKey, 0, len(src.signingKeys))
+		for _, key := range src.signingKeys {
+			keys = append(keys, key)
+		}
+		cfg.Options.RotatedSigningKeys = signingkey.Encode(keys)
+	}
+
 	src.computedConfig = cfg
 	if !firstTime {
 		src.Trigger(ctx, cfg)
@@ -198,6 +234,15 @@ func (src *ConfigSource) runUpdater(cfg *config.Config) {
 		src:    src,
 	}, databroker.WithTypeURL(grpcutil.GetTypeURL(new(configpb.Config))),
 		databroker.WithFastForward())
+	signingKeySyncer := databroker.NewSyncer("databroker_signing_keys", &signingKeySyncerHandler{
+		client: client,
+		src:    src,
+	}, databroker.WithTypeURL(grpcutil.GetTypeURL(new(crypt.SigningKey))),
+		databroker.WithFastForward())
+	go func() {
+		_ = grpc.WaitForReady(ctx, cc, time.Second*10)
+		_ = signingKeySyncer.Run(ctx)
+	}()
 	go func() {
 		var databrokerURLs []string
 		urls, _ := cfg.Options.GetDataBrokerURLs()
@@ -255,3 +300,45 @@ func (s *syncerHandler) UpdateRecords(ctx context.Context, serverVersion uint64,
 
 	s.src.rebuild(ctx, firstTime(false))
 }
+
+type signingKeySyncerHandler struct {
+	src    *ConfigSource
+	client databroker.DataBrokerServiceClient
+}
+
+func (s *signingKeySyncerHandler) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return s.client
+}
+
+func (s *signingKeySyncerHandler) ClearRecords(ctx context.Context) {
+	s.src.mu.Lock()
+	s.src.signingKeys = map[string]*crypt.SigningKey{}
+	s.src.mu.Unlock()
+}
+
+func (s *signingKeySyncerHandler) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	s.src.mu.Lock()
+	for _, record := range records {
+		if record.GetDeletedAt() != nil {
+			delete(s.src.signingKeys, record.GetId())
+			continue
+		}
+
+		key := new(crypt.SigningKey)
+		err := record.GetData().UnmarshalTo(key)
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("databroker: error decoding signing key")
+			delete(s.src.signingKeys, record.GetId())
+			continue
+		}
+
+		s.src.signingKeys[record.GetId()] = key
+	}
+	s.src.mu.Unlock()
+
+	s.src.rebuild(ctx, firstTime(false))
+}
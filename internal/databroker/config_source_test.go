@@ -45,6 +45,9 @@ func TestConfigSource(t *testing.T) {
 			{URL: *u},
 		}, AllowedUsers: []string{"foo@bar.com"},
 	})
+	base.PolicyNamespaces = []config.PolicyNamespaceOptions{
+		{Name: "payments", Domains: []string{"*.payments.example.com"}, Upstreams: []string{"to.example.com"}, Admins: []string{"admin@example.com"}},
+	}
 
 	baseSource := config.NewStaticSource(&config.Config{
 		OutboundPort: outboundPort,
@@ -88,6 +91,64 @@ func TestConfigSource(t *testing.T) {
 		assert.Len(t, cfg.Options.AdditionalPolicies, 1)
 	}
 
+	// namespace records may only add routes for the domains and upstreams of
+	// the namespace, which only set the allowed fields
+	data = protoutil.NewAny(&configpb.Config{
+		Name: "payments",
+		Routes: []*configpb.Route{
+			{
+				From: "https://api.payments.example.com",
+				To:   []string{"https://to.example.com"},
+			},
+			{
+				From: "https://api.example.com",
+				To:   []string{"https://to.example.com"},
+			},
+			{
+				From: "https://metadata.payments.example.com",
+				To:   []string{"http://169.254.169.254"},
+			},
+			{
+				From:              "https://key.payments.example.com",
+				To:                []string{"https://to.example.com"},
+				TlsClientCertFile: "/etc/pomerium/cert.pem",
+				TlsClientKeyFile:  "/etc/pomerium/key.pem",
+			},
+			{
+				From:                             "https://public.payments.example.com",
+				To:                               []string{"https://to.example.com"},
+				AllowPublicUnauthenticatedAccess: true,
+			},
+			{
+				From:     "https://rego.payments.example.com",
+				To:       []string{"https://to.example.com"},
+				Policies: []*configpb.Policy{{Rego: []string{"package pomerium.policy\nallow := true"}}},
+			},
+		},
+		Settings: &configpb.Settings{
+			CookieName: proto.String("other"),
+		},
+	})
+	_, _ = dataBrokerServer.Put(ctx, &databroker.PutRequest{
+		Records: []*databroker.Record{{
+			Type: data.TypeUrl,
+			Id:   "policy-namespace/payments",
+			Data: data,
+		}},
+	})
+
+	select {
+	case <-ctx.Done():
+		assert.NoError(t, ctx.Err())
+		return
+	case cfg := <-cfgs:
+		if assert.Len(t, cfg.Options.AdditionalPolicies, 2) {
+			froms := []string{cfg.Options.AdditionalPolicies[0].From, cfg.Options.AdditionalPolicies[1].From}
+			assert.ElementsMatch(t, []string{"https://from.example.com", "https://api.payments.example.com"}, froms)
+		}
+		assert.Equal(t, base.CookieName, cfg.Options.CookieName)
+	}
+
 	baseSource.SetConfig(ctx, &config.Config{
 		OutboundPort: outboundPort,
 		Options:      base,
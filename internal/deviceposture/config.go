@@ -0,0 +1,55 @@
+package deviceposture
+
+import (
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type syncerConfig struct {
+	dataBrokerClient databroker.DataBrokerServiceClient
+	providers        []config.DevicePostureProviderOptions
+	newProvider      func(*config.DevicePostureProviderOptions) (Provider, error)
+	now              func() time.Time
+}
+
+func newSyncerConfig(options ...Option) *syncerConfig {
+	cfg := new(syncerConfig)
+	WithNow(time.Now)(cfg)
+	withNewProvider(NewProvider)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// An Option customizes the configuration used for the device posture syncer.
+type Option func(*syncerConfig)
+
+// WithDataBrokerClient sets the databroker client in the config.
+func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
+	return func(cfg *syncerConfig) {
+		cfg.dataBrokerClient = dataBrokerClient
+	}
+}
+
+// WithProviders sets the device posture providers to sync.
+func WithProviders(providers []config.DevicePostureProviderOptions) Option {
+	return func(cfg *syncerConfig) {
+		cfg.providers = providers
+	}
+}
+
+// WithNow customizes the time.Now function used by the syncer.
+func WithNow(now func() time.Time) Option {
+	return func(cfg *syncerConfig) {
+		cfg.now = now
+	}
+}
+
+func withNewProvider(newProvider func(*config.DevicePostureProviderOptions) (Provider, error)) Option {
+	return func(cfg *syncerConfig) {
+		cfg.newProvider = newProvider
+	}
+}
@@ -0,0 +1,155 @@
+package deviceposture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+const (
+	defaultCrowdStrikeURL = "https://api.crowdstrike.com"
+	// https://falcon.crowdstrike.com/documentation/page/a2a7fc0e/crowdstrike-oauth2-based-apis
+	crowdStrikeHostsScrollPath = "/devices/queries/devices-scroll/v1"
+	crowdStrikeHostsPath       = "/devices/entities/devices/v2"
+	crowdStrikeAssessmentsPath = "/zero-trust-assessment/entities/assessments/v1"
+	crowdStrikePageSize        = 100
+)
+
+type crowdStrikeHost struct {
+	DeviceID      string    `json:"device_id"`
+	Hostname      string    `json:"hostname"`
+	PlatformName  string    `json:"platform_name"`
+	OSVersion     string    `json:"os_version"`
+	LastSeen      time.Time `json:"last_seen"`
+	LastLoginUser string    `json:"last_login_user"`
+	Status        string    `json:"status"`
+}
+
+type crowdStrikeAssessment struct {
+	AID        string `json:"aid"`
+	Assessment struct {
+		Overall int32 `json:"overall"`
+	} `json:"assessment"`
+}
+
+// crowdStrike lists the hosts of CrowdStrike Falcon. Every host with a sensor
+// is managed, and compliant unless it is network contained. The score is the
+// host's Zero Trust Assessment, if available. Hosts are matched to users by
+// the last login user, so only hosts whose users sign in with an email
+// address are listed.
+type crowdStrike struct {
+	client *http.Client
+	url    string
+}
+
+func newCrowdStrike(o *config.DevicePostureProviderOptions) *crowdStrike {
+	apiURL := o.URL
+	if apiURL == "" {
+		apiURL = defaultCrowdStrikeURL
+	}
+	return &crowdStrike{
+		client: newClient(&clientcredentials.Config{
+			ClientID:     o.ClientID,
+			ClientSecret: o.ClientSecret,
+			TokenURL:     urlutil.Join(apiURL, "/oauth2/token"),
+			AuthStyle:    oauth2.AuthStyleInParams,
+		}),
+		url: apiURL,
+	}
+}
+
+func (p *crowdStrike) ListDevices(ctx context.Context) (map[string][]*device.Posture_Device, error) {
+	devices := make(map[string][]*device.Posture_Device)
+	offset := ""
+	for {
+		q := url.Values{"limit": {fmt.Sprint(crowdStrikePageSize)}}
+		if offset != "" {
+			q.Set("offset", offset)
+		}
+		var response struct {
+			Resources []string `json:"resources"`
+			Meta      struct {
+				Pagination struct {
+					Offset string `json:"offset"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		err := getJSON(ctx, p.client, urlutil.Join(p.url, crowdStrikeHostsScrollPath)+"?"+q.Encode(), &response)
+		if err != nil {
+			return nil, fmt.Errorf("deviceposture/crowdstrike: error listing hosts: %w", err)
+		}
+		if len(response.Resources) == 0 {
+			return devices, nil
+		}
+
+		if err := p.addHosts(ctx, devices, response.Resources); err != nil {
+			return nil, err
+		}
+
+		offset = response.Meta.Pagination.Offset
+		if offset == "" {
+			return devices, nil
+		}
+	}
+}
+
+func (p *crowdStrike) addHosts(ctx context.Context, devices map[string][]*device.Posture_Device, ids []string) error {
+	q := url.Values{"ids": ids}
+
+	var hosts struct {
+		Resources []crowdStrikeHost `json:"resources"`
+	}
+	err := getJSON(ctx, p.client, urlutil.Join(p.url, crowdStrikeHostsPath)+"?"+q.Encode(), &hosts)
+	if err != nil {
+		return fmt.Errorf("deviceposture/crowdstrike: error getting hosts: %w", err)
+	}
+
+	// Zero Trust Assessment requires its own subscription, so without it
+	// hosts don't have a score
+	scores := make(map[string]int32)
+	var assessments struct {
+		Resources []crowdStrikeAssessment `json:"resources"`
+	}
+	err = getJSON(ctx, p.client, urlutil.Join(p.url, crowdStrikeAssessmentsPath)+"?"+q.Encode(), &assessments)
+	var se statusError
+	if errors.As(err, &se) && (se == http.StatusForbidden || se == http.StatusNotFound) {
+		log.Debug(ctx).Err(err).Msg("deviceposture/crowdstrike: zero trust assessments are unavailable")
+	} else if err != nil {
+		return fmt.Errorf("deviceposture/crowdstrike: error getting zero trust assessments: %w", err)
+	}
+	for _, a := range assessments.Resources {
+		scores[a.AID] = a.Assessment.Overall
+	}
+
+	for _, h := range hosts.Resources {
+		d := &device.Posture_Device{
+			Id:        h.DeviceID,
+			Name:      h.Hostname,
+			Os:        h.PlatformName,
+			OsVersion: h.OSVersion,
+			Managed:   true,
+			Compliant: h.Status == "normal",
+		}
+		if score, ok := scores[h.DeviceID]; ok {
+			d.Score = proto.Int32(score)
+		}
+		if !h.LastSeen.IsZero() {
+			d.LastSeenAt = timestamppb.New(h.LastSeen)
+		}
+		addDevice(devices, h.LastLoginUser, d)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package deviceposture
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+func TestCrowdStrike(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	lastSeen := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	hosts := map[string]map[string]any{
+		"h1": {
+			"device_id": "h1", "hostname": "laptop", "platform_name": "Mac", "os_version": "Ventura (13)",
+			"last_seen": lastSeen, "last_login_user": "user@example.com", "status": "normal",
+		},
+		"h2": {
+			"device_id": "h2", "hostname": "desktop", "platform_name": "Windows",
+			"last_login_user": "user@example.com", "status": "contained",
+		},
+		"h3": {
+			"device_id": "h3", "hostname": "server", "platform_name": "Linux",
+			"last_login_user": "root", "status": "normal",
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth2/token" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "ACCESS_TOKEN", "token_type": "bearer", "expires_in": 60,
+			})
+			return
+		}
+
+		assert.Equal(t, "Bearer ACCESS_TOKEN", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/devices/queries/devices-scroll/v1":
+			switch r.URL.Query().Get("offset") {
+			case "":
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"resources": []string{"h1", "h2"},
+					"meta":      map[string]any{"pagination": map[string]any{"offset": "NEXT"}},
+				})
+			case "NEXT":
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"resources": []string{"h3"},
+					"meta":      map[string]any{"pagination": map[string]any{"offset": "LAST"}},
+				})
+			default:
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"resources": []string{},
+				})
+			}
+		case "/devices/entities/devices/v2":
+			var resources []map[string]any
+			for _, id := range r.URL.Query()["ids"] {
+				resources = append(resources, hosts[id])
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"resources": resources})
+		case "/zero-trust-assessment/entities/assessments/v1":
+			var resources []map[string]any
+			for _, id := range r.URL.Query()["ids"] {
+				if id == "h1" {
+					resources = append(resources, map[string]any{
+						"aid": id, "assessment": map[string]any{"overall": 85},
+					})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"resources": resources})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	p := newCrowdStrike(&config.DevicePostureProviderOptions{
+		URL:          srv.URL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+	})
+	devices, err := p.ListDevices(ctx)
+	require.NoError(t, err)
+	testutil.AssertProtoEqual(t, map[string][]*device.Posture_Device{
+		"user@example.com": {
+			{
+				Id: "h1", Name: "laptop", Os: "Mac", OsVersion: "Ventura (13)",
+				Managed: true, Compliant: true, Score: proto.Int32(85), LastSeenAt: timestamppb.New(lastSeen),
+			},
+			{Id: "h2", Name: "desktop", Os: "Windows", Managed: true},
+		},
+	}, devices)
+}
+
+func TestCrowdStrikeWithoutZeroTrustAssessment(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devices/queries/devices-scroll/v1":
+			_ = json.NewEncoder(w).Encode(map[string]any{"resources": []string{"h1"}})
+		case "/devices/entities/devices/v2":
+			_ = json.NewEncoder(w).Encode(map[string]any{"resources": []map[string]any{
+				{"device_id": "h1", "last_login_user": "user@example.com", "status": "normal"},
+			}})
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	p := &crowdStrike{client: srv.Client(), url: srv.URL}
+	devices, err := p.ListDevices(ctx)
+	require.NoError(t, err)
+	testutil.AssertProtoEqual(t, map[string][]*device.Posture_Device{
+		"user@example.com": {{Id: "h1", Managed: true, Compliant: true}},
+	}, devices)
+}
@@ -0,0 +1,95 @@
+// Package deviceposture syncs the compliance state of devices from device
+// management and endpoint security providers into the databroker.
+package deviceposture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/version"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+const maxResponseSize = 10 << 20
+
+// A Provider lists the devices of a device management or endpoint security
+// provider.
+type Provider interface {
+	// ListDevices returns the devices by the lowercase email address of their
+	// user. Devices without a user are skipped.
+	ListDevices(ctx context.Context) (map[string][]*device.Posture_Device, error)
+}
+
+// NewProvider creates a new Provider from the options.
+func NewProvider(o *config.DevicePostureProviderOptions) (Provider, error) {
+	switch o.Type {
+	case config.DevicePostureProviderIntune:
+		return newIntune(o), nil
+	case config.DevicePostureProviderJamf:
+		return newJamf(o), nil
+	case config.DevicePostureProviderCrowdStrike:
+		return newCrowdStrike(o), nil
+	}
+	return nil, fmt.Errorf("deviceposture: unknown provider type: %s", o.Type)
+}
+
+// newClient returns an http client which authenticates with the client
+// credentials.
+func newClient(cfg *clientcredentials.Config) *http.Client {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient,
+		httputil.NewLoggingClient(http.DefaultClient, "device_posture_http_client"))
+	return cfg.Client(ctx)
+}
+
+// A statusError is returned for unexpected http status codes.
+type statusError int
+
+func (err statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", int(err))
+}
+
+// getJSON gets a JSON document.
+func getJSON(ctx context.Context, client *http.Client, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(res.StatusCode)
+	}
+
+	bs, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize+1))
+	if err != nil {
+		return err
+	}
+	if len(bs) > maxResponseSize {
+		return fmt.Errorf("response exceeds %d bytes", maxResponseSize)
+	}
+	return json.Unmarshal(bs, v)
+}
+
+func addDevice(devices map[string][]*device.Posture_Device, email string, d *device.Posture_Device) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return
+	}
+	devices[email] = append(devices[email], d)
+}
@@ -0,0 +1,108 @@
+package deviceposture
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+const (
+	defaultIntuneGraphURL = "https://graph.microsoft.com/v1.0"
+	// https://learn.microsoft.com/en-us/graph/api/intune-devices-manageddevice-list
+	intuneManagedDevicesPath   = "/deviceManagement/managedDevices"
+	intuneManagedDevicesSelect = "id,deviceName,userPrincipalName,emailAddress,operatingSystem,osVersion," +
+		"complianceState,managementState,lastSyncDateTime"
+)
+
+type intuneManagedDevice struct {
+	ID                string    `json:"id"`
+	DeviceName        string    `json:"deviceName"`
+	UserPrincipalName string    `json:"userPrincipalName"`
+	EmailAddress      string    `json:"emailAddress"`
+	OperatingSystem   string    `json:"operatingSystem"`
+	OSVersion         string    `json:"osVersion"`
+	ComplianceState   string    `json:"complianceState"`
+	ManagementState   string    `json:"managementState"`
+	LastSyncDateTime  time.Time `json:"lastSyncDateTime"`
+}
+
+// intune lists the managed devices of Microsoft Intune. A device is managed
+// if its management state is managed, and compliant if its compliance state
+// is compliant.
+type intune struct {
+	client   *http.Client
+	graphURL string
+}
+
+func newIntune(o *config.DevicePostureProviderOptions) *intune {
+	graphURL := o.URL
+	if graphURL == "" {
+		graphURL = defaultIntuneGraphURL
+	}
+	return &intune{
+		client: newClient(&clientcredentials.Config{
+			ClientID:     o.ClientID,
+			ClientSecret: o.ClientSecret,
+			TokenURL:     "https://login.microsoftonline.com/" + url.PathEscape(o.TenantID) + "/oauth2/v2.0/token",
+			Scopes:       []string{"https://graph.microsoft.com/.default"},
+		}),
+		graphURL: graphURL,
+	}
+}
+
+func (p *intune) ListDevices(ctx context.Context) (map[string][]*device.Posture_Device, error) {
+	devices := make(map[string][]*device.Posture_Device)
+	endpoint := urlutil.Join(p.graphURL, intuneManagedDevicesPath) + "?$select=" + intuneManagedDevicesSelect
+	for endpoint != "" {
+		var response struct {
+			Value    []intuneManagedDevice `json:"value"`
+			NextLink string                `json:"@odata.nextLink"`
+		}
+		if err := getJSON(ctx, p.client, endpoint, &response); err != nil {
+			return nil, fmt.Errorf("deviceposture/intune: error listing managed devices: %w", err)
+		}
+
+		for _, md := range response.Value {
+			email := md.EmailAddress
+			if email == "" {
+				email = md.UserPrincipalName
+			}
+			d := &device.Posture_Device{
+				Id:        md.ID,
+				Name:      md.DeviceName,
+				Os:        md.OperatingSystem,
+				OsVersion: md.OSVersion,
+				Managed:   md.ManagementState == "managed",
+				Compliant: md.ComplianceState == "compliant",
+			}
+			if !md.LastSyncDateTime.IsZero() {
+				d.LastSeenAt = timestamppb.New(md.LastSyncDateTime)
+			}
+			addDevice(devices, email, d)
+		}
+
+		if response.NextLink != "" {
+			// the next link must be on the same host, so that the access
+			// token isn't sent elsewhere
+			next, err := url.Parse(response.NextLink)
+			if err != nil {
+				return nil, fmt.Errorf("deviceposture/intune: invalid next link: %w", err)
+			}
+			current, _ := url.Parse(endpoint)
+			if next.Host != current.Host {
+				return nil, fmt.Errorf("deviceposture/intune: unexpected next link host: %s", next.Host)
+			}
+		}
+		endpoint = response.NextLink
+	}
+	return devices, nil
+}
@@ -0,0 +1,68 @@
+package deviceposture
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+func TestIntune(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	lastSync := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/deviceManagement/managedDevices", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("$skiptoken") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"value": []map[string]any{
+					{
+						"id": "d1", "deviceName": "laptop", "emailAddress": "User@Example.com",
+						"operatingSystem": "Windows", "osVersion": "10.0.22621",
+						"complianceState": "compliant", "managementState": "managed",
+						"lastSyncDateTime": lastSync,
+					},
+					{"id": "d2", "deviceName": "kiosk", "complianceState": "compliant", "managementState": "managed"},
+				},
+				"@odata.nextLink": srv.URL + "/deviceManagement/managedDevices?$skiptoken=NEXT",
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"value": []map[string]any{
+				{
+					"id": "d3", "deviceName": "phone", "userPrincipalName": "user@example.com",
+					"operatingSystem": "iOS", "complianceState": "noncompliant", "managementState": "retirePending",
+				},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	p := &intune{client: srv.Client(), graphURL: srv.URL}
+	devices, err := p.ListDevices(ctx)
+	require.NoError(t, err)
+	testutil.AssertProtoEqual(t, map[string][]*device.Posture_Device{
+		"user@example.com": {
+			{
+				Id: "d1", Name: "laptop", Os: "Windows", OsVersion: "10.0.22621",
+				Managed: true, Compliant: true, LastSeenAt: timestamppb.New(lastSync),
+			},
+			{Id: "d3", Name: "phone", Os: "iOS"},
+		},
+	}, devices)
+}
@@ -0,0 +1,100 @@
+package deviceposture
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+const (
+	// https://developer.jamf.com/jamf-pro/reference/get_v1-computers-inventory
+	jamfComputersInventoryPath = "/api/v1/computers-inventory"
+	jamfPageSize               = 100
+)
+
+type jamfComputer struct {
+	ID      string `json:"id"`
+	General struct {
+		Name             string    `json:"name"`
+		LastContactTime  time.Time `json:"lastContactTime"`
+		RemoteManagement struct {
+			Managed bool `json:"managed"`
+		} `json:"remoteManagement"`
+	} `json:"general"`
+	UserAndLocation struct {
+		Email string `json:"email"`
+	} `json:"userAndLocation"`
+	OperatingSystem struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"operatingSystem"`
+}
+
+// jamf lists the computers of Jamf Pro. Jamf Pro only reports whether a
+// computer is managed, so computers are never compliant.
+type jamf struct {
+	client *http.Client
+	url    string
+}
+
+func newJamf(o *config.DevicePostureProviderOptions) *jamf {
+	return &jamf{
+		client: newClient(&clientcredentials.Config{
+			ClientID:     o.ClientID,
+			ClientSecret: o.ClientSecret,
+			TokenURL:     urlutil.Join(o.URL, "/api/oauth/token"),
+			AuthStyle:    oauth2.AuthStyleInParams,
+		}),
+		url: o.URL,
+	}
+}
+
+func (p *jamf) ListDevices(ctx context.Context) (map[string][]*device.Posture_Device, error) {
+	devices := make(map[string][]*device.Posture_Device)
+	for page, seen := 0, 0; ; page++ {
+		q := url.Values{
+			"section":   {"GENERAL", "USER_AND_LOCATION", "OPERATING_SYSTEM"},
+			"page":      {strconv.Itoa(page)},
+			"page-size": {strconv.Itoa(jamfPageSize)},
+			"sort":      {"id:asc"},
+		}
+		var response struct {
+			TotalCount int            `json:"totalCount"`
+			Results    []jamfComputer `json:"results"`
+		}
+		err := getJSON(ctx, p.client, urlutil.Join(p.url, jamfComputersInventoryPath)+"?"+q.Encode(), &response)
+		if err != nil {
+			return nil, fmt.Errorf("deviceposture/jamf: error listing computers: %w", err)
+		}
+
+		for _, c := range response.Results {
+			d := &device.Posture_Device{
+				Id:        c.ID,
+				Name:      c.General.Name,
+				Os:        c.OperatingSystem.Name,
+				OsVersion: c.OperatingSystem.Version,
+				Managed:   c.General.RemoteManagement.Managed,
+			}
+			if !c.General.LastContactTime.IsZero() {
+				d.LastSeenAt = timestamppb.New(c.General.LastContactTime)
+			}
+			addDevice(devices, c.UserAndLocation.Email, d)
+		}
+
+		seen += len(response.Results)
+		if len(response.Results) == 0 || seen >= response.TotalCount {
+			return devices, nil
+		}
+	}
+}
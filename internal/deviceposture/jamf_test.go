@@ -0,0 +1,81 @@
+package deviceposture
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+)
+
+func TestJamf(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	computers := []map[string]any{
+		{
+			"id":              "1",
+			"general":         map[string]any{"name": "mac-1", "remoteManagement": map[string]any{"managed": true}},
+			"userAndLocation": map[string]any{"email": "user@example.com"},
+			"operatingSystem": map[string]any{"name": "macOS", "version": "13.4"},
+		},
+		{
+			"id":              "2",
+			"general":         map[string]any{"name": "mac-2"},
+			"userAndLocation": map[string]any{"email": "other@example.com"},
+		},
+		{
+			"id":      "3",
+			"general": map[string]any{"name": "lab"},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/oauth/token":
+			assert.Equal(t, "CLIENT_ID", r.FormValue("client_id"))
+			assert.Equal(t, "CLIENT_SECRET", r.FormValue("client_secret"))
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "ACCESS_TOKEN", "token_type": "Bearer", "expires_in": 60,
+			})
+		case "/api/v1/computers-inventory":
+			assert.Equal(t, "Bearer ACCESS_TOKEN", r.Header.Get("Authorization"))
+			// two computers per page
+			page := computers
+			if r.URL.Query().Get("page") == "0" {
+				page = page[:2]
+			} else {
+				page = page[2:]
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": len(computers),
+				"results":    page,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	p := newJamf(&config.DevicePostureProviderOptions{
+		URL:          srv.URL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+	})
+	devices, err := p.ListDevices(ctx)
+	require.NoError(t, err)
+	testutil.AssertProtoEqual(t, map[string][]*device.Posture_Device{
+		"user@example.com":  {{Id: "1", Name: "mac-1", Os: "macOS", OsVersion: "13.4", Managed: true}},
+		"other@example.com": {{Id: "2", Name: "mac-2"}},
+	}, devices)
+}
@@ -0,0 +1,258 @@
+package deviceposture
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// maxWait is the maximum time the syncer waits before checking the providers
+// again, so that configuration changes are picked up.
+const maxWait = time.Minute
+
+type syncerProvider struct {
+	options  config.DevicePostureProviderOptions
+	provider Provider
+	nextSync time.Time
+}
+
+// A Syncer syncs the devices of the device posture providers into the
+// databroker, as a Posture record for each provider and user.
+type Syncer struct {
+	cfg *atomicutil.Value[*syncerConfig]
+
+	mu        sync.Mutex
+	providers map[string]*syncerProvider
+}
+
+// NewSyncer creates a new Syncer.
+func NewSyncer(options ...Option) *Syncer {
+	s := &Syncer{
+		cfg:       atomicutil.NewValue(newSyncerConfig()),
+		providers: make(map[string]*syncerProvider),
+	}
+	s.UpdateConfig(options...)
+	return s
+}
+
+// UpdateConfig updates the syncer with the new options.
+func (s *Syncer) UpdateConfig(options ...Option) {
+	s.cfg.Store(newSyncerConfig(options...))
+}
+
+// Run runs the syncer. This method blocks until an error occurs or the given context is canceled.
+func (s *Syncer) Run(ctx context.Context) error {
+	leaser := databroker.NewLeaser("device_posture_syncer", time.Second*30, s)
+	return leaser.Run(ctx)
+}
+
+// RunLeased runs the syncer when a lease is acquired.
+func (s *Syncer) RunLeased(ctx context.Context) error {
+	ctx = log.WithContext(ctx, func(c zerolog.Context) zerolog.Context {
+		return c.Str("service", "device_posture_syncer")
+	})
+
+	for {
+		wait, err := s.runOnce(ctx, s.cfg.Load())
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("deviceposture: error syncing device posture")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// GetDataBrokerServiceClient gets the databroker client.
+func (s *Syncer) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return s.cfg.Load().dataBrokerClient
+}
+
+// runOnce syncs the providers which are due and returns how long to wait
+// until the next sync is due.
+func (s *Syncer) runOnce(ctx context.Context, cfg *syncerConfig) (time.Duration, error) {
+	now := cfg.now()
+	due := s.getDueProviders(ctx, cfg, now)
+
+	records, _, _, err := databroker.InitialSync(ctx, cfg.dataBrokerClient, &databroker.SyncLatestRequest{
+		Type: grpcutil.GetTypeURL(new(device.Posture)),
+	})
+	if err != nil {
+		return maxWait, fmt.Errorf("deviceposture: error listing device posture: %w", err)
+	}
+	existing := make(map[string][]*device.Posture)
+	for _, record := range records {
+		posture := new(device.Posture)
+		if err := record.GetData().UnmarshalTo(posture); err != nil {
+			log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("deviceposture: invalid device posture record, ignoring")
+			continue
+		}
+		existing[posture.GetProvider()] = append(existing[posture.GetProvider()], posture)
+	}
+
+	var updated, deleted []*device.Posture
+	for name, provider := range due {
+		devices, err := provider.ListDevices(ctx)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("provider", name).Msg("deviceposture: error listing devices")
+			continue
+		}
+		u, d := diffPostures(name, devices, existing[name], now)
+		updated, deleted = append(updated, u...), append(deleted, d...)
+		log.Debug(ctx).Str("provider", name).Int("users", len(devices)).Msg("deviceposture: synced devices")
+	}
+
+	// remove the device posture of providers which are no longer configured
+	configured := make(map[string]bool)
+	for _, o := range cfg.providers {
+		configured[o.Name] = true
+	}
+	for name, postures := range existing {
+		if !configured[name] {
+			deleted = append(deleted, postures...)
+		}
+	}
+
+	var changes []*databroker.Record
+	for _, posture := range updated {
+		changes = append(changes, databroker.NewRecord(posture))
+	}
+	for _, posture := range deleted {
+		record := databroker.NewRecord(posture)
+		record.DeletedAt = timestamppb.New(now)
+		changes = append(changes, record)
+	}
+	if len(changes) > 0 {
+		_, err = cfg.dataBrokerClient.Put(ctx, &databroker.PutRequest{Records: changes})
+		if err != nil {
+			return maxWait, fmt.Errorf("deviceposture: error storing device posture: %w", err)
+		}
+	}
+
+	return s.nextSync(now), nil
+}
+
+// getDueProviders returns the providers which are due to be synced, by name,
+// and schedules their next sync. Providers whose options changed are created
+// again and synced immediately.
+func (s *Syncer) getDueProviders(ctx context.Context, cfg *syncerConfig, now time.Time) map[string]Provider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	configured := make(map[string]bool)
+	due := make(map[string]Provider)
+	for _, o := range cfg.providers {
+		configured[o.Name] = true
+
+		sp, ok := s.providers[o.Name]
+		if !ok || sp.options != o {
+			provider, err := cfg.newProvider(&o)
+			if err != nil {
+				log.Error(ctx).Err(err).Str("provider", o.Name).Msg("deviceposture: invalid provider")
+				delete(s.providers, o.Name)
+				continue
+			}
+			sp = &syncerProvider{options: o, provider: provider}
+			s.providers[o.Name] = sp
+		}
+
+		if !now.Before(sp.nextSync) {
+			sp.nextSync = now.Add(o.GetRefreshInterval())
+			due[o.Name] = sp.provider
+		}
+	}
+	for name := range s.providers {
+		if !configured[name] {
+			delete(s.providers, name)
+		}
+	}
+	return due
+}
+
+// nextSync returns how long until the next provider is due to be synced.
+func (s *Syncer) nextSync(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := maxWait
+	for _, sp := range s.providers {
+		if d := sp.nextSync.Sub(now); d < next {
+			next = d
+		}
+	}
+	if next < 0 {
+		next = 0
+	}
+	return next
+}
+
+// diffPostures computes the changes needed to bring the device posture of a
+// provider up to date. Users whose devices haven't changed are left alone.
+func diffPostures(
+	provider string,
+	devices map[string][]*device.Posture_Device,
+	existing []*device.Posture,
+	now time.Time,
+) (updated, deleted []*device.Posture) {
+	lookup := make(map[string]*device.Posture, len(existing))
+	for _, posture := range existing {
+		lookup[posture.GetEmail()] = posture
+	}
+
+	for email, ds := range devices {
+		sort.Slice(ds, func(i, j int) bool {
+			return ds[i].GetId() < ds[j].GetId()
+		})
+		if posture, ok := lookup[email]; ok && devicesEqual(posture.GetDevices(), ds) {
+			continue
+		}
+		updated = append(updated, &device.Posture{
+			Id:        provider + "/" + email,
+			Provider:  provider,
+			Email:     email,
+			Devices:   ds,
+			UpdatedAt: timestamppb.New(now),
+		})
+	}
+	for _, posture := range existing {
+		if _, ok := devices[posture.GetEmail()]; !ok {
+			deleted = append(deleted, posture)
+		}
+	}
+
+	sort.Slice(updated, func(i, j int) bool {
+		return updated[i].GetId() < updated[j].GetId()
+	})
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].GetId() < deleted[j].GetId()
+	})
+	return updated, deleted
+}
+
+func devicesEqual(x, y []*device.Posture_Device) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if !proto.Equal(x[i], y[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package deviceposture
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+type providerFunc func(ctx context.Context) (map[string][]*device.Posture_Device, error)
+
+func (f providerFunc) ListDevices(ctx context.Context) (map[string][]*device.Posture_Device, error) {
+	return f(ctx)
+}
+
+func TestDiffPostures(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	existing := []*device.Posture{
+		{
+			Id: "intune/a@example.com", Provider: "intune", Email: "a@example.com",
+			Devices: []*device.Posture_Device{{Id: "1", Managed: true}},
+		},
+		{
+			Id: "intune/b@example.com", Provider: "intune", Email: "b@example.com",
+			Devices: []*device.Posture_Device{{Id: "2", Managed: true}},
+		},
+		{
+			Id: "intune/c@example.com", Provider: "intune", Email: "c@example.com",
+			Devices: []*device.Posture_Device{{Id: "3"}},
+		},
+	}
+	updated, deleted := diffPostures("intune", map[string][]*device.Posture_Device{
+		"a@example.com": {{Id: "1", Managed: true}},
+		"b@example.com": {{Id: "4"}, {Id: "2", Managed: true, Compliant: true}},
+		"d@example.com": {{Id: "5"}},
+	}, existing, now)
+	testutil.AssertProtoEqual(t, []*device.Posture{
+		{
+			Id: "intune/b@example.com", Provider: "intune", Email: "b@example.com",
+			Devices:   []*device.Posture_Device{{Id: "2", Managed: true, Compliant: true}, {Id: "4"}},
+			UpdatedAt: timestamppb.New(now),
+		},
+		{
+			Id: "intune/d@example.com", Provider: "intune", Email: "d@example.com",
+			Devices:   []*device.Posture_Device{{Id: "5"}},
+			UpdatedAt: timestamppb.New(now),
+		},
+	}, updated)
+	testutil.AssertProtoEqual(t, []*device.Posture{existing[2]}, deleted)
+}
+
+func TestSyncer(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	li := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(s, internal_databroker.New())
+	go s.Serve(li)
+	t.Cleanup(s.Stop)
+	cc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cc.Close() })
+	client := databroker.NewDataBrokerServiceClient(cc)
+
+	listPostures := func() map[string]*device.Posture {
+		records, _, _, err := databroker.InitialSync(ctx, client, &databroker.SyncLatestRequest{
+			Type: grpcutil.GetTypeURL(new(device.Posture)),
+		})
+		require.NoError(t, err)
+		postures := make(map[string]*device.Posture)
+		for _, record := range records {
+			posture := new(device.Posture)
+			require.NoError(t, record.GetData().UnmarshalTo(posture))
+			postures[posture.GetId()] = posture
+		}
+		return postures
+	}
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	var listErr error
+	provider := providerFunc(func(ctx context.Context) (map[string][]*device.Posture_Device, error) {
+		calls++
+		return map[string][]*device.Posture_Device{
+			"user@example.com": {{Id: "1", Managed: true, Compliant: calls == 1}},
+		}, listErr
+	})
+	options := []Option{
+		WithDataBrokerClient(client),
+		WithProviders([]config.DevicePostureProviderOptions{
+			{Name: "intune", Type: "intune", RefreshInterval: time.Hour},
+		}),
+		WithNow(func() time.Time { return now }),
+		withNewProvider(func(o *config.DevicePostureProviderOptions) (Provider, error) {
+			return provider, nil
+		}),
+	}
+	syncer := NewSyncer(options...)
+
+	wait, err := syncer.runOnce(ctx, syncer.cfg.Load())
+	require.NoError(t, err)
+	assert.Equal(t, maxWait, wait)
+	postures := listPostures()
+	require.Contains(t, postures, "intune/user@example.com")
+	assert.True(t, postures["intune/user@example.com"].GetDevices()[0].GetCompliant())
+
+	// not synced again before the refresh interval
+	now = now.Add(time.Minute)
+	_, err = syncer.runOnce(ctx, syncer.cfg.Load())
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// synced after the refresh interval
+	now = now.Add(time.Hour)
+	_, err = syncer.runOnce(ctx, syncer.cfg.Load())
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.False(t, listPostures()["intune/user@example.com"].GetDevices()[0].GetCompliant())
+
+	// the device posture is kept when the provider fails
+	listErr = errors.New("unavailable")
+	now = now.Add(time.Hour)
+	_, err = syncer.runOnce(ctx, syncer.cfg.Load())
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Contains(t, listPostures(), "intune/user@example.com")
+
+	// the device posture is removed with the provider
+	syncer.UpdateConfig(append(options, WithProviders(nil))...)
+	_, err = syncer.runOnce(ctx, syncer.cfg.Load())
+	require.NoError(t, err)
+	assert.Empty(t, listPostures())
+}
@@ -0,0 +1,191 @@
+// Package dpop validates OAuth 2.0 Demonstrating Proof of Possession (DPoP)
+// proofs as specified by rfc9449.
+package dpop
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// HeaderName is the name of the header containing the DPoP proof.
+const HeaderName = "DPoP"
+
+// proofType is the required type of DPoP proof JWTs.
+const proofType = "dpop+jwt"
+
+// DefaultLeeway is the default amount of time a proof's issued at time may
+// differ from the current time.
+const DefaultLeeway = time.Minute
+
+// proofLeasePrefix is the prefix of the databroker leases which record used
+// proofs.
+const proofLeasePrefix = "pomerium/dpop-proof/"
+
+// supportedAlgorithms are the asymmetric signature algorithms accepted for
+// proofs.
+var supportedAlgorithms = map[jose.SignatureAlgorithm]struct{}{
+	jose.ES256: {}, jose.ES384: {}, jose.ES512: {},
+	jose.RS256: {}, jose.RS384: {}, jose.RS512: {},
+	jose.PS256: {}, jose.PS384: {}, jose.PS512: {},
+	jose.EdDSA: {},
+}
+
+// ErrInvalidProof indicates that a DPoP proof is invalid.
+var ErrInvalidProof = errors.New("dpop: invalid proof")
+
+// A Request describes the HTTP request a proof is expected to be bound to.
+type Request struct {
+	Method string
+	URL    url.URL
+	// AccessToken is the access token presented with the request, if any.
+	// Proofs for requests with an access token must include its hash.
+	AccessToken string
+	Now         time.Time
+	Leeway      time.Duration
+	// DataBrokerClient records the proofs which have been used, so that each
+	// proof is only accepted once by any instance.
+	DataBrokerClient databroker.DataBrokerServiceClient
+}
+
+type claims struct {
+	ID              string           `json:"jti"`
+	HTTPMethod      string           `json:"htm"`
+	HTTPURI         string           `json:"htu"`
+	IssuedAt        *jwt.NumericDate `json:"iat"`
+	AccessTokenHash string           `json:"ath,omitempty"`
+}
+
+// Verify verifies a DPoP proof for the request and returns the JWK SHA-256
+// thumbprint of the public key the proof was signed with, as used by the
+// "jkt" confirmation method.
+func Verify(ctx context.Context, proof string, req Request) (string, error) {
+	tok, err := jwt.ParseSigned(proof)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	if len(tok.Headers) != 1 {
+		return "", fmt.Errorf("%w: expected a single signature", ErrInvalidProof)
+	}
+
+	hdr := tok.Headers[0]
+	if typ, _ := hdr.ExtraHeaders[jose.HeaderType].(string); typ != proofType {
+		return "", fmt.Errorf("%w: invalid type: %s", ErrInvalidProof, typ)
+	}
+	if _, ok := supportedAlgorithms[jose.SignatureAlgorithm(hdr.Algorithm)]; !ok {
+		return "", fmt.Errorf("%w: unsupported algorithm: %s", ErrInvalidProof, hdr.Algorithm)
+	}
+	if hdr.JSONWebKey == nil || !hdr.JSONWebKey.Valid() || !hdr.JSONWebKey.IsPublic() {
+		return "", fmt.Errorf("%w: missing or invalid public key", ErrInvalidProof)
+	}
+
+	var c claims
+	if err := tok.Claims(hdr.JSONWebKey, &c); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+
+	if c.ID == "" {
+		return "", fmt.Errorf("%w: missing jti", ErrInvalidProof)
+	}
+	if c.HTTPMethod != req.Method {
+		return "", fmt.Errorf("%w: method mismatch", ErrInvalidProof)
+	}
+	if !matchesURI(c.HTTPURI, req.URL) {
+		return "", fmt.Errorf("%w: uri mismatch", ErrInvalidProof)
+	}
+
+	now, leeway := req.Now, req.Leeway
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if leeway == 0 {
+		leeway = DefaultLeeway
+	}
+	if c.IssuedAt == nil {
+		return "", fmt.Errorf("%w: missing iat", ErrInvalidProof)
+	}
+	if iat := c.IssuedAt.Time(); iat.Before(now.Add(-leeway)) || iat.After(now.Add(leeway)) {
+		return "", fmt.Errorf("%w: iat outside of the acceptable window", ErrInvalidProof)
+	}
+
+	if req.AccessToken != "" {
+		if c.AccessTokenHash == "" {
+			return "", fmt.Errorf("%w: missing ath", ErrInvalidProof)
+		}
+		if c.AccessTokenHash != AccessTokenHash(req.AccessToken) {
+			return "", fmt.Errorf("%w: access token hash mismatch", ErrInvalidProof)
+		}
+	}
+
+	rawThumbprint, err := hdr.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	thumbprint := base64.RawURLEncoding.EncodeToString(rawThumbprint)
+
+	// the proof is accepted until its issued at time is outside of the
+	// leeway, so it's recorded until then
+	err = claim(ctx, req.DataBrokerClient, thumbprint, c.ID, c.IssuedAt.Time().Add(leeway).Sub(now))
+	if err != nil {
+		return "", err
+	}
+	return thumbprint, nil
+}
+
+// claim records the use of the proof with the jti for the ttl, and returns
+// an error if it was already used. Proofs are claimed with a databroker
+// lease, which the databroker grants to a single client.
+func claim(ctx context.Context, client databroker.DataBrokerServiceClient, thumbprint, id string, ttl time.Duration) error {
+	if client == nil {
+		return errors.New("dpop: databroker client is required")
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	key := cryptutil.Hash("dpop proof", []byte(thumbprint+"|"+id))
+	_, err := client.AcquireLease(ctx, &databroker.AcquireLeaseRequest{
+		Name:     proofLeasePrefix + hex.EncodeToString(key),
+		Duration: durationpb.New(ttl),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return fmt.Errorf("%w: replayed jti", ErrInvalidProof)
+	} else if err != nil {
+		return fmt.Errorf("dpop: error recording used proof: %w", err)
+	}
+	return nil
+}
+
+// AccessTokenHash returns the "ath" claim value for an access token.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// matchesURI compares the htu claim to the request URL, ignoring any query
+// and fragment components.
+func matchesURI(htu string, requestURL url.URL) bool {
+	u, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	requestURL.RawQuery, requestURL.Fragment, requestURL.RawFragment = "", "", ""
+	return u.Scheme == requestURL.Scheme &&
+		u.Host == requestURL.Host &&
+		u.EscapedPath() == requestURL.EscapedPath()
+}
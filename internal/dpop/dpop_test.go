@@ -0,0 +1,125 @@
+package dpop
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	newProof := func(t *testing.T, typ string, c claims) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			(&jose.SignerOptions{EmbedJWK: true}).WithType(jose.ContentType(typ)))
+		require.NoError(t, err)
+		proof, err := jwt.Signed(signer).Claims(c).CompactSerialize()
+		require.NoError(t, err)
+		return proof
+	}
+	validClaims := func() claims {
+		return claims{
+			ID:              "1",
+			HTTPMethod:      "GET",
+			HTTPURI:         "https://api.example.com/resource",
+			IssuedAt:        jwt.NewNumericDate(now),
+			AccessTokenHash: AccessTokenHash("TOKEN"),
+		}
+	}
+	ctx := context.Background()
+	req := Request{
+		Method:           "GET",
+		URL:              url.URL{Scheme: "https", Host: "api.example.com", Path: "/resource", RawQuery: "x=1"},
+		AccessToken:      "TOKEN",
+		Now:              now,
+		DataBrokerClient: newMockDataBrokerClient(),
+	}
+
+	expectThumbprint, err := (&jose.JSONWebKey{Key: key.Public()}).Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+
+	thumbprint, err := Verify(ctx, newProof(t, "dpop+jwt", validClaims()), req)
+	assert.NoError(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(expectThumbprint), thumbprint)
+
+	_, err = Verify(ctx, newProof(t, "dpop+jwt", validClaims()), req)
+	assert.ErrorIs(t, err, ErrInvalidProof, "should reject replayed proofs")
+
+	_, err = Verify(ctx, newProof(t, "dpop+jwt", validClaims()), Request{
+		Method: req.Method, URL: req.URL, AccessToken: req.AccessToken, Now: now,
+	})
+	assert.Error(t, err, "should require a databroker client")
+
+	for _, tc := range []struct {
+		name   string
+		typ    string
+		modify func(c *claims)
+	}{
+		{"invalid type", "JWT", func(c *claims) {}},
+		{"missing jti", "dpop+jwt", func(c *claims) { c.ID = "" }},
+		{"wrong method", "dpop+jwt", func(c *claims) { c.HTTPMethod = "POST" }},
+		{"wrong uri", "dpop+jwt", func(c *claims) { c.HTTPURI = "https://api.example.com/other" }},
+		{"expired", "dpop+jwt", func(c *claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(-time.Hour)) }},
+		{"wrong access token", "dpop+jwt", func(c *claims) { c.AccessTokenHash = AccessTokenHash("OTHER") }},
+		{"missing access token hash", "dpop+jwt", func(c *claims) { c.AccessTokenHash = "" }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validClaims()
+			tc.modify(&c)
+			_, err := Verify(ctx, newProof(t, tc.typ, c), req)
+			assert.ErrorIs(t, err, ErrInvalidProof)
+		})
+	}
+
+	t.Run("symmetric", func(t *testing.T) {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("01234567890123456789012345678901")},
+			(&jose.SignerOptions{}).WithType("dpop+jwt"))
+		require.NoError(t, err)
+		proof, err := jwt.Signed(signer).Claims(validClaims()).CompactSerialize()
+		require.NoError(t, err)
+		_, err = Verify(ctx, proof, req)
+		assert.ErrorIs(t, err, ErrInvalidProof)
+	})
+}
+
+type mockDataBrokerClient struct {
+	databroker.DataBrokerServiceClient
+
+	mu     sync.Mutex
+	leases map[string]struct{}
+}
+
+func newMockDataBrokerClient() *mockDataBrokerClient {
+	return &mockDataBrokerClient{leases: make(map[string]struct{})}
+}
+
+func (m *mockDataBrokerClient) AcquireLease(_ context.Context, in *databroker.AcquireLeaseRequest, _ ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.leases[in.GetName()]; ok {
+		return nil, status.Error(codes.AlreadyExists, "lease is already taken")
+	}
+	m.leases[in.GetName()] = struct{}{}
+	return &databroker.AcquireLeaseResponse{Id: in.GetName()}, nil
+}
@@ -0,0 +1,107 @@
+// Package jwe represents encrypted content using JSON-based data structures
+// as specified by rfc7516
+package jwe
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+)
+
+// JSONWebEncrypter is the struct representing an encrypted JWT.
+// https://tools.ietf.org/html/rfc7519
+type JSONWebEncrypter struct {
+	Encrypter jose.Encrypter
+
+	// nested encrypts already serialized JWTs, as specified by rfc7519 5.2
+	nested jose.Encrypter
+	key    interface{}
+}
+
+// NewA128GCMEncrypter creates an AES-128-GCM JWT encrypter from a 16 byte
+// key.
+func NewA128GCMEncrypter(key []byte) (encoding.MarshalUnmarshaler, error) {
+	return newEncrypter(jose.A128GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, key)
+}
+
+// NewA256GCMEncrypter creates an AES-256-GCM JWT encrypter from a 32 byte key.
+func NewA256GCMEncrypter(key []byte) (encoding.MarshalUnmarshaler, error) {
+	return newEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, key)
+}
+
+// NewECDHESEncrypter creates a JWT encrypter which uses ECDH-ES key agreement
+// with the public key of the given elliptic curve key, and the given AES-GCM
+// content encryption, which must be either A128GCM or A256GCM.
+func NewECDHESEncrypter(enc jose.ContentEncryption, key *ecdsa.PrivateKey) (encoding.MarshalUnmarshaler, error) {
+	if enc != jose.A128GCM && enc != jose.A256GCM {
+		return nil, fmt.Errorf("internal/encoding: unsupported content encryption: %s", enc)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("internal/encoding: ecdh-es key is required")
+	}
+	return newEncrypter(enc, jose.Recipient{Algorithm: jose.ECDH_ES, Key: &key.PublicKey}, key)
+}
+
+func newEncrypter(enc jose.ContentEncryption, recipient jose.Recipient, key interface{}) (encoding.MarshalUnmarshaler, error) {
+	encrypter, err := jose.NewEncrypter(enc, recipient,
+		(&jose.EncrypterOptions{}).WithType("JWT"))
+	if err != nil {
+		return nil, err
+	}
+	nested, err := jose.NewEncrypter(enc, recipient,
+		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"))
+	if err != nil {
+		return nil, err
+	}
+	return &JSONWebEncrypter{Encrypter: encrypter, nested: nested, key: key}, nil
+}
+
+// Marshal encrypts, and serializes a JWT. Strings and byte slices are
+// treated as serialized JWTs and encrypted as nested JWTs.
+func (c *JSONWebEncrypter) Marshal(x interface{}) ([]byte, error) {
+	var payload []byte
+	switch v := x.(type) {
+	case []byte:
+		payload = v
+	case string:
+		payload = []byte(v)
+	default:
+		s, err := jwt.Encrypted(c.Encrypter).Claims(x).CompactSerialize()
+		return []byte(s), err
+	}
+
+	obj, err := c.nested.Encrypt(payload)
+	if err != nil {
+		return nil, err
+	}
+	s, err := obj.CompactSerialize()
+	return []byte(s), err
+}
+
+// Unmarshal parses and decrypts an encrypted JWT. Nested JWTs may be
+// unmarshaled into a string or byte slice.
+func (c *JSONWebEncrypter) Unmarshal(value []byte, s interface{}) error {
+	obj, err := jose.ParseEncrypted(string(value))
+	if err != nil {
+		return err
+	}
+	payload, err := obj.Decrypt(c.key)
+	if err != nil {
+		return err
+	}
+
+	switch v := s.(type) {
+	case *[]byte:
+		*v = payload
+		return nil
+	case *string:
+		*v = string(payload)
+		return nil
+	}
+	return json.Unmarshal(payload, s)
+}
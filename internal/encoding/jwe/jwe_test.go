@@ -0,0 +1,100 @@
+package jwe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestJSONWebEncrypter(t *testing.T) {
+	key := cryptutil.NewKey()
+	e, err := NewA256GCMEncrypter(key)
+	require.NoError(t, err)
+
+	raw, err := e.Marshal(map[string]interface{}{"email": "user@example.com"})
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(string(raw), "."), 5, "should be a compact jwe")
+	assert.NotContains(t, string(raw), "user@example.com")
+
+	var claims map[string]string
+	assert.NoError(t, e.Unmarshal(raw, &claims))
+	assert.Equal(t, "user@example.com", claims["email"])
+
+	raw, err = e.Marshal("header.payload.signature")
+	require.NoError(t, err)
+	var nested string
+	assert.NoError(t, e.Unmarshal(raw, &nested))
+	assert.Equal(t, "header.payload.signature", nested)
+
+	other, err := NewA256GCMEncrypter(cryptutil.NewKey())
+	require.NoError(t, err)
+	assert.Error(t, other.Unmarshal(raw, &claims), "should fail to decrypt with another key")
+
+	_, err = NewA256GCMEncrypter([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestNewA128GCMEncrypter(t *testing.T) {
+	key := cryptutil.NewKey()[:16]
+	e, err := NewA128GCMEncrypter(key)
+	require.NoError(t, err)
+
+	raw, err := e.Marshal(map[string]interface{}{"email": "user@example.com"})
+	require.NoError(t, err)
+	var claims map[string]string
+	assert.NoError(t, e.Unmarshal(raw, &claims))
+	assert.Equal(t, "user@example.com", claims["email"])
+
+	_, err = NewA128GCMEncrypter(cryptutil.NewKey())
+	assert.Error(t, err, "should require a 16 byte key")
+}
+
+func TestNewECDHESEncrypter(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for _, enc := range []jose.ContentEncryption{jose.A128GCM, jose.A256GCM} {
+		enc := enc
+		t.Run(string(enc), func(t *testing.T) {
+			e, err := NewECDHESEncrypter(enc, key)
+			require.NoError(t, err)
+
+			raw, err := e.Marshal(map[string]interface{}{"email": "user@example.com"})
+			require.NoError(t, err)
+			assert.NotContains(t, string(raw), "user@example.com")
+			var claims map[string]string
+			assert.NoError(t, e.Unmarshal(raw, &claims))
+			assert.Equal(t, "user@example.com", claims["email"])
+
+			raw, err = e.Marshal("header.payload.signature")
+			require.NoError(t, err)
+			var nested string
+			assert.NoError(t, e.Unmarshal(raw, &nested))
+			assert.Equal(t, "header.payload.signature", nested)
+		})
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	e, err := NewECDHESEncrypter(jose.A256GCM, key)
+	require.NoError(t, err)
+	other, err := NewECDHESEncrypter(jose.A256GCM, otherKey)
+	require.NoError(t, err)
+	raw, err := e.Marshal(map[string]interface{}{"email": "user@example.com"})
+	require.NoError(t, err)
+	var claims map[string]string
+	assert.Error(t, other.Unmarshal(raw, &claims), "should fail to decrypt with another key")
+
+	_, err = NewECDHESEncrypter(jose.A192GCM, key)
+	assert.Error(t, err)
+	_, err = NewECDHESEncrypter(jose.A256GCM, nil)
+	assert.Error(t, err)
+}
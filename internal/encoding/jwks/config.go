@@ -0,0 +1,90 @@
+package jwks
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+var (
+	defaultMinRefreshInterval = time.Minute
+	defaultMaxRefreshInterval = 24 * time.Hour
+	defaultRefreshInterval    = time.Hour
+	defaultTimeout            = 30 * time.Second
+)
+
+type config struct {
+	httpClient         *http.Client
+	minRefreshInterval time.Duration
+	maxRefreshInterval time.Duration
+	timeout            time.Duration
+	now                func() time.Time
+}
+
+// An Option customizes the Fetcher config.
+type Option func(*config)
+
+// WithHTTPClient sets the http client used to fetch key sets.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(cfg *config) {
+		cfg.httpClient = httpClient
+	}
+}
+
+// WithMinRefreshInterval sets the minimum time between fetches of a key set.
+func WithMinRefreshInterval(dur time.Duration) Option {
+	return func(cfg *config) {
+		cfg.minRefreshInterval = dur
+	}
+}
+
+// WithMaxRefreshInterval sets the maximum time a key set is cached before it
+// is refreshed.
+func WithMaxRefreshInterval(dur time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxRefreshInterval = dur
+	}
+}
+
+// WithTimeout sets the timeout for fetching a key set.
+func WithTimeout(dur time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = dur
+	}
+}
+
+// WithNow sets the time.Now function used by the Fetcher.
+func WithNow(now func() time.Time) Option {
+	return func(cfg *config) {
+		cfg.now = now
+	}
+}
+
+func getConfig(options ...Option) *config {
+	cfg := new(config)
+	WithHTTPClient(httputil.NewLoggingClient(nil, "jwks_fetcher"))(cfg)
+	WithMinRefreshInterval(defaultMinRefreshInterval)(cfg)
+	WithMaxRefreshInterval(defaultMaxRefreshInterval)(cfg)
+	WithTimeout(defaultTimeout)(cfg)
+	WithNow(time.Now)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// clampRefreshInterval returns how long a key set with the given max-age
+// should be cached. A negative max-age means there was no max-age.
+func (cfg *config) clampRefreshInterval(maxAge time.Duration) time.Duration {
+	if maxAge < 0 {
+		maxAge = defaultRefreshInterval
+	}
+	if maxAge < cfg.minRefreshInterval {
+		maxAge = cfg.minRefreshInterval
+	}
+	if maxAge > cfg.maxRefreshInterval {
+		maxAge = cfg.maxRefreshInterval
+	}
+	return maxAge
+}
@@ -0,0 +1,254 @@
+// Package jwks fetches and caches remote JSON Web Key Sets, as specified by
+// rfc7517, which are used to verify JWTs issued by third parties.
+package jwks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/json"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const maxKeySetSize = 1 << 20
+
+var (
+	// ErrUnknownKeyID is returned when verifying a JWT signed by a key which
+	// isn't in the key set.
+	ErrUnknownKeyID = errors.New("internal/encoding: unknown key id")
+
+	// DefaultFetcher is the default Fetcher.
+	DefaultFetcher = NewFetcher()
+)
+
+// A Fetcher fetches remote JSON Web Key Sets and caches them. Cached key sets
+// are refreshed in the background once the max-age of the Cache-Control
+// response header has passed, and stale key sets are used if a refresh fails.
+type Fetcher struct {
+	cfg *config
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	keySet    *jose.JSONWebKeySet
+	err       error
+	fetchedAt time.Time
+	refreshAt time.Time
+	// fetching is closed when the current fetch completes
+	fetching chan struct{}
+}
+
+// NewFetcher creates a new Fetcher.
+func NewFetcher(options ...Option) *Fetcher {
+	return &Fetcher{
+		cfg:     getConfig(options...),
+		entries: make(map[string]*entry),
+	}
+}
+
+// GetKeySet gets the key set at the given URL. The first call for a URL
+// blocks until the key set has been fetched. Subsequent calls return the
+// cached key set, refreshing it in the background when it has expired.
+func (f *Fetcher) GetKeySet(ctx context.Context, rawURL string) (*jose.JSONWebKeySet, error) {
+	f.mu.Lock()
+	e, ok := f.entries[rawURL]
+	if !ok {
+		e = new(entry)
+		f.entries[rawURL] = e
+	}
+	if !f.cfg.now().Before(e.refreshAt) {
+		f.startFetchLocked(rawURL, e)
+	}
+	keySet, fetching := e.keySet, e.fetching
+	f.mu.Unlock()
+
+	// use the cached key set while it is refreshed
+	if keySet != nil {
+		return keySet, nil
+	}
+	return f.wait(ctx, e, fetching)
+}
+
+// refreshUnknownKeyID refreshes the key set when a JWT is signed by an unknown
+// key, in case the keys have been rotated. Refreshes are limited by the
+// minimum refresh interval.
+func (f *Fetcher) refreshUnknownKeyID(ctx context.Context, rawURL string) (*jose.JSONWebKeySet, error) {
+	f.mu.Lock()
+	e, ok := f.entries[rawURL]
+	if !ok {
+		f.mu.Unlock()
+		return f.GetKeySet(ctx, rawURL)
+	}
+	if !f.cfg.now().Before(e.fetchedAt.Add(f.cfg.minRefreshInterval)) {
+		f.startFetchLocked(rawURL, e)
+	}
+	fetching := e.fetching
+	f.mu.Unlock()
+
+	return f.wait(ctx, e, fetching)
+}
+
+func (f *Fetcher) wait(ctx context.Context, e *entry, fetching chan struct{}) (*jose.JSONWebKeySet, error) {
+	if fetching != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-fetching:
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e.keySet == nil {
+		return nil, e.err
+	}
+	return e.keySet, nil
+}
+
+func (f *Fetcher) startFetchLocked(rawURL string, e *entry) {
+	if e.fetching != nil {
+		return
+	}
+	e.fetching = make(chan struct{})
+	go f.refresh(rawURL, e)
+}
+
+func (f *Fetcher) refresh(rawURL string, e *entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.cfg.timeout)
+	defer cancel()
+
+	keySet, maxAge, err := f.fetch(ctx, rawURL)
+	now := f.cfg.now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil {
+		log.Warn(ctx).Err(err).Str("url", rawURL).Msg("jwks: error fetching key set")
+		e.err = err
+		// keep using the stale key set, if any, and try again later
+		e.refreshAt = now.Add(f.cfg.minRefreshInterval)
+	} else {
+		e.keySet, e.err = keySet, nil
+		e.fetchedAt = now
+		e.refreshAt = now.Add(f.cfg.clampRefreshInterval(maxAge))
+	}
+
+	close(e.fetching)
+	e.fetching = nil
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (keySet *jose.JSONWebKeySet, maxAge time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := f.cfg.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, 0, fmt.Errorf("jwks: unexpected status code %d fetching %s", res.StatusCode, rawURL)
+	}
+
+	bs, err := io.ReadAll(io.LimitReader(res.Body, maxKeySetSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keySet = new(jose.JSONWebKeySet)
+	if err := json.Unmarshal(bs, keySet); err != nil {
+		return nil, 0, fmt.Errorf("jwks: invalid key set: %w", err)
+	}
+
+	return keySet, parseMaxAge(res.Header.Get("Cache-Control")), nil
+}
+
+// VerifyJWT verifies a JWT signed by a key in the key set at the given URL and
+// unmarshals its claims into out. The expiry and not before claims are
+// validated.
+func (f *Fetcher) VerifyJWT(ctx context.Context, rawURL, rawJWT string, out interface{}) error {
+	tok, err := jwt.ParseSigned(rawJWT)
+	if err != nil {
+		return err
+	}
+	if len(tok.Headers) != 1 {
+		return errors.New("internal/encoding: unexpected number of signatures")
+	}
+
+	keySet, err := f.GetKeySet(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+
+	keys := getVerificationKeys(keySet, tok.Headers[0].KeyID)
+	if len(keys) == 0 {
+		keySet, err = f.refreshUnknownKeyID(ctx, rawURL)
+		if err != nil {
+			return err
+		}
+		keys = getVerificationKeys(keySet, tok.Headers[0].KeyID)
+		if len(keys) == 0 {
+			return ErrUnknownKeyID
+		}
+	}
+
+	var claims jwt.Claims
+	for _, key := range keys {
+		err = tok.Claims(key, &claims, out)
+		if err == nil {
+			return claims.ValidateWithLeeway(jwt.Expected{Time: f.cfg.now()}, jwt.DefaultLeeway)
+		}
+	}
+	return err
+}
+
+// getVerificationKeys returns the signing keys with the given key id, or all
+// the signing keys if the key id is empty.
+func getVerificationKeys(keySet *jose.JSONWebKeySet, kid string) []jose.JSONWebKey {
+	var keys []jose.JSONWebKey
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if kid != "" && key.KeyID != kid {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// parseMaxAge parses the max-age directive of a Cache-Control header. Responses
+// which shouldn't be cached have a max-age of 0.
+func parseMaxAge(cacheControl string) time.Duration {
+	maxAge := time.Duration(-1)
+	for _, directive := range strings.Split(cacheControl, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(k) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(v, `"`)); err == nil && seconds >= 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return maxAge
+}
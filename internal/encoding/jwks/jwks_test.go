@@ -0,0 +1,197 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKeyServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	keys         []jose.JSONWebKey
+	cacheControl string
+	fail         bool
+	requests     atomic.Int32
+}
+
+func newTestKeyServer(t *testing.T) *testKeyServer {
+	srv := new(testKeyServer)
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.requests.Add(1)
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		if srv.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if srv.cacheControl != "" {
+			w.Header().Set("Cache-Control", srv.cacheControl)
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: srv.keys})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *testKeyServer) update(f func(srv *testKeyServer)) {
+	srv.mu.Lock()
+	f(srv)
+	srv.mu.Unlock()
+}
+
+func newTestKey(t *testing.T, kid string) (*ecdsa.PrivateKey, jose.JSONWebKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key, jose.JSONWebKey{Key: &key.PublicKey, KeyID: kid, Algorithm: string(jose.ES256), Use: "sig"}
+}
+
+func signJWT(t *testing.T, key *ecdsa.PrivateKey, kid string, claims interface{}) string {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", kid))
+	require.NoError(t, err)
+	raw, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return raw
+}
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestFetcher(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	k1, jwk1 := newTestKey(t, "k1")
+	k2, jwk2 := newTestKey(t, "k2")
+	srv := newTestKeyServer(t)
+	srv.update(func(srv *testKeyServer) {
+		srv.keys = []jose.JSONWebKey{jwk1}
+		srv.cacheControl = "public, max-age=600"
+	})
+
+	clock := &testClock{now: time.Now()}
+	f := NewFetcher(WithNow(clock.Now))
+
+	keySet, err := f.GetKeySet(ctx, srv.URL)
+	require.NoError(t, err)
+	assert.Len(t, keySet.Keys, 1)
+
+	var claims map[string]interface{}
+	err = f.VerifyJWT(ctx, srv.URL, signJWT(t, k1, "k1", map[string]interface{}{"sub": "user"}), &claims)
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims["sub"])
+	assert.Equal(t, int32(1), srv.requests.Load(), "should use the cached key set")
+
+	t.Run("expired", func(t *testing.T) {
+		err := f.VerifyJWT(ctx, srv.URL, signJWT(t, k1, "k1", jwt.Claims{
+			Expiry: jwt.NewNumericDate(clock.Now().Add(-time.Hour)),
+		}), &claims)
+		assert.ErrorIs(t, err, jwt.ErrExpired)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		err := f.VerifyJWT(ctx, srv.URL, signJWT(t, k2, "k1", map[string]interface{}{"sub": "user"}), &claims)
+		assert.Error(t, err)
+	})
+
+	// rotate the keys
+	srv.update(func(srv *testKeyServer) {
+		srv.keys = []jose.JSONWebKey{jwk1, jwk2}
+	})
+	rawJWT := signJWT(t, k2, "k2", map[string]interface{}{"sub": "user2"})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		assert.ErrorIs(t, f.VerifyJWT(ctx, srv.URL, rawJWT, &claims), ErrUnknownKeyID,
+			"should not refresh before the minimum refresh interval")
+
+		clock.Add(2 * time.Minute)
+		assert.NoError(t, f.VerifyJWT(ctx, srv.URL, rawJWT, &claims),
+			"should refresh the key set for an unknown key id")
+		assert.Equal(t, "user2", claims["sub"])
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		srv.update(func(srv *testKeyServer) {
+			srv.fail = true
+		})
+		before := srv.requests.Load()
+		clock.Add(time.Hour)
+
+		keySet, err := f.GetKeySet(ctx, srv.URL)
+		require.NoError(t, err, "should use the stale key set")
+		assert.Len(t, keySet.Keys, 2)
+		assert.Eventually(t, func() bool {
+			return srv.requests.Load() > before
+		}, 5*time.Second, 10*time.Millisecond, "should refresh in the background")
+		keySet, err = f.GetKeySet(ctx, srv.URL)
+		require.NoError(t, err, "should use the stale key set after a failed refresh")
+		assert.Len(t, keySet.Keys, 2)
+	})
+}
+
+func TestFetcherError(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestKeyServer(t)
+	srv.update(func(srv *testKeyServer) {
+		srv.fail = true
+	})
+
+	f := NewFetcher()
+	_, err := f.GetKeySet(context.Background(), srv.URL)
+	assert.Error(t, err)
+}
+
+func TestParseMaxAge(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		cacheControl string
+		expect       time.Duration
+	}{
+		{"", -1},
+		{"max-age=60", time.Minute},
+		{"public, max-age=3600, must-revalidate", time.Hour},
+		{`max-age="120"`, 2 * time.Minute},
+		{"no-store", 0},
+		{"max-age=60, no-cache", 0},
+		{"max-age=invalid", -1},
+	} {
+		assert.Equal(t, tc.expect, parseMaxAge(tc.cacheControl), tc.cacheControl)
+	}
+
+	cfg := getConfig()
+	assert.Equal(t, defaultRefreshInterval, cfg.clampRefreshInterval(-1))
+	assert.Equal(t, defaultMinRefreshInterval, cfg.clampRefreshInterval(0))
+	assert.Equal(t, defaultMaxRefreshInterval, cfg.clampRefreshInterval(365*24*time.Hour))
+}
@@ -0,0 +1,109 @@
+package jws
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/json"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+const (
+	// zipHeader is the header used to indicate that the payload is compressed,
+	// as defined for JWE by rfc7516
+	zipHeader = "zip"
+	// zipDeflate is the DEFLATE compression algorithm, as defined by rfc1951
+	zipDeflate = "DEF"
+
+	// maxDecompressedSize limits the size of a decompressed payload
+	maxDecompressedSize = 1 << 20
+)
+
+// An Option customizes a JWT signer.
+type Option func(*options)
+
+type options struct {
+	compress bool
+}
+
+func getOptions(opts ...Option) *options {
+	o := new(options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCompression compresses the JWT payload with DEFLATE before signing, to
+// reduce the size of JWTs with large claims, such as many groups. Compressed
+// JWTs are marked with a zip header and can only be unmarshaled by this
+// package.
+func WithCompression() Option {
+	return func(o *options) {
+		o.compress = true
+	}
+}
+
+// marshalCompressed signs and serializes a JWT with a compressed payload.
+// If compressing the payload doesn't make it smaller it is signed by the
+// uncompressed signer instead.
+func marshalCompressed(signer, compressedSigner jose.Signer, x interface{}) ([]byte, error) {
+	payload, err := json.Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = w.Write(payload)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() < len(payload) {
+		signer, payload = compressedSigner, buf.Bytes()
+	}
+
+	obj, err := signer.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	s, err := obj.CompactSerialize()
+	return []byte(s), err
+}
+
+// verifyClaims verifies a JWT with the key and unmarshals its claims,
+// decompressing the payload if it was compressed.
+func verifyClaims(tok *jwt.JSONWebToken, value []byte, key interface{}, s interface{}) error {
+	if len(tok.Headers) != 1 || tok.Headers[0].ExtraHeaders[zipHeader] == nil {
+		return tok.Claims(key, s)
+	}
+	if tok.Headers[0].ExtraHeaders[zipHeader] != zipDeflate {
+		return fmt.Errorf("internal/encoding: unsupported compression algorithm: %v",
+			tok.Headers[0].ExtraHeaders[zipHeader])
+	}
+
+	obj, err := jose.ParseSigned(string(value))
+	if err != nil {
+		return err
+	}
+	payload, err := obj.Verify(key)
+	if err != nil {
+		return err
+	}
+
+	payload, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(payload)), maxDecompressedSize+1))
+	if err != nil {
+		return fmt.Errorf("internal/encoding: invalid compressed payload: %w", err)
+	}
+	if len(payload) > maxDecompressedSize {
+		return errors.New("internal/encoding: compressed payload is too large")
+	}
+	return json.Unmarshal(payload, s)
+}
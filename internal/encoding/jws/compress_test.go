@@ -0,0 +1,96 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	key := cryptutil.NewKey()
+	signer, err := NewHS256Signer(key)
+	require.NoError(t, err)
+	compressedSigner, err := NewHS256Signer(key, WithCompression())
+	require.NoError(t, err)
+
+	groups := make([]string, 200)
+	for i := range groups {
+		groups[i] = fmt.Sprintf("group-%d@example.com", i)
+	}
+	claims := map[string]interface{}{"sub": "user", "groups": groups}
+
+	raw, err := signer.Marshal(claims)
+	require.NoError(t, err)
+	compressed, err := compressedSigner.Marshal(claims)
+	require.NoError(t, err)
+	assert.Less(t, len(compressed), len(raw)/2, "should compress the payload")
+
+	tok, err := jwt.ParseSigned(string(compressed))
+	require.NoError(t, err)
+	assert.Equal(t, zipDeflate, tok.Headers[0].ExtraHeaders[zipHeader])
+
+	for _, mu := range []encoding.Unmarshaler{signer, compressedSigner} {
+		var out struct {
+			Subject string   `json:"sub"`
+			Groups  []string `json:"groups"`
+		}
+		require.NoError(t, mu.Unmarshal(compressed, &out))
+		assert.Equal(t, "user", out.Subject)
+		assert.Equal(t, groups, out.Groups)
+	}
+
+	t.Run("small payload", func(t *testing.T) {
+		raw, err := compressedSigner.Marshal(map[string]interface{}{"sub": "u"})
+		require.NoError(t, err)
+		tok, err := jwt.ParseSigned(string(raw))
+		require.NoError(t, err)
+		assert.Nil(t, tok.Headers[0].ExtraHeaders[zipHeader], "should not compress when it doesn't help")
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := NewHS256Signer(cryptutil.NewKey())
+		require.NoError(t, err)
+		var out map[string]interface{}
+		assert.Error(t, other.Unmarshal(compressed, &out))
+	})
+	t.Run("asymmetric", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		signer, err := NewES256Signer(ecKey, WithCompression())
+		require.NoError(t, err)
+		verifier, err := NewES256Verifier(&ecKey.PublicKey)
+		require.NoError(t, err)
+
+		raw, err := signer.Marshal(claims)
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, verifier.Unmarshal(raw, &out))
+		assert.Equal(t, "user", out["sub"])
+	})
+	t.Run("keyring", func(t *testing.T) {
+		kr, err := NewHS256Keyring(cryptutil.NewKey(), key)
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, kr.Unmarshal(compressed, &out))
+		assert.Equal(t, "user", out["sub"])
+	})
+	t.Run("decompression limit", func(t *testing.T) {
+		raw, err := compressedSigner.Marshal(map[string]interface{}{
+			"sub": strings.Repeat("a", maxDecompressedSize),
+		})
+		require.NoError(t, err)
+		var out map[string]interface{}
+		assert.Error(t, compressedSigner.Unmarshal(raw, &out))
+	})
+}
@@ -3,41 +3,107 @@
 package jws
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"errors"
+
 	"github.com/pomerium/pomerium/internal/encoding"
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
 )
 
+// ErrVerifyOnly is returned when marshaling with a verify only signer.
+var ErrVerifyOnly = errors.New("internal/encoding: signer can only verify")
+
 // JSONWebSigner is the struct representing a signed JWT.
 // https://tools.ietf.org/html/rfc7519
 type JSONWebSigner struct {
 	Signer jose.Signer
 
-	key interface{}
+	// compressedSigner is used to sign compressed payloads
+	compressedSigner jose.Signer
+	key              interface{}
 }
 
 // NewHS256Signer creates a SHA256 JWT signer from a 32 byte key.
-func NewHS256Signer(key []byte) (encoding.MarshalUnmarshaler, error) {
-	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: key},
+func NewHS256Signer(key []byte, opts ...Option) (encoding.MarshalUnmarshaler, error) {
+	return newSigner(jose.HS256, key, key, opts...)
+}
+
+// NewES256Signer creates an ECDSA P-256 SHA256 JWT signer. Signed JWTs can be
+// verified by a verifier created with NewES256Verifier from the public key.
+func NewES256Signer(key *ecdsa.PrivateKey, opts ...Option) (encoding.MarshalUnmarshaler, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, errors.New("internal/encoding: es256 requires a P-256 key")
+	}
+	return newSigner(jose.ES256, key, &key.PublicKey, opts...)
+}
+
+// NewES256Verifier creates an ECDSA P-256 SHA256 JWT verifier, which can
+// unmarshal but not marshal JWTs.
+func NewES256Verifier(key *ecdsa.PublicKey) (encoding.MarshalUnmarshaler, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, errors.New("internal/encoding: es256 requires a P-256 key")
+	}
+	return &JSONWebSigner{key: key}, nil
+}
+
+// NewEdDSASigner creates an Ed25519 JWT signer. Signed JWTs can be verified by
+// a verifier created with NewEdDSAVerifier from the public key.
+func NewEdDSASigner(key ed25519.PrivateKey, opts ...Option) (encoding.MarshalUnmarshaler, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("internal/encoding: invalid ed25519 private key")
+	}
+	return newSigner(jose.EdDSA, key, key.Public(), opts...)
+}
+
+// NewEdDSAVerifier creates an Ed25519 JWT verifier, which can unmarshal but
+// not marshal JWTs.
+func NewEdDSAVerifier(key ed25519.PublicKey) (encoding.MarshalUnmarshaler, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("internal/encoding: invalid ed25519 public key")
+	}
+	return &JSONWebSigner{key: key}, nil
+}
+
+func newSigner(alg jose.SignatureAlgorithm, signingKey, verificationKey interface{}, opts ...Option) (encoding.MarshalUnmarshaler, error) {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: signingKey},
 		(&jose.SignerOptions{}).WithType("JWT"))
 	if err != nil {
 		return nil, err
 	}
-	return &JSONWebSigner{Signer: sig, key: key}, nil
+	s := &JSONWebSigner{Signer: sig, key: verificationKey}
+
+	if getOptions(opts...).compress {
+		s.compressedSigner, err = jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: signingKey},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader(zipHeader, zipDeflate))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 // Marshal signs, and serializes a JWT.
 func (c *JSONWebSigner) Marshal(x interface{}) ([]byte, error) {
+	if c.Signer == nil {
+		return nil, ErrVerifyOnly
+	}
+	if c.compressedSigner != nil {
+		return marshalCompressed(c.Signer, c.compressedSigner, x)
+	}
 	s, err := jwt.Signed(c.Signer).Claims(x).CompactSerialize()
 	return []byte(s), err
 }
 
-// Unmarshal parses and validates a signed JWT.
+// Unmarshal parses and validates a signed JWT. Compressed JWTs are
+// decompressed.
 func (c *JSONWebSigner) Unmarshal(value []byte, s interface{}) error {
 	tok, err := jwt.ParseSigned(string(value))
 	if err != nil {
 		return err
 	}
-	return tok.Claims(c.key, s)
+	return verifyClaims(tok, value, c.key, s)
 }
@@ -0,0 +1,93 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestAsymmetricSigners(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherEDPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	must := func(e encoding.MarshalUnmarshaler, err error) encoding.MarshalUnmarshaler {
+		require.NoError(t, err)
+		return e
+	}
+
+	for _, tc := range []struct {
+		name          string
+		signer        encoding.MarshalUnmarshaler
+		verifier      encoding.MarshalUnmarshaler
+		otherVerifier encoding.MarshalUnmarshaler
+	}{
+		{
+			"ES256",
+			must(NewES256Signer(ecKey)),
+			must(NewES256Verifier(&ecKey.PublicKey)),
+			must(NewES256Verifier(&otherECKey.PublicKey)),
+		},
+		{
+			"EdDSA",
+			must(NewEdDSASigner(edKey)),
+			must(NewEdDSAVerifier(edPublicKey)),
+			must(NewEdDSAVerifier(otherEDPublicKey)),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := tc.signer.Marshal(map[string]interface{}{"sub": "user"})
+			require.NoError(t, err)
+
+			var claims map[string]string
+			assert.NoError(t, tc.signer.Unmarshal(raw, &claims))
+			assert.Equal(t, "user", claims["sub"])
+
+			claims = nil
+			assert.NoError(t, tc.verifier.Unmarshal(raw, &claims))
+			assert.Equal(t, "user", claims["sub"])
+
+			assert.Error(t, tc.otherVerifier.Unmarshal(raw, &claims))
+
+			_, err = tc.verifier.Marshal(map[string]interface{}{"sub": "user"})
+			assert.ErrorIs(t, err, ErrVerifyOnly)
+		})
+	}
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		hs256, err := NewHS256Signer(cryptutil.NewKey())
+		require.NoError(t, err)
+		raw, err := hs256.Marshal(map[string]interface{}{"sub": "user"})
+		require.NoError(t, err)
+
+		var claims map[string]string
+		assert.Error(t, must(NewES256Verifier(&ecKey.PublicKey)).Unmarshal(raw, &claims))
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.NoError(t, err)
+		_, err = NewES256Signer(p384Key)
+		assert.Error(t, err)
+		_, err = NewES256Verifier(nil)
+		assert.Error(t, err)
+		_, err = NewEdDSASigner(nil)
+		assert.Error(t, err)
+		_, err = NewEdDSAVerifier(ed25519.PublicKey("short"))
+		assert.Error(t, err)
+	})
+}
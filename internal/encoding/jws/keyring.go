@@ -0,0 +1,140 @@
+package jws
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+)
+
+// ErrUnknownKeyID is returned when unmarshaling a JWT signed by a key which
+// isn't in the keyring.
+var ErrUnknownKeyID = errors.New("internal/encoding: unknown key id")
+
+// A Keyring signs JWTs with its newest key and verifies JWTs signed by any of
+// its keys. Keys are identified by the kid header, so that signing keys can be
+// rotated without invalidating JWTs signed by previous keys.
+type Keyring struct {
+	signer jose.Signer
+	// keys are the verification keys, newest first
+	keys []jose.JSONWebKey
+}
+
+// NewKeyring creates a new Keyring from keys ordered from oldest to newest.
+// Each key must have a unique key id and an algorithm. If the newest key is a
+// public key the keyring can only verify JWTs.
+func NewKeyring(keys ...jose.JSONWebKey) (encoding.MarshalUnmarshaler, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("internal/encoding: at least one key is required")
+	}
+
+	kr := new(Keyring)
+	seen := make(map[string]struct{}, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		k := keys[i]
+		if k.KeyID == "" {
+			return nil, errors.New("internal/encoding: key id is required")
+		}
+		if _, ok := seen[k.KeyID]; ok {
+			return nil, fmt.Errorf("internal/encoding: duplicate key id: %s", k.KeyID)
+		}
+		seen[k.KeyID] = struct{}{}
+		if k.Algorithm == "" {
+			return nil, fmt.Errorf("internal/encoding: key %s is missing an algorithm", k.KeyID)
+		}
+
+		verificationKey, err := getVerificationKey(k)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys = append(kr.keys, verificationKey)
+	}
+
+	newest := keys[len(keys)-1]
+	if !newest.IsPublic() {
+		var err error
+		kr.signer, err = jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.SignatureAlgorithm(newest.Algorithm), Key: newest.Key},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", newest.KeyID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kr, nil
+}
+
+// NewHS256Keyring creates a new Keyring of HS256 keys ordered from oldest to
+// newest. Key ids are derived from the keys.
+func NewHS256Keyring(keys ...[]byte) (encoding.MarshalUnmarshaler, error) {
+	jwks := make([]jose.JSONWebKey, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, jose.JSONWebKey{
+			Key:       key,
+			KeyID:     getHS256KeyID(key),
+			Algorithm: string(jose.HS256),
+		})
+	}
+	return NewKeyring(jwks...)
+}
+
+// Marshal signs, and serializes a JWT with the newest key.
+func (kr *Keyring) Marshal(x interface{}) ([]byte, error) {
+	if kr.signer == nil {
+		return nil, ErrVerifyOnly
+	}
+	s, err := jwt.Signed(kr.signer).Claims(x).CompactSerialize()
+	return []byte(s), err
+}
+
+// Unmarshal parses and validates a JWT signed by any key in the keyring. JWTs
+// without a key id are verified against every key. Compressed JWTs are
+// decompressed.
+func (kr *Keyring) Unmarshal(value []byte, s interface{}) error {
+	tok, err := jwt.ParseSigned(string(value))
+	if err != nil {
+		return err
+	}
+	if len(tok.Headers) != 1 {
+		return errors.New("internal/encoding: unexpected number of signatures")
+	}
+
+	if kid := tok.Headers[0].KeyID; kid != "" {
+		for _, k := range kr.keys {
+			if k.KeyID == kid {
+				return verifyClaims(tok, value, k.Key, s)
+			}
+		}
+		return ErrUnknownKeyID
+	}
+
+	// JWTs signed before the key was added to a keyring don't have a key id
+	for _, k := range kr.keys {
+		err = verifyClaims(tok, value, k.Key, s)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func getVerificationKey(k jose.JSONWebKey) (jose.JSONWebKey, error) {
+	if _, ok := k.Key.([]byte); ok || k.IsPublic() {
+		return k, nil
+	}
+	pub := k.Public()
+	if !pub.Valid() {
+		return pub, fmt.Errorf("internal/encoding: unsupported key type for key %s: %T", k.KeyID, k.Key)
+	}
+	return pub, nil
+}
+
+func getHS256KeyID(key []byte) string {
+	h := sha256.Sum256(key)
+	return hex.EncodeToString(h[:8])
+}
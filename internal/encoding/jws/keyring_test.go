@@ -0,0 +1,89 @@
+package jws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestHS256Keyring(t *testing.T) {
+	oldKey, newKey := cryptutil.NewKey(), cryptutil.NewKey()
+
+	oldSigner, err := NewHS256Signer(oldKey)
+	require.NoError(t, err)
+	oldKeyring, err := NewHS256Keyring(oldKey)
+	require.NoError(t, err)
+	rotated, err := NewHS256Keyring(oldKey, newKey)
+	require.NoError(t, err)
+	newKeyring, err := NewHS256Keyring(newKey)
+	require.NoError(t, err)
+
+	claims := map[string]interface{}{"sub": "user"}
+	var out map[string]interface{}
+
+	// JWTs signed with the old key are still valid after rotation
+	raw, err := oldKeyring.Marshal(claims)
+	require.NoError(t, err)
+	assert.NoError(t, rotated.Unmarshal(raw, &out))
+	assert.Equal(t, "user", out["sub"])
+
+	// JWTs signed before the keyring existed have no key id
+	raw, err = oldSigner.Marshal(claims)
+	require.NoError(t, err)
+	assert.NoError(t, rotated.Unmarshal(raw, &out))
+
+	// new JWTs are signed with the newest key
+	raw, err = rotated.Marshal(claims)
+	require.NoError(t, err)
+	assert.NoError(t, newKeyring.Unmarshal(raw, &out))
+	assert.ErrorIs(t, oldKeyring.Unmarshal(raw, &out), ErrUnknownKeyID)
+	assert.Error(t, oldSigner.Unmarshal(raw, &out))
+}
+
+func TestKeyring(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := NewKeyring(
+		jose.JSONWebKey{Key: oldKey, KeyID: "old", Algorithm: string(jose.ES256)},
+		jose.JSONWebKey{Key: newKey, KeyID: "new", Algorithm: string(jose.ES256)},
+	)
+	require.NoError(t, err)
+	verifier, err := NewKeyring(
+		jose.JSONWebKey{Key: &oldKey.PublicKey, KeyID: "old", Algorithm: string(jose.ES256)},
+		jose.JSONWebKey{Key: &newKey.PublicKey, KeyID: "new", Algorithm: string(jose.ES256)},
+	)
+	require.NoError(t, err)
+
+	raw, err := signer.Marshal(map[string]interface{}{"sub": "user"})
+	require.NoError(t, err)
+	var out map[string]interface{}
+	assert.NoError(t, verifier.Unmarshal(raw, &out))
+	assert.Equal(t, "user", out["sub"])
+
+	_, err = verifier.Marshal(out)
+	assert.ErrorIs(t, err, ErrVerifyOnly)
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewKeyring()
+		assert.Error(t, err)
+		_, err = NewKeyring(jose.JSONWebKey{Key: newKey, Algorithm: string(jose.ES256)})
+		assert.Error(t, err, "missing key id")
+		_, err = NewKeyring(jose.JSONWebKey{Key: newKey, KeyID: "new"})
+		assert.Error(t, err, "missing algorithm")
+		_, err = NewKeyring(
+			jose.JSONWebKey{Key: oldKey, KeyID: "new", Algorithm: string(jose.ES256)},
+			jose.JSONWebKey{Key: newKey, KeyID: "new", Algorithm: string(jose.ES256)},
+		)
+		assert.Error(t, err, "duplicate key id")
+	})
+}
@@ -0,0 +1,129 @@
+// Package geoip looks up the country and autonomous system of IP addresses
+// in MaxMind databases.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Result is the geolocation of an IP address.
+type Result struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country.
+	Country string
+	// ASN is the autonomous system number.
+	ASN uint64
+	// ASOrganization is the organization of the autonomous system.
+	ASOrganization string
+}
+
+// A Database looks up IP addresses in one or more MaxMind databases, e.g.
+// GeoLite2-Country and GeoLite2-ASN.
+type Database struct {
+	readers []*Reader
+}
+
+// NewDatabase creates a new Database from readers.
+func NewDatabase(readers ...*Reader) *Database {
+	return &Database{readers: readers}
+}
+
+// Lookup looks up the ip address. Each field is set from the first database
+// which has it.
+func (db *Database) Lookup(ip net.IP) (*Result, error) {
+	res := new(Result)
+	if db == nil {
+		return res, nil
+	}
+
+	for _, r := range db.readers {
+		raw, err := r.Lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		record, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if res.Country == "" {
+			res.Country = getCountry(record)
+		}
+		if res.ASN == 0 {
+			res.ASN, _ = record["autonomous_system_number"].(uint64)
+		}
+		if res.ASOrganization == "" {
+			res.ASOrganization, _ = record["autonomous_system_organization"].(string)
+		}
+	}
+	return res, nil
+}
+
+// getCountry returns the country of the record, or, for anonymous proxies and
+// the like, the country the network is registered in.
+func getCountry(record map[string]any) string {
+	for _, field := range []string{"country", "registered_country"} {
+		if country, ok := record[field].(map[string]any); ok {
+			if isoCode, ok := country["iso_code"].(string); ok && isoCode != "" {
+				return isoCode
+			}
+		}
+	}
+	return ""
+}
+
+type cachedReader struct {
+	modTime time.Time
+	size    int64
+	reader  *Reader
+}
+
+var readerCache = struct {
+	sync.Mutex
+	m map[string]cachedReader
+}{m: make(map[string]cachedReader)}
+
+// Open opens the databases at the paths. Empty paths are ignored. Databases
+// are only read again when their file changes.
+func Open(paths ...string) (*Database, error) {
+	db := new(Database)
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		r, err := openReader(p)
+		if err != nil {
+			return nil, err
+		}
+		db.readers = append(db.readers, r)
+	}
+	return db, nil
+}
+
+func openReader(path string) (*Reader, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: error opening database: %w", err)
+	}
+
+	readerCache.Lock()
+	defer readerCache.Unlock()
+
+	if c, ok := readerCache.m[path]; ok && c.modTime.Equal(fi.ModTime()) && c.size == fi.Size() {
+		return c.reader, nil
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: error reading database: %w", err)
+	}
+	r, err := NewReader(bs)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: error reading database %s: %w", path, err)
+	}
+	readerCache.m[path] = cachedReader{modTime: fi.ModTime(), size: fi.Size(), reader: r}
+	return r, nil
+}
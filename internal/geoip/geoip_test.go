@@ -0,0 +1,154 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/geoip/geoiptest"
+)
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	networks := map[string]map[string]any{
+		"1.2.3.0/24": {
+			"country": map[string]any{"iso_code": "AU", "names": map[string]any{"en": "Australia"}},
+		},
+		"8.8.8.0/24": {
+			"autonomous_system_number":       uint64(15169),
+			"autonomous_system_organization": "GOOGLE",
+			"is_anycast":                     true,
+			"location":                       map[string]any{"latitude": 37.751},
+			"tags":                           []any{"a", "b"},
+		},
+		"2001:db8::/32": {
+			"country": map[string]any{"iso_code": "DE"},
+		},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		bs, err := geoiptest.Build(recordSize, networks)
+		require.NoError(t, err)
+		r, err := NewReader(bs)
+		require.NoError(t, err, "record size %d", recordSize)
+		assert.Equal(t, Metadata{DatabaseType: "Test", IPVersion: 6, NodeCount: r.Metadata().NodeCount, RecordSize: uint64(recordSize)}, r.Metadata())
+
+		v, err := r.Lookup(net.ParseIP("1.2.3.4"))
+		assert.NoError(t, err)
+		assert.Equal(t, networks["1.2.3.0/24"], v)
+
+		v, err = r.Lookup(net.ParseIP("8.8.8.8"))
+		assert.NoError(t, err)
+		assert.Equal(t, networks["8.8.8.0/24"], v)
+
+		v, err = r.Lookup(net.ParseIP("2001:db8::1"))
+		assert.NoError(t, err)
+		assert.Equal(t, networks["2001:db8::/32"], v)
+
+		for _, ip := range []string{"1.2.4.1", "127.0.0.1", "2001:db9::1"} {
+			v, err = r.Lookup(net.ParseIP(ip))
+			assert.NoError(t, err)
+			assert.Nil(t, v, ip)
+		}
+	}
+
+	_, err := NewReader([]byte("not a database"))
+	assert.Error(t, err)
+}
+
+func TestDecoder(t *testing.T) {
+	t.Parallel()
+
+	d := &decoder{buf: []byte{
+		// 0: "hello"
+		0x45, 'h', 'e', 'l', 'l', 'o',
+		// 6: map with a pointer to "hello" as the key and an int32 of -1
+		0xe1, 0x20, 0x00, 0x04, 0x01, 0xff, 0xff, 0xff, 0xff,
+		// 15: uint128 of 1
+		0x01, 0x03, 0x01,
+		// 18: pointer to a pointer
+		0x20, 0x07,
+	}}
+
+	v, next, err := d.decode(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", v)
+	assert.Equal(t, uint64(6), next)
+
+	v, next, err = d.decode(6, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"hello": int64(-1)}, v)
+	assert.Equal(t, uint64(15), next)
+
+	v, _, err = d.decode(15, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", v.(interface{ String() string }).String())
+
+	_, _, err = d.decode(18, 0)
+	assert.Error(t, err)
+
+	_, _, err = (&decoder{buf: []byte{0x45, 'h'}}).decode(0, 0)
+	assert.Error(t, err)
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	countryPath := filepath.Join(dir, "country.mmdb")
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	writeDatabase := func(path string, networks map[string]map[string]any) {
+		bs, err := geoiptest.Build(24, networks)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, bs, 0o600))
+	}
+	writeDatabase(countryPath, map[string]map[string]any{
+		"1.2.3.0/24": {"country": map[string]any{"iso_code": "AU"}},
+		"1.2.4.0/24": {"registered_country": map[string]any{"iso_code": "NZ"}},
+	})
+	writeDatabase(asnPath, map[string]map[string]any{
+		"1.2.0.0/16": {"autonomous_system_number": uint64(13335), "autonomous_system_organization": "CLOUDFLARENET"},
+	})
+
+	db, err := Open(countryPath, "", asnPath)
+	require.NoError(t, err)
+
+	res, err := db.Lookup(net.ParseIP("1.2.3.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{Country: "AU", ASN: 13335, ASOrganization: "CLOUDFLARENET"}, res)
+
+	res, err = db.Lookup(net.ParseIP("1.2.4.4"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{Country: "NZ", ASN: 13335, ASOrganization: "CLOUDFLARENET"}, res)
+
+	res, err = db.Lookup(net.ParseIP("9.9.9.9"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{}, res)
+
+	t.Run("cached", func(t *testing.T) {
+		db2, err := Open(countryPath)
+		require.NoError(t, err)
+		assert.Same(t, db.readers[0], db2.readers[0])
+	})
+	t.Run("reload", func(t *testing.T) {
+		writeDatabase(countryPath, map[string]map[string]any{
+			"1.2.3.0/24": {"country": map[string]any{"iso_code": "US"}},
+		})
+		require.NoError(t, os.Chtimes(countryPath, time.Now(), time.Now().Add(time.Minute)))
+
+		db, err := Open(countryPath)
+		require.NoError(t, err)
+		res, err := db.Lookup(net.ParseIP("1.2.3.4"))
+		assert.NoError(t, err)
+		assert.Equal(t, "US", res.Country)
+	})
+	t.Run("missing", func(t *testing.T) {
+		_, err := Open(filepath.Join(dir, "missing.mmdb"))
+		assert.Error(t, err)
+	})
+}
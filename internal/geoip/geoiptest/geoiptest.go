@@ -0,0 +1,209 @@
+// Package geoiptest builds MaxMind databases for tests.
+package geoiptest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+)
+
+// Build builds an IPv6 MaxMind database with the given record size (24, 28
+// or 32), which maps networks in CIDR notation to records. IPv4 networks are
+// stored as ::a.b.c.d, and networks must not overlap. Record values may be
+// maps, arrays, strings, bools, float64s and uint64s.
+func Build(recordSize int, networks map[string]map[string]any) ([]byte, error) {
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size: %d", recordSize)
+	}
+
+	var data bytes.Buffer
+	root := new(node)
+
+	// insert the networks in a stable order
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ones, _ := n.Mask.Size()
+		addr := n.IP.To16()
+		if n.IP.To4() != nil {
+			ones += 96
+			addr = append(make([]byte, 12), n.IP.To4()...)
+		}
+
+		offset := data.Len()
+		if err := encode(&data, networks[cidr]); err != nil {
+			return nil, err
+		}
+
+		cur := root
+		for i := 0; i < ones; i++ {
+			bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+			if cur.children[bit] == nil {
+				cur.children[bit] = new(node)
+			}
+			cur = cur.children[bit]
+		}
+		cur.children = [2]*node{}
+		cur.dataOffset = offset + 1
+	}
+
+	// number the inner nodes breadth first
+	var nodes []*node
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && c.dataOffset == 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	nodeCount := len(nodes)
+
+	var tree bytes.Buffer
+	for _, n := range nodes {
+		var records [2]uint32
+		for i, c := range n.children {
+			switch {
+			case c == nil:
+				records[i] = uint32(nodeCount)
+			case c.dataOffset > 0:
+				records[i] = uint32(nodeCount + 16 + c.dataOffset - 1)
+			default:
+				records[i] = uint32(c.id)
+			}
+		}
+		writeNode(&tree, recordSize, records)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree.Bytes())
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	err := encode(&buf, map[string]any{
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"database_type":               "Test",
+		"ip_version":                  uint64(6),
+		"node_count":                  uint64(nodeCount),
+		"record_size":                 uint64(recordSize),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type node struct {
+	id         int
+	children   [2]*node
+	dataOffset int // the offset of the record + 1, for leaves
+}
+
+func writeNode(w *bytes.Buffer, recordSize int, records [2]uint32) {
+	l, r := records[0], records[1]
+	switch recordSize {
+	case 24:
+		w.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+	case 28:
+		w.Write([]byte{
+			byte(l >> 16), byte(l >> 8), byte(l),
+			byte((l>>24)&0x0f)<<4 | byte((r>>24)&0x0f),
+			byte(r >> 16), byte(r >> 8), byte(r),
+		})
+	default:
+		_ = binary.Write(w, binary.BigEndian, records)
+	}
+}
+
+func encode(w *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		writeControl(w, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encode(w, k); err != nil {
+				return err
+			}
+			if err := encode(w, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		writeControl(w, 11, len(v))
+		for _, e := range v {
+			if err := encode(w, e); err != nil {
+				return err
+			}
+		}
+	case string:
+		writeControl(w, 2, len(v))
+		w.WriteString(v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(w, 14, size)
+	case float64:
+		writeControl(w, 3, 8)
+		_ = binary.Write(w, binary.BigEndian, math.Float64bits(v))
+	case uint64:
+		var b []byte
+		for x := v; x > 0; x >>= 8 {
+			b = append([]byte{byte(x)}, b...)
+		}
+		writeControl(w, 9, len(b))
+		w.Write(b)
+	default:
+		return fmt.Errorf("unsupported type: %T", v)
+	}
+	return nil
+}
+
+func writeControl(w *bytes.Buffer, typ, size int) {
+	var ctrl byte
+	var extended []byte
+	if typ <= 7 {
+		ctrl = byte(typ) << 5
+	} else {
+		extended = []byte{byte(typ - 7)}
+	}
+
+	switch {
+	case size < 29:
+		w.WriteByte(ctrl | byte(size))
+		w.Write(extended)
+	case size < 285:
+		w.WriteByte(ctrl | 29)
+		w.Write(extended)
+		w.WriteByte(byte(size - 29))
+	case size < 65821:
+		w.WriteByte(ctrl | 30)
+		w.Write(extended)
+		_ = binary.Write(w, binary.BigEndian, uint16(size-285))
+	default:
+		s := size - 65821
+		w.WriteByte(ctrl | 31)
+		w.Write(extended)
+		w.Write([]byte{byte(s >> 16), byte(s >> 8), byte(s)})
+	}
+}
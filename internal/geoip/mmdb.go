@@ -0,0 +1,369 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+)
+
+// metadataStartMarker precedes the metadata at the end of the database.
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparatorSize is the size of the zeros between the search tree
+// and the data section.
+const dataSectionSeparatorSize = 16
+
+// maxDecodeDepth limits the nesting of maps and arrays.
+const maxDecodeDepth = 32
+
+// data types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Metadata is the metadata of a MaxMind database.
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint64
+	NodeCount    uint64
+	RecordSize   uint64
+}
+
+// A Reader reads a database in the MaxMind DB format.
+//
+// https://maxmind.github.io/MaxMind-DB/
+type Reader struct {
+	metadata Metadata
+
+	tree              []byte
+	data              decoder
+	nodeByteSize      uint64
+	ipv4Start         uint64
+	ipv4StartBitDepth int
+}
+
+// NewReader creates a new Reader for the raw database.
+func NewReader(buf []byte) (*Reader, error) {
+	metadataStart := bytes.LastIndex(buf, metadataStartMarker)
+	if metadataStart < 0 {
+		return nil, fmt.Errorf("geoip: invalid database: metadata not found")
+	}
+
+	raw, _, err := (&decoder{buf: buf[metadataStart+len(metadataStartMarker):]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: invalid database metadata: %w", err)
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("geoip: invalid database metadata: expected map, got %T", raw)
+	}
+
+	r := new(Reader)
+	r.metadata.DatabaseType, _ = m["database_type"].(string)
+	r.metadata.IPVersion, _ = m["ip_version"].(uint64)
+	r.metadata.NodeCount, _ = m["node_count"].(uint64)
+	r.metadata.RecordSize, _ = m["record_size"].(uint64)
+
+	switch r.metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size: %d", r.metadata.RecordSize)
+	}
+	if r.metadata.IPVersion != 4 && r.metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported ip version: %d", r.metadata.IPVersion)
+	}
+
+	r.nodeByteSize = r.metadata.RecordSize / 4
+	treeSize := r.metadata.NodeCount * r.nodeByteSize
+	if treeSize+dataSectionSeparatorSize > uint64(metadataStart) {
+		return nil, fmt.Errorf("geoip: invalid database: search tree exceeds the database size")
+	}
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+dataSectionSeparatorSize : metadataStart]}
+
+	// IPv4 addresses are stored in IPv6 databases as ::a.b.c.d
+	if r.metadata.IPVersion == 6 {
+		for r.ipv4StartBitDepth < 96 && r.ipv4Start < r.metadata.NodeCount {
+			r.ipv4Start = r.readNode(r.ipv4Start, 0)
+			r.ipv4StartBitDepth++
+		}
+	}
+
+	return r, nil
+}
+
+// Metadata returns the metadata of the database.
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup returns the data for the ip, or nil if the database has no data for
+// it.
+func (r *Reader) Lookup(ip net.IP) (any, error) {
+	var addr []byte
+	node := uint64(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		addr = ip4
+		if r.metadata.IPVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if ip16 := ip.To16(); ip16 != nil {
+		if r.metadata.IPVersion == 4 {
+			return nil, nil
+		}
+		addr = ip16
+	} else {
+		return nil, fmt.Errorf("geoip: invalid ip address: %s", ip)
+	}
+
+	nodeCount := r.metadata.NodeCount
+	for i := 0; i < len(addr)*8 && node < nodeCount; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		node = r.readNode(node, bit)
+	}
+
+	switch {
+	case node == nodeCount:
+		return nil, nil
+	case node < nodeCount:
+		return nil, fmt.Errorf("geoip: invalid database: search tree is deeper than the address")
+	}
+
+	offset := node - nodeCount - dataSectionSeparatorSize
+	v, _, err := r.data.decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: invalid database record: %w", err)
+	}
+	return v, nil
+}
+
+// readNode reads the left (0) or right (1) record of a node.
+func (r *Reader) readNode(node uint64, bit byte) uint64 {
+	b := r.tree[node*r.nodeByteSize : (node+1)*r.nodeByteSize]
+	switch r.metadata.RecordSize {
+	case 24:
+		if bit == 0 {
+			return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+	case 28:
+		if bit == 0 {
+			return uint64(b[3]&0xf0)<<20 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3]&0x0f)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+	default:
+		if bit == 0 {
+			return uint64(binary.BigEndian.Uint32(b[:4]))
+		}
+		return uint64(binary.BigEndian.Uint32(b[4:]))
+	}
+}
+
+var errUnexpectedEOF = errors.New("unexpected end of data")
+
+// decoder decodes the data section. Maps are decoded as map[string]any,
+// arrays as []any, unsigned integers up to 64 bits as uint64, int32 as int64
+// and uint128 as *big.Int.
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) decode(offset uint64, depth int) (any, uint64, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("exceeded maximum depth")
+	}
+
+	typ, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// pointers may not point to other pointers
+		typ, size, valueOffset, err := d.decodeControl(pointer)
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ == typePointer {
+			return nil, 0, fmt.Errorf("invalid pointer to a pointer")
+		}
+		v, _, err := d.decodeValue(typ, size, valueOffset, depth)
+		return v, next, err
+	}
+
+	return d.decodeValue(typ, size, offset, depth)
+}
+
+// decodeControl decodes a control byte, returning the type, the size (or the
+// raw control byte for pointers) and the offset of the value.
+func (d *decoder) decodeControl(offset uint64) (typ byte, size uint64, next uint64, err error) {
+	if offset >= uint64(len(d.buf)) {
+		return 0, 0, 0, errUnexpectedEOF
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ = ctrl >> 5
+	if typ == typePointer {
+		return typ, uint64(ctrl), offset, nil
+	}
+	if typ == typeExtended {
+		if offset >= uint64(len(d.buf)) {
+			return 0, 0, 0, errUnexpectedEOF
+		}
+		typ = 7 + d.buf[offset]
+		offset++
+	}
+
+	size = uint64(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint64(len(d.buf)) {
+			return 0, 0, 0, errUnexpectedEOF
+		}
+		v := uintFromBytes(d.buf[offset : offset+n])
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + v
+		case 2:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+	return typ, size, offset, nil
+}
+
+func (d *decoder) decodePointer(ctrl uint64, offset uint64) (pointer uint64, next uint64, err error) {
+	ss := (ctrl >> 3) & 0x3
+	n := ss + 1
+	if offset+n > uint64(len(d.buf)) {
+		return 0, 0, errUnexpectedEOF
+	}
+	v := uintFromBytes(d.buf[offset : offset+n])
+	vvv := ctrl & 0x7
+	switch ss {
+	case 0:
+		pointer = vvv<<8 | v
+	case 1:
+		pointer = (vvv<<16 | v) + 2048
+	case 2:
+		pointer = (vvv<<24 | v) + 526336
+	default:
+		pointer = v
+	}
+	return pointer, offset + n, nil
+}
+
+func (d *decoder) decodeValue(typ byte, size uint64, offset uint64, depth int) (any, uint64, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint64(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("invalid map key type: %T", k)
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := uint64(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid boolean size: %d", size)
+		}
+		return size == 1, offset, nil
+	}
+
+	if offset+size > uint64(len(d.buf)) {
+		return nil, 0, errUnexpectedEOF
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size: %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size: %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		maxSize := map[byte]uint64{typeUint16: 2, typeUint32: 4, typeUint64: 8}[typ]
+		if size > maxSize {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size: %d", size)
+		}
+		return uintFromBytes(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size: %d", size)
+		}
+		return int64(int32(uint32(uintFromBytes(b)))), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size: %d", size)
+		}
+		return new(big.Int).SetBytes(b), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported data type: %d", typ)
+}
+
+func uintFromBytes(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
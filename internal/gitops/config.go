@@ -0,0 +1,56 @@
+package gitops
+
+import (
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type syncerConfig struct {
+	dataBrokerClient databroker.DataBrokerServiceClient
+	options          *config.GitOpsOptions
+	fetch            fetchFunc
+	now              func() time.Time
+}
+
+func newSyncerConfig(options ...Option) *syncerConfig {
+	cfg := new(syncerConfig)
+	WithNow(time.Now)(cfg)
+	withFetch(fetch)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// An Option customizes the configuration used for the gitops syncer.
+type Option func(*syncerConfig)
+
+// WithDataBrokerClient sets the databroker client in the config.
+func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
+	return func(cfg *syncerConfig) {
+		cfg.dataBrokerClient = dataBrokerClient
+	}
+}
+
+// WithOptions sets the gitops options. If they are nil, the routes of the
+// repository are removed.
+func WithOptions(options *config.GitOpsOptions) Option {
+	return func(cfg *syncerConfig) {
+		cfg.options = options
+	}
+}
+
+// WithNow customizes the time.Now function used by the syncer.
+func WithNow(now func() time.Time) Option {
+	return func(cfg *syncerConfig) {
+		cfg.now = now
+	}
+}
+
+func withFetch(fetch fetchFunc) Option {
+	return func(cfg *syncerConfig) {
+		cfg.fetch = fetch
+	}
+}
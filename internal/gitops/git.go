@@ -0,0 +1,55 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+// A fetchFunc fetches the latest commit of the branch of a repository into a
+// working tree in the directory, and returns the commit hash.
+type fetchFunc func(ctx context.Context, dir string, options *config.GitOpsOptions) (commit string, err error)
+
+// fetch fetches a commit with the git command line. Only the latest commit
+// is fetched.
+func fetch(ctx context.Context, dir string, options *config.GitOpsOptions) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := runGit(ctx, "", "init", "--quiet", dir); err != nil {
+			return "", err
+		}
+	}
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "--depth", "1", "--no-tags", "--",
+		options.Repository, "refs/heads/"+options.GetBranch()); err != nil {
+		return "", err
+	}
+	commit, err := runGit(ctx, dir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", err
+	}
+	if _, err := runGit(ctx, dir, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	command := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// never prompt for credentials
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("gitops: git %s: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,272 @@
+// Package gitops synchronizes the routes defined in a git repository into the
+// databroker config.
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/log"
+	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/gitops"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// ConfigRecordID is the id of the databroker config record which stores the
+// routes of the repository.
+const ConfigRecordID = "gitops"
+
+// maxWait is the maximum time the syncer waits before checking the options
+// again, so that configuration changes are picked up.
+const maxWait = time.Minute
+
+// A Syncer syncs the routes of the latest commit of a branch of a git
+// repository into the databroker config. Routes are validated before they
+// are applied, if any is invalid the routes of the previous commit are kept.
+// The status of every commit is stored as a CommitStatus record.
+type Syncer struct {
+	cfg *atomicutil.Value[*syncerConfig]
+
+	// these are only used by the leased syncer
+	options  *config.GitOpsOptions
+	commit   string
+	nextSync time.Time
+	cleared  bool
+}
+
+// NewSyncer creates a new Syncer.
+func NewSyncer(options ...Option) *Syncer {
+	s := &Syncer{
+		cfg: atomicutil.NewValue(newSyncerConfig()),
+	}
+	s.UpdateConfig(options...)
+	return s
+}
+
+// UpdateConfig updates the syncer with the new options.
+func (s *Syncer) UpdateConfig(options ...Option) {
+	s.cfg.Store(newSyncerConfig(options...))
+}
+
+// Run runs the syncer. This method blocks until an error occurs or the given context is canceled.
+func (s *Syncer) Run(ctx context.Context) error {
+	leaser := databroker.NewLeaser("gitops_syncer", time.Second*30, s)
+	return leaser.Run(ctx)
+}
+
+// RunLeased runs the syncer when a lease is acquired.
+func (s *Syncer) RunLeased(ctx context.Context) error {
+	ctx = log.WithContext(ctx, func(c zerolog.Context) zerolog.Context {
+		return c.Str("service", "gitops_syncer")
+	})
+
+	dir, err := os.MkdirTemp("", "pomerium-gitops-")
+	if err != nil {
+		return fmt.Errorf("gitops: error creating working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// start from scratch with the new working directory
+	s.options, s.commit, s.nextSync = nil, "", time.Time{}
+
+	for {
+		wait, err := s.runOnce(ctx, s.cfg.Load(), dir)
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("gitops: error syncing routes")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// GetDataBrokerServiceClient gets the databroker client.
+func (s *Syncer) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return s.cfg.Load().dataBrokerClient
+}
+
+// runOnce syncs the latest commit, if it's due, and returns how long to wait
+// until the next sync is due.
+func (s *Syncer) runOnce(ctx context.Context, cfg *syncerConfig, dir string) (time.Duration, error) {
+	now := cfg.now()
+
+	if cfg.options == nil {
+		// remove the routes once gitops is disabled
+		if s.cleared {
+			return maxWait, nil
+		}
+		_, err := cfg.dataBrokerClient.Put(ctx, &databroker.PutRequest{
+			Records: []*databroker.Record{{
+				Type:      grpcutil.GetTypeURL(new(configpb.Config)),
+				Id:        ConfigRecordID,
+				Data:      protoutil.NewAny(&configpb.Config{Name: ConfigRecordID}),
+				DeletedAt: timestamppb.New(now),
+			}},
+		})
+		if err != nil {
+			return maxWait, fmt.Errorf("gitops: error removing routes: %w", err)
+		}
+		s.options, s.commit, s.cleared = nil, "", true
+		return maxWait, nil
+	}
+
+	options := *cfg.options
+	changed := s.options == nil || *s.options != options
+	if !changed && now.Before(s.nextSync) {
+		return minDuration(s.nextSync.Sub(now), maxWait), nil
+	}
+	s.nextSync = now.Add(options.GetPollInterval())
+	wait := minDuration(options.GetPollInterval(), maxWait)
+
+	commit, err := cfg.fetch(ctx, dir, &options)
+	if err != nil {
+		return wait, err
+	}
+	if !changed && commit == s.commit {
+		return wait, nil
+	}
+
+	status := &gitops.CommitStatus{
+		Id:         commit,
+		Repository: redactRepository(options.Repository),
+		Branch:     options.GetBranch(),
+		Path:       options.Path,
+		SyncedAt:   timestamppb.New(now),
+	}
+	var records []*databroker.Record
+	routes, err := loadRoutes(dir, options.Path)
+	if err != nil {
+		status.State = gitops.CommitStatus_INVALID
+		status.Message = err.Error()
+	} else {
+		status.State = gitops.CommitStatus_APPLIED
+		status.Routes = int32(len(routes))
+		records = append(records, &databroker.Record{
+			Type: grpcutil.GetTypeURL(new(configpb.Config)),
+			Id:   ConfigRecordID,
+			Data: protoutil.NewAny(&configpb.Config{Name: ConfigRecordID, Routes: routes}),
+		})
+	}
+	records = append(records, databroker.NewRecord(status))
+	if _, err := cfg.dataBrokerClient.Put(ctx, &databroker.PutRequest{Records: records}); err != nil {
+		return wait, fmt.Errorf("gitops: error storing routes: %w", err)
+	}
+	s.options, s.commit, s.cleared = &options, commit, false
+
+	evt := log.Info(ctx)
+	if status.State != gitops.CommitStatus_APPLIED {
+		evt = log.Warn(ctx).Str("error", status.Message)
+	}
+	evt.Str("repository", status.Repository).
+		Str("branch", status.Branch).
+		Str("commit", commit).
+		Str("state", status.State.String()).
+		Int32("routes", status.Routes).
+		Msg("gitops: synced routes")
+
+	return wait, nil
+}
+
+// loadRoutes loads and validates the routes of the file or directory at the
+// path of the working tree.
+func loadRoutes(dir, path string) ([]*configpb.Route, error) {
+	root := filepath.Join(dir, filepath.FromSlash(path))
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+
+	var files []string
+	if info.IsDir() {
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".yaml", ".yml", ".json":
+				if !d.IsDir() {
+					files = append(files, p)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	} else {
+		files = []string{root}
+	}
+
+	var routes []*configpb.Route
+	seen := make(map[uint64]string)
+	for _, file := range files {
+		name, _ := filepath.Rel(dir, file)
+		name = filepath.ToSlash(name)
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		policies, err := config.ParseRoutes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for i := range policies {
+			policy := &policies[i]
+			if err := policy.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: route %d: %w", name, i, err)
+			}
+			id, err := policy.RouteID()
+			if err != nil {
+				return nil, fmt.Errorf("%s: route %d: %w", name, i, err)
+			}
+			if other, ok := seen[id]; ok {
+				return nil, fmt.Errorf("%s: route %d: duplicate of a route in %s", name, i, other)
+			}
+			seen[id] = name
+			route, err := policy.ToProto()
+			if err != nil {
+				return nil, fmt.Errorf("%s: route %d: %w", name, i, err)
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+// redactRepository removes the password from the url of a repository.
+func redactRepository(repository string) string {
+	u, err := url.Parse(repository)
+	if err != nil || u.User == nil {
+		return repository
+	}
+	return u.Redacted()
+}
+
+func minDuration(x, y time.Duration) time.Duration {
+	if x < y {
+		return x
+	}
+	return y
+}
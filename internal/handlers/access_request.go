@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/ui"
+)
+
+// AccessRequestData is the data for the AccessRequest page.
+type AccessRequestData struct {
+	// RouteURL is the url of the route to request access to, when no
+	// access request has been created yet.
+	RouteURL        string
+	Durations       []time.Duration
+	DefaultDuration time.Duration
+	// AccessRequest is the access request to show.
+	AccessRequest *user.AccessRequest
+	// CanDecide is true if the user may approve or deny the access request.
+	CanDecide bool
+	Error     string
+}
+
+// ToJSON converts the data into a JSON map.
+func (data AccessRequestData) ToJSON() map[string]interface{} {
+	durations := make([]string, 0, len(data.Durations))
+	for _, d := range data.Durations {
+		durations = append(durations, formatDuration(d))
+	}
+	m := map[string]interface{}{
+		"routeUrl":        data.RouteURL,
+		"durations":       durations,
+		"defaultDuration": formatDuration(data.DefaultDuration),
+		"canDecide":       data.CanDecide,
+		"error":           data.Error,
+	}
+	if req := data.AccessRequest; req != nil {
+		accessRequest := map[string]interface{}{
+			"id":        req.GetId(),
+			"userId":    req.GetUserId(),
+			"email":     req.GetEmail(),
+			"routeUrl":  req.GetRouteUrl(),
+			"reason":    req.GetReason(),
+			"duration":  formatDuration(req.GetDuration().AsDuration()),
+			"state":     req.GetState().String(),
+			"createdAt": req.GetCreatedAt().AsTime(),
+		}
+		if req.GetDecidedAt() != nil {
+			accessRequest["decidedAt"] = req.GetDecidedAt().AsTime()
+		}
+		if req.GetExpiresAt() != nil {
+			accessRequest["expiresAt"] = req.GetExpiresAt().AsTime()
+		}
+		m["accessRequest"] = accessRequest
+	}
+	return m
+}
+
+// AccessRequest returns a handler that renders the page where users request
+// access to a route, and where approvers approve or deny access requests.
+func AccessRequest(data AccessRequestData) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ui.ServePage(w, r, "AccessRequest", data.ToJSON())
+	})
+}
+
+// formatDuration formats a duration without its zero minutes and seconds,
+// e.g. 1h instead of 1h0m0s.
+func formatDuration(d time.Duration) string {
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
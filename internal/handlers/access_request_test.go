@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDuration(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		duration time.Duration
+		expect   string
+	}{
+		{15 * time.Minute, "15m"},
+		{time.Hour, "1h"},
+		{90 * time.Minute, "1h30m"},
+		{90 * time.Second, "1m30s"},
+		{24 * time.Hour, "24h"},
+	} {
+		assert.Equal(t, tc.expect, formatDuration(tc.duration), tc.duration)
+	}
+}
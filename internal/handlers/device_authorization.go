@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/ui"
+)
+
+// DeviceAuthorizationData is the data for the DeviceAuthorization page.
+type DeviceAuthorizationData struct {
+	UserCode string
+	Error    string
+}
+
+// ToJSON converts the data into a JSON map.
+func (data DeviceAuthorizationData) ToJSON() map[string]interface{} {
+	return map[string]interface{}{
+		"userCode": data.UserCode,
+		"error":    data.Error,
+	}
+}
+
+// DeviceAuthorization returns a handler that renders the page where users
+// enter the user code of a device.
+func DeviceAuthorization(data DeviceAuthorizationData) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ui.ServePage(w, r, "DeviceAuthorization", data.ToJSON())
+	})
+}
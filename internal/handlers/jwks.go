@@ -30,6 +30,13 @@ func JWKSHandler(signingKey []byte) http.Handler {
 			for _, k := range ks {
 				jwks.Keys = append(jwks.Keys, *k)
 			}
+			hks, err := cryptutil.HybridPublicJWKsFromBytes(signingKey)
+			if err != nil {
+				return httputil.NewError(http.StatusInternalServerError, errors.New("bad signing key"))
+			}
+			for _, k := range hks {
+				jwks.Keys = append(jwks.Keys, *k)
+			}
 		}
 
 		bs, err := json.Marshal(jwks)
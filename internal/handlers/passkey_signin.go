@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/ui"
+	"github.com/pomerium/webauthn"
+)
+
+// PasskeySignInData is the data for the PasskeySignIn page.
+type PasskeySignInData struct {
+	State               string
+	SelfURL             string
+	Error               string
+	RegistrationEnabled bool
+	RequestOptions      *webauthn.PublicKeyCredentialRequestOptions
+
+	// set once a user asked to register a passkey
+	Username        string
+	RecoveryCode    string
+	CreationOptions *webauthn.PublicKeyCredentialCreationOptions
+
+	// set once a user registered their first passkey
+	RecoveryCodes []string
+	ContinueURL   string
+}
+
+// ToJSON converts the data into a JSON map.
+func (data PasskeySignInData) ToJSON() map[string]interface{} {
+	m := map[string]interface{}{
+		"state":               data.State,
+		"selfUrl":             data.SelfURL,
+		"error":               data.Error,
+		"registrationEnabled": data.RegistrationEnabled,
+		"username":            data.Username,
+		"recoveryCode":        data.RecoveryCode,
+		"recoveryCodes":       data.RecoveryCodes,
+		"continueUrl":         data.ContinueURL,
+	}
+	if data.RequestOptions != nil {
+		m["requestOptions"] = data.RequestOptions
+	}
+	if data.CreationOptions != nil {
+		m["creationOptions"] = data.CreationOptions
+	}
+	return m
+}
+
+// PasskeySignIn returns a handler that renders the passkey sign in page.
+func PasskeySignIn(data PasskeySignInData) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ui.ServePage(w, r, "PasskeySignIn", data.ToJSON())
+	})
+}
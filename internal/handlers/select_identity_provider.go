@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/ui"
+)
+
+// IdentityProviderChoice is an identity provider users may choose to sign
+// in with.
+type IdentityProviderChoice struct {
+	Name string
+	URL  string
+}
+
+// SelectIdentityProviderData is the data for the SelectIdentityProvider page.
+type SelectIdentityProviderData struct {
+	IdentityProviders []IdentityProviderChoice
+}
+
+// ToJSON converts the data into a JSON map.
+func (data SelectIdentityProviderData) ToJSON() map[string]interface{} {
+	idps := make([]map[string]interface{}, 0, len(data.IdentityProviders))
+	for _, idp := range data.IdentityProviders {
+		idps = append(idps, map[string]interface{}{
+			"name": idp.Name,
+			"url":  idp.URL,
+		})
+	}
+	return map[string]interface{}{
+		"identityProviders": idps,
+	}
+}
+
+// SelectIdentityProvider returns a handler that renders the identity provider
+// chooser page.
+func SelectIdentityProvider(data SelectIdentityProviderData) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ui.ServePage(w, r, "SelectIdentityProvider", data.ToJSON())
+	})
+}
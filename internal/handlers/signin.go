@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/ui"
+)
+
+// SignInData is the data for the SignIn page.
+type SignInData struct {
+	State    string
+	Username string
+	Error    string
+}
+
+// ToJSON converts the data into a JSON map.
+func (data SignInData) ToJSON() map[string]interface{} {
+	return map[string]interface{}{
+		"state":    data.State,
+		"username": data.Username,
+		"error":    data.Error,
+	}
+}
+
+// SignIn returns a handler that renders the username and password sign in page.
+func SignIn(data SignInData) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ui.ServePage(w, r, "SignIn", data.ToJSON())
+	})
+}
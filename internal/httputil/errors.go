@@ -97,6 +97,9 @@ func (e *HTTPError) ErrorResponse(ctx context.Context, w http.ResponseWriter, r
 	if response.DebugURL != nil {
 		m["debugUrl"] = response.DebugURL.String()
 	}
+	if u := contextutil.GetAccessRequestURL(ctx); u != nil && e.Status == http.StatusForbidden {
+		m["accessRequestUrl"] = u.String()
+	}
 	AddBrandingOptionsToMap(m, e.BrandingOptions)
 
 	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
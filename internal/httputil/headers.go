@@ -9,6 +9,8 @@ const (
 	HeaderReferrer         = "Referer"
 	HeaderImpersonateGroup = "Impersonate-Group"
 	HeaderUpgrade          = "Upgrade"
+	// HeaderForwardedClientCert is set by envoy to the client certificate.
+	HeaderForwardedClientCert = "X-Forwarded-Client-Cert"
 )
 
 // Pomerium headers contain information added to a request.
@@ -0,0 +1,249 @@
+// Package claimmap implements a small expression language which maps the
+// claims returned by an identity provider to new claims.
+//
+// An expression is one or more terms joined by +, which concatenates them. A
+// term is a string literal ("..."), a claim path (given_name,
+// realm_access.roles) or a function call:
+//
+//	claim("path")          the claim with the given path, for names which
+//	                       aren't valid identifiers
+//	default(a, b, ...)     the first argument which is not empty
+//	regex(value, pattern)  the first submatch of the pattern, or the whole
+//	                       match if it has no groups
+//	lower(value)           the value in lower case
+//	upper(value)           the value in upper case
+//	split(value, sep)      the value split into a list
+//	join(list, sep)        the list joined into a string
+//
+// Missing claims, non-matching patterns and type mismatches evaluate to
+// nothing, so that default can provide a fallback. regex, lower and upper are
+// applied to every element of a list.
+package claimmap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Mapping maps claims to new claims.
+type Mapping struct {
+	names []string
+	exprs map[string]expr
+}
+
+// Compile compiles the expressions of a mapping of claim names to
+// expressions.
+func Compile(src map[string]string) (*Mapping, error) {
+	m := &Mapping{exprs: make(map[string]expr, len(src))}
+	for name, s := range src {
+		e, err := parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("claimmap: invalid expression for %s: %w", name, err)
+		}
+		m.names = append(m.names, name)
+		m.exprs[name] = e
+	}
+	sort.Strings(m.names)
+	return m, nil
+}
+
+// Apply sets the mapped claims. Every expression is evaluated against the
+// original claims. Claims whose expression evaluates to nothing are left
+// unchanged.
+func (m *Mapping) Apply(claims map[string]any) {
+	for name, v := range m.Evaluate(claims) {
+		claims[name] = v
+	}
+}
+
+// Evaluate returns the mapped claims, without the claims whose expression
+// evaluates to nothing.
+func (m *Mapping) Evaluate(claims map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	values := make(map[string]any, len(m.names))
+	for _, name := range m.names {
+		if v := m.exprs[name].eval(claims); v != nil {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+type expr interface {
+	eval(claims map[string]any) any
+}
+
+type literal string
+
+func (e literal) eval(_ map[string]any) any { return string(e) }
+
+type path []string
+
+func (e path) eval(claims map[string]any) any {
+	var v any = claims
+	for _, key := range e {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	if isEmpty(v) {
+		return nil
+	}
+	return v
+}
+
+type concat []expr
+
+func (e concat) eval(claims map[string]any) any {
+	var sb strings.Builder
+	for _, term := range e {
+		s, ok := toString(term.eval(claims))
+		if !ok {
+			return nil
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+type call struct {
+	name string
+	args []expr
+}
+
+// arity is the number of arguments of each function, or -1 for at least one.
+var arity = map[string]int{
+	"claim":   1,
+	"default": -1,
+	"regex":   2,
+	"lower":   1,
+	"upper":   1,
+	"split":   2,
+	"join":    2,
+}
+
+func (e call) eval(claims map[string]any) any {
+	switch e.name {
+	case "claim":
+		s, ok := toString(e.args[0].eval(claims))
+		if !ok {
+			return nil
+		}
+		return path(strings.Split(s, ".")).eval(claims)
+	case "default":
+		for _, arg := range e.args {
+			if v := arg.eval(claims); !isEmpty(v) {
+				return v
+			}
+		}
+		return nil
+	case "regex":
+		pattern, ok := toString(e.args[1].eval(claims))
+		if !ok {
+			return nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil
+		}
+		return mapStrings(e.args[0].eval(claims), func(s string) any {
+			m := re.FindStringSubmatch(s)
+			switch {
+			case m == nil:
+				return nil
+			case len(m) > 1:
+				return m[1]
+			default:
+				return m[0]
+			}
+		})
+	case "lower":
+		return mapStrings(e.args[0].eval(claims), func(s string) any { return strings.ToLower(s) })
+	case "upper":
+		return mapStrings(e.args[0].eval(claims), func(s string) any { return strings.ToUpper(s) })
+	case "split":
+		s, ok := toString(e.args[0].eval(claims))
+		sep, sepOK := toString(e.args[1].eval(claims))
+		if !ok || !sepOK {
+			return nil
+		}
+		var list []any
+		for _, el := range strings.Split(s, sep) {
+			list = append(list, el)
+		}
+		return list
+	case "join":
+		list, ok := e.args[0].eval(claims).([]any)
+		sep, sepOK := toString(e.args[1].eval(claims))
+		if !ok || !sepOK {
+			return nil
+		}
+		strs := make([]string, 0, len(list))
+		for _, el := range list {
+			if s, ok := toString(el); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strings.Join(strs, sep)
+	}
+	return nil
+}
+
+// mapStrings applies f to a string, or to every string in a list, dropping
+// the elements which f maps to nothing.
+func mapStrings(v any, f func(string) any) any {
+	if list, ok := v.([]any); ok {
+		var out []any
+		for _, el := range list {
+			if s, ok := toString(el); ok {
+				if mapped := f(s); mapped != nil {
+					out = append(out, mapped)
+				}
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	}
+	s, ok := toString(v)
+	if !ok {
+		return nil
+	}
+	return f(s)
+}
+
+func toString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
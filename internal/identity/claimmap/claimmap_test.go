@@ -0,0 +1,82 @@
+package claimmap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapping(t *testing.T) {
+	t.Parallel()
+
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"given_name": "Alice",
+		"family_name": "Smith",
+		"mail": "Alice.Smith@Example.com",
+		"employee": {"id": 1234, "department": ""},
+		"dn": "CN=Alice Smith,OU=Engineering,DC=example,DC=com",
+		"roles": ["Admin", "Viewer"],
+		"custom claim": "x",
+		"tags": "a,b"
+	}`), &claims))
+
+	for _, tc := range []struct {
+		expr   string
+		expect any
+	}{
+		{`mail`, "Alice.Smith@Example.com"},
+		{`given_name + " " + family_name`, "Alice Smith"},
+		{`lower(mail)`, "alice.smith@example.com"},
+		{`"E" + employee.id`, "E1234"},
+		{`regex(dn, "OU=([^,]+)")`, "Engineering"},
+		{`regex(mail, "@.*$")`, "@Example.com"},
+		{`default(employee.department, regex(dn, "OU=([^,]+)"), "unknown")`, "Engineering"},
+		{`default(missing, "unknown")`, "unknown"},
+		{`upper(roles)`, []any{"ADMIN", "VIEWER"}},
+		{`regex(roles, "^A.*")`, []any{"Admin"}},
+		{`join(roles, ",")`, "Admin,Viewer"},
+		{`split(tags, ",")`, []any{"a", "b"}},
+		{`claim("custom claim")`, "x"},
+		{`missing`, nil},
+		{`given_name + missing`, nil},
+		{`regex(dn, "^nomatch$")`, nil},
+	} {
+		e, err := parse(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expect, e.eval(claims), tc.expr)
+	}
+
+	for _, expr := range []string{``, `a +`, `"unterminated`, `nope(a)`, `lower(a, b)`, `default()`, `a b`, `lower(a`, `a..b`} {
+		_, err := parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestMapping_Apply(t *testing.T) {
+	t.Parallel()
+
+	m, err := Compile(map[string]string{
+		"name":  `given_name + " " + family_name`,
+		"email": `lower(mail)`,
+		"mail":  `"replaced"`,
+		"nick":  `missing`,
+	})
+	require.NoError(t, err)
+
+	claims := map[string]any{"given_name": "Alice", "family_name": "Smith", "mail": "Alice@Example.com", "nick": "al"}
+	m.Apply(claims)
+	assert.Equal(t, map[string]any{
+		"given_name":  "Alice",
+		"family_name": "Smith",
+		"name":        "Alice Smith",
+		"email":       "alice@example.com",
+		"mail":        "replaced",
+		"nick":        "al",
+	}, claims, "expressions should be evaluated against the original claims")
+
+	_, err = Compile(map[string]string{"email": `lower(`})
+	assert.Error(t, err)
+}
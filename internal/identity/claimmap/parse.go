@@ -0,0 +1,144 @@
+package claimmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type parser struct {
+	src string
+	pos int
+}
+
+func parse(src string) (expr, error) {
+	p := &parser{src: src}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos)
+	}
+	return e, nil
+}
+
+// parseExpr parses terms joined by +.
+func (p *parser) parseExpr() (expr, error) {
+	var terms concat
+	for {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+
+		p.skipSpace()
+		if !p.consume('+') {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *parser) parseTerm() (expr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	if p.src[p.pos] == '"' {
+		return p.parseString()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isPathChar(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	ident := p.src[start:p.pos]
+	if ident == "" {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos)
+	}
+
+	p.skipSpace()
+	if !p.consume('(') {
+		for _, key := range strings.Split(ident, ".") {
+			if key == "" {
+				return nil, fmt.Errorf("invalid claim path: %s", ident)
+			}
+		}
+		return path(strings.Split(ident, ".")), nil
+	}
+
+	n, ok := arity[ident]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", ident)
+	}
+	var args []expr
+	p.skipSpace()
+	if !p.consume(')') {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			p.skipSpace()
+			if p.consume(')') {
+				break
+			}
+			if !p.consume(',') {
+				return nil, fmt.Errorf("expected , or ) at position %d", p.pos)
+			}
+		}
+	}
+	if (n >= 0 && len(args) != n) || (n < 0 && len(args) == 0) {
+		return nil, fmt.Errorf("wrong number of arguments for %s: %d", ident, len(args))
+	}
+	return call{name: ident, args: args}, nil
+}
+
+func (p *parser) parseString() (expr, error) {
+	start := p.pos
+	p.pos++ // opening quote
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return nil, errors.New("unterminated string")
+	}
+	p.pos++ // closing quote
+	s, err := strconv.Unquote(p.src[start:p.pos])
+	if err != nil {
+		return nil, fmt.Errorf("invalid string %s: %w", p.src[start:p.pos], err)
+	}
+	return literal(s), nil
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func isPathChar(r rune) bool {
+	return r == '_' || r == '.' || r == '-' || r == ':' ||
+		('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
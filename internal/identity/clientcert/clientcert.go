@@ -0,0 +1,383 @@
+// Package clientcert implements an identity provider that derives the user's
+// identity from the client certificate presented to pomerium, so that clients
+// with a certificate sign in without being redirected to an identity
+// provider.
+//
+// The certificate must be issued by the client CA (client_ca). The user is
+// identified by the email address or the user principal name in the subject
+// alternative names, and the organizational units of the subject are the
+// user's groups.
+//
+// Envoy forwards the certificate to the authenticate service in the
+// x-forwarded-client-cert header, so the authenticate service must be the one
+// terminating the client's TLS connection.
+package clientcert
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// Name identifies the client certificate identity provider.
+	Name = "client_certificate"
+
+	// SignInPath is the path of the sign in endpoint served by the
+	// authenticate service.
+	SignInPath = "/oauth2/client_certificate"
+)
+
+const (
+	// certificates can't be looked up again, so sessions are only refreshed
+	// to renew their tokens, until the certificate expires
+	refreshInterval = time.Hour
+	// how long a sign in code can be redeemed for
+	codeTTL = time.Minute
+
+	purposeCode  = "client certificate code"
+	purposeToken = "client certificate access token"
+)
+
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	// https://learn.microsoft.com/en-us/windows/security/identity-protection/smart-cards/smart-card-certificate-requirements-and-enumeration
+	oidUserPrincipalName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// ErrInvalidCertificate is returned by SignIn when the certificate isn't
+// valid or doesn't identify a user.
+var ErrInvalidCertificate = errors.New("clientcert: invalid client certificate")
+
+// Provider is a client certificate identity provider.
+type Provider struct {
+	roots       *x509.CertPool
+	redirectURL *url.URL
+	cipher      cipher.AEAD
+	now         func() time.Time
+}
+
+// New creates a new client certificate identity provider.
+func New(_ context.Context, o *oauth.Options) (*Provider, error) {
+	if o.ClientSecret == "" {
+		return nil, errors.New("clientcert: client secret is required")
+	}
+	if o.RedirectURL == nil {
+		return nil, errors.New("clientcert: redirect url is required")
+	}
+	if len(o.ClientCA) == 0 {
+		return nil, errors.New("clientcert: client ca is required")
+	}
+
+	p := &Provider{
+		roots:       x509.NewCertPool(),
+		redirectURL: o.RedirectURL,
+		now:         time.Now,
+	}
+	if !p.roots.AppendCertsFromPEM(o.ClientCA) {
+		return nil, errors.New("clientcert: invalid client ca")
+	}
+	key := cryptutil.Hash("client certificate provider", []byte(o.ClientSecret))
+	var err error
+	p.cipher, err = cryptutil.NewAEADCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ParseForwardedClientCert returns the certificate of the first element of an
+// x-forwarded-client-cert header, as set by envoy. nil is returned if there
+// is none.
+func ParseForwardedClientCert(header string) (*x509.Certificate, error) {
+	element, _, _ := strings.Cut(header, ",")
+	for _, pair := range splitQuoted(element, ';') {
+		key, value, _ := strings.Cut(pair, "=")
+		if !strings.EqualFold(strings.TrimSpace(key), "Cert") {
+			continue
+		}
+		value, err := url.QueryUnescape(strings.Trim(strings.TrimSpace(value), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("clientcert: invalid x-forwarded-client-cert: %w", err)
+		}
+		block, _ := pem.Decode([]byte(value))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.New("clientcert: invalid x-forwarded-client-cert")
+		}
+		return x509.ParseCertificate(block.Bytes)
+	}
+	return nil, nil
+}
+
+// splitQuoted splits s by sep, except within double quotes.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// SignIn verifies a client certificate and returns a short-lived code for its
+// user which can be redeemed with Authenticate.
+func (p *Provider) SignIn(_ context.Context, cert *x509.Certificate) (string, error) {
+	if cert == nil {
+		return "", ErrInvalidCertificate
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:       p.roots,
+		CurrentTime: p.now(),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+
+	u, err := newUser(cert)
+	if err != nil {
+		return "", err
+	}
+	return p.seal(purposeCode, u, codeTTL)
+}
+
+// Authenticate redeems a code returned by SignIn.
+func (p *Provider) Authenticate(_ context.Context, code string, v identity.State, _ ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	u, err := p.open(purposeCode, code)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(u, v)
+}
+
+// Refresh renews a user's session, until the certificate expires.
+func (p *Provider) Refresh(_ context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	if t == nil {
+		return nil, oidc.ErrMissingAccessToken
+	}
+	u, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(u, v)
+}
+
+// UpdateUserInfo sets the user's claims.
+func (p *Provider) UpdateUserInfo(_ context.Context, t *oauth2.Token, v interface{}) error {
+	if t == nil {
+		return oidc.ErrMissingAccessToken
+	}
+	u, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return err
+	}
+	return p.userInfo(u, v)
+}
+
+// Revoke does nothing, since there are no tokens to revoke.
+func (p *Provider) Revoke(_ context.Context, _ *oauth2.Token) error {
+	return nil
+}
+
+// GetSignInURL returns the URL of the authenticate service's sign in
+// endpoint.
+func (p *Provider) GetSignInURL(state string, _ ...oauth2.AuthCodeOption) (string, error) {
+	u := *p.redirectURL
+	u.Path = SignInPath
+	u.RawQuery = url.Values{"state": {state}}.Encode()
+	return u.String(), nil
+}
+
+// LogOut is not implemented by client certificates.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// A user is the identity in a client certificate.
+type user struct {
+	ID       string   `json:"id"`
+	Email    string   `json:"email,omitempty"`
+	UPN      string   `json:"upn,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	NotAfter int64    `json:"not_after"`
+}
+
+func newUser(cert *x509.Certificate) (*user, error) {
+	u := &user{
+		Name:     cert.Subject.CommonName,
+		Groups:   cert.Subject.OrganizationalUnit,
+		NotAfter: cert.NotAfter.Unix(),
+	}
+	if len(cert.EmailAddresses) > 0 {
+		u.Email = cert.EmailAddresses[0]
+	}
+	upn, err := getUserPrincipalName(cert)
+	if err != nil {
+		return nil, err
+	}
+	u.UPN = upn
+
+	switch {
+	case u.Email != "":
+		u.ID = u.Email
+	case u.UPN != "":
+		u.ID = u.UPN
+		u.Email = strings.ToLower(u.UPN)
+	default:
+		return nil, fmt.Errorf("%w: no email address or user principal name", ErrInvalidCertificate)
+	}
+	return u, nil
+}
+
+// getUserPrincipalName returns the user principal name in the subject
+// alternative names, which the x509 package doesn't parse.
+func getUserPrincipalName(cert *x509.Certificate) (string, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+		}
+		for _, name := range names {
+			// otherName [0] { type-id OID, value [0] EXPLICIT ANY }
+			if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+				continue
+			}
+			var typeID asn1.ObjectIdentifier
+			rest, err := asn1.Unmarshal(name.Bytes, &typeID)
+			if err != nil || !typeID.Equal(oidUserPrincipalName) {
+				continue
+			}
+			var upn string
+			if _, err := asn1.UnmarshalWithParams(rest, &upn, "explicit,tag:0,utf8"); err == nil && upn != "" {
+				return upn, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (p *Provider) authenticate(u *user, v identity.State) (*oauth2.Token, error) {
+	if err := p.userInfo(u, v); err != nil {
+		return nil, err
+	}
+	accessToken, err := p.seal(purposeToken, u, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		Expiry:      p.expiry(u),
+	}, nil
+}
+
+func (p *Provider) expiry(u *user) time.Time {
+	expiry := p.now().Add(refreshInterval)
+	if notAfter := time.Unix(u.NotAfter, 0); notAfter.Before(expiry) {
+		return notAfter
+	}
+	return expiry
+}
+
+func (p *Provider) userInfo(u *user, v interface{}) error {
+	var out struct {
+		Subject string   `json:"sub"`
+		User    string   `json:"user"`
+		Email   string   `json:"email,omitempty"`
+		UPN     string   `json:"upn,omitempty"`
+		Name    string   `json:"name,omitempty"`
+		Groups  []string `json:"groups,omitempty"`
+		// needs to be set manually
+		Expiry    *jwt.NumericDate `json:"exp,omitempty"`
+		NotBefore *jwt.NumericDate `json:"nbf,omitempty"`
+		IssuedAt  *jwt.NumericDate `json:"iat,omitempty"`
+	}
+
+	out.Expiry = jwt.NewNumericDate(p.expiry(u))
+	out.NotBefore = jwt.NewNumericDate(p.now())
+	out.IssuedAt = jwt.NewNumericDate(p.now())
+
+	out.Subject = u.ID
+	out.User = u.ID
+	out.Email = u.Email
+	out.UPN = u.UPN
+	out.Name = u.Name
+	out.Groups = u.Groups
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+type sealedUser struct {
+	User   *user `json:"user"`
+	Expiry int64 `json:"exp,omitempty"`
+}
+
+func (p *Provider) seal(purpose string, u *user, ttl time.Duration) (string, error) {
+	v := sealedUser{User: u}
+	if ttl > 0 {
+		v.Expiry = p.now().Add(ttl).Unix()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cryptutil.Encrypt(p.cipher, b, []byte(purpose))), nil
+}
+
+func (p *Provider) open(purpose, s string) (*user, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("clientcert: invalid %s: %w", purpose, err)
+	}
+	b, err := cryptutil.Decrypt(p.cipher, raw, []byte(purpose))
+	if err != nil {
+		return nil, fmt.Errorf("clientcert: invalid %s: %w", purpose, err)
+	}
+	var v sealedUser
+	if err := json.Unmarshal(b, &v); err != nil || v.User == nil {
+		return nil, fmt.Errorf("clientcert: invalid %s", purpose)
+	}
+	if v.Expiry != 0 && p.now().Unix() > v.Expiry {
+		return nil, fmt.Errorf("clientcert: expired %s", purpose)
+	}
+	if p.now().Unix() > v.User.NotAfter {
+		return nil, errors.New("clientcert: client certificate expired")
+	}
+	return v.User, nil
+}
@@ -0,0 +1,189 @@
+package clientcert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	ca, caKey, caPEM := newCA(t)
+	otherCA, otherCAKey, _ := newCA(t)
+
+	p, err := New(ctx, &oauth.Options{
+		ClientSecret: "SECRET",
+		RedirectURL:  &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+		ClientCA:     caPEM,
+	})
+	require.NoError(t, err)
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	assert.Equal(t, "https://authenticate.example.com/oauth2/client_certificate?state=STATE", signInURL)
+
+	t.Run("email", func(t *testing.T) {
+		cert := newCert(t, ca, caKey, &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "Alice", OrganizationalUnit: []string{"Engineering", "Admins"}},
+			EmailAddresses: []string{"alice@example.com"},
+			NotAfter:       now.Add(30 * time.Minute),
+		})
+		code, err := p.SignIn(ctx, cert)
+		require.NoError(t, err)
+
+		var claims testClaims
+		token, err := p.Authenticate(ctx, code, &claims)
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", claims["sub"])
+		assert.Equal(t, "Alice", claims["name"])
+		assert.ElementsMatch(t, []any{"Engineering", "Admins"}, claims["groups"])
+		assert.WithinDuration(t, now.Add(30*time.Minute), token.Expiry, time.Second,
+			"sessions should expire with the certificate")
+
+		p := *p
+		p.now = func() time.Time { return now.Add(time.Hour) }
+		_, err = p.Refresh(ctx, token, &claims)
+		assert.Error(t, err, "sessions should not be refreshed after the certificate expired")
+	})
+	t.Run("user principal name", func(t *testing.T) {
+		cert := newCert(t, ca, caKey, &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "Bob"},
+			ExtraExtensions: []pkix.Extension{newUPNExtension(t, "Bob@CORP.EXAMPLE.COM")},
+			NotAfter:        now.Add(time.Hour),
+		})
+		code, err := p.SignIn(ctx, cert)
+		require.NoError(t, err)
+
+		var claims testClaims
+		_, err = p.Authenticate(ctx, code, &claims)
+		require.NoError(t, err)
+		assert.Equal(t, "Bob@CORP.EXAMPLE.COM", claims["sub"])
+		assert.Equal(t, "Bob@CORP.EXAMPLE.COM", claims["upn"])
+		assert.Equal(t, "bob@corp.example.com", claims["email"])
+	})
+	t.Run("no identity", func(t *testing.T) {
+		cert := newCert(t, ca, caKey, &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "Carol"},
+			NotAfter: now.Add(time.Hour),
+		})
+		_, err := p.SignIn(ctx, cert)
+		assert.ErrorIs(t, err, ErrInvalidCertificate)
+	})
+	t.Run("untrusted", func(t *testing.T) {
+		cert := newCert(t, otherCA, otherCAKey, &x509.Certificate{
+			EmailAddresses: []string{"mallory@example.com"},
+			NotAfter:       now.Add(time.Hour),
+		})
+		_, err := p.SignIn(ctx, cert)
+		assert.ErrorIs(t, err, ErrInvalidCertificate)
+	})
+	t.Run("missing", func(t *testing.T) {
+		_, err := p.SignIn(ctx, nil)
+		assert.ErrorIs(t, err, ErrInvalidCertificate)
+	})
+
+	_, err = New(ctx, &oauth.Options{ClientSecret: "SECRET", RedirectURL: &url.URL{}})
+	assert.Error(t, err, "should require a client ca")
+}
+
+func TestParseForwardedClientCert(t *testing.T) {
+	t.Parallel()
+
+	ca, caKey, _ := newCA(t)
+	cert := newCert(t, ca, caKey, &x509.Certificate{
+		EmailAddresses: []string{"alice@example.com"},
+		NotAfter:       time.Now().Add(time.Hour),
+	})
+	encoded := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+
+	actual, err := ParseForwardedClientCert(`Hash=1234;Cert="` + encoded + `";Subject="CN=a;b,OU=c"`)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, actual.Raw)
+
+	actual, err = ParseForwardedClientCert(`Subject="OU=a;Cert=b";Cert=` + encoded + `,Cert=invalid`)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, actual.Raw)
+
+	actual, err = ParseForwardedClientCert("")
+	assert.NoError(t, err)
+	assert.Nil(t, actual)
+
+	_, err = ParseForwardedClientCert(`Cert="invalid"`)
+	assert.Error(t, err)
+}
+
+type testClaims map[string]any
+
+func (testClaims) SetRawIDToken(string) {}
+
+func newCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, tpl *x509.Certificate) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl.SerialNumber = big.NewInt(2)
+	tpl.NotBefore = time.Now().Add(-time.Hour)
+	tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func newUPNExtension(t *testing.T, upn string) pkix.Extension {
+	t.Helper()
+
+	value, err := asn1.MarshalWithParams(upn, "explicit,tag:0,utf8")
+	require.NoError(t, err)
+	typeID, err := asn1.Marshal(oidUserPrincipalName)
+	require.NoError(t, err)
+	otherName, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append(typeID, value...),
+	})
+	require.NoError(t, err)
+	san, err := asn1.Marshal([]asn1.RawValue{{FullBytes: otherName}})
+	require.NoError(t, err)
+	return pkix.Extension{Id: oidSubjectAltName, Value: san}
+}
@@ -0,0 +1,280 @@
+// Package healthcheck probes identity providers to detect when they are
+// down.
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+// A target is an identity provider with health checks enabled.
+type target struct {
+	idpID              string
+	name               string
+	discoveryURL       string
+	tokenURL           string
+	interval           time.Duration
+	timeout            time.Duration
+	unhealthyThreshold int
+}
+
+type status struct {
+	failures int
+	healthy  bool
+}
+
+type checkerConfig struct {
+	client *http.Client
+}
+
+// An Option customizes the checker.
+type Option func(*checkerConfig)
+
+// WithHTTPClient sets the http client used to probe identity providers.
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *checkerConfig) {
+		cfg.client = client
+	}
+}
+
+// A Checker periodically probes the identity providers with health checks
+// enabled. An identity provider is down after several consecutive failed
+// probes, until a probe succeeds.
+type Checker struct {
+	cfg *checkerConfig
+
+	mu       sync.RWMutex
+	cancel   func()
+	statuses map[string]*status
+}
+
+// New creates a new Checker.
+func New(options ...Option) *Checker {
+	cfg := new(checkerConfig)
+	WithHTTPClient(http.DefaultClient)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return &Checker{
+		cfg:      cfg,
+		statuses: make(map[string]*status),
+	}
+}
+
+// OnConfigChange restarts the health checks with the identity providers of
+// the new config. The health of identity providers which are still checked
+// is kept.
+func (c *Checker) OnConfigChange(ctx context.Context, cfg *config.Config) {
+	targets, err := getTargets(cfg.Options)
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("healthcheck: invalid identity providers")
+	}
+
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	statuses := make(map[string]*status, len(targets))
+	for _, t := range targets {
+		if s, ok := c.statuses[t.idpID]; ok {
+			statuses[t.idpID] = s
+		} else {
+			statuses[t.idpID] = &status{healthy: true}
+		}
+	}
+	c.statuses = statuses
+	if len(targets) > 0 {
+		runCtx, cancel := context.WithCancel(context.TODO())
+		c.cancel = cancel
+		for _, t := range targets {
+			go c.run(runCtx, t)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// IsHealthy returns false if the identity provider with the given IDP id is
+// down. Identity providers without health checks are always healthy.
+func (c *Checker) IsHealthy(idpID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok := c.statuses[idpID]
+	return !ok || s.healthy
+}
+
+func (c *Checker) run(ctx context.Context, t target) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, t target) {
+	probeCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	err := c.probe(probeCtx, t)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.mu.Lock()
+	s, ok := c.statuses[t.idpID]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	wasHealthy := s.healthy
+	if err == nil {
+		s.failures = 0
+		s.healthy = true
+	} else {
+		s.failures++
+		if s.failures >= t.unhealthyThreshold {
+			s.healthy = false
+		}
+	}
+	healthy := s.healthy
+	c.mu.Unlock()
+
+	metrics.RecordIdentityProviderHealthCheck(ctx, t.name, err, healthy)
+	if err != nil {
+		log.Debug(ctx).Err(err).Str("idp", t.name).Msg("healthcheck: identity provider probe failed")
+	}
+	if wasHealthy && !healthy {
+		log.Warn(ctx).Err(err).Str("idp", t.name).Msg("healthcheck: identity provider is down")
+	} else if !wasHealthy && healthy {
+		log.Info(ctx).Str("idp", t.name).Msg("healthcheck: identity provider is healthy")
+	}
+}
+
+// probe fetches the discovery document, and makes sure the token endpoint
+// responds. Token requests without credentials are rejected by healthy
+// identity providers with a client error.
+func (c *Checker) probe(ctx context.Context, t target) error {
+	tokenURL := t.tokenURL
+	if t.discoveryURL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.discoveryURL, nil)
+		if err != nil {
+			return err
+		}
+		res, err := c.cfg.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("healthcheck: error fetching discovery document: %w", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("healthcheck: unexpected discovery document status code: %d", res.StatusCode)
+		}
+		var doc struct {
+			TokenEndpoint string `json:"token_endpoint"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+			return fmt.Errorf("healthcheck: invalid discovery document: %w", err)
+		}
+		if tokenURL == "" {
+			tokenURL = doc.TokenEndpoint
+		}
+	}
+	if tokenURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := c.cfg.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("healthcheck: error calling token endpoint: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("healthcheck: unexpected token endpoint status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// getTargets returns the identity providers with health checks enabled.
+// Identity providers without a provider url or token url can't be probed.
+func getTargets(options *config.Options) ([]target, error) {
+	idps, err := options.GetAllIdentityProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []target
+	for _, idp := range idps {
+		healthCheck, err := options.GetIDPHealthCheckOptions(idp.GetId())
+		if err != nil {
+			return nil, err
+		}
+		if healthCheck == nil {
+			continue
+		}
+		oauthOptions, err := options.GetOauthOptionsForIdentityProvider(idp.GetId())
+		if err != nil {
+			return nil, err
+		}
+		name, err := options.GetIdentityProviderName(idp.GetId())
+		if err != nil {
+			return nil, err
+		}
+
+		t := target{
+			idpID:              idp.GetId(),
+			name:               name,
+			interval:           healthCheck.GetInterval(),
+			timeout:            healthCheck.GetTimeout(),
+			unhealthyThreshold: healthCheck.GetUnhealthyThreshold(),
+		}
+		if oauthOptions.TokenURL != "" {
+			// generic oauth2 identity providers don't have a discovery
+			// document, their token url may be relative to the provider url
+			t.tokenURL, err = resolveURL(oauthOptions.ProviderURL, oauthOptions.TokenURL)
+			if err != nil {
+				return nil, err
+			}
+		} else if oauthOptions.ProviderURL != "" {
+			t.discoveryURL = strings.TrimSuffix(oauthOptions.ProviderURL, "/") + "/.well-known/openid-configuration"
+		} else {
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func resolveURL(base, ref string) (string, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("healthcheck: invalid token url: %w", err)
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("healthcheck: invalid provider url: %w", err)
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
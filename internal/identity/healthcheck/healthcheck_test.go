@@ -0,0 +1,96 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestChecker(t *testing.T) {
+	t.Parallel()
+
+	var down atomic.Bool
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"token_endpoint":"` + srv.URL + `/token"}`))
+		case "/token":
+			if down.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	options := config.NewDefaultOptions()
+	options.Provider = "oidc"
+	options.ProviderURL = srv.URL
+	options.ClientID = "CLIENT_ID"
+	options.ClientSecret = "CLIENT_SECRET"
+	options.IDPHealthCheck = &config.IDPHealthCheckOptions{
+		Interval:           10 * time.Millisecond,
+		UnhealthyThreshold: 2,
+	}
+	options.IdentityProviders = []config.IdentityProviderOptions{{
+		Name:        "unchecked",
+		Provider:    "oidc",
+		ProviderURL: srv.URL,
+	}}
+
+	targets, err := getTargets(options)
+	require.NoError(t, err)
+	require.Len(t, targets, 1, "should only check identity providers with health checks")
+	assert.Equal(t, srv.URL+"/.well-known/openid-configuration", targets[0].discoveryURL)
+	idpID := targets[0].idpID
+
+	c := New(WithHTTPClient(srv.Client()))
+	ctx := context.Background()
+	c.OnConfigChange(ctx, &config.Config{Options: options})
+	t.Cleanup(func() { c.OnConfigChange(ctx, &config.Config{Options: config.NewDefaultOptions()}) })
+	assert.True(t, c.IsHealthy(idpID))
+	assert.True(t, c.IsHealthy("unknown"))
+
+	down.Store(true)
+	assert.Eventually(t, func() bool { return !c.IsHealthy(idpID) }, 5*time.Second, 10*time.Millisecond)
+	down.Store(false)
+	assert.Eventually(t, func() bool { return c.IsHealthy(idpID) }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New(WithHTTPClient(srv.Client()))
+	ctx := context.Background()
+	assert.NoError(t, c.probe(ctx, target{tokenURL: srv.URL + "/oauth/token"}),
+		"client errors should be healthy")
+	assert.Error(t, c.probe(ctx, target{tokenURL: srv.URL + "/token"}))
+	assert.Error(t, c.probe(ctx, target{discoveryURL: srv.URL + "/.well-known/openid-configuration"}))
+
+	tokenURL, err := resolveURL("https://idp.example.com/tenant/", "oauth/token")
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com/tenant/oauth/token", tokenURL)
+}
@@ -0,0 +1,199 @@
+package kerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // required by RFC 3962
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Encryption types, from RFC 3962. The older des and rc4-hmac types are not
+// supported.
+const (
+	etypeAES128CTSHMACSHA196 = 17
+	etypeAES256CTSHMACSHA196 = 18
+)
+
+// Key usages, from RFC 4120 section 7.5.1.
+const (
+	keyUsageTicket        = 2
+	keyUsageAuthenticator = 11
+)
+
+const (
+	hmacSize       = 12 // HMAC-SHA1-96
+	confounderSize = aes.BlockSize
+)
+
+var errIntegrity = errors.New("kerberos: integrity check failed")
+
+// keySize returns the key size of an encryption type, or 0 if it's not
+// supported.
+func keySize(etype int32) int {
+	switch etype {
+	case etypeAES128CTSHMACSHA196:
+		return 16
+	case etypeAES256CTSHMACSHA196:
+		return 32
+	}
+	return 0
+}
+
+// decrypt decrypts and verifies the cipher text of EncryptedData, as defined
+// by RFC 3961 and RFC 3962, returning the plain text without the confounder.
+func decrypt(etype int32, key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if keySize(etype) == 0 {
+		return nil, fmt.Errorf("kerberos: unsupported encryption type: %d", etype)
+	}
+	if len(key) != keySize(etype) {
+		return nil, fmt.Errorf("kerberos: invalid key size for encryption type %d", etype)
+	}
+	if len(ciphertext) < confounderSize+hmacSize {
+		return nil, errors.New("kerberos: cipher text too short")
+	}
+
+	ke, err := deriveKey(key, usage, 0xAA)
+	if err != nil {
+		return nil, err
+	}
+	ki, err := deriveKey(key, usage, 0x55)
+	if err != nil {
+		return nil, err
+	}
+
+	data, mac := ciphertext[:len(ciphertext)-hmacSize], ciphertext[len(ciphertext)-hmacSize:]
+	plaintext, err := decryptCTS(ke, data)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hmac.New(sha1.New, ki)
+	h.Write(plaintext)
+	if !hmac.Equal(h.Sum(nil)[:hmacSize], mac) {
+		return nil, errIntegrity
+	}
+	return plaintext[confounderSize:], nil
+}
+
+// deriveKey derives the key for a usage, DK(key, usage | kind).
+func deriveKey(key []byte, usage uint32, kind byte) ([]byte, error) {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+	constant[4] = kind
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// DR(key, constant): iterate the encryption of the n-folded constant until
+	// there are enough bits for a key. random-to-key is the identity for AES.
+	derived := make([]byte, 0, len(key))
+	b := nfold(constant, aes.BlockSize)
+	for len(derived) < len(key) {
+		block.Encrypt(b, b)
+		derived = append(derived, b...)
+	}
+	return derived[:len(key)], nil
+}
+
+// decryptCTS decrypts AES in CBC mode with ciphertext stealing, where the last
+// two blocks are always swapped, and an all-zero initialization vector.
+func decryptCTS(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	n := len(ciphertext)
+	switch {
+	case n < aes.BlockSize:
+		return nil, errors.New("kerberos: cipher text too short")
+	case n == aes.BlockSize:
+		plaintext := make([]byte, n)
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		return plaintext, nil
+	}
+
+	// the length of the last, possibly partial, block
+	last := n % aes.BlockSize
+	if last == 0 {
+		last = aes.BlockSize
+	}
+	prefixLen := n - aes.BlockSize - last
+
+	plaintext := make([]byte, n)
+	prev := iv
+	if prefixLen > 0 {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext[:prefixLen], ciphertext[:prefixLen])
+		prev = ciphertext[prefixLen-aes.BlockSize : prefixLen]
+	}
+
+	// the second to last block of the cipher text is the encryption of the
+	// last plain text block, padded with the end of the stolen block
+	d := make([]byte, aes.BlockSize)
+	block.Decrypt(d, ciphertext[prefixLen:prefixLen+aes.BlockSize])
+	partial := ciphertext[prefixLen+aes.BlockSize:]
+	for i := 0; i < last; i++ {
+		plaintext[prefixLen+aes.BlockSize+i] = d[i] ^ partial[i]
+	}
+
+	stolen := make([]byte, aes.BlockSize)
+	copy(stolen, partial)
+	copy(stolen[last:], d[last:])
+	block.Decrypt(stolen, stolen)
+	for i := 0; i < aes.BlockSize; i++ {
+		plaintext[prefixLen+i] = stolen[i] ^ prev[i]
+	}
+	return plaintext, nil
+}
+
+// nfold implements the n-fold operation of RFC 3961 section 5.1, stretching
+// or folding the input to size bytes.
+func nfold(in []byte, size int) []byte {
+	inBits := len(in) * 8
+	lcm := len(in) * size / gcd(len(in), size)
+
+	// concatenate copies of the input, each rotated 13 bits further right
+	buf := make([]byte, lcm)
+	for i := 0; i < lcm/len(in); i++ {
+		rotation := (13 * i) % inBits
+		for bit := 0; bit < inBits; bit++ {
+			src := (bit - rotation + inBits) % inBits
+			if in[src/8]&(0x80>>(src%8)) != 0 {
+				dst := i*inBits + bit
+				buf[dst/8] |= 0x80 >> (dst % 8)
+			}
+		}
+	}
+
+	// add the size byte chunks with one's complement addition
+	out := make([]byte, size)
+	for offset := 0; offset < lcm; offset += size {
+		carry := 0
+		for i := size - 1; i >= 0; i-- {
+			sum := int(out[i]) + int(buf[offset+i]) + carry
+			out[i] = byte(sum)
+			carry = sum >> 8
+		}
+		// end-around carry
+		for carry != 0 {
+			for i := size - 1; i >= 0; i-- {
+				sum := int(out[i]) + carry
+				out[i] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,383 @@
+// Package kerberos implements an identity provider that signs in users of
+// domain-joined clients with Kerberos, negotiated over HTTP with SPNEGO
+// (RFC 4559), so that they aren't prompted for credentials.
+//
+// The authenticate service serves the sign in endpoint, which asks browsers
+// to negotiate. Browsers which don't send a Kerberos ticket, typically those
+// off the corporate network, are sent to the fallback identity provider
+// instead.
+//
+// The service principal's keys are read from a keytab, as exported by ktpass
+// or ktutil. Only the AES encryption types are supported. Mutual
+// authentication and the group memberships in the PAC are not supported.
+package kerberos
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// Name identifies the Kerberos identity provider.
+	Name = "kerberos"
+
+	// SignInPath is the path of the SPNEGO endpoint served by the
+	// authenticate service.
+	SignInPath = "/oauth2/kerberos"
+)
+
+const (
+	// sessions can't be refreshed against the KDC, so they are only refreshed
+	// to renew their tokens
+	refreshInterval = time.Hour
+	// how long a sign in code can be redeemed for
+	codeTTL = time.Minute
+	// the maximum clock skew between clients and the authenticate service,
+	// which is also how long authenticators are remembered to detect replays
+	maxClockSkew = 5 * time.Minute
+
+	purposeCode  = "kerberos code"
+	purposeToken = "kerberos access token"
+)
+
+// ErrNegotiationFailed is returned by Negotiate when the token isn't a valid
+// Kerberos ticket for the service.
+var ErrNegotiationFailed = errors.New("kerberos: negotiation failed")
+
+// Provider is a Kerberos identity provider.
+type Provider struct {
+	keytab      keytab
+	redirectURL *url.URL
+	cipher      cipher.AEAD
+
+	mu      sync.Mutex
+	replays map[string]time.Time
+	now     func() time.Time
+}
+
+// New creates a new Kerberos identity provider.
+func New(_ context.Context, o *oauth.Options) (*Provider, error) {
+	if o.RedirectURL == nil {
+		return nil, errors.New("kerberos: redirect url is required")
+	}
+
+	raw, err := readKeytab(o)
+	if err != nil {
+		return nil, err
+	}
+	kt, err := parseKeytab(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(kt) == 0 {
+		return nil, errors.New("kerberos: keytab has no keys")
+	}
+
+	p := &Provider{
+		keytab:      kt,
+		redirectURL: o.RedirectURL,
+		replays:     make(map[string]time.Time),
+		now:         time.Now,
+	}
+	key := cryptutil.Hash("kerberos provider", raw)
+	p.cipher, err = cryptutil.NewAEADCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func readKeytab(o *oauth.Options) ([]byte, error) {
+	switch {
+	case o.KerberosKeytab != "":
+		raw, err := base64.StdEncoding.DecodeString(o.KerberosKeytab)
+		if err != nil {
+			return nil, fmt.Errorf("kerberos: invalid keytab: %w", err)
+		}
+		return raw, nil
+	case o.KerberosKeytabFile != "":
+		raw, err := os.ReadFile(o.KerberosKeytabFile)
+		if err != nil {
+			return nil, fmt.Errorf("kerberos: failed to read keytab: %w", err)
+		}
+		return raw, nil
+	}
+	return nil, errors.New("kerberos: keytab is required")
+}
+
+// Negotiate verifies the token of a Negotiate authorization header and
+// returns a short-lived code for the client principal which can be redeemed
+// with Authenticate.
+func (p *Provider) Negotiate(_ context.Context, token string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNegotiationFailed, err)
+	}
+	principal, ticketExpiry, err := p.accept(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNegotiationFailed, err)
+	}
+	return p.seal(purposeCode, sealedPrincipal{
+		Principal:    principal,
+		Expiry:       p.now().Add(codeTTL).Unix(),
+		TicketExpiry: ticketExpiry.Unix(),
+	})
+}
+
+// accept verifies an AP-REQ and returns the client principal, as user@REALM,
+// and the end time of its ticket.
+func (p *Provider) accept(token []byte) (string, time.Time, error) {
+	req, err := parseAPReq(token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var tkt ticket
+	_, err = asn1.UnmarshalWithParams(req.Ticket.Bytes, &tkt, "application,explicit,tag:1")
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("kerberos: invalid ticket: %w", err)
+	}
+	service := tkt.SName.String() + "@" + tkt.Realm
+	key, ok := p.keytab.find(service, tkt.EncPart.EType, uint32(tkt.EncPart.KVNO))
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("kerberos: no key for %s (etype %d, kvno %d) in keytab",
+			service, tkt.EncPart.EType, tkt.EncPart.KVNO)
+	}
+
+	b, err := decrypt(tkt.EncPart.EType, key, keyUsageTicket, tkt.EncPart.Cipher)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var part encTicketPart
+	_, err = asn1.UnmarshalWithParams(b, &part, "application,explicit,tag:3")
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("kerberos: invalid ticket: %w", err)
+	}
+
+	// the authenticator proves that the client holds the session key
+	if req.Authenticator.EType != part.Key.KeyType {
+		return "", time.Time{}, errors.New("kerberos: authenticator encryption type mismatch")
+	}
+	b, err = decrypt(part.Key.KeyType, part.Key.KeyValue, keyUsageAuthenticator, req.Authenticator.Cipher)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var auth authenticator
+	_, err = asn1.UnmarshalWithParams(b, &auth, "application,explicit,tag:2")
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("kerberos: invalid authenticator: %w", err)
+	}
+
+	principal := part.CName.String() + "@" + part.CRealm
+	if auth.CName.String()+"@"+auth.CRealm != principal {
+		return "", time.Time{}, errors.New("kerberos: authenticator client mismatch")
+	}
+
+	now := p.now()
+	startTime := part.StartTime
+	if startTime.IsZero() {
+		startTime = part.AuthTime
+	}
+	if now.Before(startTime.Add(-maxClockSkew)) {
+		return "", time.Time{}, errors.New("kerberos: ticket not yet valid")
+	}
+	if now.After(part.EndTime.Add(maxClockSkew)) {
+		return "", time.Time{}, errors.New("kerberos: ticket expired")
+	}
+	if d := now.Sub(auth.CTime); d > maxClockSkew || d < -maxClockSkew {
+		return "", time.Time{}, errors.New("kerberos: clock skew too great")
+	}
+
+	replayKey := principal + "|" + auth.CTime.UTC().Format(time.RFC3339) + "|" + strconv.Itoa(auth.CUSec)
+	if !p.checkReplay(replayKey, now) {
+		return "", time.Time{}, errors.New("kerberos: replayed authenticator")
+	}
+	return principal, part.EndTime, nil
+}
+
+// checkReplay returns false if the authenticator was already seen within the
+// clock skew.
+func (p *Provider) checkReplay(key string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, expiry := range p.replays {
+		if now.After(expiry) {
+			delete(p.replays, k)
+		}
+	}
+	if _, ok := p.replays[key]; ok {
+		return false
+	}
+	p.replays[key] = now.Add(2 * maxClockSkew)
+	return true
+}
+
+// Authenticate redeems a code returned by Negotiate.
+func (p *Provider) Authenticate(_ context.Context, code string, v identity.State, _ ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	sealed, err := p.open(purposeCode, code)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(sealed.Principal, time.Unix(sealed.TicketExpiry, 0), v)
+}
+
+// Refresh renews a user's session. Sessions can't be refreshed past the end
+// time of the ticket the user signed in with, as tickets can't be renewed
+// without the client.
+func (p *Provider) Refresh(_ context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	if t == nil {
+		return nil, oidc.ErrMissingAccessToken
+	}
+	sealed, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(sealed.Principal, time.Unix(sealed.Expiry, 0), v)
+}
+
+// UpdateUserInfo sets the user's claims.
+func (p *Provider) UpdateUserInfo(_ context.Context, t *oauth2.Token, v interface{}) error {
+	if t == nil {
+		return oidc.ErrMissingAccessToken
+	}
+	sealed, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return err
+	}
+	return userInfo(sealed.Principal, v)
+}
+
+// Revoke does nothing, since there are no tokens to revoke.
+func (p *Provider) Revoke(_ context.Context, _ *oauth2.Token) error {
+	return nil
+}
+
+// GetSignInURL returns the URL of the authenticate service's SPNEGO
+// endpoint.
+func (p *Provider) GetSignInURL(state string, _ ...oauth2.AuthCodeOption) (string, error) {
+	u := *p.redirectURL
+	u.Path = SignInPath
+	u.RawQuery = url.Values{"state": {state}}.Encode()
+	return u.String(), nil
+}
+
+// LogOut is not implemented by Kerberos.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// authenticate returns an access token for the principal which expires along
+// with the principal's ticket.
+func (p *Provider) authenticate(principal string, ticketExpiry time.Time, v identity.State) (*oauth2.Token, error) {
+	if err := userInfo(principal, v); err != nil {
+		return nil, err
+	}
+	accessToken, err := p.seal(purposeToken, sealedPrincipal{
+		Principal: principal,
+		Expiry:    ticketExpiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := p.now().Add(refreshInterval)
+	if ticketExpiry.Before(expiry) {
+		expiry = ticketExpiry
+	}
+	return &oauth2.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
+
+// userInfo sets the claims of a principal. The email is the principal in
+// lower case, which matches the user principal name of most Active Directory
+// users.
+func userInfo(principal string, v interface{}) error {
+	var out struct {
+		Subject string `json:"sub"`
+		User    string `json:"user"`
+		Email   string `json:"email"`
+		Name    string `json:"name"`
+		// needs to be set manually
+		Expiry    *jwt.NumericDate `json:"exp,omitempty"`
+		NotBefore *jwt.NumericDate `json:"nbf,omitempty"`
+		IssuedAt  *jwt.NumericDate `json:"iat,omitempty"`
+	}
+
+	out.Expiry = jwt.NewNumericDate(time.Now().Add(refreshInterval))
+	out.NotBefore = jwt.NewNumericDate(time.Now())
+	out.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	out.Subject = principal
+	out.User = principal
+	out.Email = strings.ToLower(principal)
+	out.Name, _, _ = strings.Cut(principal, "@")
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+type sealedPrincipal struct {
+	Principal string `json:"principal"`
+	Expiry    int64  `json:"exp,omitempty"`
+	// TicketExpiry is the end time of the ticket of a sign in code
+	TicketExpiry int64 `json:"tkt_exp,omitempty"`
+}
+
+func (p *Provider) seal(purpose string, v sealedPrincipal) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cryptutil.Encrypt(p.cipher, b, []byte(purpose))), nil
+}
+
+// open returns the sealed principal, if it hasn't expired.
+func (p *Provider) open(purpose, s string) (*sealedPrincipal, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos: invalid %s: %w", purpose, err)
+	}
+	b, err := cryptutil.Decrypt(p.cipher, raw, []byte(purpose))
+	if err != nil {
+		return nil, fmt.Errorf("kerberos: invalid %s: %w", purpose, err)
+	}
+	var v sealedPrincipal
+	if err := json.Unmarshal(b, &v); err != nil || v.Principal == "" {
+		return nil, fmt.Errorf("kerberos: invalid %s", purpose)
+	}
+	// everything sealed expires, so reject anything sealed without an expiry
+	if v.Expiry == 0 || p.now().Unix() > v.Expiry {
+		return nil, fmt.Errorf("kerberos: expired %s", purpose)
+	}
+	return &v, nil
+}
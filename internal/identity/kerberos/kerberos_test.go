@@ -0,0 +1,323 @@
+package kerberos
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func TestNFold(t *testing.T) {
+	t.Parallel()
+
+	// RFC 3961 appendix A.1
+	for _, tc := range []struct {
+		in   string
+		bits int
+		out  string
+	}{
+		{"012345", 64, "be072631276b1955"},
+		{"password", 56, "78a07b6caf85fa"},
+		{"Rough Consensus, and Running Code", 64, "bb6ed30870b7f0e0"},
+		{"password", 168, "59e4a8ca7c0385c3c37b3f6d2000247cb6e6bd5b3e"},
+		{"kerberos", 128, "6b65726265726f737b9b5b2b93132b93"},
+	} {
+		assert.Equal(t, tc.out, hex.EncodeToString(nfold([]byte(tc.in), tc.bits/8)), "%d-fold(%q)", tc.bits, tc.in)
+	}
+}
+
+func TestDecryptCTS(t *testing.T) {
+	t.Parallel()
+
+	// RFC 3962 appendix B
+	key := mustHex(t, "636869636b656e207465726979616b69")
+	for _, tc := range []struct {
+		plaintext, ciphertext string
+	}{
+		{"4920776f756c64206c696b652074686520", "c6353568f2bf8cb4d8a580362da7ff7f97"},
+		{"4920776f756c64206c696b65207468652047656e6572616c20476175277320", "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+	} {
+		plaintext, err := decryptCTS(key, mustHex(t, tc.ciphertext))
+		require.NoError(t, err)
+		assert.Equal(t, tc.plaintext, hex.EncodeToString(plaintext))
+	}
+
+	for _, n := range []int{16, 32, 33, 47, 48, 100} {
+		plaintext := make([]byte, n)
+		_, _ = rand.Read(plaintext)
+		actual, err := decryptCTS(key, encryptCTS(t, key, plaintext))
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, actual, "length %d", n)
+	}
+}
+
+func TestParseKeytab(t *testing.T) {
+	t.Parallel()
+
+	key := make([]byte, 32)
+	raw := newKeytab("HTTP/authenticate.example.com@EXAMPLE.COM", 3, etypeAES256CTSHMACSHA196, key)
+	// a deleted entry
+	raw = append(raw, 0xff, 0xff, 0xff, 0xfc, 0, 0, 0, 0)
+
+	kt, err := parseKeytab(raw)
+	require.NoError(t, err)
+	require.Len(t, kt, 1)
+	assert.Equal(t, "HTTP/authenticate.example.com@EXAMPLE.COM", kt[0].principal)
+	assert.Equal(t, uint32(3), kt[0].kvno)
+
+	_, ok := kt.find("http/Authenticate.example.com@example.com", etypeAES256CTSHMACSHA196, 3)
+	assert.True(t, ok)
+	_, ok = kt.find("HTTP/authenticate.example.com@EXAMPLE.COM", etypeAES128CTSHMACSHA196, 3)
+	assert.False(t, ok)
+	_, ok = kt.find("HTTP/authenticate.example.com@EXAMPLE.COM", etypeAES256CTSHMACSHA196, 4)
+	assert.False(t, ok)
+
+	_, err = parseKeytab([]byte{0x05, 0x01})
+	assert.Error(t, err)
+	_, err = parseKeytab(raw[:20])
+	assert.Error(t, err)
+}
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	serviceKey := make([]byte, 32)
+	_, _ = rand.Read(serviceKey)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	p, err := New(ctx, &oauth.Options{
+		RedirectURL:    &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+		KerberosKeytab: base64.StdEncoding.EncodeToString(newKeytab("HTTP/authenticate.example.com@EXAMPLE.COM", 3, etypeAES256CTSHMACSHA196, serviceKey)),
+	})
+	require.NoError(t, err)
+	p.now = func() time.Time { return now }
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	assert.Equal(t, "https://authenticate.example.com/oauth2/kerberos?state=STATE", signInURL)
+
+	token := newSPNEGOToken(t, serviceKey, now, now)
+	code, err := p.Negotiate(ctx, token)
+	require.NoError(t, err)
+
+	var claims testClaims
+	oauthToken, err := p.Authenticate(ctx, code, &claims)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@EXAMPLE.COM", claims["sub"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.Equal(t, "alice", claims["name"])
+
+	assert.Equal(t, now.Add(refreshInterval), oauthToken.Expiry)
+
+	claims = nil
+	_, err = p.Refresh(ctx, oauthToken, &claims)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@EXAMPLE.COM", claims["user"])
+
+	t.Run("token expiry", func(t *testing.T) {
+		defer func() { p.now = func() time.Time { return now } }()
+
+		p.now = func() time.Time { return now.Add(9*time.Hour + 30*time.Minute) }
+		refreshed, err := p.Refresh(ctx, oauthToken, &testClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(10*time.Hour), refreshed.Expiry.UTC(),
+			"tokens should not be refreshed past the end time of the ticket")
+
+		p.now = func() time.Time { return now.Add(11 * time.Hour) }
+		_, err = p.Refresh(ctx, refreshed, &testClaims{})
+		assert.Error(t, err, "tokens should expire along with the ticket")
+		assert.Error(t, p.UpdateUserInfo(ctx, refreshed, &testClaims{}))
+
+		p.now = func() time.Time { return now }
+		unexpiring, err := p.seal(purposeToken, sealedPrincipal{Principal: "alice@EXAMPLE.COM"})
+		require.NoError(t, err)
+		_, err = p.Refresh(ctx, &oauth2.Token{AccessToken: unexpiring}, &testClaims{})
+		assert.Error(t, err, "tokens without an expiry should be rejected")
+	})
+
+	_, err = p.Negotiate(ctx, token)
+	assert.ErrorIs(t, err, ErrNegotiationFailed, "authenticators should not be replayable")
+
+	_, err = p.Negotiate(ctx, newSPNEGOToken(t, serviceKey, now.Add(-time.Hour), now.Add(-11*time.Hour)))
+	assert.ErrorIs(t, err, ErrNegotiationFailed, "expired tickets should be rejected")
+
+	_, err = p.Negotiate(ctx, newSPNEGOToken(t, serviceKey, now.Add(-10*time.Minute), now))
+	assert.ErrorIs(t, err, ErrNegotiationFailed, "stale authenticators should be rejected")
+
+	otherKey := make([]byte, 32)
+	_, err = p.Negotiate(ctx, newSPNEGOToken(t, otherKey, now.Add(time.Second), now))
+	assert.ErrorIs(t, err, ErrNegotiationFailed, "tickets for other keys should be rejected")
+
+	_, err = p.Negotiate(ctx, "not a token")
+	assert.ErrorIs(t, err, ErrNegotiationFailed)
+
+	_, err = New(ctx, &oauth.Options{RedirectURL: &url.URL{}})
+	assert.Error(t, err, "should require a keytab")
+}
+
+type testClaims map[string]any
+
+func (testClaims) SetRawIDToken(string) {}
+
+// newSPNEGOToken returns a SPNEGO token for alice@EXAMPLE.COM, with a ticket
+// issued at authTime and an authenticator created at ctime.
+func newSPNEGOToken(t *testing.T, serviceKey []byte, ctime, authTime time.Time) string {
+	t.Helper()
+
+	sessionKey := make([]byte, 32)
+	_, _ = rand.Read(sessionKey)
+	cname := principalName{NameType: 1, NameString: []string{"alice"}}
+
+	encPart, err := asn1.MarshalWithParams(encTicketPart{
+		Flags:     asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+		Key:       encryptionKey{KeyType: etypeAES256CTSHMACSHA196, KeyValue: sessionKey},
+		CRealm:    "EXAMPLE.COM",
+		CName:     cname,
+		Transited: transitedEncoding{Contents: []byte{}},
+		AuthTime:  authTime,
+		EndTime:   authTime.Add(10 * time.Hour),
+	}, "application,explicit,tag:3")
+	require.NoError(t, err)
+	tkt, err := asn1.MarshalWithParams(ticket{
+		TktVNO: pvno,
+		Realm:  "EXAMPLE.COM",
+		SName:  principalName{NameType: 2, NameString: []string{"HTTP", "authenticate.example.com"}},
+		EncPart: encryptedData{
+			EType:  etypeAES256CTSHMACSHA196,
+			KVNO:   3,
+			Cipher: encrypt(t, serviceKey, keyUsageTicket, encPart),
+		},
+	}, "application,explicit,tag:1")
+	require.NoError(t, err)
+
+	auth, err := asn1.MarshalWithParams(authenticator{
+		AuthenticatorVNO: pvno,
+		CRealm:           "EXAMPLE.COM",
+		CName:            cname,
+		CUSec:            123,
+		CTime:            ctime,
+	}, "application,explicit,tag:2")
+	require.NoError(t, err)
+
+	req, err := asn1.MarshalWithParams(apReq{
+		PVNO:      pvno,
+		MsgType:   msgTypeAPReq,
+		APOptions: asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+		Ticket:    asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: tkt},
+		Authenticator: encryptedData{
+			EType:  etypeAES256CTSHMACSHA196,
+			Cipher: encrypt(t, sessionKey, keyUsageAuthenticator, auth),
+		},
+	}, "application,explicit,tag:14")
+	require.NoError(t, err)
+
+	mechToken := newGSSToken(t, oidKRB5, append(append([]byte{}, tokIDAPReq...), req...))
+	init, err := asn1.MarshalWithParams(negTokenInit{
+		MechTypes: []asn1.ObjectIdentifier{oidMSKRB5, oidKRB5},
+		MechToken: mechToken,
+	}, "explicit,tag:0")
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(newGSSToken(t, oidSPNEGO, init))
+}
+
+func newGSSToken(t *testing.T, mech asn1.ObjectIdentifier, inner []byte) []byte {
+	t.Helper()
+
+	oid, err := asn1.Marshal(mech)
+	require.NoError(t, err)
+	b, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassApplication,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append(oid, inner...),
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func newKeytab(principal string, kvno uint8, etype uint16, key []byte) []byte {
+	var entry []byte
+	putString := func(s string) {
+		entry = binary.BigEndian.AppendUint16(entry, uint16(len(s)))
+		entry = append(entry, s...)
+	}
+
+	service, realm := principal[:len(principal)-len("@EXAMPLE.COM")], "EXAMPLE.COM"
+	entry = binary.BigEndian.AppendUint16(entry, 2)
+	putString(realm)
+	putString(service[:4])
+	putString(service[5:])
+	entry = binary.BigEndian.AppendUint32(entry, 1)
+	entry = binary.BigEndian.AppendUint32(entry, 0)
+	entry = append(entry, kvno)
+	entry = binary.BigEndian.AppendUint16(entry, etype)
+	putString(string(key))
+
+	b := []byte{0x05, 0x02}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(entry)))
+	return append(b, entry...)
+}
+
+// encrypt is the inverse of decrypt.
+func encrypt(t *testing.T, key []byte, usage uint32, plaintext []byte) []byte {
+	t.Helper()
+
+	ke, err := deriveKey(key, usage, 0xAA)
+	require.NoError(t, err)
+	ki, err := deriveKey(key, usage, 0x55)
+	require.NoError(t, err)
+
+	b := make([]byte, confounderSize, confounderSize+len(plaintext))
+	_, _ = rand.Read(b)
+	b = append(b, plaintext...)
+	h := hmac.New(sha1.New, ki)
+	h.Write(b)
+	return append(encryptCTS(t, ke, b), h.Sum(nil)[:hmacSize]...)
+}
+
+func encryptCTS(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	n := len(plaintext)
+	padded := make([]byte, (n+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	copy(padded, plaintext)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(ciphertext, padded)
+	if n == aes.BlockSize {
+		return ciphertext
+	}
+
+	// swap the last two blocks and truncate
+	last := n - (len(padded) - aes.BlockSize)
+	out := append([]byte{}, ciphertext[:len(padded)-2*aes.BlockSize]...)
+	out = append(out, ciphertext[len(padded)-aes.BlockSize:]...)
+	out = append(out, ciphertext[len(padded)-2*aes.BlockSize:len(padded)-2*aes.BlockSize+last]...)
+	return out
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
@@ -0,0 +1,139 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A keytabEntry is a key of a service principal.
+type keytabEntry struct {
+	principal string // e.g. HTTP/authenticate.example.com@EXAMPLE.COM
+	kvno      uint32
+	etype     int32
+	key       []byte
+}
+
+// A keytab is a list of service principal keys, in the MIT keytab format
+// written by ktutil and ktpass.
+type keytab []keytabEntry
+
+// parseKeytab parses a version 2 keytab.
+func parseKeytab(b []byte) (keytab, error) {
+	if len(b) < 2 || b[0] != 0x05 || b[1] != 0x02 {
+		return nil, errors.New("kerberos: unsupported keytab version")
+	}
+	b = b[2:]
+
+	var kt keytab
+	for len(b) >= 4 {
+		size := int32(binary.BigEndian.Uint32(b))
+		b = b[4:]
+		// negative sizes are holes left by deleted entries
+		if size < 0 {
+			size = -size
+			if int(size) > len(b) {
+				return nil, errors.New("kerberos: invalid keytab")
+			}
+			b = b[size:]
+			continue
+		}
+		if int(size) > len(b) {
+			return nil, errors.New("kerberos: invalid keytab")
+		}
+		entry, err := parseKeytabEntry(b[:size])
+		if err != nil {
+			return nil, err
+		}
+		kt = append(kt, entry)
+		b = b[size:]
+	}
+	return kt, nil
+}
+
+func parseKeytabEntry(b []byte) (keytabEntry, error) {
+	r := &keytabReader{b: b}
+	var e keytabEntry
+
+	components := int(r.uint16())
+	realm := r.string()
+	names := make([]string, components)
+	for i := range names {
+		names[i] = r.string()
+	}
+	e.principal = strings.Join(names, "/") + "@" + realm
+	_ = r.uint32() // name type
+	_ = r.uint32() // timestamp
+	e.kvno = uint32(r.uint8())
+	e.etype = int32(r.uint16())
+	e.key = r.bytes()
+	// newer keytabs append the full 32 bit key version number
+	if r.err == nil && len(r.b) >= 4 {
+		if kvno := r.uint32(); kvno != 0 {
+			e.kvno = kvno
+		}
+	}
+	if r.err != nil {
+		return e, fmt.Errorf("kerberos: invalid keytab entry: %w", r.err)
+	}
+	return e, nil
+}
+
+// find returns the key of a principal, with the given encryption type and key
+// version number. Principals are matched case-insensitively.
+func (kt keytab) find(principal string, etype int32, kvno uint32) ([]byte, bool) {
+	for _, e := range kt {
+		if strings.EqualFold(e.principal, principal) && e.etype == etype && (kvno == 0 || e.kvno == kvno) {
+			return e.key, true
+		}
+	}
+	return nil, false
+}
+
+type keytabReader struct {
+	b   []byte
+	err error
+}
+
+func (r *keytabReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = errors.New("unexpected end of entry")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *keytabReader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *keytabReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *keytabReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *keytabReader) bytes() []byte {
+	return r.next(int(r.uint16()))
+}
+
+func (r *keytabReader) string() string {
+	return string(r.bytes())
+}
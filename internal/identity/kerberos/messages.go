@@ -0,0 +1,161 @@
+package kerberos
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mechanism OIDs, from RFC 4178 and RFC 1964. Windows clients may use the
+// OID of the Microsoft implementation of Kerberos 5.
+var (
+	oidSPNEGO   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidKRB5     = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	oidMSKRB5   = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+	tokIDAPReq  = []byte{0x01, 0x00}
+	errNoKRB5   = errors.New("kerberos: token does not contain a kerberos 5 ticket")
+	errBadToken = errors.New("kerberos: invalid token")
+)
+
+const (
+	pvno         = 5
+	msgTypeAPReq = 14
+)
+
+// The following are the messages of RFC 4120 and RFC 4178 which are needed to
+// accept an AP-REQ. Kerberos uses explicit tags throughout.
+
+type negTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	ReqFlags    asn1.BitString          `asn1:"explicit,optional,tag:1"`
+	MechToken   []byte                  `asn1:"explicit,optional,tag:2"`
+	MechListMIC []byte                  `asn1:"explicit,optional,tag:3"`
+}
+
+type apReq struct {
+	PVNO          int            `asn1:"explicit,tag:0"`
+	MsgType       int            `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"explicit,tag:3"`
+	Authenticator encryptedData  `asn1:"explicit,tag:4"`
+}
+
+type ticket struct {
+	TktVNO  int           `asn1:"explicit,tag:0"`
+	Realm   string        `asn1:"explicit,tag:1"`
+	SName   principalName `asn1:"explicit,tag:2"`
+	EncPart encryptedData `asn1:"explicit,tag:3"`
+}
+
+type encTicketPart struct {
+	Flags             asn1.BitString    `asn1:"explicit,tag:0"`
+	Key               encryptionKey     `asn1:"explicit,tag:1"`
+	CRealm            string            `asn1:"explicit,tag:2"`
+	CName             principalName     `asn1:"explicit,tag:3"`
+	Transited         transitedEncoding `asn1:"explicit,tag:4"`
+	AuthTime          time.Time         `asn1:"generalized,explicit,tag:5"`
+	StartTime         time.Time         `asn1:"generalized,explicit,optional,tag:6"`
+	EndTime           time.Time         `asn1:"generalized,explicit,tag:7"`
+	RenewTill         time.Time         `asn1:"generalized,explicit,optional,tag:8"`
+	CAddr             asn1.RawValue     `asn1:"explicit,optional,tag:9"`
+	AuthorizationData asn1.RawValue     `asn1:"explicit,optional,tag:10"`
+}
+
+type authenticator struct {
+	AuthenticatorVNO  int           `asn1:"explicit,tag:0"`
+	CRealm            string        `asn1:"explicit,tag:1"`
+	CName             principalName `asn1:"explicit,tag:2"`
+	Cksum             asn1.RawValue `asn1:"explicit,optional,tag:3"`
+	CUSec             int           `asn1:"explicit,tag:4"`
+	CTime             time.Time     `asn1:"generalized,explicit,tag:5"`
+	SubKey            asn1.RawValue `asn1:"explicit,optional,tag:6"`
+	SeqNumber         int64         `asn1:"explicit,optional,tag:7"`
+	AuthorizationData asn1.RawValue `asn1:"explicit,optional,tag:8"`
+}
+
+type principalName struct {
+	NameType   int32    `asn1:"explicit,tag:0"`
+	NameString []string `asn1:"explicit,tag:1"`
+}
+
+func (pn principalName) String() string {
+	return strings.Join(pn.NameString, "/")
+}
+
+type encryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int64  `asn1:"explicit,optional,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+type encryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+type transitedEncoding struct {
+	TRType   int32  `asn1:"explicit,tag:0"`
+	Contents []byte `asn1:"explicit,tag:1"`
+}
+
+// parseGSSToken parses a GSS-API initial context token (RFC 2743 section 3.1),
+// returning the mechanism and the inner token.
+func parseGSSToken(b []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var outer asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &outer)
+	if err != nil || len(rest) > 0 || outer.Class != asn1.ClassApplication || outer.Tag != 0 {
+		return nil, nil, errBadToken
+	}
+	var mech asn1.ObjectIdentifier
+	inner, err := asn1.Unmarshal(outer.Bytes, &mech)
+	if err != nil {
+		return nil, nil, errBadToken
+	}
+	return mech, inner, nil
+}
+
+// parseAPReq returns the AP-REQ of a SPNEGO or raw Kerberos 5 GSS token.
+func parseAPReq(token []byte) (*apReq, error) {
+	mech, inner, err := parseGSSToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if mech.Equal(oidSPNEGO) {
+		var init negTokenInit
+		_, err = asn1.UnmarshalWithParams(inner, &init, "explicit,tag:0")
+		if err != nil {
+			return nil, fmt.Errorf("kerberos: invalid negTokenInit: %w", err)
+		}
+		// only the optimistic token of the preferred mechanism is accepted,
+		// so clients offering NTLM first are rejected
+		if len(init.MechTypes) == 0 || !isKRB5(init.MechTypes[0]) || len(init.MechToken) == 0 {
+			return nil, errNoKRB5
+		}
+		mech, inner, err = parseGSSToken(init.MechToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !isKRB5(mech) || !bytes.HasPrefix(inner, tokIDAPReq) {
+		return nil, errNoKRB5
+	}
+
+	var req apReq
+	_, err = asn1.UnmarshalWithParams(inner[len(tokIDAPReq):], &req, "application,explicit,tag:14")
+	if err != nil {
+		return nil, fmt.Errorf("kerberos: invalid AP-REQ: %w", err)
+	}
+	if req.PVNO != pvno || req.MsgType != msgTypeAPReq {
+		return nil, errors.New("kerberos: invalid AP-REQ")
+	}
+	return &req, nil
+}
+
+func isKRB5(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(oidKRB5) || oid.Equal(oidMSKRB5)
+}
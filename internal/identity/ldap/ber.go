@@ -0,0 +1,184 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifiers used by LDAP messages.
+//
+// https://datatracker.ietf.org/doc/html/rfc4511#section-4
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	tagBindRequest           = 0x60
+	tagBindResponse          = 0x61
+	tagUnbindRequest         = 0x42
+	tagSearchRequest         = 0x63
+	tagSearchResultEntry     = 0x64
+	tagSearchResultDone      = 0x65
+	tagSearchResultReference = 0x73
+
+	tagSimpleAuthentication = 0x80
+)
+
+// maxMessageSize limits the size of messages read from the server.
+const maxMessageSize = 16 << 20
+
+var errMalformedBER = errors.New("ldap: malformed BER data")
+
+type berElement struct {
+	tag   byte
+	value []byte
+}
+
+func berAppend(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag)
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, value...)
+}
+
+func berBytes(tag byte, value []byte) []byte {
+	return berAppend(nil, tag, value)
+}
+
+func berString(tag byte, value string) []byte {
+	return berAppend(nil, tag, []byte(value))
+}
+
+func berInt(tag byte, n int64) []byte {
+	// minimal two's complement big-endian encoding
+	v := []byte{byte(n)}
+	for n > 0x7f || n < -0x80 {
+		n >>= 8
+		v = append([]byte{byte(n)}, v...)
+	}
+	return berAppend(nil, tag, v)
+}
+
+func berBool(value bool) []byte {
+	if value {
+		return berAppend(nil, tagBoolean, []byte{0xff})
+	}
+	return berAppend(nil, tagBoolean, []byte{0x00})
+}
+
+func berConstructed(tag byte, children ...[]byte) []byte {
+	return berAppend(nil, tag, bytes.Join(children, nil))
+}
+
+// berParseLength parses a definite length. Long form lengths don't have to be
+// minimal, since Active Directory always uses four bytes.
+func berParseLength(b []byte) (length, size int, err error) {
+	if len(b) == 0 {
+		return 0, 0, errMalformedBER
+	}
+	if b[0] < 0x80 {
+		return int(b[0]), 1, nil
+	}
+	n := int(b[0] & 0x7f)
+	if n == 0 || n > 4 || len(b) < 1+n {
+		return 0, 0, errMalformedBER
+	}
+	for _, c := range b[1 : 1+n] {
+		length = length<<8 | int(c)
+	}
+	if length < 0 {
+		return 0, 0, errMalformedBER
+	}
+	return length, 1 + n, nil
+}
+
+// berParse splits the first element off of b.
+func berParse(b []byte) (el berElement, rest []byte, err error) {
+	if len(b) < 2 {
+		return el, nil, errMalformedBER
+	}
+	el.tag = b[0]
+	if el.tag&0x1f == 0x1f {
+		return el, nil, fmt.Errorf("ldap: unsupported BER tag: %#x", el.tag)
+	}
+	length, size, err := berParseLength(b[1:])
+	if err != nil {
+		return el, nil, err
+	}
+	b = b[1+size:]
+	if len(b) < length {
+		return el, nil, errMalformedBER
+	}
+	el.value = b[:length]
+	return el, b[length:], nil
+}
+
+// berParseAll parses all the elements in b.
+func berParseAll(b []byte) ([]berElement, error) {
+	var els []berElement
+	for len(b) > 0 {
+		el, rest, err := berParse(b)
+		if err != nil {
+			return nil, err
+		}
+		els = append(els, el)
+		b = rest
+	}
+	return els, nil
+}
+
+func berParseInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errMalformedBER
+	}
+	// sign extend the first byte
+	n := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n, nil
+}
+
+// berRead reads a single element from r.
+func berRead(r *bufio.Reader) (berElement, error) {
+	var el berElement
+	hdr, err := r.Peek(2)
+	if err != nil {
+		return el, err
+	}
+	size := 1
+	if hdr[1] >= 0x80 {
+		size += int(hdr[1] & 0x7f)
+	}
+	hdr, err = r.Peek(1 + size)
+	if err != nil {
+		return el, err
+	}
+	length, _, err := berParseLength(hdr[1:])
+	if err != nil {
+		return el, err
+	}
+	if length > maxMessageSize {
+		return el, fmt.Errorf("ldap: message too large: %d bytes", length)
+	}
+	b := make([]byte, 1+size+length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return el, err
+	}
+	el, _, err = berParse(b)
+	return el, err
+}
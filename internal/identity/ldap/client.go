@@ -0,0 +1,264 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// result codes
+//
+// https://datatracker.ietf.org/doc/html/rfc4511#section-4.1.9
+const (
+	resultSuccess            = 0
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+)
+
+// search scopes
+const (
+	scopeBaseObject   = 0
+	scopeSingleLevel  = 1
+	scopeWholeSubtree = 2
+)
+
+const derefNever = 0
+
+// A ResultError is returned when an LDAP operation fails.
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+// Error implements the error interface.
+func (err *ResultError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", err.Code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", err.Code, err.Message)
+}
+
+type entry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// get returns the first value of an attribute.
+func (e *entry) get(name string) string {
+	if vs := e.attributes[strings.ToLower(name)]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+type conn struct {
+	c     net.Conn
+	r     *bufio.Reader
+	msgID int64
+}
+
+// dial connects to an ldap:// or ldaps:// server. The connection's deadline is
+// set from the context.
+func dial(ctx context.Context, u *url.URL) (*conn, error) {
+	var d net.Dialer
+	var nc net.Conn
+	var err error
+	switch u.Scheme {
+	case "ldap":
+		nc, err = d.DialContext(ctx, "tcp", hostPort(u, "389"))
+	case "ldaps":
+		td := &tls.Dialer{
+			NetDialer: &d,
+			Config: &tls.Config{
+				ServerName: u.Hostname(),
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+		nc, err = td.DialContext(ctx, "tcp", hostPort(u, "636"))
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme: %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap: error connecting to server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+	}
+	return &conn{c: nc, r: bufio.NewReader(nc)}, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+func (c *conn) Close() error {
+	_, _ = c.send(berBytes(tagUnbindRequest, nil))
+	return c.c.Close()
+}
+
+func (c *conn) send(op []byte) (int64, error) {
+	c.msgID++
+	msg := berConstructed(tagSequence, berInt(tagInteger, c.msgID), op)
+	if _, err := c.c.Write(msg); err != nil {
+		return 0, fmt.Errorf("ldap: error writing request: %w", err)
+	}
+	return c.msgID, nil
+}
+
+// receive reads the next message from the server and returns its protocol op.
+func (c *conn) receive(msgID int64) (berElement, error) {
+	msg, err := berRead(c.r)
+	if err != nil {
+		return berElement{}, fmt.Errorf("ldap: error reading response: %w", err)
+	}
+	if msg.tag != tagSequence {
+		return berElement{}, errMalformedBER
+	}
+	els, err := berParseAll(msg.value)
+	if err != nil {
+		return berElement{}, err
+	}
+	if len(els) < 2 || els[0].tag != tagInteger {
+		return berElement{}, errMalformedBER
+	}
+	id, err := berParseInt(els[0].value)
+	if err != nil {
+		return berElement{}, err
+	}
+	if id != msgID {
+		// this is most likely a notice of disconnection (message id 0)
+		return berElement{}, fmt.Errorf("ldap: unexpected message id %d", id)
+	}
+	return els[1], nil
+}
+
+// bind performs a simple bind.
+func (c *conn) bind(dn, password string) error {
+	id, err := c.send(berConstructed(tagBindRequest,
+		berInt(tagInteger, 3),
+		berString(tagOctetString, dn),
+		berString(tagSimpleAuthentication, password)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != tagBindResponse {
+		return fmt.Errorf("ldap: unexpected response to bind request: %#x", op.tag)
+	}
+	return parseResult(op.value)
+}
+
+// search returns the entries matching the filter. Search result references
+// are ignored.
+func (c *conn) search(baseDN string, scope int64, filter string, attributes ...string) ([]*entry, error) {
+	f, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([][]byte, len(attributes))
+	for i, attr := range attributes {
+		attrs[i] = berString(tagOctetString, attr)
+	}
+
+	id, err := c.send(berConstructed(tagSearchRequest,
+		berString(tagOctetString, baseDN),
+		berInt(tagEnumerated, scope),
+		berInt(tagEnumerated, derefNever),
+		berInt(tagInteger, 0), // size limit
+		berInt(tagInteger, 0), // time limit
+		berBool(false),        // types only
+		f,
+		berConstructed(tagSequence, attrs...)))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case tagSearchResultEntry:
+			e, err := parseEntry(op.value)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case tagSearchResultReference:
+		case tagSearchResultDone:
+			err := parseResult(op.value)
+			var resultErr *ResultError
+			if errors.As(err, &resultErr) && resultErr.Code == resultNoSuchObject {
+				return nil, nil
+			}
+			return entries, err
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response to search request: %#x", op.tag)
+		}
+	}
+}
+
+func parseResult(b []byte) error {
+	els, err := berParseAll(b)
+	if err != nil {
+		return err
+	}
+	if len(els) < 3 || els[0].tag != tagEnumerated {
+		return errMalformedBER
+	}
+	code, err := berParseInt(els[0].value)
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return &ResultError{Code: code, Message: string(els[2].value)}
+	}
+	return nil
+}
+
+func parseEntry(b []byte) (*entry, error) {
+	els, err := berParseAll(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(els) != 2 || els[0].tag != tagOctetString || els[1].tag != tagSequence {
+		return nil, errMalformedBER
+	}
+	e := &entry{dn: string(els[0].value), attributes: make(map[string][]string)}
+
+	attrs, err := berParseAll(els[1].value)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		parts, err := berParseAll(attr.value)
+		if err != nil {
+			return nil, err
+		}
+		if attr.tag != tagSequence || len(parts) != 2 || parts[1].tag != tagSet {
+			return nil, errMalformedBER
+		}
+		vals, err := berParseAll(parts[1].value)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(string(parts[0].value))
+		for _, val := range vals {
+			e.attributes[name] = append(e.attributes[name], string(val.value))
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,192 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// filter choice tags
+//
+// https://datatracker.ietf.org/doc/html/rfc4511#section-4.5.1.7
+const (
+	filterAnd            = 0xa0
+	filterOr             = 0xa1
+	filterNot            = 0xa2
+	filterEqualityMatch  = 0xa3
+	filterSubstrings     = 0xa4
+	filterGreaterOrEqual = 0xa5
+	filterLessOrEqual    = 0xa6
+	filterPresent        = 0x87
+	filterApproxMatch    = 0xa8
+	substringInitial     = 0x80
+	substringAny         = 0x81
+	substringFinal       = 0x82
+)
+
+const maxFilterNestingDepth = 32
+
+// compileFilter compiles a string search filter to its BER encoding.
+// Extensible match filters are not supported.
+//
+// https://datatracker.ietf.org/doc/html/rfc4515
+func compileFilter(s string) ([]byte, error) {
+	f, rest, err := parseFilter(s, 0)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid filter %q: %w", s, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("ldap: invalid filter %q: unexpected trailing data", s)
+	}
+	return f, nil
+}
+
+func parseFilter(s string, depth int) ([]byte, string, error) {
+	if depth > maxFilterNestingDepth {
+		return nil, "", fmt.Errorf("too deeply nested")
+	}
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("expected (")
+	}
+	s = s[1:]
+
+	var f []byte
+	switch {
+	case strings.HasPrefix(s, "&"), strings.HasPrefix(s, "|"):
+		tag := byte(filterAnd)
+		if s[0] == '|' {
+			tag = filterOr
+		}
+		s = s[1:]
+		var children [][]byte
+		for strings.HasPrefix(s, "(") {
+			var child []byte
+			var err error
+			child, s, err = parseFilter(s, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			children = append(children, child)
+		}
+		f = berConstructed(tag, children...)
+	case strings.HasPrefix(s, "!"):
+		child, rest, err := parseFilter(s[1:], depth+1)
+		if err != nil {
+			return nil, "", err
+		}
+		f, s = berConstructed(filterNot, child), rest
+	default:
+		idx := strings.IndexByte(s, ')')
+		if idx < 0 {
+			return nil, "", fmt.Errorf("expected )")
+		}
+		var err error
+		f, err = parseFilterItem(s[:idx])
+		if err != nil {
+			return nil, "", err
+		}
+		s = s[idx:]
+	}
+
+	if !strings.HasPrefix(s, ")") {
+		return nil, "", fmt.Errorf("expected )")
+	}
+	return f, s[1:], nil
+}
+
+func parseFilterItem(s string) ([]byte, error) {
+	idx := strings.IndexByte(s, '=')
+	if idx <= 0 {
+		return nil, fmt.Errorf("expected attribute=value")
+	}
+	attr, value := s[:idx], s[idx+1:]
+
+	tag := byte(filterEqualityMatch)
+	switch attr[len(attr)-1] {
+	case '~':
+		tag = filterApproxMatch
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	}
+	if tag != filterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" || strings.ContainsAny(attr, ":()*\\") {
+		return nil, fmt.Errorf("unsupported attribute description: %q", attr)
+	}
+
+	if tag == filterEqualityMatch && value == "*" {
+		return berString(filterPresent, attr), nil
+	}
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		var substrings [][]byte
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			v, err := unescapeFilterValue(part)
+			if err != nil {
+				return nil, err
+			}
+			switch i {
+			case 0:
+				substrings = append(substrings, berString(substringInitial, v))
+			case len(parts) - 1:
+				substrings = append(substrings, berString(substringFinal, v))
+			default:
+				substrings = append(substrings, berString(substringAny, v))
+			}
+		}
+		return berConstructed(filterSubstrings,
+			berString(tagOctetString, attr),
+			berConstructed(tagSequence, substrings...)), nil
+	}
+
+	v, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return berConstructed(tag,
+		berString(tagOctetString, attr),
+		berString(tagOctetString, v)), nil
+}
+
+func unescapeFilterValue(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("invalid escape sequence")
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape sequence: %w", err)
+		}
+		sb.Write(b)
+		i += 2
+	}
+	return sb.String(), nil
+}
+
+// escapeFilterValue escapes a value so it can be used in a search filter.
+func escapeFilterValue(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&sb, "\\%02x", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
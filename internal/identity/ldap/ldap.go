@@ -0,0 +1,404 @@
+// Package ldap implements an identity provider that authenticates users with
+// a simple bind against an LDAP directory, such as Active Directory or
+// OpenLDAP.
+//
+// The provider url is an LDAP URL (RFC 4516) with the base DN, the attribute
+// users sign in with, the search scope and a filter for user entries:
+//
+//	ldaps://ldap.example.com/dc=example,dc=com?sAMAccountName?sub?(objectClass=user)
+//
+// The client id and secret are the DN and password of the service account
+// used to search the directory.
+package ldap
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// Name identifies the LDAP identity provider.
+const Name = "ldap"
+
+// SignInPath is the path of the sign in form served by the authenticate
+// service.
+const SignInPath = "/oauth2/ldap"
+
+const (
+	defaultLoginAttribute = "uid"
+	defaultFilter         = "(objectClass=*)"
+
+	// since there are no tokens to expire, sessions are periodically refreshed
+	// against the directory so that disabled users and group changes are
+	// picked up
+	refreshInterval = 15 * time.Minute
+	// how long a sign in code can be redeemed for
+	codeTTL = time.Minute
+	timeout = 10 * time.Second
+	// how many levels of nested groups are followed
+	maxGroupDepth = 8
+
+	purposeCode  = "ldap code"
+	purposeToken = "ldap access token"
+
+	// https://learn.microsoft.com/en-us/troubleshoot/windows-server/identity/useraccountcontrol-manipulate-account-properties
+	adAccountDisable = 0x2
+)
+
+// ErrInvalidCredentials is returned by SignIn when the username or password
+// is wrong.
+var ErrInvalidCredentials = errors.New("ldap: invalid username or password")
+
+var errUserNotFound = errors.New("ldap: user not found or disabled")
+
+// Provider is an LDAP identity provider.
+type Provider struct {
+	serverURL      *url.URL
+	baseDN         string
+	loginAttribute string
+	scope          int64
+	filter         string
+	bindDN         string
+	bindPassword   string
+	redirectURL    *url.URL
+	cipher         cipher.AEAD
+}
+
+// New creates a new LDAP identity provider.
+func New(_ context.Context, o *oauth.Options) (*Provider, error) {
+	if o.ProviderURL == "" {
+		return nil, oidc.ErrMissingProviderURL
+	}
+	if o.ClientID == "" || o.ClientSecret == "" {
+		return nil, errors.New("ldap: client id and client secret are required")
+	}
+	if o.RedirectURL == nil {
+		return nil, errors.New("ldap: redirect url is required")
+	}
+
+	u, err := url.Parse(o.ProviderURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid provider url: %w", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, fmt.Errorf("ldap: unsupported provider url scheme: %s", u.Scheme)
+	}
+
+	p := &Provider{
+		serverURL:      &url.URL{Scheme: u.Scheme, Host: u.Host},
+		baseDN:         strings.TrimPrefix(u.Path, "/"),
+		loginAttribute: defaultLoginAttribute,
+		scope:          scopeWholeSubtree,
+		filter:         defaultFilter,
+		bindDN:         o.ClientID,
+		bindPassword:   o.ClientSecret,
+		redirectURL:    o.RedirectURL,
+	}
+
+	// attributes?scope?filter?extensions
+	parts := strings.Split(u.RawQuery, "?")
+	for i := range parts {
+		if parts[i], err = url.QueryUnescape(parts[i]); err != nil {
+			return nil, fmt.Errorf("ldap: invalid provider url: %w", err)
+		}
+	}
+	if len(parts) > 0 && parts[0] != "" {
+		p.loginAttribute = strings.Split(parts[0], ",")[0]
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		switch parts[1] {
+		case "base":
+			p.scope = scopeBaseObject
+		case "one":
+			p.scope = scopeSingleLevel
+		case "sub":
+			p.scope = scopeWholeSubtree
+		default:
+			return nil, fmt.Errorf("ldap: invalid search scope: %s", parts[1])
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		p.filter = parts[2]
+	}
+	if _, err := compileFilter(p.filter); err != nil {
+		return nil, err
+	}
+
+	key := cryptutil.Hash("ldap provider", []byte(o.ClientID+"\x00"+o.ClientSecret))
+	p.cipher, err = cryptutil.NewAEADCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SignIn verifies a user's credentials and returns a short-lived code which
+// can be redeemed with Authenticate.
+func (p *Provider) SignIn(ctx context.Context, username, password string) (string, error) {
+	// a simple bind with an empty password is an unauthenticated bind, which
+	// always succeeds
+	if username == "" || password == "" {
+		return "", ErrInvalidCredentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c, err := p.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", p.filter, p.loginAttribute, escapeFilterValue(username))
+	entries, err := c.search(p.baseDN, p.scope, filter, "1.1")
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 {
+		return "", ErrInvalidCredentials
+	}
+
+	err = c.bind(entries[0].dn, password)
+	var resultErr *ResultError
+	if errors.As(err, &resultErr) && resultErr.Code == resultInvalidCredentials {
+		return "", ErrInvalidCredentials
+	} else if err != nil {
+		return "", err
+	}
+
+	return p.seal(purposeCode, entries[0].dn, codeTTL)
+}
+
+// Authenticate redeems a code returned by SignIn.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, _ ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	dn, err := p.open(purposeCode, code)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(ctx, dn, v)
+}
+
+// Refresh looks up the user in the directory again, failing if the user no
+// longer exists or has been disabled.
+func (p *Provider) Refresh(ctx context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	if t == nil {
+		return nil, oidc.ErrMissingAccessToken
+	}
+	dn, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(ctx, dn, v)
+}
+
+// UpdateUserInfo looks up the user's attributes and groups.
+func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error {
+	if t == nil {
+		return oidc.ErrMissingAccessToken
+	}
+	dn, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return err
+	}
+	return p.userInfo(ctx, dn, v)
+}
+
+// Revoke does nothing, since there are no tokens to revoke.
+func (p *Provider) Revoke(_ context.Context, _ *oauth2.Token) error {
+	return nil
+}
+
+// GetSignInURL returns the URL of the authenticate service's sign in form.
+func (p *Provider) GetSignInURL(state string, _ ...oauth2.AuthCodeOption) (string, error) {
+	u := *p.redirectURL
+	u.Path = SignInPath
+	u.RawQuery = url.Values{"state": {state}}.Encode()
+	return u.String(), nil
+}
+
+// LogOut is not implemented by LDAP.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+func (p *Provider) authenticate(ctx context.Context, dn string, v identity.State) (*oauth2.Token, error) {
+	if err := p.userInfo(ctx, dn, v); err != nil {
+		return nil, err
+	}
+	accessToken, err := p.seal(purposeToken, dn, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(refreshInterval),
+	}, nil
+}
+
+func (p *Provider) userInfo(ctx context.Context, dn string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// the filter is applied again so users that no longer match it are
+	// signed out
+	entries, err := c.search(dn, scopeBaseObject, p.filter,
+		p.loginAttribute, "mail", "displayName", "cn", "userAccountControl", "pwdAccountLockedTime")
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || isDisabled(entries[0]) {
+		return errUserNotFound
+	}
+	e := entries[0]
+
+	groups, err := p.getGroups(c, e.dn)
+	if err != nil {
+		return err
+	}
+
+	var out struct {
+		Subject string   `json:"sub"`
+		User    string   `json:"user"`
+		Email   string   `json:"email,omitempty"`
+		Name    string   `json:"name,omitempty"`
+		Groups  []string `json:"groups"`
+		// needs to be set manually
+		Expiry    *jwt.NumericDate `json:"exp,omitempty"`
+		NotBefore *jwt.NumericDate `json:"nbf,omitempty"`
+		IssuedAt  *jwt.NumericDate `json:"iat,omitempty"`
+	}
+
+	out.Expiry = jwt.NewNumericDate(time.Now().Add(refreshInterval))
+	out.NotBefore = jwt.NewNumericDate(time.Now())
+	out.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	out.Subject = e.dn
+	out.User = e.get(p.loginAttribute)
+	out.Email = e.get("mail")
+	out.Name = e.get("displayName")
+	if out.Name == "" {
+		out.Name = e.get("cn")
+	}
+	out.Groups = groups
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// getGroups returns the DNs of the groups the entry is a member of, including
+// nested groups.
+func (p *Provider) getGroups(c *conn, dn string) ([]string, error) {
+	seen := map[string]bool{strings.ToLower(dn): true}
+	groups := []string{}
+	members := []string{dn}
+	for depth := 0; depth < maxGroupDepth && len(members) > 0; depth++ {
+		var next []string
+		for _, member := range members {
+			value := escapeFilterValue(member)
+			entries, err := c.search(p.baseDN, scopeWholeSubtree,
+				fmt.Sprintf("(|(member=%s)(uniqueMember=%s))", value, value), "1.1")
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				key := strings.ToLower(e.dn)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				groups = append(groups, e.dn)
+				next = append(next, e.dn)
+			}
+		}
+		members = next
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func isDisabled(e *entry) bool {
+	if uac, err := strconv.ParseInt(e.get("userAccountControl"), 10, 64); err == nil && uac&adAccountDisable != 0 {
+		return true
+	}
+	return e.get("pwdAccountLockedTime") != ""
+}
+
+// connect connects to the server and binds as the service account.
+func (p *Provider) connect(ctx context.Context) (*conn, error) {
+	c, err := dial(ctx, p.serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.bind(p.bindDN, p.bindPassword); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("ldap: error binding as service account: %w", err)
+	}
+	return c, nil
+}
+
+type sealedDN struct {
+	DN     string `json:"dn"`
+	Expiry int64  `json:"exp,omitempty"`
+}
+
+func (p *Provider) seal(purpose, dn string, ttl time.Duration) (string, error) {
+	v := sealedDN{DN: dn}
+	if ttl > 0 {
+		v.Expiry = time.Now().Add(ttl).Unix()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cryptutil.Encrypt(p.cipher, b, []byte(purpose))), nil
+}
+
+func (p *Provider) open(purpose, s string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("ldap: invalid %s: %w", purpose, err)
+	}
+	b, err := cryptutil.Decrypt(p.cipher, raw, []byte(purpose))
+	if err != nil {
+		return "", fmt.Errorf("ldap: invalid %s: %w", purpose, err)
+	}
+	var v sealedDN
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", fmt.Errorf("ldap: invalid %s: %w", purpose, err)
+	}
+	if v.Expiry != 0 && time.Now().Unix() > v.Expiry {
+		return "", fmt.Errorf("ldap: expired %s", purpose)
+	}
+	return v.DN, nil
+}
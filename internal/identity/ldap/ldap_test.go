@@ -0,0 +1,367 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func TestBER(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		el, rest, err := berParse(berInt(tagInteger, n))
+		require.NoError(t, err)
+		assert.Empty(t, rest)
+		v, err := berParseInt(el.value)
+		require.NoError(t, err)
+		assert.Equal(t, n, v)
+	}
+
+	// active directory uses non-minimal long form lengths
+	el, rest, err := berParse([]byte{tagOctetString, 0x84, 0, 0, 0, 2, 'h', 'i', 0xff})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(el.value))
+	assert.Equal(t, []byte{0xff}, rest)
+
+	_, _, err = berParse([]byte{tagOctetString, 0x84, 0, 0, 0, 3, 'h', 'i'})
+	assert.Error(t, err)
+	_, _, err = berParse([]byte{tagOctetString, 0x80})
+	assert.Error(t, err, "should reject indefinite lengths")
+
+	long := strings.Repeat("x", 300)
+	el, _, err = berParse(berString(tagOctetString, long))
+	require.NoError(t, err)
+	assert.Equal(t, long, string(el.value))
+}
+
+func TestCompileFilter(t *testing.T) {
+	t.Parallel()
+
+	f, err := compileFilter("(&(objectClass=person)(!(cn=a\\2ab))(mail=*)(sn=x*y*z))")
+	require.NoError(t, err)
+	assert.Equal(t, berConstructed(filterAnd,
+		berConstructed(filterEqualityMatch, berString(tagOctetString, "objectClass"), berString(tagOctetString, "person")),
+		berConstructed(filterNot,
+			berConstructed(filterEqualityMatch, berString(tagOctetString, "cn"), berString(tagOctetString, "a*b"))),
+		berString(filterPresent, "mail"),
+		berConstructed(filterSubstrings, berString(tagOctetString, "sn"), berConstructed(tagSequence,
+			berString(substringInitial, "x"),
+			berString(substringAny, "y"),
+			berString(substringFinal, "z"))),
+	), f)
+
+	for _, invalid := range []string{"", "cn=a", "(cn=a", "(cn=a))", "(=a)", "(cn:dn:=a)", "(cn=\\2)"} {
+		_, err := compileFilter(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	assert.Equal(t, "a\\2a\\28b\\29\\5c", escapeFilterValue("a*(b)\\"))
+}
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, "cn=svc,dc=example,dc=com", "svc-password")
+	srv.add("uid=alice,ou=people,dc=example,dc=com", "alice-password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"mail":        {"alice@example.com"},
+		"cn":          {"Alice"},
+	})
+	srv.add("uid=bob,ou=people,dc=example,dc=com", "bob-password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+	})
+	srv.add("cn=devs,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=com"},
+	})
+	srv.add("cn=eng,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"group"},
+		"member":      {"cn=devs,ou=groups,dc=example,dc=com", "cn=all,ou=groups,dc=example,dc=com"},
+	})
+	srv.add("cn=all,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass":  {"groupOfUniqueNames"},
+		"uniqueMember": {"cn=eng,ou=groups,dc=example,dc=com"},
+	})
+
+	p, err := New(context.Background(), &oauth.Options{
+		ProviderName: Name,
+		ProviderURL:  "ldap://" + srv.addr + "/dc=example,dc=com?uid?sub?(objectClass=person)",
+		ClientID:     "cn=svc,dc=example,dc=com",
+		ClientSecret: "svc-password",
+		RedirectURL:  &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+	})
+	require.NoError(t, err)
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	assert.Equal(t, "https://authenticate.example.com/oauth2/ldap?state=STATE", signInURL)
+
+	ctx := context.Background()
+	for _, creds := range [][2]string{{"alice", "wrong"}, {"alice", ""}, {"", ""}, {"nobody", "x"}, {"*", "alice-password"}} {
+		_, err := p.SignIn(ctx, creds[0], creds[1])
+		assert.ErrorIs(t, err, ErrInvalidCredentials, creds[0])
+	}
+
+	code, err := p.SignIn(ctx, "alice", "alice-password")
+	require.NoError(t, err)
+
+	var claims testClaims
+	token, err := p.Authenticate(ctx, code, &claims)
+	require.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=example,dc=com", claims["sub"])
+	assert.Equal(t, "alice", claims["user"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.Equal(t, "Alice", claims["name"])
+	assert.Equal(t, []any{
+		"cn=all,ou=groups,dc=example,dc=com",
+		"cn=devs,ou=groups,dc=example,dc=com",
+		"cn=eng,ou=groups,dc=example,dc=com",
+	}, claims["groups"], "should include nested groups")
+	assert.False(t, token.Expiry.IsZero())
+
+	_, err = p.Authenticate(ctx, token.AccessToken, &claims)
+	assert.Error(t, err, "should not accept an access token as a code")
+
+	token, err = p.Refresh(ctx, token, &claims)
+	require.NoError(t, err)
+
+	srv.set("uid=alice,ou=people,dc=example,dc=com", "userAccountControl", "514")
+	_, err = p.Refresh(ctx, token, &claims)
+	assert.Error(t, err, "should fail for disabled users")
+
+	t.Run("invalid service account", func(t *testing.T) {
+		p, err := New(context.Background(), &oauth.Options{
+			ProviderURL:  "ldap://" + srv.addr + "/dc=example,dc=com",
+			ClientID:     "cn=svc,dc=example,dc=com",
+			ClientSecret: "wrong",
+			RedirectURL:  &url.URL{Scheme: "https", Host: "authenticate.example.com"},
+		})
+		require.NoError(t, err)
+		_, err = p.SignIn(ctx, "bob", "bob-password")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	redirectURL := &url.URL{Scheme: "https", Host: "authenticate.example.com"}
+	for _, providerURL := range []string{
+		"",
+		"https://ldap.example.com",
+		"ldap://ldap.example.com/dc=example?uid?everything",
+		"ldap://ldap.example.com/dc=example?uid?sub?(uid=",
+	} {
+		_, err := New(context.Background(), &oauth.Options{
+			ProviderURL:  providerURL,
+			ClientID:     "cn=svc",
+			ClientSecret: "secret",
+			RedirectURL:  redirectURL,
+		})
+		assert.Error(t, err, providerURL)
+	}
+
+	_, err := New(context.Background(), &oauth.Options{
+		ProviderURL: "ldap://ldap.example.com/dc=example",
+		RedirectURL: redirectURL,
+	})
+	assert.Error(t, err, "should require a service account")
+
+	p, err := New(context.Background(), &oauth.Options{
+		ProviderURL:  "ldaps://ldap.example.com/ou=people,dc=example?sAMAccountName?one?(objectClass=user)",
+		ClientID:     "cn=svc",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ldaps://ldap.example.com", p.serverURL.String())
+	assert.Equal(t, "ou=people,dc=example", p.baseDN)
+	assert.Equal(t, "sAMAccountName", p.loginAttribute)
+	assert.Equal(t, int64(scopeSingleLevel), p.scope)
+	assert.Equal(t, "(objectClass=user)", p.filter)
+}
+
+type testClaims map[string]any
+
+func (testClaims) SetRawIDToken(string) {}
+
+// testServer is a minimal in-memory LDAP server supporting simple binds and
+// searches with equality, presence and boolean filters.
+type testServer struct {
+	addr string
+
+	mu        sync.Mutex
+	entries   map[string]map[string][]string
+	passwords map[string]string
+}
+
+func newTestServer(t *testing.T, bindDN, bindPassword string) *testServer {
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = li.Close() })
+
+	srv := &testServer{
+		addr:      li.Addr().String(),
+		entries:   make(map[string]map[string][]string),
+		passwords: map[string]string{bindDN: bindPassword},
+	}
+	go func() {
+		for {
+			c, err := li.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(c)
+		}
+	}()
+	return srv
+}
+
+func (srv *testServer) add(dn, password string, attributes map[string][]string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	attrs := make(map[string][]string)
+	for k, v := range attributes {
+		attrs[strings.ToLower(k)] = v
+	}
+	srv.entries[strings.ToLower(dn)] = attrs
+	if password != "" {
+		srv.passwords[dn] = password
+	}
+}
+
+func (srv *testServer) set(dn, attribute, value string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.entries[strings.ToLower(dn)][strings.ToLower(attribute)] = []string{value}
+}
+
+func (srv *testServer) serve(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	for {
+		msg, err := berRead(r)
+		if err != nil {
+			return
+		}
+		els, err := berParseAll(msg.value)
+		if err != nil || len(els) < 2 {
+			return
+		}
+		id := els[0].value
+		op, err := berParseAll(els[1].value)
+		if err != nil {
+			return
+		}
+
+		var responses [][]byte
+		switch els[1].tag {
+		case tagBindRequest:
+			code := int64(resultInvalidCredentials)
+			srv.mu.Lock()
+			if password, ok := srv.passwords[string(op[1].value)]; ok && password == string(op[2].value) {
+				code = resultSuccess
+			}
+			srv.mu.Unlock()
+			responses = append(responses, testResult(tagBindResponse, code))
+		case tagSearchRequest:
+			for dn, attrs := range srv.search(string(op[0].value), op[1].value, op[6]) {
+				var attributes [][]byte
+				for name, values := range attrs {
+					var vals [][]byte
+					for _, v := range values {
+						vals = append(vals, berString(tagOctetString, v))
+					}
+					attributes = append(attributes, berConstructed(tagSequence,
+						berString(tagOctetString, name),
+						berConstructed(tagSet, vals...)))
+				}
+				responses = append(responses, berConstructed(tagSearchResultEntry,
+					berString(tagOctetString, dn),
+					berConstructed(tagSequence, attributes...)))
+			}
+			responses = append(responses, testResult(tagSearchResultDone, resultSuccess))
+		case tagUnbindRequest:
+			return
+		}
+		for _, res := range responses {
+			if _, err := c.Write(berConstructed(tagSequence, berBytes(tagInteger, id), res)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (srv *testServer) search(baseDN string, scope []byte, filter berElement) map[string]map[string][]string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	results := make(map[string]map[string][]string)
+	baseDN = strings.ToLower(baseDN)
+	for dn, attrs := range srv.entries {
+		if scope[0] == scopeBaseObject && dn != baseDN {
+			continue
+		}
+		if !strings.HasSuffix(dn, baseDN) || !testMatch(filter, attrs) {
+			continue
+		}
+		results[dn] = attrs
+	}
+	return results
+}
+
+func testMatch(filter berElement, attrs map[string][]string) bool {
+	children, _ := berParseAll(filter.value)
+	switch filter.tag {
+	case filterAnd:
+		for _, child := range children {
+			if !testMatch(child, attrs) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range children {
+			if testMatch(child, attrs) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !testMatch(children[0], attrs)
+	case filterPresent:
+		return len(attrs[strings.ToLower(string(filter.value))]) > 0 ||
+			strings.EqualFold(string(filter.value), "objectClass")
+	case filterEqualityMatch:
+		for _, v := range attrs[strings.ToLower(string(children[0].value))] {
+			if strings.EqualFold(v, string(children[1].value)) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func testResult(tag byte, code int64) []byte {
+	return berConstructed(tag,
+		berInt(tagEnumerated, code),
+		berString(tagOctetString, ""),
+		berString(tagOctetString, ""))
+}
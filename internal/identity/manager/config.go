@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/pomerium/pomerium/internal/events"
+	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
@@ -14,11 +15,16 @@ var (
 
 type config struct {
 	authenticator                 Authenticator
+	authenticators                map[string]Authenticator
 	dataBrokerClient              databroker.DataBrokerServiceClient
 	sessionRefreshGracePeriod     time.Duration
 	sessionRefreshCoolOffDuration time.Duration
 	now                           func() time.Time
 	eventMgr                      *events.Manager
+	sessionLifecycleHooks         []sessions.LifecycleHook
+	directorySyncOptions          map[string]DirectorySyncOptions
+	isIdentityProviderHealthy     func(idpID string) bool
+	downGracePeriods              map[string]time.Duration
 }
 
 func newConfig(options ...Option) *config {
@@ -32,6 +38,20 @@ func newConfig(options ...Option) *config {
 	return cfg
 }
 
+// DirectorySyncOptions configure how often the user information and groups
+// of users are refreshed from an identity provider.
+type DirectorySyncOptions struct {
+	// Interval is the time between refreshes of a user.
+	Interval time.Duration
+	// Jitter is the maximum random amount of time added to the interval, so
+	// that refreshes of users created together are spread out.
+	Jitter time.Duration
+	// ErrorBackoff is the time to wait before retrying after a temporary
+	// error. It doubles with every consecutive error, up to the interval.
+	// If zero, users are retried after the interval.
+	ErrorBackoff time.Duration
+}
+
 // An Option customizes the configuration used for the identity manager.
 type Option func(*config)
 
@@ -42,6 +62,15 @@ func WithAuthenticator(authenticator Authenticator) Option {
 	}
 }
 
+// WithAuthenticators sets the authenticators used for sessions created with
+// the identity provider with the given IDP id. Other sessions use the default
+// authenticator.
+func WithAuthenticators(authenticators map[string]Authenticator) Option {
+	return func(cfg *config) {
+		cfg.authenticators = authenticators
+	}
+}
+
 // WithDataBrokerClient sets the databroker client in the config.
 func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
 	return func(cfg *config) {
@@ -76,3 +105,74 @@ func WithEventManager(mgr *events.Manager) Option {
 		c.eventMgr = mgr
 	}
 }
+
+// WithSessionLifecycleHook adds a hook which receives session lifecycle events.
+func WithSessionLifecycleHook(hook sessions.LifecycleHook) Option {
+	return func(c *config) {
+		c.sessionLifecycleHooks = append(c.sessionLifecycleHooks, hook)
+	}
+}
+
+// WithDirectorySyncOptions sets the directory sync options for users with
+// sessions created with the identity provider with the given IDP id. Options
+// for the empty IDP id apply to every other identity provider.
+func WithDirectorySyncOptions(idpID string, options DirectorySyncOptions) Option {
+	return func(cfg *config) {
+		if cfg.directorySyncOptions == nil {
+			cfg.directorySyncOptions = make(map[string]DirectorySyncOptions)
+		}
+		cfg.directorySyncOptions[idpID] = options
+	}
+}
+
+// WithIdentityProviderHealth sets the function which reports whether the
+// identity provider with the given IDP id is healthy.
+func WithIdentityProviderHealth(isHealthy func(idpID string) bool) Option {
+	return func(cfg *config) {
+		cfg.isIdentityProviderHealthy = isHealthy
+	}
+}
+
+// WithIdentityProviderDownGracePeriod sets how long sessions created with the
+// identity provider with the given IDP id are kept when they fail to refresh
+// while the identity provider is down, instead of being deleted.
+func WithIdentityProviderDownGracePeriod(idpID string, gracePeriod time.Duration) Option {
+	return func(cfg *config) {
+		if cfg.downGracePeriods == nil {
+			cfg.downGracePeriods = make(map[string]time.Duration)
+		}
+		cfg.downGracePeriods[idpID] = gracePeriod
+	}
+}
+
+// getDownGracePeriod returns how long sessions created with the identity
+// provider with the given IDP id are kept when they fail to refresh. It is 0
+// unless the identity provider is down.
+func (cfg *config) getDownGracePeriod(idpID string) time.Duration {
+	if cfg.isIdentityProviderHealthy == nil || cfg.isIdentityProviderHealthy(idpID) {
+		return 0
+	}
+	return cfg.downGracePeriods[idpID]
+}
+
+// getDirectorySyncOptions returns the directory sync options for users with
+// sessions created with the identity provider with the given IDP id.
+func (cfg *config) getDirectorySyncOptions(idpID string) DirectorySyncOptions {
+	options, ok := cfg.directorySyncOptions[idpID]
+	if !ok {
+		options = cfg.directorySyncOptions[""]
+	}
+	if options.Interval <= 0 {
+		options.Interval = userRefreshInterval
+	}
+	return options
+}
+
+// getAuthenticator returns the authenticator for sessions created with the
+// identity provider with the given IDP id.
+func (cfg *config) getAuthenticator(idpID string) Authenticator {
+	if authenticator, ok := cfg.authenticators[idpID]; ok {
+		return authenticator
+	}
+	return cfg.authenticator
+}
@@ -18,11 +18,30 @@ const userRefreshInterval = 10 * time.Minute
 type User struct {
 	*user.User
 	lastRefresh time.Time
+	syncOptions DirectorySyncOptions
+	// jitter is the random amount of time added to the refresh interval.
+	jitter time.Duration
+	// consecutiveErrors is the number of refreshes which failed with a
+	// temporary error since the last successful refresh.
+	consecutiveErrors int
 }
 
 // NextRefresh returns the next time the user information needs to be refreshed.
 func (u User) NextRefresh() time.Time {
-	return u.lastRefresh.Add(userRefreshInterval)
+	interval := u.syncOptions.Interval
+	if interval <= 0 {
+		interval = userRefreshInterval
+	}
+	if u.consecutiveErrors > 0 && u.syncOptions.ErrorBackoff > 0 {
+		backoff := u.syncOptions.ErrorBackoff
+		for i := 1; i < u.consecutiveErrors && backoff < interval; i++ {
+			backoff *= 2
+		}
+		if backoff < interval {
+			return u.lastRefresh.Add(backoff)
+		}
+	}
+	return u.lastRefresh.Add(interval + u.jitter)
 }
 
 // UnmarshalJSON unmarshals json data into the user object.
@@ -59,6 +78,9 @@ type Session struct {
 	gracePeriod time.Duration
 	// coolOffDuration is the amount of time to wait before attempting another refresh.
 	coolOffDuration time.Duration
+	// refreshFailingSince is the time of the first failed refresh while the
+	// identity provider is down.
+	refreshFailingSince time.Time
 }
 
 // NextRefresh returns the next time the session needs to be refreshed.
@@ -258,6 +280,16 @@ func (c *userCollection) Get(userID string) (User, bool) {
 	return item.(userCollectionItem).User, true
 }
 
+// GetUserIDs gets the ids of all the users.
+func (c *userCollection) GetUserIDs() []string {
+	var userIDs []string
+	c.Ascend(func(item btree.Item) bool {
+		userIDs = append(userIDs, item.(userCollectionItem).GetId())
+		return true
+	})
+	return userIDs
+}
+
 func (c *userCollection) ReplaceOrInsert(u User) {
 	c.BTree.ReplaceOrInsert(userCollectionItem{User: u})
 }
@@ -30,6 +30,24 @@ func TestUser_UnmarshalJSON(t *testing.T) {
 	}, u.Claims)
 }
 
+func TestUser_NextRefresh(t *testing.T) {
+	tm := time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+	u := User{lastRefresh: tm}
+	assert.Equal(t, tm.Add(userRefreshInterval), u.NextRefresh())
+
+	u.syncOptions = DirectorySyncOptions{Interval: time.Hour, ErrorBackoff: time.Minute}
+	u.jitter = time.Second
+	assert.Equal(t, tm.Add(time.Hour+time.Second), u.NextRefresh())
+
+	u.consecutiveErrors = 1
+	assert.Equal(t, tm.Add(time.Minute), u.NextRefresh())
+	u.consecutiveErrors = 3
+	assert.Equal(t, tm.Add(4*time.Minute), u.NextRefresh())
+	u.consecutiveErrors = 100
+	assert.Equal(t, tm.Add(time.Hour+time.Second), u.NextRefresh(),
+		"backoff should be limited to the interval")
+}
+
 func TestSession_NextRefresh(t *testing.T) {
 	tm1 := time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
 	s := Session{
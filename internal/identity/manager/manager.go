@@ -4,10 +4,12 @@ package manager
 import (
 	"context"
 	"errors"
+	"math/rand"
 	"time"
 
 	"github.com/google/btree"
 	"github.com/rs/zerolog"
+	"golang.org/x/exp/slices"
 	"golang.org/x/oauth2"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
@@ -19,6 +21,7 @@ import (
 	"github.com/pomerium/pomerium/internal/identity/identity"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/scheduler"
+	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
@@ -49,6 +52,10 @@ type Manager struct {
 
 	sessions sessionCollection
 	users    userCollection
+
+	// synced is true once the records from a full sync have been received,
+	// so that existing sessions aren't reported as created
+	synced bool
 }
 
 // New creates a new identity manager.
@@ -120,6 +127,7 @@ func (mgr *Manager) refreshLoop(ctx context.Context, update <-chan updateRecords
 	case msg := <-update:
 		mgr.onUpdateRecords(ctx, msg)
 	}
+	mgr.synced = true
 
 	log.Info(ctx).
 		Int("sessions", mgr.sessions.Len()).
@@ -141,6 +149,7 @@ func (mgr *Manager) refreshLoop(ctx context.Context, update <-chan updateRecords
 			mgr.reset()
 		case msg := <-update:
 			mgr.onUpdateRecords(ctx, msg)
+			mgr.synced = true
 		case <-timer.C:
 		}
 
@@ -187,22 +196,22 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 		Str("session_id", sessionID).
 		Msg("refreshing session")
 
-	authenticator := mgr.cfg.Load().authenticator
-	if authenticator == nil {
-		log.Info(ctx).
+	s, ok := mgr.sessions.Get(userID, sessionID)
+	if !ok {
+		log.Warn(ctx).
 			Str("user_id", userID).
 			Str("session_id", sessionID).
-			Msg("no authenticator defined, deleting session")
-		mgr.deleteSession(ctx, userID, sessionID)
+			Msg("no session found for refresh")
 		return
 	}
 
-	s, ok := mgr.sessions.Get(userID, sessionID)
-	if !ok {
-		log.Warn(ctx).
+	authenticator := mgr.cfg.Load().getAuthenticator(s.GetIdentityProviderId())
+	if authenticator == nil {
+		log.Info(ctx).
 			Str("user_id", userID).
 			Str("session_id", sessionID).
-			Msg("no session found for refresh")
+			Msg("no authenticator defined, deleting session")
+		mgr.deleteSession(ctx, userID, sessionID)
 		return
 	}
 
@@ -213,6 +222,7 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 			Str("session_id", sessionID).
 			Msg("deleting expired session")
 		mgr.deleteSession(ctx, userID, sessionID)
+		mgr.publishSessionEvent(ctx, sessions.LifecycleEventExpired, userID, sessionID)
 		return
 	}
 
@@ -224,7 +234,27 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 		return
 	}
 
-	newToken, err := authenticator.Refresh(ctx, FromOAuthToken(s.OauthToken), &s)
+	// identity providers may rotate the refresh token on every use, in which
+	// case the newest refresh token is stored separately from the session
+	token := FromOAuthToken(s.OauthToken)
+	var rotation *session.RefreshTokenRotation
+	if token.RefreshToken != "" {
+		var err error
+		rotation, err = mgr.getRefreshTokenRotation(ctx, sessionID)
+		if err != nil {
+			log.Error(ctx).Err(err).
+				Str("user_id", s.GetUserId()).
+				Str("session_id", s.GetId()).
+				Msg("failed to get refresh token rotation")
+			return
+		}
+		if rotation != nil && isRotatedRefreshToken(rotation, token.RefreshToken) {
+			// a stale copy of the session was stored, never reuse its token
+			token.RefreshToken = rotation.GetRefreshToken()
+		}
+	}
+
+	newToken, err := authenticator.Refresh(ctx, token, &s)
 	metrics.RecordIdentityManagerSessionRefresh(ctx, err)
 	mgr.recordLastError(metrics_ids.IdentityManagerLastSessionRefreshError, err)
 	if isTemporaryError(err) {
@@ -233,14 +263,48 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 			Str("session_id", s.GetId()).
 			Msg("failed to refresh oauth2 token")
 		return
+	} else if err != nil && rotation != nil && isInvalidGrantError(err) {
+		// the newest refresh token has never been used by pomerium, so if the
+		// identity provider rejects it someone else used it
+		log.Warn(ctx).Err(err).
+			Str("user_id", s.GetUserId()).
+			Str("session_id", s.GetId()).
+			Msg("refresh token reuse detected, revoking session")
+		if err := authenticator.Revoke(ctx, token); err != nil {
+			log.Warn(ctx).Err(err).
+				Str("user_id", s.GetUserId()).
+				Str("session_id", s.GetId()).
+				Msg("failed to revoke oauth2 token")
+		}
+		mgr.deleteSession(ctx, userID, sessionID)
+		mgr.publishSessionEvent(ctx, sessions.LifecycleEventRevoked, userID, sessionID)
+		return
+	} else if err != nil && mgr.keepSessionWhileIdentityProviderDown(ctx, s, err) {
+		return
 	} else if err != nil {
 		log.Error(ctx).Err(err).
 			Str("user_id", s.GetUserId()).
 			Str("session_id", s.GetId()).
 			Msg("failed to refresh oauth2 token, deleting session")
 		mgr.deleteSession(ctx, userID, sessionID)
+		mgr.publishSessionEvent(ctx, sessions.LifecycleEventRevoked, userID, sessionID)
 		return
 	}
+
+	// persist a rotated refresh token before anything else, as the old
+	// refresh token can't be used anymore
+	if newToken.RefreshToken != "" && newToken.RefreshToken != token.RefreshToken {
+		if rotation == nil {
+			rotation = &session.RefreshTokenRotation{Id: sessionID}
+		}
+		err = mgr.putRefreshTokenRotation(ctx, rotation, token.RefreshToken, newToken.RefreshToken)
+		if err != nil {
+			log.Error(ctx).Err(err).
+				Str("user_id", s.GetUserId()).
+				Str("session_id", s.GetId()).
+				Msg("failed to update refresh token rotation")
+		}
+	}
 	s.OauthToken = ToOAuthToken(newToken)
 
 	err = authenticator.UpdateUserInfo(ctx, FromOAuthToken(s.OauthToken), &s)
@@ -252,12 +316,15 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 			Str("session_id", s.GetId()).
 			Msg("failed to update user info")
 		return
+	} else if err != nil && mgr.keepSessionWhileIdentityProviderDown(ctx, s, err) {
+		return
 	} else if err != nil {
 		log.Error(ctx).Err(err).
 			Str("user_id", s.GetUserId()).
 			Str("session_id", s.GetId()).
 			Msg("failed to update user info, deleting session")
 		mgr.deleteSession(ctx, userID, sessionID)
+		mgr.publishSessionEvent(ctx, sessions.LifecycleEventRevoked, userID, sessionID)
 		return
 	}
 
@@ -270,7 +337,40 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 		return
 	}
 
+	s.refreshFailingSince = time.Time{}
+	mgr.sessions.ReplaceOrInsert(s)
 	mgr.onUpdateSession(ctx, res.GetRecord(), s.Session)
+	mgr.publishSessionEvent(ctx, sessions.LifecycleEventRefreshed, userID, sessionID)
+}
+
+// keepSessionWhileIdentityProviderDown returns true if a session which failed
+// to refresh is kept, because its identity provider is down and the grace
+// period since the first failed refresh hasn't passed. The refresh is retried
+// after the cool-off duration.
+func (mgr *Manager) keepSessionWhileIdentityProviderDown(ctx context.Context, s Session, err error) bool {
+	cfg := mgr.cfg.Load()
+	gracePeriod := cfg.getDownGracePeriod(s.GetIdentityProviderId())
+	if gracePeriod <= 0 {
+		return false
+	}
+
+	now := cfg.now()
+	if s.refreshFailingSince.IsZero() {
+		s.refreshFailingSince = now
+	}
+	if now.Sub(s.refreshFailingSince) >= gracePeriod {
+		return false
+	}
+
+	log.Warn(ctx).Err(err).
+		Str("user_id", s.GetUserId()).
+		Str("session_id", s.GetId()).
+		Time("failing_since", s.refreshFailingSince).
+		Msg("failed to refresh session while the identity provider is down, keeping session")
+	s.lastRefresh = now
+	mgr.sessions.ReplaceOrInsert(s)
+	mgr.sessionScheduler.Add(s.NextRefresh(), toSessionSchedulerKey(s.GetUserId(), s.GetId()))
+	return true
 }
 
 func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
@@ -278,8 +378,8 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 		Str("user_id", userID).
 		Msg("refreshing user")
 
-	authenticator := mgr.cfg.Load().authenticator
-	if authenticator == nil {
+	cfg := mgr.cfg.Load()
+	if cfg.authenticator == nil && len(cfg.authenticators) == 0 {
 		return
 	}
 
@@ -291,6 +391,11 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 		return
 	}
 	u.lastRefresh = time.Now()
+	u.syncOptions = mgr.getUserDirectorySyncOptions(userID)
+	u.jitter = randomJitter(u.syncOptions.Jitter)
+	consecutiveErrors := u.consecutiveErrors
+	u.consecutiveErrors = 0
+	mgr.users.ReplaceOrInsert(u)
 	mgr.userScheduler.Add(u.NextRefresh(), u.GetId())
 
 	for _, s := range mgr.sessions.GetSessionsForUser(userID) {
@@ -301,6 +406,11 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 			continue
 		}
 
+		authenticator := cfg.getAuthenticator(s.GetIdentityProviderId())
+		if authenticator == nil {
+			continue
+		}
+
 		err := authenticator.UpdateUserInfo(ctx, FromOAuthToken(s.OauthToken), &u)
 		metrics.RecordIdentityManagerUserRefresh(ctx, err)
 		mgr.recordLastError(metrics_ids.IdentityManagerLastUserRefreshError, err)
@@ -309,6 +419,9 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 				Str("user_id", s.GetUserId()).
 				Str("session_id", s.GetId()).
 				Msg("failed to update user info")
+			u.consecutiveErrors = consecutiveErrors + 1
+			mgr.users.ReplaceOrInsert(u)
+			mgr.userScheduler.Add(u.NextRefresh(), u.GetId())
 			return
 		} else if err != nil {
 			log.Error(ctx).Err(err).
@@ -351,20 +464,37 @@ func (mgr *Manager) onUpdateRecords(ctx context.Context, msg updateRecordsMessag
 				continue
 			}
 			mgr.onUpdateUser(ctx, record, &pbUser)
+		case grpcutil.GetTypeURL(new(session.DirectorySync)):
+			var pbDirectorySync session.DirectorySync
+			err := record.GetData().UnmarshalTo(&pbDirectorySync)
+			if err != nil {
+				log.Warn(ctx).Msgf("error unmarshaling directory sync: %s", err)
+				continue
+			}
+			mgr.onUpdateDirectorySync(ctx, record, &pbDirectorySync)
 		}
 	}
 }
 
-func (mgr *Manager) onUpdateSession(_ context.Context, record *databroker.Record, session *session.Session) {
+func (mgr *Manager) onUpdateSession(ctx context.Context, record *databroker.Record, session *session.Session) {
 	mgr.sessionScheduler.Remove(toSessionSchedulerKey(session.GetUserId(), session.GetId()))
 
+	// sessions deleted by the manager itself are removed from the collection
+	// beforehand, so only sessions deleted elsewhere are reported as revoked
+	s, exists := mgr.sessions.Get(session.GetUserId(), session.GetId())
+
 	if record.GetDeletedAt() != nil {
 		mgr.sessions.Delete(session.GetUserId(), session.GetId())
+		if exists {
+			mgr.publishSessionEvent(ctx, sessions.LifecycleEventRevoked, session.GetUserId(), session.GetId())
+		}
 		return
 	}
+	if !exists && mgr.synced {
+		mgr.publishSessionEvent(ctx, sessions.LifecycleEventCreated, session.GetUserId(), session.GetId())
+	}
 
 	// update session
-	s, _ := mgr.sessions.Get(session.GetUserId(), session.GetId())
 	s.lastRefresh = time.Now()
 	s.gracePeriod = mgr.cfg.Load().sessionRefreshGracePeriod
 	s.coolOffDuration = mgr.cfg.Load().sessionRefreshCoolOffDuration
@@ -381,13 +511,77 @@ func (mgr *Manager) onUpdateUser(_ context.Context, record *databroker.Record, u
 		return
 	}
 
-	u, _ := mgr.users.Get(user.GetId())
+	u, exists := mgr.users.Get(user.GetId())
 	u.lastRefresh = mgr.cfg.Load().now()
 	u.User = user
+	if !exists {
+		u.syncOptions = mgr.getUserDirectorySyncOptions(user.GetId())
+		u.jitter = randomJitter(u.syncOptions.Jitter)
+	}
 	mgr.users.ReplaceOrInsert(u)
 	mgr.userScheduler.Add(u.NextRefresh(), u.GetId())
 }
 
+// onUpdateDirectorySync schedules an immediate refresh of the users with
+// sessions from the requested identity provider, or of every user if no
+// identity provider was given.
+func (mgr *Manager) onUpdateDirectorySync(ctx context.Context, record *databroker.Record, directorySync *session.DirectorySync) {
+	if record.GetDeletedAt() != nil {
+		return
+	}
+
+	idpID := directorySync.GetId()
+	now := mgr.cfg.Load().now()
+	var userIDs []string
+	for _, userID := range mgr.users.GetUserIDs() {
+		if idpID != "" && slices.IndexFunc(mgr.sessions.GetSessionsForUser(userID), func(s Session) bool {
+			return s.GetIdentityProviderId() == idpID
+		}) < 0 {
+			continue
+		}
+		mgr.userScheduler.Add(now, userID)
+		userIDs = append(userIDs, userID)
+	}
+
+	log.Info(ctx).
+		Str("idp_id", idpID).
+		Int("users", len(userIDs)).
+		Msg("directory sync requested")
+
+	// the request has been handled, so remove it
+	deleted := databroker.NewRecord(directorySync)
+	deleted.DeletedAt = timestamppb.Now()
+	_, err := mgr.cfg.Load().dataBrokerClient.Put(ctx, &databroker.PutRequest{
+		Records: []*databroker.Record{deleted},
+	})
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("idp_id", idpID).
+			Msg("failed to delete directory sync request")
+	}
+}
+
+// getUserDirectorySyncOptions returns the directory sync options of the
+// identity providers of the user's sessions with the shortest interval.
+func (mgr *Manager) getUserDirectorySyncOptions(userID string) DirectorySyncOptions {
+	cfg := mgr.cfg.Load()
+	options := cfg.getDirectorySyncOptions("")
+	for i, s := range mgr.sessions.GetSessionsForUser(userID) {
+		idpOptions := cfg.getDirectorySyncOptions(s.GetIdentityProviderId())
+		if i == 0 || idpOptions.Interval < options.Interval {
+			options = idpOptions
+		}
+	}
+	return options
+}
+
+func randomJitter(maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(maxJitter))) //nolint:gosec
+}
+
 func (mgr *Manager) deleteSession(ctx context.Context, userID, sessionID string) {
 	mgr.sessionScheduler.Remove(toSessionSchedulerKey(userID, sessionID))
 	mgr.sessions.Delete(userID, sessionID)
@@ -408,9 +602,11 @@ func (mgr *Manager) deleteSession(ctx context.Context, userID, sessionID string)
 
 	record := res.GetRecord()
 	record.DeletedAt = timestamppb.Now()
+	rotationRecord := databroker.NewRecord(&session.RefreshTokenRotation{Id: sessionID})
+	rotationRecord.DeletedAt = record.DeletedAt
 
 	_, err = client.Put(ctx, &databroker.PutRequest{
-		Records: []*databroker.Record{record},
+		Records: []*databroker.Record{record, rotationRecord},
 	})
 	if err != nil {
 		log.Error(ctx).Err(err).
@@ -420,8 +616,26 @@ func (mgr *Manager) deleteSession(ctx context.Context, userID, sessionID string)
 	}
 }
 
+func (mgr *Manager) publishSessionEvent(ctx context.Context, typ sessions.LifecycleEventType, userID, sessionID string) {
+	hooks := mgr.cfg.Load().sessionLifecycleHooks
+	if len(hooks) == 0 {
+		return
+	}
+
+	evt := sessions.LifecycleEvent{
+		Type:      typ,
+		SessionID: sessionID,
+		UserID:    userID,
+		Time:      mgr.cfg.Load().now(),
+	}
+	for _, hook := range hooks {
+		hook(ctx, evt)
+	}
+}
+
 // reset resets all the manager datastructures to their initial state
 func (mgr *Manager) reset() {
+	mgr.synced = false
 	mgr.sessions = sessionCollection{BTree: btree.New(8)}
 	mgr.users = userCollection{BTree: btree.New(8)}
 }
@@ -3,19 +3,28 @@ package manager
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
 	"github.com/pomerium/pomerium/internal/events"
 	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker/mock_databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
@@ -38,6 +47,22 @@ func (mock mockAuthenticator) UpdateUserInfo(_ context.Context, _ *oauth2.Token,
 	return errors.New("update user info")
 }
 
+func TestConfig_getAuthenticator(t *testing.T) {
+	type namedAuthenticator struct {
+		mockAuthenticator
+		name string
+	}
+	def := namedAuthenticator{name: "default"}
+	other := namedAuthenticator{name: "other"}
+	cfg := newConfig(
+		WithAuthenticator(def),
+		WithAuthenticators(map[string]Authenticator{"idp2": other}),
+	)
+	assert.Equal(t, other, cfg.getAuthenticator("idp2"))
+	assert.Equal(t, def, cfg.getAuthenticator("idp1"))
+	assert.Equal(t, def, cfg.getAuthenticator(""))
+}
+
 func TestManager_refresh(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
@@ -94,6 +119,164 @@ func TestManager_onUpdateRecords(t *testing.T) {
 	}
 }
 
+func TestManager_directorySync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	now := time.Now()
+
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	mgr := New(
+		WithDataBrokerClient(client),
+		WithDirectorySyncOptions("idp1", DirectorySyncOptions{Interval: time.Hour}),
+		WithNow(func() time.Time {
+			return now
+		}),
+	)
+
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(&session.Session{Id: "session1", UserId: "user1", IdentityProviderId: "idp1"}),
+			mkRecord(&session.Session{Id: "session2", UserId: "user2", IdentityProviderId: "idp2"}),
+			mkRecord(&user.User{Id: "user1"}),
+			mkRecord(&user.User{Id: "user2"}),
+		},
+	})
+
+	u1, _ := mgr.users.Get("user1")
+	assert.Equal(t, now.Add(time.Hour), u1.NextRefresh())
+	u2, _ := mgr.users.Get("user2")
+	assert.Equal(t, now.Add(userRefreshInterval), u2.NextRefresh())
+
+	client.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+			assert.NotNil(t, req.GetRecords()[0].GetDeletedAt(), "directory sync request should be deleted")
+			return &databroker.PutResponse{Records: req.GetRecords()}, nil
+		})
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			databroker.NewRecord(&session.DirectorySync{Id: "idp1"}),
+		},
+	})
+
+	tm, id := mgr.userScheduler.Next()
+	assert.Equal(t, now, tm)
+	assert.Equal(t, "user1", id)
+	mgr.userScheduler.Remove(id)
+	tm, id = mgr.userScheduler.Next()
+	assert.Equal(t, now.Add(userRefreshInterval), tm)
+	assert.Equal(t, "user2", id)
+}
+
+func TestManager_sessionLifecycleEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	var got []sessions.LifecycleEventType
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, status.Error(codes.NotFound, "not found"))
+	mgr := New(
+		WithAuthenticator(mockAuthenticator{}),
+		WithDataBrokerClient(client),
+		WithSessionLifecycleHook(func(_ context.Context, evt sessions.LifecycleEvent) {
+			assert.Equal(t, "user1", evt.UserID)
+			got = append(got, evt.Type)
+		}),
+	)
+
+	// sessions from the initial sync aren't reported as created
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(&session.Session{Id: "session1", UserId: "user1"}),
+		},
+	})
+	mgr.synced = true
+	assert.Empty(t, got)
+
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(&session.Session{Id: "session2", UserId: "user1", ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute))}),
+		},
+	})
+	assert.Equal(t, []sessions.LifecycleEventType{sessions.LifecycleEventCreated}, got)
+
+	mgr.refreshSession(ctx, "user1", "session2")
+	assert.Equal(t, []sessions.LifecycleEventType{
+		sessions.LifecycleEventCreated,
+		sessions.LifecycleEventExpired,
+	}, got)
+
+	deleted := mkRecord(&session.Session{Id: "session1", UserId: "user1"})
+	deleted.DeletedAt = timestamppb.Now()
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{records: []*databroker.Record{deleted}})
+	assert.Equal(t, []sessions.LifecycleEventType{
+		sessions.LifecycleEventCreated,
+		sessions.LifecycleEventExpired,
+		sessions.LifecycleEventRevoked,
+	}, got)
+}
+
+func TestManager_identityProviderDown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	now := time.Now()
+	healthy := false
+	var got []sessions.LifecycleEventType
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	mgr := New(
+		WithAuthenticator(mockAuthenticator{}),
+		WithDataBrokerClient(client),
+		WithNow(func() time.Time { return now }),
+		WithIdentityProviderHealth(func(idpID string) bool {
+			assert.Equal(t, "idp1", idpID)
+			return healthy
+		}),
+		WithIdentityProviderDownGracePeriod("idp1", time.Hour),
+		WithSessionLifecycleHook(func(_ context.Context, evt sessions.LifecycleEvent) {
+			got = append(got, evt.Type)
+		}),
+	)
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(&session.Session{
+				Id:                 "session1",
+				UserId:             "user1",
+				IdentityProviderId: "idp1",
+				OauthToken:         &session.OAuthToken{ExpiresAt: timestamppb.New(now)},
+				ExpiresAt:          timestamppb.New(now.Add(24 * time.Hour)),
+			}),
+		},
+	})
+
+	// sessions which fail to refresh are kept while the identity provider is
+	// down, until the grace period has passed
+	mgr.refreshSession(ctx, "user1", "session1")
+	_, ok := mgr.sessions.Get("user1", "session1")
+	assert.True(t, ok, "should keep the session")
+	tm, _ := mgr.sessionScheduler.Next()
+	assert.Equal(t, now.Add(defaultSessionRefreshCoolOffDuration), tm, "should retry the refresh")
+
+	now = now.Add(30 * time.Minute)
+	mgr.refreshSession(ctx, "user1", "session1")
+	_, ok = mgr.sessions.Get("user1", "session1")
+	assert.True(t, ok, "should keep the session")
+	assert.Empty(t, got)
+
+	now = now.Add(30 * time.Minute)
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.NotFound, "not found"))
+	mgr.refreshSession(ctx, "user1", "session1")
+	_, ok = mgr.sessions.Get("user1", "session1")
+	assert.False(t, ok, "should delete the session after the grace period")
+	assert.Equal(t, []sessions.LifecycleEventType{sessions.LifecycleEventRevoked}, got)
+}
+
 func TestManager_reportErrors(t *testing.T) {
 	ctrl := gomock.NewController(t)
 
@@ -159,6 +342,98 @@ func TestManager_reportErrors(t *testing.T) {
 	expectMsg(metrics_ids.IdentityManagerLastSessionRefreshError, "update session")
 }
 
+func TestManager_refreshTokenRotation(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	li := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(srv, internal_databroker.New())
+	go srv.Serve(li)
+	t.Cleanup(srv.Stop)
+	cc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	client := databroker.NewDataBrokerServiceClient(cc)
+
+	var used, revoked []string
+	var refreshErr error
+	authenticator := funcAuthenticator{
+		refresh: func(_ context.Context, t *oauth2.Token, _ identity.State) (*oauth2.Token, error) {
+			used = append(used, t.RefreshToken)
+			if refreshErr != nil {
+				return nil, refreshErr
+			}
+			return &oauth2.Token{
+				AccessToken:  "ACCESS_TOKEN",
+				RefreshToken: fmt.Sprintf("REFRESH_TOKEN_%d", len(used)+1),
+				Expiry:       time.Now().Add(time.Hour),
+			}, nil
+		},
+		revoke: func(_ context.Context, t *oauth2.Token) error {
+			revoked = append(revoked, t.RefreshToken)
+			return nil
+		},
+	}
+	mgr := New(WithDataBrokerClient(client), WithAuthenticator(authenticator))
+
+	putSession := func(refreshToken string) {
+		s := &session.Session{
+			Id:         "s1",
+			UserId:     "u1",
+			OauthToken: &session.OAuthToken{RefreshToken: refreshToken},
+			ExpiresAt:  timestamppb.New(time.Now().Add(time.Hour)),
+		}
+		res, err := session.Put(ctx, client, s)
+		require.NoError(t, err)
+		mgr.onUpdateRecords(ctx, updateRecordsMessage{records: res.GetRecords()})
+	}
+
+	putSession("REFRESH_TOKEN_1")
+	mgr.refreshSession(ctx, "u1", "s1")
+	assert.Equal(t, []string{"REFRESH_TOKEN_1"}, used)
+	s, err := session.Get(ctx, client, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "REFRESH_TOKEN_2", s.GetOauthToken().GetRefreshToken())
+
+	// a stale copy of the session must not cause the old token to be reused
+	putSession("REFRESH_TOKEN_1")
+	mgr.refreshSession(ctx, "u1", "s1")
+	assert.Equal(t, []string{"REFRESH_TOKEN_1", "REFRESH_TOKEN_2"}, used)
+
+	// the identity provider rejecting the newest token is a sign of theft
+	refreshErr = fmt.Errorf("refresh failed: %w", &oauth2.RetrieveError{
+		Response: &http.Response{StatusCode: http.StatusBadRequest},
+		Body:     []byte(`{"error":"invalid_grant"}`),
+	})
+	mgr.refreshSession(ctx, "u1", "s1")
+	assert.Equal(t, []string{"REFRESH_TOKEN_3"}, revoked)
+	_, err = session.Get(ctx, client, "s1")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	rotation, err := mgr.getRefreshTokenRotation(ctx, "s1")
+	assert.NoError(t, err)
+	assert.Nil(t, rotation)
+}
+
+type funcAuthenticator struct {
+	refresh func(context.Context, *oauth2.Token, identity.State) (*oauth2.Token, error)
+	revoke  func(context.Context, *oauth2.Token) error
+}
+
+func (f funcAuthenticator) Refresh(ctx context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	return f.refresh(ctx, t, v)
+}
+
+func (f funcAuthenticator) Revoke(ctx context.Context, t *oauth2.Token) error {
+	return f.revoke(ctx, t)
+}
+
+func (f funcAuthenticator) UpdateUserInfo(_ context.Context, _ *oauth2.Token, _ any) error {
+	return nil
+}
+
 func mkRecord(msg recordable) *databroker.Record {
 	any := protoutil.NewAny(msg)
 	return &databroker.Record{
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// maxRotatedRefreshTokens is the number of replaced refresh tokens which are
+// remembered for each session.
+const maxRotatedRefreshTokens = 16
+
+func (mgr *Manager) getRefreshTokenRotation(ctx context.Context, sessionID string) (*session.RefreshTokenRotation, error) {
+	rotation := &session.RefreshTokenRotation{Id: sessionID}
+	err := databroker.Get(ctx, mgr.cfg.Load().dataBrokerClient, rotation)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// putRefreshTokenRotation stores the newest refresh token of a session, which
+// replaces the old refresh token.
+func (mgr *Manager) putRefreshTokenRotation(
+	ctx context.Context,
+	rotation *session.RefreshTokenRotation,
+	oldRefreshToken, newRefreshToken string,
+) error {
+	rotation.RotatedRefreshTokenHashes = append(rotation.RotatedRefreshTokenHashes, hashRefreshToken(oldRefreshToken))
+	if n := len(rotation.RotatedRefreshTokenHashes); n > maxRotatedRefreshTokens {
+		rotation.RotatedRefreshTokenHashes = rotation.RotatedRefreshTokenHashes[n-maxRotatedRefreshTokens:]
+	}
+	rotation.RefreshToken = newRefreshToken
+	_, err := databroker.Put(ctx, mgr.cfg.Load().dataBrokerClient, rotation)
+	return err
+}
+
+// isRotatedRefreshToken returns true if the refresh token has been replaced
+// by a newer refresh token.
+func isRotatedRefreshToken(rotation *session.RefreshTokenRotation, refreshToken string) bool {
+	h := hashRefreshToken(refreshToken)
+	return slices.IndexFunc(rotation.GetRotatedRefreshTokenHashes(), func(rotated []byte) bool {
+		return bytes.Equal(rotated, h)
+	}) >= 0
+}
+
+func hashRefreshToken(refreshToken string) []byte {
+	return cryptutil.Hash("refresh token", []byte(refreshToken))
+}
+
+// isInvalidGrantError returns true if the identity provider rejected the
+// refresh token.
+//
+// https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+func isInvalidGrantError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return false
+	}
+
+	var res struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(retrieveErr.Body, &res) == nil {
+		return res.Error == "invalid_grant"
+	}
+	// some identity providers respond with form encoded errors
+	values, _ := url.ParseQuery(string(retrieveErr.Body))
+	return values.Get("error") == "invalid_grant"
+}
@@ -5,16 +5,24 @@ package apple
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/exp/maps"
 	"golang.org/x/oauth2"
 
+	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
 
 	"github.com/pomerium/pomerium/internal/httputil"
@@ -34,6 +42,11 @@ const (
 	authURL            = "/auth/authorize"
 	refreshDeadline    = time.Minute * 60
 	revocationURL      = "/auth/revoke"
+
+	// client secrets are valid for up to six months, but are regenerated
+	// well before they expire
+	clientSecretExpiry  = time.Hour * 24
+	clientSecretRenewal = time.Hour
 )
 
 var (
@@ -47,6 +60,17 @@ var (
 type Provider struct {
 	oauth           *oauth2.Config
 	authCodeOptions map[string]string
+	audience        string
+	revocationURL   string
+
+	// the client secret is generated from the private key, if any
+	teamID     string
+	keyID      string
+	privateKey *ecdsa.PrivateKey
+
+	mu                 sync.Mutex
+	clientSecret       string
+	clientSecretExpiry time.Time
 }
 
 // New instantiates an OpenID Connect (OIDC) provider for Apple.
@@ -59,7 +83,23 @@ func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
 		options.Scopes = defaultScopes
 	}
 
-	p := Provider{}
+	p := Provider{
+		audience:      options.ProviderURL,
+		revocationURL: urlutil.Join(options.ProviderURL, revocationURL),
+		teamID:        options.AppleTeamID,
+		keyID:         options.AppleKeyID,
+	}
+	if options.AppleTeamID != "" {
+		var err error
+		p.privateKey, err = loadPrivateKey(&options)
+		if err != nil {
+			return nil, err
+		}
+		if options.AppleKeyID == "" {
+			return nil, fmt.Errorf("identity/apple: key id is required to generate the client secret")
+		}
+	}
+
 	p.authCodeOptions = make(map[string]string)
 	maps.Copy(p.authCodeOptions, defaultAuthCodeOptions)
 	maps.Copy(p.authCodeOptions, options.AuthCodeOptions)
@@ -93,8 +133,7 @@ func (p *Provider) Name() string {
 // always provide a non-empty string and validate that it matches the
 // the state query parameter on your redirect callback.
 // See http://tools.ietf.org/html/rfc6749#section-10.12 for more info.
-func (p *Provider) GetSignInURL(state string) (string, error) {
-	opts := []oauth2.AuthCodeOption{}
+func (p *Provider) GetSignInURL(state string, opts ...oauth2.AuthCodeOption) (string, error) {
 	for k, v := range p.authCodeOptions {
 		opts = append(opts, oauth2.SetAuthURLParam(k, v))
 	}
@@ -108,8 +147,13 @@ func (p *Provider) GetSignInURL(state string) (string, error) {
 
 // Authenticate converts an authorization code returned from the identity
 // provider into a token which is then converted into a user session.
-func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State) (*oauth2.Token, error) {
-	oauth2Token, err := p.oauth.Exchange(ctx, code)
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	oa, err := p.getOauthConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	oauth2Token, err := oa.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("identity/apple: token exchange failed: %w", err)
 	}
@@ -140,7 +184,12 @@ func (p *Provider) Refresh(ctx context.Context, t *oauth2.Token, v identity.Stat
 		return nil, oidc.ErrMissingRefreshToken
 	}
 
-	newToken, err := p.oauth.TokenSource(ctx, t).Token()
+	oa, err := p.getOauthConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	newToken, err := oa.TokenSource(ctx, t).Token()
 	if err != nil {
 		return nil, fmt.Errorf("identity/apple: refresh failed: %w", err)
 	}
@@ -163,13 +212,18 @@ func (p *Provider) Revoke(ctx context.Context, t *oauth2.Token) error {
 		return oidc.ErrMissingAccessToken
 	}
 
+	oa, err := p.getOauthConfig()
+	if err != nil {
+		return err
+	}
+
 	params := url.Values{}
 	params.Add("token", t.AccessToken)
 	params.Add("token_type_hint", "access_token")
-	params.Add("client_id", p.oauth.ClientID)
-	params.Add("client_secret", p.oauth.ClientSecret)
+	params.Add("client_id", oa.ClientID)
+	params.Add("client_secret", oa.ClientSecret)
 
-	err := httputil.Do(ctx, http.MethodPost, revocationURL, version.UserAgent(), nil, params, nil)
+	err = httputil.Do(ctx, http.MethodPost, p.revocationURL, version.UserAgent(), nil, params, nil)
 	if err != nil && errors.Is(err, httputil.ErrTokenRevoked) {
 		return fmt.Errorf("identity/apple: unexpected revoke error: %w", err)
 	}
@@ -191,3 +245,130 @@ func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interf
 
 	return idToken.UnsafeClaimsWithoutVerification(v)
 }
+
+// getOauthConfig returns the oauth config with a client secret generated
+// from the private key, if any.
+func (p *Provider) getOauthConfig() (*oauth2.Config, error) {
+	if p.privateKey == nil {
+		return p.oauth, nil
+	}
+
+	clientSecret, err := p.getClientSecret(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	oa := *p.oauth
+	oa.ClientSecret = clientSecret
+	return &oa, nil
+}
+
+// getClientSecret returns the client secret JWT, signed with the private key.
+//
+// https://developer.apple.com/documentation/accountorganizationaldatasharing/creating-a-client-secret
+func (p *Provider) getClientSecret(now time.Time) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.clientSecret != "" && now.Add(clientSecretRenewal).Before(p.clientSecretExpiry) {
+		return p.clientSecret, nil
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: p.privateKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", p.keyID),
+	)
+	if err != nil {
+		return "", fmt.Errorf("identity/apple: error creating client secret signer: %w", err)
+	}
+
+	expiry := now.Add(clientSecretExpiry)
+	clientSecret, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:   p.teamID,
+		Subject:  p.oauth.ClientID,
+		Audience: jwt.Audience{p.audience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(expiry),
+	}).CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("identity/apple: error signing client secret: %w", err)
+	}
+
+	p.clientSecret, p.clientSecretExpiry = clientSecret, expiry
+	return clientSecret, nil
+}
+
+func loadPrivateKey(o *oauth.Options) (*ecdsa.PrivateKey, error) {
+	var raw []byte
+	switch {
+	case o.ApplePrivateKey != "":
+		var err error
+		raw, err = base64.StdEncoding.DecodeString(o.ApplePrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("identity/apple: invalid base64 private key: %w", err)
+		}
+	case o.ApplePrivateKeyFile != "":
+		var err error
+		raw, err = os.ReadFile(o.ApplePrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("identity/apple: error reading private key file: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("identity/apple: private key is required to generate the client secret")
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("identity/apple: private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("identity/apple: invalid private key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("identity/apple: private key is not an ECDSA key")
+	}
+	return ecKey, nil
+}
+
+// User is the user Apple posts to the callback, along with the authorization
+// code, only the first time a user signs in.
+//
+// https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_js/incorporating_sign_in_with_apple_into_other_platforms
+type User struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// ParseUser parses the user form value posted to the callback.
+func ParseUser(rawUser string) (*User, error) {
+	var u User
+	if err := json.Unmarshal([]byte(rawUser), &u); err != nil {
+		return nil, fmt.Errorf("identity/apple: invalid user: %w", err)
+	}
+	return &u, nil
+}
+
+// Claims returns the user's name and email as OpenID Connect claims. The
+// id token never has the name, so the first sign in is the only chance to
+// capture it.
+func (u *User) Claims() map[string]any {
+	claims := make(map[string]any)
+	if u.Name.FirstName != "" {
+		claims["given_name"] = u.Name.FirstName
+	}
+	if u.Name.LastName != "" {
+		claims["family_name"] = u.Name.LastName
+	}
+	if name := strings.TrimSpace(u.Name.FirstName + " " + u.Name.LastName); name != "" {
+		claims["name"] = name
+	}
+	if u.Email != "" {
+		claims["email"] = u.Email
+	}
+	return claims
+}
@@ -0,0 +1,130 @@
+package apple
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func newPrivateKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	raw := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return key, base64.StdEncoding.EncodeToString(raw)
+}
+
+type testState struct{}
+
+func (testState) SetRawIDToken(string) {}
+
+func TestProvider_clientSecret(t *testing.T) {
+	t.Parallel()
+
+	key, encodedKey := newPrivateKey(t)
+
+	var clientSecret string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		clientSecret = r.PostForm.Get("client_secret")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "ACCESS_TOKEN",
+			"token_type":   "Bearer",
+		})
+	}))
+	defer srv.Close()
+
+	p, err := New(context.Background(), &oauth.Options{
+		ProviderURL:     srv.URL,
+		ClientID:        "com.example.service",
+		RedirectURL:     &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+		AppleTeamID:     "TEAM_ID",
+		AppleKeyID:      "KEY_ID",
+		ApplePrivateKey: encodedKey,
+	})
+	require.NoError(t, err)
+
+	_, err = p.Authenticate(context.Background(), "CODE", new(testState))
+	require.NoError(t, err)
+
+	tok, err := jwt.ParseSigned(clientSecret)
+	require.NoError(t, err)
+	require.Len(t, tok.Headers, 1)
+	assert.Equal(t, "KEY_ID", tok.Headers[0].KeyID)
+	assert.Equal(t, "ES256", tok.Headers[0].Algorithm)
+
+	var secretClaims jwt.Claims
+	require.NoError(t, tok.Claims(&key.PublicKey, &secretClaims))
+	assert.Equal(t, "TEAM_ID", secretClaims.Issuer)
+	assert.Equal(t, "com.example.service", secretClaims.Subject)
+	assert.Equal(t, jwt.Audience{srv.URL}, secretClaims.Audience)
+	assert.NoError(t, secretClaims.Validate(jwt.Expected{Time: time.Now()}))
+
+	t.Run("cached", func(t *testing.T) {
+		now := time.Now()
+		s1, err := p.getClientSecret(now)
+		require.NoError(t, err)
+		s2, err := p.getClientSecret(now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, s1, s2)
+		s3, err := p.getClientSecret(now.Add(clientSecretExpiry))
+		require.NoError(t, err)
+		assert.NotEqual(t, s1, s3)
+	})
+}
+
+func TestNew_invalidPrivateKey(t *testing.T) {
+	t.Parallel()
+
+	_, encodedKey := newPrivateKey(t)
+	for _, o := range []*oauth.Options{
+		{AppleTeamID: "TEAM_ID", AppleKeyID: "KEY_ID"},
+		{AppleTeamID: "TEAM_ID", AppleKeyID: "KEY_ID", ApplePrivateKey: "not base64"},
+		{AppleTeamID: "TEAM_ID", AppleKeyID: "KEY_ID", ApplePrivateKey: base64.StdEncoding.EncodeToString([]byte("not pem"))},
+		{AppleTeamID: "TEAM_ID", ApplePrivateKey: encodedKey},
+	} {
+		o.RedirectURL = &url.URL{}
+		_, err := New(context.Background(), o)
+		assert.Error(t, err)
+	}
+}
+
+func TestUser_Claims(t *testing.T) {
+	t.Parallel()
+
+	u, err := ParseUser(`{"name":{"firstName":"Jane","lastName":"Doe"},"email":"jane@example.com"}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"given_name":  "Jane",
+		"family_name": "Doe",
+		"name":        "Jane Doe",
+		"email":       "jane@example.com",
+	}, u.Claims())
+
+	u, err = ParseUser(`{"email":"jane@example.com"}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"email": "jane@example.com"}, u.Claims())
+
+	_, err = ParseUser(`not json`)
+	assert.Error(t, err)
+}
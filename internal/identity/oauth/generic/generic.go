@@ -0,0 +1,243 @@
+// Package generic implements OAuth2 based authentication for identity
+// providers which do not implement OpenID Connect discovery. Claims are
+// retrieved from a user info endpoint and selected with JSONPath expressions.
+package generic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+// Name identifies the generic OAuth2 identity provider.
+const Name = "oauth2"
+
+// access tokens without an expiry are re-validated against the user info
+// endpoint at this interval
+const refreshDeadline = time.Minute * 60
+
+// claims which must be strings for pomerium sessions
+var stringClaims = []string{"sub", "user", "email", "name"}
+
+// Provider is a generic OAuth2 implementation of the Authenticator interface.
+type Provider struct {
+	oauth           *oauth2.Config
+	authCodeOptions map[string]string
+
+	providerURL string
+	userInfoURL *template.Template
+	claimPaths  map[string]*jsonPath
+}
+
+// New instantiates a generic OAuth2 provider. The authorization, token and
+// user info endpoints are required, and may be relative to the provider URL.
+//
+// The user info URL is a template executed with the OAuth2 token, so values
+// from the token response can be used, e.g. {{.Extra "user_id" | urlquery}}.
+func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
+	if o.AuthURL == "" || o.TokenURL == "" || o.UserInfoURL == "" {
+		return nil, errors.New("oauth2: authorization, token and user info urls are required")
+	}
+
+	p := &Provider{
+		authCodeOptions: o.AuthCodeOptions,
+		providerURL:     o.ProviderURL,
+		claimPaths:      make(map[string]*jsonPath, len(o.ClaimPaths)),
+	}
+
+	var err error
+	p.userInfoURL, err = template.New("userinfo").Option("missingkey=error").Parse(o.UserInfoURL)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: invalid user info url template: %w", err)
+	}
+	for claim, expr := range o.ClaimPaths {
+		p.claimPaths[claim], err = compileJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		Scopes:       o.Scopes,
+		RedirectURL:  o.RedirectURL.String(),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.resolve(o.AuthURL),
+			TokenURL: p.resolve(o.TokenURL),
+		},
+	}
+	return p, nil
+}
+
+// Authenticate exchanges the authorization code for an access token and
+// retrieves the user's claims from the user info endpoint.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	t, err := p.oauth.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: token exchange failed: %w", err)
+	}
+	if t.Expiry.IsZero() {
+		t.Expiry = time.Now().Add(refreshDeadline)
+	}
+
+	err = p.UpdateUserInfo(ctx, t, v)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Refresh renews the access token with the refresh token, if there is one.
+// Otherwise the access token is validated against the user info endpoint
+// and its expiry extended.
+func (p *Provider) Refresh(ctx context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	if t == nil {
+		return nil, oidc.ErrMissingAccessToken
+	}
+
+	if t.RefreshToken == "" {
+		if err := p.UpdateUserInfo(ctx, t, v); err != nil {
+			return nil, err
+		}
+		t.Expiry = time.Now().Add(refreshDeadline)
+		return t, nil
+	}
+
+	newToken, err := p.oauth.TokenSource(ctx, t).Token()
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: refresh failed: %w", err)
+	}
+	if newToken.Expiry.IsZero() {
+		newToken.Expiry = time.Now().Add(refreshDeadline)
+	}
+	return newToken, nil
+}
+
+// UpdateUserInfo retrieves the user info response and fills v with the
+// claims. The top level fields of the response are claims, and the
+// configured claim paths add or override claims.
+func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error {
+	endpoint, err := p.getUserInfoURL(t)
+	if err != nil {
+		return err
+	}
+
+	var raw json.RawMessage
+	headers := map[string]string{
+		"Authorization": "Bearer " + t.AccessToken,
+		"Accept":        "application/json",
+	}
+	err = httputil.Do(ctx, http.MethodGet, endpoint, version.UserAgent(), headers, nil, &raw)
+	if err != nil {
+		return fmt.Errorf("oauth2: could not retrieve user info: %w", err)
+	}
+
+	var response interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&response); err != nil {
+		return fmt.Errorf("oauth2: invalid user info response: %w", err)
+	}
+
+	claims := make(map[string]interface{})
+	if m, ok := response.(map[string]interface{}); ok {
+		for k, v := range m {
+			claims[k] = v
+		}
+	}
+	for claim, path := range p.claimPaths {
+		value, err := path.eval(response)
+		if errors.Is(err, errNoMatch) {
+			delete(claims, claim)
+			continue
+		} else if err != nil {
+			return err
+		}
+		claims[claim] = value
+	}
+	for _, claim := range stringClaims {
+		if n, ok := claims[claim].(json.Number); ok {
+			claims[claim] = n.String()
+		}
+	}
+	if s, _ := claims["sub"].(string); s == "" {
+		return errors.New("oauth2: user info has no subject")
+	}
+	if _, ok := claims["user"]; !ok {
+		claims["user"] = claims["sub"]
+	}
+
+	claims["iat"] = jwt.NewNumericDate(time.Now())
+	claims["nbf"] = jwt.NewNumericDate(time.Now())
+	claims["exp"] = jwt.NewNumericDate(t.Expiry)
+
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (p *Provider) getUserInfoURL(t *oauth2.Token) (string, error) {
+	var buf bytes.Buffer
+	if err := p.userInfoURL.Execute(&buf, t); err != nil {
+		return "", fmt.Errorf("oauth2: invalid user info url template: %w", err)
+	}
+	endpoint := buf.String()
+	if strings.Contains(endpoint, "<no value>") {
+		return "", errors.New("oauth2: user info url template references a missing token value")
+	}
+	return p.resolve(endpoint), nil
+}
+
+// resolve returns the endpoint relative to the provider URL, unless it is an
+// absolute URL.
+func (p *Provider) resolve(endpoint string) string {
+	if u, err := url.Parse(endpoint); p.providerURL == "" || (err == nil && u.IsAbs()) {
+		return endpoint
+	}
+	return urlutil.Join(p.providerURL, endpoint)
+}
+
+// Revoke is not implemented by generic OAuth2 providers.
+func (p *Provider) Revoke(ctx context.Context, t *oauth2.Token) error {
+	return oidc.ErrRevokeNotImplemented
+}
+
+// GetSignInURL returns a URL to OAuth 2.0 provider's consent page
+// that asks for permissions for the required scopes explicitly.
+func (p *Provider) GetSignInURL(state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	opts = append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)
+	for k, v := range p.authCodeOptions {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return p.oauth.AuthCodeURL(state, opts...), nil
+}
+
+// LogOut is not implemented by generic OAuth2 providers.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
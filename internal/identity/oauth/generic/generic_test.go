@@ -0,0 +1,190 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func TestJSONPath(t *testing.T) {
+	t.Parallel()
+
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": 1,
+		"user": {"login": "alice", "first.last": "Alice Smith"},
+		"teams": [{"name": "admins"}, {"name": "devs"}, {"id": 3}],
+		"tags": {"b": "2", "a": "1"}
+	}`), &doc))
+
+	for _, tc := range []struct {
+		expr   string
+		expect interface{}
+	}{
+		{"$", doc},
+		{"$.id", float64(1)},
+		{"$.user.login", "alice"},
+		{"$.user['first.last']", "Alice Smith"},
+		{`$["user"]["login"]`, "alice"},
+		{"$.teams[0].name", "admins"},
+		{"$.teams[-2].name", "devs"},
+		{"$.teams[*].name", []interface{}{"admins", "devs"}},
+		{"$.tags.*", []interface{}{"1", "2"}},
+		{"$.missing[*]", []interface{}{}},
+	} {
+		p, err := compileJSONPath(tc.expr)
+		require.NoError(t, err, tc.expr)
+		actual, err := p.eval(doc)
+		assert.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expect, actual, tc.expr)
+	}
+
+	for _, expr := range []string{"$.missing", "$.teams[5]", "$.user[0]", "$.teams.name"} {
+		p, err := compileJSONPath(expr)
+		require.NoError(t, err, expr)
+		_, err = p.eval(doc)
+		assert.ErrorIs(t, err, errNoMatch, expr)
+	}
+
+	for _, expr := range []string{"", "user.login", "$..login", "$.", "$[0", "$[abc]", "$user"} {
+		_, err := compileJSONPath(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	var refreshed bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			if r.PostForm.Get("code") != "CODE" {
+				http.Error(w, "invalid code", http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "ACCESS",
+				"token_type":   "bearer",
+				"user_id":      "12345678901234567",
+			})
+		case "refresh_token":
+			refreshed = true
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "ACCESS",
+				"refresh_token": "REFRESH",
+				"token_type":    "bearer",
+				"expires_in":    300,
+			})
+		}
+	})
+	mux.HandleFunc("/api/users/12345678901234567", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ACCESS" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"id": 12345678901234567,
+			"username": "alice",
+			"name": "Alice",
+			"exp": 1,
+			"contact": {"emails": [{"address": "alice@example.com", "primary": true}]},
+			"teams": [{"name": "admins"}, {"name": "devs"}]
+		}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	p, err := New(ctx, &oauth.Options{
+		ProviderURL:     srv.URL,
+		ClientID:        "CLIENT_ID",
+		ClientSecret:    "CLIENT_SECRET",
+		RedirectURL:     &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+		Scopes:          []string{"read_user"},
+		AuthCodeOptions: map[string]string{"prompt": "consent"},
+		AuthURL:         "https://auth.example.com/authorize",
+		TokenURL:        "/oauth/token",
+		UserInfoURL:     `/api/users/{{.Extra "user_id" | urlquery}}`,
+		ClaimPaths: map[string]string{
+			"sub":    "$.id",
+			"user":   "$.username",
+			"email":  "$.contact.emails[0].address",
+			"groups": "$.teams[*].name",
+			"team":   "$.team.name",
+		},
+	})
+	require.NoError(t, err)
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	u, err := url.Parse(signInURL)
+	require.NoError(t, err)
+	assert.Equal(t, "auth.example.com", u.Host)
+	assert.Equal(t, "STATE", u.Query().Get("state"))
+	assert.Equal(t, "consent", u.Query().Get("prompt"))
+	assert.Equal(t, "read_user", u.Query().Get("scope"))
+
+	var claims map[string]interface{}
+	token, err := p.Authenticate(ctx, "CODE", (*testClaims)(&claims))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(refreshDeadline), token.Expiry, time.Minute)
+	assert.Equal(t, "12345678901234567", claims["sub"])
+	assert.Equal(t, "alice", claims["user"])
+	assert.Equal(t, "Alice", claims["name"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.Equal(t, []interface{}{"admins", "devs"}, claims["groups"])
+	assert.Equal(t, float64(token.Expiry.Unix()), claims["exp"])
+	assert.NotContains(t, claims, "team")
+
+	_, err = p.Authenticate(ctx, "INVALID", (*testClaims)(&claims))
+	assert.Error(t, err)
+
+	t.Run("refresh without refresh token", func(t *testing.T) {
+		token := &oauth2.Token{AccessToken: "ACCESS", Expiry: time.Now().Add(-time.Minute)}
+		token = token.WithExtra(map[string]interface{}{"user_id": "12345678901234567"})
+		token, err := p.Refresh(ctx, token, (*testClaims)(&claims))
+		require.NoError(t, err)
+		assert.True(t, token.Expiry.After(time.Now()))
+
+		token = &oauth2.Token{AccessToken: "REVOKED"}
+		token = token.WithExtra(map[string]interface{}{"user_id": "12345678901234567"})
+		_, err = p.Refresh(ctx, token, (*testClaims)(&claims))
+		assert.Error(t, err)
+
+		_, err = p.Refresh(ctx, &oauth2.Token{AccessToken: "ACCESS"}, (*testClaims)(&claims))
+		assert.Error(t, err, "should fail when the user info url template references a missing value")
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		token := &oauth2.Token{AccessToken: "EXPIRED", RefreshToken: "REFRESH", Expiry: time.Now().Add(-time.Minute)}
+		token, err := p.Refresh(ctx, token, (*testClaims)(&claims))
+		require.NoError(t, err)
+		assert.True(t, refreshed)
+		assert.Equal(t, "ACCESS", token.AccessToken)
+	})
+
+	_, err = New(ctx, &oauth.Options{RedirectURL: &url.URL{}, AuthURL: "/authorize", TokenURL: "/token"})
+	assert.Error(t, err, "should require a user info url")
+	_, err = New(ctx, &oauth.Options{RedirectURL: &url.URL{}, AuthURL: "/authorize", TokenURL: "/token", UserInfoURL: "/user",
+		ClaimPaths: map[string]string{"sub": "id"}})
+	assert.Error(t, err, "should reject invalid claim paths")
+}
+
+type testClaims map[string]interface{}
+
+func (c *testClaims) SetRawIDToken(string) {}
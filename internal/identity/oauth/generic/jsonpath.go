@@ -0,0 +1,134 @@
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// jsonPath is a compiled JSONPath expression. The supported subset is the
+// root ($), child members (.name, ['name']), array indices ([0], [-1]) and
+// wildcards (.*, [*]).
+//
+// https://datatracker.ietf.org/doc/html/rfc9535
+type jsonPath struct {
+	segments []pathSegment
+	multi    bool // the path contains a wildcard
+}
+
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func compileJSONPath(expr string) (*jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("oauth2: invalid json path %q: must start with $", expr)
+	}
+	s = s[1:]
+
+	p := new(jsonPath)
+	for s != "" {
+		var seg pathSegment
+		switch {
+		case strings.HasPrefix(s, ".."):
+			return nil, fmt.Errorf("oauth2: invalid json path %q: recursive descent is not supported", expr)
+		case s[0] == '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("oauth2: invalid json path %q: empty member name", expr)
+			}
+			if s[:end] == "*" {
+				seg.wildcard = true
+			} else {
+				seg.key = s[:end]
+			}
+			s = s[end:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("oauth2: invalid json path %q: unterminated selector", expr)
+			}
+			selector := strings.TrimSpace(s[1:end])
+			switch {
+			case selector == "*":
+				seg.wildcard = true
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				seg.key = selector[1 : len(selector)-1]
+			default:
+				i, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("oauth2: invalid json path %q: invalid selector %q", expr, selector)
+				}
+				seg.index, seg.isIndex = i, true
+			}
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("oauth2: invalid json path %q: unexpected %q", expr, s[0])
+		}
+		p.multi = p.multi || seg.wildcard
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+var errNoMatch = errors.New("oauth2: json path did not match")
+
+// eval evaluates the path against a decoded JSON value. A path with a
+// wildcard returns a list of the matched values, otherwise the single
+// matched value is returned.
+func (p *jsonPath) eval(v interface{}) (interface{}, error) {
+	values := []interface{}{v}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if seg.wildcard {
+					keys := maps.Keys(v)
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, v[k])
+					}
+				} else if c, ok := v[seg.key]; ok && !seg.isIndex {
+					next = append(next, c)
+				}
+			case []interface{}:
+				if seg.wildcard {
+					next = append(next, v...)
+				} else if seg.isIndex {
+					i := seg.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+
+	if p.multi {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, errNoMatch
+	}
+	return values[0], nil
+}
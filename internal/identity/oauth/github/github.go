@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +36,8 @@ const (
 	userPath           = "/user"
 	revokePath         = "/applications/%s/grant"
 	emailPath          = "/user/emails"
+	orgsPath           = "/user/orgs"
+	teamsPath          = "/user/teams"
 	// https://developer.github.com/apps/building-oauth-apps/authorizing-oauth-apps
 	authURL  = "/login/oauth/authorize"
 	tokenURL = "/login/oauth/access_token"
@@ -44,6 +48,9 @@ const (
 
 var maxTime = time.Unix(253370793661, 0) // year 9999
 
+// pageSize is the maximum number of items github returns per page.
+const pageSize = 100
+
 // https://developer.github.com/apps/building-oauth-apps/understanding-scopes-for-oauth-apps/
 var defaultScopes = []string{"user:email", "read:org"}
 
@@ -51,8 +58,11 @@ var defaultScopes = []string{"user:email", "read:org"}
 type Provider struct {
 	Oauth *oauth2.Config
 
+	apiURL        string
 	userEndpoint  string
 	emailEndpoint string
+	orgsEndpoint  string
+	teamsEndpoint string
 }
 
 // New instantiates an OAuth2 provider for Github.
@@ -62,14 +72,21 @@ func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
 		o.ProviderURL = defaultProviderURL
 	}
 
-	// when the default provider url is used, use the Github API endpoint
-	if o.ProviderURL == defaultProviderURL {
-		p.userEndpoint = urlutil.Join(githubAPIURL, userPath)
-		p.emailEndpoint = urlutil.Join(githubAPIURL, emailPath)
-	} else {
-		p.userEndpoint = urlutil.Join(o.ProviderURL, userPath)
-		p.emailEndpoint = urlutil.Join(o.ProviderURL, emailPath)
+	// when the default provider url is used, use the Github API endpoint.
+	// GitHub Enterprise Server serves its API at /api/v3, which is set as the
+	// API url.
+	switch {
+	case o.APIURL != "":
+		p.apiURL = o.APIURL
+	case o.ProviderURL == defaultProviderURL:
+		p.apiURL = githubAPIURL
+	default:
+		p.apiURL = o.ProviderURL
 	}
+	p.userEndpoint = urlutil.Join(p.apiURL, userPath)
+	p.emailEndpoint = urlutil.Join(p.apiURL, emailPath)
+	p.orgsEndpoint = urlutil.Join(p.apiURL, orgsPath)
+	p.teamsEndpoint = urlutil.Join(p.apiURL, teamsPath)
 
 	if len(o.Scopes) == 0 {
 		o.Scopes = defaultScopes
@@ -89,8 +106,8 @@ func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
 
 // Authenticate creates an identity session with github from a authorization code, and follows up
 // call to the user and user group endpoint with the
-func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State) (*oauth2.Token, error) {
-	oauth2Token, err := p.Oauth.Exchange(ctx, code)
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	oauth2Token, err := p.Oauth.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("github: token exchange failed %v", err)
 	}
@@ -120,6 +137,11 @@ func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interf
 		return fmt.Errorf("github: could not retrieve user email %w", err)
 	}
 
+	err = p.userGroups(ctx, t, v)
+	if err != nil {
+		return fmt.Errorf("github: could not retrieve user groups %w", err)
+	}
+
 	return nil
 }
 
@@ -209,6 +231,79 @@ func (p *Provider) userInfo(ctx context.Context, t *oauth2.Token, v interface{})
 	return json.Unmarshal(b, v)
 }
 
+// userGroups sets the groups claim of the user to the logins of the user's
+// organizations and the org/team slugs of the user's teams, e.g.
+// "pomerium/admins". Both require the read:org scope.
+//
+// https://docs.github.com/en/rest/orgs/orgs#list-organizations-for-the-authenticated-user
+// https://docs.github.com/en/rest/teams/teams#list-teams-for-the-authenticated-user
+func (p *Provider) userGroups(ctx context.Context, t *oauth2.Token, v interface{}) error {
+	type organization struct {
+		Login string `json:"login"`
+	}
+	orgs, err := getAllPages[organization](ctx, t, p.orgsEndpoint)
+	if err != nil {
+		return err
+	}
+	type team struct {
+		Slug         string       `json:"slug"`
+		Organization organization `json:"organization"`
+	}
+	teams, err := getAllPages[team](ctx, t, p.teamsEndpoint)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]struct{}{}
+	for _, org := range orgs {
+		groups[org.Login] = struct{}{}
+	}
+	for _, team := range teams {
+		groups[team.Organization.Login] = struct{}{}
+		groups[team.Organization.Login+"/"+team.Slug] = struct{}{}
+	}
+
+	var out struct {
+		Groups []string `json:"groups"`
+	}
+	out.Groups = make([]string, 0, len(groups))
+	for group := range groups {
+		out.Groups = append(out.Groups, group)
+	}
+	sort.Strings(out.Groups)
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// getAllPages returns the items of every page of a github list endpoint.
+//
+// https://docs.github.com/en/rest/guides/using-pagination-in-the-rest-api
+func getAllPages[T any](ctx context.Context, t *oauth2.Token, endpoint string) ([]T, error) {
+	headers := map[string]string{
+		"Authorization": fmt.Sprintf("token %s", t.AccessToken),
+		"Accept":        "application/vnd.github.v3+json",
+	}
+	var all []T
+	for page := 1; ; page++ {
+		params := url.Values{
+			"per_page": {strconv.Itoa(pageSize)},
+			"page":     {strconv.Itoa(page)},
+		}
+		var items []T
+		err := httputil.Do(ctx, http.MethodGet, endpoint, version.UserAgent(), headers, params, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if len(items) < pageSize {
+			return all, nil
+		}
+	}
+}
+
 // Revoke method will remove all the github grants the user
 // gave pomerium application during authorization.
 //
@@ -216,12 +311,11 @@ func (p *Provider) userInfo(ctx context.Context, t *oauth2.Token, v interface{})
 func (p *Provider) Revoke(ctx context.Context, token *oauth2.Token) error {
 	// build the basic authentication request
 	basicAuth := url.UserPassword(p.Oauth.ClientID, p.Oauth.ClientSecret)
-	revokeURL := url.URL{
-		Scheme: "https",
-		User:   basicAuth,
-		Host:   "api.github.com",
-		Path:   fmt.Sprintf(revokePath, p.Oauth.ClientID),
+	revokeURL, err := url.Parse(urlutil.Join(p.apiURL, fmt.Sprintf(revokePath, p.Oauth.ClientID)))
+	if err != nil {
+		return errors.New("github: could not create revoke request")
 	}
+	revokeURL.User = basicAuth
 	reqBody := strings.NewReader(fmt.Sprintf(`{"access_token": "%s"}`, token.AccessToken))
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, revokeURL.String(), reqBody)
 	if err != nil {
@@ -241,8 +335,8 @@ func (p *Provider) Revoke(ctx context.Context, token *oauth2.Token) error {
 
 // GetSignInURL returns a URL to OAuth 2.0 provider's consent page
 // that asks for permissions for the required scopes explicitly.
-func (p *Provider) GetSignInURL(state string) (string, error) {
-	return p.Oauth.AuthCodeURL(state, oauth2.AccessTypeOffline), nil
+func (p *Provider) GetSignInURL(state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	return p.Oauth.AuthCodeURL(state, append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)...), nil
 }
 
 // LogOut is not implemented by github.
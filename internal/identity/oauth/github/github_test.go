@@ -0,0 +1,87 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func TestProvider_UpdateUserInfo(t *testing.T) {
+	t.Parallel()
+
+	type team struct {
+		Slug         string            `json:"slug"`
+		Organization map[string]string `json:"organization"`
+	}
+	var teams []team
+	for i := 0; i < pageSize; i++ {
+		teams = append(teams, team{Slug: fmt.Sprintf("team%03d", i), Organization: map[string]string{"login": "org1"}})
+	}
+	teams = append(teams, team{Slug: "admins", Organization: map[string]string{"login": "org2"}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "login": "alice", "name": "Alice"})
+	})
+	mux.HandleFunc("/api/v3/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "alice@example.com", "verified": true, "primary": true},
+		})
+	})
+	mux.HandleFunc("/api/v3/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]string{{"login": "org1"}, {"login": "org3"}})
+	})
+	mux.HandleFunc("/api/v3/user/teams", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token ACCESS", r.Header.Get("Authorization"))
+		switch r.URL.Query().Get("page") {
+		case "1":
+			_ = json.NewEncoder(w).Encode(teams[:pageSize])
+		case "2":
+			_ = json.NewEncoder(w).Encode(teams[pageSize:])
+		default:
+			_ = json.NewEncoder(w).Encode([]team{})
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	p, err := New(context.Background(), &oauth.Options{
+		ProviderURL: srv.URL,
+		APIURL:      srv.URL + "/api/v3",
+		RedirectURL: &url.URL{Scheme: "https", Host: "authenticate.example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/login/oauth/authorize", p.Oauth.Endpoint.AuthURL)
+
+	var claims struct {
+		User   string   `json:"user"`
+		Email  string   `json:"email"`
+		Groups []string `json:"groups"`
+	}
+	require.NoError(t, p.UpdateUserInfo(context.Background(), &oauth2.Token{AccessToken: "ACCESS"}, &claims))
+	assert.Equal(t, "alice", claims.User)
+	assert.Equal(t, "alice@example.com", claims.Email)
+	assert.Len(t, claims.Groups, pageSize+4)
+	assert.Contains(t, claims.Groups, "org1/team099")
+	assert.Contains(t, claims.Groups, "org2/admins")
+	assert.Subset(t, claims.Groups, []string{"org1", "org2", "org3"})
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	p, err := New(context.Background(), &oauth.Options{RedirectURL: &url.URL{}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.github.com/user/teams", p.teamsEndpoint)
+	assert.Equal(t, "https://github.com/login/oauth/authorize", p.Oauth.Endpoint.AuthURL)
+}
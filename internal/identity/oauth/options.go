@@ -29,4 +29,45 @@ type Options struct {
 	// AuthCodeOptions specifies additional key value pairs query params to add
 	// to the request flow signin url.
 	AuthCodeOptions map[string]string
+
+	// AuthURL and TokenURL are the authorization and token endpoints of
+	// identity providers without a discovery document.
+	AuthURL  string
+	TokenURL string
+	// UserInfoURL is the user info endpoint of identity providers without a
+	// discovery document. It may be a template.
+	UserInfoURL string
+	// APIURL is the base URL of the REST API of identity providers which
+	// serve it separately, such as GitHub Enterprise Server.
+	APIURL string
+	// KeycloakSkipRealmRoles doesn't add Keycloak realm roles to the groups
+	// claim.
+	KeycloakSkipRealmRoles bool
+	// KeycloakClientRoles are the ids of the Keycloak clients whose roles are
+	// added to the groups claim.
+	KeycloakClientRoles []string
+	// PasskeyAllowedUsers are the usernames of the users who may register
+	// passkeys, or "*" for anyone.
+	PasskeyAllowedUsers []string
+	// KerberosKeytab is the base64 encoded keytab of the Kerberos service
+	// principal. KerberosKeytabFile is the path of the keytab instead.
+	KerberosKeytab     string
+	KerberosKeytabFile string
+	// AppleTeamID, AppleKeyID and the base64 encoded ApplePrivateKey, or
+	// ApplePrivateKeyFile instead, generate the client secret JWT of the
+	// Sign in with Apple identity provider.
+	AppleTeamID         string
+	AppleKeyID          string
+	ApplePrivateKey     string
+	ApplePrivateKeyFile string
+	// ClientCA is the PEM encoded certificate authority of the client
+	// certificates which identify users.
+	ClientCA []byte
+	// RequirePKCE requires the identity provider to support PKCE with the
+	// S256 code challenge method.
+	RequirePKCE bool
+
+	// ClaimPaths maps claim names to JSONPath expressions which select the
+	// claim values from the user info response.
+	ClaimPaths map[string]string
 }
@@ -0,0 +1,33 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/oauth2"
+)
+
+// CodeChallengeMethodS256 is the PKCE code challenge method which uses the
+// SHA-256 hash of the code verifier.
+//
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.2
+const CodeChallengeMethodS256 = "S256"
+
+// S256ChallengeOptions returns the authorization request options for the S256
+// code challenge of the PKCE code verifier.
+//
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.3
+func S256ChallengeOptions(codeVerifier string) []oauth2.AuthCodeOption {
+	h := sha256.Sum256([]byte(codeVerifier))
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(h[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", CodeChallengeMethodS256),
+	}
+}
+
+// VerifierOption returns the token request option for the PKCE code verifier.
+//
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.5
+func VerifierOption(codeVerifier string) oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("code_verifier", codeVerifier)
+}
@@ -0,0 +1,112 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+// defaultGraphURL is the base url of the Microsoft Graph API. National clouds
+// use a different url, which is set as the API url.
+const defaultGraphURL = "https://graph.microsoft.com/v1.0"
+
+const (
+	// https://learn.microsoft.com/en-us/graph/api/user-list-transitivememberof
+	transitiveMemberOfPath = "/me/transitiveMemberOf/microsoft.graph.group"
+	// https://learn.microsoft.com/en-us/graph/api/user-list-approleassignments
+	appRoleAssignmentsPath = "/me/appRoleAssignments"
+)
+
+// updateGraphClaims sets the groups claim to the ids of the groups the user
+// is a direct or nested member of, and the app_role_assignments claim to the
+// ids of the app roles assigned to the user or the user's groups.
+//
+// Transitive group membership requires the GroupMember.Read.All permission. If
+// Microsoft Graph can't be queried the claims from the ID token are kept.
+func (p *Provider) updateGraphClaims(ctx context.Context, t *oauth2.Token, v interface{}) {
+	if t == nil || t.AccessToken == "" {
+		return
+	}
+
+	groups, err := getAllGraphPages[struct {
+		ID string `json:"id"`
+	}](ctx, t, urlutil.Join(p.graphURL, transitiveMemberOfPath)+"?$select=id")
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("azure: failed to retrieve transitive group membership")
+		return
+	}
+	appRoleAssignments, err := getAllGraphPages[struct {
+		AppRoleID string `json:"appRoleId"`
+	}](ctx, t, urlutil.Join(p.graphURL, appRoleAssignmentsPath)+"?$select=appRoleId")
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("azure: failed to retrieve app role assignments")
+		return
+	}
+
+	var out struct {
+		Groups             []string `json:"groups"`
+		AppRoleAssignments []string `json:"app_role_assignments"`
+	}
+	out.Groups = make([]string, 0, len(groups))
+	for _, group := range groups {
+		out.Groups = append(out.Groups, group.ID)
+	}
+	out.AppRoleAssignments = make([]string, 0, len(appRoleAssignments))
+	for _, assignment := range appRoleAssignments {
+		out.AppRoleAssignments = append(out.AppRoleAssignments, assignment.AppRoleID)
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		log.Warn(ctx).Err(err).Msg("azure: failed to set microsoft graph claims")
+	}
+}
+
+// getAllGraphPages returns the values of every page of a Microsoft Graph
+// collection.
+//
+// https://learn.microsoft.com/en-us/graph/paging
+func getAllGraphPages[T any](ctx context.Context, t *oauth2.Token, endpoint string) ([]T, error) {
+	headers := map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", t.AccessToken),
+		"Accept":        "application/json",
+	}
+	var all []T
+	for endpoint != "" {
+		var response struct {
+			Value    []T    `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		err := httputil.Do(ctx, http.MethodGet, endpoint, version.UserAgent(), headers, nil, &response)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, response.Value...)
+
+		if response.NextLink != "" {
+			// the next link must be on the same host, so that the access
+			// token isn't sent elsewhere
+			next, err := url.Parse(response.NextLink)
+			if err != nil {
+				return nil, err
+			}
+			current, _ := url.Parse(endpoint)
+			if next.Host != current.Host {
+				return nil, fmt.Errorf("unexpected next link host: %s", next.Host)
+			}
+		}
+		endpoint = response.NextLink
+	}
+	return all, nil
+}
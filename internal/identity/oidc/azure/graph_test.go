@@ -0,0 +1,73 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestProvider_updateGraphClaims(t *testing.T) {
+	t.Parallel()
+
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc(transitiveMemberOfPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer ACCESS", r.Header.Get("Authorization"))
+		if r.URL.Query().Get("$skiptoken") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"value":           []map[string]string{{"id": "g1"}, {"id": "g2"}},
+				"@odata.nextLink": srv.URL + transitiveMemberOfPath + "?$skiptoken=2",
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"value": []map[string]string{{"id": "g3"}},
+		})
+	})
+	mux.HandleFunc(appRoleAssignmentsPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"value": []map[string]string{{"appRoleId": "r1"}},
+		})
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	p := &Provider{graphURL: srv.URL}
+
+	var claims struct {
+		Groups             []string `json:"groups"`
+		AppRoleAssignments []string `json:"app_role_assignments"`
+	}
+	claims.Groups = []string{"from-id-token"}
+	p.updateGraphClaims(context.Background(), &oauth2.Token{AccessToken: "ACCESS"}, &claims)
+	assert.Equal(t, []string{"g1", "g2", "g3"}, claims.Groups)
+	assert.Equal(t, []string{"r1"}, claims.AppRoleAssignments)
+
+	t.Run("unavailable", func(t *testing.T) {
+		p := &Provider{graphURL: srv.URL + "/missing"}
+		claims.Groups = []string{"from-id-token"}
+		p.updateGraphClaims(context.Background(), &oauth2.Token{AccessToken: "ACCESS"}, &claims)
+		assert.Equal(t, []string{"from-id-token"}, claims.Groups,
+			"claims should be kept when microsoft graph can't be queried")
+	})
+}
+
+func TestGetAllGraphPages(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"value":           []string{"a"},
+			"@odata.nextLink": "https://attacker.example.com/next",
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := getAllGraphPages[string](context.Background(), &oauth2.Token{AccessToken: "ACCESS"}, srv.URL)
+	assert.Error(t, err, "the access token should not be sent to other hosts")
+}
@@ -14,6 +14,7 @@ import (
 	go_oidc "github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 
+	"github.com/pomerium/pomerium/internal/identity/identity"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
 	pom_oidc "github.com/pomerium/pomerium/internal/identity/oidc"
 )
@@ -37,6 +38,8 @@ var defaultAuthCodeOptions = map[string]string{"prompt": "select_account"}
 // Provider is an Azure implementation of the Authenticator interface.
 type Provider struct {
 	*pom_oidc.Provider
+
+	graphURL string
 }
 
 // New instantiates an OpenID Connect (OIDC) provider for Azure.
@@ -65,9 +68,48 @@ func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
 		p.AuthCodeOptions = o.AuthCodeOptions
 	}
 
+	p.graphURL = defaultGraphURL
+	if o.APIURL != "" {
+		p.graphURL = o.APIURL
+	}
+
 	return &p, nil
 }
 
+// Authenticate converts an authorization code returned from the identity
+// provider into a token, and adds the user's transitive groups and app role
+// assignments from Microsoft Graph.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	t, err := p.Provider.Authenticate(ctx, code, v, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.updateGraphClaims(ctx, t, v)
+	return t, nil
+}
+
+// Refresh renews a user's session, along with the user's transitive groups
+// and app role assignments.
+func (p *Provider) Refresh(ctx context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	t, err := p.Provider.Refresh(ctx, t, v)
+	if err != nil {
+		return nil, err
+	}
+	p.updateGraphClaims(ctx, t, v)
+	return t, nil
+}
+
+// UpdateUserInfo calls the user info endpoint and adds the user's transitive
+// groups and app role assignments.
+func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error {
+	err := p.Provider.UpdateUserInfo(ctx, t, v)
+	if err != nil {
+		return err
+	}
+	p.updateGraphClaims(ctx, t, v)
+	return nil
+}
+
 // Name returns the provider name.
 func (p *Provider) Name() string {
 	return Name
@@ -26,3 +26,7 @@ var ErrMissingRefreshToken = errors.New("identity/oidc: missing refresh token")
 
 // ErrMissingAccessToken is returned when no access token was found.
 var ErrMissingAccessToken = errors.New("identity/oidc: missing access token")
+
+// ErrPKCENotSupported is returned when PKCE is required but the identity
+// provider doesn't support the S256 code challenge method.
+var ErrPKCENotSupported = errors.New("identity/oidc: identity provider does not support PKCE with S256")
@@ -6,10 +6,14 @@ package google
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	oidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/exp/slices"
+	"golang.org/x/oauth2"
 
+	"github.com/pomerium/pomerium/internal/identity/identity"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
 	pom_oidc "github.com/pomerium/pomerium/internal/identity/oidc"
 )
@@ -36,6 +40,10 @@ var defaultAuthCodeOptions = map[string]string{"prompt": "select_account consent
 // Provider is a Google implementation of the Authenticator interface.
 type Provider struct {
 	*pom_oidc.Provider
+
+	// groups resolves nested groups, if the Cloud Identity groups scope was
+	// requested
+	groups *groupResolver
 }
 
 // New instantiates an OpenID Connect (OIDC) session with Google.
@@ -58,9 +66,74 @@ func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
 	if len(o.AuthCodeOptions) != 0 {
 		p.AuthCodeOptions = o.AuthCodeOptions
 	}
+
+	if slices.Contains(o.Scopes, CloudIdentityGroupsScope) {
+		cloudIdentityURL := defaultCloudIdentityURL
+		if o.APIURL != "" {
+			cloudIdentityURL = o.APIURL
+		}
+		p.groups = newGroupResolver(cloudIdentityURL)
+	}
 	return &p, nil
 }
 
+// Authenticate converts an authorization code returned from the identity
+// provider into a token, and resolves the user's nested groups.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	t, err := p.Provider.Authenticate(ctx, code, v, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if p.groups != nil {
+		email, err := getIDTokenEmail(t)
+		if err == nil {
+			p.groups.updateClaims(ctx, t, email, v)
+		}
+	}
+	return t, nil
+}
+
+// Refresh renews a user's session, along with the user's nested groups.
+func (p *Provider) Refresh(ctx context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	t, err := p.Provider.Refresh(ctx, t, v)
+	if err != nil {
+		return nil, err
+	}
+	if p.groups != nil {
+		email, err := getIDTokenEmail(t)
+		if err == nil {
+			p.groups.updateClaims(ctx, t, email, v)
+		}
+	}
+	return t, nil
+}
+
+// UpdateUserInfo calls the user info endpoint and resolves the user's nested
+// groups.
+func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error {
+	if p.groups == nil {
+		return p.Provider.UpdateUserInfo(ctx, t, v)
+	}
+
+	var claims map[string]interface{}
+	err := p.Provider.UpdateUserInfo(ctx, t, &claims)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return err
+	}
+
+	email, _ := claims["email"].(string)
+	p.groups.updateClaims(ctx, t, email, v)
+	return nil
+}
+
 // Name returns the provider name.
 func (p *Provider) Name() string {
 	return Name
@@ -0,0 +1,149 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+// CloudIdentityGroupsScope is the scope which enables resolving the user's
+// nested groups with the Cloud Identity API.
+const CloudIdentityGroupsScope = "https://www.googleapis.com/auth/cloud-identity.groups.readonly"
+
+const (
+	defaultCloudIdentityURL = "https://cloudidentity.googleapis.com/v1"
+	// https://cloud.google.com/identity/docs/reference/rest/v1/groups.memberships/searchTransitiveGroups
+	searchTransitiveGroupsPath = "/groups/-/memberships:searchTransitiveGroups"
+
+	groupsCacheSize = 10_000
+	groupsCacheTTL  = 5 * time.Minute
+)
+
+type cachedGroups struct {
+	groups    []string
+	expiresAt time.Time
+}
+
+// groupResolver resolves the groups a user is a direct or nested member of,
+// and caches them so that refreshing sessions and users shortly after each
+// other doesn't query the Cloud Identity API again.
+type groupResolver struct {
+	cloudIdentityURL string
+	cache            *lru.Cache[string, cachedGroups]
+	now              func() time.Time
+}
+
+func newGroupResolver(cloudIdentityURL string) *groupResolver {
+	cache, err := lru.New[string, cachedGroups](groupsCacheSize)
+	if err != nil {
+		// only fails for a non-positive size
+		panic(err)
+	}
+	return &groupResolver{
+		cloudIdentityURL: cloudIdentityURL,
+		cache:            cache,
+		now:              time.Now,
+	}
+}
+
+// updateClaims sets the groups claim to the email addresses of the groups the
+// user with the given email address is a direct or nested member of. If the
+// Cloud Identity API can't be queried the existing claims are kept.
+func (r *groupResolver) updateClaims(ctx context.Context, t *oauth2.Token, email string, v interface{}) {
+	if t == nil || t.AccessToken == "" || email == "" {
+		return
+	}
+
+	groups, err := r.getGroups(ctx, t, email)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("google: failed to resolve nested groups")
+		return
+	}
+
+	b, err := json.Marshal(map[string][]string{"groups": groups})
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		log.Warn(ctx).Err(err).Msg("google: failed to set groups claim")
+	}
+}
+
+func (r *groupResolver) getGroups(ctx context.Context, t *oauth2.Token, email string) ([]string, error) {
+	if cached, ok := r.cache.Get(email); ok && r.now().Before(cached.expiresAt) {
+		return cached.groups, nil
+	}
+
+	if strings.ContainsAny(email, `'\`) {
+		return nil, fmt.Errorf("invalid email address: %s", email)
+	}
+
+	headers := map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", t.AccessToken),
+		"Accept":        "application/json",
+	}
+	query := fmt.Sprintf("member_key_id == '%s' && 'cloudidentity.googleapis.com/groups.discussion_forum' in labels", email)
+	groups := []string{}
+	pageToken := ""
+	for {
+		params := url.Values{"query": {query}}
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+		var response struct {
+			Memberships []struct {
+				GroupKey struct {
+					ID string `json:"id"`
+				} `json:"groupKey"`
+			} `json:"memberships"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err := httputil.Do(ctx, http.MethodGet, urlutil.Join(r.cloudIdentityURL, searchTransitiveGroupsPath),
+			version.UserAgent(), headers, params, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, membership := range response.Memberships {
+			groups = append(groups, membership.GroupKey.ID)
+		}
+		if response.NextPageToken == "" {
+			break
+		}
+		pageToken = response.NextPageToken
+	}
+
+	r.cache.Add(email, cachedGroups{groups: groups, expiresAt: r.now().Add(groupsCacheTTL)})
+	return groups, nil
+}
+
+// getIDTokenEmail returns the email claim of the token's ID token, which has
+// already been verified.
+func getIDTokenEmail(t *oauth2.Token) (string, error) {
+	rawIDToken, ok := t.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("missing id_token")
+	}
+	idToken, err := jwt.ParseSigned(rawIDToken)
+	if err != nil {
+		return "", err
+	}
+	var claims struct {
+		Email string `json:"email"`
+	}
+	err = idToken.UnsafeClaimsWithoutVerification(&claims)
+	return claims.Email, err
+}
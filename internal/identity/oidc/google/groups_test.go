@@ -0,0 +1,69 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestGroupResolver(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, searchTransitiveGroupsPath, r.URL.Path)
+		assert.Equal(t, "Bearer ACCESS", r.Header.Get("Authorization"))
+		assert.Contains(t, r.URL.Query().Get("query"), "member_key_id == 'alice@example.com'")
+		if r.URL.Query().Get("pageToken") == "" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"memberships": []map[string]interface{}{
+					{"groupKey": map[string]string{"id": "child@example.com"}},
+				},
+				"nextPageToken": "2",
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"memberships": []map[string]interface{}{
+				{"groupKey": map[string]string{"id": "parent@example.com"}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Now()
+	r := newGroupResolver(srv.URL)
+	r.now = func() time.Time { return now }
+
+	var claims struct {
+		Email  string   `json:"email"`
+		Groups []string `json:"groups"`
+	}
+	claims.Email = "alice@example.com"
+	token := &oauth2.Token{AccessToken: "ACCESS"}
+	r.updateClaims(context.Background(), token, claims.Email, &claims)
+	assert.Equal(t, []string{"child@example.com", "parent@example.com"}, claims.Groups)
+	assert.Equal(t, "alice@example.com", claims.Email)
+	assert.Equal(t, 2, requests)
+
+	groups, err := r.getGroups(context.Background(), token, "alice@example.com")
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, 2, requests, "groups should be cached")
+
+	now = now.Add(groupsCacheTTL)
+	_, err = r.getGroups(context.Background(), token, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 4, requests, "expired groups should be resolved again")
+
+	_, err = r.getGroups(context.Background(), token, "alice'@example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+// Package keycloak implements OpenID Connect for Keycloak
+//
+// https://www.keycloak.org/docs/latest/server_admin/#con-oidc_server_administration_guide
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/exp/slices"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	pom_oidc "github.com/pomerium/pomerium/internal/identity/oidc"
+)
+
+const (
+	// Name identifies the Keycloak identity provider
+	Name = "keycloak"
+
+	// AllClients selects the roles of every client.
+	AllClients = "*"
+)
+
+// Provider is a Keycloak implementation of the Authenticator interface.
+type Provider struct {
+	*pom_oidc.Provider
+
+	skipRealmRoles bool
+	clientRoles    []string
+}
+
+// New instantiates an OpenID Connect (OIDC) provider for Keycloak.
+func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
+	var p Provider
+	var err error
+	genericOidc, err := pom_oidc.New(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed creating oidc provider: %w", Name, err)
+	}
+	p.Provider = genericOidc
+
+	p.skipRealmRoles = o.KeycloakSkipRealmRoles
+	p.clientRoles = o.KeycloakClientRoles
+	if len(p.clientRoles) == 0 {
+		p.clientRoles = []string{o.ClientID}
+	}
+
+	return &p, nil
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// Authenticate converts an authorization code returned from the identity
+// provider into a token, and maps the user's roles to groups.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	t, err := p.Provider.Authenticate(ctx, code, v, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.updateGroups(t, v); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Refresh renews a user's session, along with the user's roles.
+func (p *Provider) Refresh(ctx context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	t, err := p.Provider.Refresh(ctx, t, v)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.updateGroups(t, v); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UpdateUserInfo calls the user info endpoint and maps the user's roles to
+// groups.
+func (p *Provider) UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error {
+	err := p.Provider.UpdateUserInfo(ctx, t, v)
+	if err != nil {
+		return err
+	}
+	return p.updateGroups(t, v)
+}
+
+type accessTokenClaims struct {
+	Groups      []string `json:"groups"`
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+}
+
+// updateGroups sets the groups claim to the user's Keycloak groups, realm
+// roles and client roles, named <client id>/<role>.
+//
+// Keycloak only adds roles to the access token by default. The access token
+// was received directly from the token endpoint, so its claims are read
+// without verifying its signature.
+func (p *Provider) updateGroups(t *oauth2.Token, v interface{}) error {
+	if t == nil || t.AccessToken == "" {
+		return nil
+	}
+	accessToken, err := jwt.ParseSigned(t.AccessToken)
+	if err != nil {
+		// not a JWT, so there are no roles
+		return nil
+	}
+	var claims accessTokenClaims
+	err = accessToken.UnsafeClaimsWithoutVerification(&claims)
+	if err != nil {
+		return fmt.Errorf("%s: invalid access token claims: %w", Name, err)
+	}
+
+	b, err := json.Marshal(map[string][]string{"groups": p.getGroups(&claims)})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (p *Provider) getGroups(claims *accessTokenClaims) []string {
+	groups := append([]string{}, claims.Groups...)
+	if !p.skipRealmRoles {
+		groups = append(groups, claims.RealmAccess.Roles...)
+	}
+	for clientID, access := range claims.ResourceAccess {
+		if !slices.Contains(p.clientRoles, AllClients) && !slices.Contains(p.clientRoles, clientID) {
+			continue
+		}
+		for _, role := range access.Roles {
+			groups = append(groups, clientID+"/"+role)
+		}
+	}
+	sort.Strings(groups)
+	return slices.Compact(groups)
+}
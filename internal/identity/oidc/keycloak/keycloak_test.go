@@ -0,0 +1,61 @@
+package keycloak
+
+import (
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestProvider_updateGroups(t *testing.T) {
+	t.Parallel()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}, nil)
+	require.NoError(t, err)
+	accessToken, err := jwt.Signed(signer).Claims(map[string]any{
+		"groups":       []string{"/staff"},
+		"realm_access": map[string]any{"roles": []string{"admin", "offline_access"}},
+		"resource_access": map[string]any{
+			"pomerium": map[string]any{"roles": []string{"viewer"}},
+			"grafana":  map[string]any{"roles": []string{"editor", "viewer"}},
+		},
+	}).CompactSerialize()
+	require.NoError(t, err)
+	token := &oauth2.Token{AccessToken: accessToken}
+
+	for _, tc := range []struct {
+		name     string
+		provider Provider
+		expect   []string
+	}{
+		{"default", Provider{clientRoles: []string{"pomerium"}},
+			[]string{"/staff", "admin", "offline_access", "pomerium/viewer"}},
+		{"skip realm roles", Provider{skipRealmRoles: true, clientRoles: []string{"grafana"}},
+			[]string{"/staff", "grafana/editor", "grafana/viewer"}},
+		{"all clients", Provider{skipRealmRoles: true, clientRoles: []string{AllClients}},
+			[]string{"/staff", "grafana/editor", "grafana/viewer", "pomerium/viewer"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var claims struct {
+				Groups []string `json:"groups"`
+			}
+			require.NoError(t, tc.provider.updateGroups(token, &claims))
+			assert.Equal(t, tc.expect, claims.Groups)
+		})
+	}
+
+	t.Run("opaque access token", func(t *testing.T) {
+		var claims struct {
+			Groups []string `json:"groups"`
+		}
+		p := Provider{}
+		assert.NoError(t, p.updateGroups(&oauth2.Token{AccessToken: "OPAQUE"}, &claims))
+		assert.Nil(t, claims.Groups)
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/internal/version"
+	"github.com/pomerium/pomerium/pkg/slices"
 )
 
 // Name identifies the generic OpenID Connect provider.
@@ -44,6 +45,11 @@ type Provider struct {
 	// https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPInitiated
 	EndSessionURL string `json:"end_session_endpoint,omitempty"`
 
+	// CodeChallengeMethodsSupported are the PKCE code challenge methods
+	// supported by the identity provider.
+	// https://datatracker.ietf.org/doc/html/rfc8414#section-2
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+
 	// AuthCodeOptions specifies additional key value pairs query params to add
 	// to the request flow signin url.
 	AuthCodeOptions map[string]string
@@ -87,6 +93,10 @@ func New(ctx context.Context, o *oauth.Options, options ...Option) (*Provider, e
 				return nil, fmt.Errorf("identity/oidc: could not retrieve additional claims: %w", err)
 			}
 
+			if o.RequirePKCE && !slices.Contains(p.CodeChallengeMethodsSupported, oauth.CodeChallengeMethodS256) {
+				return nil, ErrPKCENotSupported
+			}
+
 			return pp, nil
 		}),
 		WithGetVerifier(func(provider *go_oidc.Provider) *go_oidc.IDTokenVerifier {
@@ -103,29 +113,30 @@ func New(ctx context.Context, o *oauth.Options, options ...Option) (*Provider, e
 // always provide a non-empty string and validate that it matches the
 // the state query parameter on your redirect callback.
 // See http://tools.ietf.org/html/rfc6749#section-10.12 for more info.
-func (p *Provider) GetSignInURL(state string) (string, error) {
+func (p *Provider) GetSignInURL(state string, opts ...oauth2.AuthCodeOption) (string, error) {
 	oa, err := p.GetOauthConfig()
 	if err != nil {
 		return "", err
 	}
 
-	opts := defaultAuthCodeOptions
+	// options passed in take precedence over the configured ones
+	authCodeOptions := append([]oauth2.AuthCodeOption{}, defaultAuthCodeOptions...)
 	for k, v := range p.AuthCodeOptions {
-		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam(k, v))
 	}
-	return oa.AuthCodeURL(state, opts...), nil
+	return oa.AuthCodeURL(state, append(authCodeOptions, opts...)...), nil
 }
 
 // Authenticate converts an authorization code returned from the identity
 // provider into a token which is then converted into a user session.
-func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State) (*oauth2.Token, error) {
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
 	oa, err := p.GetOauthConfig()
 	if err != nil {
 		return nil, err
 	}
 
 	// Exchange converts an authorization code into a token.
-	oauth2Token, err := oa.Exchange(ctx, code)
+	oauth2Token, err := oa.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("identity/oidc: token exchange failed: %w", err)
 	}
@@ -63,3 +63,57 @@ func TestRevoke(t *testing.T) {
 		AccessToken: "ACCESS_TOKEN",
 	}))
 }
+
+func TestPKCE(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	newServer := func(codeChallengeMethods []string) *httptest.Server {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/.well-known/openid-configuration":
+				json.NewEncoder(w).Encode(map[string]any{
+					"issuer":                           srv.URL,
+					"authorization_endpoint":           srv.URL + "/authorize",
+					"code_challenge_methods_supported": codeChallengeMethods,
+				})
+			default:
+				assert.Failf(t, "unexpected http request", "url: %s", r.URL.String())
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	signIn := func(srv *httptest.Server, requirePKCE bool) (*url.URL, error) {
+		redirectURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		p, err := New(ctx, &oauth.Options{
+			ProviderURL: srv.URL,
+			RedirectURL: redirectURL,
+			ClientID:    "CLIENT_ID",
+			RequirePKCE: requirePKCE,
+		})
+		require.NoError(t, err)
+		rawURL, err := p.GetSignInURL("STATE", oauth.S256ChallengeOptions("CODE_VERIFIER")...)
+		if err != nil {
+			return nil, err
+		}
+		return url.Parse(rawURL)
+	}
+
+	u, err := signIn(newServer([]string{"plain", "S256"}), true)
+	require.NoError(t, err)
+	// the SHA-256 hash of CODE_VERIFIER
+	assert.Equal(t, "pBvokOmo_vU_rFF4MeFzkkUbVJOGVGPCH14UHuQAhM4", u.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+
+	_, err = signIn(newServer([]string{"plain"}), true)
+	assert.ErrorIs(t, err, ErrPKCENotSupported)
+
+	u, err = signIn(newServer(nil), false)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"),
+		"PKCE should be used even when the identity provider doesn't advertise it")
+}
@@ -0,0 +1,294 @@
+// Package passkey implements an identity provider where users sign in to the
+// authenticate service with passkeys, discoverable WebAuthn credentials, for
+// environments without an external identity provider.
+//
+// The ceremonies themselves are handled by the authenticate service, which
+// stores credentials in the databroker. The provider only issues and redeems
+// the codes and tokens of signed in users.
+package passkey
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"golang.org/x/exp/slices"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// Name identifies the passkey identity provider.
+	Name = "passkey"
+
+	// SignInPath is the path of the sign in page served by the authenticate
+	// service.
+	SignInPath = "/oauth2/passkey"
+
+	// AllUsers allows anyone to register.
+	AllUsers = "*"
+
+	// RecoveryCodeCount is the number of recovery codes generated when a
+	// user registers.
+	RecoveryCodeCount = 10
+)
+
+const (
+	// users are stored in the databroker, so sessions are only refreshed to
+	// renew their tokens
+	refreshInterval = time.Hour
+	// how long a sign in code can be redeemed for
+	codeTTL = time.Minute
+
+	purposeCode  = "passkey code"
+	purposeToken = "passkey access token"
+)
+
+// A User is a user who signed in with a passkey.
+type User struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Provider is a passkey identity provider.
+type Provider struct {
+	redirectURL  *url.URL
+	allowedUsers []string
+	cipher       cipher.AEAD
+}
+
+// New creates a new passkey identity provider.
+func New(_ context.Context, o *oauth.Options) (*Provider, error) {
+	if o.ClientSecret == "" {
+		return nil, errors.New("passkey: client secret is required")
+	}
+	if o.RedirectURL == nil {
+		return nil, errors.New("passkey: redirect url is required")
+	}
+
+	p := &Provider{
+		redirectURL:  o.RedirectURL,
+		allowedUsers: o.PasskeyAllowedUsers,
+	}
+	key := cryptutil.Hash("passkey provider", []byte(o.ClientSecret))
+	var err error
+	p.cipher, err = cryptutil.NewAEADCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NormalizeUsername returns the canonical form of a username, which is also
+// the user's id.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// CanRegister returns true if the user with the given username may register
+// a first passkey. Additional passkeys require a recovery code.
+func (p *Provider) CanRegister(username string) bool {
+	username = NormalizeUsername(username)
+	if username == "" {
+		return false
+	}
+	return slices.Contains(p.allowedUsers, AllUsers) ||
+		slices.IndexFunc(p.allowedUsers, func(allowed string) bool {
+			return NormalizeUsername(allowed) == username
+		}) >= 0
+}
+
+// RegistrationEnabled returns true if any user may register.
+func (p *Provider) RegistrationEnabled() bool {
+	return len(p.allowedUsers) > 0
+}
+
+// IssueCode returns a short-lived code for a signed in user which can be
+// redeemed with Authenticate.
+func (p *Provider) IssueCode(u *User) (string, error) {
+	return p.seal(purposeCode, u, codeTTL)
+}
+
+// Authenticate redeems a code returned by IssueCode.
+func (p *Provider) Authenticate(_ context.Context, code string, v identity.State, _ ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	u, err := p.open(purposeCode, code)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(u, v)
+}
+
+// Refresh renews a user's session.
+func (p *Provider) Refresh(_ context.Context, t *oauth2.Token, v identity.State) (*oauth2.Token, error) {
+	if t == nil {
+		return nil, oidc.ErrMissingAccessToken
+	}
+	u, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.authenticate(u, v)
+}
+
+// UpdateUserInfo sets the user's claims.
+func (p *Provider) UpdateUserInfo(_ context.Context, t *oauth2.Token, v interface{}) error {
+	if t == nil {
+		return oidc.ErrMissingAccessToken
+	}
+	u, err := p.open(purposeToken, t.AccessToken)
+	if err != nil {
+		return err
+	}
+	return userInfo(u, v)
+}
+
+// Revoke does nothing, since there are no tokens to revoke.
+func (p *Provider) Revoke(_ context.Context, _ *oauth2.Token) error {
+	return nil
+}
+
+// GetSignInURL returns the URL of the authenticate service's sign in page.
+func (p *Provider) GetSignInURL(state string, _ ...oauth2.AuthCodeOption) (string, error) {
+	u := *p.redirectURL
+	u.Path = SignInPath
+	u.RawQuery = url.Values{"state": {state}}.Encode()
+	return u.String(), nil
+}
+
+// LogOut is not implemented by passkeys.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+func (p *Provider) authenticate(u *User, v identity.State) (*oauth2.Token, error) {
+	if err := userInfo(u, v); err != nil {
+		return nil, err
+	}
+	accessToken, err := p.seal(purposeToken, u, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(refreshInterval),
+	}, nil
+}
+
+func userInfo(u *User, v interface{}) error {
+	var out struct {
+		Subject string `json:"sub"`
+		User    string `json:"user"`
+		Email   string `json:"email,omitempty"`
+		Name    string `json:"name,omitempty"`
+		// needs to be set manually
+		Expiry    *jwt.NumericDate `json:"exp,omitempty"`
+		NotBefore *jwt.NumericDate `json:"nbf,omitempty"`
+		IssuedAt  *jwt.NumericDate `json:"iat,omitempty"`
+	}
+
+	out.Expiry = jwt.NewNumericDate(time.Now().Add(refreshInterval))
+	out.NotBefore = jwt.NewNumericDate(time.Now())
+	out.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	out.Subject = u.ID
+	out.User = u.ID
+	out.Email = u.Email
+	out.Name = u.Name
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+type sealedUser struct {
+	User   *User `json:"user"`
+	Expiry int64 `json:"exp,omitempty"`
+}
+
+func (p *Provider) seal(purpose string, u *User, ttl time.Duration) (string, error) {
+	v := sealedUser{User: u}
+	if ttl > 0 {
+		v.Expiry = time.Now().Add(ttl).Unix()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cryptutil.Encrypt(p.cipher, b, []byte(purpose))), nil
+}
+
+func (p *Provider) open(purpose, s string) (*User, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("passkey: invalid %s: %w", purpose, err)
+	}
+	b, err := cryptutil.Decrypt(p.cipher, raw, []byte(purpose))
+	if err != nil {
+		return nil, fmt.Errorf("passkey: invalid %s: %w", purpose, err)
+	}
+	var v sealedUser
+	if err := json.Unmarshal(b, &v); err != nil || v.User == nil {
+		return nil, fmt.Errorf("passkey: invalid %s", purpose)
+	}
+	if v.Expiry != 0 && time.Now().Unix() > v.Expiry {
+		return nil, fmt.Errorf("passkey: expired %s", purpose)
+	}
+	return v.User, nil
+}
+
+// GenerateRecoveryCodes generates new recovery codes, along with the hashes
+// to store.
+func GenerateRecoveryCodes() (codes []string, hashes [][]byte, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code = code[:8] + "-" + code[8:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode returns the hashes without the hash of the given recovery
+// code, and false if the recovery code doesn't match any of the hashes.
+func UseRecoveryCode(hashes [][]byte, code string) ([][]byte, bool) {
+	h := hashRecoveryCode(code)
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare(hash, h) == 1 {
+			return append(hashes[:i:i], hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
+
+func hashRecoveryCode(code string) []byte {
+	code = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(code)), "-", "")
+	h := sha256.Sum256([]byte(code))
+	return h[:]
+}
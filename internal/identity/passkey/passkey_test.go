@@ -0,0 +1,76 @@
+package passkey
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	p, err := New(ctx, &oauth.Options{
+		ClientSecret:        "SECRET",
+		RedirectURL:         &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+		PasskeyAllowedUsers: []string{"Alice@Example.com"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, p.RegistrationEnabled())
+	assert.True(t, p.CanRegister(" alice@example.com"))
+	assert.False(t, p.CanRegister("bob@example.com"))
+	assert.False(t, p.CanRegister(""))
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	assert.Equal(t, "https://authenticate.example.com/oauth2/passkey?state=STATE", signInURL)
+
+	code, err := p.IssueCode(&User{ID: "alice@example.com", Name: "Alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	var claims testClaims
+	token, err := p.Authenticate(ctx, code, &claims)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", claims["sub"])
+	assert.Equal(t, "Alice", claims["name"])
+
+	claims = nil
+	_, err = p.Refresh(ctx, token, &claims)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", claims["email"])
+
+	_, err = p.Authenticate(ctx, token.AccessToken, &claims)
+	assert.Error(t, err, "an access token should not be redeemable as a code")
+
+	_, err = New(ctx, &oauth.Options{RedirectURL: &url.URL{}})
+	assert.Error(t, err, "should require a client secret")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Len(t, hashes, RecoveryCodeCount)
+
+	remaining, ok := UseRecoveryCode(hashes, " "+codes[3]+" ")
+	assert.True(t, ok)
+	assert.Len(t, remaining, RecoveryCodeCount-1)
+
+	_, ok = UseRecoveryCode(remaining, codes[3])
+	assert.False(t, ok, "recovery codes should only be usable once")
+
+	_, ok = UseRecoveryCode(hashes, "invalid")
+	assert.False(t, ok)
+}
+
+type testClaims map[string]any
+
+func (testClaims) SetRawIDToken(string) {}
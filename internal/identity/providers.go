@@ -9,26 +9,33 @@ import (
 
 	"golang.org/x/oauth2"
 
+	"github.com/pomerium/pomerium/internal/identity/clientcert"
 	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/kerberos"
+	"github.com/pomerium/pomerium/internal/identity/ldap"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/identity/oauth/apple"
+	"github.com/pomerium/pomerium/internal/identity/oauth/generic"
 	"github.com/pomerium/pomerium/internal/identity/oauth/github"
 	"github.com/pomerium/pomerium/internal/identity/oidc"
 	"github.com/pomerium/pomerium/internal/identity/oidc/auth0"
 	"github.com/pomerium/pomerium/internal/identity/oidc/azure"
 	"github.com/pomerium/pomerium/internal/identity/oidc/gitlab"
 	"github.com/pomerium/pomerium/internal/identity/oidc/google"
+	"github.com/pomerium/pomerium/internal/identity/oidc/keycloak"
 	"github.com/pomerium/pomerium/internal/identity/oidc/okta"
 	"github.com/pomerium/pomerium/internal/identity/oidc/onelogin"
 	"github.com/pomerium/pomerium/internal/identity/oidc/ping"
+	"github.com/pomerium/pomerium/internal/identity/passkey"
+	"github.com/pomerium/pomerium/internal/identity/saml"
 )
 
 // Authenticator is an interface representing the ability to authenticate with an identity provider.
 type Authenticator interface {
-	Authenticate(context.Context, string, identity.State) (*oauth2.Token, error)
+	Authenticate(context.Context, string, identity.State, ...oauth2.AuthCodeOption) (*oauth2.Token, error)
 	Refresh(context.Context, *oauth2.Token, identity.State) (*oauth2.Token, error)
 	Revoke(context.Context, *oauth2.Token) error
-	GetSignInURL(state string) (string, error)
+	GetSignInURL(state string, opts ...oauth2.AuthCodeOption) (string, error)
 	Name() string
 	LogOut() (*url.URL, error)
 	UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error
@@ -44,20 +51,34 @@ func NewAuthenticator(o oauth.Options) (a Authenticator, err error) {
 		a, err = auth0.New(ctx, &o)
 	case azure.Name:
 		a, err = azure.New(ctx, &o)
+	case clientcert.Name:
+		a, err = clientcert.New(ctx, &o)
 	case gitlab.Name:
 		a, err = gitlab.New(ctx, &o)
 	case github.Name:
 		a, err = github.New(ctx, &o)
+	case generic.Name:
+		a, err = generic.New(ctx, &o)
 	case google.Name:
 		a, err = google.New(ctx, &o)
+	case kerberos.Name:
+		a, err = kerberos.New(ctx, &o)
+	case keycloak.Name:
+		a, err = keycloak.New(ctx, &o)
+	case ldap.Name:
+		a, err = ldap.New(ctx, &o)
 	case oidc.Name:
 		a, err = oidc.New(ctx, &o)
 	case okta.Name:
 		a, err = okta.New(ctx, &o)
 	case onelogin.Name:
 		a, err = onelogin.New(ctx, &o)
+	case passkey.Name:
+		a, err = passkey.New(ctx, &o)
 	case ping.Name:
 		a, err = ping.New(ctx, &o)
+	case saml.Name:
+		a, err = saml.New(ctx, &o)
 	case "":
 		return nil, fmt.Errorf("identity: provider is not defined")
 	default:
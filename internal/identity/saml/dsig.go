@@ -0,0 +1,164 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	// hash functions used by signatures
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// XML signature namespace and algorithm identifiers.
+//
+// https://www.w3.org/TR/xmldsig-core1/
+const (
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA256             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA384             = "http://www.w3.org/2001/04/xmldsig-more#sha384"
+	algSHA512             = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA384          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384"
+	algRSASHA512          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256        = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algECDSASHA384        = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	algECDSASHA512        = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	algSHA256: crypto.SHA256,
+	algSHA384: crypto.SHA384,
+	algSHA512: crypto.SHA512,
+}
+
+var signatureAlgorithms = map[string]crypto.Hash{
+	algRSASHA256:   crypto.SHA256,
+	algRSASHA384:   crypto.SHA384,
+	algRSASHA512:   crypto.SHA512,
+	algECDSASHA256: crypto.SHA256,
+	algECDSASHA384: crypto.SHA384,
+	algECDSASHA512: crypto.SHA512,
+}
+
+// errNotSigned is returned when an element has no signature.
+var errNotSigned = errors.New("saml: element is not signed")
+
+// verifySignature verifies the enveloped signature of an element with one of
+// the trusted certificates. Only signatures with a single reference to the
+// element itself, using exclusive canonicalization, are accepted, so the
+// verified content is exactly the given element.
+func verifySignature(e *xmlElement, certs []*x509.Certificate) error {
+	sigs := e.elements(nsDSig, "Signature")
+	if len(sigs) == 0 {
+		return errNotSigned
+	} else if len(sigs) > 1 {
+		return errors.New("saml: element has multiple signatures")
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("saml: missing signed info")
+	}
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod.attr("Algorithm") != algExcC14N {
+		return fmt.Errorf("saml: unsupported canonicalization method: %s", c14nMethod.attr("Algorithm"))
+	}
+	signatureMethod := signedInfo.child(nsDSig, "SignatureMethod").attr("Algorithm")
+	hash, ok := signatureAlgorithms[signatureMethod]
+	if !ok {
+		return fmt.Errorf("saml: unsupported signature method: %s", signatureMethod)
+	}
+
+	refs := signedInfo.elements(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return errors.New("saml: signature must have exactly one reference")
+	}
+	ref := refs[0]
+	id := e.attr("ID")
+	if id == "" || ref.attr("URI") != "#"+id {
+		return errors.New("saml: signature does not reference the signed element")
+	}
+
+	var prefixes []string
+	var canonicalized bool
+	for _, transform := range ref.child(nsDSig, "Transforms").elements(nsDSig, "Transform") {
+		switch transform.attr("Algorithm") {
+		case algEnvelopedSignature:
+		case algExcC14N:
+			canonicalized = true
+			prefixes = getInclusivePrefixes(transform)
+		default:
+			return fmt.Errorf("saml: unsupported transform: %s", transform.attr("Algorithm"))
+		}
+	}
+	if !canonicalized {
+		return errors.New("saml: reference must use exclusive canonicalization")
+	}
+
+	digestMethod := ref.child(nsDSig, "DigestMethod").attr("Algorithm")
+	digestHash, ok := digestAlgorithms[digestMethod]
+	if !ok {
+		return fmt.Errorf("saml: unsupported digest method: %s", digestMethod)
+	}
+	digestValue, err := decodeBase64(ref.child(nsDSig, "DigestValue").text())
+	if err != nil {
+		return fmt.Errorf("saml: invalid digest value: %w", err)
+	}
+	h := digestHash.New()
+	h.Write(canonicalize(e, sig, prefixes))
+	if !hmac.Equal(h.Sum(nil), digestValue) {
+		return errors.New("saml: digest mismatch")
+	}
+
+	signatureValue, err := decodeBase64(sig.child(nsDSig, "SignatureValue").text())
+	if err != nil {
+		return fmt.Errorf("saml: invalid signature value: %w", err)
+	}
+	h = hash.New()
+	h.Write(canonicalize(signedInfo, nil, getInclusivePrefixes(c14nMethod)))
+	digest := h.Sum(nil)
+	for _, cert := range certs {
+		if verifyDigest(cert.PublicKey, hash, digest, signatureValue) {
+			return nil
+		}
+	}
+	return errors.New("saml: invalid signature")
+}
+
+func verifyDigest(key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// XML signatures encode ECDSA signatures as r || s
+		if len(signature) == 0 || len(signature)%2 != 0 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:len(signature)/2])
+		s := new(big.Int).SetBytes(signature[len(signature)/2:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+func getInclusivePrefixes(transform *xmlElement) []string {
+	// the exclusive canonicalization namespace is the algorithm identifier
+	return strings.Fields(transform.child(algExcC14N, "InclusiveNamespaces").attr("PrefixList"))
+}
+
+// decodeBase64 decodes base64 which may contain line breaks.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
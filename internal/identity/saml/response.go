@@ -0,0 +1,238 @@
+package saml
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// well known attribute names, mapped to claims
+var attributeClaims = map[string]string{
+	"email":        "email",
+	"mail":         "email",
+	"emailAddress": "email",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "email",
+	"urn:oid:0.9.2342.19200300.100.1.3":                                  "email",
+
+	"name":        "name",
+	"displayName": "name",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name": "name",
+	"http://schemas.microsoft.com/identity/claims/displayname":   "name",
+	"urn:oid:2.16.840.1.113730.3.1.241":                          "name",
+
+	"groups":   "groups",
+	"memberOf": "groups",
+	"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups": "groups",
+	"http://schemas.xmlsoap.org/claims/Group":                        "groups",
+	"urn:oid:1.3.6.1.4.1.5923.1.5.1.1":                               "groups",
+}
+
+// registered JWT claims are set by pomerium, so attributes with these names
+// are ignored
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+}
+
+// assertion is the information from a verified assertion.
+type assertion struct {
+	id                  string
+	notOnOrAfter        time.Time
+	nameID              string
+	nameIDFormat        string
+	sessionNotOnOrAfter time.Time
+	attributes          map[string][]string
+}
+
+// parseResponse parses and verifies a SAML response. The response must be in
+// response to the authentication request for the relay state.
+func (p *Provider) parseResponse(ctx context.Context, raw []byte, relayState string) (*assertion, error) {
+	idp, err := p.getIDPMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := parseXML(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !response.is(nsProtocol, "Response") {
+		return nil, errors.New("saml: expected a response")
+	}
+	if dst := response.attr("Destination"); dst != "" && dst != p.acsURL {
+		return nil, fmt.Errorf("saml: unexpected response destination: %s", dst)
+	}
+	// only SP-initiated SSO is supported
+	inResponseTo := response.attr("InResponseTo")
+	if inResponseTo == "" {
+		return nil, errors.New("saml: unsolicited responses are not supported")
+	}
+	if inResponseTo != requestID(relayState) {
+		return nil, errors.New("saml: response is not in response to the authentication request")
+	}
+	if issuer := response.child(nsAssertion, "Issuer"); issuer != nil && issuer.text() != idp.entityID {
+		return nil, fmt.Errorf("saml: unexpected response issuer: %s", issuer.text())
+	}
+	status := response.child(nsProtocol, "Status").child(nsProtocol, "StatusCode").attr("Value")
+	if status != statusSuccess {
+		return nil, fmt.Errorf("saml: authentication failed: %s", status)
+	}
+
+	if len(response.elements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("saml: encrypted assertions are not supported")
+	}
+	assertions := response.elements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("saml: response must contain exactly one assertion")
+	}
+	a := assertions[0]
+
+	// either the response or the assertion must be signed, and all the
+	// signatures must be valid
+	var signed bool
+	for _, e := range []*xmlElement{response, a} {
+		err := verifySignature(e, idp.certs)
+		if errors.Is(err, errNotSigned) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		signed = true
+	}
+	if !signed {
+		return nil, errNotSigned
+	}
+
+	return p.parseAssertion(a, idp, inResponseTo)
+}
+
+func (p *Provider) parseAssertion(a *xmlElement, idp *idpMetadata, inResponseTo string) (*assertion, error) {
+	now := time.Now()
+
+	id := a.attr("ID")
+	if id == "" {
+		return nil, errors.New("saml: assertion has no id")
+	}
+
+	if issuer := a.child(nsAssertion, "Issuer").text(); issuer != idp.entityID {
+		return nil, fmt.Errorf("saml: unexpected assertion issuer: %s", issuer)
+	}
+
+	subject := a.child(nsAssertion, "Subject")
+	nameID := subject.child(nsAssertion, "NameID")
+	if nameID.text() == "" {
+		return nil, errors.New("saml: assertion has no subject")
+	}
+
+	// https://docs.oasis-open.org/security/saml/v2.0/saml-profiles-2.0-os.pdf
+	// section 4.1.4.2
+	var confirmedUntil time.Time
+	for _, sc := range subject.elements(nsAssertion, "SubjectConfirmation") {
+		data := sc.child(nsAssertion, "SubjectConfirmationData")
+		if sc.attr("Method") != confirmationBearer ||
+			(data.attr("Recipient") != "" && data.attr("Recipient") != p.acsURL) ||
+			data.attr("InResponseTo") != inResponseTo ||
+			!isBefore(now, data.attr("NotOnOrAfter"), -maxClockSkew) {
+			continue
+		}
+		confirmedUntil, _ = time.Parse(time.RFC3339, data.attr("NotOnOrAfter"))
+		break
+	}
+	if confirmedUntil.IsZero() {
+		return nil, errors.New("saml: assertion has no valid bearer subject confirmation")
+	}
+
+	conditions := a.child(nsAssertion, "Conditions")
+	if notOnOrAfter := conditions.attr("NotOnOrAfter"); notOnOrAfter != "" && !isBefore(now, notOnOrAfter, -maxClockSkew) {
+		return nil, errors.New("saml: assertion expired")
+	}
+	if notBefore := conditions.attr("NotBefore"); notBefore != "" && isBefore(now, notBefore, maxClockSkew) {
+		return nil, errors.New("saml: assertion is not yet valid")
+	}
+	for _, restriction := range conditions.elements(nsAssertion, "AudienceRestriction") {
+		var ok bool
+		for _, audience := range restriction.elements(nsAssertion, "Audience") {
+			ok = ok || audience.text() == p.entityID
+		}
+		if !ok {
+			return nil, errors.New("saml: assertion is not intended for this service provider")
+		}
+	}
+
+	info := &assertion{
+		id:           id,
+		notOnOrAfter: confirmedUntil,
+		nameID:       nameID.text(),
+		nameIDFormat: nameID.attr("Format"),
+		attributes:   make(map[string][]string),
+	}
+	for _, statement := range a.elements(nsAssertion, "AuthnStatement") {
+		if t, err := time.Parse(time.RFC3339, statement.attr("SessionNotOnOrAfter")); err == nil {
+			info.sessionNotOnOrAfter = t
+		}
+	}
+	for _, statement := range a.elements(nsAssertion, "AttributeStatement") {
+		for _, attr := range statement.elements(nsAssertion, "Attribute") {
+			var values []string
+			for _, v := range attr.elements(nsAssertion, "AttributeValue") {
+				values = append(values, v.text())
+			}
+			info.attributes[attr.attr("Name")] = append(info.attributes[attr.attr("Name")], values...)
+			if friendlyName := attr.attr("FriendlyName"); friendlyName != "" {
+				info.attributes[friendlyName] = append(info.attributes[friendlyName], values...)
+			}
+		}
+	}
+	return info, nil
+}
+
+// claims fills v with the claims for the assertion. Attributes are added as
+// claims by name, and well known attributes are also mapped to the email,
+// name and groups claims.
+func (a *assertion) claims(v interface{}) error {
+	claims := make(map[string]interface{})
+	for name, values := range a.attributes {
+		if !reservedClaims[name] {
+			claims[name] = values
+		}
+	}
+	for name, values := range a.attributes {
+		claim, ok := attributeClaims[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if claim == "groups" {
+			claims[claim] = values
+		} else {
+			claims[claim] = values[0]
+		}
+	}
+	if _, ok := claims["email"]; !ok && a.nameIDFormat == nameIDFormatEmail {
+		claims["email"] = a.nameID
+	}
+
+	now := time.Now()
+	claims["sub"] = a.nameID
+	claims["user"] = a.nameID
+	claims["iat"] = jwt.NewNumericDate(now)
+	claims["nbf"] = jwt.NewNumericDate(now)
+	if !a.sessionNotOnOrAfter.IsZero() {
+		claims["exp"] = jwt.NewNumericDate(a.sessionNotOnOrAfter)
+	}
+
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// isBefore returns true if now, adjusted by skew, is before the timestamp. It
+// returns false for invalid timestamps.
+func isBefore(now time.Time, timestamp string, skew time.Duration) bool {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	return err == nil && now.Add(skew).Before(t)
+}
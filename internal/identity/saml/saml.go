@@ -0,0 +1,504 @@
+// Package saml implements a SAML 2.0 service provider for identity providers
+// which don't support OpenID Connect.
+//
+// Only SP-initiated SSO is supported: users are sent to the identity provider
+// with the HTTP-Redirect binding and the response is posted back to the
+// authenticate service's assertion consumer service. Responses must be signed,
+// unsolicited responses are rejected, each assertion can only be used once and
+// encrypted assertions are not supported.
+//
+// https://docs.oasis-open.org/security/saml/v2.0/saml-core-2.0-os.pdf
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/cipher"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/internal/version"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// Name identifies the SAML identity provider.
+const Name = "saml"
+
+// Paths of the service provider endpoints served by the authenticate service.
+const (
+	ACSPath      = "/oauth2/saml/acs"
+	MetadataPath = "/oauth2/saml/metadata"
+)
+
+// SAML namespaces and identifiers.
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDFormatEmail   = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// Purposes for which an assertion can be used once: the response posted to
+// the assertion consumer service, and the code it is exchanged for.
+const (
+	purposeResponse = "saml response"
+	purposeCode     = "saml code"
+)
+
+const (
+	// allowed difference between our clock and the identity provider's
+	maxClockSkew = 2 * time.Minute
+	// maximum size of metadata and responses
+	maxDocumentSize = 10 << 20
+	// how long a code can be redeemed for
+	codeTTL = time.Minute
+	// prefix of the databroker leases which mark assertions as used
+	assertionLeasePrefix = "pomerium/saml-assertion/"
+)
+
+// CodeOptions are the options used to issue and redeem codes.
+type CodeOptions struct {
+	// Cipher seals codes, so that they can't be read or forged.
+	Cipher cipher.AEAD
+	// DataBrokerClient records the ids of used assertions, so that each
+	// assertion is only accepted once by any instance of the authenticate
+	// service.
+	DataBrokerClient databroker.DataBrokerServiceClient
+}
+
+// Provider is a SAML 2.0 service provider.
+type Provider struct {
+	metadataURL string
+	entityID    string
+	acsURL      string
+	redirectURL *url.URL
+
+	mu  sync.Mutex
+	idp *idpMetadata
+}
+
+type idpMetadata struct {
+	entityID string
+	ssoURL   string
+	certs    []*x509.Certificate
+}
+
+// New creates a new SAML service provider. The provider url is the url of the
+// identity provider's metadata. The client id is the service provider's
+// entity id, which defaults to the url of its metadata.
+func New(_ context.Context, o *oauth.Options) (*Provider, error) {
+	if o.ProviderURL == "" {
+		return nil, oidc.ErrMissingProviderURL
+	}
+	if o.RedirectURL == nil {
+		return nil, errors.New("saml: redirect url is required")
+	}
+
+	p := &Provider{
+		metadataURL: o.ProviderURL,
+		entityID:    o.ClientID,
+		redirectURL: o.RedirectURL,
+	}
+	acsURL := *o.RedirectURL
+	acsURL.Path, acsURL.RawQuery = ACSPath, ""
+	p.acsURL = acsURL.String()
+	if p.entityID == "" {
+		metadataURL := *o.RedirectURL
+		metadataURL.Path, metadataURL.RawQuery = MetadataPath, ""
+		p.entityID = metadataURL.String()
+	}
+	return p, nil
+}
+
+// Authenticate is not supported, since codes are bound to the relay state of
+// the authentication request. Use Redeem instead.
+func (p *Provider) Authenticate(_ context.Context, _ string, _ identity.State, _ ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	return nil, errors.New("saml: codes must be redeemed with the relay state")
+}
+
+// Redeem redeems a code returned by NewCode for the same relay state. Each
+// code can only be redeemed once.
+func (p *Provider) Redeem(ctx context.Context, o *CodeOptions, code, relayState string, v identity.State) (*oauth2.Token, error) {
+	a, err := openCode(o.Cipher, code, relayState, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ok, err := p.claim(ctx, o.DataBrokerClient, purposeCode, a.id, codeTTL+maxClockSkew)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("saml: code was already used")
+	}
+	if err := a.claims(v); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{Expiry: a.sessionNotOnOrAfter}, nil
+}
+
+// Refresh can't refresh SAML sessions, so it only checks that the session
+// hasn't expired.
+func (p *Provider) Refresh(_ context.Context, t *oauth2.Token, _ identity.State) (*oauth2.Token, error) {
+	if t == nil {
+		return nil, oidc.ErrMissingAccessToken
+	}
+	if !t.Expiry.IsZero() && time.Now().After(t.Expiry) {
+		return nil, errors.New("saml: session expired")
+	}
+	return t, nil
+}
+
+// UpdateUserInfo does nothing, since the claims are only available in the
+// SAML response.
+func (p *Provider) UpdateUserInfo(_ context.Context, _ *oauth2.Token, _ interface{}) error {
+	return nil
+}
+
+// Revoke is not implemented by SAML.
+func (p *Provider) Revoke(_ context.Context, _ *oauth2.Token) error {
+	return oidc.ErrRevokeNotImplemented
+}
+
+// LogOut is not implemented by SAML.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// GetSignInURL returns the URL of the identity provider's single sign on
+// service with an authentication request. The state is used as the relay
+// state and to derive the request id.
+func (p *Provider) GetSignInURL(state string, _ ...oauth2.AuthCodeOption) (string, error) {
+	idp, err := p.getIDPMetadata(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	type issuer struct {
+		XMLName xml.Name `xml:"saml:Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+	type nameIDPolicy struct {
+		XMLName     xml.Name `xml:"samlp:NameIDPolicy"`
+		AllowCreate bool     `xml:"AllowCreate,attr"`
+	}
+	req := struct {
+		XMLName                     xml.Name `xml:"samlp:AuthnRequest"`
+		XMLNSSAMLP                  string   `xml:"xmlns:samlp,attr"`
+		XMLNSSAML                   string   `xml:"xmlns:saml,attr"`
+		ID                          string   `xml:"ID,attr"`
+		Version                     string   `xml:"Version,attr"`
+		IssueInstant                string   `xml:"IssueInstant,attr"`
+		Destination                 string   `xml:"Destination,attr"`
+		AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+		ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+		Issuer                      issuer
+		NameIDPolicy                nameIDPolicy
+	}{
+		XMLNSSAMLP:                  nsProtocol,
+		XMLNSSAML:                   nsAssertion,
+		ID:                          requestID(state),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 idp.ssoURL,
+		AssertionConsumerServiceURL: p.acsURL,
+		ProtocolBinding:             bindingHTTPPost,
+		Issuer:                      issuer{Value: p.entityID},
+		NameIDPolicy:                nameIDPolicy{AllowCreate: true},
+	}
+	raw, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	// https://docs.oasis-open.org/security/saml/v2.0/saml-bindings-2.0-os.pdf
+	// section 3.4.4.1
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = w.Write(raw)
+	_ = w.Close()
+
+	u, err := url.Parse(idp.ssoURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	q.Set("RelayState", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// NewCode verifies a SAML response posted to the assertion consumer service
+// in response to the request created by GetSignInURL for the relay state. It
+// returns a code, sealed and bound to the relay state, which can be redeemed
+// with Redeem.
+func (p *Provider) NewCode(ctx context.Context, o *CodeOptions, samlResponse, relayState string) (string, error) {
+	if relayState == "" {
+		return "", errors.New("saml: relay state is required")
+	}
+	raw, err := decodeBase64(samlResponse)
+	if err != nil {
+		return "", fmt.Errorf("saml: invalid response encoding: %w", err)
+	}
+	a, err := p.parseResponse(ctx, raw, relayState)
+	if err != nil {
+		return "", err
+	}
+
+	// assertions are remembered until their bearer subject confirmation
+	// expires, after which they are rejected anyway
+	ok, err := p.claim(ctx, o.DataBrokerClient, purposeResponse, a.id, time.Until(a.notOnOrAfter.Add(maxClockSkew)))
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", errors.New("saml: replayed assertion")
+	}
+
+	return sealCode(o.Cipher, a, relayState, time.Now())
+}
+
+// Metadata returns the service provider's metadata.
+func (p *Provider) Metadata() ([]byte, error) {
+	type acs struct {
+		Binding  string `xml:"Binding,attr"`
+		Location string `xml:"Location,attr"`
+		Index    int    `xml:"index,attr"`
+	}
+	md := struct {
+		XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+		EntityID string   `xml:"entityID,attr"`
+		SP       struct {
+			AuthnRequestsSigned        bool   `xml:"AuthnRequestsSigned,attr"`
+			WantAssertionsSigned       bool   `xml:"WantAssertionsSigned,attr"`
+			ProtocolSupportEnumeration string `xml:"protocolSupportEnumeration,attr"`
+			AssertionConsumerService   acs
+		} `xml:"SPSSODescriptor"`
+	}{EntityID: p.entityID}
+	md.SP.WantAssertionsSigned = true
+	md.SP.ProtocolSupportEnumeration = nsProtocol
+	md.SP.AssertionConsumerService = acs{Binding: bindingHTTPPost, Location: p.acsURL}
+
+	b, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (p *Provider) getIDPMetadata(ctx context.Context) (*idpMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idp != nil {
+		return p.idp, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("saml: invalid metadata url: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("saml: error fetching identity provider metadata: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("saml: error fetching identity provider metadata: %s", res.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(res.Body, maxDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("saml: error fetching identity provider metadata: %w", err)
+	}
+
+	idp, err := parseIDPMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+	p.idp = idp
+	return idp, nil
+}
+
+func parseIDPMetadata(raw []byte) (*idpMetadata, error) {
+	root, err := parseXML(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// use the first entity with an identity provider descriptor
+	entities := []*xmlElement{root}
+	if root.is(nsMetadata, "EntitiesDescriptor") {
+		entities = root.elements(nsMetadata, "EntityDescriptor")
+	}
+	for _, entity := range entities {
+		descriptor := entity.child(nsMetadata, "IDPSSODescriptor")
+		if !entity.is(nsMetadata, "EntityDescriptor") || descriptor == nil {
+			continue
+		}
+
+		idp := &idpMetadata{entityID: entity.attr("entityID")}
+		for _, sso := range descriptor.elements(nsMetadata, "SingleSignOnService") {
+			if sso.attr("Binding") == bindingHTTPRedirect {
+				idp.ssoURL = sso.attr("Location")
+				break
+			}
+		}
+		for _, kd := range descriptor.elements(nsMetadata, "KeyDescriptor") {
+			if use := kd.attr("use"); use != "" && use != "signing" {
+				continue
+			}
+			data := kd.child(nsDSig, "KeyInfo").child(nsDSig, "X509Data")
+			for _, c := range data.elements(nsDSig, "X509Certificate") {
+				der, err := decodeBase64(c.text())
+				if err != nil {
+					return nil, fmt.Errorf("saml: invalid identity provider certificate: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("saml: invalid identity provider certificate: %w", err)
+				}
+				idp.certs = append(idp.certs, cert)
+			}
+		}
+
+		switch {
+		case idp.entityID == "":
+			return nil, errors.New("saml: identity provider metadata is missing the entity id")
+		case idp.ssoURL == "":
+			return nil, errors.New("saml: identity provider doesn't support the HTTP-Redirect binding")
+		case len(idp.certs) == 0:
+			return nil, errors.New("saml: identity provider metadata has no signing certificates")
+		}
+		return idp, nil
+	}
+	return nil, errors.New("saml: no identity provider found in metadata")
+}
+
+// requestID derives the id of an authentication request from the relay state,
+// so responses can be matched to requests without storing them.
+func requestID(state string) string {
+	return "id-" + hex.EncodeToString(cryptutil.Hash("saml request id", []byte(state)))
+}
+
+// claim marks the assertion as used for the purpose, for the ttl, and
+// returns false if it was already used. Assertions are claimed with a
+// databroker lease, which the databroker grants to a single client.
+func (p *Provider) claim(ctx context.Context, client databroker.DataBrokerServiceClient, purpose, id string, ttl time.Duration) (bool, error) {
+	if client == nil {
+		return false, errors.New("saml: databroker client is required")
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	key := cryptutil.Hash(purpose, []byte(p.entityID+"|"+id))
+	_, err := client.AcquireLease(ctx, &databroker.AcquireLeaseRequest{
+		Name:     assertionLeasePrefix + hex.EncodeToString(key),
+		Duration: durationpb.New(ttl),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("saml: error recording used assertion: %w", err)
+	}
+	return true, nil
+}
+
+// A sealedCode is the verified assertion carried by a code.
+type sealedCode struct {
+	ID                  string              `json:"id"`
+	NameID              string              `json:"name_id"`
+	NameIDFormat        string              `json:"name_id_format,omitempty"`
+	SessionNotOnOrAfter int64               `json:"session_not_on_or_after,omitempty"`
+	Attributes          map[string][]string `json:"attributes,omitempty"`
+	Expiry              int64               `json:"exp"`
+}
+
+// sealCode seals the assertion in a code. The request id of the relay state
+// is used as additional data, so the code can only be opened for the same
+// authentication request.
+func sealCode(c cipher.AEAD, a *assertion, relayState string, now time.Time) (string, error) {
+	if c == nil {
+		return "", errors.New("saml: cipher is required")
+	}
+	v := sealedCode{
+		ID:           a.id,
+		NameID:       a.nameID,
+		NameIDFormat: a.nameIDFormat,
+		Attributes:   a.attributes,
+		Expiry:       now.Add(codeTTL).Unix(),
+	}
+	if !a.sessionNotOnOrAfter.IsZero() {
+		v.SessionNotOnOrAfter = a.sessionNotOnOrAfter.Unix()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cryptutil.Encrypt(c, b, codeAdditionalData(relayState))), nil
+}
+
+// openCode opens a code sealed for the relay state.
+func openCode(c cipher.AEAD, code, relayState string, now time.Time) (*assertion, error) {
+	if c == nil {
+		return nil, errors.New("saml: cipher is required")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(code)
+	if err != nil {
+		return nil, fmt.Errorf("saml: invalid code: %w", err)
+	}
+	b, err := cryptutil.Decrypt(c, raw, codeAdditionalData(relayState))
+	if err != nil {
+		return nil, fmt.Errorf("saml: invalid code: %w", err)
+	}
+	var v sealedCode
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("saml: invalid code: %w", err)
+	}
+	if now.Unix() > v.Expiry {
+		return nil, errors.New("saml: expired code")
+	}
+
+	a := &assertion{
+		id:           v.ID,
+		nameID:       v.NameID,
+		nameIDFormat: v.NameIDFormat,
+		attributes:   v.Attributes,
+	}
+	if v.SessionNotOnOrAfter != 0 {
+		a.sessionNotOnOrAfter = time.Unix(v.SessionNotOnOrAfter, 0)
+	}
+	return a, nil
+}
+
+func codeAdditionalData(relayState string) []byte {
+	return []byte(purposeCode + "|" + requestID(relayState))
+}
@@ -0,0 +1,389 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Parallel()
+
+	// https://www.w3.org/TR/xml-exc-c14n/#sec-Enveloping
+	root, err := parseXML([]byte(`<n0:pdu xmlns:n0="http://a.example"><n1:elem1 xmlns:n1="http://b.example" xmlns:n2="http://c.example">content</n1:elem1></n0:pdu>`))
+	require.NoError(t, err)
+	elem1 := root.children[0].(*xmlElement)
+	assert.Equal(t, `<n1:elem1 xmlns:n1="http://b.example">content</n1:elem1>`,
+		string(canonicalize(elem1, nil, nil)))
+	assert.Equal(t, `<n1:elem1 xmlns:n1="http://b.example" xmlns:n2="http://c.example">content</n1:elem1>`,
+		string(canonicalize(elem1, nil, []string{"n2"})))
+
+	root, err = parseXML([]byte(`<?xml version="1.0"?>
+<a xmlns="urn:a" xmlns:b="urn:b" z="1" b:y="2" a="&quot;&#x9;"><!-- comment --><b:c/><d xmlns="">x &gt; y &amp;&#13;</d></a>`))
+	require.NoError(t, err)
+	assert.Equal(t, `<a xmlns="urn:a" xmlns:b="urn:b" a="&quot;&#x9;" z="1" b:y="2"><b:c></b:c><d xmlns="">x &gt; y &amp;&#xD;</d></a>`,
+		string(canonicalize(root, nil, nil)))
+
+	for _, invalid := range []string{
+		`<!DOCTYPE a [<!ENTITY b "c">]><a>&b;</a>`,
+		`<a:b/>`,
+		`<a></b>`,
+		`<a/><b/>`,
+	} {
+		_, err := parseXML([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	key, cert := newTestCertificate(t)
+	otherKey, _ := newTestCertificate(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="encryption"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>invalid</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>
+      %s
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso?app=1"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, base64.StdEncoding.EncodeToString(cert.Raw))
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := New(context.Background(), &oauth.Options{
+		ProviderName: Name,
+		ProviderURL:  srv.URL,
+		RedirectURL:  &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+	})
+	require.NoError(t, err)
+
+	codeCipher, err := cryptutil.NewAEADCipher(cryptutil.NewKey())
+	require.NoError(t, err)
+	codeOptions := &CodeOptions{
+		Cipher:           codeCipher,
+		DataBrokerClient: newMockDataBrokerClient(),
+	}
+
+	t.Run("sign in url", func(t *testing.T) {
+		signInURL, err := p.GetSignInURL("STATE")
+		require.NoError(t, err)
+		u, err := url.Parse(signInURL)
+		require.NoError(t, err)
+		assert.Equal(t, "idp.example.com", u.Host)
+		assert.Equal(t, "1", u.Query().Get("app"))
+		assert.Equal(t, "STATE", u.Query().Get("RelayState"))
+
+		compressed, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+		require.NoError(t, err)
+		raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		require.NoError(t, err)
+		req, err := parseXML(raw)
+		require.NoError(t, err)
+		assert.True(t, req.is(nsProtocol, "AuthnRequest"))
+		assert.Equal(t, requestID("STATE"), req.attr("ID"))
+		assert.Equal(t, "https://authenticate.example.com/oauth2/saml/acs", req.attr("AssertionConsumerServiceURL"))
+		assert.Equal(t, "https://authenticate.example.com/oauth2/saml/metadata", req.child(nsAssertion, "Issuer").text())
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		metadata, err := p.Metadata()
+		require.NoError(t, err)
+		md, err := parseXML(metadata)
+		require.NoError(t, err)
+		assert.Equal(t, "https://authenticate.example.com/oauth2/saml/metadata", md.attr("entityID"))
+		assert.Equal(t, "https://authenticate.example.com/oauth2/saml/acs",
+			md.child(nsMetadata, "SPSSODescriptor").child(nsMetadata, "AssertionConsumerService").attr("Location"))
+	})
+
+	type responseOptions struct {
+		assertionID                    string
+		inResponseTo, audience, nameID string
+		notOnOrAfter                   time.Time
+		signResponse, signAssertion    bool
+		unsolicited                    bool
+		key                            *rsa.PrivateKey
+	}
+	var assertions int
+	newResponse := func(o responseOptions) string {
+		if o.assertionID == "" {
+			assertions++
+			o.assertionID = fmt.Sprintf("assertion%d", assertions)
+		}
+		if o.inResponseTo == "" && !o.unsolicited {
+			o.inResponseTo = requestID("STATE")
+		}
+		if o.audience == "" {
+			o.audience = p.entityID
+		}
+		if o.nameID == "" {
+			o.nameID = "user@example.com"
+		}
+		if o.notOnOrAfter.IsZero() {
+			o.notOnOrAfter = time.Now().Add(5 * time.Minute)
+		}
+		if o.key == nil {
+			o.key = key
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		notOnOrAfter := o.notOnOrAfter.UTC().Format(time.RFC3339)
+		doc := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="response1" Version="2.0" IssueInstant="` + now + `" Destination="https://authenticate.example.com/oauth2/saml/acs" InResponseTo="` + o.inResponseTo + `">
+  <saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">https://idp.example.com</saml:Issuer><!--sig:response1-->
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  <saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="` + o.assertionID + `" Version="2.0" IssueInstant="` + now + `">
+    <saml:Issuer>https://idp.example.com</saml:Issuer><!--sig:` + o.assertionID + `-->
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">` + o.nameID + `</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="` + o.inResponseTo + `" NotOnOrAfter="` + notOnOrAfter + `" Recipient="https://authenticate.example.com/oauth2/saml/acs"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="` + now + `" NotOnOrAfter="` + notOnOrAfter + `">
+      <saml:AudienceRestriction><saml:Audience>` + o.audience + `</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AuthnStatement AuthnInstant="` + now + `" SessionNotOnOrAfter="2100-01-01T00:00:00Z"/>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name"><saml:AttributeValue>User</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="urn:oid:1.3.6.1.4.1.5923.1.5.1.1" FriendlyName="isMemberOf"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>devs</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="exp"><saml:AttributeValue>never</saml:AttributeValue></saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+		if o.signAssertion {
+			doc = signTestDocument(t, o.key, doc, o.assertionID)
+		}
+		if o.signResponse {
+			doc = signTestDocument(t, o.key, doc, "response1")
+		}
+		return base64.StdEncoding.EncodeToString([]byte(doc))
+	}
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		responseOptions
+	}{
+		{"signed assertion", responseOptions{signAssertion: true}},
+		{"signed response", responseOptions{signResponse: true}},
+		{"both signed", responseOptions{signAssertion: true, signResponse: true}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := p.NewCode(ctx, codeOptions, newResponse(tc.responseOptions), "STATE")
+			require.NoError(t, err)
+			assert.NotContains(t, code, "user", "should seal the code")
+
+			var claims testClaims
+			token, err := p.Redeem(ctx, codeOptions, code, "STATE", &claims)
+			require.NoError(t, err)
+			assert.Equal(t, "user@example.com", claims["sub"])
+			assert.Equal(t, "user@example.com", claims["email"])
+			assert.Equal(t, "User", claims["name"])
+			assert.Equal(t, []any{"admins", "devs"}, claims["groups"])
+			assert.Equal(t, []any{"admins", "devs"}, claims["isMemberOf"])
+			assert.Equal(t, float64(4102444800), claims["exp"], "should ignore attributes named like registered claims")
+			assert.Equal(t, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), token.Expiry.UTC())
+
+			_, err = p.Refresh(ctx, token, &claims)
+			assert.NoError(t, err)
+		})
+	}
+
+	for _, tc := range []struct {
+		name       string
+		response   string
+		relayState string
+	}{
+		{"unsigned", newResponse(responseOptions{}), "STATE"},
+		{"wrong key", newResponse(responseOptions{signAssertion: true, key: otherKey}), "STATE"},
+		{"wrong request", newResponse(responseOptions{signAssertion: true}), "OTHER"},
+		{"wrong audience", newResponse(responseOptions{signAssertion: true, audience: "https://other.example.com"}), "STATE"},
+		{"expired", newResponse(responseOptions{signAssertion: true, notOnOrAfter: time.Now().Add(-time.Hour)}), "STATE"},
+		{"unsolicited", newResponse(responseOptions{signAssertion: true, unsolicited: true}), "STATE"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := p.NewCode(ctx, codeOptions, tc.response, tc.relayState)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("replayed", func(t *testing.T) {
+		response := newResponse(responseOptions{signAssertion: true})
+		code, err := p.NewCode(ctx, codeOptions, response, "STATE")
+		require.NoError(t, err)
+		_, err = p.NewCode(ctx, codeOptions, response, "STATE")
+		assert.ErrorContains(t, err, "replayed assertion")
+
+		var claims testClaims
+		_, err = p.Redeem(ctx, codeOptions, code, "STATE", &claims)
+		require.NoError(t, err)
+		_, err = p.Redeem(ctx, codeOptions, code, "STATE", &claims)
+		assert.ErrorContains(t, err, "code was already used")
+	})
+
+	t.Run("code for another request", func(t *testing.T) {
+		code, err := p.NewCode(ctx, codeOptions, newResponse(responseOptions{signAssertion: true}), "STATE")
+		require.NoError(t, err)
+
+		var claims testClaims
+		_, err = p.Redeem(ctx, codeOptions, code, "OTHER", &claims)
+		assert.ErrorContains(t, err, "invalid code")
+		_, err = p.Authenticate(ctx, code, &claims)
+		assert.Error(t, err, "should require the relay state")
+	})
+
+	t.Run("raw response as code", func(t *testing.T) {
+		raw, err := base64.StdEncoding.DecodeString(newResponse(responseOptions{signAssertion: true}))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		_, _ = w.Write(raw)
+		_ = w.Close()
+
+		var claims testClaims
+		_, err = p.Redeem(ctx, codeOptions, base64.RawURLEncoding.EncodeToString(buf.Bytes()), "STATE", &claims)
+		assert.ErrorContains(t, err, "invalid code")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		raw, err := base64.StdEncoding.DecodeString(newResponse(responseOptions{signAssertion: true}))
+		require.NoError(t, err)
+		tampered := strings.Replace(string(raw), ">user@example.com<", ">admin@example.com<", 1)
+		_, err = p.NewCode(ctx, codeOptions, base64.StdEncoding.EncodeToString([]byte(tampered)), "STATE")
+		assert.ErrorContains(t, err, "digest mismatch")
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		// a signed assertion moved out of the way of an unsigned one
+		raw, err := base64.StdEncoding.DecodeString(newResponse(responseOptions{signAssertion: true, assertionID: "assertion1"}))
+		require.NoError(t, err)
+		doc := string(raw)
+		start, end := strings.Index(doc, "<saml:Assertion"), strings.Index(doc, "</saml:Assertion>")+len("</saml:Assertion>")
+		signed := doc[start:end]
+		evil := strings.Replace(signed, `ID="assertion1"`, `ID="evil"`, 1)
+		evil = strings.Replace(evil, ">user@example.com<", ">admin@example.com<", 1)
+		doc = doc[:start] + `<samlp:Extensions>` + signed + `</samlp:Extensions>` + evil + doc[end:]
+		_, err = p.NewCode(ctx, codeOptions, base64.StdEncoding.EncodeToString([]byte(doc)), "STATE")
+		assert.Error(t, err)
+	})
+}
+
+type testClaims map[string]any
+
+type mockDataBrokerClient struct {
+	databroker.DataBrokerServiceClient
+
+	mu     sync.Mutex
+	leases map[string]struct{}
+}
+
+func newMockDataBrokerClient() *mockDataBrokerClient {
+	return &mockDataBrokerClient{leases: make(map[string]struct{})}
+}
+
+func (m *mockDataBrokerClient) AcquireLease(_ context.Context, in *databroker.AcquireLeaseRequest, _ ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.leases[in.GetName()]; ok {
+		return nil, status.Error(codes.AlreadyExists, "lease is already taken")
+	}
+	m.leases[in.GetName()] = struct{}{}
+	return &databroker.AcquireLeaseResponse{Id: in.GetName()}, nil
+}
+
+func (testClaims) SetRawIDToken(string) {}
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+// signTestDocument signs the element with the id, replacing the <!--sig:ID-->
+// placeholder with the signature.
+func signTestDocument(t *testing.T, key *rsa.PrivateKey, doc, id string) string {
+	root, err := parseXML([]byte(doc))
+	require.NoError(t, err)
+	e := findTestElement(root, id)
+	require.NotNil(t, e)
+
+	digest := sha256.Sum256(canonicalize(e, nil, nil))
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`</ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo>`
+	si, err := parseXML([]byte(signedInfo))
+	require.NoError(t, err)
+	h := sha256.Sum256(canonicalize(si, nil, nil))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	require.NoError(t, err)
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		strings.Replace(signedInfo, ` xmlns:ds="http://www.w3.org/2000/09/xmldsig#"`, "", 1) +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sig) + `</ds:SignatureValue>` +
+		`</ds:Signature>`
+	return strings.Replace(doc, "<!--sig:"+id+"-->", signature, 1)
+}
+
+func findTestElement(e *xmlElement, id string) *xmlElement {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, c := range e.children {
+		if c, ok := c.(*xmlElement); ok {
+			if found := findTestElement(c, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const nsXML = "http://www.w3.org/XML/1998/namespace"
+
+// maxElementDepth limits the nesting of parsed documents.
+const maxElementDepth = 64
+
+// xmlElement is an element of a parsed XML document. Unlike encoding/xml,
+// namespace prefixes and declarations are preserved so the element can be
+// canonicalized.
+type xmlElement struct {
+	prefix   string
+	local    string
+	attrs    []xml.Attr // Name.Space is the prefix
+	children []any      // *xmlElement, xml.CharData or xml.ProcInst
+	parent   *xmlElement
+}
+
+// parseXML parses an XML document. Comments are dropped and DTDs are
+// rejected.
+func parseXML(data []byte) (*xmlElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+
+	var root, current *xmlElement
+	depth := 0
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("saml: invalid xml: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("saml: invalid xml: multiple root elements")
+			}
+			depth++
+			if depth > maxElementDepth {
+				return nil, errors.New("saml: invalid xml: too deeply nested")
+			}
+			e := &xmlElement{
+				prefix: tok.Name.Space,
+				local:  tok.Name.Local,
+				attrs:  tok.Copy().Attr,
+				parent: current,
+			}
+			if current == nil {
+				root = e
+			} else {
+				current.children = append(current.children, e)
+			}
+			current = e
+		case xml.EndElement:
+			if current == nil || current.prefix != tok.Name.Space || current.local != tok.Name.Local {
+				return nil, errors.New("saml: invalid xml: mismatched end element")
+			}
+			depth--
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, tok.Copy())
+			}
+		case xml.ProcInst:
+			if current != nil {
+				current.children = append(current.children, tok.Copy())
+			}
+		case xml.Directive:
+			return nil, errors.New("saml: invalid xml: DTDs are not supported")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("saml: invalid xml: missing root element")
+	}
+	if err := root.checkNamespaces(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// checkNamespaces verifies that all the prefixes used in the tree are bound.
+func (e *xmlElement) checkNamespaces() error {
+	if _, ok := e.lookupNamespace(e.prefix); !ok && e.prefix != "" {
+		return fmt.Errorf("saml: invalid xml: unbound prefix %s", e.prefix)
+	}
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "" || attr.Name.Space == "xmlns" {
+			continue
+		}
+		if _, ok := e.lookupNamespace(attr.Name.Space); !ok {
+			return fmt.Errorf("saml: invalid xml: unbound prefix %s", attr.Name.Space)
+		}
+	}
+	for _, c := range e.children {
+		if c, ok := c.(*xmlElement); ok {
+			if err := c.checkNamespaces(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupNamespace returns the namespace bound to the prefix in the scope of
+// the element. The empty prefix is the default namespace.
+func (e *xmlElement) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, attr := range el.attrs {
+			if (prefix == "" && attr.Name.Space == "" && attr.Name.Local == "xmlns") ||
+				(prefix != "" && attr.Name.Space == "xmlns" && attr.Name.Local == prefix) {
+				return attr.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// is returns true if the element has the given namespace and local name.
+func (e *xmlElement) is(space, local string) bool {
+	if e == nil || e.local != local {
+		return false
+	}
+	ns, _ := e.lookupNamespace(e.prefix)
+	return ns == space
+}
+
+// child returns the first child element with the given name, or nil.
+func (e *xmlElement) child(space, local string) *xmlElement {
+	for _, c := range e.elements(space, local) {
+		return c
+	}
+	return nil
+}
+
+// elements returns the child elements with the given name.
+func (e *xmlElement) elements(space, local string) []*xmlElement {
+	if e == nil {
+		return nil
+	}
+	var els []*xmlElement
+	for _, c := range e.children {
+		if c, ok := c.(*xmlElement); ok && c.is(space, local) {
+			els = append(els, c)
+		}
+	}
+	return els
+}
+
+// attr returns the value of an unqualified attribute.
+func (e *xmlElement) attr(local string) string {
+	if e == nil {
+		return ""
+	}
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// text returns the character data of the element.
+func (e *xmlElement) text() string {
+	if e == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, c := range e.children {
+		if c, ok := c.(xml.CharData); ok {
+			sb.Write(c)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// canonicalize returns the exclusive XML canonicalization (without comments)
+// of the element, omitting the excluded element. Prefixes in the inclusive
+// list are treated as in inclusive canonicalization, "#default" being the
+// default namespace.
+//
+// https://www.w3.org/TR/xml-exc-c14n/
+func canonicalize(e, exclude *xmlElement, inclusivePrefixes []string) []byte {
+	c := &canonicalizer{exclude: exclude, inclusive: make(map[string]bool)}
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		c.inclusive[prefix] = true
+	}
+	c.element(e, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf       bytes.Buffer
+	exclude   *xmlElement
+	inclusive map[string]bool
+}
+
+func (c *canonicalizer) element(e *xmlElement, rendered map[string]string) {
+	// namespaces which are visibly utilized by the element or explicitly
+	// included
+	prefixes := map[string]bool{e.prefix: true}
+	for _, attr := range e.attrs {
+		if attr.Name.Space != "" && attr.Name.Space != "xmlns" && attr.Name.Space != "xml" {
+			prefixes[attr.Name.Space] = true
+		}
+	}
+	for prefix := range c.inclusive {
+		if _, ok := e.lookupNamespace(prefix); ok {
+			prefixes[prefix] = true
+		}
+	}
+
+	var decls []xml.Attr
+	scope := make(map[string]string, len(rendered))
+	for k, v := range rendered {
+		scope[k] = v
+	}
+	for prefix := range prefixes {
+		uri, _ := e.lookupNamespace(prefix)
+		if prev, ok := rendered[prefix]; ok && prev == uri {
+			continue
+		} else if !ok && uri == "" {
+			// an empty default namespace only needs to be rendered to
+			// undeclare a rendered one
+			continue
+		}
+		decls = append(decls, xml.Attr{Name: xml.Name{Local: prefix}, Value: uri})
+		scope[prefix] = uri
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Name.Local < decls[j].Name.Local })
+
+	type attribute struct {
+		space, local, qname, value string
+	}
+	var attrs []attribute
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		a := attribute{qname: attr.Name.Local, local: attr.Name.Local, value: attr.Value}
+		if attr.Name.Space != "" {
+			a.space, _ = e.lookupNamespace(attr.Name.Space)
+			a.qname = attr.Name.Space + ":" + attr.Name.Local
+		}
+		attrs = append(attrs, a)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	name := e.local
+	if e.prefix != "" {
+		name = e.prefix + ":" + e.local
+	}
+	c.buf.WriteString("<" + name)
+	for _, decl := range decls {
+		if decl.Name.Local == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(` xmlns:` + decl.Name.Local + `="`)
+		}
+		c.attrValue(decl.Value)
+		c.buf.WriteString(`"`)
+	}
+	for _, attr := range attrs {
+		c.buf.WriteString(" " + attr.qname + `="`)
+		c.attrValue(attr.value)
+		c.buf.WriteString(`"`)
+	}
+	c.buf.WriteString(">")
+
+	for _, child := range e.children {
+		switch child := child.(type) {
+		case *xmlElement:
+			if child != c.exclude {
+				c.element(child, scope)
+			}
+		case xml.CharData:
+			c.text(string(child))
+		case xml.ProcInst:
+			c.buf.WriteString("<?" + child.Target)
+			if len(child.Inst) > 0 {
+				c.buf.WriteString(" ")
+				c.buf.Write(child.Inst)
+			}
+			c.buf.WriteString("?>")
+		}
+	}
+	c.buf.WriteString("</" + name + ">")
+}
+
+var (
+	c14nTextReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		"\r", "&#xD;",
+	)
+	c14nAttrReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"\t", "&#x9;",
+		"\n", "&#xA;",
+		"\r", "&#xD;",
+	)
+)
+
+func (c *canonicalizer) text(s string) {
+	_, _ = c14nTextReplacer.WriteString(&c.buf, s)
+}
+
+func (c *canonicalizer) attrValue(s string) {
+	_, _ = c14nAttrReplacer.WriteString(&c.buf, s)
+}
@@ -0,0 +1,119 @@
+package policybundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/open-policy-agent/opa/bundle"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const defaultSigningAlgorithm = "RS256"
+
+// A Bundle is a verified policy bundle.
+type Bundle struct {
+	// Digest is the digest of the manifest the bundle was pulled with.
+	Digest  string
+	Modules []Module
+}
+
+// A Module is a rego module of a bundle.
+type Module struct {
+	Path string
+	Rego string
+}
+
+// Pull pulls the policy bundle from its OCI registry and verifies its
+// signature. If the manifest digest is lastDigest, the bundle is unchanged
+// and nil is returned.
+func Pull(ctx context.Context, httpClient *http.Client, o *config.PolicyBundleOptions, lastDigest string) (*Bundle, error) {
+	ref, err := parseReference(o.Reference)
+	if err != nil {
+		return nil, err
+	}
+	if o.Digest != "" {
+		if ref.digest != "" && ref.digest != o.Digest {
+			return nil, fmt.Errorf("policybundle: reference digest %s doesn't match the pinned digest %s", ref.digest, o.Digest)
+		}
+		ref.digest = o.Digest
+	}
+
+	client := &registryClient{
+		httpClient: httpClient,
+		username:   o.Username,
+		password:   o.Password,
+	}
+	manifest, digest, err := client.pullManifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if digest == lastDigest {
+		return nil, nil
+	}
+
+	var layer *ociDescriptor
+	for i := range manifest.Layers {
+		if manifest.Layers[i].MediaType == mediaTypeBundleLayer {
+			layer = &manifest.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("policybundle: manifest has no %s layer", mediaTypeBundleLayer)
+	}
+
+	raw, err := client.pullBlob(ctx, ref, *layer)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := readBundle(o, raw)
+	if err != nil {
+		return nil, err
+	}
+	b.Digest = digest
+	return b, nil
+}
+
+// readBundle reads a gzipped tarball in the OPA bundle format, which must be
+// signed by the bundle's public key.
+//
+// https://www.openpolicyagent.org/docs/latest/management-bundles/#signing
+func readBundle(o *config.PolicyBundleOptions, raw []byte) (*Bundle, error) {
+	publicKey, err := o.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	algorithm := o.SigningAlgorithm
+	if algorithm == "" {
+		algorithm = defaultSigningAlgorithm
+	}
+	verificationConfig := bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{
+		o.GetKeyID(): {Key: publicKey, Algorithm: algorithm},
+	}, o.GetKeyID(), "", nil)
+
+	ob, err := bundle.NewReader(bytes.NewReader(raw)).
+		WithBundleVerificationConfig(verificationConfig).
+		WithBundleName(o.Name).
+		WithSizeLimitBytes(maxBundleSize).
+		Read()
+	if err != nil {
+		return nil, fmt.Errorf("policybundle: invalid bundle %s: %w", o.Name, err)
+	}
+
+	b := new(Bundle)
+	for _, m := range ob.Modules {
+		b.Modules = append(b.Modules, Module{Path: m.Path, Rego: string(m.Raw)})
+	}
+	if len(b.Modules) == 0 {
+		return nil, fmt.Errorf("policybundle: bundle %s has no rego modules", o.Name)
+	}
+	sort.Slice(b.Modules, func(i, j int) bool {
+		return b.Modules[i].Path < b.Modules[j].Path
+	})
+	return b, nil
+}
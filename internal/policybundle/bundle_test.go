@@ -0,0 +1,206 @@
+package policybundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const testRego = `package pomerium.policy
+
+allow := true
+`
+
+func newKeyPair(t *testing.T) (privateKeyPEM, encodedPublicKey string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	privateKeyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	encodedPublicKey = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+	return privateKeyPEM, encodedPublicKey
+}
+
+func newBundle(t *testing.T, privateKeyPEM string, rego string) []byte {
+	t.Helper()
+
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "1"},
+		Data:     map[string]any{},
+		Modules: []bundle.ModuleFile{{
+			URL:  "/policy.rego",
+			Path: "/policy.rego",
+			Raw:  []byte(rego),
+		}},
+	}
+	if privateKeyPEM != "" {
+		require.NoError(t, b.GenerateSignature(bundle.NewSigningConfig(privateKeyPEM, "RS256", ""), "default", false))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, bundle.NewWriter(&buf).Write(b))
+	return buf.Bytes()
+}
+
+// newRegistry serves the bundle with the distribution API, behind bearer
+// token authentication.
+func newRegistry(t *testing.T, blob []byte) (srv *httptest.Server, manifestDigest string) {
+	t.Helper()
+
+	manifest, err := json.Marshal(ociManifest{
+		MediaType: mediaTypeOCIManifest,
+		Layers: []ociDescriptor{{
+			MediaType: mediaTypeBundleLayer,
+			Digest:    computeDigest(blob),
+			Size:      int64(len(blob)),
+		}},
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "USER" || p != "PASSWORD" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "repository:example/policies:pull", r.URL.Query().Get("scope"))
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "TOKEN"})
+	})
+	mux.HandleFunc("/v2/example/policies/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer TOKEN" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="registry",scope="repository:example/policies:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/example/policies/manifests/latest", "/v2/example/policies/manifests/" + computeDigest(manifest):
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			_, _ = w.Write(manifest)
+		case "/v2/example/policies/blobs/" + computeDigest(blob):
+			_, _ = w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, computeDigest(manifest)
+}
+
+func TestPull(t *testing.T) {
+	t.Parallel()
+
+	privateKeyPEM, publicKey := newKeyPair(t)
+	srv, digest := newRegistry(t, newBundle(t, privateKeyPEM, testRego))
+	o := &config.PolicyBundleOptions{
+		Name:      "security",
+		Reference: srv.URL + "/example/policies:latest",
+		Username:  "USER",
+		Password:  "PASSWORD",
+		PublicKey: publicKey,
+	}
+
+	b, err := Pull(context.Background(), srv.Client(), o, "")
+	require.NoError(t, err)
+	assert.Equal(t, digest, b.Digest)
+	assert.Equal(t, []Module{{Path: "/policy.rego", Rego: testRego}}, b.Modules)
+
+	b, err = Pull(context.Background(), srv.Client(), o, digest)
+	assert.NoError(t, err)
+	assert.Nil(t, b, "should return nil for an unchanged bundle")
+
+	t.Run("pinned", func(t *testing.T) {
+		o := *o
+		o.Digest = digest
+		b, err := Pull(context.Background(), srv.Client(), &o, "")
+		require.NoError(t, err)
+		assert.Equal(t, digest, b.Digest)
+
+		o.Digest = "sha256:" + strings.Repeat("0", 64)
+		_, err = Pull(context.Background(), srv.Client(), &o, "")
+		assert.Error(t, err)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		_, otherPublicKey := newKeyPair(t)
+		o := *o
+		o.PublicKey = otherPublicKey
+		_, err := Pull(context.Background(), srv.Client(), &o, "")
+		assert.Error(t, err)
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		o := *o
+		o.Password = "WRONG"
+		_, err := Pull(context.Background(), srv.Client(), &o, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestPull_unsigned(t *testing.T) {
+	t.Parallel()
+
+	_, publicKey := newKeyPair(t)
+	srv, _ := newRegistry(t, newBundle(t, "", testRego))
+	_, err := Pull(context.Background(), srv.Client(), &config.PolicyBundleOptions{
+		Name:      "security",
+		Reference: srv.URL + "/example/policies",
+		Username:  "USER",
+		Password:  "PASSWORD",
+		PublicKey: publicKey,
+	}, "")
+	assert.Error(t, err)
+}
+
+func TestParseReference(t *testing.T) {
+	t.Parallel()
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	for _, tc := range []struct {
+		in   string
+		want *reference
+	}{
+		{"ghcr.io/example/policies:v1", &reference{scheme: "https", registry: "ghcr.io", repository: "example/policies", tag: "v1"}},
+		{"ghcr.io/example/policies", &reference{scheme: "https", registry: "ghcr.io", repository: "example/policies", tag: "latest"}},
+		{"oci://localhost:5000/policies@" + digest, &reference{scheme: "https", registry: "localhost:5000", repository: "policies", digest: digest}},
+		{"http://localhost:5000/policies:v1@" + digest, &reference{scheme: "http", registry: "localhost:5000", repository: "policies", tag: "v1", digest: digest}},
+		{"ghcr.io", nil},
+		{"ftp://ghcr.io/example/policies", nil},
+		{"ghcr.io/example/policies@md5:abc", nil},
+	} {
+		got, err := parseReference(tc.in)
+		if tc.want == nil {
+			assert.Error(t, err, tc.in)
+			continue
+		}
+		assert.NoError(t, err, tc.in)
+		assert.Equal(t, tc.want, got, tc.in)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	t.Parallel()
+
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull",
+	}, params)
+}
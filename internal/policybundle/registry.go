@@ -0,0 +1,272 @@
+package policybundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeBundleLayer = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	maxManifestSize = 4 << 20
+	maxBundleSize   = 64 << 20
+)
+
+// A reference is a parsed OCI reference, e.g.
+// ghcr.io/example/policies:latest or
+// ghcr.io/example/policies@sha256:...
+type reference struct {
+	scheme     string
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+func parseReference(rawRef string) (*reference, error) {
+	ref := &reference{scheme: "https"}
+	// an explicit scheme allows plain http registries, e.g. for local testing
+	if scheme, rest, ok := strings.Cut(rawRef, "://"); ok {
+		switch scheme {
+		case "http", "https":
+			ref.scheme = scheme
+		case "oci":
+		default:
+			return nil, fmt.Errorf("policybundle: unsupported reference scheme: %s", scheme)
+		}
+		rawRef = rest
+	}
+
+	registry, rest, ok := strings.Cut(rawRef, "/")
+	if !ok || registry == "" || rest == "" {
+		return nil, fmt.Errorf("policybundle: invalid reference, expected <registry>/<repository>: %s", rawRef)
+	}
+	ref.registry = registry
+
+	if repository, digest, ok := strings.Cut(rest, "@"); ok {
+		rest, ref.digest = repository, digest
+		if !strings.HasPrefix(ref.digest, "sha256:") {
+			return nil, fmt.Errorf("policybundle: unsupported reference digest: %s", ref.digest)
+		}
+	}
+	// a tag follows the last colon, after the last slash
+	if idx := strings.LastIndex(rest, ":"); idx > strings.LastIndex(rest, "/") {
+		rest, ref.tag = rest[:idx], rest[idx+1:]
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("policybundle: invalid reference, missing repository: %s", rawRef)
+	}
+	ref.repository = rest
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+	return ref, nil
+}
+
+// manifestReference returns the tag or digest the manifest is pulled by.
+func (ref *reference) manifestReference() string {
+	if ref.digest != "" {
+		return ref.digest
+	}
+	return ref.tag
+}
+
+func (ref *reference) url(path string) string {
+	return (&url.URL{
+		Scheme: ref.scheme,
+		Host:   ref.registry,
+		Path:   "/v2/" + ref.repository + path,
+	}).String()
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// A registryClient pulls bundles from an OCI registry with the distribution
+// API.
+//
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+type registryClient struct {
+	httpClient         *http.Client
+	username, password string
+	token              string
+}
+
+// pullManifest pulls the manifest of the reference and returns it along with
+// its digest.
+func (c *registryClient) pullManifest(ctx context.Context, ref *reference) (*ociManifest, string, error) {
+	bs, err := c.get(ctx, ref.url("/manifests/"+ref.manifestReference()), mediaTypeOCIManifest, maxManifestSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("policybundle: error pulling manifest: %w", err)
+	}
+	digest := computeDigest(bs)
+	if ref.digest != "" && ref.digest != digest {
+		return nil, "", fmt.Errorf("policybundle: manifest digest %s doesn't match the reference digest %s", digest, ref.digest)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(bs, &manifest); err != nil {
+		return nil, "", fmt.Errorf("policybundle: invalid manifest: %w", err)
+	}
+	return &manifest, digest, nil
+}
+
+// pullBlob pulls the blob with the given digest.
+func (c *registryClient) pullBlob(ctx context.Context, ref *reference, desc ociDescriptor) ([]byte, error) {
+	if desc.Size > maxBundleSize {
+		return nil, fmt.Errorf("policybundle: bundle is too large: %d bytes", desc.Size)
+	}
+	bs, err := c.get(ctx, ref.url("/blobs/"+desc.Digest), "", maxBundleSize)
+	if err != nil {
+		return nil, fmt.Errorf("policybundle: error pulling bundle: %w", err)
+	}
+	if digest := computeDigest(bs); digest != desc.Digest {
+		return nil, fmt.Errorf("policybundle: bundle digest %s doesn't match the manifest digest %s", digest, desc.Digest)
+	}
+	return bs, nil
+}
+
+func (c *registryClient) get(ctx context.Context, rawURL, accept string, limit int64) ([]byte, error) {
+	res, err := c.do(ctx, rawURL, accept)
+	if err != nil {
+		return nil, err
+	}
+	// registries ask for a bearer token the first time
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		_ = res.Body.Close()
+		if err := c.authenticate(ctx, challenge); err != nil {
+			return nil, err
+		}
+		res, err = c.do(ctx, rawURL, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	bs, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bs)) > limit {
+		return nil, fmt.Errorf("response is larger than %d bytes", limit)
+	}
+	return bs, nil
+}
+
+func (c *registryClient) do(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.httpClient.Do(req)
+}
+
+// authenticate gets a bearer token for the challenge of a registry.
+//
+// https://distribution.github.io/distribution/spec/auth/token/
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return errors.New("unauthorized")
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("invalid token realm: %w", err)
+	}
+	q := tokenURL.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	tokenURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error getting registry token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("error getting registry token: unexpected status code: %d", res.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(&token); err != nil {
+		return fmt.Errorf("invalid registry token response: %w", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return errors.New("registry token response is missing the token")
+	}
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate challenge, e.g.
+// Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	for rest != "" {
+		var k, v string
+		k, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			v, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			v, rest, _ = strings.Cut(rest, ",")
+		}
+		if k != "" {
+			params[strings.ToLower(strings.TrimSpace(k))] = v
+		}
+	}
+	return scheme, params
+}
+
+func computeDigest(bs []byte) string {
+	h := sha256.Sum256(bs)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
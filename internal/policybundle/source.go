@@ -0,0 +1,211 @@
+// Package policybundle pulls signed rego policy bundles from OCI registries
+// and adds them to the policies of the routes which refer to them.
+package policybundle
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// unavailableRego denies access to routes whose policy bundle hasn't been
+// pulled yet, rather than evaluating their policy without it.
+const unavailableRego = `package pomerium.policy
+
+deny := [true, {"policy-bundle-unavailable"}]
+`
+
+// subPolicyIDPrefix prefixes the ids of the sub policies of bundles.
+const subPolicyIDPrefix = "policy-bundle:"
+
+type poller struct {
+	options config.PolicyBundleOptions
+	cancel  context.CancelFunc
+}
+
+// Source is a config source which adds the rego modules of policy bundles to
+// the policies of the routes which refer to them, and triggers a change
+// whenever a bundle changes.
+type Source struct {
+	ctx        context.Context
+	underlying config.Source
+	httpClient *http.Client
+
+	mu             sync.Mutex
+	underlyingCfg  *config.Config
+	computedConfig *config.Config
+	pollers        map[string]*poller
+	bundles        map[string]*Bundle
+
+	config.ChangeDispatcher
+}
+
+var _ config.Source = (*Source)(nil)
+
+// NewSource creates a new Source.
+func NewSource(ctx context.Context, underlying config.Source) *Source {
+	src := &Source{
+		ctx:        ctx,
+		underlying: underlying,
+		httpClient: http.DefaultClient,
+		pollers:    make(map[string]*poller),
+		bundles:    make(map[string]*Bundle),
+	}
+	underlying.OnConfigChange(ctx, src.onUnderlyingConfigChange)
+	src.update(underlying.GetConfig())
+	return src
+}
+
+// GetConfig returns the config with the policy bundles.
+func (src *Source) GetConfig() *config.Config {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.computedConfig
+}
+
+func (src *Source) onUnderlyingConfigChange(ctx context.Context, cfg *config.Config) {
+	src.Trigger(ctx, src.update(cfg))
+}
+
+func (src *Source) update(cfg *config.Config) *config.Config {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	src.underlyingCfg = cfg
+
+	// restart the pollers of bundles whose options changed
+	current := make(map[string]bool)
+	if cfg != nil && cfg.Options != nil {
+		for _, o := range cfg.Options.PolicyBundles {
+			current[o.Name] = true
+			if p, ok := src.pollers[o.Name]; ok && p.options == o {
+				continue
+			} else if ok {
+				p.cancel()
+				delete(src.bundles, o.Name)
+			}
+
+			ctx, cancel := context.WithCancel(src.ctx)
+			src.pollers[o.Name] = &poller{options: o, cancel: cancel}
+			go src.poll(ctx, o)
+		}
+	}
+	for name, p := range src.pollers {
+		if !current[name] {
+			p.cancel()
+			delete(src.pollers, name)
+			delete(src.bundles, name)
+		}
+	}
+
+	src.computedConfig = src.build(cfg)
+	return src.computedConfig
+}
+
+func (src *Source) poll(ctx context.Context, o config.PolicyBundleOptions) {
+	ticker := time.NewTicker(o.GetRefreshInterval())
+	defer ticker.Stop()
+
+	for {
+		src.refresh(ctx, &o)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (src *Source) refresh(ctx context.Context, o *config.PolicyBundleOptions) {
+	var lastDigest string
+	src.mu.Lock()
+	if b, ok := src.bundles[o.Name]; ok {
+		lastDigest = b.Digest
+	}
+	src.mu.Unlock()
+
+	b, err := Pull(ctx, src.httpClient, o, lastDigest)
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("bundle", o.Name).
+			Str("reference", o.Reference).
+			Msg("policybundle: error pulling policy bundle")
+		return
+	} else if b == nil {
+		return
+	}
+
+	src.mu.Lock()
+	// the options changed while pulling
+	if ctx.Err() != nil {
+		src.mu.Unlock()
+		return
+	}
+	src.bundles[o.Name] = b
+	src.computedConfig = src.build(src.underlyingCfg)
+	cfg := src.computedConfig
+	src.mu.Unlock()
+
+	log.Info(ctx).
+		Str("bundle", o.Name).
+		Str("digest", b.Digest).
+		Msg("policybundle: updated policy bundle")
+	src.Trigger(ctx, cfg)
+}
+
+// build adds the policy bundles to the routes of the config.
+func (src *Source) build(cfg *config.Config) *config.Config {
+	if cfg == nil || cfg.Options == nil || len(cfg.Options.PolicyBundles) == 0 {
+		return cfg
+	}
+
+	next := cfg.Clone()
+	next.Options.Policies = src.addBundles(cfg.Options.Policies)
+	next.Options.Routes = src.addBundles(cfg.Options.Routes)
+	next.Options.AdditionalPolicies = src.addBundles(cfg.Options.AdditionalPolicies)
+	return next
+}
+
+func (src *Source) addBundles(policies []config.Policy) []config.Policy {
+	if policies == nil {
+		return nil
+	}
+
+	next := make([]config.Policy, len(policies))
+	copy(next, policies)
+	for i := range next {
+		if next[i].PolicyBundle == "" {
+			continue
+		}
+		next[i].SubPolicies = append(append([]config.SubPolicy{}, next[i].SubPolicies...),
+			src.getSubPolicies(next[i].PolicyBundle)...)
+	}
+	return next
+}
+
+func (src *Source) getSubPolicies(name string) []config.SubPolicy {
+	b, ok := src.bundles[name]
+	if !ok {
+		return []config.SubPolicy{{
+			ID:          subPolicyIDPrefix + name,
+			Name:        name,
+			Rego:        []string{unavailableRego},
+			Explanation: "The policy bundle " + name + " is unavailable.",
+		}}
+	}
+
+	sps := make([]config.SubPolicy, 0, len(b.Modules))
+	for _, m := range b.Modules {
+		sps = append(sps, config.SubPolicy{
+			ID:   subPolicyIDPrefix + name + ":" + m.Path,
+			Name: name,
+			Rego: []string{m.Rego},
+		})
+	}
+	return sps
+}
@@ -0,0 +1,69 @@
+package policybundle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestSource(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	privateKeyPEM, publicKey := newKeyPair(t)
+	srv, digest := newRegistry(t, newBundle(t, privateKeyPEM, testRego))
+
+	options := config.NewDefaultOptions()
+	options.PolicyBundles = []config.PolicyBundleOptions{{
+		Name:      "security",
+		Reference: srv.URL + "/example/policies:latest",
+		Username:  "USER",
+		Password:  "PASSWORD",
+		PublicKey: publicKey,
+	}}
+	options.Policies = []config.Policy{
+		{From: "https://a.example.com", PolicyBundle: "security"},
+		{From: "https://b.example.com"},
+	}
+	underlying := config.NewStaticSource(&config.Config{Options: options})
+
+	src := &Source{
+		ctx:        ctx,
+		underlying: underlying,
+		httpClient: srv.Client(),
+		pollers:    make(map[string]*poller),
+		bundles:    make(map[string]*Bundle),
+	}
+	updated := make(chan *config.Config, 1)
+	src.OnConfigChange(ctx, func(_ context.Context, cfg *config.Config) {
+		updated <- cfg
+	})
+	src.update(underlying.GetConfig())
+
+	// until the bundle is pulled, access is denied
+	cfg := src.GetConfig()
+	require.Len(t, cfg.Options.Policies[0].SubPolicies, 1)
+	assert.Equal(t, []string{unavailableRego}, cfg.Options.Policies[0].SubPolicies[0].Rego)
+	assert.Empty(t, cfg.Options.Policies[1].SubPolicies)
+
+	select {
+	case cfg = <-updated:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the config to be updated with the bundle")
+	}
+	assert.Equal(t, []config.SubPolicy{{
+		ID:   "policy-bundle:security:/policy.rego",
+		Name: "security",
+		Rego: []string{testRego},
+	}}, cfg.Options.Policies[0].SubPolicies)
+	assert.Empty(t, cfg.Options.Policies[1].SubPolicies)
+	assert.Empty(t, options.Policies[0].SubPolicies, "should not modify the underlying config")
+	assert.Equal(t, digest, src.bundles["security"].Digest)
+}
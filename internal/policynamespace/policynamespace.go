@@ -0,0 +1,223 @@
+// Package policynamespace implements a REST API with which the admins of
+// policy namespaces manage the routes of their namespaces.
+package policynamespace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// PathPrefix is the path prefix of the policy namespace endpoints.
+const PathPrefix = "/api/v1/namespaces"
+
+const maxRequestSize = 1 << 20
+
+// An Authenticator returns the id and email of the user a bearer token was
+// issued to. The user id is empty if the token is invalid, expired or
+// revoked.
+type Authenticator func(ctx context.Context, token string) (userID, email string, err error)
+
+type handler struct {
+	options       *config.Options
+	authenticator Authenticator
+	client        databroker.DataBrokerServiceClient
+	router        *mux.Router
+}
+
+type userKey struct{}
+
+type user struct {
+	id, email string
+}
+
+// New creates a new policy namespace handler. Requests must be authenticated
+// with a Pomerium session or service account JWT as a bearer token, whose
+// user administers the namespace.
+//
+//	GET /api/v1/namespaces/{namespace}/routes   returns the routes of a namespace
+//	PUT /api/v1/namespaces/{namespace}/routes   replaces the routes of a namespace
+//
+// Routes are stored in the databroker, from which they are added to the
+// routes of the config. Every route must be served from one of the domains
+// of the namespace, proxy to its upstreams and only set the fields namespace
+// admins are allowed to set.
+func New(options *config.Options, authenticator Authenticator, client databroker.DataBrokerServiceClient) http.Handler {
+	h := &handler{
+		options:       options,
+		authenticator: authenticator,
+		client:        client,
+	}
+
+	h.router = mux.NewRouter()
+	r := h.router.PathPrefix(PathPrefix).Subrouter()
+	r.Path("/{namespace}/routes").Handler(handlerFunc(h.get)).Methods(http.MethodGet)
+	r.Path("/{namespace}/routes").Handler(handlerFunc(h.put)).Methods(http.MethodPut)
+	r.NotFoundHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return status.Error(codes.NotFound, "not found")
+	})
+	r.MethodNotAllowedHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return nil
+	})
+	return h
+}
+
+// ServeHTTP serves a policy namespace request.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	userID, email, err := h.authenticator(r.Context(), token)
+	if err != nil {
+		log.Error(r.Context()).Err(err).Msg("policynamespace: error authenticating request")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	} else if token == "" || userID == "" {
+		writeError(w, r, http.StatusUnauthorized, "invalid bearer token")
+		return
+	}
+	ctx := context.WithValue(r.Context(), userKey{}, user{id: userID, email: email})
+	h.router.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := h.getNamespace(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.client.Get(r.Context(), &databroker.GetRequest{
+		Type: grpcutil.GetTypeURL(new(configpb.Config)),
+		Id:   namespace.GetRecordID(),
+	})
+	if status.Code(err) == codes.NotFound {
+		return writeProto(w, http.StatusOK, &configpb.Config{Name: namespace.Name})
+	} else if err != nil {
+		return err
+	}
+
+	cfg := new(configpb.Config)
+	if err := res.GetRecord().GetData().UnmarshalTo(cfg); err != nil {
+		return fmt.Errorf("policynamespace: error unmarshaling config: %w", err)
+	}
+	return writeProto(w, http.StatusOK, cfg)
+}
+
+func (h *handler) put(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := h.getNamespace(r)
+	if err != nil {
+		return err
+	}
+
+	in := new(configpb.Config)
+	if err := readProto(r, in); err != nil {
+		return err
+	}
+
+	// only the routes are managed by namespace admins
+	cfg := &configpb.Config{Name: namespace.Name, Routes: in.GetRoutes()}
+	for i, routepb := range cfg.Routes {
+		if err := namespace.CheckRoute(routepb); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid route %d: %s", i, err)
+		}
+	}
+
+	_, err = h.client.Put(r.Context(), &databroker.PutRequest{
+		Records: []*databroker.Record{{
+			Type: grpcutil.GetTypeURL(cfg),
+			Id:   namespace.GetRecordID(),
+			Data: protoutil.NewAny(cfg),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	u := r.Context().Value(userKey{}).(user)
+	log.Info(r.Context()).
+		Str("namespace", namespace.Name).
+		Str("user_id", u.id).
+		Int("routes", len(cfg.Routes)).
+		Msg("policynamespace: updated routes")
+
+	return writeProto(w, http.StatusOK, cfg)
+}
+
+// getNamespace returns the namespace of a request, which the user of the
+// request must administer.
+func (h *handler) getNamespace(r *http.Request) (*config.PolicyNamespaceOptions, error) {
+	name := mux.Vars(r)["namespace"]
+	namespace := h.options.GetPolicyNamespace(name)
+	if namespace == nil {
+		return nil, status.Errorf(codes.NotFound, "namespace not found: %s", name)
+	}
+	u := r.Context().Value(userKey{}).(user)
+	if !namespace.IsAdmin(u.id, u.email) {
+		return nil, status.Errorf(codes.PermissionDenied, "not an admin of namespace: %s", name)
+	}
+	return namespace, nil
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f handlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := f(w, r)
+	if err == nil {
+		return
+	}
+
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		writeError(w, r, http.StatusBadRequest, status.Convert(err).Message())
+	case codes.PermissionDenied:
+		writeError(w, r, http.StatusForbidden, status.Convert(err).Message())
+	case codes.NotFound:
+		writeError(w, r, http.StatusNotFound, status.Convert(err).Message())
+	default:
+		log.Error(r.Context()).Err(err).Msg("policynamespace: error handling request")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, _ *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": message})
+}
+
+func writeProto(w http.ResponseWriter, status int, msg proto.Message) error {
+	bs, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(bs)
+	return err
+}
+
+func readProto(r *http.Request, msg proto.Message) error {
+	bs, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal(bs, msg); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid request body: "+err.Error())
+	}
+	return nil
+}
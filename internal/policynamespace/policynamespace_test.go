@@ -0,0 +1,152 @@
+package policynamespace
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/pomerium/pomerium/config"
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	li := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(s, internal_databroker.New())
+	go s.Serve(li)
+	t.Cleanup(s.Stop)
+	cc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	options := config.NewDefaultOptions()
+	options.PolicyNamespaces = []config.PolicyNamespaceOptions{
+		{Name: "payments", Domains: []string{"*.payments.example.com"}, Upstreams: []string{"*.internal"}, Admins: []string{"alice@example.com"}},
+		{Name: "billing", Domains: []string{"billing.example.com"}, Admins: []string{"user-2"}},
+	}
+	h := New(options, func(_ context.Context, token string) (string, string, error) {
+		switch token {
+		case "ALICE":
+			return "user-1", "alice@example.com", nil
+		case "BOB":
+			return "user-2", "bob@example.com", nil
+		}
+		return "", "", nil
+	}, databroker.NewDataBrokerServiceClient(cc))
+
+	do := func(token, method, path, body string) (int, map[string]any) {
+		r := httptest.NewRequest(method, "https://authenticate.example.com"+PathPrefix+path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var res map[string]any
+		if w.Body.Len() > 0 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w.Code, res
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		code, _ := do("WRONG", http.MethodGet, "/payments/routes", "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+	t.Run("forbidden", func(t *testing.T) {
+		code, _ := do("BOB", http.MethodGet, "/payments/routes", "")
+		assert.Equal(t, http.StatusForbidden, code)
+		code, _ = do("BOB", http.MethodPut, "/payments/routes", `{}`)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+	t.Run("not found", func(t *testing.T) {
+		code, _ := do("ALICE", http.MethodGet, "/shipping/routes", "")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+	t.Run("empty", func(t *testing.T) {
+		code, res := do("BOB", http.MethodGet, "/billing/routes", "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]any{"name": "billing"}, res)
+	})
+	t.Run("outside of namespace", func(t *testing.T) {
+		code, res := do("ALICE", http.MethodPut, "/payments/routes", `{"routes": [
+			{"from": "https://api.payments.example.com", "to": ["https://api.internal"]},
+			{"from": "https://billing.example.com", "to": ["https://billing.internal"]}
+		]}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalid route 1: billing.example.com is not a domain of namespace payments", res["error"])
+	})
+	t.Run("reserved fields", func(t *testing.T) {
+		for _, tc := range []struct {
+			route, err string
+		}{
+			{
+				`{"from": "https://api.payments.example.com", "to": ["https://api.internal"], "kubernetesServiceAccountTokenFile": "/var/run/secrets/token"}`,
+				"invalid request body",
+			},
+			{
+				`{"from": "https://api.payments.example.com", "to": ["https://api.internal"], "tlsClientKeyFile": "/etc/pomerium/key.pem"}`,
+				"invalid route 0: tls_client_key_file may not be set in namespace payments",
+			},
+			{
+				`{"from": "https://api.payments.example.com", "to": ["https://api.internal"], "tlsCustomCaFile": "/etc/pomerium/ca.pem"}`,
+				"invalid route 0: tls_custom_ca_file may not be set in namespace payments",
+			},
+			{
+				`{"from": "https://api.payments.example.com", "to": ["https://api.internal"], "tlsDownstreamClientCaFile": "/etc/pomerium/ca.pem"}`,
+				"invalid route 0: tls_downstream_client_ca_file may not be set in namespace payments",
+			},
+			{
+				`{"from": "https://api.payments.example.com", "to": ["https://api.internal"], "allowPublicUnauthenticatedAccess": true}`,
+				"invalid route 0: allow_public_unauthenticated_access may not be set in namespace payments",
+			},
+			{
+				`{"from": "https://api.payments.example.com", "to": ["https://api.internal"], "policies": [{"rego": ["package pomerium.policy"]}]}`,
+				"invalid route 0: policies.rego may not be set in namespace payments",
+			},
+			{
+				`{"from": "https://api.payments.example.com", "to": ["http://169.254.169.254"]}`,
+				"invalid route 0: 169.254.169.254 is not an upstream of namespace payments",
+			},
+		} {
+			code, res := do("ALICE", http.MethodPut, "/payments/routes", `{"routes": [`+tc.route+`]}`)
+			assert.Equal(t, http.StatusBadRequest, code, tc.route)
+			assert.Contains(t, res["error"], tc.err, tc.route)
+		}
+	})
+	t.Run("invalid route", func(t *testing.T) {
+		code, _ := do("ALICE", http.MethodPut, "/payments/routes", `{"routes": [
+			{"from": "https://api.payments.example.com"}
+		]}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	t.Run("put", func(t *testing.T) {
+		code, res := do("ALICE", http.MethodPut, "/payments/routes", `{
+			"name": "other",
+			"routes": [{"from": "https://api.payments.example.com", "to": ["https://api.internal"]}],
+			"settings": {"cookieName": "other"}
+		}`)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "payments", res["name"])
+		assert.Nil(t, res["settings"])
+
+		code, res = do("ALICE", http.MethodGet, "/payments/routes", "")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, res["routes"], 1) {
+			assert.Equal(t, "https://api.payments.example.com", res["routes"].([]any)[0].(map[string]any)["from"])
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// counterRecordType is the databroker record type of the counts.
+const counterRecordType = "pomerium.io/RateLimitCounter"
+
+type dataBrokerCounter struct {
+	getClient func() databroker.DataBrokerServiceClient
+
+	// the databroker can't increment a record atomically, so increments are
+	// serialized within an instance
+	mu sync.Mutex
+}
+
+// NewDataBrokerCounter creates a new Counter which stores the counts in the
+// databroker. Increments from different instances may race, so the counts
+// are approximate when there are several authorize instances.
+func NewDataBrokerCounter(getClient func() databroker.DataBrokerServiceClient) Counter {
+	return &dataBrokerCounter{getClient: getClient}
+}
+
+func (c *dataBrokerCounter) Increment(ctx context.Context, key string, start time.Time, ttl time.Duration) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client := c.getClient()
+	id := counterRecordID(key, start)
+
+	var count uint64
+	res, err := client.Get(ctx, &databroker.GetRequest{
+		Type: counterRecordType,
+		Id:   id,
+	})
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		return 0, err
+	default:
+		var value wrapperspb.UInt64Value
+		if err := res.GetRecord().GetData().UnmarshalTo(&value); err != nil {
+			return 0, err
+		}
+		count = value.GetValue()
+	}
+	count++
+
+	records := []*databroker.Record{{
+		Type: counterRecordType,
+		Id:   id,
+		Data: protoutil.NewAny(wrapperspb.UInt64(count)),
+	}}
+	// the first request in a window removes the count of the previous window
+	if count == 1 {
+		records = append(records, &databroker.Record{
+			Type:      counterRecordType,
+			Id:        counterRecordID(key, start.Add(-ttl)),
+			Data:      protoutil.NewAny(wrapperspb.UInt64(0)),
+			DeletedAt: timestamppb.Now(),
+		})
+	}
+	_, err = client.Put(ctx, &databroker.PutRequest{Records: records})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func counterRecordID(key string, start time.Time) string {
+	return key + "@" + strconv.FormatInt(start.Unix(), 10)
+}
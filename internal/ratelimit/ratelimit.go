@@ -0,0 +1,107 @@
+// Package ratelimit limits the number of requests in fixed time windows.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Counter counts the requests for keys in fixed time windows.
+type Counter interface {
+	// Increment increments the count of the key in the window which starts at
+	// start, and returns the new count. The count may be discarded once ttl
+	// has passed.
+	Increment(ctx context.Context, key string, start time.Time, ttl time.Duration) (uint64, error)
+}
+
+// A Limiter limits the number of requests for a key in a time window.
+type Limiter struct {
+	counter Counter
+	now     func() time.Time
+}
+
+// New creates a new Limiter which stores the counts in counter.
+func New(counter Counter) *Limiter {
+	return &Limiter{
+		counter: counter,
+		now:     time.Now,
+	}
+}
+
+// Allow counts a request for the key and returns whether the number of
+// requests in the current window is within the limit. A nil Limiter allows
+// every request.
+func (l *Limiter) Allow(ctx context.Context, key string, limit uint64, window time.Duration) (bool, error) {
+	if l == nil {
+		return true, nil
+	}
+	if window <= 0 {
+		return false, fmt.Errorf("ratelimit: invalid window: %s", window)
+	}
+
+	start := l.now().Truncate(window)
+	count, err := l.counter.Increment(ctx, key, start, window)
+	if err != nil {
+		return false, fmt.Errorf("ratelimit: error counting request: %w", err)
+	}
+	return count <= limit, nil
+}
+
+// Increment counts a request for the key in the window from start to end, and
+// returns the number of requests in the window. A nil Limiter counts nothing.
+func (l *Limiter) Increment(ctx context.Context, key string, start, end time.Time) (uint64, error) {
+	if l == nil {
+		return 0, nil
+	}
+	if !end.After(start) {
+		return 0, fmt.Errorf("ratelimit: invalid window: %s to %s", start, end)
+	}
+
+	count, err := l.counter.Increment(ctx, key, start, end.Sub(start))
+	if err != nil {
+		return 0, fmt.Errorf("ratelimit: error counting request: %w", err)
+	}
+	return count, nil
+}
+
+type memoryCounter struct {
+	mu     sync.Mutex
+	counts map[memoryCounterKey]memoryCount
+}
+
+type memoryCounterKey struct {
+	key   string
+	start time.Time
+}
+
+type memoryCount struct {
+	count     uint64
+	expiresAt time.Time
+}
+
+// NewMemoryCounter creates a new Counter which stores the counts in memory,
+// so they aren't shared with other instances.
+func NewMemoryCounter() Counter {
+	return &memoryCounter{counts: make(map[memoryCounterKey]memoryCount)}
+}
+
+func (c *memoryCounter) Increment(_ context.Context, key string, start time.Time, ttl time.Duration) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// remove any windows which ended before this one started
+	for k, v := range c.counts {
+		if !v.expiresAt.After(start) {
+			delete(c.counts, k)
+		}
+	}
+
+	k := memoryCounterKey{key: key, start: start.UTC()}
+	v := c.counts[k]
+	v.count++
+	v.expiresAt = start.Add(ttl)
+	c.counts[k] = v
+	return v.count, nil
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	li := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(s, internal_databroker.New())
+	go s.Serve(li)
+	t.Cleanup(s.Stop)
+	cc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cc.Close() })
+	client := databroker.NewDataBrokerServiceClient(cc)
+
+	for _, tc := range []struct {
+		name    string
+		counter Counter
+	}{
+		{"memory", NewMemoryCounter()},
+		{"databroker", NewDataBrokerCounter(func() databroker.DataBrokerServiceClient { return client })},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+			l := New(tc.counter)
+			l.now = func() time.Time { return now }
+
+			for i := 0; i < 3; i++ {
+				allowed, err := l.Allow(ctx, "user:u1", 3, time.Minute)
+				require.NoError(t, err)
+				assert.True(t, allowed, "request %d", i+1)
+			}
+			allowed, err := l.Allow(ctx, "user:u1", 3, time.Minute)
+			require.NoError(t, err)
+			assert.False(t, allowed, "should deny requests over the limit")
+
+			allowed, err = l.Allow(ctx, "user:u2", 3, time.Minute)
+			require.NoError(t, err)
+			assert.True(t, allowed, "should count keys separately")
+
+			now = now.Add(time.Minute)
+			allowed, err = l.Allow(ctx, "user:u1", 3, time.Minute)
+			require.NoError(t, err)
+			assert.True(t, allowed, "should reset the count in the next window")
+
+			start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+			end := start.AddDate(0, 1, 0)
+			for i := uint64(1); i <= 2; i++ {
+				count, err := l.Increment(ctx, "quota:u1", start, end)
+				require.NoError(t, err)
+				assert.Equal(t, i, count)
+			}
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var l *Limiter
+		allowed, err := l.Allow(ctx, "user:u1", 0, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+
+		count, err := l.Increment(ctx, "user:u1", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
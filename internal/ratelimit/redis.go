@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisKeyPrefix is the prefix of the redis keys of the counts.
+const redisKeyPrefix = "pomerium/rate_limit/"
+
+type redisCounter struct {
+	client redis.UniversalClient
+}
+
+// NewRedisCounter creates a new Counter which stores the counts in redis.
+func NewRedisCounter(client redis.UniversalClient) Counter {
+	return &redisCounter{client: client}
+}
+
+func (c *redisCounter) Increment(ctx context.Context, key string, start time.Time, ttl time.Duration) (uint64, error) {
+	redisKey := redisKeyPrefix + key + "@" + strconv.FormatInt(start.Unix(), 10)
+
+	var incr *redis.IntCmd
+	_, err := c.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.Incr(ctx, redisKey)
+		p.PExpireAt(ctx, redisKey, start.Add(ttl))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(incr.Val()), nil
+}
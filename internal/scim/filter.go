@@ -0,0 +1,123 @@
+package scim
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A filter is an equality filter on an attribute, the only kind of filter
+// identity providers use when provisioning.
+type filter struct {
+	attr  string // lower case attribute name
+	value string
+}
+
+// parseFilter parses a filter of the form `attr eq "value"`.
+func parseFilter(expr string) (*filter, error) {
+	fields := strings.SplitN(strings.TrimSpace(expr), " ", 3)
+	if len(fields) != 3 || !strings.EqualFold(fields[1], "eq") {
+		return nil, newError(http.StatusBadRequest, "invalidFilter", "unsupported filter: "+expr)
+	}
+
+	value := strings.TrimSpace(fields[2])
+	if strings.HasPrefix(value, `"`) {
+		var err error
+		value, err = strconv.Unquote(value)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, "invalidFilter", "invalid filter value: "+expr)
+		}
+	}
+	return &filter{attr: strings.ToLower(fields[0]), value: value}, nil
+}
+
+// matches returns true if the attribute value of a resource matches the
+// filter.
+func (f *filter) matches(attrs map[string]string) bool {
+	return attrs[f.attr] == f.value
+}
+
+// A patchPath is the path of a patch operation, of the form `attr`,
+// `attr.subAttr`, `attr[filter]` or `attr[filter].subAttr`.
+type patchPath struct {
+	attr    string // lower case attribute name
+	filter  *filter
+	subAttr string // lower case sub-attribute name
+}
+
+func parsePatchPath(path string) (*patchPath, error) {
+	p := new(patchPath)
+	if i := strings.IndexByte(path, '['); i >= 0 {
+		j := strings.LastIndexByte(path, ']')
+		if j < i {
+			return nil, newError(http.StatusBadRequest, "invalidPath", "invalid path: "+path)
+		}
+		var err error
+		p.filter, err = parseFilter(path[i+1 : j])
+		if err != nil {
+			return nil, err
+		}
+		path = path[:i] + path[j+1:]
+	}
+
+	// attributes may be prefixed by the schema URN
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		path = path[strings.LastIndexByte(path, ':')+1:]
+	}
+
+	attr, subAttr, _ := strings.Cut(path, ".")
+	if attr == "" {
+		return nil, newError(http.StatusBadRequest, "invalidPath", "invalid path: "+path)
+	}
+	p.attr, p.subAttr = strings.ToLower(attr), strings.ToLower(subAttr)
+	return p, nil
+}
+
+// A patchRequest is a SCIM patch request.
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+func (req *patchRequest) validate() error {
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace", "remove":
+		default:
+			return newError(http.StatusBadRequest, "invalidSyntax", "unsupported patch operation: "+op.Op)
+		}
+	}
+	return nil
+}
+
+// toBool converts a patch value to a bool. Some identity providers send
+// booleans as strings.
+func toBool(v any) (bool, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err == nil {
+			return b, nil
+		}
+	}
+	return false, newError(http.StatusBadRequest, "invalidValue", "expected a boolean value")
+}
+
+// toString converts a patch value to a string.
+func toString(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", newError(http.StatusBadRequest, "invalidValue", "expected a string value")
+}
@@ -0,0 +1,386 @@
+package scim
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/pomerium/datasource/pkg/directory"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/slices"
+)
+
+// groupResource is the SCIM representation of a group.
+type groupResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []reference `json:"members,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+func (h *handler) listGroupsHandler(w http.ResponseWriter, r *http.Request) error {
+	var f *filter
+	if expr := r.FormValue("filter"); expr != "" {
+		var err error
+		f, err = parseFilter(expr)
+		if err != nil {
+			return err
+		}
+	}
+
+	groups, err := h.listGroups(r.Context())
+	if err != nil {
+		return err
+	}
+	users, err := h.listUsers(r.Context())
+	if err != nil {
+		return err
+	}
+
+	resources := []any{}
+	for _, g := range groups {
+		if f != nil && !f.matches(map[string]string{
+			"id":          g.ID,
+			"externalid":  g.ExternalID,
+			"displayname": g.Name,
+		}) {
+			continue
+		}
+		resources = append(resources, newGroupResource(r, g, users, groups))
+	}
+
+	startIndex, count := getPagination(r)
+	return writeJSON(w, http.StatusOK, newListResponse(resources, startIndex, count))
+}
+
+func (h *handler) getGroupHandler(w http.ResponseWriter, r *http.Request) error {
+	g, err := h.getExistingGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	return h.writeGroup(w, r, http.StatusOK, g)
+}
+
+func (h *handler) createGroup(w http.ResponseWriter, r *http.Request) error {
+	var res groupResource
+	if err := readJSON(r, &res); err != nil {
+		return err
+	}
+	if res.DisplayName == "" {
+		return newError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+
+	g := &storedGroup{ExternalID: res.ExternalID}
+	g.ID = res.ExternalID
+	if g.ID == "" {
+		g.ID = uuid.NewString()
+	}
+	g.Name = res.DisplayName
+	existing, err := h.getGroup(r.Context(), g.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return newError(http.StatusConflict, "uniqueness", "group already exists")
+	}
+
+	if err := h.putGroups(r.Context(), g); err != nil {
+		return err
+	}
+	if err := h.setMembers(r.Context(), g.ID, referenceValues(res.Members)); err != nil {
+		return err
+	}
+
+	log.Info(r.Context()).Str("group-id", g.ID).Msg("scim: created group")
+	w.Header().Set("Location", locationURL(r, "Group", g.ID))
+	return h.writeGroup(w, r, http.StatusCreated, g)
+}
+
+func (h *handler) replaceGroup(w http.ResponseWriter, r *http.Request) error {
+	g, err := h.getExistingGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	var res groupResource
+	if err := readJSON(r, &res); err != nil {
+		return err
+	}
+	if res.DisplayName == "" {
+		return newError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+
+	g.Name, g.ExternalID = res.DisplayName, res.ExternalID
+	if err := h.putGroups(r.Context(), g); err != nil {
+		return err
+	}
+	if err := h.setMembers(r.Context(), g.ID, referenceValues(res.Members)); err != nil {
+		return err
+	}
+	return h.writeGroup(w, r, http.StatusOK, g)
+}
+
+func (h *handler) patchGroup(w http.ResponseWriter, r *http.Request) error {
+	g, err := h.getExistingGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	var req patchRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if err := req.validate(); err != nil {
+		return err
+	}
+
+	users, err := h.listUsers(r.Context())
+	if err != nil {
+		return err
+	}
+	groups, err := h.listGroups(r.Context())
+	if err != nil {
+		return err
+	}
+	members := getMembers(g.ID, users, groups)
+	for _, op := range req.Operations {
+		members, err = applyGroupPatch(g, members, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := h.putGroups(r.Context(), g); err != nil {
+		return err
+	}
+	if err := h.setMembers(r.Context(), g.ID, members); err != nil {
+		return err
+	}
+	return h.writeGroup(w, r, http.StatusOK, g)
+}
+
+func (h *handler) deleteGroup(w http.ResponseWriter, r *http.Request) error {
+	g, err := h.getExistingGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	if err := h.setMembers(r.Context(), g.ID, nil); err != nil {
+		return err
+	}
+	if err := h.delete(r.Context(), directory.GroupRecordType, g.ID); err != nil {
+		return err
+	}
+	log.Info(r.Context()).Str("group-id", g.ID).Msg("scim: deleted group")
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *handler) getExistingGroup(ctx context.Context, id string) (*storedGroup, error) {
+	g, err := h.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, newError(http.StatusNotFound, "", "group not found")
+	}
+	return g, nil
+}
+
+// setMembers updates the group ids of the users, and the parent ids of the
+// groups, so that the given users and groups are exactly the members of the
+// group. Unknown members are ignored.
+func (h *handler) setMembers(ctx context.Context, groupID string, memberIDs []string) error {
+	users, err := h.listUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	var changedUsers []*storedUser
+	for _, u := range users {
+		isMember := slices.Contains(u.GroupIDs, groupID)
+		switch shouldBeMember := slices.Contains(memberIDs, u.ID); {
+		case shouldBeMember && !isMember:
+			u.GroupIDs = append(u.GroupIDs, groupID)
+			sort.Strings(u.GroupIDs)
+		case !shouldBeMember && isMember:
+			u.GroupIDs = slices.Remove(u.GroupIDs, groupID)
+		default:
+			continue
+		}
+		changedUsers = append(changedUsers, u)
+	}
+	if err := h.putUsers(ctx, changedUsers...); err != nil {
+		return err
+	}
+
+	groups, err := h.listGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var changedGroups []*storedGroup
+	for _, g := range groups {
+		// a group can't be a member of itself
+		if g.ID == groupID {
+			continue
+		}
+		isMember := slices.Contains(g.ParentIDs, groupID)
+		switch shouldBeMember := slices.Contains(memberIDs, g.ID); {
+		case shouldBeMember && !isMember:
+			g.ParentIDs = append(g.ParentIDs, groupID)
+			sort.Strings(g.ParentIDs)
+		case !shouldBeMember && isMember:
+			g.ParentIDs = slices.Remove(g.ParentIDs, groupID)
+		default:
+			continue
+		}
+		changedGroups = append(changedGroups, g)
+	}
+	return h.putGroups(ctx, changedGroups...)
+}
+
+func (h *handler) writeGroup(w http.ResponseWriter, r *http.Request, status int, g *storedGroup) error {
+	users, err := h.listUsers(r.Context())
+	if err != nil {
+		return err
+	}
+	groups, err := h.listGroups(r.Context())
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, status, newGroupResource(r, g, users, groups))
+}
+
+func newGroupResource(r *http.Request, g *storedGroup, users []*storedUser, groups []*storedGroup) *groupResource {
+	res := &groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.Name,
+		Meta: &meta{
+			ResourceType: "Group",
+			Location:     locationURL(r, "Group", g.ID),
+		},
+	}
+	for _, u := range users {
+		if slices.Contains(u.GroupIDs, g.ID) {
+			res.Members = append(res.Members, reference{
+				Value:   u.ID,
+				Display: u.DisplayName,
+				Ref:     locationURL(r, "User", u.ID),
+			})
+		}
+	}
+	for _, child := range groups {
+		if slices.Contains(child.ParentIDs, g.ID) {
+			res.Members = append(res.Members, reference{
+				Value:   child.ID,
+				Display: child.Name,
+				Ref:     locationURL(r, "Group", child.ID),
+			})
+		}
+	}
+	return res
+}
+
+func getMembers(groupID string, users []*storedUser, groups []*storedGroup) []string {
+	var memberIDs []string
+	for _, u := range users {
+		if slices.Contains(u.GroupIDs, groupID) {
+			memberIDs = append(memberIDs, u.ID)
+		}
+	}
+	for _, g := range groups {
+		if slices.Contains(g.ParentIDs, groupID) {
+			memberIDs = append(memberIDs, g.ID)
+		}
+	}
+	return memberIDs
+}
+
+// applyGroupPatch applies the patch operation to the group and returns the
+// updated ids of the members.
+func applyGroupPatch(g *storedGroup, members []string, op patchOperation) ([]string, error) {
+	remove := strings.EqualFold(op.Op, "remove")
+
+	// without a path the value is a partial resource
+	if op.Path == "" {
+		attrs, ok := op.Value.(map[string]any)
+		if !ok || remove {
+			return nil, newError(http.StatusBadRequest, "noTarget", "a path is required")
+		}
+		for path, value := range attrs {
+			var err error
+			members, err = applyGroupPatch(g, members, patchOperation{Op: op.Op, Path: path, Value: value})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return members, nil
+	}
+
+	p, err := parsePatchPath(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.attr {
+	case "displayname":
+		if remove {
+			return nil, newError(http.StatusBadRequest, "mutability", "displayName can't be removed")
+		}
+		g.Name, err = toString(op.Value)
+	case "externalid":
+		if remove {
+			op.Value = nil
+		}
+		g.ExternalID, err = toString(op.Value)
+	case "members":
+		var memberIDs []string
+		if p.filter != nil {
+			if p.filter.attr != "value" {
+				return nil, newError(http.StatusBadRequest, "invalidFilter", "unsupported members filter")
+			}
+			memberIDs = []string{p.filter.value}
+		} else {
+			values, _ := op.Value.([]any)
+			for _, value := range values {
+				if m, ok := value.(map[string]any); ok {
+					if v, ok := m["value"].(string); ok {
+						memberIDs = append(memberIDs, v)
+					}
+				}
+			}
+		}
+
+		switch strings.ToLower(op.Op) {
+		case "add":
+			members = slices.Unique(append(members, memberIDs...))
+		case "replace":
+			members = memberIDs
+		case "remove":
+			if p.filter == nil && op.Value == nil {
+				// removing all members
+				memberIDs = members
+			}
+			members = slices.Filter(members, func(id string) bool {
+				return !slices.Contains(memberIDs, id)
+			})
+		}
+	default:
+		// ignore other attributes, such as the id
+	}
+	return members, err
+}
+
+func referenceValues(refs []reference) []string {
+	values := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		values = append(values, ref.Value)
+	}
+	return values
+}
@@ -0,0 +1,238 @@
+// Package scim implements a SCIM 2.0 service provider backed by the
+// databroker. Identity providers use it to push user and group changes, which
+// are stored as directory users and groups.
+//
+// https://datatracker.ietf.org/doc/html/rfc7643
+// https://datatracker.ietf.org/doc/html/rfc7644
+package scim
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// PathPrefix is the path prefix of the SCIM endpoints.
+const PathPrefix = "/scim/v2"
+
+const contentType = "application/scim+json"
+
+// schema URNs
+const (
+	schemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	schemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	schemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+type handler struct {
+	bearerToken          [sha256.Size]byte
+	dataBrokerClient     databroker.DataBrokerServiceClient
+	sessionServiceClient session.SessionServiceClient
+	router               *mux.Router
+}
+
+// New creates a new SCIM handler. Requests must be authenticated with the
+// bearer token. Deactivated and deleted users are signed out everywhere with
+// the session service.
+func New(
+	bearerToken string,
+	dataBrokerClient databroker.DataBrokerServiceClient,
+	sessionServiceClient session.SessionServiceClient,
+) http.Handler {
+	h := &handler{
+		bearerToken:          sha256.Sum256([]byte(bearerToken)),
+		dataBrokerClient:     dataBrokerClient,
+		sessionServiceClient: sessionServiceClient,
+	}
+
+	h.router = mux.NewRouter()
+	r := h.router.PathPrefix(PathPrefix).Subrouter()
+	r.Path("/ServiceProviderConfig").Handler(handlerFunc(h.serviceProviderConfig)).Methods(http.MethodGet)
+	r.Path("/ResourceTypes").Handler(handlerFunc(h.resourceTypes)).Methods(http.MethodGet)
+	r.Path("/Users").Handler(handlerFunc(h.listUsersHandler)).Methods(http.MethodGet)
+	r.Path("/Users").Handler(handlerFunc(h.createUser)).Methods(http.MethodPost)
+	r.Path("/Users/{id}").Handler(handlerFunc(h.getUserHandler)).Methods(http.MethodGet)
+	r.Path("/Users/{id}").Handler(handlerFunc(h.replaceUser)).Methods(http.MethodPut)
+	r.Path("/Users/{id}").Handler(handlerFunc(h.patchUser)).Methods(http.MethodPatch)
+	r.Path("/Users/{id}").Handler(handlerFunc(h.deleteUser)).Methods(http.MethodDelete)
+	r.Path("/Groups").Handler(handlerFunc(h.listGroupsHandler)).Methods(http.MethodGet)
+	r.Path("/Groups").Handler(handlerFunc(h.createGroup)).Methods(http.MethodPost)
+	r.Path("/Groups/{id}").Handler(handlerFunc(h.getGroupHandler)).Methods(http.MethodGet)
+	r.Path("/Groups/{id}").Handler(handlerFunc(h.replaceGroup)).Methods(http.MethodPut)
+	r.Path("/Groups/{id}").Handler(handlerFunc(h.patchGroup)).Methods(http.MethodPatch)
+	r.Path("/Groups/{id}").Handler(handlerFunc(h.deleteGroup)).Methods(http.MethodDelete)
+	r.NotFoundHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return newError(http.StatusNotFound, "", "resource not found")
+	})
+	r.MethodNotAllowedHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return newError(http.StatusMethodNotAllowed, "", "method not allowed")
+	})
+	return h
+}
+
+// ServeHTTP serves a SCIM request.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	tokenHash := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(tokenHash[:], h.bearerToken[:]) != 1 {
+		writeError(w, r, newError(http.StatusUnauthorized, "", "invalid bearer token"))
+		return
+	}
+	h.router.ServeHTTP(w, r)
+}
+
+func (h *handler) serviceProviderConfig(w http.ResponseWriter, r *http.Request) error {
+	supported := func(v bool) map[string]any { return map[string]any{"supported": v} }
+	return writeJSON(w, http.StatusOK, map[string]any{
+		"schemas":        []string{schemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": queryLimit},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with a bearer token",
+		}},
+	})
+}
+
+func (h *handler) resourceTypes(w http.ResponseWriter, r *http.Request) error {
+	resourceTypes := []any{
+		map[string]any{
+			"schemas":  []string{schemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   schemaUser,
+		},
+		map[string]any{
+			"schemas":  []string{schemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   schemaGroup,
+		},
+	}
+	return writeJSON(w, http.StatusOK, newListResponse(resourceTypes, 1, len(resourceTypes)))
+}
+
+// A listResponse is a page of resources.
+type listResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// newListResponse returns the page of the resources starting at the 1-based
+// start index.
+func newListResponse(resources []any, startIndex, count int) *listResponse {
+	res := &listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		Resources:    []any{},
+	}
+	if startIndex-1 < len(resources) {
+		resources = resources[startIndex-1:]
+		if count < len(resources) {
+			resources = resources[:count]
+		}
+		res.Resources = resources
+	}
+	res.ItemsPerPage = len(res.Resources)
+	return res
+}
+
+// getPagination returns the start index and count query parameters.
+func getPagination(r *http.Request) (startIndex, count int) {
+	startIndex, count = 1, queryLimit
+	if v, err := strconv.Atoi(r.FormValue("startIndex")); err == nil && v > 1 {
+		startIndex = v
+	}
+	if v, err := strconv.Atoi(r.FormValue("count")); err == nil && v >= 0 && v < count {
+		count = v
+	}
+	return startIndex, count
+}
+
+// scimError is a SCIM error response.
+type scimError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func newError(status int, scimType, detail string) *scimError {
+	return &scimError{Status: status, ScimType: scimType, Detail: detail}
+}
+
+func (err *scimError) Error() string {
+	return err.Detail
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f handlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var scimErr *scimError
+	if !errors.As(err, &scimErr) {
+		log.Error(r.Context()).Err(err).Msg("scim: error handling request")
+		scimErr = newError(http.StatusInternalServerError, "", "internal error")
+	}
+
+	body := map[string]any{
+		"schemas": []string{schemaError},
+		"status":  strconv.Itoa(scimErr.Status),
+		"detail":  scimErr.Detail,
+	}
+	if scimErr.ScimType != "" {
+		body["scimType"] = scimErr.ScimType
+	}
+	_ = writeJSON(w, scimErr.Status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func readJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newError(http.StatusBadRequest, "invalidSyntax", "invalid request body: "+err.Error())
+	}
+	return nil
+}
+
+// locationURL returns the URL of the resource relative to the request.
+func locationURL(r *http.Request, resourceType, id string) string {
+	scheme := "https"
+	if r.TLS == nil && r.Header.Get("X-Forwarded-Proto") == "http" {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host + PathPrefix + "/" + resourceType + "s/" + id
+}
@@ -0,0 +1,211 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pomerium/datasource/pkg/directory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestParseFilter(t *testing.T) {
+	t.Parallel()
+
+	f, err := parseFilter(`userName eq "alice@example.com"`)
+	require.NoError(t, err)
+	assert.Equal(t, &filter{attr: "username", value: "alice@example.com"}, f)
+
+	f, err = parseFilter(`externalId EQ 1234`)
+	require.NoError(t, err)
+	assert.Equal(t, &filter{attr: "externalid", value: "1234"}, f)
+
+	for _, expr := range []string{`userName sw "a"`, `userName eq`, `userName eq "a`} {
+		_, err := parseFilter(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestParsePatchPath(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		path   string
+		expect *patchPath
+	}{
+		{"active", &patchPath{attr: "active"}},
+		{"name.givenName", &patchPath{attr: "name", subAttr: "givenname"}},
+		{`emails[type eq "work"].value`, &patchPath{attr: "emails", filter: &filter{attr: "type", value: "work"}, subAttr: "value"}},
+		{`members[value eq "u1"]`, &patchPath{attr: "members", filter: &filter{attr: "value", value: "u1"}}},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:userName", &patchPath{attr: "username"}},
+	} {
+		p, err := parsePatchPath(tc.path)
+		assert.NoError(t, err, tc.path)
+		assert.Equal(t, tc.expect, p, tc.path)
+	}
+
+	_, err := parsePatchPath(`members[value eq "u1"`)
+	assert.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	li := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(s, internal_databroker.New())
+	go s.Serve(li)
+	t.Cleanup(s.Stop)
+	cc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	client := databroker.NewDataBrokerServiceClient(cc)
+
+	var signedOut []string
+	h := New("TOKEN", client, mockSessionServiceClient{
+		signOutAll: func(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error) {
+			signedOut = append(signedOut, in.GetUserId())
+			return &session.SignOutAllResponse{}, nil
+		},
+	})
+
+	do := func(method, path, body string) (int, map[string]any) {
+		r := httptest.NewRequest(method, "https://authenticate.example.com"+PathPrefix+path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer TOKEN")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var res map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	getDirectoryUser := func(id string) *directory.User {
+		u, err := databroker.GetViaJSON[directory.User](ctx, client, directory.UserRecordType, id)
+		require.NoError(t, err)
+		return u
+	}
+
+	getStoredGroup := func(id string) *storedGroup {
+		g, err := databroker.GetViaJSON[storedGroup](ctx, client, directory.GroupRecordType, id)
+		require.NoError(t, err)
+		return g
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, PathPrefix+"/Users", nil)
+		r.Header.Set("Authorization", "Bearer WRONG")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+	})
+
+	code, res := do(http.MethodPost, "/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"externalId": "u1",
+		"userName": "alice@example.com",
+		"name": {"givenName": "Alice", "familyName": "Smith"},
+		"emails": [{"value": "alice@example.com", "type": "work", "primary": true}],
+		"active": true
+	}`)
+	require.Equal(t, http.StatusCreated, code, res)
+	assert.Equal(t, "u1", res["id"])
+	assert.Equal(t, "Alice Smith", res["displayName"])
+	assert.Equal(t, &directory.User{ID: "u1", DisplayName: "Alice Smith", Email: "alice@example.com"}, getDirectoryUser("u1"))
+
+	code, _ = do(http.MethodPost, "/Users", `{"externalId": "u1", "userName": "alice@example.com"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, res = do(http.MethodGet, "/Users?filter="+`userName+eq+"alice@example.com"`, "")
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Equal(t, float64(1), res["totalResults"])
+	code, res = do(http.MethodGet, "/Users?filter="+`userName+eq+"bob@example.com"`, "")
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Equal(t, float64(0), res["totalResults"])
+
+	code, res = do(http.MethodPost, "/Groups", `{"displayName": "admins", "members": [{"value": "u1"}]}`)
+	require.Equal(t, http.StatusCreated, code, res)
+	groupID := res["id"].(string)
+	assert.Equal(t, []string{groupID}, getDirectoryUser("u1").GroupIDs)
+
+	code, res = do(http.MethodGet, "/Users/u1", "")
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Equal(t, []any{map[string]any{
+		"value":   groupID,
+		"display": "admins",
+		"$ref":    "https://authenticate.example.com/scim/v2/Groups/" + groupID,
+	}}, res["groups"])
+
+	code, res = do(http.MethodPatch, "/Groups/"+groupID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "displayName", "value": "owners"},
+			{"op": "remove", "path": "members[value eq \"u1\"]"}
+		]
+	}`)
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Equal(t, "owners", res["displayName"])
+	assert.Nil(t, res["members"])
+	assert.Empty(t, getDirectoryUser("u1").GroupIDs)
+
+	code, res = do(http.MethodPatch, "/Groups/"+groupID, `{
+		"Operations": [{"op": "Add", "path": "members", "value": [{"value": "u1"}]}]
+	}`)
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Len(t, res["members"], 1)
+
+	code, res = do(http.MethodPatch, "/Users/u1", `{
+		"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+	}`)
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Equal(t, false, res["active"])
+	assert.Equal(t, []string{"u1"}, signedOut)
+
+	code, res = do(http.MethodPost, "/Groups", `{"displayName": "eng", "members": [{"value": "`+groupID+`"}]}`)
+	require.Equal(t, http.StatusCreated, code, res)
+	parentID := res["id"].(string)
+	assert.Equal(t, []any{map[string]any{
+		"value":   groupID,
+		"display": "owners",
+		"$ref":    "https://authenticate.example.com/scim/v2/Groups/" + groupID,
+	}}, res["members"])
+	assert.Equal(t, []string{parentID}, getStoredGroup(groupID).ParentIDs)
+
+	code, _ = do(http.MethodDelete, "/Groups/"+parentID, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Empty(t, getStoredGroup(groupID).ParentIDs)
+
+	code, _ = do(http.MethodDelete, "/Groups/"+groupID, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Empty(t, getDirectoryUser("u1").GroupIDs)
+
+	code, _ = do(http.MethodDelete, "/Users/u1", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, res = do(http.MethodGet, "/Users/u1", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "404", res["status"])
+}
+
+type mockSessionServiceClient struct {
+	session.SessionServiceClient
+
+	signOutAll func(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error)
+}
+
+func (m mockSessionServiceClient) SignOutAll(ctx context.Context, in *session.SignOutAllRequest, opts ...grpc.CallOption) (*session.SignOutAllResponse, error) {
+	return m.signOutAll(ctx, in, opts...)
+}
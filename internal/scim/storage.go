@@ -0,0 +1,163 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pomerium/datasource/pkg/directory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+const queryLimit = 100
+
+// storedUser is a directory user with the SCIM attributes which have no
+// equivalent in the directory.
+type storedUser struct {
+	directory.User
+	UserName   string `json:"user_name,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Active     bool   `json:"active"`
+}
+
+// storedGroup is a directory group with the SCIM attributes which have no
+// equivalent in the directory. Group members are stored as the group ids of
+// the directory users, and nested groups as the parent ids of the member
+// groups.
+type storedGroup struct {
+	directory.Group
+	ExternalID string   `json:"external_id,omitempty"`
+	ParentIDs  []string `json:"parent_ids,omitempty"`
+}
+
+func (h *handler) getUser(ctx context.Context, id string) (*storedUser, error) {
+	return getRecord[storedUser](ctx, h.dataBrokerClient, directory.UserRecordType, id)
+}
+
+func (h *handler) getGroup(ctx context.Context, id string) (*storedGroup, error) {
+	return getRecord[storedGroup](ctx, h.dataBrokerClient, directory.GroupRecordType, id)
+}
+
+func (h *handler) listUsers(ctx context.Context) ([]*storedUser, error) {
+	return listRecords[storedUser](ctx, h.dataBrokerClient, directory.UserRecordType)
+}
+
+func (h *handler) listGroups(ctx context.Context) ([]*storedGroup, error) {
+	return listRecords[storedGroup](ctx, h.dataBrokerClient, directory.GroupRecordType)
+}
+
+func (h *handler) putUsers(ctx context.Context, users ...*storedUser) error {
+	records := make([]*databroker.Record, 0, len(users))
+	for _, u := range users {
+		record, err := newRecord(directory.UserRecordType, u.ID, u)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	return h.put(ctx, records)
+}
+
+func (h *handler) putGroups(ctx context.Context, groups ...*storedGroup) error {
+	records := make([]*databroker.Record, 0, len(groups))
+	for _, g := range groups {
+		record, err := newRecord(directory.GroupRecordType, g.ID, g)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	return h.put(ctx, records)
+}
+
+func (h *handler) delete(ctx context.Context, recordType, id string) error {
+	return h.put(ctx, []*databroker.Record{{
+		Type:      recordType,
+		Id:        id,
+		Data:      protoutil.NewAny(new(structpb.Struct)),
+		DeletedAt: timestamppb.Now(),
+	}})
+}
+
+func (h *handler) put(ctx context.Context, records []*databroker.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	_, err := h.dataBrokerClient.Put(ctx, &databroker.PutRequest{Records: records})
+	if err != nil {
+		return fmt.Errorf("scim: error storing records: %w", err)
+	}
+	return nil
+}
+
+// getRecord returns the record with the given type and id, or nil if there
+// is no such record.
+func getRecord[T any](ctx context.Context, client databroker.DataBrokerServiceClient, recordType, id string) (*T, error) {
+	obj, err := databroker.GetViaJSON[T](ctx, client, recordType, id)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("scim: error getting record: %w", err)
+	}
+	return obj, nil
+}
+
+func listRecords[T any](ctx context.Context, client databroker.DataBrokerServiceClient, recordType string) ([]*T, error) {
+	var objs []*T
+	for offset := int64(0); ; offset += queryLimit {
+		res, err := client.Query(ctx, &databroker.QueryRequest{
+			Type:   recordType,
+			Offset: offset,
+			Limit:  queryLimit,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scim: error querying records: %w", err)
+		}
+
+		for _, record := range res.GetRecords() {
+			msg, err := record.GetData().UnmarshalNew()
+			if err != nil {
+				return nil, fmt.Errorf("scim: error unmarshaling record: %w", err)
+			}
+			bs, err := protojson.Marshal(msg)
+			if err != nil {
+				return nil, fmt.Errorf("scim: error unmarshaling record: %w", err)
+			}
+			obj := new(T)
+			if err = json.Unmarshal(bs, obj); err != nil {
+				return nil, fmt.Errorf("scim: error unmarshaling record: %w", err)
+			}
+			objs = append(objs, obj)
+		}
+
+		if offset+queryLimit >= res.GetTotalCount() {
+			break
+		}
+	}
+	return objs, nil
+}
+
+func newRecord(recordType, id string, obj any) (*databroker.Record, error) {
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("scim: error marshaling record: %w", err)
+	}
+	data := new(structpb.Struct)
+	if err = protojson.Unmarshal(bs, data); err != nil {
+		return nil, fmt.Errorf("scim: error marshaling record: %w", err)
+	}
+	return &databroker.Record{
+		Type: recordType,
+		Id:   id,
+		Data: protoutil.NewAny(data),
+	}, nil
+}
@@ -0,0 +1,406 @@
+package scim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slices"
+
+	"github.com/pomerium/datasource/pkg/directory"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// userResource is the SCIM representation of a user.
+type userResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Name        *userName    `json:"name,omitempty"`
+	Emails      []multiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Groups      []reference  `json:"groups,omitempty"`
+	Meta        *meta        `json:"meta,omitempty"`
+}
+
+type userName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type multiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type reference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+func (h *handler) listUsersHandler(w http.ResponseWriter, r *http.Request) error {
+	var f *filter
+	if expr := r.FormValue("filter"); expr != "" {
+		var err error
+		f, err = parseFilter(expr)
+		if err != nil {
+			return err
+		}
+	}
+
+	users, err := h.listUsers(r.Context())
+	if err != nil {
+		return err
+	}
+	groupNames, err := h.getGroupNames(r.Context())
+	if err != nil {
+		return err
+	}
+
+	resources := []any{}
+	for _, u := range users {
+		if f != nil && !f.matches(map[string]string{
+			"id":          u.ID,
+			"username":    u.UserName,
+			"externalid":  u.ExternalID,
+			"displayname": u.DisplayName,
+			"emails":      u.Email,
+		}) {
+			continue
+		}
+		resources = append(resources, newUserResource(r, u, groupNames))
+	}
+
+	startIndex, count := getPagination(r)
+	return writeJSON(w, http.StatusOK, newListResponse(resources, startIndex, count))
+}
+
+func (h *handler) getUserHandler(w http.ResponseWriter, r *http.Request) error {
+	u, err := h.getExistingUser(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	return h.writeUser(w, r, http.StatusOK, u)
+}
+
+func (h *handler) createUser(w http.ResponseWriter, r *http.Request) error {
+	var res userResource
+	if err := readJSON(r, &res); err != nil {
+		return err
+	}
+	if res.UserName == "" {
+		return newError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+
+	// the user id must match the user id of pomerium sessions, which is the
+	// subject of the identity provider, so the external id is preferred
+	u := &storedUser{Active: true}
+	u.ID = res.ExternalID
+	if u.ID == "" {
+		u.ID = res.UserName
+	}
+	existing, err := h.getUser(r.Context(), u.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return newError(http.StatusConflict, "uniqueness", "user already exists")
+	}
+
+	applyUserResource(u, &res)
+	if err := h.putUsers(r.Context(), u); err != nil {
+		return err
+	}
+
+	log.Info(r.Context()).Str("user-id", u.ID).Msg("scim: created user")
+	w.Header().Set("Location", locationURL(r, "User", u.ID))
+	return h.writeUser(w, r, http.StatusCreated, u)
+}
+
+func (h *handler) replaceUser(w http.ResponseWriter, r *http.Request) error {
+	u, err := h.getExistingUser(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	var res userResource
+	if err := readJSON(r, &res); err != nil {
+		return err
+	}
+	if res.UserName == "" {
+		return newError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+
+	wasActive := u.Active
+	u.User = directory.User{ID: u.ID, GroupIDs: u.GroupIDs}
+	u.ExternalID, u.GivenName, u.FamilyName = "", "", ""
+	u.Active = true
+	applyUserResource(u, &res)
+	if err := h.updateUser(r.Context(), u, wasActive); err != nil {
+		return err
+	}
+	return h.writeUser(w, r, http.StatusOK, u)
+}
+
+func (h *handler) patchUser(w http.ResponseWriter, r *http.Request) error {
+	u, err := h.getExistingUser(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	var req patchRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if err := req.validate(); err != nil {
+		return err
+	}
+
+	wasActive := u.Active
+	for _, op := range req.Operations {
+		if err := applyUserPatch(u, op); err != nil {
+			return err
+		}
+	}
+	if err := h.updateUser(r.Context(), u, wasActive); err != nil {
+		return err
+	}
+	return h.writeUser(w, r, http.StatusOK, u)
+}
+
+func (h *handler) deleteUser(w http.ResponseWriter, r *http.Request) error {
+	u, err := h.getExistingUser(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	if err := h.delete(r.Context(), directory.UserRecordType, u.ID); err != nil {
+		return err
+	}
+	log.Info(r.Context()).Str("user-id", u.ID).Msg("scim: deleted user")
+	if err := h.signOut(r.Context(), u.ID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *handler) getExistingUser(ctx context.Context, id string) (*storedUser, error) {
+	u, err := h.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, newError(http.StatusNotFound, "", "user not found")
+	}
+	return u, nil
+}
+
+// updateUser stores the user, and signs the user out everywhere if the user
+// has been deactivated.
+func (h *handler) updateUser(ctx context.Context, u *storedUser, wasActive bool) error {
+	if err := h.putUsers(ctx, u); err != nil {
+		return err
+	}
+	if wasActive && !u.Active {
+		log.Info(ctx).Str("user-id", u.ID).Msg("scim: deactivated user")
+		return h.signOut(ctx, u.ID)
+	}
+	return nil
+}
+
+func (h *handler) signOut(ctx context.Context, userID string) error {
+	if h.sessionServiceClient == nil {
+		return nil
+	}
+	_, err := h.sessionServiceClient.SignOutAll(ctx, &session.SignOutAllRequest{UserId: userID})
+	if err != nil {
+		return fmt.Errorf("scim: error signing out user: %w", err)
+	}
+	return nil
+}
+
+func (h *handler) writeUser(w http.ResponseWriter, r *http.Request, status int, u *storedUser) error {
+	groupNames, err := h.getGroupNames(r.Context())
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, status, newUserResource(r, u, groupNames))
+}
+
+func (h *handler) getGroupNames(ctx context.Context) (map[string]string, error) {
+	groups, err := h.listGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupNames := make(map[string]string, len(groups))
+	for _, g := range groups {
+		groupNames[g.ID] = g.Name
+	}
+	return groupNames, nil
+}
+
+func newUserResource(r *http.Request, u *storedUser, groupNames map[string]string) *userResource {
+	active := u.Active
+	res := &userResource{
+		Schemas:     []string{schemaUser},
+		ID:          u.ID,
+		ExternalID:  u.ExternalID,
+		UserName:    u.UserName,
+		DisplayName: u.DisplayName,
+		Active:      &active,
+		Meta: &meta{
+			ResourceType: "User",
+			Location:     locationURL(r, "User", u.ID),
+		},
+	}
+	if u.GivenName != "" || u.FamilyName != "" {
+		res.Name = &userName{GivenName: u.GivenName, FamilyName: u.FamilyName}
+	}
+	if u.Email != "" {
+		res.Emails = []multiValue{{Value: u.Email, Type: "work", Primary: true}}
+	}
+	for _, groupID := range u.GroupIDs {
+		res.Groups = append(res.Groups, reference{
+			Value:   groupID,
+			Display: groupNames[groupID],
+			Ref:     locationURL(r, "Group", groupID),
+		})
+	}
+	return res
+}
+
+// applyUserResource sets the attributes of the user from the resource. The
+// id and group memberships of the user are not changed.
+func applyUserResource(u *storedUser, res *userResource) {
+	u.UserName = res.UserName
+	u.ExternalID = res.ExternalID
+	if res.Active != nil {
+		u.Active = *res.Active
+	}
+	if res.Name != nil {
+		u.GivenName, u.FamilyName = res.Name.GivenName, res.Name.FamilyName
+	}
+	u.Email = primaryValue(res.Emails)
+
+	u.DisplayName = res.DisplayName
+	if u.DisplayName == "" && res.Name != nil {
+		u.DisplayName = res.Name.Formatted
+		if u.DisplayName == "" {
+			u.DisplayName = strings.TrimSpace(res.Name.GivenName + " " + res.Name.FamilyName)
+		}
+	}
+}
+
+func applyUserPatch(u *storedUser, op patchOperation) error {
+	remove := strings.EqualFold(op.Op, "remove")
+
+	// without a path the value is a partial resource
+	if op.Path == "" {
+		attrs, ok := op.Value.(map[string]any)
+		if !ok || remove {
+			return newError(http.StatusBadRequest, "noTarget", "a path is required")
+		}
+		for path, value := range attrs {
+			err := applyUserPatch(u, patchOperation{Op: op.Op, Path: path, Value: value})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	p, err := parsePatchPath(op.Path)
+	if err != nil {
+		return err
+	}
+	if remove {
+		op.Value = nil
+	}
+
+	switch p.attr {
+	case "active":
+		if remove {
+			return newError(http.StatusBadRequest, "mutability", "active can't be removed")
+		}
+		u.Active, err = toBool(op.Value)
+	case "username":
+		if remove {
+			return newError(http.StatusBadRequest, "mutability", "userName can't be removed")
+		}
+		u.UserName, err = toString(op.Value)
+	case "externalid":
+		u.ExternalID, err = toString(op.Value)
+	case "displayname":
+		u.DisplayName, err = toString(op.Value)
+	case "name":
+		err = applyUserNamePatch(u, p.subAttr, op.Value)
+	case "emails":
+		if p.subAttr != "" || p.filter != nil {
+			u.Email, err = toString(op.Value)
+			break
+		}
+		var emails []multiValue
+		if values, ok := op.Value.([]any); ok {
+			for _, value := range values {
+				if m, ok := value.(map[string]any); ok {
+					v, _ := m["value"].(string)
+					primary, _ := toBool(m["primary"])
+					emails = append(emails, multiValue{Value: v, Primary: primary})
+				}
+			}
+		}
+		u.Email = primaryValue(emails)
+	default:
+		// other attributes, such as titles or addresses, aren't stored
+	}
+	return err
+}
+
+func applyUserNamePatch(u *storedUser, subAttr string, value any) error {
+	if subAttr == "" {
+		m, _ := value.(map[string]any)
+		for k, v := range m {
+			if err := applyUserNamePatch(u, strings.ToLower(k), v); err != nil {
+				return err
+			}
+		}
+		if m == nil {
+			u.GivenName, u.FamilyName = "", ""
+		}
+		return nil
+	}
+
+	var err error
+	switch subAttr {
+	case "givenname":
+		u.GivenName, err = toString(value)
+	case "familyname":
+		u.FamilyName, err = toString(value)
+	case "formatted":
+		u.DisplayName, err = toString(value)
+	}
+	return err
+}
+
+// primaryValue returns the primary value, or else the first value.
+func primaryValue(values []multiValue) string {
+	i := slices.IndexFunc(values, func(v multiValue) bool { return v.Primary })
+	if i < 0 {
+		i = 0
+	}
+	if i < len(values) {
+		return values[i].Value
+	}
+	return ""
+}
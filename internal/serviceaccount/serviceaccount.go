@@ -0,0 +1,166 @@
+// Package serviceaccount implements a REST API for managing service accounts
+// with the databroker's service account service.
+package serviceaccount
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// PathPrefix is the path prefix of the service account endpoints.
+const PathPrefix = "/api/v1/service_accounts"
+
+type handler struct {
+	bearerToken [sha256.Size]byte
+	client      user.ServiceAccountServiceClient
+	router      *mux.Router
+}
+
+// New creates a new service account handler. Requests must be authenticated
+// with the bearer token.
+//
+//	GET    /api/v1/service_accounts?user_id=...   lists service accounts
+//	POST   /api/v1/service_accounts               creates a service account
+//	POST   /api/v1/service_accounts/{id}/rotate   rotates a service account
+//	DELETE /api/v1/service_accounts/{id}          revokes a service account
+func New(bearerToken string, client user.ServiceAccountServiceClient) http.Handler {
+	h := &handler{
+		bearerToken: sha256.Sum256([]byte(bearerToken)),
+		client:      client,
+	}
+
+	h.router = mux.NewRouter()
+	r := h.router.PathPrefix(PathPrefix).Subrouter()
+	r.Path("").Handler(handlerFunc(h.list)).Methods(http.MethodGet)
+	r.Path("").Handler(handlerFunc(h.create)).Methods(http.MethodPost)
+	r.Path("/{id}/rotate").Handler(handlerFunc(h.rotate)).Methods(http.MethodPost)
+	r.Path("/{id}").Handler(handlerFunc(h.revoke)).Methods(http.MethodDelete)
+	r.NotFoundHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return status.Error(codes.NotFound, "not found")
+	})
+	r.MethodNotAllowedHandler = handlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return nil
+	})
+	return h
+}
+
+// ServeHTTP serves a service account request.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	tokenHash := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(tokenHash[:], h.bearerToken[:]) != 1 {
+		writeError(w, r, http.StatusUnauthorized, "invalid bearer token")
+		return
+	}
+	h.router.ServeHTTP(w, r)
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) error {
+	res, err := h.client.ListServiceAccounts(r.Context(), &user.ListServiceAccountsRequest{
+		UserId: r.FormValue("user_id"),
+	})
+	if err != nil {
+		return err
+	}
+	return writeProto(w, http.StatusOK, res)
+}
+
+func (h *handler) create(w http.ResponseWriter, r *http.Request) error {
+	req := new(user.CreateServiceAccountRequest)
+	if err := readProto(r, req); err != nil {
+		return err
+	}
+	res, err := h.client.CreateServiceAccount(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	return writeProto(w, http.StatusCreated, res)
+}
+
+func (h *handler) rotate(w http.ResponseWriter, r *http.Request) error {
+	// the body is optional, it may set a new expiry
+	req := new(user.RotateServiceAccountRequest)
+	if r.ContentLength != 0 {
+		if err := readProto(r, req); err != nil {
+			return err
+		}
+	}
+	req.Id = mux.Vars(r)["id"]
+	res, err := h.client.RotateServiceAccount(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	return writeProto(w, http.StatusOK, res)
+}
+
+func (h *handler) revoke(w http.ResponseWriter, r *http.Request) error {
+	_, err := h.client.RevokeServiceAccount(r.Context(), &user.RevokeServiceAccountRequest{
+		Id: mux.Vars(r)["id"],
+	})
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f handlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := f(w, r)
+	if err == nil {
+		return
+	}
+
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		writeError(w, r, http.StatusBadRequest, status.Convert(err).Message())
+	case codes.NotFound:
+		writeError(w, r, http.StatusNotFound, status.Convert(err).Message())
+	default:
+		log.Error(r.Context()).Err(err).Msg("serviceaccount: error handling request")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, _ *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": message})
+}
+
+func writeProto(w http.ResponseWriter, status int, msg proto.Message) error {
+	bs, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(bs)
+	return err
+}
+
+func readProto(r *http.Request, msg proto.Message) error {
+	bs, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal(bs, msg); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid request body: "+err.Error())
+	}
+	return nil
+}
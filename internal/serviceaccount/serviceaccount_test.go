@@ -0,0 +1,110 @@
+package serviceaccount
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+type mockClient struct {
+	user.ServiceAccountServiceClient
+	accounts map[string]*user.ServiceAccount
+}
+
+func (m *mockClient) CreateServiceAccount(_ context.Context, in *user.CreateServiceAccountRequest, _ ...grpc.CallOption) (*user.CreateServiceAccountResponse, error) {
+	if in.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	sa := &user.ServiceAccount{Id: "sa1", UserId: in.GetUserId(), Audiences: in.GetAudiences()}
+	m.accounts[sa.Id] = sa
+	return &user.CreateServiceAccountResponse{ServiceAccount: sa, Jwt: "JWT1"}, nil
+}
+
+func (m *mockClient) ListServiceAccounts(_ context.Context, in *user.ListServiceAccountsRequest, _ ...grpc.CallOption) (*user.ListServiceAccountsResponse, error) {
+	res := new(user.ListServiceAccountsResponse)
+	for _, sa := range m.accounts {
+		if in.GetUserId() == "" || sa.GetUserId() == in.GetUserId() {
+			res.ServiceAccounts = append(res.ServiceAccounts, sa)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockClient) RotateServiceAccount(_ context.Context, in *user.RotateServiceAccountRequest, _ ...grpc.CallOption) (*user.RotateServiceAccountResponse, error) {
+	sa, ok := m.accounts[in.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &user.RotateServiceAccountResponse{ServiceAccount: sa, Jwt: "JWT2"}, nil
+}
+
+func (m *mockClient) RevokeServiceAccount(_ context.Context, in *user.RevokeServiceAccountRequest, _ ...grpc.CallOption) (*user.RevokeServiceAccountResponse, error) {
+	if _, ok := m.accounts[in.GetId()]; !ok {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	delete(m.accounts, in.GetId())
+	return &user.RevokeServiceAccountResponse{}, nil
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	h := New("TOKEN", &mockClient{accounts: map[string]*user.ServiceAccount{}})
+	do := func(method, path, body string) (int, map[string]any) {
+		r := httptest.NewRequest(method, "https://authenticate.example.com"+path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer TOKEN")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var res map[string]any
+		if w.Body.Len() > 0 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w.Code, res
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com"+PathPrefix, nil)
+		r.Header.Set("Authorization", "Bearer WRONG")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	code, _ := do(http.MethodPost, PathPrefix, `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(http.MethodPost, PathPrefix, `not json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, res := do(http.MethodPost, PathPrefix, `{"userId":"u1","audiences":["from.example.com"]}`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "JWT1", res["jwt"])
+	assert.Equal(t, "u1", res["serviceAccount"].(map[string]any)["userId"])
+
+	code, res = do(http.MethodGet, PathPrefix+"?user_id=u1", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, res["serviceAccounts"], 1)
+	_, res = do(http.MethodGet, PathPrefix+"?user_id=u2", "")
+	assert.Empty(t, res["serviceAccounts"])
+
+	code, res = do(http.MethodPost, PathPrefix+"/sa1/rotate", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "JWT2", res["jwt"])
+
+	code, _ = do(http.MethodDelete, PathPrefix+"/sa1", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = do(http.MethodDelete, PathPrefix+"/sa1", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do(http.MethodPut, PathPrefix+"/sa1", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
@@ -0,0 +1,97 @@
+// Package sessionbinding contains the request attributes sessions are bound
+// to when they're created.
+package sessionbinding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// A Binding contains the attributes of a request a session is bound to.
+// Empty attributes are not bound.
+type Binding struct {
+	ClientCertificateFingerprint string
+	IPPrefix                     string
+	UserAgentHash                string
+}
+
+// Get returns the binding attributes of a request. The client certificate is
+// DER-encoded.
+func Get(options *config.Options, clientCertificate []byte, ip, userAgent string) Binding {
+	var binding Binding
+	if options.SessionBindClientCertificate {
+		binding.ClientCertificateFingerprint = GetClientCertificateFingerprint(clientCertificate)
+	}
+	if options.GetSessionBindingMode() != config.SessionBindingModeOff {
+		binding.IPPrefix = GetIPPrefix(ip, options.SessionBindingIPv4PrefixLength, options.SessionBindingIPv6PrefixLength)
+		binding.UserAgentHash = GetUserAgentHash(userAgent)
+	}
+	return binding
+}
+
+// Apply binds the session to the binding attributes.
+func (binding Binding) Apply(s *session.Session) {
+	s.ClientCertificateFingerprint = binding.ClientCertificateFingerprint
+	s.IpPrefix = binding.IPPrefix
+	s.UserAgentHash = binding.UserAgentHash
+}
+
+// GetClientCertificateFingerprint returns the hex-encoded SHA-256
+// fingerprint of a DER-encoded certificate, or an empty string if there is
+// none.
+func GetClientCertificateFingerprint(clientCertificate []byte) string {
+	if len(clientCertificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(clientCertificate)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetIPPrefix returns the prefix of the given length containing the ip, or an
+// empty string if the ip is invalid or the prefix length is zero.
+func GetIPPrefix(ip string, ipv4PrefixLength, ipv6PrefixLength int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	bits := ipv6PrefixLength
+	if addr.Is4() {
+		bits = ipv4PrefixLength
+	}
+	if bits <= 0 {
+		return ""
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// IPPrefixContains returns true if the bound prefix contains the current
+// prefix. Prefixes are compared by containment so that changing the
+// configured prefix length doesn't invalidate existing sessions.
+func IPPrefixContains(bound, current string) bool {
+	boundPrefix, err := netip.ParsePrefix(bound)
+	if err != nil {
+		return false
+	}
+	currentPrefix, err := netip.ParsePrefix(current)
+	if err != nil {
+		return false
+	}
+	return boundPrefix.Contains(currentPrefix.Addr()) && currentPrefix.Bits() >= boundPrefix.Bits()
+}
+
+// GetUserAgentHash returns the hex-encoded hash of a User-Agent.
+func GetUserAgentHash(userAgent string) string {
+	return hex.EncodeToString(cryptutil.Hash("session binding user agent", []byte(userAgent)))
+}
@@ -0,0 +1,41 @@
+package sessionbinding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestGet(t *testing.T) {
+	options := config.NewDefaultOptions()
+	assert.Equal(t, Binding{}, Get(options, []byte("cert"), "10.0.0.1", "agent"))
+
+	options.SessionBindClientCertificate = true
+	options.SessionBinding = config.SessionBindingModeEnforce
+	binding := Get(options, []byte("cert"), "10.0.0.1", "agent")
+	assert.Len(t, binding.ClientCertificateFingerprint, 64)
+	assert.Equal(t, "10.0.0.0/24", binding.IPPrefix)
+	assert.Equal(t, GetUserAgentHash("agent"), binding.UserAgentHash)
+
+	s := &session.Session{Id: "s1"}
+	binding.Apply(s)
+	assert.Equal(t, binding.ClientCertificateFingerprint, s.GetClientCertificateFingerprint())
+	assert.Equal(t, binding.IPPrefix, s.GetIpPrefix())
+	assert.Equal(t, binding.UserAgentHash, s.GetUserAgentHash())
+}
+
+func TestGetIPPrefix(t *testing.T) {
+	assert.Equal(t, "192.168.1.0/24", GetIPPrefix("192.168.1.10", 24, 64))
+	assert.Equal(t, "2001:db8:1:2::/64", GetIPPrefix("2001:db8:1:2:3:4:5:6", 24, 64))
+	assert.Equal(t, "", GetIPPrefix("192.168.1.10", 0, 64))
+	assert.Equal(t, "", GetIPPrefix("invalid", 24, 64))
+}
+
+func TestIPPrefixContains(t *testing.T) {
+	assert.True(t, IPPrefixContains("10.0.0.0/16", "10.0.1.0/24"))
+	assert.False(t, IPPrefixContains("10.0.1.0/24", "10.0.0.0/16"))
+	assert.False(t, IPPrefixContains("10.0.0.0/24", ""))
+}
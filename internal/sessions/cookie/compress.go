@@ -0,0 +1,75 @@
+package cookie
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	// CompressedCanaryByte is the byte value used as a prefix to distinguish
+	// compressed cookie values. Like ChunkedCanaryByte, it *should not* be
+	// valid base64.
+	CompressedCanaryByte byte = '~'
+	// CompressionThreshold is the size above which cookie values are
+	// compressed. Smaller values are stored as is.
+	CompressionThreshold = 1024
+	// maxDecompressedSize limits the size of decompressed values to prevent
+	// decompression bombs.
+	maxDecompressedSize = 1 << 20
+)
+
+var errDecompressedSize = errors.New("internal/sessions: decompressed cookie is too large")
+
+// compress deflates values larger than the compression threshold. Values are
+// only compressed if doing so makes them smaller.
+func compress(value string) string {
+	if len(value) <= CompressionThreshold {
+		return value
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return value
+	}
+	if _, err = io.WriteString(w, value); err != nil {
+		return value
+	}
+	if err = w.Close(); err != nil {
+		return value
+	}
+
+	compressed := string(CompressedCanaryByte) + base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	if len(compressed) >= len(value) {
+		return value
+	}
+	return compressed
+}
+
+// decompress inflates values which were compressed by compress. Other values
+// are returned as is.
+func decompress(value string) (string, error) {
+	if !strings.HasPrefix(value, string(CompressedCanaryByte)) {
+		return value, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value[1:])
+	if err != nil {
+		return "", err
+	}
+	r := flate.NewReader(bytes.NewReader(raw))
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxDecompressedSize {
+		return "", errDecompressedSize
+	}
+	return string(data), nil
+}
@@ -2,14 +2,19 @@
 package cookie
 
 import (
+	"crypto/hmac"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pomerium/pomerium/internal/encoding"
 	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
 var (
@@ -35,6 +40,14 @@ const (
 	MaxNumChunks = 5
 )
 
+// chunkHeaderVersion prefixes the header of multi-part cookies which are
+// authenticated with a MAC keyed by the shared secret.
+const chunkHeaderVersion = "v2"
+
+// errChunkIntegrity is returned when the chunks of a multi-part cookie do not
+// match the MAC stored in the first chunk.
+var errChunkIntegrity = errors.New("internal/sessions: chunked cookie failed integrity check")
+
 // Options holds options for Store
 type Options struct {
 	Name     string
@@ -42,6 +55,28 @@ type Options struct {
 	Expire   time.Duration
 	HTTPOnly bool
 	Secure   bool
+	// Partitioned stores the cookie in partitioned storage (CHIPS) so that it
+	// remains available when the site is embedded in a third-party context.
+	Partitioned bool
+	// SameSite sets the SameSite attribute of the cookie.
+	SameSite http.SameSite
+	// ByHost overrides cookie attributes for requests to the given hosts, so
+	// that routes can be isolated or embedded cross-site.
+	ByHost map[string]HostOptions
+	// SharedKey is the shared secret. It keys the MAC which authenticates the
+	// chunks of a multi-part cookie.
+	SharedKey []byte
+}
+
+// HostOptions override the cookie attributes for requests to a host. Zero
+// values inherit the attributes from Options.
+type HostOptions struct {
+	// Path restricts the cookie to a path of the host.
+	Path string
+	// Domain overrides the domain of the cookie.
+	Domain string
+	// SameSite overrides the SameSite attribute of the cookie.
+	SameSite http.SameSite
 }
 
 // A GetOptionsFunc is a getter for cookie options.
@@ -52,6 +87,14 @@ type Store struct {
 	getOptions GetOptionsFunc
 	encoder    encoding.Marshaler
 	decoder    encoding.Unmarshaler
+
+	// dataBrokerClient is set when the store is in opaque mode, in which case
+	// the cookie only holds a reference to a session stored in the databroker.
+	dataBrokerClient databroker.DataBrokerServiceClient
+
+	// encrypter is set when the store is in encrypted mode, in which case the
+	// cookie holds the session JWT wrapped in a JWE.
+	encrypter encoding.MarshalUnmarshaler
 }
 
 // NewStore returns a new store that implements the SessionStore interface
@@ -76,31 +119,82 @@ func NewCookieLoader(getOptions GetOptionsFunc, dencoder encoding.Unmarshaler) (
 	return cs, nil
 }
 
+// NewOpaqueStore returns a new store that implements the SessionStore
+// interface using http cookies which only contain a random session reference.
+// The session itself is persisted in the databroker.
+func NewOpaqueStore(
+	getOptions GetOptionsFunc,
+	encoder encoding.MarshalUnmarshaler,
+	dataBrokerClient databroker.DataBrokerServiceClient,
+) (sessions.SessionStore, error) {
+	cs, err := NewOpaqueCookieLoader(getOptions, encoder, dataBrokerClient)
+	if err != nil {
+		return nil, err
+	}
+	cs.encoder = encoder
+	return cs, nil
+}
+
+// NewOpaqueCookieLoader returns a new store that implements the SessionLoader
+// interface using http cookies which only contain a random session reference.
+func NewOpaqueCookieLoader(
+	getOptions GetOptionsFunc,
+	dencoder encoding.Unmarshaler,
+	dataBrokerClient databroker.DataBrokerServiceClient,
+) (*Store, error) {
+	if dataBrokerClient == nil {
+		return nil, fmt.Errorf("internal/sessions: databroker client cannot be nil")
+	}
+	cs, err := NewCookieLoader(getOptions, dencoder)
+	if err != nil {
+		return nil, err
+	}
+	cs.dataBrokerClient = dataBrokerClient
+	return cs, nil
+}
+
+// NewEncryptedStore returns a new store that implements the SessionStore
+// interface using http cookies which hold the session encrypted, so that its
+// claims can't be read client-side.
+func NewEncryptedStore(
+	getOptions GetOptionsFunc,
+	encoder encoding.MarshalUnmarshaler,
+	encrypter encoding.MarshalUnmarshaler,
+) (sessions.SessionStore, error) {
+	if encrypter == nil {
+		return nil, fmt.Errorf("internal/sessions: encrypter cannot be nil")
+	}
+	cs, err := NewCookieLoader(getOptions, encoder)
+	if err != nil {
+		return nil, err
+	}
+	cs.encoder = encoder
+	cs.encrypter = encrypter
+	return cs, nil
+}
+
 func newStore(getOptions GetOptionsFunc) *Store {
 	return &Store{
 		getOptions: getOptions,
 	}
 }
 
-func (cs *Store) makeCookie(value string) *http.Cookie {
-	opts := cs.getOptions()
-	return &http.Cookie{
-		Name:     opts.Name,
-		Value:    value,
-		Path:     "/",
-		Domain:   opts.Domain,
-		HttpOnly: opts.HTTPOnly,
-		Secure:   opts.Secure,
-		Expires:  timeNow().Add(opts.Expire),
-	}
+func (cs *Store) makeCookie(r *http.Request, value string) *http.Cookie {
+	return cs.getOptions().NewCookie(r, value)
 }
 
 // ClearSession clears the session cookie from a request
 func (cs *Store) ClearSession(w http.ResponseWriter, r *http.Request) {
-	c := cs.makeCookie("")
+	if cs.dataBrokerClient != nil {
+		for _, cookie := range getCookies(r, cs.getOptions().Name) {
+			_ = deleteReference(r.Context(), cs.dataBrokerClient, cookie.Value)
+		}
+	}
+
+	c := cs.makeCookie(r, "")
 	c.MaxAge = -1
 	c.Expires = timeNow().Add(-time.Hour)
-	http.SetCookie(w, c)
+	cs.writeCookie(w, c)
 }
 
 func getCookies(r *http.Request, name string) []*http.Cookie {
@@ -123,18 +217,42 @@ func (cs *Store) LoadSession(r *http.Request) (string, error) {
 	}
 	var err error
 	for _, cookie := range cookies {
-		jwt := loadChunkedCookie(r, cookie)
+		var jwt string
+		if cs.dataBrokerClient != nil {
+			jwt, err = loadReference(r.Context(), cs.dataBrokerClient, cookie.Value)
+			if err != nil {
+				continue
+			}
+		} else {
+			jwt, err = loadChunkedCookie(r, cookie, opts.SharedKey)
+			if err != nil {
+				continue
+			}
+		}
+		if cs.encrypter != nil {
+			err = cs.encrypter.Unmarshal([]byte(jwt), &jwt)
+			if err != nil {
+				continue
+			}
+		}
+		jwt, err = decompress(jwt)
+		if err != nil {
+			continue
+		}
 		session := &sessions.State{}
 		err = cs.decoder.Unmarshal([]byte(jwt), session)
 		if err == nil {
 			return jwt, nil
 		}
 	}
+	if errors.Is(err, sessions.ErrNoSessionFound) {
+		return "", err
+	}
 	return "", fmt.Errorf("%w: %s", sessions.ErrMalformed, err)
 }
 
 // SaveSession saves a session state to a request's cookie store.
-func (cs *Store) SaveSession(w http.ResponseWriter, _ *http.Request, x interface{}) error {
+func (cs *Store) SaveSession(w http.ResponseWriter, r *http.Request, x interface{}) error {
 	var value string
 	switch v := x.(type) {
 	case []byte:
@@ -152,56 +270,141 @@ func (cs *Store) SaveSession(w http.ResponseWriter, _ *http.Request, x interface
 		value = string(data)
 	}
 
-	cs.setSessionCookie(w, value)
+	// opaque cookies only hold a reference, so there's nothing to compress
+	if cs.dataBrokerClient == nil {
+		value = compress(value)
+	}
+
+	if cs.encrypter != nil {
+		data, err := cs.encrypter.Marshal(value)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+
+	if cs.dataBrokerClient != nil {
+		ref, err := saveReference(r.Context(), cs.dataBrokerClient, value, cs.getOptions().Expire)
+		if err != nil {
+			return err
+		}
+		for _, cookie := range getCookies(r, cs.getOptions().Name) {
+			_ = deleteReference(r.Context(), cs.dataBrokerClient, cookie.Value)
+		}
+		value = ref
+	}
+
+	cs.setSessionCookie(w, r, value)
 	return nil
 }
 
-func (cs *Store) setSessionCookie(w http.ResponseWriter, val string) {
-	cs.setCookie(w, cs.makeCookie(val))
+func (cs *Store) setSessionCookie(w http.ResponseWriter, r *http.Request, val string) {
+	cs.setCookie(w, cs.makeCookie(r, val))
 }
 
 func (cs *Store) setCookie(w http.ResponseWriter, cookie *http.Cookie) {
 	if len(cookie.String()) <= MaxChunkSize {
-		http.SetCookie(w, cookie)
+		cs.writeCookie(w, cookie)
 		return
 	}
-	for i, c := range chunk(cookie.Value, MaxChunkSize) {
+	chunks := chunk(cookie.Value, MaxChunkSize)
+	for i, c := range chunks {
 		// start with a copy of our original cookie
 		nc := *cookie
 		if i == 0 {
-			// if this is the first cookie, add our canary byte
-			nc.Value = fmt.Sprintf("%s%s", string(ChunkedCanaryByte), c)
+			// if this is the first cookie, add our canary byte and a header
+			// used to verify the reassembled chunks
+			nc.Value = fmt.Sprintf("%s%s%s", string(ChunkedCanaryByte),
+				chunkHeader(cs.getOptions().SharedKey, cookie.Name, cookie.Value, len(chunks)), c)
 		} else {
 			// subsequent parts will be postfixed with their part number
 			nc.Name = fmt.Sprintf("%s_%d", cookie.Name, i)
 			nc.Value = c
 		}
-		http.SetCookie(w, &nc)
+		cs.writeCookie(w, &nc)
 	}
 }
 
-func loadChunkedCookie(r *http.Request, c *http.Cookie) string {
+func (cs *Store) writeCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	cs.getOptions().SetCookie(w, cookie)
+}
+
+func loadChunkedCookie(r *http.Request, c *http.Cookie, sharedKey []byte) (string, error) {
 	if len(c.Value) == 0 {
-		return ""
+		return "", nil
 	}
 	// if the first byte is our canary byte, we need to handle the multipart bit
 	if []byte(c.Value)[0] != ChunkedCanaryByte {
-		return c.Value
+		return c.Value, nil
+	}
+
+	// the first chunk is prefixed with a header of the form: v2.{count}.{mac}.
+	//
+	// TODO: remove support for the legacy {count}.{checksum}. header, which
+	// used an unkeyed checksum, in the next release. It is only accepted so
+	// that upgrading doesn't sign out users with large sessions.
+	header := c.Value[1:]
+	legacy := !strings.HasPrefix(header, chunkHeaderVersion+".")
+	if !legacy {
+		header = strings.TrimPrefix(header, chunkHeaderVersion+".")
+	}
+	parts := strings.SplitN(header, ".", 3)
+	if len(parts) != 3 {
+		return "", errChunkIntegrity
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 || count > MaxNumChunks+1 {
+		return "", errChunkIntegrity
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errChunkIntegrity
 	}
 
-	data := c.Value
 	var b strings.Builder
-	fmt.Fprintf(&b, "%s", data[1:])
-	for i := 1; i <= MaxNumChunks; i++ {
+	b.WriteString(parts[2])
+	for i := 1; i < count; i++ {
 		next, err := r.Cookie(fmt.Sprintf("%s_%d", c.Name, i))
 		if err != nil {
-			break // break if we can't find the next cookie
+			return "", fmt.Errorf("%w: missing chunk %d of %d", errChunkIntegrity, i+1, count)
 		}
-		fmt.Fprintf(&b, "%s", next.Value)
+		b.WriteString(next.Value)
+	}
+	data := b.String()
+
+	var valid bool
+	if legacy {
+		valid = hmac.Equal(mac, legacyChunkChecksum(c.Name, data, count))
+	} else {
+		valid = cryptutil.CheckHMAC(chunkMACData(c.Name, data, count), mac, chunkMACKey(sharedKey))
+	}
+	if !valid {
+		return "", errChunkIntegrity
 	}
-	data = b.String()
+	return data, nil
+}
+
+// chunkHeader returns the header stored in the first chunk of a multi-part
+// cookie, containing the number of chunks and a MAC of the full payload.
+func chunkHeader(sharedKey []byte, name, value string, count int) string {
+	mac := cryptutil.GenerateHMAC(chunkMACData(name, value, count), chunkMACKey(sharedKey))
+	return fmt.Sprintf("%s.%d.%s.", chunkHeaderVersion, count, base64.RawURLEncoding.EncodeToString(mac))
+}
+
+func chunkMACData(name, value string, count int) []byte {
+	return []byte(name + "|" + strconv.Itoa(count) + "|" + value)
+}
+
+// chunkMACKey derives the key of the chunk MAC from the shared secret, so
+// that the shared secret itself isn't used for another purpose.
+func chunkMACKey(sharedKey []byte) []byte {
+	return cryptutil.Hash("cookie-chunk", sharedKey)
+}
 
-	return data
+// legacyChunkChecksum returns the unkeyed checksum used by the legacy
+// multi-part cookie header.
+func legacyChunkChecksum(name, value string, count int) []byte {
+	return cryptutil.Hash("cookie-chunk", []byte(name+"|"+strconv.Itoa(count)+"|"+value))
 }
 
 func chunk(s string, size int) []string {
@@ -1,9 +1,12 @@
 package cookie
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -11,13 +14,19 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/internal/encoding/jwe"
 	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/internal/encoding/mock"
 	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
 func TestNewStore(t *testing.T) {
@@ -169,3 +178,275 @@ func TestStore_SaveSession(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_ChunkIntegrity(t *testing.T) {
+	key := cryptutil.NewKey()
+	encoder, err := jws.NewHS256Signer(key)
+	require.NoError(t, err)
+
+	sharedKey := cryptutil.NewKey()
+	s := &Store{
+		getOptions: func() Options {
+			return Options{Name: "_pomerium", Expire: 10 * time.Second, SharedKey: sharedKey}
+		},
+		encoder: encoder,
+		decoder: encoder,
+	}
+
+	saveCookies := func(t *testing.T, subject string) []*http.Cookie {
+		w := httptest.NewRecorder()
+		require.NoError(t, s.SaveSession(w, httptest.NewRequest("GET", "/", nil), &sessions.State{
+			ID:      "xyz",
+			Subject: subject,
+		}))
+		cookies := w.Result().Cookies()
+		require.Greater(t, len(cookies), 2, "should chunk the cookie")
+		return cookies
+	}
+	loadCookies := func(cookies ...*http.Cookie) error {
+		r := httptest.NewRequest("GET", "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		_, err := s.LoadSession(r)
+		return err
+	}
+
+	// random subjects so that compression doesn't avoid chunking
+	randomSubject := func(t *testing.T) string {
+		b := make([]byte, 2*MaxChunkSize)
+		_, err := rand.Read(b)
+		require.NoError(t, err)
+		return fmt.Sprintf("%x", b)
+	}
+	cookies1 := saveCookies(t, randomSubject(t))
+	cookies2 := saveCookies(t, randomSubject(t))
+	require.Equal(t, len(cookies1), len(cookies2))
+
+	assert.NoError(t, loadCookies(cookies1...))
+	assert.NoError(t, loadCookies(cookies2...))
+
+	t.Run("missing chunk", func(t *testing.T) {
+		err := loadCookies(cookies1[:len(cookies1)-1]...)
+		assert.ErrorIs(t, err, sessions.ErrMalformed)
+		assert.Contains(t, err.Error(), errChunkIntegrity.Error())
+	})
+	t.Run("swapped chunk", func(t *testing.T) {
+		swapped := append([]*http.Cookie{cookies1[0], cookies2[1]}, cookies1[2:]...)
+		err := loadCookies(swapped...)
+		assert.ErrorIs(t, err, sessions.ErrMalformed)
+		assert.Contains(t, err.Error(), errChunkIntegrity.Error())
+	})
+	// rewriteHeader replaces the header of the first chunk with the one
+	// returned by header for the reassembled payload
+	rewriteHeader := func(t *testing.T, cookies []*http.Cookie, header func(name, payload string, count int) string) []*http.Cookie {
+		first := *cookies[0]
+		rest := strings.TrimPrefix(first.Value, string(ChunkedCanaryByte)+chunkHeaderVersion+".")
+		parts := strings.SplitN(rest, ".", 3)
+		require.Len(t, parts, 3)
+		payload := parts[2]
+		for _, c := range cookies[1:] {
+			payload += c.Value
+		}
+		first.Value = string(ChunkedCanaryByte) + header(first.Name, payload, len(cookies)) + parts[2]
+		return append([]*http.Cookie{&first}, cookies[1:]...)
+	}
+	t.Run("forged mac", func(t *testing.T) {
+		swapped := append([]*http.Cookie{cookies1[0], cookies2[1]}, cookies1[2:]...)
+		forged := rewriteHeader(t, swapped, func(name, payload string, count int) string {
+			return chunkHeader(cryptutil.NewKey(), name, payload, count)
+		})
+		err := loadCookies(forged...)
+		assert.ErrorIs(t, err, sessions.ErrMalformed)
+		assert.Contains(t, err.Error(), errChunkIntegrity.Error())
+	})
+	t.Run("legacy header", func(t *testing.T) {
+		legacy := rewriteHeader(t, cookies1, func(name, payload string, count int) string {
+			return fmt.Sprintf("%d.%s.", count,
+				base64.RawURLEncoding.EncodeToString(legacyChunkChecksum(name, payload, count)))
+		})
+		assert.NoError(t, loadCookies(legacy...))
+	})
+}
+
+func TestStore_Compression(t *testing.T) {
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+	s, err := NewStore(func() Options {
+		return Options{Name: "_pomerium", Expire: 10 * time.Second}
+	}, encoder)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		subject    string
+		compressed bool
+	}{
+		{"small", "user@example.com", false},
+		{"large", strings.Repeat("group,", 3*MaxChunkSize), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &sessions.State{ID: "xyz", Subject: tc.subject}
+			w := httptest.NewRecorder()
+			require.NoError(t, s.SaveSession(w, httptest.NewRequest("GET", "/", nil), state))
+
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1, "should fit in a single cookie")
+			assert.Equal(t, tc.compressed, cookies[0].Value[0] == CompressedCanaryByte)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(cookies[0])
+			jwt, err := s.LoadSession(r)
+			require.NoError(t, err)
+
+			var loaded sessions.State
+			require.NoError(t, encoder.Unmarshal([]byte(jwt), &loaded))
+			assert.Equal(t, state, &loaded)
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	value, err := decompress("header.payload.signature")
+	assert.NoError(t, err)
+	assert.Equal(t, "header.payload.signature", value, "should ignore uncompressed values")
+
+	_, err = decompress(string(CompressedCanaryByte) + "!!!")
+	assert.Error(t, err)
+
+	bomb := compress(strings.Repeat("a", 2*maxDecompressedSize))
+	require.Equal(t, CompressedCanaryByte, bomb[0])
+	_, err = decompress(bomb)
+	assert.ErrorIs(t, err, errDecompressedSize)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+	encrypter, err := jwe.NewA256GCMEncrypter(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	getOptions := func() Options {
+		return Options{Name: "_pomerium", Expire: 10 * time.Second}
+	}
+
+	_, err = NewEncryptedStore(getOptions, encoder, nil)
+	assert.Error(t, err, "should require an encrypter")
+
+	s, err := NewEncryptedStore(getOptions, encoder, encrypter)
+	require.NoError(t, err)
+
+	state := &sessions.State{ID: "xyz", Subject: "user@example.com"}
+	w := httptest.NewRecorder()
+	require.NoError(t, s.SaveSession(w, httptest.NewRequest("GET", "/", nil), state))
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Len(t, strings.Split(cookies[0].Value, "."), 5, "should be a compact jwe")
+
+	var plain sessions.State
+	assert.Error(t, encoder.Unmarshal([]byte(cookies[0].Value), &plain), "claims should not be readable")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	jwt, err := s.LoadSession(r)
+	require.NoError(t, err)
+
+	var loaded sessions.State
+	require.NoError(t, encoder.Unmarshal([]byte(jwt), &loaded))
+	assert.Equal(t, state, &loaded)
+
+	t.Run("plain cookie", func(t *testing.T) {
+		rawJWT, err := encoder.Marshal(state)
+		require.NoError(t, err)
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: "_pomerium", Value: string(rawJWT)})
+		_, err = s.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrMalformed)
+	})
+}
+
+type mockDataBrokerClient struct {
+	databroker.DataBrokerServiceClient
+	records map[string]*databroker.Record
+}
+
+func newMockDataBrokerClient() *mockDataBrokerClient {
+	return &mockDataBrokerClient{records: make(map[string]*databroker.Record)}
+}
+
+func (m *mockDataBrokerClient) Get(_ context.Context, in *databroker.GetRequest, _ ...grpc.CallOption) (*databroker.GetResponse, error) {
+	record, ok := m.records[in.GetType()+"/"+in.GetId()]
+	if !ok || record.GetDeletedAt() != nil {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &databroker.GetResponse{Record: record}, nil
+}
+
+func (m *mockDataBrokerClient) Put(_ context.Context, in *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+	for _, record := range in.GetRecords() {
+		m.records[record.GetType()+"/"+record.GetId()] = record
+	}
+	return &databroker.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func TestOpaqueStore(t *testing.T) {
+	key := cryptutil.NewKey()
+	encoder, err := jws.NewHS256Signer(key)
+	require.NoError(t, err)
+
+	getOptions := func() Options {
+		return Options{
+			Name:     "_pomerium",
+			Secure:   true,
+			HTTPOnly: true,
+			Expire:   10 * time.Second,
+		}
+	}
+
+	_, err = NewOpaqueStore(getOptions, encoder, nil)
+	assert.Error(t, err, "should require a databroker client")
+
+	client := newMockDataBrokerClient()
+	s, err := NewOpaqueStore(getOptions, encoder, client)
+	require.NoError(t, err)
+
+	hugeString := make([]byte, 4097)
+	_, err = rand.Read(hugeString)
+	require.NoError(t, err)
+	state := &sessions.State{ID: "xyz", Subject: fmt.Sprintf("%x", hugeString)}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, s.SaveSession(w, r, state))
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1, "should not chunk opaque cookies")
+	assert.Less(t, len(cookies[0].Value), 100)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	jwt, err := s.LoadSession(r)
+	require.NoError(t, err)
+
+	var loaded sessions.State
+	require.NoError(t, encoder.Unmarshal([]byte(jwt), &loaded))
+	assert.Equal(t, state, &loaded)
+
+	t.Run("revoked", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookies[0])
+		s.ClearSession(httptest.NewRecorder(), r)
+
+		_, err := s.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+	t.Run("unknown reference", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: "_pomerium", Value: "unknown"})
+
+		_, err := s.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+}
@@ -0,0 +1,133 @@
+package cookie
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Cookie name prefixes which instruct browsers to enforce additional
+// constraints on the cookie.
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Set-Cookie#cookie_prefixes
+const (
+	// HostPrefix requires the cookie to be secure, to have a path of "/"
+	// and to not have a domain.
+	HostPrefix = "__Host-"
+	// SecurePrefix requires the cookie to be secure.
+	SecurePrefix = "__Secure-"
+)
+
+// Validate validates the options against the constraints of the cookie name
+// prefix, if any, and of partitioned cookies.
+func (opts Options) Validate() error {
+	if opts.Partitioned && !opts.Secure {
+		return fmt.Errorf("internal/sessions: partitioned cookies must be secure")
+	}
+	if !opts.Secure {
+		if opts.SameSite == http.SameSiteNoneMode {
+			return fmt.Errorf("internal/sessions: SameSite=None cookies must be secure")
+		}
+		for host, hostOpts := range opts.ByHost {
+			if hostOpts.SameSite == http.SameSiteNoneMode {
+				return fmt.Errorf("internal/sessions: SameSite=None cookies must be secure (%s)", host)
+			}
+		}
+	}
+
+	switch {
+	case hasPrefix(opts.Name, HostPrefix):
+		if !opts.Secure {
+			return fmt.Errorf("internal/sessions: %s cookies must be secure", HostPrefix)
+		}
+		if opts.Domain != "" {
+			return fmt.Errorf("internal/sessions: %s cookies cannot have a domain", HostPrefix)
+		}
+		for host, hostOpts := range opts.ByHost {
+			if hostOpts.Domain != "" {
+				return fmt.Errorf("internal/sessions: %s cookies cannot have a domain (%s)", HostPrefix, host)
+			}
+			if hostOpts.Path != "" && hostOpts.Path != "/" {
+				return fmt.Errorf("internal/sessions: %s cookies must have a path of / (%s)", HostPrefix, host)
+			}
+		}
+	case hasPrefix(opts.Name, SecurePrefix):
+		if !opts.Secure {
+			return fmt.Errorf("internal/sessions: %s cookies must be secure", SecurePrefix)
+		}
+	}
+	return nil
+}
+
+// NewCookie creates a new cookie for the request using the options.
+func (opts Options) NewCookie(r *http.Request, value string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     opts.Name,
+		Value:    value,
+		Path:     "/",
+		Domain:   opts.Domain,
+		HttpOnly: opts.HTTPOnly,
+		Secure:   opts.Secure,
+		Expires:  timeNow().Add(opts.Expire),
+		SameSite: opts.SameSite,
+	}
+	if hostOpts, ok := opts.getHostOptions(r); ok {
+		if hostOpts.Path != "" {
+			c.Path = hostOpts.Path
+		}
+		if hostOpts.Domain != "" {
+			c.Domain = hostOpts.Domain
+		}
+		if hostOpts.SameSite != 0 {
+			c.SameSite = hostOpts.SameSite
+		}
+	}
+	applyPrefixConstraints(c)
+	return c
+}
+
+// SetCookie adds the cookie to the response headers. It's used instead of
+// http.SetCookie so that the Partitioned attribute can be added.
+func (opts Options) SetCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	v := cookie.String()
+	if v == "" {
+		return
+	}
+	if opts.Partitioned {
+		v += "; Partitioned"
+	}
+	w.Header().Add("Set-Cookie", v)
+}
+
+// getHostOptions returns the options overridden for the host of the request.
+func (opts Options) getHostOptions(r *http.Request) (HostOptions, bool) {
+	if r == nil || len(opts.ByHost) == 0 {
+		return HostOptions{}, false
+	}
+	if hostOpts, ok := opts.ByHost[r.Host]; ok {
+		return hostOpts, true
+	}
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		if hostOpts, ok := opts.ByHost[host]; ok {
+			return hostOpts, true
+		}
+	}
+	return HostOptions{}, false
+}
+
+// applyPrefixConstraints updates the cookie so that it satisfies the
+// constraints of its name prefix. Otherwise browsers would reject the cookie.
+func applyPrefixConstraints(c *http.Cookie) {
+	switch {
+	case hasPrefix(c.Name, HostPrefix):
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	case hasPrefix(c.Name, SecurePrefix):
+		c.Secure = true
+	}
+}
+
+func hasPrefix(name, prefix string) bool {
+	return len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix)
+}
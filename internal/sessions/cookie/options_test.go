@@ -0,0 +1,154 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"no prefix", Options{Name: "_pomerium", Domain: "example.com"}, false},
+		{"host", Options{Name: "__Host-pomerium", Secure: true}, false},
+		{"host insecure", Options{Name: "__Host-pomerium"}, true},
+		{"host with domain", Options{Name: "__host-pomerium", Secure: true, Domain: "example.com"}, true},
+		{"secure", Options{Name: "__Secure-pomerium", Secure: true, Domain: "example.com"}, false},
+		{"secure insecure", Options{Name: "__Secure-pomerium"}, true},
+		{"partitioned", Options{Name: "_pomerium", Secure: true, Partitioned: true}, false},
+		{"partitioned insecure", Options{Name: "_pomerium", Partitioned: true}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			assert.Equal(t, tc.wantErr, err != nil, "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestStore_CookiePrefix(t *testing.T) {
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		wantDomain string
+	}{
+		{"__Host-pomerium", ""},
+		{"__Secure-pomerium", "pomerium.io"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewStore(func() Options {
+				return Options{
+					Name:   tc.name,
+					Domain: "pomerium.io",
+					Expire: 10 * time.Second,
+				}
+			}, encoder)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			require.NoError(t, s.SaveSession(w, httptest.NewRequest("GET", "/", nil), &sessions.State{ID: "xyz"}))
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1)
+			assert.True(t, cookies[0].Secure)
+			assert.Equal(t, "/", cookies[0].Path)
+			assert.Equal(t, tc.wantDomain, cookies[0].Domain)
+		})
+	}
+}
+
+func TestStore_Partitioned(t *testing.T) {
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	s, err := NewStore(func() Options {
+		return Options{
+			Name:        "_pomerium",
+			Secure:      true,
+			Partitioned: true,
+			Expire:      10 * time.Second,
+		}
+	}, encoder)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, s.SaveSession(w, r, &sessions.State{ID: "xyz"}))
+	assert.True(t, strings.HasSuffix(w.Header().Get("Set-Cookie"), "; Partitioned"))
+
+	w = httptest.NewRecorder()
+	s.ClearSession(w, r)
+	assert.True(t, strings.HasSuffix(w.Header().Get("Set-Cookie"), "; Partitioned"),
+		"partitioned cookies must be cleared with the partitioned attribute")
+}
+
+func TestOptions_SameSite(t *testing.T) {
+	opts := Options{
+		Name:     "_pomerium",
+		SameSite: http.SameSiteLaxMode,
+		ByHost: map[string]HostOptions{
+			"embedded.example.com": {SameSite: http.SameSiteNoneMode},
+		},
+	}
+
+	for _, tc := range []struct {
+		host   string
+		expect http.SameSite
+	}{
+		{"www.example.com", http.SameSiteLaxMode},
+		{"embedded.example.com", http.SameSiteNoneMode},
+		{"embedded.example.com:8443", http.SameSiteNoneMode},
+	} {
+		r := httptest.NewRequest("GET", "https://"+tc.host+"/", nil)
+		assert.Equal(t, tc.expect, opts.NewCookie(r, "value").SameSite, tc.host)
+	}
+
+	assert.Error(t, opts.Validate(), "SameSite=None requires secure cookies")
+	opts.Secure = true
+	assert.NoError(t, opts.Validate())
+}
+
+func TestOptions_PathAndDomain(t *testing.T) {
+	opts := Options{
+		Name:   "_pomerium",
+		Domain: "example.com",
+		ByHost: map[string]HostOptions{
+			"app1.example.com": {Domain: "app1.example.com"},
+			"apps.example.com": {Path: "/app2"},
+		},
+	}
+
+	for _, tc := range []struct {
+		host, path, domain string
+	}{
+		{"www.example.com", "/", "example.com"},
+		{"app1.example.com", "/", "app1.example.com"},
+		{"apps.example.com:8443", "/app2", "example.com"},
+	} {
+		r := httptest.NewRequest("GET", "https://"+tc.host+"/", nil)
+		c := opts.NewCookie(r, "value")
+		assert.Equal(t, tc.path, c.Path, tc.host)
+		assert.Equal(t, tc.domain, c.Domain, tc.host)
+	}
+
+	opts.Domain = ""
+	opts.Name = "__Host-pomerium"
+	opts.Secure = true
+	assert.Error(t, opts.Validate(), "__Host- cookies cannot have a domain")
+	delete(opts.ByHost, "app1.example.com")
+	assert.Error(t, opts.Validate(), "__Host- cookies must have a path of /")
+	delete(opts.ByHost, "apps.example.com")
+	assert.NoError(t, opts.Validate())
+}
@@ -0,0 +1,73 @@
+package cookie
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// referenceLength is the number of random bytes used for an opaque session
+// reference.
+const referenceLength = 32
+
+func loadReference(ctx context.Context, client databroker.DataBrokerServiceClient, id string) (string, error) {
+	if id == "" {
+		return "", sessions.ErrNoSessionFound
+	}
+
+	ref := &session.SessionReference{Id: id}
+	err := databroker.Get(ctx, client, ref)
+	if status.Code(err) == codes.NotFound {
+		return "", sessions.ErrNoSessionFound
+	} else if err != nil {
+		return "", fmt.Errorf("internal/sessions: error loading session reference: %w", err)
+	}
+
+	if ref.ExpiresAt != nil && ref.ExpiresAt.AsTime().Before(timeNow()) {
+		return "", sessions.ErrNoSessionFound
+	}
+	return ref.GetJwt(), nil
+}
+
+func saveReference(ctx context.Context, client databroker.DataBrokerServiceClient, jwt string, expire time.Duration) (string, error) {
+	ref := &session.SessionReference{
+		Id:  cryptutil.NewRandomStringN(referenceLength),
+		Jwt: jwt,
+	}
+	if expire > 0 {
+		ref.ExpiresAt = timestamppb.New(timeNow().Add(expire))
+	}
+
+	_, err := databroker.Put(ctx, client, ref)
+	if err != nil {
+		return "", fmt.Errorf("internal/sessions: error saving session reference: %w", err)
+	}
+	return ref.GetId(), nil
+}
+
+func deleteReference(ctx context.Context, client databroker.DataBrokerServiceClient, id string) error {
+	if id == "" {
+		return nil
+	}
+
+	any := protoutil.NewAny(&session.SessionReference{Id: id})
+	_, err := client.Put(ctx, &databroker.PutRequest{
+		Records: []*databroker.Record{{
+			Type:      any.GetTypeUrl(),
+			Id:        id,
+			Data:      any,
+			DeletedAt: timestamppb.Now(),
+		}},
+	})
+	return err
+}
@@ -23,6 +23,9 @@ var (
 	// ErrIssuedInTheFuture indicates that the iat field is in the future.
 	ErrIssuedInTheFuture = errors.New("internal/sessions: validation field, token issued in the future (iat)")
 
+	// ErrIdleTimeout indicates that the session has not been used within the idle timeout.
+	ErrIdleTimeout = errors.New("internal/sessions: validation failed, session is idle")
+
 	// ErrInvalidAudience indicated invalid aud claim.
 	ErrInvalidAudience = errors.New("internal/sessions: validation failed, invalid audience claim (aud)")
 )
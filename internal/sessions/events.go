@@ -0,0 +1,36 @@
+package sessions
+
+import (
+	"context"
+	"time"
+)
+
+// A LifecycleEventType is the type of a session lifecycle event.
+type LifecycleEventType string
+
+// Session lifecycle event types.
+const (
+	// LifecycleEventCreated is published when a new session is created.
+	LifecycleEventCreated LifecycleEventType = "created"
+	// LifecycleEventRefreshed is published when a session's tokens are
+	// refreshed with the identity provider.
+	LifecycleEventRefreshed LifecycleEventType = "refreshed"
+	// LifecycleEventRevoked is published when a session is signed out, revoked
+	// or rejected by the identity provider.
+	LifecycleEventRevoked LifecycleEventType = "revoked"
+	// LifecycleEventExpired is published when a session is deleted because it
+	// has expired.
+	LifecycleEventExpired LifecycleEventType = "expired"
+)
+
+// A LifecycleEvent describes a change in the lifecycle of a session.
+type LifecycleEvent struct {
+	Type      LifecycleEventType `json:"type"`
+	SessionID string             `json:"session_id"`
+	UserID    string             `json:"user_id"`
+	Time      time.Time          `json:"time"`
+}
+
+// A LifecycleHook receives session lifecycle events. Hooks are called
+// synchronously and should not block.
+type LifecycleHook func(context.Context, LifecycleEvent)
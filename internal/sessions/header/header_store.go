@@ -16,7 +16,8 @@ var _ sessions.SessionLoader = &Store{}
 // Store implements the load session store interface using http
 // authorization headers.
 type Store struct {
-	encoder encoding.Unmarshaler
+	encoder   encoding.Unmarshaler
+	getScheme GetSchemeFunc
 }
 
 // NewStore returns a new header store for loading sessions from
@@ -24,15 +25,22 @@ type Store struct {
 //
 // NOTA BENE: While most servers do not log Authorization headers by default,
 // you should ensure no other services are logging or leaking your auth headers.
-func NewStore(enc encoding.Unmarshaler) *Store {
+func NewStore(enc encoding.Unmarshaler, options ...Option) *Store {
+	cfg := getConfig(options...)
 	return &Store{
-		encoder: enc,
+		encoder:   enc,
+		getScheme: cfg.getScheme,
 	}
 }
 
 // LoadSession tries to retrieve the token string from the Authorization header.
 func (as *Store) LoadSession(r *http.Request) (string, error) {
 	jwt := TokenFromHeaders(r)
+	if jwt == "" && as.getScheme != nil {
+		if scheme, ok := as.getScheme(r); ok {
+			jwt = TokenFromScheme(r, scheme)
+		}
+	}
 	if jwt == "" {
 		return "", sessions.ErrNoSessionFound
 	}
@@ -62,3 +70,30 @@ func TokenFromHeaders(r *http.Request) string {
 
 	return ""
 }
+
+// TokenFromScheme retrieves the token from the header described by the scheme.
+func TokenFromScheme(r *http.Request, scheme Scheme) string {
+	if scheme.Header == "" {
+		return ""
+	}
+	value := r.Header.Get(scheme.Header)
+	if value == "" {
+		return ""
+	}
+
+	allowRaw := len(scheme.Prefixes) == 0
+	for _, prefix := range scheme.Prefixes {
+		if prefix == "" {
+			allowRaw = true
+			continue
+		}
+		// schemes are case-insensitive as per rfc7235
+		if len(value) > len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) && value[len(prefix)] == ' ' {
+			return value[len(prefix)+1:]
+		}
+	}
+	if allowRaw {
+		return value
+	}
+	return ""
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/sessions"
 )
 
 func TestTokenFromHeader(t *testing.T) {
@@ -27,3 +29,36 @@ func TestTokenFromHeader(t *testing.T) {
 		assert.Equal(t, "JWT", v)
 	})
 }
+
+func TestTokenFromScheme(t *testing.T) {
+	newRequest := func(header, value string) *http.Request {
+		r, _ := http.NewRequest("GET", "http://localhost/some/url", nil)
+		r.Header.Set(header, value)
+		return r
+	}
+
+	bearer := Scheme{Header: "Authorization", Prefixes: []string{"Bearer"}}
+	assert.Equal(t, "JWT", TokenFromScheme(newRequest("Authorization", "Bearer JWT"), bearer))
+	assert.Equal(t, "JWT", TokenFromScheme(newRequest("Authorization", "bearer JWT"), bearer))
+	assert.Equal(t, "", TokenFromScheme(newRequest("Authorization", "Basic JWT"), bearer))
+	assert.Equal(t, "", TokenFromScheme(newRequest("Authorization", "BearerJWT"), bearer))
+
+	custom := Scheme{Header: "X-Api-Token", Prefixes: []string{"Token", ""}}
+	assert.Equal(t, "JWT", TokenFromScheme(newRequest("X-Api-Token", "Token JWT"), custom))
+	assert.Equal(t, "JWT", TokenFromScheme(newRequest("X-Api-Token", "JWT"), custom))
+	assert.Equal(t, "", TokenFromScheme(newRequest("Authorization", "JWT"), custom))
+}
+
+func TestStore_LoadSession(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost/some/url", nil)
+	r.Header.Set("Authorization", "Bearer JWT")
+
+	_, err := NewStore(nil).LoadSession(r)
+	assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+
+	jwt, err := NewStore(nil, WithGetScheme(func(r *http.Request) (Scheme, bool) {
+		return Scheme{Header: "Authorization", Prefixes: []string{"Bearer"}}, true
+	})).LoadSession(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "JWT", jwt)
+}
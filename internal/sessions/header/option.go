@@ -0,0 +1,38 @@
+package header
+
+import "net/http"
+
+// Scheme describes an additional header from which a session may be loaded.
+type Scheme struct {
+	// Header is the name of the header, e.g. "Authorization".
+	Header string
+	// Prefixes are the accepted value prefixes, e.g. "Bearer". An empty
+	// prefix accepts the raw header value.
+	Prefixes []string
+}
+
+// A GetSchemeFunc returns the additional scheme to use for a request, if any.
+type GetSchemeFunc func(r *http.Request) (Scheme, bool)
+
+type config struct {
+	getScheme GetSchemeFunc
+}
+
+// An Option customizes a Store.
+type Option func(*config)
+
+// WithGetScheme sets the function used to look up an additional, typically
+// route specific, scheme for loading sessions.
+func WithGetScheme(getScheme GetSchemeFunc) Option {
+	return func(cfg *config) {
+		cfg.getScheme = getScheme
+	}
+}
+
+func getConfig(options ...Option) *config {
+	cfg := new(config)
+	for _, o := range options {
+		o(cfg)
+	}
+	return cfg
+}
@@ -0,0 +1,172 @@
+// Package memcachedstore provides a memcached based implementation of a
+// session store.
+//
+// Session state is persisted in memcached and the session cookie only carries
+// an opaque, randomly generated reference to it. Sessions are sharded across
+// the memcached servers using consistent hashing, so adding or removing a
+// server only invalidates a fraction of the sessions.
+package memcachedstore
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+var (
+	_ sessions.SessionStore  = &Store{}
+	_ sessions.SessionLoader = &Store{}
+)
+
+const (
+	sessionKeyPrefix = "pomerium_session_"
+
+	// referenceLength is the number of random bytes used for the session
+	// reference stored in the cookie.
+	referenceLength = 32
+
+	// maxRelativeExpiration is the largest expiration memcached treats as
+	// relative. Larger values are interpreted as a unix timestamp.
+	maxRelativeExpiration = 30 * 24 * time.Hour
+)
+
+// timeNow is time.Now but pulled out as a variable for tests.
+var timeNow = time.Now
+
+// Store implements the session store interface using memcached to hold the
+// session and a cookie to hold a reference to it.
+type Store struct {
+	client     *memcache.Client
+	getOptions cookie.GetOptionsFunc
+	encoder    encoding.MarshalUnmarshaler
+}
+
+// New creates a new memcached session store.
+func New(
+	servers []string,
+	getOptions cookie.GetOptionsFunc,
+	encoder encoding.MarshalUnmarshaler,
+	options ...Option,
+) (*Store, error) {
+	if encoder == nil {
+		return nil, fmt.Errorf("internal/sessions: encoder cannot be nil")
+	}
+	cfg := getConfig(options...)
+	selector, err := newRing(servers, cfg.replicas)
+	if err != nil {
+		return nil, err
+	}
+	client := memcache.NewFromSelector(selector)
+	client.Timeout = cfg.timeout
+	client.MaxIdleConns = cfg.maxIdleConns
+	return &Store{
+		client:     client,
+		getOptions: getOptions,
+		encoder:    encoder,
+	}, nil
+}
+
+// ClearSession removes the session from memcached and clears the reference
+// cookie.
+func (s *Store) ClearSession(w http.ResponseWriter, r *http.Request) {
+	if ref, ok := s.loadReference(r); ok {
+		_ = s.client.Delete(sessionKey(ref))
+	}
+
+	opts := s.getOptions()
+	c := opts.NewCookie(r, "")
+	c.MaxAge = -1
+	c.Expires = timeNow().Add(-time.Hour)
+	opts.SetCookie(w, c)
+}
+
+// LoadSession returns the session referenced by the request's cookie.
+func (s *Store) LoadSession(r *http.Request) (string, error) {
+	ref, ok := s.loadReference(r)
+	if !ok {
+		return "", sessions.ErrNoSessionFound
+	}
+
+	item, err := s.client.Get(sessionKey(ref))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return "", sessions.ErrNoSessionFound
+	} else if err != nil {
+		return "", fmt.Errorf("internal/sessions: error loading session from memcached: %w", err)
+	}
+
+	jwt := string(item.Value)
+	var state sessions.State
+	if err := s.encoder.Unmarshal(item.Value, &state); err != nil {
+		return "", fmt.Errorf("%w: %s", sessions.ErrMalformed, err)
+	}
+	return jwt, nil
+}
+
+// SaveSession saves a session to memcached and sets a cookie referencing it.
+// Any session previously referenced by the request is removed.
+func (s *Store) SaveSession(w http.ResponseWriter, r *http.Request, x interface{}) error {
+	var value []byte
+	switch v := x.(type) {
+	case []byte:
+		value = v
+	case string:
+		value = []byte(v)
+	default:
+		data, err := s.encoder.Marshal(x)
+		if err != nil {
+			return err
+		}
+		value = data
+	}
+
+	ref := cryptutil.NewRandomStringN(referenceLength)
+	opts := s.getOptions()
+	err := s.client.Set(&memcache.Item{
+		Key:        sessionKey(ref),
+		Value:      value,
+		Expiration: getExpiration(timeNow(), opts.Expire),
+	})
+	if err != nil {
+		return fmt.Errorf("internal/sessions: error saving session to memcached: %w", err)
+	}
+	if old, ok := s.loadReference(r); ok {
+		_ = s.client.Delete(sessionKey(old))
+	}
+
+	opts.SetCookie(w, opts.NewCookie(r, ref))
+	return nil
+}
+
+func (s *Store) loadReference(r *http.Request) (string, bool) {
+	c, err := r.Cookie(s.getOptions().Name)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return c.Value, true
+}
+
+func sessionKey(ref string) string {
+	return sessionKeyPrefix + ref
+}
+
+// getExpiration returns the memcached expiration for an item which should
+// expire along with the session cookie. Expirations longer than 30 days have
+// to be given as a unix timestamp. Zero means the item doesn't expire.
+func getExpiration(now time.Time, expire time.Duration) int32 {
+	if expire <= 0 {
+		return 0
+	}
+	if expire > maxRelativeExpiration {
+		return int32(now.Add(expire).Unix())
+	}
+	// round up so items never expire before the cookie
+	return int32((expire + time.Second - 1) / time.Second)
+}
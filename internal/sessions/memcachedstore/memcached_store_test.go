@@ -0,0 +1,98 @@
+package memcachedstore
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestNew(t *testing.T) {
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+	getOptions := func() cookie.Options { return cookie.Options{Name: "_pomerium"} }
+
+	_, err = New([]string{"127.0.0.1:11211"}, getOptions, nil)
+	assert.Error(t, err, "should require an encoder")
+	_, err = New(nil, getOptions, encoder)
+	assert.Error(t, err, "should require a server")
+	_, err = New([]string{"127.0.0.1:port"}, getOptions, encoder)
+	assert.Error(t, err, "should require valid servers")
+
+	s, err := New([]string{"127.0.0.1:11211", "127.0.0.2:11211"}, getOptions, encoder,
+		WithTimeout(time.Second), WithMaxIdleConns(4))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, s.client.Timeout)
+	assert.Equal(t, 4, s.client.MaxIdleConns)
+}
+
+func TestRing(t *testing.T) {
+	servers := []string{"127.0.0.1:11211", "127.0.0.2:11211", "127.0.0.3:11211"}
+	r, err := newRing(servers, defaultReplicas)
+	require.NoError(t, err)
+
+	var keys []string
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := sessionKey(fmt.Sprint(i))
+		keys = append(keys, key)
+		addr, err := r.PickServer(key)
+		require.NoError(t, err)
+		counts[addr.String()]++
+	}
+	assert.Len(t, counts, 3)
+	for server, count := range counts {
+		assert.Greater(t, count, 600, "keys should be spread evenly: %s", server)
+	}
+
+	var each []string
+	assert.NoError(t, r.Each(func(addr net.Addr) error {
+		each = append(each, addr.String())
+		return nil
+	}))
+	assert.Equal(t, servers, each)
+
+	t.Run("adding a server", func(t *testing.T) {
+		r2, err := newRing(append(servers, "127.0.0.4:11211"), defaultReplicas)
+		require.NoError(t, err)
+
+		moved := 0
+		for _, key := range keys {
+			addr1, _ := r.PickServer(key)
+			addr2, _ := r2.PickServer(key)
+			if addr1.String() != addr2.String() {
+				assert.Equal(t, "127.0.0.4:11211", addr2.String(), "keys should only move to the new server")
+				moved++
+			}
+		}
+		assert.Less(t, moved, len(keys)/2, "most keys should stay on the same server")
+	})
+}
+
+func TestGetExpiration(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	assert.Equal(t, int32(0), getExpiration(now, 0))
+	assert.Equal(t, int32(1), getExpiration(now, time.Millisecond), "should round up")
+	assert.Equal(t, int32(14*60*60), getExpiration(now, 14*time.Hour))
+	assert.Equal(t, int32(30*24*60*60), getExpiration(now, 30*24*time.Hour))
+	assert.Equal(t, int32(now.Add(31*24*time.Hour).Unix()), getExpiration(now, 31*24*time.Hour),
+		"long expirations should be absolute")
+}
+
+func TestParseURL(t *testing.T) {
+	servers, err := parseURL("memcached://127.0.0.1:11211, 127.0.0.2:11211")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:11211", "127.0.0.2:11211"}, servers)
+
+	_, err = parseURL("")
+	assert.Error(t, err)
+	_, err = parseURL("redis://127.0.0.1:6379")
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package memcachedstore
+
+import (
+	"time"
+)
+
+const (
+	defaultReplicas     = 160
+	defaultTimeout      = 500 * time.Millisecond
+	defaultMaxIdleConns = 16
+)
+
+type config struct {
+	replicas     int
+	timeout      time.Duration
+	maxIdleConns int
+}
+
+// An Option customizes a Store.
+type Option func(*config)
+
+// WithReplicas sets the number of points each server has on the consistent
+// hash ring. More points result in a more even distribution of sessions.
+func WithReplicas(replicas int) Option {
+	return func(cfg *config) {
+		cfg.replicas = replicas
+	}
+}
+
+// WithTimeout sets the socket read/write timeout of the memcached client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections kept per
+// memcached server.
+func WithMaxIdleConns(maxIdleConns int) Option {
+	return func(cfg *config) {
+		cfg.maxIdleConns = maxIdleConns
+	}
+}
+
+func getConfig(options ...Option) *config {
+	cfg := &config{
+		replicas:     defaultReplicas,
+		timeout:      defaultTimeout,
+		maxIdleConns: defaultMaxIdleConns,
+	}
+	for _, o := range options {
+		o(cfg)
+	}
+	return cfg
+}
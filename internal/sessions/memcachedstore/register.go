@@ -0,0 +1,74 @@
+package memcachedstore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pomerium/pomerium/pkg/sessionstore"
+)
+
+// Name is the name the memcached session store is registered under.
+const Name = "memcached"
+
+const urlScheme = "memcached://"
+
+func init() {
+	sessionstore.Register(Name, newFromOptions)
+}
+
+// stores holds a memcached session store per URL, so that recreating the
+// session store on every config change doesn't leak connections.
+var stores struct {
+	sync.Mutex
+	m map[string]*Store
+}
+
+func newFromOptions(options sessionstore.Options) (sessionstore.SessionStore, error) {
+	servers, err := parseURL(options.URL)
+	if err != nil {
+		return nil, err
+	}
+	if options.Encoder == nil {
+		return nil, fmt.Errorf("internal/sessions: encoder cannot be nil")
+	}
+
+	stores.Lock()
+	defer stores.Unlock()
+
+	s, ok := stores.m[options.URL]
+	if !ok {
+		s, err = New(servers, options.GetCookieOptions, options.Encoder)
+		if err != nil {
+			return nil, err
+		}
+		if stores.m == nil {
+			stores.m = make(map[string]*Store)
+		}
+		stores.m[options.URL] = s
+	}
+	return &Store{
+		client:     s.client,
+		getOptions: options.GetCookieOptions,
+		encoder:    options.Encoder,
+	}, nil
+}
+
+// parseURL parses a comma separated list of memcached servers in the form
+// memcached://host1:11211,host2:11211.
+func parseURL(rawURL string) ([]string, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("internal/sessions: session_store_url is required for the memcached session store")
+	}
+	if !strings.HasPrefix(rawURL, urlScheme) {
+		return nil, fmt.Errorf("internal/sessions: invalid memcached url, expected %shost:port[,host:port...]", urlScheme)
+	}
+
+	var servers []string
+	for _, server := range strings.Split(strings.TrimPrefix(rawURL, urlScheme), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return servers, nil
+}
@@ -0,0 +1,89 @@
+package memcachedstore
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/cespare/xxhash/v2"
+)
+
+var _ memcache.ServerSelector = (*ring)(nil)
+
+// A ring is a consistent hash ring of memcached servers. Each server is
+// placed on the ring multiple times so that keys are spread evenly, and keys
+// are assigned to the first server following their hash.
+type ring struct {
+	addrs  []net.Addr
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash uint64
+	addr net.Addr
+}
+
+func newRing(servers []string, replicas int) (*ring, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("internal/sessions: at least one memcached server is required")
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+
+	r := &ring{
+		addrs:  make([]net.Addr, 0, len(servers)),
+		points: make([]ringPoint, 0, len(servers)*replicas),
+	}
+	for _, server := range servers {
+		addr, err := resolveServer(server)
+		if err != nil {
+			return nil, fmt.Errorf("internal/sessions: invalid memcached server %q: %w", server, err)
+		}
+		r.addrs = append(r.addrs, addr)
+		// points are derived from the configured name rather than the resolved
+		// address so that every instance builds the same ring
+		for i := 0; i < replicas; i++ {
+			r.points = append(r.points, ringPoint{
+				hash: xxhash.Sum64String(server + "-" + strconv.Itoa(i)),
+				addr: addr,
+			})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r, nil
+}
+
+// PickServer returns the server a key is stored on.
+func (r *ring) PickServer(key string) (net.Addr, error) {
+	h := xxhash.Sum64String(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].addr, nil
+}
+
+// Each calls f for every server.
+func (r *ring) Each(f func(net.Addr) error) error {
+	for _, addr := range r.addrs {
+		if err := f(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveServer(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		return net.ResolveUnixAddr("unix", server)
+	}
+	return net.ResolveTCPAddr("tcp", server)
+}
@@ -0,0 +1,76 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+// Session store operation results used for metrics.
+const (
+	operationResultSuccess  = "success"
+	operationResultNotFound = "not_found"
+	operationResultError    = "error"
+)
+
+type instrumentedLoader struct {
+	storeType string
+	loader    SessionLoader
+}
+
+// NewInstrumentedLoader returns a session loader which records metrics for
+// the sessions loaded by the given loader.
+func NewInstrumentedLoader(storeType string, loader SessionLoader) SessionLoader {
+	return &instrumentedLoader{storeType: storeType, loader: loader}
+}
+
+func (l *instrumentedLoader) LoadSession(r *http.Request) (string, error) {
+	start := time.Now()
+	s, err := l.loader.LoadSession(r)
+	recordOperation(r, l.storeType, "load", err, time.Since(start))
+	return s, err
+}
+
+type instrumentedStore struct {
+	instrumentedLoader
+	store SessionStore
+}
+
+// NewInstrumentedStore returns a session store which records metrics for the
+// operations of the given store.
+func NewInstrumentedStore(storeType string, store SessionStore) SessionStore {
+	return &instrumentedStore{
+		instrumentedLoader: instrumentedLoader{storeType: storeType, loader: store},
+		store:              store,
+	}
+}
+
+func (s *instrumentedStore) ClearSession(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	s.store.ClearSession(w, r)
+	recordOperation(r, s.storeType, "clear", nil, time.Since(start))
+}
+
+func (s *instrumentedStore) SaveSession(w http.ResponseWriter, r *http.Request, x interface{}) error {
+	start := time.Now()
+	err := s.store.SaveSession(w, r, x)
+	recordOperation(r, s.storeType, "save", err, time.Since(start))
+	return err
+}
+
+func recordOperation(r *http.Request, storeType, operation string, err error, duration time.Duration) {
+	result := operationResultSuccess
+	if errors.Is(err, ErrNoSessionFound) {
+		result = operationResultNotFound
+	} else if err != nil {
+		result = operationResultError
+	}
+
+	metrics.RecordSessionStoreOperation(r.Context(), &metrics.SessionStoreOperationTags{
+		Store:     storeType,
+		Operation: operation,
+		Result:    result,
+	}, duration)
+}
@@ -0,0 +1,55 @@
+package sessions_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/mock"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+func TestInstrumentedStore(t *testing.T) {
+	view.Unregister(metrics.SessionStoreViews...)
+	require.NoError(t, view.Register(metrics.SessionStoreViews...))
+	defer view.Unregister(metrics.SessionStoreViews...)
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	w := httptest.NewRecorder()
+
+	store := sessions.NewInstrumentedStore("test", &mock.Store{
+		LoadError: sessions.ErrNoSessionFound,
+		SaveError: errors.New("error"),
+	})
+	_, _ = store.LoadSession(r)
+	_ = store.SaveSession(w, r, nil)
+	store.ClearSession(w, r)
+
+	rows, err := view.RetrieveData(metrics.SessionStoreOperationCountView.Name)
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, row := range rows {
+		var operation, result string
+		for _, tag := range row.Tags {
+			switch tag.Key {
+			case metrics.TagKeyStorageOperation:
+				operation = tag.Value
+			case metrics.TagKeyStorageResult:
+				result = tag.Value
+			}
+		}
+		got[operation] = result
+	}
+	assert.Equal(t, map[string]string{
+		"load":  "not_found",
+		"save":  "error",
+		"clear": "success",
+	}, got)
+}
@@ -0,0 +1,167 @@
+package queryparam
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+var (
+	_ sessions.SessionStore  = &OneTimeStore{}
+	_ sessions.SessionLoader = &OneTimeStore{}
+)
+
+const (
+	defaultOneTimeQueryParamKey = "pomerium_session_token"
+	// DefaultOneTimeTokenExpire is the default lifetime of a one-time token.
+	DefaultOneTimeTokenExpire = 5 * time.Minute
+
+	oneTimeTokenLeasePrefix = "pomerium/session-token/"
+)
+
+// timeNow is time.Now but pulled out as a variable for tests.
+var timeNow = time.Now
+
+// OneTimeStore implements the load session store interface using single-use
+// tokens passed as query parameters. The token is a random reference to a
+// session stored in the databroker and is deleted the first time it is
+// loaded, so that leaked URLs can't be replayed.
+type OneTimeStore struct {
+	queryParamKey    string
+	expire           time.Duration
+	encoder          encoding.Marshaler
+	dataBrokerClient databroker.DataBrokerServiceClient
+}
+
+// NewOneTimeStore returns a new one-time query param store. Tokens saved by
+// the store expire after the given duration.
+func NewOneTimeStore(
+	enc encoding.MarshalUnmarshaler,
+	dataBrokerClient databroker.DataBrokerServiceClient,
+	qp string,
+	expire time.Duration,
+) *OneTimeStore {
+	if qp == "" {
+		qp = defaultOneTimeQueryParamKey
+	}
+	if expire <= 0 {
+		expire = DefaultOneTimeTokenExpire
+	}
+	return &OneTimeStore{
+		queryParamKey:    qp,
+		expire:           expire,
+		encoder:          enc,
+		dataBrokerClient: dataBrokerClient,
+	}
+}
+
+// LoadSession loads the session referenced by the token in the URL query
+// parameters and invalidates the token.
+func (qp *OneTimeStore) LoadSession(r *http.Request) (string, error) {
+	id := r.URL.Query().Get(qp.queryParamKey)
+	if id == "" {
+		return "", sessions.ErrNoSessionFound
+	}
+
+	ctx := r.Context()
+	redeemed, err := qp.redeemToken(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("internal/sessions: error redeeming session token: %w", err)
+	} else if !redeemed {
+		return "", sessions.ErrNoSessionFound
+	}
+
+	token := &session.SessionToken{Id: id}
+	err = databroker.Get(ctx, qp.dataBrokerClient, token)
+	if status.Code(err) == codes.NotFound {
+		return "", sessions.ErrNoSessionFound
+	} else if err != nil {
+		return "", fmt.Errorf("internal/sessions: error loading session token: %w", err)
+	}
+
+	// the token can't be redeemed again, but delete it as it's no longer needed
+	err = qp.deleteToken(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("internal/sessions: error invalidating session token: %w", err)
+	}
+
+	if token.ExpiresAt != nil && token.ExpiresAt.AsTime().Before(timeNow()) {
+		return "", sessions.ErrNoSessionFound
+	}
+	return token.GetJwt(), nil
+}
+
+// ClearSession removes the token from the request's query parameters.
+func (qp *OneTimeStore) ClearSession(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	params.Del(qp.queryParamKey)
+	r.URL.RawQuery = params.Encode()
+}
+
+// SaveSession stores the session in the databroker and sets a new one-time
+// token referencing it in the request's query parameters.
+func (qp *OneTimeStore) SaveSession(w http.ResponseWriter, r *http.Request, x interface{}) error {
+	data, err := qp.encoder.Marshal(x)
+	if err != nil {
+		return err
+	}
+
+	token := &session.SessionToken{
+		Id:        base64.RawURLEncoding.EncodeToString(cryptutil.NewKey()),
+		Jwt:       string(data),
+		ExpiresAt: timestamppb.New(timeNow().Add(qp.expire)),
+	}
+	_, err = databroker.Put(r.Context(), qp.dataBrokerClient, token)
+	if err != nil {
+		return fmt.Errorf("internal/sessions: error saving session token: %w", err)
+	}
+
+	params := r.URL.Query()
+	params.Set(qp.queryParamKey, token.GetId())
+	r.URL.RawQuery = params.Encode()
+	return nil
+}
+
+// redeemToken claims the token, and returns false if it was already claimed.
+// Tokens are claimed with a databroker lease, which the databroker grants to a
+// single client, for as long as tokens are valid, so that concurrent requests
+// can't both load the session.
+func (qp *OneTimeStore) redeemToken(ctx context.Context, id string) (bool, error) {
+	_, err := qp.dataBrokerClient.AcquireLease(ctx, &databroker.AcquireLeaseRequest{
+		Name:     oneTimeTokenLeasePrefix + id,
+		Duration: durationpb.New(qp.expire),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (qp *OneTimeStore) deleteToken(ctx context.Context, id string) error {
+	any := protoutil.NewAny(&session.SessionToken{Id: id})
+	_, err := qp.dataBrokerClient.Put(ctx, &databroker.PutRequest{
+		Records: []*databroker.Record{{
+			Type:      any.GetTypeUrl(),
+			Id:        id,
+			Data:      any,
+			DeletedAt: timestamppb.Now(),
+		}},
+	})
+	return err
+}
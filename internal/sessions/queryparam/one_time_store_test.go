@@ -0,0 +1,142 @@
+package queryparam
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type mockDataBrokerClient struct {
+	databroker.DataBrokerServiceClient
+
+	mu      sync.Mutex
+	records map[string]*databroker.Record
+	leases  map[string]struct{}
+}
+
+func newMockDataBrokerClient() *mockDataBrokerClient {
+	return &mockDataBrokerClient{
+		records: make(map[string]*databroker.Record),
+		leases:  make(map[string]struct{}),
+	}
+}
+
+func (m *mockDataBrokerClient) AcquireLease(_ context.Context, in *databroker.AcquireLeaseRequest, _ ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.leases[in.GetName()]; ok {
+		return nil, status.Error(codes.AlreadyExists, "lease is already taken")
+	}
+	m.leases[in.GetName()] = struct{}{}
+	return &databroker.AcquireLeaseResponse{Id: in.GetName()}, nil
+}
+
+func (m *mockDataBrokerClient) Get(_ context.Context, in *databroker.GetRequest, _ ...grpc.CallOption) (*databroker.GetResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[in.GetType()+"/"+in.GetId()]
+	if !ok || record.GetDeletedAt() != nil {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &databroker.GetResponse{Record: record}, nil
+}
+
+func (m *mockDataBrokerClient) Put(_ context.Context, in *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, record := range in.GetRecords() {
+		m.records[record.GetType()+"/"+record.GetId()] = record
+	}
+	return &databroker.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func TestOneTimeStore(t *testing.T) {
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	client := newMockDataBrokerClient()
+	store := NewOneTimeStore(encoder, client, "", time.Minute)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	require.NoError(t, store.SaveSession(nil, r, &sessions.State{ID: "SESSION_ID"}))
+	token := r.URL.Query().Get(defaultOneTimeQueryParamKey)
+	assert.NotEmpty(t, token)
+	assert.NotContains(t, r.URL.RawQuery, "SESSION_ID")
+	assert.Equal(t, url.QueryEscape(token), token, "token should be URL-safe")
+
+	t.Run("single use", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/?"+url.Values{defaultOneTimeQueryParamKey: {token}}.Encode(), nil)
+		rawJWT, err := store.LoadSession(r)
+		require.NoError(t, err)
+
+		var s sessions.State
+		require.NoError(t, encoder.Unmarshal([]byte(rawJWT), &s))
+		assert.Equal(t, "SESSION_ID", s.ID)
+
+		_, err = store.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		require.NoError(t, store.SaveSession(nil, r, &sessions.State{ID: "SESSION_ID"}))
+
+		var wg sync.WaitGroup
+		var loaded int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := httptest.NewRequest("GET", "/?"+r.URL.RawQuery, nil)
+				if _, err := store.LoadSession(r); err == nil {
+					atomic.AddInt32(&loaded, 1)
+				} else {
+					assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), loaded)
+	})
+	t.Run("expired", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		require.NoError(t, store.SaveSession(nil, r, &sessions.State{ID: "SESSION_ID"}))
+
+		timeNow = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		defer func() { timeNow = time.Now }()
+
+		_, err := store.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+	t.Run("missing", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		_, err := store.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+
+		r = httptest.NewRequest("GET", "/?"+url.Values{defaultOneTimeQueryParamKey: {"unknown"}}.Encode(), nil)
+		_, err = store.LoadSession(r)
+		assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+	})
+	t.Run("clear", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/?"+url.Values{defaultOneTimeQueryParamKey: {token}, "x": {"y"}}.Encode(), nil)
+		store.ClearSession(nil, r)
+		assert.Equal(t, "x=y", r.URL.RawQuery)
+	})
+}
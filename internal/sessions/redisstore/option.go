@@ -0,0 +1,27 @@
+package redisstore
+
+import (
+	"crypto/tls"
+)
+
+type config struct {
+	tls *tls.Config
+}
+
+// An Option customizes a Store.
+type Option func(*config)
+
+// WithTLSConfig sets the tls.Config which Store uses.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(cfg *config) {
+		cfg.tls = tlsConfig
+	}
+}
+
+func getConfig(options ...Option) *config {
+	cfg := new(config)
+	for _, o := range options {
+		o(cfg)
+	}
+	return cfg
+}
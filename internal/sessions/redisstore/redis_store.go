@@ -0,0 +1,154 @@
+// Package redisstore provides a redis based implementation of a session store.
+//
+// Session state is persisted in redis and the session cookie only carries an
+// opaque, randomly generated reference to it. This keeps the cookie small
+// regardless of how large the underlying session is.
+package redisstore
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/internal/redisutil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+var (
+	_ sessions.SessionStore  = &Store{}
+	_ sessions.SessionLoader = &Store{}
+)
+
+const (
+	sessionKeyTpl = redisutil.KeyPrefix + "session.%s"
+
+	// referenceLength is the number of random bytes used for the session
+	// reference stored in the cookie.
+	referenceLength = 32
+)
+
+// timeNow is time.Now but pulled out as a variable for tests.
+var timeNow = time.Now
+
+// Store implements the session store interface using redis to hold the
+// session and a cookie to hold a reference to it.
+type Store struct {
+	client     redis.UniversalClient
+	getOptions cookie.GetOptionsFunc
+	encoder    encoding.MarshalUnmarshaler
+}
+
+// New creates a new redis session store.
+func New(
+	rawURL string,
+	getOptions cookie.GetOptionsFunc,
+	encoder encoding.MarshalUnmarshaler,
+	options ...Option,
+) (*Store, error) {
+	if encoder == nil {
+		return nil, fmt.Errorf("internal/sessions: encoder cannot be nil")
+	}
+	cfg := getConfig(options...)
+	client, err := redisutil.NewClientFromURL(rawURL, cfg.tls)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		client:     client,
+		getOptions: getOptions,
+		encoder:    encoder,
+	}, nil
+}
+
+// Close closes the underlying redis connection.
+func (s *Store) Close() error {
+	return s.client.Close()
+}
+
+// ClearSession removes the session from redis and clears the reference
+// cookie.
+func (s *Store) ClearSession(w http.ResponseWriter, r *http.Request) {
+	if ref, ok := s.loadReference(r); ok {
+		_ = s.client.Del(r.Context(), sessionKey(ref)).Err()
+	}
+
+	opts := s.getOptions()
+	c := opts.NewCookie(r, "")
+	c.MaxAge = -1
+	c.Expires = timeNow().Add(-time.Hour)
+	opts.SetCookie(w, c)
+}
+
+// LoadSession returns the session referenced by the request's cookie.
+func (s *Store) LoadSession(r *http.Request) (string, error) {
+	ref, ok := s.loadReference(r)
+	if !ok {
+		return "", sessions.ErrNoSessionFound
+	}
+
+	jwt, err := s.client.Get(r.Context(), sessionKey(ref)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", sessions.ErrNoSessionFound
+	} else if err != nil {
+		return "", fmt.Errorf("internal/sessions: error loading session from redis: %w", err)
+	}
+
+	var state sessions.State
+	if err := s.encoder.Unmarshal([]byte(jwt), &state); err != nil {
+		return "", fmt.Errorf("%w: %s", sessions.ErrMalformed, err)
+	}
+	return jwt, nil
+}
+
+// SaveSession saves a session to redis and sets a cookie referencing it.
+// Any session previously referenced by the request is removed.
+func (s *Store) SaveSession(w http.ResponseWriter, r *http.Request, x interface{}) error {
+	var value []byte
+	switch v := x.(type) {
+	case []byte:
+		value = v
+	case string:
+		value = []byte(v)
+	default:
+		data, err := s.encoder.Marshal(x)
+		if err != nil {
+			return err
+		}
+		value = data
+	}
+
+	ctx := r.Context()
+	ref := cryptutil.NewRandomStringN(referenceLength)
+	opts := s.getOptions()
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if old, ok := s.loadReference(r); ok {
+			p.Del(ctx, sessionKey(old))
+		}
+		p.Set(ctx, sessionKey(ref), value, opts.Expire)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("internal/sessions: error saving session to redis: %w", err)
+	}
+
+	opts.SetCookie(w, opts.NewCookie(r, ref))
+	return nil
+}
+
+func (s *Store) loadReference(r *http.Request) (string, bool) {
+	c, err := r.Cookie(s.getOptions().Name)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return c.Value, true
+}
+
+func sessionKey(ref string) string {
+	return fmt.Sprintf(sessionKeyTpl, ref)
+}
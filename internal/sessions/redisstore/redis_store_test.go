@@ -0,0 +1,93 @@
+package redisstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestStore(t *testing.T) {
+	if os.Getenv("GITHUB_ACTION") != "" && runtime.GOOS == "darwin" {
+		t.Skip("Github action can not run docker on MacOS")
+	}
+
+	encoder, err := jws.NewHS256Signer(cryptutil.NewKey())
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.WithTestRedis(false, func(rawURL string) error {
+		s, err := New(rawURL, func() cookie.Options {
+			return cookie.Options{
+				Name:     "_pomerium",
+				Secure:   true,
+				HTTPOnly: true,
+				Expire:   time.Minute,
+			}
+		}, encoder)
+		require.NoError(t, err)
+		defer func() { _ = s.Close() }()
+
+		t.Run("no session", func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			_, err := s.LoadSession(r)
+			assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+		})
+		t.Run("save and load", func(t *testing.T) {
+			state := &sessions.State{ID: "xyz", Subject: "user"}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			require.NoError(t, s.SaveSession(w, r, state))
+
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1)
+			assert.NotEmpty(t, cookies[0].Value)
+
+			r = httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(cookies[0])
+			jwt, err := s.LoadSession(r)
+			require.NoError(t, err)
+
+			var loaded sessions.State
+			require.NoError(t, encoder.Unmarshal([]byte(jwt), &loaded))
+			assert.Equal(t, state, &loaded)
+
+			w = httptest.NewRecorder()
+			s.ClearSession(w, r)
+			_, err = s.LoadSession(r)
+			assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+		})
+		t.Run("save replaces previous session", func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			require.NoError(t, s.SaveSession(w, r, &sessions.State{ID: "one"}))
+			first := w.Result().Cookies()[0]
+
+			r = httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(first)
+			w = httptest.NewRecorder()
+			require.NoError(t, s.SaveSession(w, r, &sessions.State{ID: "two"}))
+
+			_, err := s.LoadSession(r)
+			assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+		})
+		t.Run("unknown reference", func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: "_pomerium", Value: "does-not-exist"})
+			_, err := s.LoadSession(r)
+			assert.ErrorIs(t, err, sessions.ErrNoSessionFound)
+		})
+		return nil
+	}))
+}
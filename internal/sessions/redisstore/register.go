@@ -0,0 +1,62 @@
+package redisstore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pomerium/pomerium/internal/redisutil"
+	"github.com/pomerium/pomerium/pkg/sessionstore"
+)
+
+// Name is the name the redis session store is registered under.
+const Name = "redis"
+
+func init() {
+	sessionstore.Register(Name, newFromOptions)
+}
+
+// clients holds a redis client per URL, so that recreating the session store
+// on every config change doesn't leak connections.
+var clients struct {
+	sync.Mutex
+	m map[string]redis.UniversalClient
+}
+
+func newFromOptions(options sessionstore.Options) (sessionstore.SessionStore, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("internal/sessions: session_store_url is required for the redis session store")
+	}
+	if options.Encoder == nil {
+		return nil, fmt.Errorf("internal/sessions: encoder cannot be nil")
+	}
+	client, err := getClient(options.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		client:     client,
+		getOptions: options.GetCookieOptions,
+		encoder:    options.Encoder,
+	}, nil
+}
+
+func getClient(rawURL string) (redis.UniversalClient, error) {
+	clients.Lock()
+	defer clients.Unlock()
+
+	if client, ok := clients.m[rawURL]; ok {
+		return client, nil
+	}
+
+	client, err := redisutil.NewClientFromURL(rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("internal/sessions: invalid redis url: %w", err)
+	}
+	if clients.m == nil {
+		clients.m = make(map[string]redis.UniversalClient)
+	}
+	clients.m[rawURL] = client
+	return client, nil
+}
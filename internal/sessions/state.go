@@ -27,6 +27,10 @@ type State struct {
 	// Azure returns OID which should be used instead of subject.
 	OID string `json:"oid,omitempty"`
 
+	// LinkedUserID is the user the identity provider account is linked to,
+	// when account linking is enabled.
+	LinkedUserID string `json:"linked_user_id,omitempty"`
+
 	// DatabrokerServerVersion tracks the last referenced databroker server version
 	// for the saved session.
 	DatabrokerServerVersion uint64 `json:"databroker_server_version,omitempty"`
@@ -36,6 +40,38 @@ type State struct {
 
 	// IdentityProviderID is the identity provider for the session.
 	IdentityProviderID string `json:"idp_id,omitempty"`
+
+	// LastActivity is the last time the session was used. It is used to
+	// enforce an idle timeout independent of the session's absolute expiry.
+	LastActivity *jwt.NumericDate `json:"last_activity,omitempty"`
+
+	// ACR is the authentication context class reference reported by the
+	// identity provider, e.g. to distinguish MFA from password-only sign-ins.
+	ACR string `json:"acr,omitempty"`
+	// AMR are the authentication methods references reported by the identity
+	// provider, e.g. "pwd", "otp" or "mfa".
+	AMR AuthenticationMethods `json:"amr,omitempty"`
+}
+
+// AuthenticationMethods are the authentication methods used for a session.
+// Some identity providers use a single string instead of a list, so both are
+// accepted when unmarshaling.
+type AuthenticationMethods []string
+
+// UnmarshalJSON unmarshals authentication methods from a string or a list of
+// strings.
+func (amr *AuthenticationMethods) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*amr = AuthenticationMethods{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return err
+	}
+	*amr = ss
+	return nil
 }
 
 // NewState creates a new State.
@@ -61,12 +97,44 @@ func (s *State) WithNewIssuer(issuer string, audience []string) State {
 
 // UserID returns the corresponding user ID for a session.
 func (s *State) UserID() string {
+	if s.LinkedUserID != "" {
+		return s.LinkedUserID
+	}
+	return s.IdentityProviderUserID()
+}
+
+// IdentityProviderUserID returns the ID of the user at the identity provider,
+// regardless of account linking.
+func (s *State) IdentityProviderUserID() string {
 	if s.OID != "" {
 		return s.OID
 	}
 	return s.Subject
 }
 
+// IsIdle returns true if the session has not been used within the given idle
+// timeout. Sessions which have never been refreshed are considered active as
+// of the time they were issued. A zero timeout disables the check.
+func (s *State) IsIdle(idleTimeout time.Duration) bool {
+	if idleTimeout <= 0 {
+		return false
+	}
+
+	lastActivity := s.LastActivity
+	if lastActivity == nil {
+		lastActivity = s.IssuedAt
+	}
+	if lastActivity == nil {
+		return false
+	}
+	return timeNow().Sub(lastActivity.Time()) > idleTimeout
+}
+
+// Touch sets the session's last activity to the current time.
+func (s *State) Touch() {
+	s.LastActivity = jwt.NewNumericDate(timeNow())
+}
+
 // UnmarshalJSON returns a State struct from JSON. Additionally munges
 // a user's session by using by setting `user` claim to `sub` if empty.
 func (s *State) UnmarshalJSON(data []byte) error {
@@ -64,3 +64,94 @@ func TestState_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticationMethods_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    AuthenticationMethods
+		wantErr bool
+	}{
+		{"list", `{"jti":"xyz","acr":"mfa","amr":["pwd","otp"]}`, AuthenticationMethods{"pwd", "otp"}, false},
+		{"string", `{"jti":"xyz","amr":"pwd"}`, AuthenticationMethods{"pwd"}, false},
+		{"missing", `{"jti":"xyz"}`, nil, false},
+		{"invalid", `{"jti":"xyz","amr":1}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s State
+			err := json.Unmarshal([]byte(tt.in), &s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("State.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, s.AMR); diff != "" {
+				t.Errorf("State.UnmarshalJSON() amr = %v", diff)
+			}
+		})
+	}
+}
+
+func TestState_IsIdle(t *testing.T) {
+	fixedTime := time.Date(2009, 11, 17, 20, 34, 58, 651387237, time.UTC)
+	timeNow = func() time.Time {
+		return fixedTime
+	}
+	defer func() { timeNow = time.Now }()
+
+	tests := []struct {
+		name        string
+		state       *State
+		idleTimeout time.Duration
+		want        bool
+	}{
+		{"disabled", &State{IssuedAt: jwt.NewNumericDate(fixedTime.Add(-time.Hour))}, 0, false},
+		{"no timestamps", &State{}, time.Minute, false},
+		{"issued recently", &State{IssuedAt: jwt.NewNumericDate(fixedTime.Add(-time.Second))}, time.Minute, false},
+		{"issued long ago", &State{IssuedAt: jwt.NewNumericDate(fixedTime.Add(-time.Hour))}, time.Minute, true},
+		{"recent activity", &State{
+			IssuedAt:     jwt.NewNumericDate(fixedTime.Add(-time.Hour)),
+			LastActivity: jwt.NewNumericDate(fixedTime.Add(-time.Second)),
+		}, time.Minute, false},
+		{"old activity", &State{
+			IssuedAt:     jwt.NewNumericDate(fixedTime.Add(-time.Hour)),
+			LastActivity: jwt.NewNumericDate(fixedTime.Add(-2 * time.Minute)),
+		}, time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.IsIdle(tt.idleTimeout); got != tt.want {
+				t.Errorf("State.IsIdle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	s := &State{IssuedAt: jwt.NewNumericDate(fixedTime.Add(-time.Hour))}
+	s.Touch()
+	if s.IsIdle(time.Minute) {
+		t.Errorf("State.IsIdle() = true after Touch, want false")
+	}
+}
+
+func TestState_UserID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		state *State
+		want  string
+	}{
+		{"subject", &State{Subject: "SUBJECT"}, "SUBJECT"},
+		{"oid", &State{Subject: "SUBJECT", OID: "OID"}, "OID"},
+		{"linked", &State{Subject: "SUBJECT", OID: "OID", LinkedUserID: "LINKED"}, "LINKED"},
+	}
+	for _, tt := range tests {
+		if got := tt.state.UserID(); got != tt.want {
+			t.Errorf("%s: State.UserID() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	s := &State{OID: "OID", LinkedUserID: "LINKED"}
+	if got := s.IdentityProviderUserID(); got != "OID" {
+		t.Errorf("State.IdentityProviderUserID() = %v, want OID", got)
+	}
+}
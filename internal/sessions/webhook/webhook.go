@@ -0,0 +1,135 @@
+// Package webhook publishes session lifecycle events to a webhook.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sessions"
+)
+
+const (
+	defaultTimeout        = 5 * time.Second
+	defaultMaxConcurrency = 16
+)
+
+type config struct {
+	client         *http.Client
+	timeout        time.Duration
+	maxConcurrency int
+}
+
+// An Option customizes the webhook publisher.
+type Option func(*config)
+
+// WithHTTPClient sets the http client used to call the webhook.
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *config) {
+		cfg.client = client
+	}
+}
+
+// WithTimeout sets the timeout for a single webhook call.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithMaxConcurrency sets the maximum number of concurrent webhook calls.
+// Events published while the limit is reached are dropped.
+func WithMaxConcurrency(maxConcurrency int) Option {
+	return func(cfg *config) {
+		cfg.maxConcurrency = maxConcurrency
+	}
+}
+
+func getConfig(options ...Option) *config {
+	cfg := new(config)
+	WithHTTPClient(http.DefaultClient)(cfg)
+	WithTimeout(defaultTimeout)(cfg)
+	WithMaxConcurrency(defaultMaxConcurrency)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// A Publisher publishes session lifecycle events to a webhook by POSTing them
+// as JSON.
+type Publisher struct {
+	cfg *config
+	url string
+	sem chan struct{}
+}
+
+// New creates a new Publisher for the webhook url.
+func New(url string, options ...Option) *Publisher {
+	cfg := getConfig(options...)
+	return &Publisher{
+		cfg: cfg,
+		url: url,
+		sem: make(chan struct{}, cfg.maxConcurrency),
+	}
+}
+
+// Hook returns a sessions.LifecycleHook which publishes events to the
+// webhook in the background.
+func (p *Publisher) Hook() sessions.LifecycleHook {
+	return func(ctx context.Context, evt sessions.LifecycleEvent) {
+		select {
+		case p.sem <- struct{}{}:
+		default:
+			log.Warn(ctx).
+				Str("type", string(evt.Type)).
+				Str("session_id", evt.SessionID).
+				Msg("internal/sessions: dropping webhook event due to too many pending requests")
+			return
+		}
+		go func() {
+			defer func() { <-p.sem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), p.cfg.timeout)
+			defer cancel()
+
+			if err := p.Publish(ctx, evt); err != nil {
+				log.Error(ctx).Err(err).
+					Str("type", string(evt.Type)).
+					Str("session_id", evt.SessionID).
+					Msg("internal/sessions: failed to publish session event to webhook")
+			}
+		}()
+	}
+}
+
+// Publish publishes an event to the webhook.
+func (p *Publisher) Publish(ctx context.Context, evt sessions.LifecycleEvent) error {
+	body, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("internal/sessions: error marshaling session event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("internal/sessions: error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.cfg.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("internal/sessions: error calling webhook: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("internal/sessions: webhook returned unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+)
+
+func TestPublisher(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan sessions.LifecycleEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var evt sessions.LifecycleEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&evt))
+		received <- evt
+	}))
+	t.Cleanup(srv.Close)
+
+	evt := sessions.LifecycleEvent{
+		Type:      sessions.LifecycleEventRevoked,
+		SessionID: "s1",
+		UserID:    "u1",
+		Time:      time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	New(srv.URL).Hook()(context.Background(), evt)
+
+	select {
+	case got := <-received:
+		assert.Equal(t, evt, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+	}
+}
+
+func TestPublisher_Error(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := New(srv.URL).Publish(context.Background(), sessions.LifecycleEvent{Type: sessions.LifecycleEventCreated})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "500")
+}
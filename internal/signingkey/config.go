@@ -0,0 +1,55 @@
+package signingkey
+
+import (
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type config struct {
+	dataBrokerClient databroker.DataBrokerServiceClient
+	rotationInterval time.Duration
+	rotationOverlap  time.Duration
+	now              func() time.Time
+}
+
+func newConfig(options ...Option) *config {
+	cfg := new(config)
+	WithNow(time.Now)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// An Option customizes the configuration used for the signing key rotator.
+type Option func(*config)
+
+// WithDataBrokerClient sets the databroker client in the config.
+func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
+	return func(cfg *config) {
+		cfg.dataBrokerClient = dataBrokerClient
+	}
+}
+
+// WithRotationInterval sets how often a new signing key is generated. A zero
+// interval disables rotation.
+func WithRotationInterval(dur time.Duration) Option {
+	return func(cfg *config) {
+		cfg.rotationInterval = dur
+	}
+}
+
+// WithRotationOverlap sets how long a superseded signing key is still published.
+func WithRotationOverlap(dur time.Duration) Option {
+	return func(cfg *config) {
+		cfg.rotationOverlap = dur
+	}
+}
+
+// WithNow customizes the time.Now function used by the rotator.
+func WithNow(now func() time.Time) Option {
+	return func(cfg *config) {
+		cfg.now = now
+	}
+}
@@ -0,0 +1,214 @@
+package signingkey
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/crypt"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// maxWait is the maximum time the rotator waits before checking the signing
+// keys again, so that configuration changes are picked up.
+const maxWait = time.Minute
+
+// A Rotator generates new signing keys on a schedule and retires superseded
+// keys once the overlap window has passed.
+type Rotator struct {
+	cfg *atomicutil.Value[*config]
+}
+
+// NewRotator creates a new Rotator.
+func NewRotator(options ...Option) *Rotator {
+	r := &Rotator{
+		cfg: atomicutil.NewValue(newConfig()),
+	}
+	r.UpdateConfig(options...)
+	return r
+}
+
+// UpdateConfig updates the rotator with the new options.
+func (r *Rotator) UpdateConfig(options ...Option) {
+	r.cfg.Store(newConfig(options...))
+}
+
+// Run runs the rotator. This method blocks until an error occurs or the given context is canceled.
+func (r *Rotator) Run(ctx context.Context) error {
+	leaser := databroker.NewLeaser("signing_key_rotator", time.Second*30, r)
+	return leaser.Run(ctx)
+}
+
+// RunLeased runs the rotator when a lease is acquired.
+func (r *Rotator) RunLeased(ctx context.Context) error {
+	ctx = log.WithContext(ctx, func(c zerolog.Context) zerolog.Context {
+		return c.Str("service", "signing_key_rotator")
+	})
+
+	for {
+		wait := maxWait
+		if cfg := r.cfg.Load(); cfg.rotationInterval > 0 {
+			next, err := r.runOnce(ctx, cfg)
+			if err != nil {
+				log.Error(ctx).Err(err).Msg("signingkey: error rotating signing keys")
+			} else if next < wait {
+				wait = next
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// GetDataBrokerServiceClient gets the databroker client.
+func (r *Rotator) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return r.cfg.Load().dataBrokerClient
+}
+
+// runOnce rotates the signing keys stored in the databroker and returns how
+// long to wait until the next change is due.
+func (r *Rotator) runOnce(ctx context.Context, cfg *config) (time.Duration, error) {
+	records, _, _, err := databroker.InitialSync(ctx, cfg.dataBrokerClient, &databroker.SyncLatestRequest{
+		Type: grpcutil.GetTypeURL(new(crypt.SigningKey)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("signingkey: error listing signing keys: %w", err)
+	}
+
+	var keys []*crypt.SigningKey
+	for _, record := range records {
+		key := new(crypt.SigningKey)
+		if err := record.GetData().UnmarshalTo(key); err != nil {
+			log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("signingkey: invalid signing key record, ignoring")
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	now := cfg.now()
+	updated, deleted, err := rotate(cfg, now, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	var changes []*databroker.Record
+	for _, key := range updated {
+		changes = append(changes, databroker.NewRecord(key))
+	}
+	for _, key := range deleted {
+		record := databroker.NewRecord(key)
+		record.DeletedAt = timestamppb.New(now)
+		changes = append(changes, record)
+	}
+	if len(changes) > 0 {
+		_, err = cfg.dataBrokerClient.Put(ctx, &databroker.PutRequest{Records: changes})
+		if err != nil {
+			return 0, fmt.Errorf("signingkey: error storing signing keys: %w", err)
+		}
+		for _, key := range updated {
+			if key.GetRetireAt() == nil {
+				log.Info(ctx).Str("key_id", key.GetId()).Msg("signingkey: rotated signing key")
+			}
+		}
+		for _, key := range deleted {
+			log.Info(ctx).Str("key_id", key.GetId()).Msg("signingkey: retired signing key")
+		}
+	}
+
+	return nextChange(cfg, now, keys, updated, deleted), nil
+}
+
+// rotate computes the changes needed to bring the signing keys up to date. A
+// new key is generated when there is no current key or when the current key
+// is older than the rotation interval. Superseded keys are given a retirement
+// time and are deleted once it has passed.
+func rotate(cfg *config, now time.Time, keys []*crypt.SigningKey) (updated, deleted []*crypt.SigningKey, err error) {
+	var current *crypt.SigningKey
+	for _, key := range sortKeys(keys) {
+		switch {
+		case isRetired(key, now):
+			deleted = append(deleted, key)
+		case key.GetRetireAt() != nil:
+		case current == nil:
+			current = key
+		default:
+			// only a single key should ever be current
+			key.RetireAt = timestamppb.New(now.Add(cfg.rotationOverlap))
+			updated = append(updated, key)
+		}
+	}
+
+	if current != nil && now.Before(current.GetCreatedAt().AsTime().Add(cfg.rotationInterval)) {
+		return updated, deleted, nil
+	}
+
+	key, err := newSigningKey(now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if current != nil {
+		current.RetireAt = timestamppb.New(now.Add(cfg.rotationOverlap))
+		updated = append(updated, current)
+	}
+	updated = append(updated, key)
+	return updated, deleted, nil
+}
+
+// nextChange returns how long until the current key is due to be rotated or a
+// superseded key is due to be retired.
+func nextChange(cfg *config, now time.Time, keys, updated, deleted []*crypt.SigningKey) time.Duration {
+	isDeleted := map[string]bool{}
+	for _, key := range deleted {
+		isDeleted[key.GetId()] = true
+	}
+
+	next := maxWait
+	for _, key := range append(keys, updated...) {
+		if isDeleted[key.GetId()] {
+			continue
+		}
+
+		at := key.GetCreatedAt().AsTime().Add(cfg.rotationInterval)
+		if key.GetRetireAt() != nil {
+			at = key.GetRetireAt().AsTime()
+		}
+		if d := at.Sub(now); d < next {
+			next = d
+		}
+	}
+	if next < 0 {
+		next = 0
+	}
+	return next
+}
+
+func newSigningKey(now time.Time) (*crypt.SigningKey, error) {
+	privateKey, err := cryptutil.NewSigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("signingkey: error generating signing key: %w", err)
+	}
+	encoded, err := cryptutil.EncodePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("signingkey: error encoding signing key: %w", err)
+	}
+	jwk, err := cryptutil.PublicJWKFromBytes(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("signingkey: error encoding signing key: %w", err)
+	}
+	return &crypt.SigningKey{
+		Id:         jwk.KeyID,
+		PrivateKey: encoded,
+		CreatedAt:  timestamppb.New(now),
+	}, nil
+}
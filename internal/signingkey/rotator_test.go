@@ -0,0 +1,105 @@
+package signingkey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/crypt"
+)
+
+func TestRotate(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig(
+		WithRotationInterval(24*time.Hour),
+		WithRotationOverlap(time.Hour),
+	)
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// initial key
+	updated, deleted, err := rotate(cfg, t0, nil)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	require.Len(t, updated, 1)
+	k1 := updated[0]
+	assert.Nil(t, k1.GetRetireAt())
+	jwk, err := cryptutil.PublicJWKFromBytes(k1.GetPrivateKey())
+	require.NoError(t, err)
+	assert.Equal(t, jwk.KeyID, k1.GetId(), "should use the key thumbprint as the id")
+
+	// nothing to do before the rotation interval
+	updated, deleted, err = rotate(cfg, t0.Add(23*time.Hour), []*crypt.SigningKey{k1})
+	require.NoError(t, err)
+	assert.Empty(t, updated)
+	assert.Empty(t, deleted)
+
+	// rotate after the rotation interval
+	t1 := t0.Add(24 * time.Hour)
+	updated, deleted, err = rotate(cfg, t1, []*crypt.SigningKey{k1})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	require.Len(t, updated, 2)
+	assert.Equal(t, k1.GetId(), updated[0].GetId())
+	assert.Equal(t, t1.Add(time.Hour), updated[0].GetRetireAt().AsTime(), "should retire the old key after the overlap")
+	k2 := updated[1]
+	assert.Nil(t, k2.GetRetireAt())
+	assert.NotEqual(t, k1.GetId(), k2.GetId())
+
+	// both keys are published during the overlap window
+	assert.Equal(t, string(k2.GetPrivateKey())+string(k1.GetPrivateKey()), string(Encode([]*crypt.SigningKey{k1, k2})))
+
+	// retire the old key after the overlap window
+	updated, deleted, err = rotate(cfg, t1.Add(time.Hour), []*crypt.SigningKey{k1, k2})
+	require.NoError(t, err)
+	assert.Empty(t, updated)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, k1.GetId(), deleted[0].GetId())
+	}
+}
+
+func TestRotateMultipleCurrentKeys(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig(
+		WithRotationInterval(24*time.Hour),
+		WithRotationOverlap(time.Hour),
+	)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	k1 := &crypt.SigningKey{Id: "k1", CreatedAt: timestamppb.New(now.Add(-2 * time.Hour))}
+	k2 := &crypt.SigningKey{Id: "k2", CreatedAt: timestamppb.New(now.Add(-time.Hour))}
+	updated, deleted, err := rotate(cfg, now, []*crypt.SigningKey{k1, k2})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+	if assert.Len(t, updated, 1) {
+		assert.Equal(t, "k1", updated[0].GetId(), "should retire all but the newest key")
+		assert.Equal(t, now.Add(time.Hour), updated[0].GetRetireAt().AsTime())
+	}
+}
+
+func TestNextChange(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig(
+		WithRotationInterval(24*time.Hour),
+		WithRotationOverlap(time.Hour),
+	)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	current := &crypt.SigningKey{Id: "k2", CreatedAt: timestamppb.New(now.Add(-24*time.Hour + 10*time.Second))}
+	assert.Equal(t, 10*time.Second, nextChange(cfg, now, []*crypt.SigningKey{current}, nil, nil))
+
+	old := &crypt.SigningKey{
+		Id:        "k1",
+		CreatedAt: timestamppb.New(now.Add(-48 * time.Hour)),
+		RetireAt:  timestamppb.New(now.Add(5 * time.Second)),
+	}
+	assert.Equal(t, 5*time.Second, nextChange(cfg, now, []*crypt.SigningKey{current, old}, nil, nil))
+	assert.Equal(t, 10*time.Second, nextChange(cfg, now, []*crypt.SigningKey{current, old}, nil, []*crypt.SigningKey{old}))
+	assert.Equal(t, maxWait, nextChange(cfg, now, nil, nil, nil))
+}
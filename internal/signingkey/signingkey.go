@@ -0,0 +1,48 @@
+// Package signingkey implements automated rotation of the JWT signing key.
+//
+// The rotator runs in the databroker service and stores the generated keys as
+// databroker records. Every other service syncs those records and publishes
+// the keys via the /.well-known/pomerium/jwks.json endpoint. When a key is
+// rotated, the superseded key is still published for an overlap window so that
+// JWTs signed by it can be verified, and is then retired.
+package signingkey
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/crypt"
+)
+
+// Encode encodes the published signing keys as a PEM bundle. The current
+// signing key comes first, followed by the superseded keys, newest first.
+func Encode(keys []*crypt.SigningKey) []byte {
+	keys = sortKeys(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		buf.Write(bytes.TrimSpace(key.GetPrivateKey()))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// sortKeys sorts the keys so that unretired keys come first, then by creation
+// time, newest first.
+func sortKeys(keys []*crypt.SigningKey) []*crypt.SigningKey {
+	keys = append([]*crypt.SigningKey(nil), keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		iRetired, jRetired := keys[i].GetRetireAt() != nil, keys[j].GetRetireAt() != nil
+		if iRetired != jRetired {
+			return !iRetired
+		}
+		return keys[i].GetCreatedAt().AsTime().After(keys[j].GetCreatedAt().AsTime())
+	})
+	return keys
+}
+
+// isRetired returns true if the key should no longer be published.
+func isRetired(key *crypt.SigningKey, now time.Time) bool {
+	return key.GetRetireAt() != nil && !now.Before(key.GetRetireAt().AsTime())
+}
@@ -18,6 +18,10 @@ var (
 	TagKeyStorageOperation = tag.MustNewKey("operation")
 	TagKeyStorageResult    = tag.MustNewKey("result")
 	TagKeyStorageBackend   = tag.MustNewKey("backend")
+
+	TagKeySessionStore = tag.MustNewKey("store")
+
+	TagKeyIdentityProvider = tag.MustNewKey("idp")
 )
 
 // Default distributions used by views in this package.
@@ -44,5 +48,7 @@ var (
 		HTTPServerViews,
 		InfoViews,
 		StorageViews,
+		SessionStoreViews,
+		IdentityProviderViews,
 	}
 )
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+var (
+	// IdentityProviderViews contains opencensus views for identity provider
+	// health check metrics
+	IdentityProviderViews = []*view.View{
+		IdentityProviderHealthyView,
+		IdentityProviderHealthCheckCountView,
+	}
+
+	identityProviderHealthy = stats.Int64(
+		"idp_healthy",
+		"1 if the identity provider is healthy, 0 if it is down",
+		stats.UnitDimensionless)
+
+	identityProviderHealthCheck = stats.Int64(
+		"idp_health_checks",
+		"Identity provider health checks",
+		stats.UnitDimensionless)
+
+	// IdentityProviderHealthyView is an OpenCensus view that tracks whether
+	// identity providers are healthy
+	IdentityProviderHealthyView = &view.View{
+		Name:        identityProviderHealthy.Name(),
+		Description: identityProviderHealthy.Description(),
+		Measure:     identityProviderHealthy,
+		TagKeys:     []tag.Key{TagKeyIdentityProvider},
+		Aggregation: view.LastValue(),
+	}
+
+	// IdentityProviderHealthCheckCountView is an OpenCensus view that tracks
+	// identity provider health checks by result
+	IdentityProviderHealthCheckCountView = &view.View{
+		Name:        "idp_health_checks_total",
+		Description: "Total identity provider health checks",
+		Measure:     identityProviderHealthCheck,
+		TagKeys:     []tag.Key{TagKeyIdentityProvider, TagKeyStorageResult},
+		Aggregation: view.Count(),
+	}
+)
+
+// RecordIdentityProviderHealthCheck records the result of an identity
+// provider health check, and whether the identity provider is healthy.
+func RecordIdentityProviderHealthCheck(ctx context.Context, idp string, checkErr error, healthy bool) {
+	result := "success"
+	if checkErr != nil {
+		result = "error"
+	}
+	var value int64
+	if healthy {
+		value = 1
+	}
+
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyIdentityProvider, idp), tag.Upsert(TagKeyStorageResult, result)},
+		identityProviderHealthCheck.M(1))
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+	err = stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyIdentityProvider, idp)},
+		identityProviderHealthy.M(value))
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
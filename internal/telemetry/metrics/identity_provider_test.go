@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+func Test_RecordIdentityProviderHealthCheck(t *testing.T) {
+	view.Unregister(IdentityProviderViews...)
+	view.Register(IdentityProviderViews...)
+
+	RecordIdentityProviderHealthCheck(context.Background(), "okta", nil, true)
+	testDataRetrieval(IdentityProviderHealthyView, t, "{ { {idp okta} }&{1")
+
+	RecordIdentityProviderHealthCheck(context.Background(), "okta", errors.New("down"), false)
+	testDataRetrieval(IdentityProviderHealthyView, t, "{ { {idp okta} }&{0")
+
+	rows, err := view.RetrieveData(IdentityProviderHealthCheckCountView.Name)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	for _, row := range rows {
+		assert.Equal(t, int64(1), row.Data.(*view.CountData).Value, row.Tags)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+var (
+	// SessionStoreViews contains opencensus views for session store metrics
+	SessionStoreViews = []*view.View{
+		SessionStoreOperationCountView,
+		SessionStoreOperationDurationView,
+	}
+
+	sessionStoreOperationDuration = stats.Int64(
+		"session_store_operation_duration_ms",
+		"Session store operation duration in ms",
+		"ms")
+
+	// SessionStoreOperationCountView is an OpenCensus view that tracks session
+	// store operations by store type, operation and result
+	SessionStoreOperationCountView = &view.View{
+		Name:        "session_store_operations_total",
+		Description: "Total session store operations",
+		Measure:     sessionStoreOperationDuration,
+		TagKeys:     []tag.Key{TagKeySessionStore, TagKeyStorageOperation, TagKeyStorageResult},
+		Aggregation: view.Count(),
+	}
+
+	// SessionStoreOperationDurationView is an OpenCensus view that tracks
+	// session store latency by store type, operation and result
+	SessionStoreOperationDurationView = &view.View{
+		Name:        sessionStoreOperationDuration.Name(),
+		Description: sessionStoreOperationDuration.Description(),
+		Measure:     sessionStoreOperationDuration,
+		TagKeys:     []tag.Key{TagKeySessionStore, TagKeyStorageOperation, TagKeyStorageResult},
+		Aggregation: DefaultMillisecondsDistribution,
+	}
+)
+
+// SessionStoreOperationTags contains tags to apply when recording a session
+// store operation
+type SessionStoreOperationTags struct {
+	Store     string
+	Operation string
+	Result    string
+}
+
+// RecordSessionStoreOperation records the duration of a session store
+// operation with the corresponding tags
+func RecordSessionStoreOperation(ctx context.Context, tags *SessionStoreOperationTags, duration time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeySessionStore, tags.Store),
+			tag.Upsert(TagKeyStorageOperation, tags.Operation),
+			tag.Upsert(TagKeyStorageResult, tags.Result),
+		},
+		sessionStoreOperationDuration.M(duration.Milliseconds()),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
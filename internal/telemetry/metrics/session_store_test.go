@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+func Test_RecordSessionStoreOperation(t *testing.T) {
+	tests := []struct {
+		name      string
+		tags      *SessionStoreOperationTags
+		duration  time.Duration
+		wantCount string
+		want      string
+	}{
+		{
+			"success",
+			&SessionStoreOperationTags{Store: "cookie", Operation: "load", Result: "success"},
+			time.Millisecond * 5,
+			"{ { {operation load}{result success}{store cookie} }",
+			"{ { {operation load}{result success}{store cookie} }&{1 5 5 5 0",
+		},
+		{
+			"error",
+			&SessionStoreOperationTags{Store: "header", Operation: "save", Result: "error"},
+			time.Millisecond * 5,
+			"{ { {operation save}{result error}{store header} }",
+			"{ { {operation save}{result error}{store header} }&{1 5 5 5 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view.Unregister(SessionStoreViews...)
+			view.Register(SessionStoreViews...)
+			RecordSessionStoreOperation(context.Background(), tt.tags, tt.duration)
+
+			testDataRetrieval(SessionStoreOperationCountView, t, tt.wantCount)
+			testDataRetrieval(SessionStoreOperationDurationView, t, tt.want)
+		})
+	}
+}
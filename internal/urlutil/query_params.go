@@ -4,21 +4,28 @@ package urlutil
 // services over HTTP calls and redirects. They are typically used in
 // conjunction with a HMAC to ensure authenticity.
 const (
-	QueryCallbackURI        = "pomerium_callback_uri"
-	QueryDeviceCredentialID = "pomerium_device_credential_id"
-	QueryDeviceType         = "pomerium_device_type"
-	QueryEnrollmentToken    = "pomerium_enrollment_token" //nolint
-	QueryExpiry             = "pomerium_expiry"
-	QueryIdentityProfile    = "pomerium_identity_profile"
-	QueryIdentityProviderID = "pomerium_idp_id"
-	QueryIsProgrammatic     = "pomerium_programmatic"
-	QueryIssued             = "pomerium_issued"
-	QueryPomeriumJWT        = "pomerium_jwt"
-	QueryRedirectURI        = "pomerium_redirect_uri"
-	QuerySession            = "pomerium_session"
-	QuerySessionEncrypted   = "pomerium_session_encrypted"
-	QuerySessionState       = "pomerium_session_state"
-	QueryVersion            = "pomerium_version"
+	QueryCallbackURI            = "pomerium_callback_uri"
+	QueryDeviceCredentialID     = "pomerium_device_credential_id"
+	QueryDeviceType             = "pomerium_device_type"
+	QueryDPoPJKT                = "pomerium_dpop_jkt"
+	QueryEnrollmentToken        = "pomerium_enrollment_token" //nolint
+	QueryExpiry                 = "pomerium_expiry"
+	QueryIdentityProfile        = "pomerium_identity_profile"
+	QueryIdentityProviderChoice = "pomerium_idp_choice"
+	QueryIdentityProviderID     = "pomerium_idp_id"
+	QueryIDPACRValues           = "pomerium_idp_acr_values"
+	QueryIDPLoginHint           = "pomerium_idp_login_hint"
+	QueryIDPMaxAge              = "pomerium_idp_max_age"
+	QueryIDPPrompt              = "pomerium_idp_prompt"
+	QueryIsProgrammatic         = "pomerium_programmatic"
+	QueryIssued                 = "pomerium_issued"
+	QueryPomeriumJWT            = "pomerium_jwt"
+	QueryRedirectURI            = "pomerium_redirect_uri"
+	QuerySession                = "pomerium_session"
+	QuerySessionEncrypted       = "pomerium_session_encrypted"
+	QuerySessionState           = "pomerium_session_state"
+	QuerySessionToken           = "pomerium_session_token"
+	QueryVersion                = "pomerium_version"
 )
 
 // URL signature based query params used for verifying the authenticity of a URL.
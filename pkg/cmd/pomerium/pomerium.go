@@ -21,6 +21,7 @@ import (
 	"github.com/pomerium/pomerium/internal/databroker"
 	"github.com/pomerium/pomerium/internal/events"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/policybundle"
 	"github.com/pomerium/pomerium/internal/registry"
 	"github.com/pomerium/pomerium/internal/version"
 	derivecert_config "github.com/pomerium/pomerium/pkg/derivecert/config"
@@ -47,6 +48,9 @@ func Run(ctx context.Context, src config.Source) error {
 	// trigger changes when underlying files are changed
 	src = config.NewFileWatcherSource(src)
 
+	// add the policy bundles pulled from OCI registries to routes
+	src = policybundle.NewSource(ctx, src)
+
 	src, err = autocert.New(src)
 	if err != nil {
 		return err
@@ -182,6 +186,9 @@ func setupAuthorize(ctx context.Context, src config.Source, controlPlane *contro
 		return nil, fmt.Errorf("error creating authorize service: %w", err)
 	}
 	envoy_service_auth_v3.RegisterAuthorizationServer(controlPlane.GRPCServer, svc)
+	if err := controlPlane.EnableAuthorize(svc); err != nil {
+		return nil, fmt.Errorf("error adding authorize service to control plane: %w", err)
+	}
 
 	log.Info(ctx).Msg("enabled authorize service")
 	src.OnConfigChange(ctx, svc.OnConfigChange)
@@ -0,0 +1,21 @@
+package contextutil
+
+import (
+	"context"
+	"net/url"
+)
+
+type accessRequestURLKey struct{}
+
+// GetAccessRequestURL gets the url of the page where a denied user requests
+// access from a context.
+func GetAccessRequestURL(ctx context.Context) *url.URL {
+	v, _ := ctx.Value(accessRequestURLKey{}).(*url.URL)
+	return v
+}
+
+// WithAccessRequestURL attaches the url of the page where a denied user
+// requests access to a context.
+func WithAccessRequestURL(ctx context.Context, u *url.URL) context.Context {
+	return context.WithValue(ctx, accessRequestURLKey{}, u)
+}
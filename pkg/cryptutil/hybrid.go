@@ -0,0 +1,191 @@
+package cryptutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/circl/sign/eddilithium2"
+	"github.com/go-jose/go-jose/v3"
+)
+
+// HybridSignatureAlgorithm is the experimental JWS algorithm for hybrid
+// Ed25519 and Dilithium2 signatures. Dilithium2 is the round 3 version of
+// ML-DSA-44. A hybrid signature is only valid if both signatures are valid, so
+// it remains secure as long as either scheme is unbroken.
+//
+// The algorithm isn't registered with IANA, so JWTs signed with it can only be
+// verified by verifiers which explicitly support it.
+const HybridSignatureAlgorithm jose.SignatureAlgorithm = "Ed25519-Dilithium2"
+
+// hybridPrivateKeyPEMType is the PEM block type of hybrid signing keys.
+const hybridPrivateKeyPEMType = "ED25519-DILITHIUM2 PRIVATE KEY"
+
+// GenerateHybridSigningKey generates a new hybrid Ed25519 and Dilithium2
+// signing key and returns it PEM encoded.
+func GenerateHybridSigningKey() ([]byte, error) {
+	_, key, err := eddilithium2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cryptutil: error generating hybrid signing key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  hybridPrivateKeyPEMType,
+		Bytes: key.Bytes(),
+	}), nil
+}
+
+// IsHybridSigningKey returns true if the first PEM block of data is a hybrid
+// signing key.
+func IsHybridSigningKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == hybridPrivateKeyPEMType
+}
+
+// A HybridSigner signs JWTs with a hybrid Ed25519 and Dilithium2 key. It
+// implements jose.OpaqueSigner.
+type HybridSigner struct {
+	key *eddilithium2.PrivateKey
+	jwk *HybridPublicJWK
+}
+
+// NewHybridSigner creates a new HybridSigner from the first PEM block of data.
+func NewHybridSigner(data []byte) (*HybridSigner, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != hybridPrivateKeyPEMType {
+		return nil, errors.New("cryptutil: invalid hybrid signing key")
+	}
+
+	key := new(eddilithium2.PrivateKey)
+	if err := key.UnmarshalBinary(block.Bytes); err != nil {
+		return nil, fmt.Errorf("cryptutil: invalid hybrid signing key: %w", err)
+	}
+	return &HybridSigner{
+		key: key,
+		jwk: newHybridPublicJWK(key.Public().(*eddilithium2.PublicKey)),
+	}, nil
+}
+
+// Public returns the public key. Since go-jose doesn't support hybrid keys the
+// returned key can't be marshaled to JSON, use PublicJWK instead.
+func (s *HybridSigner) Public() *jose.JSONWebKey {
+	return &jose.JSONWebKey{
+		Key:       s.key.Public(),
+		KeyID:     s.jwk.KeyID,
+		Algorithm: s.jwk.Algorithm,
+		Use:       s.jwk.Use,
+	}
+}
+
+// PublicJWK returns the public key as a JSON Web Key.
+func (s *HybridSigner) PublicJWK() *HybridPublicJWK {
+	jwk := *s.jwk
+	return &jwk
+}
+
+// Algs returns the supported algorithms.
+func (s *HybridSigner) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{HybridSignatureAlgorithm}
+}
+
+// SignPayload signs the payload.
+func (s *HybridSigner) SignPayload(payload []byte, alg jose.SignatureAlgorithm) ([]byte, error) {
+	if alg != HybridSignatureAlgorithm {
+		return nil, fmt.Errorf("cryptutil: unsupported signature algorithm: %s", alg)
+	}
+	sig := make([]byte, eddilithium2.SignatureSize)
+	eddilithium2.SignTo(s.key, payload, sig)
+	return sig, nil
+}
+
+// A HybridVerifier verifies JWTs signed by a HybridSigner. It implements
+// jose.OpaqueVerifier.
+type HybridVerifier struct {
+	key *eddilithium2.PublicKey
+}
+
+// NewHybridVerifier creates a new HybridVerifier from a hybrid public JWK.
+func NewHybridVerifier(jwk *HybridPublicJWK) (*HybridVerifier, error) {
+	if jwk.KeyType != "AKP" || jwk.Algorithm != string(HybridSignatureAlgorithm) {
+		return nil, fmt.Errorf("cryptutil: unsupported key type %s with algorithm %s", jwk.KeyType, jwk.Algorithm)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(jwk.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("cryptutil: invalid hybrid public key: %w", err)
+	}
+	key := new(eddilithium2.PublicKey)
+	if err := key.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("cryptutil: invalid hybrid public key: %w", err)
+	}
+	return &HybridVerifier{key: key}, nil
+}
+
+// VerifyPayload verifies the signature of the payload.
+func (v *HybridVerifier) VerifyPayload(payload []byte, signature []byte, alg jose.SignatureAlgorithm) error {
+	if alg != HybridSignatureAlgorithm {
+		return fmt.Errorf("cryptutil: unsupported signature algorithm: %s", alg)
+	}
+	if len(signature) != eddilithium2.SignatureSize || !eddilithium2.Verify(v.key, payload, signature) {
+		return errors.New("cryptutil: invalid hybrid signature")
+	}
+	return nil
+}
+
+// A HybridPublicJWK is a hybrid public key, represented as a JSON Web Key with
+// the "AKP" (algorithm key pair) key type from the JOSE drafts for post-quantum
+// signatures.
+type HybridPublicJWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	PublicKey string `json:"pub"`
+}
+
+func newHybridPublicJWK(key *eddilithium2.PublicKey) *HybridPublicJWK {
+	jwk := &HybridPublicJWK{
+		KeyType:   "AKP",
+		Algorithm: string(HybridSignatureAlgorithm),
+		Use:       "sig",
+		PublicKey: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+	}
+
+	// the key id is the thumbprint of the required members, in lexicographic
+	// order, as specified by rfc7638
+	thumbprintInput, _ := json.Marshal(struct {
+		Algorithm string `json:"alg"`
+		KeyType   string `json:"kty"`
+		PublicKey string `json:"pub"`
+	}{jwk.Algorithm, jwk.KeyType, jwk.PublicKey})
+	thumbprint := sha256.Sum256(thumbprintInput)
+	jwk.KeyID = hex.EncodeToString(thumbprint[:])
+	return jwk
+}
+
+// HybridPublicJWKsFromBytes returns the public JSON Web Keys of the hybrid
+// signing keys in PEM encoded data. Other PEM blocks are ignored.
+func HybridPublicJWKsFromBytes(data []byte) ([]*HybridPublicJWK, error) {
+	var jwks []*HybridPublicJWK
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != hybridPrivateKeyPEMType {
+			continue
+		}
+
+		key := new(eddilithium2.PrivateKey)
+		if err := key.UnmarshalBinary(block.Bytes); err != nil {
+			return nil, fmt.Errorf("cryptutil: invalid hybrid signing key: %w", err)
+		}
+		jwks = append(jwks, newHybridPublicJWK(key.Public().(*eddilithium2.PublicKey)))
+	}
+	return jwks, nil
+}
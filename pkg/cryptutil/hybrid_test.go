@@ -0,0 +1,67 @@
+package cryptutil
+
+import (
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHybridSigner(t *testing.T) {
+	t.Parallel()
+
+	rawKey, err := GenerateHybridSigningKey()
+	require.NoError(t, err)
+	assert.True(t, IsHybridSigningKey(rawKey))
+
+	signer, err := NewHybridSigner(rawKey)
+	require.NoError(t, err)
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: HybridSignatureAlgorithm, Key: signer},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+	rawJWT, err := jwt.Signed(sig).Claims(map[string]any{"sub": "user"}).CompactSerialize()
+	require.NoError(t, err)
+
+	jwks, err := HybridPublicJWKsFromBytes(rawKey)
+	require.NoError(t, err)
+	require.Len(t, jwks, 1)
+	assert.Equal(t, signer.PublicJWK(), jwks[0])
+	assert.Equal(t, signer.Public().KeyID, jwks[0].KeyID)
+
+	verifier, err := NewHybridVerifier(jwks[0])
+	require.NoError(t, err)
+	tok, err := jwt.ParseSigned(rawJWT)
+	require.NoError(t, err)
+	assert.Equal(t, signer.Public().KeyID, tok.Headers[0].KeyID)
+	var claims map[string]any
+	require.NoError(t, tok.Claims(verifier, &claims))
+	assert.Equal(t, "user", claims["sub"])
+
+	t.Run("wrong key", func(t *testing.T) {
+		otherKey, err := GenerateHybridSigningKey()
+		require.NoError(t, err)
+		otherJWKs, err := HybridPublicJWKsFromBytes(otherKey)
+		require.NoError(t, err)
+		otherVerifier, err := NewHybridVerifier(otherJWKs[0])
+		require.NoError(t, err)
+		assert.Error(t, tok.Claims(otherVerifier, &claims))
+	})
+	t.Run("mixed keys", func(t *testing.T) {
+		ecKey, err := NewSigningKey()
+		require.NoError(t, err)
+		rawECKey, err := EncodePrivateKey(ecKey)
+		require.NoError(t, err)
+		raw := append(append([]byte{}, rawKey...), rawECKey...)
+
+		ks, err := PublicJWKsFromBytes(raw)
+		require.NoError(t, err, "should ignore hybrid keys")
+		assert.Len(t, ks, 1)
+		hks, err := HybridPublicJWKsFromBytes(raw)
+		require.NoError(t, err, "should ignore other keys")
+		assert.Len(t, hks, 1)
+		assert.False(t, IsHybridSigningKey(rawECKey))
+	})
+}
@@ -54,6 +54,11 @@ func loadKeys(data []byte, unmarshal func([]byte) (any, error)) ([]*jose.JSONWeb
 			break
 		}
 
+		// hybrid keys aren't supported by go-jose, see HybridPublicJWKsFromBytes
+		if block.Type == hybridPrivateKeyPEMType {
+			continue
+		}
+
 		key, err := unmarshal(block.Bytes)
 		if err != nil {
 			return nil, fmt.Errorf("unmarshal key: %w", err)
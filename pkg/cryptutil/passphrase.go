@@ -0,0 +1,56 @@
+package cryptutil
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// MinPassphraseSaltSize is the minimum size of the salt used to derive a key
+// from a passphrase.
+const MinPassphraseSaltSize = 8
+
+// Argon2idParams are the tunable parameters of the Argon2id key derivation
+// function.
+type Argon2idParams struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the amount of memory used in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultArgon2idParams are the default Argon2id parameters, as recommended
+// by RFC 9106 for memory constrained environments.
+var DefaultArgon2idParams = Argon2idParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// NewKeyFromPassphrase derives a 32-byte (256 bit) key from a passphrase using
+// Argon2id. The same passphrase, salt and parameters always derive the same
+// key, so they must be shared by every instance that needs the key. If params
+// is nil, DefaultArgon2idParams are used.
+func NewKeyFromPassphrase(passphrase string, salt []byte, params *Argon2idParams) ([]byte, error) {
+	if params == nil {
+		params = &DefaultArgon2idParams
+	}
+
+	switch {
+	case passphrase == "":
+		return nil, errors.New("cryptutil: passphrase is required")
+	case len(salt) < MinPassphraseSaltSize:
+		return nil, fmt.Errorf("cryptutil: salt must be at least %d bytes", MinPassphraseSaltSize)
+	case params.Time < 1:
+		return nil, errors.New("cryptutil: argon2id time must be at least 1")
+	case params.Threads < 1:
+		return nil, errors.New("cryptutil: argon2id threads must be at least 1")
+	case params.Memory < 8*uint32(params.Threads):
+		return nil, fmt.Errorf("cryptutil: argon2id memory must be at least %d KiB", 8*uint32(params.Threads))
+	}
+
+	return argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, DefaultKeySize), nil
+}
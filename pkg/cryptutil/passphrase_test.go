@@ -0,0 +1,50 @@
+package cryptutil
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyFromPassphrase(t *testing.T) {
+	t.Parallel()
+
+	salt := []byte("pomerium salt")
+	params := &Argon2idParams{Time: 1, Memory: 64, Threads: 1}
+
+	k1, err := NewKeyFromPassphrase("correct horse battery staple", salt, params)
+	require.NoError(t, err)
+	assert.Len(t, k1, DefaultKeySize)
+	_, err = NewAEADCipher(k1)
+	assert.NoError(t, err, "should be usable as a cipher key")
+
+	k2, err := NewKeyFromPassphrase("correct horse battery staple", salt, params)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(k1), hex.EncodeToString(k2), "should be deterministic")
+
+	k3, err := NewKeyFromPassphrase("correct horse battery staple", []byte("another salt"), params)
+	require.NoError(t, err)
+	assert.NotEqual(t, k1, k3, "should depend on the salt")
+
+	k4, err := NewKeyFromPassphrase("correct horse battery staple", salt, &Argon2idParams{Time: 2, Memory: 64, Threads: 1})
+	require.NoError(t, err)
+	assert.NotEqual(t, k1, k4, "should depend on the parameters")
+
+	for _, tc := range []struct {
+		name       string
+		passphrase string
+		salt       []byte
+		params     *Argon2idParams
+	}{
+		{"empty passphrase", "", salt, params},
+		{"short salt", "passphrase", []byte("salt"), params},
+		{"zero time", "passphrase", salt, &Argon2idParams{Time: 0, Memory: 64, Threads: 1}},
+		{"zero threads", "passphrase", salt, &Argon2idParams{Time: 1, Memory: 64, Threads: 0}},
+		{"low memory", "passphrase", salt, &Argon2idParams{Time: 1, Memory: 8, Threads: 2}},
+	} {
+		_, err := NewKeyFromPassphrase(tc.passphrase, tc.salt, tc.params)
+		assert.Error(t, err, tc.name)
+	}
+}
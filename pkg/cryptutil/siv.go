@@ -0,0 +1,181 @@
+package cryptutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// NewDeterministicAEADCipher takes a 32, 48 or 64 byte secret key and returns a
+// new AES-SIV cipher, as specified by RFC 5297.
+//
+// Unlike NewAEADCipher, encrypting the same plaintext and additional data
+// always results in the same ciphertext, so encrypted values can be compared
+// for equality, for example to look up an encrypted email address in an
+// index. This reveals which values are equal, so it should only be used when
+// that's required. The cipher doesn't use a nonce, and can be used with
+// Encrypt and Decrypt.
+func NewDeterministicAEADCipher(secret []byte) (cipher.AEAD, error) {
+	switch len(secret) {
+	case 32, 48, 64:
+	default:
+		return nil, fmt.Errorf("cryptutil: got %d bytes but want 32, 48 or 64", len(secret))
+	}
+
+	// the first half of the key is used for S2V, the second half for CTR
+	macBlock, err := aes.NewCipher(secret[:len(secret)/2])
+	if err != nil {
+		return nil, err
+	}
+	ctrBlock, err := aes.NewCipher(secret[len(secret)/2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &siv{mac: newCMAC(macBlock), ctr: ctrBlock}, nil
+}
+
+type siv struct {
+	mac *cmac
+	ctr cipher.Block
+}
+
+func (*siv) NonceSize() int {
+	return 0
+}
+
+func (*siv) Overhead() int {
+	return aes.BlockSize
+}
+
+func (s *siv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != 0 {
+		panic("cryptutil: siv does not use a nonce")
+	}
+
+	v := s.s2v(additionalData, plaintext)
+	ret, out := sliceForAppend(dst, aes.BlockSize+len(plaintext))
+	copy(out, v)
+	cipher.NewCTR(s.ctr, sivCTRIV(v)).XORKeyStream(out[aes.BlockSize:], plaintext)
+	return ret
+}
+
+func (s *siv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != 0 {
+		panic("cryptutil: siv does not use a nonce")
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("cryptutil: ciphertext too short")
+	}
+
+	v, ciphertext := ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:]
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	cipher.NewCTR(s.ctr, sivCTRIV(v)).XORKeyStream(out, ciphertext)
+
+	if subtle.ConstantTimeCompare(v, s.s2v(additionalData, out)) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errors.New("cryptutil: message authentication failed")
+	}
+	return ret, nil
+}
+
+// s2v is the S2V function of RFC 5297 for the additional data and plaintext.
+func (s *siv) s2v(additionalData, plaintext []byte) []byte {
+	d := s.mac.sum(make([]byte, aes.BlockSize))
+	dbl(d)
+	xorBytes(d, s.mac.sum(additionalData))
+
+	var t []byte
+	if len(plaintext) >= aes.BlockSize {
+		t = append([]byte{}, plaintext...)
+		xorBytes(t[len(t)-aes.BlockSize:], d)
+	} else {
+		dbl(d)
+		t = make([]byte, aes.BlockSize)
+		copy(t, plaintext)
+		t[len(plaintext)] = 0x80
+		xorBytes(t, d)
+	}
+	return s.mac.sum(t)
+}
+
+// sivCTRIV clears the 31st and 63rd bits (counting from the right) of the
+// synthetic IV, so that it can be used as a CTR counter.
+func sivCTRIV(v []byte) []byte {
+	q := append([]byte{}, v...)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	return q
+}
+
+// cmac is the AES-CMAC message authentication code, as specified by RFC 4493.
+type cmac struct {
+	block  cipher.Block
+	k1, k2 []byte
+}
+
+func newCMAC(block cipher.Block) *cmac {
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	dbl(k1)
+	k2 := append([]byte{}, k1...)
+	dbl(k2)
+	return &cmac{block: block, k1: k1, k2: k2}
+}
+
+func (c *cmac) sum(msg []byte) []byte {
+	x := make([]byte, aes.BlockSize)
+
+	// all but the last block
+	for len(msg) > aes.BlockSize {
+		xorBytes(x, msg[:aes.BlockSize])
+		c.block.Encrypt(x, x)
+		msg = msg[aes.BlockSize:]
+	}
+
+	// the last block is complete, or padded
+	last := make([]byte, aes.BlockSize)
+	copy(last, msg)
+	if len(msg) == aes.BlockSize {
+		xorBytes(last, c.k1)
+	} else {
+		last[len(msg)] = 0x80
+		xorBytes(last, c.k2)
+	}
+	xorBytes(x, last)
+	c.block.Encrypt(x, x)
+	return x
+}
+
+// dbl multiplies a block by x in GF(2^128).
+func dbl(b []byte) {
+	carry := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] = b[len(b)-1]<<1 ^ (0x87 * carry)
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,73 @@
+package cryptutil
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministicAEADCipher(t *testing.T) {
+	t.Parallel()
+
+	mustDecodeHex := func(s string) []byte {
+		bs, err := hex.DecodeString(s)
+		require.NoError(t, err)
+		return bs
+	}
+
+	t.Run("rfc 5297", func(t *testing.T) {
+		c, err := NewDeterministicAEADCipher(mustDecodeHex("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff"))
+		require.NoError(t, err)
+		ad := mustDecodeHex("101112131415161718191a1b1c1d1e1f2021222324252627")
+		plaintext := mustDecodeHex("112233445566778899aabbccddee")
+
+		ciphertext := c.Seal(nil, nil, plaintext, ad)
+		assert.Equal(t, "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c", hex.EncodeToString(ciphertext))
+
+		decrypted, err := c.Open(nil, nil, ciphertext, ad)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+	t.Run("rfc 4493", func(t *testing.T) {
+		block, err := aes.NewCipher(mustDecodeHex("2b7e151628aed2a6abf7158809cf4f3c"))
+		require.NoError(t, err)
+		mac := newCMAC(block)
+		assert.Equal(t, "bb1d6929e95937287fa37d129b756746", hex.EncodeToString(mac.sum(nil)))
+		assert.Equal(t, "070a16b46b4d4144f79bdd9dd04a287c",
+			hex.EncodeToString(mac.sum(mustDecodeHex("6bc1bee22e409f96e93d7e117393172a"))))
+		assert.Equal(t, "dfa66747de9ae63030ca32611497c827",
+			hex.EncodeToString(mac.sum(mustDecodeHex("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411"))))
+	})
+
+	c, err := NewDeterministicAEADCipher(NewKey())
+	require.NoError(t, err)
+
+	t.Run("deterministic", func(t *testing.T) {
+		for _, plaintext := range []string{"", "u1", "user@example.com", "a much longer plaintext which spans multiple blocks"} {
+			c1 := Encrypt(c, []byte(plaintext), []byte("email"))
+			c2 := Encrypt(c, []byte(plaintext), []byte("email"))
+			assert.Equal(t, c1, c2, "should encrypt %q to the same ciphertext", plaintext)
+			assert.NotEqual(t, c1, Encrypt(c, []byte(plaintext), []byte("user_id")),
+				"should depend on the additional data")
+
+			decrypted, err := Decrypt(c, c1, []byte("email"))
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, string(decrypted))
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		ciphertext := Encrypt(c, []byte("user@example.com"), nil)
+		ciphertext[len(ciphertext)-1] ^= 1
+		_, err := Decrypt(c, ciphertext, nil)
+		assert.Error(t, err)
+		_, err = c.Open(nil, nil, ciphertext[:aes.BlockSize-1], nil)
+		assert.Error(t, err)
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := NewDeterministicAEADCipher(make([]byte, 16))
+		assert.Error(t, err)
+	})
+}
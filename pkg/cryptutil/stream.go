@@ -0,0 +1,214 @@
+package cryptutil
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// StreamChunkSize is the size of the plaintext chunks of an encrypted stream.
+const StreamChunkSize = 64 * 1024
+
+// the nonce of each chunk is the random nonce prefix, followed by a 4-byte
+// chunk counter and a 1-byte last chunk flag
+const streamNonceSuffixSize = 5
+
+var errStreamClosed = errors.New("cryptutil: stream is closed")
+
+// A StreamEncrypter encrypts a stream of data in chunks using the STREAM
+// construction, so that large payloads can be encrypted without loading them
+// into memory. The stream must be closed to write the final chunk.
+type StreamEncrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	ad     []byte
+	nonce  []byte
+	buf    []byte
+	closed bool
+}
+
+// NewStreamEncrypter creates a new StreamEncrypter which writes the encrypted
+// stream to w. The associated data is authenticated with every chunk.
+func NewStreamEncrypter(w io.Writer, aead cipher.AEAD, ad []byte) (*StreamEncrypter, error) {
+	if aead.NonceSize() < streamNonceSuffixSize+7 {
+		return nil, fmt.Errorf("cryptutil: nonce size %d is too small for a stream", aead.NonceSize())
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, randomBytes(aead.NonceSize()-streamNonceSuffixSize))
+	if _, err := w.Write(nonce[:len(nonce)-streamNonceSuffixSize]); err != nil {
+		return nil, err
+	}
+
+	return &StreamEncrypter{
+		w:     w,
+		aead:  aead,
+		ad:    ad,
+		nonce: nonce,
+		buf:   make([]byte, 0, StreamChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write encrypts p and writes it to the underlying writer.
+func (e *StreamEncrypter) Write(p []byte) (n int, err error) {
+	if e.closed {
+		return 0, errStreamClosed
+	}
+
+	for len(p) > 0 {
+		sz := StreamChunkSize - len(e.buf)
+		if sz > len(p) {
+			sz = len(p)
+		}
+		e.buf = append(e.buf, p[:sz]...)
+		p = p[sz:]
+		n += sz
+
+		// a full chunk is never the last chunk
+		if len(e.buf) == StreamChunkSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close encrypts and writes the final chunk. It does not close the underlying
+// writer.
+func (e *StreamEncrypter) Close() error {
+	if e.closed {
+		return errStreamClosed
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+func (e *StreamEncrypter) flush(last bool) error {
+	if err := setStreamNonce(e.nonce, last); err != nil {
+		return err
+	}
+	e.buf = e.aead.Seal(e.buf[:0], e.nonce, e.buf, e.ad)
+	if _, err := e.w.Write(e.buf); err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+	return incrementStreamNonce(e.nonce)
+}
+
+// A StreamDecrypter decrypts a stream of data encrypted by a StreamEncrypter.
+// Read returns an error if the stream has been modified or truncated.
+type StreamDecrypter struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	nonce   []byte
+	buf     []byte
+	plain   []byte
+	next    byte
+	hasNext bool
+	done    bool
+}
+
+// NewStreamDecrypter creates a new StreamDecrypter which reads the encrypted
+// stream from r.
+func NewStreamDecrypter(r io.Reader, aead cipher.AEAD, ad []byte) (*StreamDecrypter, error) {
+	if aead.NonceSize() < streamNonceSuffixSize+7 {
+		return nil, fmt.Errorf("cryptutil: nonce size %d is too small for a stream", aead.NonceSize())
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce[:len(nonce)-streamNonceSuffixSize]); err != nil {
+		return nil, fmt.Errorf("cryptutil: error reading stream header: %w", err)
+	}
+
+	return &StreamDecrypter{
+		r:     r,
+		aead:  aead,
+		ad:    ad,
+		nonce: nonce,
+		buf:   make([]byte, StreamChunkSize+aead.Overhead()+1),
+	}, nil
+}
+
+// Read reads decrypted data from the stream.
+func (d *StreamDecrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *StreamDecrypter) readChunk() error {
+	// read one byte past a full chunk to detect the last chunk, which is
+	// always shorter than a full chunk
+	chunkSize := StreamChunkSize + d.aead.Overhead()
+	off := 0
+	if d.hasNext {
+		d.buf[0] = d.next
+		off = 1
+	}
+	n, err := io.ReadFull(d.r, d.buf[off:])
+	n += off
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		// a full chunk is never the last chunk, so the stream was truncated
+		if n == 0 || n == chunkSize {
+			return fmt.Errorf("cryptutil: truncated stream: %w", io.ErrUnexpectedEOF)
+		}
+	default:
+		return err
+	}
+
+	last := n < chunkSize
+	chunk := d.buf[:n]
+	if !last {
+		chunk = d.buf[:chunkSize]
+		d.next, d.hasNext = d.buf[chunkSize], true
+	}
+
+	if err := setStreamNonce(d.nonce, last); err != nil {
+		return err
+	}
+	d.plain, err = d.aead.Open(chunk[:0], d.nonce, chunk, d.ad)
+	if err != nil {
+		return fmt.Errorf("cryptutil: decryption failed (mismatched keys?): %w", err)
+	}
+	d.done = last
+	return incrementStreamNonce(d.nonce)
+}
+
+func setStreamNonce(nonce []byte, last bool) error {
+	if nonce[len(nonce)-1] != 0 {
+		return errStreamClosed
+	}
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nil
+}
+
+func incrementStreamNonce(nonce []byte) error {
+	if nonce[len(nonce)-1] != 0 {
+		return nil
+	}
+	counter := nonce[len(nonce)-streamNonceSuffixSize : len(nonce)-1]
+	c := binary.BigEndian.Uint32(counter)
+	if c == math.MaxUint32 {
+		return errors.New("cryptutil: stream is too large")
+	}
+	binary.BigEndian.PutUint32(counter, c+1)
+	return nil
+}
@@ -0,0 +1,103 @@
+package cryptutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	xchacha, err := NewAEADCipher(NewKey())
+	require.NoError(t, err)
+	block, err := aes.NewCipher(NewKey())
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	encrypt := func(t *testing.T, aead cipher.AEAD, plaintext, ad []byte) []byte {
+		var buf bytes.Buffer
+		e, err := NewStreamEncrypter(&buf, aead, ad)
+		require.NoError(t, err)
+		// write in uneven pieces to exercise the chunk buffering
+		for p := plaintext; len(p) > 0; {
+			sz := 1000
+			if sz > len(p) {
+				sz = len(p)
+			}
+			_, err := e.Write(p[:sz])
+			require.NoError(t, err)
+			p = p[sz:]
+		}
+		require.NoError(t, e.Close())
+		return buf.Bytes()
+	}
+	decrypt := func(aead cipher.AEAD, ciphertext, ad []byte) ([]byte, error) {
+		d, err := NewStreamDecrypter(bytes.NewReader(ciphertext), aead, ad)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(d)
+	}
+
+	for _, aead := range []cipher.AEAD{xchacha, gcm} {
+		for _, size := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 17} {
+			plaintext := randomBytes(size)
+			ciphertext := encrypt(t, aead, plaintext, []byte("ad"))
+			decrypted, err := decrypt(aead, ciphertext, []byte("ad"))
+			require.NoError(t, err, "size=%d", size)
+			assert.Equal(t, plaintext, decrypted, "size=%d", size)
+		}
+	}
+
+	plaintext := randomBytes(2*StreamChunkSize + 100)
+	ciphertext := encrypt(t, xchacha, plaintext, nil)
+	chunkSize := StreamChunkSize + xchacha.Overhead()
+	headerSize := xchacha.NonceSize() - streamNonceSuffixSize
+
+	t.Run("wrong associated data", func(t *testing.T) {
+		_, err := decrypt(xchacha, ciphertext, []byte("ad"))
+		assert.Error(t, err)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := NewAEADCipher(NewKey())
+		require.NoError(t, err)
+		_, err = decrypt(other, ciphertext, nil)
+		assert.Error(t, err)
+	})
+	t.Run("modified", func(t *testing.T) {
+		modified := append([]byte{}, ciphertext...)
+		modified[headerSize+chunkSize+10] ^= 1
+		_, err := decrypt(xchacha, modified, nil)
+		assert.Error(t, err)
+	})
+	t.Run("truncated at chunk boundary", func(t *testing.T) {
+		_, err := decrypt(xchacha, ciphertext[:headerSize+2*chunkSize], nil)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+	t.Run("truncated in chunk", func(t *testing.T) {
+		_, err := decrypt(xchacha, ciphertext[:headerSize+chunkSize+100], nil)
+		assert.Error(t, err)
+	})
+	t.Run("reordered", func(t *testing.T) {
+		reordered := append([]byte{}, ciphertext[:headerSize]...)
+		reordered = append(reordered, ciphertext[headerSize+chunkSize:headerSize+2*chunkSize]...)
+		reordered = append(reordered, ciphertext[headerSize:headerSize+chunkSize]...)
+		reordered = append(reordered, ciphertext[headerSize+2*chunkSize:]...)
+		_, err := decrypt(xchacha, reordered, nil)
+		assert.Error(t, err)
+	})
+	t.Run("write after close", func(t *testing.T) {
+		e, err := NewStreamEncrypter(io.Discard, xchacha, nil)
+		require.NoError(t, err)
+		require.NoError(t, e.Close())
+		_, err = e.Write([]byte("data"))
+		assert.Error(t, err)
+	})
+}
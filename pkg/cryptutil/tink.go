@@ -0,0 +1,307 @@
+package cryptutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Tink key type URLs of the supported keys.
+const (
+	TinkXChaCha20Poly1305KeyTypeURL = "type.googleapis.com/google.crypto.tink.XChaCha20Poly1305Key"
+	TinkECDSAPrivateKeyTypeURL      = "type.googleapis.com/google.crypto.tink.EcdsaPrivateKey"
+)
+
+// field numbers and enum values from the tink protos
+const (
+	tinkXChaCha20Poly1305KeyValueField = 3
+	tinkHashTypeSHA256                 = 3
+	tinkCurveNISTP256                  = 1
+	tinkSignatureIEEEP1363             = 1
+)
+
+const (
+	tinkKeyStatusEnabled      = "ENABLED"
+	tinkOutputPrefixRaw       = "RAW"
+	tinkKeyMaterialSymmetric  = "SYMMETRIC"
+	tinkKeyMaterialAsymmetric = "ASYMMETRIC_PRIVATE"
+	// the size of P-256 private keys and coordinates
+	tinkECDSAP256Size = 32
+)
+
+// tinkKeyset is a cleartext keyset in Tink's JSON format.
+type tinkKeyset struct {
+	PrimaryKeyID uint32    `json:"primaryKeyId"`
+	Keys         []tinkKey `json:"key"`
+}
+
+type tinkKey struct {
+	KeyData struct {
+		TypeURL         string `json:"typeUrl"`
+		Value           []byte `json:"value"`
+		KeyMaterialType string `json:"keyMaterialType"`
+	} `json:"keyData"`
+	Status           string `json:"status"`
+	KeyID            uint32 `json:"keyId"`
+	OutputPrefixType string `json:"outputPrefixType"`
+}
+
+// IsTinkKeyset returns true if data is a cleartext keyset in Tink's JSON
+// format.
+func IsTinkKeyset(data []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return false
+	}
+	var ks tinkKeyset
+	return json.Unmarshal(data, &ks) == nil && len(ks.Keys) > 0
+}
+
+// AEADKeysFromTinkKeyset returns the XChaCha20Poly1305 keys of the enabled
+// keys in a cleartext Tink JSON keyset, with the primary key first.
+func AEADKeysFromTinkKeyset(data []byte) ([][]byte, error) {
+	keys, err := getEnabledTinkKeys(data, TinkXChaCha20Poly1305KeyTypeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var aeadKeys [][]byte
+	for _, k := range keys {
+		key, err := unmarshalTinkXChaCha20Poly1305Key(k.KeyData.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cryptutil: invalid tink key %d: %w", k.KeyID, err)
+		}
+		aeadKeys = append(aeadKeys, key)
+	}
+	return aeadKeys, nil
+}
+
+// SigningKeysFromTinkKeyset returns the PEM encoded ECDSA P-256 signing keys of
+// the enabled keys in a cleartext Tink JSON keyset, with the primary key first.
+func SigningKeysFromTinkKeyset(data []byte) ([]byte, error) {
+	keys, err := getEnabledTinkKeys(data, TinkECDSAPrivateKeyTypeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded []byte
+	for _, k := range keys {
+		key, err := unmarshalTinkECDSAPrivateKey(k.KeyData.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cryptutil: invalid tink key %d: %w", k.KeyID, err)
+		}
+		pem, err := EncodePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, pem...)
+	}
+	return encoded, nil
+}
+
+// AEADKeysToTinkKeyset exports XChaCha20Poly1305 keys as a cleartext Tink JSON
+// keyset. The first key is the primary key.
+func AEADKeysToTinkKeyset(keys ...[]byte) ([]byte, error) {
+	var ks tinkKeyset
+	for _, key := range keys {
+		if len(key) != DefaultKeySize {
+			return nil, fmt.Errorf("cryptutil: got %d bytes but want %d", len(key), DefaultKeySize)
+		}
+		var b []byte
+		b = protowire.AppendTag(b, tinkXChaCha20Poly1305KeyValueField, protowire.BytesType)
+		b = protowire.AppendBytes(b, key)
+		ks.add(TinkXChaCha20Poly1305KeyTypeURL, tinkKeyMaterialSymmetric, key, b)
+	}
+	return ks.marshal()
+}
+
+// SigningKeysToTinkKeyset exports PEM encoded ECDSA P-256 signing keys as a
+// cleartext Tink JSON keyset. The first key is the primary key.
+func SigningKeysToTinkKeyset(data []byte) ([]byte, error) {
+	jwks, err := PrivateJWKsFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var ks tinkKeyset
+	for _, jwk := range jwks {
+		key, ok := jwk.Key.(*ecdsa.PrivateKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("cryptutil: unsupported key type for tink: %T", jwk.Key)
+		}
+		d := key.D.FillBytes(make([]byte, tinkECDSAP256Size))
+		ks.add(TinkECDSAPrivateKeyTypeURL, tinkKeyMaterialAsymmetric, d, marshalTinkECDSAPrivateKey(key))
+	}
+	return ks.marshal()
+}
+
+func (ks *tinkKeyset) add(typeURL, keyMaterialType string, rawKey, value []byte) {
+	var k tinkKey
+	k.KeyData.TypeURL = typeURL
+	k.KeyData.Value = value
+	k.KeyData.KeyMaterialType = keyMaterialType
+	k.Status = tinkKeyStatusEnabled
+	// key ids are derived from the keys, so exporting the same keys results
+	// in the same keyset
+	k.KeyID = binary.BigEndian.Uint32(Hash("tink key id", rawKey))
+	// pomerium doesn't add tink's key id prefix to ciphertexts or signatures
+	k.OutputPrefixType = tinkOutputPrefixRaw
+	if len(ks.Keys) == 0 {
+		ks.PrimaryKeyID = k.KeyID
+	}
+	ks.Keys = append(ks.Keys, k)
+}
+
+func (ks *tinkKeyset) marshal() ([]byte, error) {
+	if len(ks.Keys) == 0 {
+		return nil, errors.New("cryptutil: at least one key is required")
+	}
+	return json.MarshalIndent(ks, "", "  ")
+}
+
+func getEnabledTinkKeys(data []byte, typeURL string) ([]tinkKey, error) {
+	var ks tinkKeyset
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("cryptutil: invalid tink keyset: %w", err)
+	}
+
+	var primary *tinkKey
+	var keys []tinkKey
+	for i, k := range ks.Keys {
+		if k.Status != tinkKeyStatusEnabled {
+			continue
+		}
+		if k.KeyData.TypeURL != typeURL {
+			return nil, fmt.Errorf("cryptutil: unsupported tink key type %s, expected %s", k.KeyData.TypeURL, typeURL)
+		}
+		if k.KeyID == ks.PrimaryKeyID {
+			primary = &ks.Keys[i]
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if primary == nil {
+		return nil, errors.New("cryptutil: tink keyset has no enabled primary key")
+	}
+	return append([]tinkKey{*primary}, keys...), nil
+}
+
+func unmarshalTinkXChaCha20Poly1305Key(b []byte) ([]byte, error) {
+	key, err := getProtoBytesField(b, tinkXChaCha20Poly1305KeyValueField)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != DefaultKeySize {
+		return nil, fmt.Errorf("got %d bytes but want %d", len(key), DefaultKeySize)
+	}
+	return key, nil
+}
+
+// marshalTinkECDSAPrivateKey marshals an EcdsaPrivateKey proto:
+//
+//	EcdsaPrivateKey { public_key = 2; key_value = 3 }
+//	EcdsaPublicKey  { params = 2; x = 3; y = 4 }
+//	EcdsaParams     { hash_type = 1; curve = 2; encoding = 3 }
+func marshalTinkECDSAPrivateKey(key *ecdsa.PrivateKey) []byte {
+	var params []byte
+	params = protowire.AppendTag(params, 1, protowire.VarintType)
+	params = protowire.AppendVarint(params, tinkHashTypeSHA256)
+	params = protowire.AppendTag(params, 2, protowire.VarintType)
+	params = protowire.AppendVarint(params, tinkCurveNISTP256)
+	params = protowire.AppendTag(params, 3, protowire.VarintType)
+	params = protowire.AppendVarint(params, tinkSignatureIEEEP1363)
+
+	var public []byte
+	public = protowire.AppendTag(public, 2, protowire.BytesType)
+	public = protowire.AppendBytes(public, params)
+	public = protowire.AppendTag(public, 3, protowire.BytesType)
+	public = protowire.AppendBytes(public, key.X.FillBytes(make([]byte, tinkECDSAP256Size)))
+	public = protowire.AppendTag(public, 4, protowire.BytesType)
+	public = protowire.AppendBytes(public, key.Y.FillBytes(make([]byte, tinkECDSAP256Size)))
+
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, public)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, key.D.FillBytes(make([]byte, tinkECDSAP256Size)))
+	return b
+}
+
+func unmarshalTinkECDSAPrivateKey(b []byte) (*ecdsa.PrivateKey, error) {
+	public, err := getProtoBytesField(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	d, err := getProtoBytesField(b, 3)
+	if err != nil {
+		return nil, err
+	}
+	params, err := getProtoBytesField(public, 2)
+	if err != nil {
+		return nil, err
+	}
+	curve, err := getProtoVarintField(params, 2)
+	if err != nil {
+		return nil, err
+	}
+	if curve != tinkCurveNISTP256 {
+		return nil, fmt.Errorf("unsupported curve: %d", curve)
+	}
+
+	// tink encodes the private key as a big-endian two's complement integer,
+	// which may have a leading zero byte
+	key := new(ecdsa.PrivateKey)
+	key.Curve = elliptic.P256()
+	key.D = new(big.Int).SetBytes(d)
+	if key.D.Sign() <= 0 || key.D.Cmp(key.Curve.Params().N) >= 0 {
+		return nil, errors.New("invalid private key")
+	}
+	key.X, key.Y = key.Curve.ScalarBaseMult(key.D.FillBytes(make([]byte, tinkECDSAP256Size)))
+	return key, nil
+}
+
+// getProtoField returns the encoded value of the last field of a protobuf
+// message with the given number and type, or nil if there is no such field.
+func getProtoField(b []byte, field protowire.Number, fieldType protowire.Type) ([]byte, error) {
+	var value []byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if num == field && typ == fieldType {
+			value = b[:n]
+		}
+		b = b[n:]
+	}
+	return value, nil
+}
+
+func getProtoBytesField(b []byte, field protowire.Number) ([]byte, error) {
+	value, err := getProtoField(b, field, protowire.BytesType)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	v, _ := protowire.ConsumeBytes(value)
+	return v, nil
+}
+
+func getProtoVarintField(b []byte, field protowire.Number) (uint64, error) {
+	value, err := getProtoField(b, field, protowire.VarintType)
+	if err != nil || value == nil {
+		return 0, err
+	}
+	v, _ := protowire.ConsumeVarint(value)
+	return v, nil
+}
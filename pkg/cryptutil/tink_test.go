@@ -0,0 +1,101 @@
+package cryptutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestTinkAEADKeyset(t *testing.T) {
+	t.Parallel()
+
+	k1, k2 := NewKey(), NewKey()
+	keyset, err := AEADKeysToTinkKeyset(k1, k2)
+	require.NoError(t, err)
+	assert.True(t, IsTinkKeyset(keyset))
+
+	again, err := AEADKeysToTinkKeyset(k1, k2)
+	require.NoError(t, err)
+	assert.Equal(t, keyset, again, "should export the same keyset for the same keys")
+
+	keys, err := AEADKeysFromTinkKeyset(keyset)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{k1, k2}, keys)
+
+	_, err = AEADKeysToTinkKeyset([]byte("short"))
+	assert.Error(t, err)
+	_, err = SigningKeysFromTinkKeyset(keyset)
+	assert.Error(t, err, "should reject keys of a different type")
+}
+
+func TestTinkSigningKeyset(t *testing.T) {
+	t.Parallel()
+
+	key1, err := NewSigningKey()
+	require.NoError(t, err)
+	key2, err := NewSigningKey()
+	require.NoError(t, err)
+	pem1, err := EncodePrivateKey(key1)
+	require.NoError(t, err)
+	pem2, err := EncodePrivateKey(key2)
+	require.NoError(t, err)
+
+	keyset, err := SigningKeysToTinkKeyset(append(append([]byte{}, pem1...), pem2...))
+	require.NoError(t, err)
+	assert.True(t, IsTinkKeyset(keyset))
+
+	encoded, err := SigningKeysFromTinkKeyset(keyset)
+	require.NoError(t, err)
+	assert.Equal(t, string(pem1)+string(pem2), string(encoded))
+}
+
+func TestTinkKeysetImport(t *testing.T) {
+	t.Parallel()
+
+	key, err := NewSigningKey()
+	require.NoError(t, err)
+	expected, err := EncodePrivateKey(key)
+	require.NoError(t, err)
+
+	// tink encodes the private key with a leading zero byte
+	value := marshalTinkECDSAPrivateKey(key)
+	value = protowire.AppendTag(value, 3, protowire.BytesType)
+	value = protowire.AppendBytes(value, append([]byte{0}, key.D.FillBytes(make([]byte, 32))...))
+	value = protowire.AppendTag(value, 1, protowire.VarintType)
+	value = protowire.AppendVarint(value, 0)
+
+	keyset, err := json.Marshal(map[string]any{
+		"primaryKeyId": 2,
+		"key": []any{
+			map[string]any{
+				"keyData":          map[string]any{"typeUrl": "type.googleapis.com/google.crypto.tink.HmacKey"},
+				"status":           "DISABLED",
+				"keyId":            1,
+				"outputPrefixType": "TINK",
+			},
+			map[string]any{
+				"keyData": map[string]any{
+					"typeUrl":         TinkECDSAPrivateKeyTypeURL,
+					"value":           value,
+					"keyMaterialType": "ASYMMETRIC_PRIVATE",
+				},
+				"status":           "ENABLED",
+				"keyId":            2,
+				"outputPrefixType": "TINK",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	encoded, err := SigningKeysFromTinkKeyset(keyset)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(encoded), "should ignore disabled keys")
+
+	assert.False(t, IsTinkKeyset([]byte(NewBase64Key())))
+	assert.False(t, IsTinkKeyset([]byte("{}")))
+	_, err = SigningKeysFromTinkKeyset([]byte(`{"primaryKeyId":3,"key":[]}`))
+	assert.Error(t, err, "should require a primary key")
+}
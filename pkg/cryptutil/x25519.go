@@ -0,0 +1,82 @@
+package cryptutil
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const boxNonceSize = 24
+
+// SharedSecret performs an X25519 key agreement between the private key and
+// the peer's public key. Both sides of the exchange compute the same secret.
+//
+// The raw secret shouldn't be used as a key directly, see NewPairwiseAEADCipher.
+func (kek *PrivateKeyEncryptionKey) SharedSecret(peer *PublicKeyEncryptionKey) ([]byte, error) {
+	secret, err := curve25519.X25519(kek.data[:], peer.data[:])
+	if err != nil { // the peer's public key is a low order point
+		return nil, fmt.Errorf("cryptutil: invalid x25519 public key: %w", err)
+	}
+	return secret, nil
+}
+
+// NewPairwiseAEADCipher returns a new XChacha20poly1305 cipher whose key is
+// derived from the X25519 shared secret of the private key and the peer's
+// public key, so that two services can exchange encrypted payloads without a
+// shared global secret. The info binds the key to its intended use and must
+// be the same on both sides.
+//
+// The cipher can be used with Encrypt and Decrypt.
+func NewPairwiseAEADCipher(kek *PrivateKeyEncryptionKey, peer *PublicKeyEncryptionKey, info []byte) (cipher.AEAD, error) {
+	secret, err := kek.SharedSecret(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	// both public keys are included, in a canonical order, so that both sides
+	// derive the same key
+	a, b := kek.Public().data[:], peer.data[:]
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	salt := append(append([]byte{}, a...), b...)
+
+	key := make([]byte, DefaultKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		return nil, fmt.Errorf("cryptutil: error deriving pairwise key: %w", err)
+	}
+	return NewAEADCipher(key)
+}
+
+// SealTo encrypts and authenticates data for the recipient using a NACL box.
+// Unlike PublicKeyEncryptionKey.Encrypt the recipient can verify who sent the
+// data with OpenFrom.
+func (kek *PrivateKeyEncryptionKey) SealTo(recipient *PublicKeyEncryptionKey, plaintext []byte) ([]byte, error) {
+	var nonce [boxNonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, fmt.Errorf("cryptutil: box encrypt failed: %w", err)
+	}
+	return box.Seal(nonce[:], plaintext, &nonce, &recipient.data, &kek.data), nil
+}
+
+// OpenFrom decrypts data sealed by the sender with SealTo.
+func (kek *PrivateKeyEncryptionKey) OpenFrom(sender *PublicKeyEncryptionKey, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < boxNonceSize+box.Overhead {
+		return nil, fmt.Errorf("cryptutil: invalid input size: %d", len(ciphertext))
+	}
+
+	var nonce [boxNonceSize]byte
+	copy(nonce[:], ciphertext)
+	opened, ok := box.Open(nil, ciphertext[boxNonceSize:], &nonce, &sender.data, &kek.data)
+	if !ok {
+		return nil, fmt.Errorf("cryptutil: box decrypt failed")
+	}
+	return opened, nil
+}
@@ -0,0 +1,66 @@
+package cryptutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestX25519(t *testing.T) {
+	t.Parallel()
+
+	alice, err := GenerateKeyEncryptionKey()
+	require.NoError(t, err)
+	bob, err := GenerateKeyEncryptionKey()
+	require.NoError(t, err)
+	eve, err := GenerateKeyEncryptionKey()
+	require.NoError(t, err)
+
+	t.Run("shared secret", func(t *testing.T) {
+		s1, err := alice.SharedSecret(bob.Public())
+		require.NoError(t, err)
+		s2, err := bob.SharedSecret(alice.Public())
+		require.NoError(t, err)
+		assert.Equal(t, s1, s2)
+
+		lowOrder, err := NewPublicKeyEncryptionKey(make([]byte, KeyEncryptionKeySize))
+		require.NoError(t, err)
+		_, err = alice.SharedSecret(lowOrder)
+		assert.Error(t, err)
+	})
+	t.Run("pairwise cipher", func(t *testing.T) {
+		a1, err := NewPairwiseAEADCipher(alice, bob.Public(), []byte("proxy-authorize"))
+		require.NoError(t, err)
+		a2, err := NewPairwiseAEADCipher(bob, alice.Public(), []byte("proxy-authorize"))
+		require.NoError(t, err)
+
+		plaintext, err := Decrypt(a2, Encrypt(a1, []byte("HELLO WORLD"), nil), nil)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("HELLO WORLD"), plaintext)
+
+		a3, err := NewPairwiseAEADCipher(bob, alice.Public(), []byte("other"))
+		require.NoError(t, err)
+		_, err = Decrypt(a3, Encrypt(a1, []byte("HELLO WORLD"), nil), nil)
+		assert.Error(t, err, "should bind the key to the info")
+
+		a4, err := NewPairwiseAEADCipher(eve, alice.Public(), []byte("proxy-authorize"))
+		require.NoError(t, err)
+		_, err = Decrypt(a4, Encrypt(a1, []byte("HELLO WORLD"), nil), nil)
+		assert.Error(t, err)
+	})
+	t.Run("box", func(t *testing.T) {
+		sealed, err := alice.SealTo(bob.Public(), []byte("HELLO WORLD"))
+		require.NoError(t, err)
+		plaintext, err := bob.OpenFrom(alice.Public(), sealed)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("HELLO WORLD"), plaintext)
+
+		_, err = bob.OpenFrom(eve.Public(), sealed)
+		assert.Error(t, err, "should authenticate the sender")
+		_, err = eve.OpenFrom(alice.Public(), sealed)
+		assert.Error(t, err)
+		_, err = bob.OpenFrom(alice.Public(), sealed[:10])
+		assert.Error(t, err)
+	})
+}
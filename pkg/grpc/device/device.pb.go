@@ -675,6 +675,88 @@ func (x *OwnerCredentialRecord) GetPublicKey() []byte {
 	return nil
 }
 
+// A Posture is the compliance state of a user's devices reported by a device
+// management or endpoint security provider. The id is the name of the
+// provider and the user's email address, joined by a slash.
+type Posture struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Provider  string                 `protobuf:"bytes,2,opt,name=provider,proto3" json:"provider,omitempty"`
+	Email     string                 `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	Devices   []*Posture_Device      `protobuf:"bytes,4,rep,name=devices,proto3" json:"devices,omitempty"`
+	UpdatedAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+}
+
+func (x *Posture) Reset() {
+	*x = Posture{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_device_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Posture) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Posture) ProtoMessage() {}
+
+func (x *Posture) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Posture.ProtoReflect.Descriptor instead.
+func (*Posture) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Posture) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Posture) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *Posture) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *Posture) GetDevices() []*Posture_Device {
+	if x != nil {
+		return x.Devices
+	}
+	return nil
+}
+
+func (x *Posture) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
 type WebAuthnOptions_AuthenticatorSelectionCriteria struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -689,7 +771,7 @@ type WebAuthnOptions_AuthenticatorSelectionCriteria struct {
 func (x *WebAuthnOptions_AuthenticatorSelectionCriteria) Reset() {
 	*x = WebAuthnOptions_AuthenticatorSelectionCriteria{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_device_proto_msgTypes[5]
+		mi := &file_device_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -702,7 +784,7 @@ func (x *WebAuthnOptions_AuthenticatorSelectionCriteria) String() string {
 func (*WebAuthnOptions_AuthenticatorSelectionCriteria) ProtoMessage() {}
 
 func (x *WebAuthnOptions_AuthenticatorSelectionCriteria) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[5]
+	mi := &file_device_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -758,7 +840,7 @@ type WebAuthnOptions_PublicKeyCredentialParameters struct {
 func (x *WebAuthnOptions_PublicKeyCredentialParameters) Reset() {
 	*x = WebAuthnOptions_PublicKeyCredentialParameters{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_device_proto_msgTypes[6]
+		mi := &file_device_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -771,7 +853,7 @@ func (x *WebAuthnOptions_PublicKeyCredentialParameters) String() string {
 func (*WebAuthnOptions_PublicKeyCredentialParameters) ProtoMessage() {}
 
 func (x *WebAuthnOptions_PublicKeyCredentialParameters) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[6]
+	mi := &file_device_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -812,7 +894,7 @@ type Type_WebAuthn struct {
 func (x *Type_WebAuthn) Reset() {
 	*x = Type_WebAuthn{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_device_proto_msgTypes[7]
+		mi := &file_device_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -825,7 +907,7 @@ func (x *Type_WebAuthn) String() string {
 func (*Type_WebAuthn) ProtoMessage() {}
 
 func (x *Type_WebAuthn) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[7]
+	mi := &file_device_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -866,7 +948,7 @@ type Credential_WebAuthn struct {
 func (x *Credential_WebAuthn) Reset() {
 	*x = Credential_WebAuthn{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_device_proto_msgTypes[8]
+		mi := &file_device_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -879,7 +961,7 @@ func (x *Credential_WebAuthn) String() string {
 func (*Credential_WebAuthn) ProtoMessage() {}
 
 func (x *Credential_WebAuthn) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[8]
+	mi := &file_device_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -930,6 +1012,113 @@ func (x *Credential_WebAuthn) GetAuthenticateResponse() [][]byte {
 	return nil
 }
 
+type Posture_Device struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id        string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name      string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Os        string `protobuf:"bytes,3,opt,name=os,proto3" json:"os,omitempty"`
+	OsVersion string `protobuf:"bytes,4,opt,name=os_version,json=osVersion,proto3" json:"os_version,omitempty"`
+	// managed is true if the device is enrolled in device management.
+	Managed bool `protobuf:"varint,5,opt,name=managed,proto3" json:"managed,omitempty"`
+	// compliant is true if the device meets the provider's compliance
+	// policies.
+	Compliant bool `protobuf:"varint,6,opt,name=compliant,proto3" json:"compliant,omitempty"`
+	// score is the provider's health score of the device, from 0 to 100.
+	Score      *int32                 `protobuf:"varint,7,opt,name=score,proto3,oneof" json:"score,omitempty"`
+	LastSeenAt *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=last_seen_at,json=lastSeenAt,proto3" json:"last_seen_at,omitempty"`
+}
+
+func (x *Posture_Device) Reset() {
+	*x = Posture_Device{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_device_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Posture_Device) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Posture_Device) ProtoMessage() {}
+
+func (x *Posture_Device) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Posture_Device.ProtoReflect.Descriptor instead.
+func (*Posture_Device) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{5, 0}
+}
+
+func (x *Posture_Device) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Posture_Device) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Posture_Device) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *Posture_Device) GetOsVersion() string {
+	if x != nil {
+		return x.OsVersion
+	}
+	return ""
+}
+
+func (x *Posture_Device) GetManaged() bool {
+	if x != nil {
+		return x.Managed
+	}
+	return false
+}
+
+func (x *Posture_Device) GetCompliant() bool {
+	if x != nil {
+		return x.Compliant
+	}
+	return false
+}
+
+func (x *Posture_Device) GetScore() int32 {
+	if x != nil && x.Score != nil {
+		return *x.Score
+	}
+	return 0
+}
+
+func (x *Posture_Device) GetLastSeenAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeenAt
+	}
+	return nil
+}
+
 var File_device_proto protoreflect.FileDescriptor
 
 var file_device_proto_rawDesc = []byte{
@@ -1092,10 +1281,38 @@ var file_device_proto_rawDesc = []byte{
 	0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x6f, 0x77,
 	0x6e, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f,
 	0x6b, 0x65, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x70, 0x75, 0x62, 0x6c, 0x69,
-	0x63, 0x4b, 0x65, 0x79, 0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
-	0x6f, 0x6d, 0x2f, 0x70, 0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75, 0x6d, 0x2f, 0x70, 0x6f, 0x6d, 0x65,
-	0x72, 0x69, 0x75, 0x6d, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x64, 0x65,
-	0x76, 0x69, 0x63, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x63, 0x4b, 0x65, 0x79, 0x22, 0xba, 0x03, 0x0a, 0x07, 0x50, 0x6f, 0x73, 0x74, 0x75, 0x72, 0x65,
+	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64,
+	0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05,
+	0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x6d, 0x61,
+	0x69, 0x6c, 0x12, 0x39, 0x0a, 0x07, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x73, 0x18, 0x04, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x70, 0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75, 0x6d, 0x2e, 0x64,
+	0x65, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x50, 0x6f, 0x73, 0x74, 0x75, 0x72, 0x65, 0x2e, 0x44, 0x65,
+	0x76, 0x69, 0x63, 0x65, 0x52, 0x07, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x73, 0x12, 0x39, 0x0a,
+	0x0a, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x75,
+	0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x1a, 0xf6, 0x01, 0x0a, 0x06, 0x44, 0x65, 0x76,
+	0x69, 0x63, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x6f, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x02, 0x6f, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x6f, 0x73, 0x5f, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6f, 0x73, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65,
+	0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x64,
+	0x12, 0x1c, 0x0a, 0x09, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x69, 0x61, 0x6e, 0x74, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x09, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x69, 0x61, 0x6e, 0x74, 0x12, 0x19,
+	0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52,
+	0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x88, 0x01, 0x01, 0x12, 0x3c, 0x0a, 0x0c, 0x6c, 0x61, 0x73,
+	0x74, 0x5f, 0x73, 0x65, 0x65, 0x6e, 0x5f, 0x61, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0a, 0x6c, 0x61, 0x73,
+	0x74, 0x53, 0x65, 0x65, 0x6e, 0x41, 0x74, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x73, 0x63, 0x6f, 0x72,
+	0x65, 0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f,
+	0x70, 0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75, 0x6d, 0x2f, 0x70, 0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75,
+	0x6d, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x64, 0x65, 0x76, 0x69, 0x63,
+	0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1111,7 +1328,7 @@ func file_device_proto_rawDescGZIP() []byte {
 }
 
 var file_device_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
-var file_device_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_device_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_device_proto_goTypes = []interface{}{
 	(WebAuthnOptions_AttestationConveyancePreference)(0),   // 0: pomerium.device.WebAuthnOptions.AttestationConveyancePreference
 	(WebAuthnOptions_AuthenticatorAttachment)(0),           // 1: pomerium.device.WebAuthnOptions.AuthenticatorAttachment
@@ -1123,29 +1340,34 @@ var file_device_proto_goTypes = []interface{}{
 	(*Enrollment)(nil),                                     // 7: pomerium.device.Enrollment
 	(*Credential)(nil),                                     // 8: pomerium.device.Credential
 	(*OwnerCredentialRecord)(nil),                          // 9: pomerium.device.OwnerCredentialRecord
-	(*WebAuthnOptions_AuthenticatorSelectionCriteria)(nil), // 10: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria
-	(*WebAuthnOptions_PublicKeyCredentialParameters)(nil),  // 11: pomerium.device.WebAuthnOptions.PublicKeyCredentialParameters
-	(*Type_WebAuthn)(nil),                                  // 12: pomerium.device.Type.WebAuthn
-	(*Credential_WebAuthn)(nil),                            // 13: pomerium.device.Credential.WebAuthn
-	(*timestamppb.Timestamp)(nil),                          // 14: google.protobuf.Timestamp
+	(*Posture)(nil),                                        // 10: pomerium.device.Posture
+	(*WebAuthnOptions_AuthenticatorSelectionCriteria)(nil), // 11: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria
+	(*WebAuthnOptions_PublicKeyCredentialParameters)(nil),  // 12: pomerium.device.WebAuthnOptions.PublicKeyCredentialParameters
+	(*Type_WebAuthn)(nil),                                  // 13: pomerium.device.Type.WebAuthn
+	(*Credential_WebAuthn)(nil),                            // 14: pomerium.device.Credential.WebAuthn
+	(*Posture_Device)(nil),                                 // 15: pomerium.device.Posture.Device
+	(*timestamppb.Timestamp)(nil),                          // 16: google.protobuf.Timestamp
 }
 var file_device_proto_depIdxs = []int32{
 	0,  // 0: pomerium.device.WebAuthnOptions.attestation:type_name -> pomerium.device.WebAuthnOptions.AttestationConveyancePreference
-	10, // 1: pomerium.device.WebAuthnOptions.authenticator_selection:type_name -> pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria
-	11, // 2: pomerium.device.WebAuthnOptions.pub_key_cred_params:type_name -> pomerium.device.WebAuthnOptions.PublicKeyCredentialParameters
-	12, // 3: pomerium.device.Type.webauthn:type_name -> pomerium.device.Type.WebAuthn
-	14, // 4: pomerium.device.Enrollment.enrolled_at:type_name -> google.protobuf.Timestamp
-	13, // 5: pomerium.device.Credential.webauthn:type_name -> pomerium.device.Credential.WebAuthn
-	1,  // 6: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria.authenticator_attachment:type_name -> pomerium.device.WebAuthnOptions.AuthenticatorAttachment
-	3,  // 7: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria.resident_key_requirement:type_name -> pomerium.device.WebAuthnOptions.ResidentKeyRequirement
-	4,  // 8: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria.user_verification:type_name -> pomerium.device.WebAuthnOptions.UserVerificationRequirement
-	2,  // 9: pomerium.device.WebAuthnOptions.PublicKeyCredentialParameters.type:type_name -> pomerium.device.WebAuthnOptions.PublicKeyCredentialType
-	5,  // 10: pomerium.device.Type.WebAuthn.options:type_name -> pomerium.device.WebAuthnOptions
-	11, // [11:11] is the sub-list for method output_type
-	11, // [11:11] is the sub-list for method input_type
-	11, // [11:11] is the sub-list for extension type_name
-	11, // [11:11] is the sub-list for extension extendee
-	0,  // [0:11] is the sub-list for field type_name
+	11, // 1: pomerium.device.WebAuthnOptions.authenticator_selection:type_name -> pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria
+	12, // 2: pomerium.device.WebAuthnOptions.pub_key_cred_params:type_name -> pomerium.device.WebAuthnOptions.PublicKeyCredentialParameters
+	13, // 3: pomerium.device.Type.webauthn:type_name -> pomerium.device.Type.WebAuthn
+	16, // 4: pomerium.device.Enrollment.enrolled_at:type_name -> google.protobuf.Timestamp
+	14, // 5: pomerium.device.Credential.webauthn:type_name -> pomerium.device.Credential.WebAuthn
+	15, // 6: pomerium.device.Posture.devices:type_name -> pomerium.device.Posture.Device
+	16, // 7: pomerium.device.Posture.updated_at:type_name -> google.protobuf.Timestamp
+	1,  // 8: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria.authenticator_attachment:type_name -> pomerium.device.WebAuthnOptions.AuthenticatorAttachment
+	3,  // 9: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria.resident_key_requirement:type_name -> pomerium.device.WebAuthnOptions.ResidentKeyRequirement
+	4,  // 10: pomerium.device.WebAuthnOptions.AuthenticatorSelectionCriteria.user_verification:type_name -> pomerium.device.WebAuthnOptions.UserVerificationRequirement
+	2,  // 11: pomerium.device.WebAuthnOptions.PublicKeyCredentialParameters.type:type_name -> pomerium.device.WebAuthnOptions.PublicKeyCredentialType
+	5,  // 12: pomerium.device.Type.WebAuthn.options:type_name -> pomerium.device.WebAuthnOptions
+	16, // 13: pomerium.device.Posture.Device.last_seen_at:type_name -> google.protobuf.Timestamp
+	14, // [14:14] is the sub-list for method output_type
+	14, // [14:14] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
 }
 
 func init() { file_device_proto_init() }
@@ -1215,7 +1437,7 @@ func file_device_proto_init() {
 			}
 		}
 		file_device_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*WebAuthnOptions_AuthenticatorSelectionCriteria); i {
+			switch v := v.(*Posture); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1227,7 +1449,7 @@ func file_device_proto_init() {
 			}
 		}
 		file_device_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*WebAuthnOptions_PublicKeyCredentialParameters); i {
+			switch v := v.(*WebAuthnOptions_AuthenticatorSelectionCriteria); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1239,7 +1461,7 @@ func file_device_proto_init() {
 			}
 		}
 		file_device_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Type_WebAuthn); i {
+			switch v := v.(*WebAuthnOptions_PublicKeyCredentialParameters); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1251,6 +1473,18 @@ func file_device_proto_init() {
 			}
 		}
 		file_device_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Type_WebAuthn); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_device_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Credential_WebAuthn); i {
 			case 0:
 				return &v.state
@@ -1262,6 +1496,18 @@ func file_device_proto_init() {
 				return nil
 			}
 		}
+		file_device_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Posture_Device); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_device_proto_msgTypes[0].OneofWrappers = []interface{}{}
 	file_device_proto_msgTypes[1].OneofWrappers = []interface{}{
@@ -1270,14 +1516,15 @@ func file_device_proto_init() {
 	file_device_proto_msgTypes[3].OneofWrappers = []interface{}{
 		(*Credential_Webauthn)(nil),
 	}
-	file_device_proto_msgTypes[5].OneofWrappers = []interface{}{}
+	file_device_proto_msgTypes[6].OneofWrappers = []interface{}{}
+	file_device_proto_msgTypes[10].OneofWrappers = []interface{}{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_device_proto_rawDesc,
 			NumEnums:      5,
-			NumMessages:   9,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
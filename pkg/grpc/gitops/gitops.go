@@ -0,0 +1,2 @@
+// Package gitops contains protobuf types for gitops route synchronization.
+package gitops
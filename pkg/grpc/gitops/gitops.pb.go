@@ -0,0 +1,282 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.21.7
+// source: gitops.proto
+
+package gitops
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CommitStatus_State int32
+
+const (
+	CommitStatus_UNKNOWN CommitStatus_State = 0
+	// the routes were applied
+	CommitStatus_APPLIED CommitStatus_State = 1
+	// the routes are invalid and were not applied
+	CommitStatus_INVALID CommitStatus_State = 2
+)
+
+// Enum value maps for CommitStatus_State.
+var (
+	CommitStatus_State_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "APPLIED",
+		2: "INVALID",
+	}
+	CommitStatus_State_value = map[string]int32{
+		"UNKNOWN": 0,
+		"APPLIED": 1,
+		"INVALID": 2,
+	}
+)
+
+func (x CommitStatus_State) Enum() *CommitStatus_State {
+	p := new(CommitStatus_State)
+	*p = x
+	return p
+}
+
+func (x CommitStatus_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CommitStatus_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_gitops_proto_enumTypes[0].Descriptor()
+}
+
+func (CommitStatus_State) Type() protoreflect.EnumType {
+	return &file_gitops_proto_enumTypes[0]
+}
+
+func (x CommitStatus_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CommitStatus_State.Descriptor instead.
+func (CommitStatus_State) EnumDescriptor() ([]byte, []int) {
+	return file_gitops_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// A CommitStatus is the status of the routes of a commit of a gitops
+// repository.
+type CommitStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// id is the commit hash.
+	Id         string             `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Repository string             `protobuf:"bytes,2,opt,name=repository,proto3" json:"repository,omitempty"`
+	Branch     string             `protobuf:"bytes,3,opt,name=branch,proto3" json:"branch,omitempty"`
+	Path       string             `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"`
+	State      CommitStatus_State `protobuf:"varint,5,opt,name=state,proto3,enum=pomerium.gitops.CommitStatus_State" json:"state,omitempty"`
+	// message describes why the routes are invalid.
+	Message  string                 `protobuf:"bytes,6,opt,name=message,proto3" json:"message,omitempty"`
+	Routes   int32                  `protobuf:"varint,7,opt,name=routes,proto3" json:"routes,omitempty"`
+	SyncedAt *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=synced_at,json=syncedAt,proto3" json:"synced_at,omitempty"`
+}
+
+func (x *CommitStatus) Reset() {
+	*x = CommitStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gitops_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CommitStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitStatus) ProtoMessage() {}
+
+func (x *CommitStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_gitops_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitStatus.ProtoReflect.Descriptor instead.
+func (*CommitStatus) Descriptor() ([]byte, []int) {
+	return file_gitops_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CommitStatus) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CommitStatus) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+func (x *CommitStatus) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *CommitStatus) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *CommitStatus) GetState() CommitStatus_State {
+	if x != nil {
+		return x.State
+	}
+	return CommitStatus_UNKNOWN
+}
+
+func (x *CommitStatus) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *CommitStatus) GetRoutes() int32 {
+	if x != nil {
+		return x.Routes
+	}
+	return 0
+}
+
+func (x *CommitStatus) GetSyncedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SyncedAt
+	}
+	return nil
+}
+
+var File_gitops_proto protoreflect.FileDescriptor
+
+var file_gitops_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x67, 0x69, 0x74, 0x6f, 0x70, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f,
+	0x70, 0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75, 0x6d, 0x2e, 0x67, 0x69, 0x74, 0x6f, 0x70, 0x73, 0x1a,
+	0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x22, 0xc0, 0x02, 0x0a, 0x0c, 0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x53, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69,
+	0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x72, 0x65, 0x70, 0x6f, 0x73, 0x69, 0x74, 0x6f, 0x72, 0x79, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x70, 0x6f, 0x73, 0x69, 0x74, 0x6f, 0x72,
+	0x79, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x62, 0x72, 0x61, 0x6e, 0x63, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74,
+	0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x39, 0x0a,
+	0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x23, 0x2e, 0x70,
+	0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75, 0x6d, 0x2e, 0x67, 0x69, 0x74, 0x6f, 0x70, 0x73, 0x2e, 0x43,
+	0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x2e, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x73, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x06, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x73, 0x12, 0x37, 0x0a, 0x09, 0x73, 0x79,
+	0x6e, 0x63, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x08, 0x73, 0x79, 0x6e, 0x63, 0x65,
+	0x64, 0x41, 0x74, 0x22, 0x2e, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x0b, 0x0a, 0x07,
+	0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x41, 0x50, 0x50,
+	0x4c, 0x49, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49,
+	0x44, 0x10, 0x02, 0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
+	0x6d, 0x2f, 0x70, 0x6f, 0x6d, 0x65, 0x72, 0x69, 0x75, 0x6d, 0x2f, 0x70, 0x6f, 0x6d, 0x65, 0x72,
+	0x69, 0x75, 0x6d, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x67, 0x69, 0x74,
+	0x6f, 0x70, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_gitops_proto_rawDescOnce sync.Once
+	file_gitops_proto_rawDescData = file_gitops_proto_rawDesc
+)
+
+func file_gitops_proto_rawDescGZIP() []byte {
+	file_gitops_proto_rawDescOnce.Do(func() {
+		file_gitops_proto_rawDescData = protoimpl.X.CompressGZIP(file_gitops_proto_rawDescData)
+	})
+	return file_gitops_proto_rawDescData
+}
+
+var file_gitops_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_gitops_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_gitops_proto_goTypes = []interface{}{
+	(CommitStatus_State)(0),       // 0: pomerium.gitops.CommitStatus.State
+	(*CommitStatus)(nil),          // 1: pomerium.gitops.CommitStatus
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_gitops_proto_depIdxs = []int32{
+	0, // 0: pomerium.gitops.CommitStatus.state:type_name -> pomerium.gitops.CommitStatus.State
+	2, // 1: pomerium.gitops.CommitStatus.synced_at:type_name -> google.protobuf.Timestamp
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_gitops_proto_init() }
+func file_gitops_proto_init() {
+	if File_gitops_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_gitops_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CommitStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_gitops_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_gitops_proto_goTypes,
+		DependencyIndexes: file_gitops_proto_depIdxs,
+		EnumInfos:         file_gitops_proto_enumTypes,
+		MessageInfos:      file_gitops_proto_msgTypes,
+	}.Build()
+	File_gitops_proto = out.File
+	file_gitops_proto_rawDesc = nil
+	file_gitops_proto_goTypes = nil
+	file_gitops_proto_depIdxs = nil
+}
@@ -92,6 +92,10 @@ _import_paths=$(join_by , "${_imports[@]}")
   --go_out="$_import_paths,plugins=grpc,paths=source_relative:./device/." \
   ./device/device.proto
 
+../../scripts/protoc -I ./gitops/ \
+  --go_out="$_import_paths,plugins=grpc,paths=source_relative:./gitops/." \
+  ./gitops/gitops.proto
+
 ../../scripts/protoc -I ./identity/ \
   --go_out="$_import_paths,plugins=grpc,paths=source_relative:./identity/." \
   ./identity/identity.proto
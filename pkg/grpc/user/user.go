@@ -3,8 +3,13 @@ package user
 
 import (
 	context "context"
+	"fmt"
+	"strings"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/internal/identity"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
@@ -28,6 +33,27 @@ func PutServiceAccount(ctx context.Context, client databroker.DataBrokerServiceC
 	return databroker.Put(ctx, client, serviceAccount)
 }
 
+// LinkAccount links an account with a verified email address to a user. The
+// first account to sign in with an email address determines the user, and
+// the ID of that user is returned.
+func LinkAccount(ctx context.Context, client databroker.DataBrokerServiceClient, email, userID string) (string, error) {
+	link := &AccountLink{Id: strings.ToLower(strings.TrimSpace(email))}
+	err := databroker.Get(ctx, client, link)
+	if err == nil {
+		return link.GetUserId(), nil
+	} else if status.Code(err) != codes.NotFound {
+		return "", fmt.Errorf("user: error loading account link: %w", err)
+	}
+
+	link.UserId = userID
+	link.CreatedAt = timestamppb.Now()
+	_, err = databroker.Put(ctx, client, link)
+	if err != nil {
+		return "", fmt.Errorf("user: error saving account link: %w", err)
+	}
+	return userID, nil
+}
+
 // AddClaims adds the flattened claims to the user.
 func (x *User) AddClaims(claims identity.FlattenedClaims) {
 	if x.Claims == nil {
@@ -0,0 +1,54 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type mockDataBrokerServiceClient struct {
+	databroker.DataBrokerServiceClient
+
+	records map[string]*databroker.Record
+}
+
+func (m mockDataBrokerServiceClient) Get(_ context.Context, in *databroker.GetRequest, _ ...grpc.CallOption) (*databroker.GetResponse, error) {
+	record, ok := m.records[in.GetType()+"/"+in.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &databroker.GetResponse{Record: record}, nil
+}
+
+func (m mockDataBrokerServiceClient) Put(_ context.Context, in *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+	for _, record := range in.GetRecords() {
+		m.records[record.GetType()+"/"+record.GetId()] = record
+	}
+	return &databroker.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func TestLinkAccount(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := mockDataBrokerServiceClient{records: make(map[string]*databroker.Record)}
+
+	userID, err := LinkAccount(ctx, client, "Alice@Example.com", "google-user")
+	require.NoError(t, err)
+	assert.Equal(t, "google-user", userID)
+
+	userID, err = LinkAccount(ctx, client, "alice@example.com", "okta-user")
+	require.NoError(t, err)
+	assert.Equal(t, "google-user", userID, "should link to the first user")
+
+	userID, err = LinkAccount(ctx, client, "bob@example.com", "okta-bob")
+	require.NoError(t, err)
+	assert.Equal(t, "okta-bob", userID)
+}
@@ -0,0 +1,152 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+type awsClient struct {
+	httpClient  *http.Client
+	endpoint    string
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+}
+
+func newAWSSignerFromURL(ctx context.Context, rest string) (Signer, error) {
+	keyID, err := parseAWSKeyID(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error loading aws config: %w", err)
+	}
+
+	region := cfg.Region
+	// ARNs contain the region of the key
+	if strings.HasPrefix(keyID, "arn:") {
+		if parts := strings.Split(keyID, ":"); len(parts) > 3 && parts[3] != "" {
+			region = parts[3]
+		}
+	}
+	if region == "" {
+		return nil, errors.New("kms: aws region is required")
+	}
+
+	return newAWSSigner(ctx, &awsClient{
+		httpClient:  &http.Client{Timeout: requestTimeout},
+		endpoint:    fmt.Sprintf("https://kms.%s.amazonaws.com/", region),
+		region:      region,
+		credentials: cfg.Credentials,
+		signer:      v4.NewSigner(),
+	}, keyID)
+}
+
+func newAWSSigner(ctx context.Context, client *awsClient, keyID string) (Signer, error) {
+	var getPublicKeyResponse struct {
+		PublicKey []byte
+	}
+	err := client.call(ctx, "GetPublicKey", map[string]any{
+		"KeyId": keyID,
+	}, &getPublicKeyResponse)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error retrieving aws kms public key: %w", err)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(getPublicKeyResponse.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid aws kms public key: %w", err)
+	}
+
+	var signingAlgorithm string
+	s, err := newSigner(publicKey, func(ctx context.Context, digest []byte) ([]byte, error) {
+		var signResponse struct {
+			Signature []byte
+		}
+		err := client.call(ctx, "Sign", map[string]any{
+			"KeyId":            keyID,
+			"Message":          digest,
+			"MessageType":      "DIGEST",
+			"SigningAlgorithm": signingAlgorithm,
+		}, &signResponse)
+		if err != nil {
+			return nil, fmt.Errorf("kms: error signing with aws kms: %w", err)
+		}
+		return normalizeSignature(publicKey, signResponse.Signature)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.jwk.Algorithm {
+	case "ES256":
+		signingAlgorithm = "ECDSA_SHA_256"
+	case "RS256":
+		signingAlgorithm = "RSASSA_PKCS1_V1_5_SHA_256"
+	}
+	return s, nil
+}
+
+// call calls an AWS KMS API action using the JSON protocol.
+func (client *awsClient) call(ctx context.Context, action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+
+	credentials, err := client.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("error retrieving aws credentials: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+	err = client.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(payloadHash[:]), "kms", client.region, time.Now())
+	if err != nil {
+		return fmt.Errorf("error signing aws request: %w", err)
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(res, resBody); err != nil {
+		return err
+	}
+	return json.Unmarshal(resBody, out)
+}
+
+func parseAWSKeyID(rest string) (string, error) {
+	keyID := strings.TrimPrefix(rest, "/")
+	if keyID == "" {
+		return "", errors.New("kms: aws kms key id is required")
+	}
+	return keyID, nil
+}
@@ -0,0 +1,124 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+const gcpKMSEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+type gcpClient struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+func newGCPSignerFromURL(ctx context.Context, rest string) (Signer, error) {
+	name, err := parseGCPKeyName(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	// the context is used to refresh tokens for the lifetime of the client
+	httpClient, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/cloudkms")
+	if err != nil {
+		return nil, fmt.Errorf("kms: error loading google cloud credentials: %w", err)
+	}
+	httpClient.Timeout = requestTimeout
+
+	return newGCPSigner(ctx, &gcpClient{
+		httpClient: httpClient,
+		endpoint:   gcpKMSEndpoint,
+	}, name)
+}
+
+func newGCPSigner(ctx context.Context, client *gcpClient, name string) (Signer, error) {
+	var getPublicKeyResponse struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	err := client.call(ctx, http.MethodGet, name+"/publicKey", nil, &getPublicKeyResponse)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error retrieving google cloud kms public key: %w", err)
+	}
+
+	// JWS only supports PKCS #1 v1.5 signatures for RSA keys
+	if !(getPublicKeyResponse.Algorithm == "EC_SIGN_P256_SHA256" ||
+		(strings.HasPrefix(getPublicKeyResponse.Algorithm, "RSA_SIGN_PKCS1_") &&
+			strings.HasSuffix(getPublicKeyResponse.Algorithm, "_SHA256"))) {
+		return nil, fmt.Errorf("kms: unsupported google cloud kms key algorithm: %s", getPublicKeyResponse.Algorithm)
+	}
+
+	publicKey, err := parsePublicKeyPEM([]byte(getPublicKeyResponse.Pem))
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigner(publicKey, func(ctx context.Context, digest []byte) ([]byte, error) {
+		var signResponse struct {
+			Signature []byte `json:"signature"`
+		}
+		err := client.call(ctx, http.MethodPost, name+":asymmetricSign", map[string]any{
+			"digest": map[string]any{"sha256": digest},
+		}, &signResponse)
+		if err != nil {
+			return nil, fmt.Errorf("kms: error signing with google cloud kms: %w", err)
+		}
+		return normalizeSignature(publicKey, signResponse.Signature)
+	})
+}
+
+func (client *gcpClient) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, client.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(res, resBody); err != nil {
+		return err
+	}
+	return json.Unmarshal(resBody, out)
+}
+
+func parseGCPKeyName(rest string) (string, error) {
+	name := strings.TrimPrefix(rest, "/")
+	parts := strings.Split(name, "/")
+	if len(parts) != 10 ||
+		parts[0] != "projects" ||
+		parts[2] != "locations" ||
+		parts[4] != "keyRings" ||
+		parts[6] != "cryptoKeys" ||
+		parts[8] != "cryptoKeyVersions" {
+		return "", errors.New("kms: google cloud kms key must be a crypto key version resource name")
+	}
+	return name, nil
+}
@@ -0,0 +1,243 @@
+// Package kms contains JWT signers backed by key management services and
+// hardware security modules, so that the private signing key never leaves the
+// key management service.
+//
+// Signers are identified by a URL:
+//
+//	awskms:///<key id, key ARN, alias name or alias ARN>
+//	gcpkms://projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>/cryptoKeyVersions/<v>
+//	hashivault://<key name>?mount=<transit mount path>
+//	pkcs11:token=<token label>;object=<key label>?module-path=<path>&pin-value=<pin>
+//
+// Credentials are loaded from the environment, the same way the AWS and Google
+// Cloud SDKs and the Vault CLI load them.
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// URL schemes for the supported key management services.
+const (
+	SchemeAWSKMS     = "awskms"
+	SchemeGCPKMS     = "gcpkms"
+	SchemeHashiVault = "hashivault"
+	SchemePKCS11     = "pkcs11"
+)
+
+// requestTimeout is the timeout for requests to a key management service.
+const requestTimeout = 10 * time.Second
+
+// A Signer signs JWTs with a key stored in a key management service.
+type Signer interface {
+	jose.OpaqueSigner
+}
+
+var signers struct {
+	sync.Mutex
+	m map[string]Signer
+}
+
+// GetSigner returns the Signer for the given URL. Signers are cached, so the
+// public key is only retrieved from the key management service once.
+func GetSigner(ctx context.Context, rawURL string) (Signer, error) {
+	signers.Lock()
+	defer signers.Unlock()
+
+	if s, ok := signers.m[rawURL]; ok {
+		return s, nil
+	}
+
+	s, err := NewSigner(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if signers.m == nil {
+		signers.m = make(map[string]Signer)
+	}
+	signers.m[rawURL] = s
+	return s, nil
+}
+
+// NewSigner creates a new Signer for the given URL.
+func NewSigner(ctx context.Context, rawURL string) (Signer, error) {
+	scheme, rest, err := splitURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case SchemeAWSKMS:
+		return newAWSSignerFromURL(ctx, rest)
+	case SchemeGCPKMS:
+		return newGCPSignerFromURL(ctx, rest)
+	case SchemeHashiVault:
+		return newVaultSignerFromURL(ctx, rest)
+	case SchemePKCS11:
+		return newPKCS11SignerFromURL(rawURL)
+	}
+	return nil, fmt.Errorf("kms: unsupported signer url scheme: %s", scheme)
+}
+
+// ValidateURL validates a signer URL without contacting the key management
+// service.
+func ValidateURL(rawURL string) error {
+	scheme, rest, err := splitURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	switch scheme {
+	case SchemeAWSKMS:
+		_, err = parseAWSKeyID(rest)
+	case SchemeGCPKMS:
+		_, err = parseGCPKeyName(rest)
+	case SchemeHashiVault:
+		_, _, err = parseVaultKey(rest)
+	case SchemePKCS11:
+		_, err = parsePKCS11URI(rawURL)
+	default:
+		err = fmt.Errorf("kms: unsupported signer url scheme: %s", scheme)
+	}
+	return err
+}
+
+// splitURL splits a signer URL into its scheme and the rest of the URL.
+// PKCS #11 URIs don't have an authority, so they don't contain "//".
+func splitURL(rawURL string) (scheme, rest string, err error) {
+	scheme, rest, ok := strings.Cut(rawURL, ":")
+	if ok && scheme != SchemePKCS11 {
+		ok = strings.HasPrefix(rest, "//")
+		rest = strings.TrimPrefix(rest, "//")
+	}
+	if !ok {
+		return "", "", fmt.Errorf("kms: invalid signer url: %s", rawURL)
+	}
+	return scheme, rest, nil
+}
+
+// EncodePublicKey returns the PEM encoded public key of the signer.
+func EncodePublicKey(s Signer) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(s.Public().Key)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error encoding public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// signer implements the jose.OpaqueSigner interface for a key management
+// service which signs SHA-256 digests.
+type signer struct {
+	jwk  *jose.JSONWebKey
+	sign func(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+func newSigner(publicKey crypto.PublicKey, sign func(ctx context.Context, digest []byte) ([]byte, error)) (*signer, error) {
+	if k, ok := publicKey.(*ecdsa.PublicKey); ok && k.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("kms: unsupported elliptic curve: %s", k.Curve.Params().Name)
+	}
+
+	alg, err := cryptutil.SignatureAlgorithmForKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the key id matches the one used for PEM encoded signing keys
+	jwk := &jose.JSONWebKey{Key: publicKey, Use: "sig", Algorithm: string(alg)}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error computing thumbprint: %w", err)
+	}
+	jwk.KeyID = hex.EncodeToString(thumbprint)
+
+	return &signer{jwk: jwk, sign: sign}, nil
+}
+
+func (s *signer) Public() *jose.JSONWebKey {
+	return s.jwk
+}
+
+func (s *signer) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{jose.SignatureAlgorithm(s.jwk.Algorithm)}
+}
+
+func (s *signer) SignPayload(payload []byte, alg jose.SignatureAlgorithm) ([]byte, error) {
+	if string(alg) != s.jwk.Algorithm {
+		return nil, fmt.Errorf("kms: unsupported signature algorithm: %s", alg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	digest := sha256.Sum256(payload)
+	return s.sign(ctx, digest[:])
+}
+
+// rawECDSASignature converts an ASN.1 encoded ECDSA signature to the fixed
+// length R || S format used by JWS.
+func rawECDSASignature(der []byte) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid ecdsa signature: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("kms: invalid ecdsa signature: trailing data")
+	} else if sig.R.BitLen() > 256 || sig.S.BitLen() > 256 {
+		return nil, errors.New("kms: invalid ecdsa signature: invalid length")
+	}
+
+	raw := make([]byte, 64)
+	sig.R.FillBytes(raw[:32])
+	sig.S.FillBytes(raw[32:])
+	return raw, nil
+}
+
+// normalizeSignature converts signatures returned by a key management service
+// to the format used by JWS.
+func normalizeSignature(publicKey crypto.PublicKey, sig []byte) ([]byte, error) {
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return rawECDSASignature(sig)
+	case *rsa.PublicKey:
+		return sig, nil
+	}
+	return nil, fmt.Errorf("kms: unsupported key type: %T", publicKey)
+}
+
+func parsePublicKeyPEM(raw []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("kms: invalid public key pem")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func checkResponse(res *http.Response, body []byte) error {
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+	return fmt.Errorf("unexpected status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,235 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestSigners(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, key := range []crypto.Signer{ecKey, rsaKey} {
+		key := key
+		publicKeyDER, err := x509.MarshalPKIXPublicKey(key.Public())
+		require.NoError(t, err)
+		publicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+		sign := func(digest []byte) []byte {
+			sig, err := key.Sign(rand.Reader, digest, crypto.SHA256)
+			require.NoError(t, err)
+			return sig
+		}
+
+		t.Run("aws", func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/kms/")
+				var req struct {
+					KeyID            string `json:"KeyId"`
+					Message          []byte
+					MessageType      string
+					SigningAlgorithm string
+				}
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				assert.Equal(t, "alias/pomerium", req.KeyID)
+
+				switch r.Header.Get("X-Amz-Target") {
+				case "TrentService.GetPublicKey":
+					_ = json.NewEncoder(w).Encode(map[string]any{"PublicKey": publicKeyDER})
+				case "TrentService.Sign":
+					assert.Equal(t, "DIGEST", req.MessageType)
+					_ = json.NewEncoder(w).Encode(map[string]any{"Signature": sign(req.Message)})
+				default:
+					http.Error(w, "unknown action", http.StatusBadRequest)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			s, err := newAWSSigner(context.Background(), &awsClient{
+				httpClient: srv.Client(),
+				endpoint:   srv.URL,
+				region:     "us-east-1",
+				credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+					return aws.Credentials{AccessKeyID: "ACCESS_KEY_ID", SecretAccessKey: "SECRET_ACCESS_KEY"}, nil
+				}),
+				signer: v4.NewSigner(),
+			}, "alias/pomerium")
+			require.NoError(t, err)
+			testSigner(t, s, key.Public())
+		})
+		t.Run("gcp", func(t *testing.T) {
+			t.Parallel()
+
+			name := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/" + name + "/publicKey":
+					algorithm := "EC_SIGN_P256_SHA256"
+					if _, ok := key.(*rsa.PrivateKey); ok {
+						algorithm = "RSA_SIGN_PKCS1_2048_SHA256"
+					}
+					_ = json.NewEncoder(w).Encode(map[string]any{"pem": publicKeyPEM, "algorithm": algorithm})
+				case "/" + name + ":asymmetricSign":
+					var req struct {
+						Digest struct {
+							SHA256 []byte `json:"sha256"`
+						} `json:"digest"`
+					}
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					_ = json.NewEncoder(w).Encode(map[string]any{"signature": sign(req.Digest.SHA256)})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			s, err := newGCPSigner(context.Background(), &gcpClient{
+				httpClient: srv.Client(),
+				endpoint:   srv.URL + "/",
+			}, name)
+			require.NoError(t, err)
+			testSigner(t, s, key.Public())
+		})
+		t.Run("vault", func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "TOKEN", r.Header.Get("X-Vault-Token"))
+				switch r.URL.Path {
+				case "/v1/custom-transit/keys/pomerium":
+					_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+						"latest_version": 2,
+						"keys": map[string]any{
+							"1": map[string]any{"public_key": "OLD"},
+							"2": map[string]any{"public_key": publicKeyPEM},
+						},
+					}})
+				case "/v1/custom-transit/sign/pomerium":
+					var req struct {
+						Input      string `json:"input"`
+						Prehashed  bool   `json:"prehashed"`
+						KeyVersion int    `json:"key_version"`
+					}
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					assert.True(t, req.Prehashed)
+					assert.Equal(t, 2, req.KeyVersion)
+					digest, _ := base64.StdEncoding.DecodeString(req.Input)
+					_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+						"signature": "vault:v2:" + base64.StdEncoding.EncodeToString(sign(digest)),
+					}})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			s, err := newVaultSigner(context.Background(), &vaultClient{
+				httpClient: srv.Client(),
+				address:    srv.URL,
+				token:      "TOKEN",
+				mount:      "custom-transit",
+			}, "pomerium")
+			require.NoError(t, err)
+			testSigner(t, s, key.Public())
+		})
+	}
+}
+
+func testSigner(t *testing.T, s Signer, publicKey crypto.PublicKey) {
+	t.Helper()
+
+	// the key id matches the key id of the PEM encoded public key
+	publicKeyPEM, err := EncodePublicKey(s)
+	require.NoError(t, err)
+	jwk, err := cryptutil.PublicJWKFromBytes(publicKeyPEM)
+	require.NoError(t, err)
+	assert.Equal(t, jwk.KeyID, s.Public().KeyID)
+	assert.Equal(t, jwk.Algorithm, s.Public().Algorithm)
+
+	js, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(s.Public().Algorithm),
+		Key:       s,
+	}, nil)
+	require.NoError(t, err)
+	raw, err := jwt.Signed(js).Claims(map[string]any{"sub": "user"}).CompactSerialize()
+	require.NoError(t, err)
+
+	tok, err := jwt.ParseSigned(raw)
+	require.NoError(t, err)
+	var claims map[string]any
+	assert.NoError(t, tok.Claims(publicKey, &claims))
+	assert.Equal(t, "user", claims["sub"])
+}
+
+func TestValidateURL(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		url   string
+		valid bool
+	}{
+		{"awskms:///arn:aws:kms:us-east-1:123456789012:key/1234abcd", true},
+		{"awskms://alias/pomerium", true},
+		{"awskms://", false},
+		{"gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", true},
+		{"gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k", false},
+		{"hashivault://pomerium", true},
+		{"hashivault://pomerium?mount=custom", true},
+		{"hashivault://", false},
+		{"pkcs11:token=pomerium;object=signing-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234", true},
+		{"pkcs11:token=pomerium?module-path=/usr/lib/softhsm/libsofthsm2.so", false},
+		{"file:///signing-key.pem", false},
+		{"pomerium", false},
+	} {
+		err := ValidateURL(tc.url)
+		if tc.valid {
+			assert.NoError(t, err, tc.url)
+		} else {
+			assert.Error(t, err, tc.url)
+		}
+	}
+}
+
+func TestRawECDSASignature(t *testing.T) {
+	t.Parallel()
+
+	_, err := rawECDSASignature([]byte("not asn.1"))
+	assert.Error(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := key.Sign(rand.Reader, make([]byte, 32), crypto.SHA256)
+	require.NoError(t, err)
+	raw, err := rawECDSASignature(der)
+	assert.NoError(t, err)
+	if assert.Len(t, raw, 64) {
+		r, s := new(big.Int).SetBytes(raw[:32]), new(big.Int).SetBytes(raw[32:])
+		assert.True(t, ecdsa.Verify(&key.PublicKey, make([]byte, 32), r, s))
+	}
+}
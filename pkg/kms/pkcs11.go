@@ -0,0 +1,370 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PKCS #11 constants, as defined by the PKCS #11 specification.
+const (
+	ckmRSAPKCS    = 0x0001
+	ckmRSAPKCSPSS = 0x000d
+	ckmECDSA      = 0x1041
+
+	ckmSHA1   = 0x0220
+	ckmSHA224 = 0x0255
+	ckmSHA256 = 0x0250
+	ckmSHA384 = 0x0260
+	ckmSHA512 = 0x0270
+
+	ckgMGF1SHA1   = 0x0001
+	ckgMGF1SHA224 = 0x0005
+	ckgMGF1SHA256 = 0x0002
+	ckgMGF1SHA384 = 0x0003
+	ckgMGF1SHA512 = 0x0004
+)
+
+// pkcs11URI is a PKCS #11 URI, as defined by RFC 7512. Only the attributes
+// needed to find a private key are supported.
+type pkcs11URI struct {
+	token      string
+	serial     string
+	slotID     *uint
+	object     string
+	id         []byte
+	modulePath string
+	pin        string
+}
+
+// parsePKCS11URI parses a PKCS #11 URI, such as:
+//
+//	pkcs11:token=pomerium;object=signing-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/secrets/pin
+func parsePKCS11URI(rawURI string) (*pkcs11URI, error) {
+	if !IsPKCS11URI(rawURI) {
+		return nil, fmt.Errorf("kms: invalid pkcs11 uri: %s", rawURI)
+	}
+	opaque := strings.TrimPrefix(rawURI, SchemePKCS11+":")
+	rawPath, rawQuery, _ := strings.Cut(opaque, "?")
+
+	uri := new(pkcs11URI)
+	if rawPath != "" {
+		for _, attr := range strings.Split(rawPath, ";") {
+			k, rawValue, _ := strings.Cut(attr, "=")
+			v, err := url.PathUnescape(rawValue)
+			if err != nil {
+				return nil, fmt.Errorf("kms: invalid pkcs11 uri attribute %s: %w", k, err)
+			}
+			switch k {
+			case "token":
+				uri.token = v
+			case "serial":
+				uri.serial = v
+			case "slot-id":
+				slotID, err := strconv.ParseUint(v, 10, 0)
+				if err != nil {
+					return nil, fmt.Errorf("kms: invalid pkcs11 uri slot-id: %w", err)
+				}
+				id := uint(slotID)
+				uri.slotID = &id
+			case "object":
+				uri.object = v
+			case "id":
+				uri.id = []byte(v)
+			case "type":
+				if v != "private" {
+					return nil, fmt.Errorf("kms: unsupported pkcs11 object type: %s", v)
+				}
+			}
+		}
+	}
+
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid pkcs11 uri query: %w", err)
+	}
+	uri.modulePath = q.Get("module-path")
+	uri.pin = q.Get("pin-value")
+	if pinSource := q.Get("pin-source"); pinSource != "" {
+		bs, err := os.ReadFile(strings.TrimPrefix(pinSource, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("kms: error reading pkcs11 pin: %w", err)
+		}
+		uri.pin = strings.TrimSpace(string(bs))
+	}
+
+	if uri.modulePath == "" {
+		return nil, errors.New("kms: pkcs11 uri module-path is required")
+	}
+	if uri.object == "" && len(uri.id) == 0 {
+		return nil, errors.New("kms: pkcs11 uri object or id is required")
+	}
+	return uri, nil
+}
+
+// pkcs11PSSParams are the parameters of the CKM_RSA_PKCS_PSS mechanism.
+type pkcs11PSSParams struct {
+	hashAlg uint
+	mgf     uint
+	sLen    uint
+}
+
+// A pkcs11Key is a private key stored in a hardware security module. It
+// implements crypto.Signer, so it can be used for TLS private keys.
+type pkcs11Key struct {
+	publicKey crypto.PublicKey
+	sign      func(mechanism uint, params *pkcs11PSSParams, data []byte) ([]byte, error)
+}
+
+var pkcs11Keys struct {
+	sync.Mutex
+	m map[string]*pkcs11Key
+}
+
+// getPKCS11Key returns the private key for a PKCS #11 URI. Keys are cached,
+// so that sessions are reused.
+func getPKCS11Key(rawURI string) (*pkcs11Key, error) {
+	pkcs11Keys.Lock()
+	defer pkcs11Keys.Unlock()
+
+	if k, ok := pkcs11Keys.m[rawURI]; ok {
+		return k, nil
+	}
+
+	uri, err := parsePKCS11URI(rawURI)
+	if err != nil {
+		return nil, err
+	}
+	k, err := openPKCS11Key(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkcs11Keys.m == nil {
+		pkcs11Keys.m = make(map[string]*pkcs11Key)
+	}
+	pkcs11Keys.m[rawURI] = k
+	return k, nil
+}
+
+func newPKCS11SignerFromURL(rawURI string) (Signer, error) {
+	key, err := getPKCS11Key(rawURI)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(key.Public(), func(ctx context.Context, digest []byte) ([]byte, error) {
+		sig, err := key.Sign(nil, digest, crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeSignature(key.Public(), sig)
+	})
+}
+
+// IsPKCS11URI returns true if the given string is a PKCS #11 URI.
+func IsPKCS11URI(raw string) bool {
+	return strings.HasPrefix(raw, SchemePKCS11+":")
+}
+
+// LoadX509KeyPair loads a certificate chain from a PEM encoded file, with a
+// private key stored in a hardware security module identified by a PKCS #11
+// URI.
+func LoadX509KeyPair(certFile, keyURI string) (*tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := new(tls.Certificate)
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("kms: no certificates found in %s", certFile)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid certificate: %w", err)
+	}
+
+	key, err := getPKCS11Key(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	if pub, ok := cert.Leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(key.Public()) {
+		return nil, errors.New("kms: private key does not match certificate")
+	}
+	cert.PrivateKey = key
+
+	return cert, nil
+}
+
+// Public returns the public key.
+func (k *pkcs11Key) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign signs a digest with the private key. ECDSA signatures are ASN.1
+// encoded, and RSA signatures use PSS if opts is a *rsa.PSSOptions, as
+// required by crypto.Signer.
+func (k *pkcs11Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != 0 && len(digest) != opts.HashFunc().Size() {
+		return nil, errors.New("kms: invalid digest length")
+	}
+
+	switch publicKey := k.publicKey.(type) {
+	case *ecdsa.PublicKey:
+		raw, err := k.sign(ckmECDSA, nil, digest)
+		if err != nil {
+			return nil, err
+		}
+		return marshalECDSASignature(publicKey, raw)
+	case *rsa.PublicKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			params, err := getPKCS11PSSParams(publicKey, pssOpts)
+			if err != nil {
+				return nil, err
+			}
+			return k.sign(ckmRSAPKCSPSS, params, digest)
+		}
+
+		prefix, ok := pkcs1v15DigestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("kms: unsupported hash function: %s", opts.HashFunc())
+		}
+		return k.sign(ckmRSAPKCS, nil, append(append([]byte{}, prefix...), digest...))
+	}
+	return nil, fmt.Errorf("kms: unsupported key type: %T", k.publicKey)
+}
+
+// pkcs1v15DigestInfoPrefixes are the ASN.1 DigestInfo prefixes of PKCS #1 v1.5
+// signatures, since the CKM_RSA_PKCS mechanism doesn't add them.
+var pkcs1v15DigestInfoPrefixes = map[crypto.Hash][]byte{
+	// TLS 1.0 and 1.1 sign a MD5 and SHA-1 digest without a prefix
+	crypto.MD5SHA1: {},
+	crypto.SHA1:    {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA224:  {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256:  {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384:  {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512:  {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+func getPKCS11PSSParams(publicKey *rsa.PublicKey, opts *rsa.PSSOptions) (*pkcs11PSSParams, error) {
+	params := new(pkcs11PSSParams)
+	switch opts.Hash {
+	case crypto.SHA1:
+		params.hashAlg, params.mgf = ckmSHA1, ckgMGF1SHA1
+	case crypto.SHA224:
+		params.hashAlg, params.mgf = ckmSHA224, ckgMGF1SHA224
+	case crypto.SHA256:
+		params.hashAlg, params.mgf = ckmSHA256, ckgMGF1SHA256
+	case crypto.SHA384:
+		params.hashAlg, params.mgf = ckmSHA384, ckgMGF1SHA384
+	case crypto.SHA512:
+		params.hashAlg, params.mgf = ckmSHA512, ckgMGF1SHA512
+	default:
+		return nil, fmt.Errorf("kms: unsupported hash function: %s", opts.Hash)
+	}
+
+	switch opts.SaltLength {
+	case rsa.PSSSaltLengthEqualsHash:
+		params.sLen = uint(opts.Hash.Size())
+	case rsa.PSSSaltLengthAuto:
+		params.sLen = uint((publicKey.N.BitLen()-1+7)/8 - 2 - opts.Hash.Size())
+	default:
+		if opts.SaltLength < 0 {
+			return nil, fmt.Errorf("kms: invalid pss salt length: %d", opts.SaltLength)
+		}
+		params.sLen = uint(opts.SaltLength)
+	}
+	return params, nil
+}
+
+// marshalECDSASignature converts the R || S signature returned by the
+// CKM_ECDSA mechanism to ASN.1.
+func marshalECDSASignature(publicKey *ecdsa.PublicKey, raw []byte) ([]byte, error) {
+	size := (publicKey.Curve.Params().BitSize + 7) / 8
+	if len(raw) != 2*size {
+		return nil, errors.New("kms: invalid pkcs11 ecdsa signature")
+	}
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(raw[:size]),
+		S: new(big.Int).SetBytes(raw[size:]),
+	})
+}
+
+// named curve object identifiers, as used by CKA_EC_PARAMS
+var (
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// parsePKCS11ECPublicKey parses the CKA_EC_PARAMS and CKA_EC_POINT attributes
+// of an EC key.
+func parsePKCS11ECPublicKey(ecParams, ecPoint []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(ecParams, &oid); err != nil {
+		return nil, fmt.Errorf("kms: invalid pkcs11 ec params: %w", err)
+	}
+
+	var curve elliptic.Curve
+	switch {
+	case oid.Equal(oidNamedCurveP256):
+		curve = elliptic.P256()
+	case oid.Equal(oidNamedCurveP384):
+		curve = elliptic.P384()
+	case oid.Equal(oidNamedCurveP521):
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("kms: unsupported pkcs11 elliptic curve: %s", oid)
+	}
+
+	// the point should be DER encoded, but some modules return it raw
+	point := ecPoint
+	var der []byte
+	if rest, err := asn1.Unmarshal(ecPoint, &der); err == nil && len(rest) == 0 {
+		point = der
+	}
+
+	x, y := elliptic.Unmarshal(curve, point) //nolint:staticcheck
+	if x == nil {
+		return nil, errors.New("kms: invalid pkcs11 ec point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// parsePKCS11RSAPublicKey parses the CKA_MODULUS and CKA_PUBLIC_EXPONENT
+// attributes of an RSA key.
+func parsePKCS11RSAPublicKey(modulus, publicExponent []byte) (*rsa.PublicKey, error) {
+	e := new(big.Int).SetBytes(publicExponent)
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("kms: invalid pkcs11 rsa public exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(e.Int64())}, nil
+}
@@ -0,0 +1,550 @@
+//go:build cgo && (linux || darwin)
+
+package kms
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+
+// The subset of the PKCS #11 header needed to sign with a private key. On
+// unix platforms PKCS #11 structs use the default packing.
+
+typedef unsigned long CK_ULONG;
+typedef CK_ULONG CK_RV;
+typedef CK_ULONG CK_SLOT_ID;
+typedef CK_ULONG CK_SESSION_HANDLE;
+typedef CK_ULONG CK_OBJECT_HANDLE;
+typedef CK_ULONG CK_FLAGS;
+typedef CK_ULONG CK_ATTRIBUTE_TYPE;
+typedef CK_ULONG CK_MECHANISM_TYPE;
+typedef CK_ULONG CK_USER_TYPE;
+typedef unsigned char CK_BYTE;
+
+typedef struct {
+	CK_BYTE major;
+	CK_BYTE minor;
+} CK_VERSION;
+
+typedef struct {
+	CK_BYTE label[32];
+	CK_BYTE manufacturerID[32];
+	CK_BYTE model[16];
+	CK_BYTE serialNumber[16];
+	CK_FLAGS flags;
+	CK_ULONG ulMaxSessionCount;
+	CK_ULONG ulSessionCount;
+	CK_ULONG ulMaxRwSessionCount;
+	CK_ULONG ulRwSessionCount;
+	CK_ULONG ulMaxPinLen;
+	CK_ULONG ulMinPinLen;
+	CK_ULONG ulTotalPublicMemory;
+	CK_ULONG ulFreePublicMemory;
+	CK_ULONG ulTotalPrivateMemory;
+	CK_ULONG ulFreePrivateMemory;
+	CK_VERSION hardwareVersion;
+	CK_VERSION firmwareVersion;
+	CK_BYTE utcTime[16];
+} CK_TOKEN_INFO;
+
+typedef struct {
+	CK_ATTRIBUTE_TYPE type;
+	void *pValue;
+	CK_ULONG ulValueLen;
+} CK_ATTRIBUTE;
+
+typedef struct {
+	CK_MECHANISM_TYPE mechanism;
+	void *pParameter;
+	CK_ULONG ulParameterLen;
+} CK_MECHANISM;
+
+typedef struct {
+	CK_MECHANISM_TYPE hashAlg;
+	CK_ULONG mgf;
+	CK_ULONG sLen;
+} CK_RSA_PKCS_PSS_PARAMS;
+
+typedef struct {
+	void *CreateMutex;
+	void *DestroyMutex;
+	void *LockMutex;
+	void *UnlockMutex;
+	CK_FLAGS flags;
+	void *pReserved;
+} CK_C_INITIALIZE_ARGS;
+
+// only the functions before C_Sign are declared, the rest aren't used
+typedef struct {
+	CK_VERSION version;
+	CK_RV (*C_Initialize)(void *);
+	CK_RV (*C_Finalize)(void *);
+	void *C_GetInfo;
+	void *C_GetFunctionList;
+	CK_RV (*C_GetSlotList)(CK_BYTE, CK_SLOT_ID *, CK_ULONG *);
+	void *C_GetSlotInfo;
+	CK_RV (*C_GetTokenInfo)(CK_SLOT_ID, CK_TOKEN_INFO *);
+	void *C_GetMechanismList;
+	void *C_GetMechanismInfo;
+	void *C_InitToken;
+	void *C_InitPIN;
+	void *C_SetPIN;
+	CK_RV (*C_OpenSession)(CK_SLOT_ID, CK_FLAGS, void *, void *, CK_SESSION_HANDLE *);
+	CK_RV (*C_CloseSession)(CK_SESSION_HANDLE);
+	void *C_CloseAllSessions;
+	void *C_GetSessionInfo;
+	void *C_GetOperationState;
+	void *C_SetOperationState;
+	CK_RV (*C_Login)(CK_SESSION_HANDLE, CK_USER_TYPE, CK_BYTE *, CK_ULONG);
+	void *C_Logout;
+	void *C_CreateObject;
+	void *C_CopyObject;
+	void *C_DestroyObject;
+	void *C_GetObjectSize;
+	CK_RV (*C_GetAttributeValue)(CK_SESSION_HANDLE, CK_OBJECT_HANDLE, CK_ATTRIBUTE *, CK_ULONG);
+	void *C_SetAttributeValue;
+	CK_RV (*C_FindObjectsInit)(CK_SESSION_HANDLE, CK_ATTRIBUTE *, CK_ULONG);
+	CK_RV (*C_FindObjects)(CK_SESSION_HANDLE, CK_OBJECT_HANDLE *, CK_ULONG, CK_ULONG *);
+	CK_RV (*C_FindObjectsFinal)(CK_SESSION_HANDLE);
+	void *C_EncryptInit;
+	void *C_Encrypt;
+	void *C_EncryptUpdate;
+	void *C_EncryptFinal;
+	void *C_DecryptInit;
+	void *C_Decrypt;
+	void *C_DecryptUpdate;
+	void *C_DecryptFinal;
+	void *C_DigestInit;
+	void *C_Digest;
+	void *C_DigestUpdate;
+	void *C_DigestKey;
+	void *C_DigestFinal;
+	CK_RV (*C_SignInit)(CK_SESSION_HANDLE, CK_MECHANISM *, CK_OBJECT_HANDLE);
+	CK_RV (*C_Sign)(CK_SESSION_HANDLE, CK_BYTE *, CK_ULONG, CK_BYTE *, CK_ULONG *);
+} CK_FUNCTION_LIST;
+
+typedef CK_RV (*CK_C_GetFunctionList)(CK_FUNCTION_LIST **);
+
+#define CKR_OK                             0x000
+#define CKR_USER_ALREADY_LOGGED_IN         0x100
+#define CKR_CRYPTOKI_ALREADY_INITIALIZED   0x191
+#define CKF_OS_LOCKING_OK                  0x002
+#define CKF_SERIAL_SESSION                 0x004
+#define CKU_USER                           1
+
+static CK_FUNCTION_LIST *p11_load(const char *path, char **err) {
+	void *handle = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (handle == NULL) {
+		*err = strdup(dlerror());
+		return NULL;
+	}
+	CK_C_GetFunctionList getFunctionList = (CK_C_GetFunctionList)dlsym(handle, "C_GetFunctionList");
+	if (getFunctionList == NULL) {
+		*err = strdup(dlerror());
+		dlclose(handle);
+		return NULL;
+	}
+	CK_FUNCTION_LIST *fl = NULL;
+	if (getFunctionList(&fl) != CKR_OK || fl == NULL) {
+		*err = strdup("C_GetFunctionList failed");
+		dlclose(handle);
+		return NULL;
+	}
+	return fl;
+}
+
+static CK_RV p11_initialize(CK_FUNCTION_LIST *fl) {
+	CK_C_INITIALIZE_ARGS args;
+	memset(&args, 0, sizeof(args));
+	args.flags = CKF_OS_LOCKING_OK;
+	CK_RV rv = fl->C_Initialize(&args);
+	if (rv == CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		return CKR_OK;
+	}
+	return rv;
+}
+
+static CK_RV p11_get_slot_list(CK_FUNCTION_LIST *fl, CK_SLOT_ID *slots, CK_ULONG *count) {
+	return fl->C_GetSlotList(1, slots, count);
+}
+
+static CK_RV p11_get_token_info(CK_FUNCTION_LIST *fl, CK_SLOT_ID slot, CK_TOKEN_INFO *info) {
+	return fl->C_GetTokenInfo(slot, info);
+}
+
+static CK_RV p11_open_session(CK_FUNCTION_LIST *fl, CK_SLOT_ID slot, CK_SESSION_HANDLE *session) {
+	return fl->C_OpenSession(slot, CKF_SERIAL_SESSION, NULL, NULL, session);
+}
+
+static CK_RV p11_close_session(CK_FUNCTION_LIST *fl, CK_SESSION_HANDLE session) {
+	return fl->C_CloseSession(session);
+}
+
+static CK_RV p11_login(CK_FUNCTION_LIST *fl, CK_SESSION_HANDLE session, CK_BYTE *pin, CK_ULONG pinLen) {
+	CK_RV rv = fl->C_Login(session, CKU_USER, pin, pinLen);
+	if (rv == CKR_USER_ALREADY_LOGGED_IN) {
+		return CKR_OK;
+	}
+	return rv;
+}
+
+static CK_RV p11_find_objects(CK_FUNCTION_LIST *fl, CK_SESSION_HANDLE session,
+	CK_ATTRIBUTE *templ, CK_ULONG templCount, CK_OBJECT_HANDLE *objects, CK_ULONG maxCount, CK_ULONG *count) {
+	CK_RV rv = fl->C_FindObjectsInit(session, templ, templCount);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	rv = fl->C_FindObjects(session, objects, maxCount, count);
+	fl->C_FindObjectsFinal(session);
+	return rv;
+}
+
+static CK_RV p11_get_attribute_value(CK_FUNCTION_LIST *fl, CK_SESSION_HANDLE session,
+	CK_OBJECT_HANDLE object, CK_ATTRIBUTE *templ, CK_ULONG count) {
+	return fl->C_GetAttributeValue(session, object, templ, count);
+}
+
+static CK_RV p11_sign(CK_FUNCTION_LIST *fl, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE key,
+	CK_MECHANISM *mechanism, CK_BYTE *data, CK_ULONG dataLen, CK_BYTE *sig, CK_ULONG *sigLen) {
+	CK_RV rv = fl->C_SignInit(session, mechanism, key);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	return fl->C_Sign(session, data, dataLen, sig, sigLen);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// PKCS #11 attribute constants.
+const (
+	ckaClass          = 0x0000
+	ckaLabel          = 0x0003
+	ckaKeyType        = 0x0100
+	ckaID             = 0x0102
+	ckaModulus        = 0x0120
+	ckaPublicExponent = 0x0122
+	ckaECParams       = 0x0180
+	ckaECPoint        = 0x0181
+
+	ckoPublicKey  = 2
+	ckoPrivateKey = 3
+
+	ckkRSA = 0x0000
+	ckkEC  = 0x0003
+)
+
+// maxPKCS11SignatureLength is large enough for RSA 8192 signatures.
+const maxPKCS11SignatureLength = 1024
+
+type pkcs11Error C.CK_RV
+
+func (err pkcs11Error) Error() string {
+	return fmt.Sprintf("kms: pkcs11 error 0x%x", uint(err))
+}
+
+func checkPKCS11(rv C.CK_RV) error {
+	if rv == C.CKR_OK {
+		return nil
+	}
+	return pkcs11Error(rv)
+}
+
+var pkcs11Modules struct {
+	sync.Mutex
+	m map[string]*C.CK_FUNCTION_LIST
+}
+
+// loadPKCS11Module loads and initializes a PKCS #11 module. Modules are only
+// loaded once, and are never unloaded.
+func loadPKCS11Module(path string) (*C.CK_FUNCTION_LIST, error) {
+	pkcs11Modules.Lock()
+	defer pkcs11Modules.Unlock()
+
+	if fl, ok := pkcs11Modules.m[path]; ok {
+		return fl, nil
+	}
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	var cerr *C.char
+	fl := C.p11_load(cpath, &cerr)
+	if fl == nil {
+		defer C.free(unsafe.Pointer(cerr))
+		return nil, fmt.Errorf("kms: error loading pkcs11 module %s: %s", path, C.GoString(cerr))
+	}
+	if err := checkPKCS11(C.p11_initialize(fl)); err != nil {
+		return nil, fmt.Errorf("kms: error initializing pkcs11 module %s: %w", path, err)
+	}
+
+	if pkcs11Modules.m == nil {
+		pkcs11Modules.m = make(map[string]*C.CK_FUNCTION_LIST)
+	}
+	pkcs11Modules.m[path] = fl
+	return fl, nil
+}
+
+func openPKCS11Key(uri *pkcs11URI) (*pkcs11Key, error) {
+	fl, err := loadPKCS11Module(uri.modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := findPKCS11Slot(fl, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var session C.CK_SESSION_HANDLE
+	if err := checkPKCS11(C.p11_open_session(fl, slot, &session)); err != nil {
+		return nil, fmt.Errorf("kms: error opening pkcs11 session: %w", err)
+	}
+	key, err := openPKCS11KeyInSession(fl, session, uri)
+	if err != nil {
+		C.p11_close_session(fl, session)
+		return nil, err
+	}
+	return key, nil
+}
+
+func openPKCS11KeyInSession(fl *C.CK_FUNCTION_LIST, session C.CK_SESSION_HANDLE, uri *pkcs11URI) (*pkcs11Key, error) {
+	if uri.pin != "" {
+		cpin := C.CBytes([]byte(uri.pin))
+		defer C.free(cpin)
+		err := checkPKCS11(C.p11_login(fl, session, (*C.CK_BYTE)(cpin), C.CK_ULONG(len(uri.pin))))
+		if err != nil {
+			return nil, fmt.Errorf("kms: error logging in to pkcs11 token: %w", err)
+		}
+	}
+
+	privateKey, err := findPKCS11Object(fl, session, ckoPrivateKey, uri)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error finding pkcs11 private key: %w", err)
+	}
+	attrs, err := getPKCS11Attributes(fl, session, privateKey, ckaKeyType)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error reading pkcs11 private key: %w", err)
+	}
+
+	// the public key is read from the public key object, since EC private keys
+	// don't have the EC point attribute
+	publicKey, err := findPKCS11Object(fl, session, ckoPublicKey, uri)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error finding pkcs11 public key: %w", err)
+	}
+
+	var pub crypto.PublicKey
+	switch keyType := bytesToCKULong(attrs[0]); keyType {
+	case ckkEC:
+		attrs, err := getPKCS11Attributes(fl, session, publicKey, ckaECParams, ckaECPoint)
+		if err != nil {
+			return nil, fmt.Errorf("kms: error reading pkcs11 public key: %w", err)
+		}
+		pub, err = parsePKCS11ECPublicKey(attrs[0], attrs[1])
+		if err != nil {
+			return nil, err
+		}
+	case ckkRSA:
+		attrs, err := getPKCS11Attributes(fl, session, publicKey, ckaModulus, ckaPublicExponent)
+		if err != nil {
+			return nil, fmt.Errorf("kms: error reading pkcs11 public key: %w", err)
+		}
+		pub, err = parsePKCS11RSAPublicKey(attrs[0], attrs[1])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("kms: unsupported pkcs11 key type: 0x%x", keyType)
+	}
+
+	// operations in a session are sequential
+	var mu sync.Mutex
+	return &pkcs11Key{
+		publicKey: pub,
+		sign: func(mechanism uint, params *pkcs11PSSParams, data []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return pkcs11Sign(fl, session, privateKey, mechanism, params, data)
+		},
+	}, nil
+}
+
+func findPKCS11Slot(fl *C.CK_FUNCTION_LIST, uri *pkcs11URI) (C.CK_SLOT_ID, error) {
+	var count C.CK_ULONG
+	if err := checkPKCS11(C.p11_get_slot_list(fl, nil, &count)); err != nil {
+		return 0, fmt.Errorf("kms: error listing pkcs11 slots: %w", err)
+	}
+	if count == 0 {
+		return 0, errors.New("kms: no pkcs11 tokens found")
+	}
+	slots := (*C.CK_SLOT_ID)(C.calloc(C.size_t(count), C.size_t(unsafe.Sizeof(C.CK_SLOT_ID(0)))))
+	defer C.free(unsafe.Pointer(slots))
+	if err := checkPKCS11(C.p11_get_slot_list(fl, slots, &count)); err != nil {
+		return 0, fmt.Errorf("kms: error listing pkcs11 slots: %w", err)
+	}
+
+	for _, slot := range unsafe.Slice(slots, int(count)) {
+		if uri.slotID != nil && uint(slot) != *uri.slotID {
+			continue
+		}
+
+		var info C.CK_TOKEN_INFO
+		if err := checkPKCS11(C.p11_get_token_info(fl, slot, &info)); err != nil {
+			return 0, fmt.Errorf("kms: error reading pkcs11 token info: %w", err)
+		}
+		label := trimPKCS11String(C.GoBytes(unsafe.Pointer(&info.label[0]), C.int(len(info.label))))
+		serial := trimPKCS11String(C.GoBytes(unsafe.Pointer(&info.serialNumber[0]), C.int(len(info.serialNumber))))
+		if (uri.token == "" || uri.token == label) && (uri.serial == "" || uri.serial == serial) {
+			return slot, nil
+		}
+	}
+	return 0, errors.New("kms: pkcs11 token not found")
+}
+
+func findPKCS11Object(fl *C.CK_FUNCTION_LIST, session C.CK_SESSION_HANDLE, class uint, uri *pkcs11URI) (C.CK_OBJECT_HANDLE, error) {
+	values := [][]byte{ckULongToBytes(class)}
+	types := []uint{ckaClass}
+	if uri.object != "" {
+		values, types = append(values, []byte(uri.object)), append(types, ckaLabel)
+	}
+	if len(uri.id) > 0 {
+		values, types = append(values, uri.id), append(types, ckaID)
+	}
+
+	templ := newPKCS11Template(types, values)
+	defer templ.free()
+
+	var objects [2]C.CK_OBJECT_HANDLE
+	var count C.CK_ULONG
+	err := checkPKCS11(C.p11_find_objects(fl, session, templ.attrs, templ.count, &objects[0], 2, &count))
+	if err != nil {
+		return 0, err
+	}
+	switch count {
+	case 0:
+		return 0, errors.New("object not found")
+	case 1:
+		return objects[0], nil
+	}
+	return 0, errors.New("multiple objects found")
+}
+
+func getPKCS11Attributes(fl *C.CK_FUNCTION_LIST, session C.CK_SESSION_HANDLE, object C.CK_OBJECT_HANDLE, types ...uint) ([][]byte, error) {
+	// the first call gets the length of each attribute
+	templ := newPKCS11Template(types, make([][]byte, len(types)))
+	defer templ.free()
+	if err := checkPKCS11(C.p11_get_attribute_value(fl, session, object, templ.attrs, templ.count)); err != nil {
+		return nil, err
+	}
+
+	lengths := make([]int, len(types))
+	for i, attr := range templ.slice() {
+		lengths[i] = int(attr.ulValueLen)
+	}
+	values := make([][]byte, len(types))
+	for i := range values {
+		values[i] = make([]byte, lengths[i])
+	}
+
+	templ2 := newPKCS11Template(types, values)
+	defer templ2.free()
+	if err := checkPKCS11(C.p11_get_attribute_value(fl, session, object, templ2.attrs, templ2.count)); err != nil {
+		return nil, err
+	}
+	for i, attr := range templ2.slice() {
+		values[i] = C.GoBytes(attr.pValue, C.int(attr.ulValueLen))
+	}
+	return values, nil
+}
+
+func pkcs11Sign(fl *C.CK_FUNCTION_LIST, session C.CK_SESSION_HANDLE, key C.CK_OBJECT_HANDLE, mechanism uint, params *pkcs11PSSParams, data []byte) ([]byte, error) {
+	mech := (*C.CK_MECHANISM)(C.calloc(1, C.size_t(unsafe.Sizeof(C.CK_MECHANISM{}))))
+	defer C.free(unsafe.Pointer(mech))
+	mech.mechanism = C.CK_MECHANISM_TYPE(mechanism)
+	if params != nil {
+		cparams := (*C.CK_RSA_PKCS_PSS_PARAMS)(C.calloc(1, C.size_t(unsafe.Sizeof(C.CK_RSA_PKCS_PSS_PARAMS{}))))
+		defer C.free(unsafe.Pointer(cparams))
+		cparams.hashAlg = C.CK_MECHANISM_TYPE(params.hashAlg)
+		cparams.mgf = C.CK_ULONG(params.mgf)
+		cparams.sLen = C.CK_ULONG(params.sLen)
+		mech.pParameter = unsafe.Pointer(cparams)
+		mech.ulParameterLen = C.CK_ULONG(unsafe.Sizeof(*cparams))
+	}
+
+	cdata := C.CBytes(data)
+	defer C.free(cdata)
+	sig := C.malloc(maxPKCS11SignatureLength)
+	defer C.free(sig)
+	sigLen := C.CK_ULONG(maxPKCS11SignatureLength)
+
+	err := checkPKCS11(C.p11_sign(fl, session, key, mech,
+		(*C.CK_BYTE)(cdata), C.CK_ULONG(len(data)), (*C.CK_BYTE)(sig), &sigLen))
+	if err != nil {
+		return nil, fmt.Errorf("kms: error signing with pkcs11 key: %w", err)
+	}
+	return C.GoBytes(sig, C.int(sigLen)), nil
+}
+
+// pkcs11Template is an attribute template allocated in C memory, since cgo
+// doesn't allow passing Go pointers stored in Go memory to C.
+type pkcs11Template struct {
+	attrs *C.CK_ATTRIBUTE
+	count C.CK_ULONG
+}
+
+func newPKCS11Template(types []uint, values [][]byte) *pkcs11Template {
+	templ := &pkcs11Template{
+		attrs: (*C.CK_ATTRIBUTE)(C.calloc(C.size_t(len(types)), C.size_t(unsafe.Sizeof(C.CK_ATTRIBUTE{})))),
+		count: C.CK_ULONG(len(types)),
+	}
+	attrs := templ.slice()
+	for i := range attrs {
+		attrs[i]._type = C.CK_ATTRIBUTE_TYPE(types[i])
+		// a nil value is used to get the length of the attribute
+		if values[i] != nil {
+			attrs[i].pValue = C.CBytes(values[i])
+			attrs[i].ulValueLen = C.CK_ULONG(len(values[i]))
+		}
+	}
+	return templ
+}
+
+func (templ *pkcs11Template) slice() []C.CK_ATTRIBUTE {
+	return unsafe.Slice(templ.attrs, int(templ.count))
+}
+
+func (templ *pkcs11Template) free() {
+	for _, attr := range templ.slice() {
+		C.free(attr.pValue)
+	}
+	C.free(unsafe.Pointer(templ.attrs))
+}
+
+func ckULongToBytes(v uint) []byte {
+	n := C.CK_ULONG(v)
+	return C.GoBytes(unsafe.Pointer(&n), C.int(unsafe.Sizeof(n)))
+}
+
+func bytesToCKULong(b []byte) uint {
+	var n C.CK_ULONG
+	if len(b) != int(unsafe.Sizeof(n)) {
+		return ^uint(0)
+	}
+	C.memcpy(unsafe.Pointer(&n), unsafe.Pointer(&b[0]), C.size_t(len(b)))
+	return uint(n)
+}
+
+// trimPKCS11String trims the padding of a fixed length PKCS #11 string.
+func trimPKCS11String(b []byte) string {
+	return string(bytes.TrimRight(b, " \x00"))
+}
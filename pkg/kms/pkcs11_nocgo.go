@@ -0,0 +1,9 @@
+//go:build !cgo || !(linux || darwin)
+
+package kms
+
+import "errors"
+
+func openPKCS11Key(_ *pkcs11URI) (*pkcs11Key, error) {
+	return nil, errors.New("kms: pkcs11 requires a build with cgo enabled on linux or darwin")
+}
@@ -0,0 +1,173 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	t.Parallel()
+
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	require.NoError(t, os.WriteFile(pinFile, []byte("5678\n"), 0o600))
+
+	slotID := uint(3)
+	for _, tc := range []struct {
+		name   string
+		uri    string
+		expect *pkcs11URI
+		err    string
+	}{
+		{
+			"token and object",
+			"pkcs11:token=pomerium;object=signing%20key?module-path=/lib/p11.so&pin-value=1234",
+			&pkcs11URI{token: "pomerium", object: "signing key", modulePath: "/lib/p11.so", pin: "1234"},
+			"",
+		},
+		{
+			"slot and id",
+			"pkcs11:slot-id=3;id=%01%02;type=private?module-path=/lib/p11.so&pin-source=file:" + pinFile,
+			&pkcs11URI{slotID: &slotID, id: []byte{1, 2}, modulePath: "/lib/p11.so", pin: "5678"},
+			"",
+		},
+		{"missing module", "pkcs11:object=key", nil, "kms: pkcs11 uri module-path is required"},
+		{"missing object", "pkcs11:token=pomerium?module-path=/lib/p11.so", nil, "kms: pkcs11 uri object or id is required"},
+		{"public key", "pkcs11:object=key;type=public?module-path=/lib/p11.so", nil, "kms: unsupported pkcs11 object type: public"},
+		{"invalid slot", "pkcs11:object=key;slot-id=x?module-path=/lib/p11.so", nil, "kms: invalid pkcs11 uri slot-id"},
+		{"invalid scheme", "file:///key.pem", nil, "kms: invalid pkcs11 uri"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			uri, err := parsePKCS11URI(tc.uri)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, uri)
+		})
+	}
+}
+
+func TestPKCS11KeySign(t *testing.T) {
+	t.Parallel()
+
+	digest := sha256.Sum256([]byte("payload"))
+
+	t.Run("ecdsa", func(t *testing.T) {
+		t.Parallel()
+
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		key := &pkcs11Key{
+			publicKey: &privateKey.PublicKey,
+			sign: func(mechanism uint, _ *pkcs11PSSParams, data []byte) ([]byte, error) {
+				assert.Equal(t, uint(ckmECDSA), mechanism)
+				r, s, err := ecdsa.Sign(rand.Reader, privateKey, data)
+				if err != nil {
+					return nil, err
+				}
+				raw := make([]byte, 64)
+				r.FillBytes(raw[:32])
+				s.FillBytes(raw[32:])
+				return raw, nil
+			},
+		}
+
+		sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		assert.True(t, ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], sig))
+	})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key := &pkcs11Key{
+		publicKey: &privateKey.PublicKey,
+		sign: func(mechanism uint, params *pkcs11PSSParams, data []byte) ([]byte, error) {
+			switch mechanism {
+			case ckmRSAPKCS:
+				return rsa.SignPKCS1v15(rand.Reader, privateKey, 0, data)
+			case ckmRSAPKCSPSS:
+				if params.hashAlg != ckmSHA256 || params.mgf != ckgMGF1SHA256 {
+					return nil, errors.New("unexpected pss params")
+				}
+				return rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, data, &rsa.PSSOptions{
+					SaltLength: int(params.sLen),
+				})
+			}
+			return nil, errors.New("unexpected mechanism")
+		},
+	}
+
+	t.Run("rsa pkcs1v15", func(t *testing.T) {
+		t.Parallel()
+
+		sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		assert.NoError(t, rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], sig))
+	})
+	t.Run("rsa pss", func(t *testing.T) {
+		t.Parallel()
+
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		sig, err := key.Sign(rand.Reader, digest[:], opts)
+		require.NoError(t, err)
+		assert.NoError(t, rsa.VerifyPSS(&privateKey.PublicKey, crypto.SHA256, digest[:], sig, opts))
+	})
+	t.Run("invalid digest", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := key.Sign(rand.Reader, digest[:16], crypto.SHA256)
+		assert.Error(t, err)
+	})
+}
+
+func TestParsePKCS11PublicKey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ec", func(t *testing.T) {
+		t.Parallel()
+
+		privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.NoError(t, err)
+		ecParams, err := asn1.Marshal(oidNamedCurveP384)
+		require.NoError(t, err)
+		point := elliptic.Marshal(privateKey.Curve, privateKey.X, privateKey.Y) //nolint:staticcheck
+		ecPoint, err := asn1.Marshal(point)
+		require.NoError(t, err)
+
+		publicKey, err := parsePKCS11ECPublicKey(ecParams, ecPoint)
+		require.NoError(t, err)
+		assert.True(t, privateKey.PublicKey.Equal(publicKey))
+
+		publicKey, err = parsePKCS11ECPublicKey(ecParams, point)
+		require.NoError(t, err, "should accept raw points")
+		assert.True(t, privateKey.PublicKey.Equal(publicKey))
+
+		_, err = parsePKCS11ECPublicKey(ecParams, []byte{1, 2, 3})
+		assert.Error(t, err)
+	})
+	t.Run("rsa", func(t *testing.T) {
+		t.Parallel()
+
+		privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+		publicKey, err := parsePKCS11RSAPublicKey(privateKey.N.Bytes(), []byte{0x01, 0x00, 0x01})
+		require.NoError(t, err)
+		assert.True(t, privateKey.PublicKey.Equal(publicKey))
+	})
+}
@@ -0,0 +1,163 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultVaultAddress = "https://127.0.0.1:8200"
+
+type vaultClient struct {
+	httpClient *http.Client
+	address    string
+	token      string
+	namespace  string
+	mount      string
+}
+
+func newVaultSignerFromURL(ctx context.Context, rest string) (Signer, error) {
+	name, mount, err := parseVaultKey(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &vaultClient{
+		httpClient: &http.Client{Timeout: requestTimeout},
+		address:    os.Getenv("VAULT_ADDR"),
+		token:      os.Getenv("VAULT_TOKEN"),
+		namespace:  os.Getenv("VAULT_NAMESPACE"),
+		mount:      mount,
+	}
+	if client.address == "" {
+		client.address = defaultVaultAddress
+	}
+	if client.token == "" {
+		return nil, errors.New("kms: VAULT_TOKEN is required")
+	}
+
+	return newVaultSigner(ctx, client, name)
+}
+
+func newVaultSigner(ctx context.Context, client *vaultClient, name string) (Signer, error) {
+	var readKeyResponse struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	err := client.call(ctx, http.MethodGet, "keys/"+name, nil, &readKeyResponse)
+	if err != nil {
+		return nil, fmt.Errorf("kms: error retrieving vault transit public key: %w", err)
+	}
+
+	// the key version is pinned, so rotating the key in vault doesn't change
+	// the key used to sign JWTs until the public key is retrieved again
+	keyVersion := readKeyResponse.Data.LatestVersion
+	key, ok := readKeyResponse.Data.Keys[strconv.Itoa(keyVersion)]
+	if !ok || key.PublicKey == "" {
+		return nil, fmt.Errorf("kms: vault transit key %s is not an asymmetric key", name)
+	}
+
+	publicKey, err := parsePublicKeyPEM([]byte(key.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigner(publicKey, func(ctx context.Context, digest []byte) ([]byte, error) {
+		var signResponse struct {
+			Data struct {
+				Signature string `json:"signature"`
+			} `json:"data"`
+		}
+		err := client.call(ctx, http.MethodPost, "sign/"+name, map[string]any{
+			"input":               base64.StdEncoding.EncodeToString(digest),
+			"prehashed":           true,
+			"hash_algorithm":      "sha2-256",
+			"key_version":         keyVersion,
+			"signature_algorithm": "pkcs1v15",
+		}, &signResponse)
+		if err != nil {
+			return nil, fmt.Errorf("kms: error signing with vault transit: %w", err)
+		}
+
+		// signatures are formatted as vault:v<key version>:<base64 signature>
+		parts := strings.SplitN(signResponse.Data.Signature, ":", 3)
+		if len(parts) != 3 {
+			return nil, errors.New("kms: invalid vault transit signature")
+		}
+		sig, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("kms: invalid vault transit signature: %w", err)
+		}
+		return normalizeSignature(publicKey, sig)
+	})
+}
+
+func (client *vaultClient) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+
+	u := strings.TrimSuffix(client.address, "/") + "/v1/" + client.mount + "/" + path
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", client.token)
+	if client.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", client.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(res, resBody); err != nil {
+		return err
+	}
+	return json.Unmarshal(resBody, out)
+}
+
+func parseVaultKey(rest string) (name, mount string, err error) {
+	rawName, rawQuery, _ := strings.Cut(rest, "?")
+	name = strings.Trim(rawName, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", errors.New("kms: vault transit key name is required")
+	}
+
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", "", fmt.Errorf("kms: invalid vault transit url: %w", err)
+	}
+	mount = strings.Trim(q.Get("mount"), "/")
+	if mount == "" {
+		mount = "transit"
+	}
+	return name, mount, nil
+}
@@ -0,0 +1,228 @@
+// Package cedar contains a parser and evaluator for a subset of the Cedar
+// policy language.
+//
+// A policy set contains zero or more permit and forbid policies. Each policy
+// has a scope which constrains the principal, action and resource of a
+// request, and zero or more when and unless conditions:
+//
+//	@id("admins")
+//	permit (
+//	  principal in Group::"admins",
+//	  action in [Action::"GET", Action::"HEAD"],
+//	  resource
+//	)
+//	when { context.http.path like "/admin/*" }
+//	unless { principal.email like "*@contractor.example.com" };
+//
+// A request is allowed if at least one permit policy is satisfied and no
+// forbid policy is. Policies which fail to evaluate, for example because they
+// access an attribute which doesn't exist, are skipped.
+//
+// The supported expressions are boolean, long, string, entity, set and record
+// literals, the principal, action, resource and context variables, the
+// &&, ||, !, ==, !=, <, <=, >, >=, +, -, *, in, has, like and is operators,
+// if-then-else, attribute access, the contains, containsAll, containsAny and
+// isEmpty set methods, and the ip extension function with the isIpv4,
+// isIpv6, isLoopback, isMulticast and isInRange methods. Templates, schemas
+// and the decimal extension aren't supported.
+package cedar
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Value is a Cedar value.
+type Value interface {
+	fmt.Stringer
+	cedarValue()
+}
+
+type (
+	// Bool is a Cedar boolean.
+	Bool bool
+	// Long is a Cedar long.
+	Long int64
+	// String is a Cedar string.
+	String string
+	// A Set is a Cedar set. Duplicate elements are ignored.
+	Set []Value
+	// A Record is a Cedar record.
+	Record map[string]Value
+	// IPAddr is a Cedar ip address or range.
+	IPAddr netip.Prefix
+)
+
+// An EntityUID identifies an entity by its type and id.
+type EntityUID struct {
+	Type string
+	ID   string
+}
+
+// NewEntityUID creates a new EntityUID.
+func NewEntityUID(typ, id string) EntityUID {
+	return EntityUID{Type: typ, ID: id}
+}
+
+func (Bool) cedarValue()      {}
+func (Long) cedarValue()      {}
+func (String) cedarValue()    {}
+func (Set) cedarValue()       {}
+func (Record) cedarValue()    {}
+func (IPAddr) cedarValue()    {}
+func (EntityUID) cedarValue() {}
+
+func (v Bool) String() string { return strconv.FormatBool(bool(v)) }
+func (v Long) String() string { return strconv.FormatInt(int64(v), 10) }
+
+func (v String) String() string { return strconv.Quote(string(v)) }
+
+func (v Set) String() string {
+	strs := make([]string, 0, len(v))
+	for _, e := range v {
+		strs = append(strs, e.String())
+	}
+	return "[" + strings.Join(strs, ", ") + "]"
+}
+
+func (v Record) String() string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	strs := make([]string, 0, len(v))
+	for _, k := range keys {
+		strs = append(strs, strconv.Quote(k)+": "+v[k].String())
+	}
+	return "{" + strings.Join(strs, ", ") + "}"
+}
+
+func (v IPAddr) String() string {
+	p := netip.Prefix(v)
+	if p.Bits() == p.Addr().BitLen() {
+		return `ip("` + p.Addr().String() + `")`
+	}
+	return `ip("` + p.String() + `")`
+}
+
+func (v EntityUID) String() string { return v.Type + "::" + strconv.Quote(v.ID) }
+
+// An Entity is a principal, action or resource, with attributes and parent
+// entities.
+type Entity struct {
+	UID        EntityUID
+	Attributes Record
+	Parents    []EntityUID
+}
+
+// Entities are the entities available to policies, by their uid.
+type Entities map[EntityUID]*Entity
+
+// Add adds an entity.
+func (entities Entities) Add(entity *Entity) {
+	entities[entity.UID] = entity
+}
+
+// in returns true if the entity is the ancestor, or if the ancestor is one
+// of the entity's parents, transitively.
+func (entities Entities) in(uid, ancestor EntityUID) bool {
+	seen := map[EntityUID]bool{}
+	todo := []EntityUID{uid}
+	for len(todo) > 0 {
+		cur := todo[0]
+		todo = todo[1:]
+		if cur == ancestor {
+			return true
+		}
+		if seen[cur] {
+			continue
+		}
+		seen[cur] = true
+		if entity, ok := entities[cur]; ok {
+			todo = append(todo, entity.Parents...)
+		}
+	}
+	return false
+}
+
+// A Request is an authorization request.
+type Request struct {
+	Principal EntityUID
+	Action    EntityUID
+	Resource  EntityUID
+	Context   Record
+}
+
+// A Decision is the result of authorizing a request.
+type Decision struct {
+	Allow bool
+	// Permits and Forbids are the ids of the satisfied permit and forbid
+	// policies.
+	Permits, Forbids []string
+	// Errors are the errors of the policies which were skipped.
+	Errors []error
+}
+
+// IsAuthorized authorizes the request with the policies.
+func (ps PolicySet) IsAuthorized(entities Entities, req Request) Decision {
+	var d Decision
+	for _, p := range ps {
+		ok, err := p.evaluate(entities, req)
+		if err != nil {
+			d.Errors = append(d.Errors, fmt.Errorf("cedar: policy %s: %w", p.ID, err))
+			continue
+		} else if !ok {
+			continue
+		}
+
+		if p.Effect == Forbid {
+			d.Forbids = append(d.Forbids, p.ID)
+		} else {
+			d.Permits = append(d.Permits, p.ID)
+		}
+	}
+	d.Allow = len(d.Permits) > 0 && len(d.Forbids) == 0
+	return d
+}
+
+// ValueFromInterface converts a JSON-like value, as returned by
+// encoding/json, into a Cedar value. Nulls, and numbers which aren't
+// integers, aren't converted.
+func ValueFromInterface(v interface{}) (Value, bool) {
+	switch t := v.(type) {
+	case bool:
+		return Bool(t), true
+	case string:
+		return String(t), true
+	case float64:
+		if t != float64(int64(t)) {
+			return nil, false
+		}
+		return Long(int64(t)), true
+	case int:
+		return Long(int64(t)), true
+	case int64:
+		return Long(t), true
+	case []interface{}:
+		set := make(Set, 0, len(t))
+		for _, e := range t {
+			if ev, ok := ValueFromInterface(e); ok {
+				set = append(set, ev)
+			}
+		}
+		return set, true
+	case map[string]interface{}:
+		record := make(Record, len(t))
+		for k, e := range t {
+			if ev, ok := ValueFromInterface(e); ok {
+				record[k] = ev
+			}
+		}
+		return record, true
+	}
+	return nil, false
+}
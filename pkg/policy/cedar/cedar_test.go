@@ -0,0 +1,138 @@
+package cedar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	ps, err := Parse(`
+// admins may do anything
+@id("admins")
+permit (principal in Group::"admins", action, resource);
+
+permit (
+  principal is User,
+  action in [Action::"GET", Action::"HEAD"],
+  resource == Route::"https://a.example.com"
+) when { context.http.path like "/public/*" };
+
+forbid (principal, action, resource)
+unless { context.is_valid_client_certificate };
+`)
+	require.NoError(t, err)
+	require.Len(t, ps, 3)
+	assert.Equal(t, "admins", ps[0].ID)
+	assert.Equal(t, Permit, ps[0].Effect)
+	assert.Equal(t, "policy1", ps[1].ID)
+	assert.Equal(t, "policy2", ps[2].ID)
+	assert.Equal(t, Forbid, ps[2].Effect)
+
+	for _, src := range []string{
+		`permit (principal, action, resource)`,
+		`allow (principal, action, resource);`,
+		`permit (principal, action);`,
+		`permit (principal == "u1", action, resource);`,
+		`permit (principal, action, resource) when { context.a == };`,
+		`permit (principal, action, resource) when { unknown("x") };`,
+		`permit (principal, action, resource) when { "\q" == "" };`,
+		`@id("a") permit (principal, action, resource); @id("a") forbid (principal, action, resource);`,
+	} {
+		_, err := Parse(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestIsAuthorized(t *testing.T) {
+	t.Parallel()
+
+	u1 := NewEntityUID("User", "u1")
+	u2 := NewEntityUID("User", "u2")
+	admins := NewEntityUID("Group", "admins")
+	staff := NewEntityUID("Group", "staff")
+	entities := Entities{}
+	entities.Add(&Entity{
+		UID:        u1,
+		Attributes: Record{"email": String("u1@example.com"), "level": Long(3), "tags": Set{String("a"), String("b")}},
+		Parents:    []EntityUID{admins},
+	})
+	entities.Add(&Entity{
+		UID:        u2,
+		Attributes: Record{"email": String("u2@contractor.example.com"), "level": Long(1)},
+	})
+	entities.Add(&Entity{UID: admins, Parents: []EntityUID{staff}})
+
+	request := func(principal EntityUID, method, path, ip string) Request {
+		return Request{
+			Principal: principal,
+			Action:    NewEntityUID("Action", method),
+			Resource:  NewEntityUID("Route", "https://a.example.com"),
+			Context: Record{
+				"http": Record{"method": String(method), "path": String(path), "ip": String(ip)},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		policy string
+		req    Request
+		allow  bool
+		errors int
+	}{
+		{"empty", ``, request(u1, "GET", "/", ""), false, 0},
+		{"permit all", `permit (principal, action, resource);`, request(u1, "GET", "/", ""), true, 0},
+		{"principal ==", `permit (principal == User::"u1", action, resource);`, request(u2, "GET", "/", ""), false, 0},
+		{"principal in transitive", `permit (principal in Group::"staff", action, resource);`, request(u1, "GET", "/", ""), true, 0},
+		{"principal is in", `permit (principal is User in Group::"admins", action, resource);`, request(u2, "GET", "/", ""), false, 0},
+		{"action in set", `permit (principal, action in [Action::"GET", Action::"HEAD"], resource);`, request(u1, "POST", "/", ""), false, 0},
+		{"resource ==", `permit (principal, action, resource == Route::"https://a.example.com");`, request(u1, "GET", "/", ""), true, 0},
+		{"forbid wins", `permit (principal, action, resource); forbid (principal == User::"u1", action, resource);`, request(u1, "GET", "/", ""), false, 0},
+		{"when", `permit (principal, action, resource) when { principal.email like "*@example.com" };`, request(u2, "GET", "/", ""), false, 0},
+		{"unless", `permit (principal, action, resource) unless { principal.email like "*@contractor.example.com" };`, request(u1, "GET", "/", ""), true, 0},
+		{"like escape", `permit (principal, action, resource) when { "a*c" like "a\*c" && !("abc" like "a\*c") };`, request(u1, "GET", "/", ""), true, 0},
+		{"has", `permit (principal, action, resource) when { principal has tags && !(principal has missing) && context has "http" };`, request(u1, "GET", "/", ""), true, 0},
+		{"missing attribute", `permit (principal, action, resource) when { principal.tags.contains("a") };`, request(u2, "GET", "/", ""), false, 1},
+		{"type error", `permit (principal, action, resource) when { principal.level };`, request(u1, "GET", "/", ""), false, 1},
+		{"arithmetic", `permit (principal, action, resource) when { principal.level * 2 - 1 >= 5 && -principal.level < 0 };`, request(u1, "GET", "/", ""), true, 0},
+		{"overflow", `permit (principal, action, resource) when { 9223372036854775807 + 1 > 0 };`, request(u1, "GET", "/", ""), false, 1},
+		{"sets", `permit (principal, action, resource) when { principal.tags.containsAll(["a"]) && principal.tags.containsAny(["c", "b"]) && !principal.tags.isEmpty() && [1, 2] == [2, 1, 1] };`, request(u1, "GET", "/", ""), true, 0},
+		{"records", `permit (principal, action, resource) when { {a: 1, "b": [true]} == {b: [true], a: 1} && context.http["path"] == "/" };`, request(u1, "GET", "/", ""), true, 0},
+		{"if", `permit (principal, action, resource) when { if context.http.method == "GET" then true else principal in Group::"admins" };`, request(u2, "POST", "/", ""), false, 0},
+		{"in operator", `permit (principal, action, resource) when { principal in [Group::"x", Group::"staff"] && principal is User };`, request(u1, "GET", "/", ""), true, 0},
+		{"ip", `permit (principal, action, resource) when { ip(context.http.ip).isInRange(ip("10.0.0.0/8")) && ip(context.http.ip).isIpv4() };`, request(u1, "GET", "/", "10.1.2.3"), true, 0},
+		{"ip outside range", `permit (principal, action, resource) when { ip(context.http.ip).isInRange(ip("10.0.0.0/8")) };`, request(u1, "GET", "/", "192.168.0.1"), false, 0},
+		{"invalid ip", `permit (principal, action, resource) when { ip(context.http.ip).isLoopback() };`, request(u1, "GET", "/", "x"), false, 1},
+		{"erroring policy is skipped", `permit (principal, action, resource); forbid (principal, action, resource) when { principal.missing };`, request(u1, "GET", "/", ""), true, 1},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps, err := Parse(tc.policy)
+			require.NoError(t, err)
+			d := ps.IsAuthorized(entities, tc.req)
+			assert.Equal(t, tc.allow, d.Allow)
+			assert.Len(t, d.Errors, tc.errors)
+		})
+	}
+}
+
+func TestValueFromInterface(t *testing.T) {
+	t.Parallel()
+
+	v, ok := ValueFromInterface(map[string]interface{}{
+		"a": "x",
+		"b": []interface{}{true, float64(1), 1.5, nil},
+		"c": nil,
+	})
+	assert.True(t, ok)
+	assert.Equal(t, Record{"a": String("x"), "b": Set{Bool(true), Long(1)}}, v)
+
+	_, ok = ValueFromInterface(nil)
+	assert.False(t, ok)
+}
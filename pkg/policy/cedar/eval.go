@@ -0,0 +1,617 @@
+package cedar
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+)
+
+type evalContext struct {
+	entities Entities
+	request  Request
+}
+
+type expr interface {
+	eval(ctx *evalContext) (Value, error)
+}
+
+// evaluate returns true if the request satisfies the policy's scope and
+// conditions.
+func (policy *Policy) evaluate(entities Entities, req Request) (bool, error) {
+	ctx := &evalContext{entities: entities, request: req}
+	if !policy.principal.matches(entities, req.Principal) ||
+		!policy.action.matches(entities, req.Action) ||
+		!policy.resource.matches(entities, req.Resource) {
+		return false, nil
+	}
+
+	for _, c := range policy.conditions {
+		v, err := evalBool(ctx, c.expr)
+		if err != nil {
+			return false, err
+		}
+		if v == c.unless {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c scopeConstraint) matches(entities Entities, uid EntityUID) bool {
+	switch c.op {
+	case "==":
+		return uid == c.entities[0]
+	case "in":
+		for _, e := range c.entities {
+			if entities.in(uid, e) {
+				return true
+			}
+		}
+		return false
+	case "is":
+		return uid.Type == c.typ && (len(c.entities) == 0 || entities.in(uid, c.entities[0]))
+	}
+	return true
+}
+
+func typeError(expected string, v Value) error {
+	return fmt.Errorf("expected %s, got %s", expected, typeName(v))
+}
+
+func typeName(v Value) string {
+	switch v.(type) {
+	case Bool:
+		return "bool"
+	case Long:
+		return "long"
+	case String:
+		return "string"
+	case Set:
+		return "set"
+	case Record:
+		return "record"
+	case IPAddr:
+		return "ipaddr"
+	case EntityUID:
+		return "entity"
+	}
+	return "unknown"
+}
+
+func evalBool(ctx *evalContext, e expr) (bool, error) {
+	v, err := e.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(Bool)
+	if !ok {
+		return false, typeError("bool", v)
+	}
+	return bool(b), nil
+}
+
+func evalLong(ctx *evalContext, e expr) (Long, error) {
+	v, err := e.eval(ctx)
+	if err != nil {
+		return 0, err
+	}
+	l, ok := v.(Long)
+	if !ok {
+		return 0, typeError("long", v)
+	}
+	return l, nil
+}
+
+type literalExpr struct {
+	value Value
+}
+
+func (e literalExpr) eval(_ *evalContext) (Value, error) {
+	return e.value, nil
+}
+
+type variableExpr struct {
+	name string
+}
+
+func (e variableExpr) eval(ctx *evalContext) (Value, error) {
+	switch e.name {
+	case "principal":
+		return ctx.request.Principal, nil
+	case "action":
+		return ctx.request.Action, nil
+	case "resource":
+		return ctx.request.Resource, nil
+	}
+	if ctx.request.Context == nil {
+		return Record{}, nil
+	}
+	return ctx.request.Context, nil
+}
+
+type ifExpr struct {
+	cond, then, els expr
+}
+
+func (e ifExpr) eval(ctx *evalContext) (Value, error) {
+	cond, err := evalBool(ctx, e.cond)
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return e.then.eval(ctx)
+	}
+	return e.els.eval(ctx)
+}
+
+type orExpr struct {
+	left, right expr
+}
+
+func (e orExpr) eval(ctx *evalContext) (Value, error) {
+	left, err := evalBool(ctx, e.left)
+	if err != nil || left {
+		return Bool(left), err
+	}
+	right, err := evalBool(ctx, e.right)
+	return Bool(right), err
+}
+
+type andExpr struct {
+	left, right expr
+}
+
+func (e andExpr) eval(ctx *evalContext) (Value, error) {
+	left, err := evalBool(ctx, e.left)
+	if err != nil || !left {
+		return Bool(left), err
+	}
+	right, err := evalBool(ctx, e.right)
+	return Bool(right), err
+}
+
+type notExpr struct {
+	expr expr
+}
+
+func (e notExpr) eval(ctx *evalContext) (Value, error) {
+	v, err := evalBool(ctx, e.expr)
+	return Bool(!v), err
+}
+
+type negExpr struct {
+	expr expr
+}
+
+func (e negExpr) eval(ctx *evalContext) (Value, error) {
+	v, err := evalLong(ctx, e.expr)
+	if err != nil {
+		return nil, err
+	}
+	if v == math.MinInt64 {
+		return nil, errOverflow
+	}
+	return -v, nil
+}
+
+var errOverflow = errors.New("integer overflow")
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e binaryExpr) eval(ctx *evalContext) (Value, error) {
+	switch e.op {
+	case "==", "!=":
+		left, err := e.left.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return Bool(equal(left, right) == (e.op == "==")), nil
+	case "in":
+		left, err := e.left.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		uid, ok := left.(EntityUID)
+		if !ok {
+			return nil, typeError("entity", left)
+		}
+		right, err := e.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return evalIn(ctx.entities, uid, right)
+	}
+
+	left, err := evalLong(ctx, e.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalLong(ctx, e.right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "<":
+		return Bool(left < right), nil
+	case "<=":
+		return Bool(left <= right), nil
+	case ">":
+		return Bool(left > right), nil
+	case ">=":
+		return Bool(left >= right), nil
+	case "+":
+		sum := left + right
+		if (right > 0 && sum < left) || (right < 0 && sum > left) {
+			return nil, errOverflow
+		}
+		return sum, nil
+	case "-":
+		diff := left - right
+		if (right > 0 && diff > left) || (right < 0 && diff < left) {
+			return nil, errOverflow
+		}
+		return diff, nil
+	case "*":
+		if left == 0 || right == 0 {
+			return Long(0), nil
+		}
+		product := left * right
+		if product/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+			return nil, errOverflow
+		}
+		return product, nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s", e.op)
+}
+
+func evalIn(entities Entities, uid EntityUID, v Value) (Value, error) {
+	switch t := v.(type) {
+	case EntityUID:
+		return Bool(entities.in(uid, t)), nil
+	case Set:
+		for _, e := range t {
+			ancestor, ok := e.(EntityUID)
+			if !ok {
+				return nil, typeError("entity", e)
+			}
+			if entities.in(uid, ancestor) {
+				return Bool(true), nil
+			}
+		}
+		return Bool(false), nil
+	}
+	return nil, typeError("entity or set", v)
+}
+
+type hasExpr struct {
+	expr expr
+	attr string
+}
+
+func (e hasExpr) eval(ctx *evalContext) (Value, error) {
+	v, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch t := v.(type) {
+	case Record:
+		_, ok := t[e.attr]
+		return Bool(ok), nil
+	case EntityUID:
+		entity, ok := ctx.entities[t]
+		if !ok {
+			return Bool(false), nil
+		}
+		_, ok = entity.Attributes[e.attr]
+		return Bool(ok), nil
+	}
+	return nil, typeError("entity or record", v)
+}
+
+type accessExpr struct {
+	expr expr
+	attr string
+}
+
+func (e accessExpr) eval(ctx *evalContext) (Value, error) {
+	v, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var attributes Record
+	switch t := v.(type) {
+	case Record:
+		attributes = t
+	case EntityUID:
+		entity, ok := ctx.entities[t]
+		if !ok {
+			return nil, fmt.Errorf("entity %s does not exist", t)
+		}
+		attributes = entity.Attributes
+	default:
+		return nil, typeError("entity or record", v)
+	}
+	attr, ok := attributes[e.attr]
+	if !ok {
+		return nil, fmt.Errorf("%s does not have the attribute %q", v, e.attr)
+	}
+	return attr, nil
+}
+
+type likeExpr struct {
+	expr    expr
+	pattern []patternElement
+}
+
+func (e likeExpr) eval(ctx *evalContext) (Value, error) {
+	v, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(String)
+	if !ok {
+		return nil, typeError("string", v)
+	}
+	return Bool(matchPattern(string(s), e.pattern)), nil
+}
+
+func matchPattern(s string, pattern []patternElement) bool {
+	if len(pattern) == 0 {
+		return s == ""
+	}
+	if !pattern[0].wildcard {
+		return strings.HasPrefix(s, pattern[0].literal) &&
+			matchPattern(s[len(pattern[0].literal):], pattern[1:])
+	}
+	for i := 0; i <= len(s); i++ {
+		if matchPattern(s[i:], pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+type isExpr struct {
+	expr expr
+	typ  string
+	in   expr
+}
+
+func (e isExpr) eval(ctx *evalContext) (Value, error) {
+	v, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uid, ok := v.(EntityUID)
+	if !ok {
+		return nil, typeError("entity", v)
+	}
+	if uid.Type != e.typ || e.in == nil {
+		return Bool(uid.Type == e.typ), nil
+	}
+	in, err := e.in.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return evalIn(ctx.entities, uid, in)
+}
+
+type setExpr struct {
+	elements []expr
+}
+
+func (e setExpr) eval(ctx *evalContext) (Value, error) {
+	set := make(Set, 0, len(e.elements))
+	for _, element := range e.elements {
+		v, err := element.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, v)
+	}
+	return set, nil
+}
+
+type recordExpr struct {
+	keys   []string
+	values []expr
+}
+
+func (e recordExpr) eval(ctx *evalContext) (Value, error) {
+	record := make(Record, len(e.keys))
+	for i, key := range e.keys {
+		v, err := e.values[i].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		record[key] = v
+	}
+	return record, nil
+}
+
+type callExpr struct {
+	name     string
+	receiver expr
+	args     []expr
+}
+
+func (e callExpr) eval(ctx *evalContext) (Value, error) {
+	receiver, err := e.receiver.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]Value, 0, len(e.args))
+	for _, arg := range e.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	switch t := receiver.(type) {
+	case Set:
+		return callSetMethod(t, e.name, args)
+	case IPAddr:
+		return callIPAddrMethod(t, e.name, args)
+	}
+	return nil, fmt.Errorf("unknown method %s of %s", e.name, typeName(receiver))
+}
+
+func callSetMethod(set Set, name string, args []Value) (Value, error) {
+	if name == "isEmpty" {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("isEmpty expects no arguments")
+		}
+		return Bool(len(set) == 0), nil
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s expects one argument", name)
+	}
+
+	switch name {
+	case "contains":
+		return Bool(set.contains(args[0])), nil
+	case "containsAll", "containsAny":
+		other, ok := args[0].(Set)
+		if !ok {
+			return nil, typeError("set", args[0])
+		}
+		for _, v := range other {
+			if set.contains(v) != (name == "containsAll") {
+				return Bool(name == "containsAny"), nil
+			}
+		}
+		return Bool(name == "containsAll"), nil
+	}
+	return nil, fmt.Errorf("unknown method %s of set", name)
+}
+
+func callIPAddrMethod(ip IPAddr, name string, args []Value) (Value, error) {
+	p := netip.Prefix(ip)
+	if name == "isInRange" {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("isInRange expects one argument")
+		}
+		r, ok := args[0].(IPAddr)
+		if !ok {
+			return nil, typeError("ipaddr", args[0])
+		}
+		rp := netip.Prefix(r)
+		return Bool(rp.Contains(p.Addr()) && p.Bits() >= rp.Bits()), nil
+	}
+	if len(args) != 0 {
+		return nil, fmt.Errorf("%s expects no arguments", name)
+	}
+
+	switch name {
+	case "isIpv4":
+		return Bool(p.Addr().Is4()), nil
+	case "isIpv6":
+		return Bool(p.Addr().Is6()), nil
+	case "isLoopback":
+		return Bool(p.Addr().IsLoopback()), nil
+	case "isMulticast":
+		return Bool(p.Addr().IsMulticast()), nil
+	}
+	return nil, fmt.Errorf("unknown method %s of ipaddr", name)
+}
+
+type extensionCallExpr struct {
+	name string
+	args []expr
+}
+
+// extensionFunctions are the supported extension functions.
+var extensionFunctions = map[string]func(args []Value) (Value, error){
+	"ip": func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ip expects one argument")
+		}
+		s, ok := args[0].(String)
+		if !ok {
+			return nil, typeError("string", args[0])
+		}
+		return ParseIPAddr(string(s))
+	},
+}
+
+func (e extensionCallExpr) eval(ctx *evalContext) (Value, error) {
+	args := make([]Value, 0, len(e.args))
+	for _, arg := range e.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return extensionFunctions[e.name](args)
+}
+
+// ParseIPAddr parses an ip address, or an ip range in CIDR notation.
+func ParseIPAddr(s string) (IPAddr, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return IPAddr{}, fmt.Errorf("invalid ip range: %q", s)
+		}
+		return IPAddr(p.Masked()), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return IPAddr{}, fmt.Errorf("invalid ip address: %q", s)
+	}
+	return IPAddr(netip.PrefixFrom(addr, addr.BitLen())), nil
+}
+
+func (set Set) contains(v Value) bool {
+	for _, e := range set {
+		if equal(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b Value) bool {
+	switch at := a.(type) {
+	case Set:
+		bt, ok := b.(Set)
+		if !ok {
+			return false
+		}
+		for _, v := range at {
+			if !bt.contains(v) {
+				return false
+			}
+		}
+		for _, v := range bt {
+			if !at.contains(v) {
+				return false
+			}
+		}
+		return true
+	case Record:
+		bt, ok := b.(Record)
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, v := range at {
+			bv, ok := bt[k]
+			if !ok || !equal(v, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,215 @@
+package cedar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenInt
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	// text is the text of the token. For strings it is the raw text between
+	// the quotes, since patterns are unescaped differently.
+	text string
+	line int
+	col  int
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return `"` + t.text + `"`
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators are the operators, with longer operators first.
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||", "::",
+	"<", ">", "!", "+", "-", "*", ".", ",", ";", ":", "(", ")", "[", "]", "{", "}", "@",
+}
+
+// tokenize splits the source into tokens.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line, col := 1, 1
+	advance := func(n int) {
+		for _, c := range src[:n] {
+			if c == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+		src = src[n:]
+	}
+
+	for {
+		// skip whitespace and comments
+		for len(src) > 0 {
+			c, size := utf8.DecodeRuneInString(src)
+			if unicode.IsSpace(c) {
+				advance(size)
+			} else if strings.HasPrefix(src, "//") {
+				n := strings.IndexByte(src, '\n')
+				if n < 0 {
+					n = len(src)
+				}
+				advance(n)
+			} else {
+				break
+			}
+		}
+		if len(src) == 0 {
+			tokens = append(tokens, token{kind: tokenEOF, line: line, col: col})
+			return tokens, nil
+		}
+
+		tok := token{line: line, col: col}
+		c, _ := utf8.DecodeRuneInString(src)
+		n := 0
+		switch {
+		case c == '_' || unicode.IsLetter(c):
+			n = strings.IndexFunc(src, func(r rune) bool {
+				return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if n < 0 {
+				n = len(src)
+			}
+			tok.kind, tok.text = tokenIdent, src[:n]
+		case c >= '0' && c <= '9':
+			n = strings.IndexFunc(src, func(r rune) bool { return r < '0' || r > '9' })
+			if n < 0 {
+				n = len(src)
+			}
+			tok.kind, tok.text = tokenInt, src[:n]
+		case c == '"':
+			end := -1
+			for i := 1; i < len(src); i++ {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '"' {
+					end = i
+					break
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("cedar: %d:%d: unterminated string", line, col)
+			}
+			n = end + 1
+			tok.kind, tok.text = tokenString, src[1:end]
+		default:
+			for _, op := range operators {
+				if strings.HasPrefix(src, op) {
+					n = len(op)
+					tok.kind, tok.text = tokenOperator, op
+					break
+				}
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("cedar: %d:%d: unexpected character %q", line, col, c)
+			}
+		}
+		tokens = append(tokens, tok)
+		advance(n)
+	}
+}
+
+// A patternElement is a literal string or a wildcard in a like pattern.
+type patternElement struct {
+	wildcard bool
+	literal  string
+}
+
+// unescape unescapes the raw text of a string. In patterns, unescaped *s are
+// wildcards.
+func unescape(raw string, pattern bool) ([]patternElement, error) {
+	var elements []patternElement
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			elements = append(elements, patternElement{literal: sb.String()})
+			sb.Reset()
+		}
+	}
+
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c == '*' && pattern {
+			flush()
+			elements = append(elements, patternElement{wildcard: true})
+			continue
+		} else if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i >= len(raw) {
+			return nil, fmt.Errorf("invalid escape sequence")
+		}
+		switch raw[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '0':
+			sb.WriteByte(0)
+		case '\\', '"', '\'':
+			sb.WriteByte(raw[i])
+		case '*':
+			if !pattern {
+				return nil, fmt.Errorf("invalid escape sequence \\*")
+			}
+			sb.WriteByte('*')
+		case 'u':
+			end := strings.IndexByte(raw[i:], '}')
+			if !strings.HasPrefix(raw[i:], "u{") || end < 0 {
+				return nil, fmt.Errorf("invalid unicode escape sequence")
+			}
+			r, err := strconv.ParseUint(raw[i+2:i+end], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return nil, fmt.Errorf("invalid unicode escape sequence")
+			}
+			sb.WriteRune(rune(r))
+			i += end
+		default:
+			return nil, fmt.Errorf("invalid escape sequence \\%c", raw[i])
+		}
+	}
+	flush()
+	return elements, nil
+}
+
+// unescapeString unescapes the raw text of a string which isn't a pattern.
+func unescapeString(raw string) (string, error) {
+	elements, err := unescape(raw, false)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, e := range elements {
+		sb.WriteString(e.literal)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,631 @@
+package cedar
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// An Effect is the effect of a policy.
+type Effect string
+
+// Effects.
+const (
+	Permit Effect = "permit"
+	Forbid Effect = "forbid"
+)
+
+// A PolicySet is a set of policies.
+type PolicySet []*Policy
+
+// A Policy is a permit or forbid policy.
+type Policy struct {
+	// ID is the value of the policy's @id annotation, or policyN for the
+	// Nth policy in the set.
+	ID          string
+	Annotations map[string]string
+	Effect      Effect
+
+	principal, action, resource scopeConstraint
+	conditions                  []condition
+}
+
+// A scopeConstraint constrains the principal, action or resource of a
+// request. An empty constraint matches any entity.
+type scopeConstraint struct {
+	// op is "", "==", "in" or "is"
+	op       string
+	entities []EntityUID
+	// typ is the entity type of is constraints, which may also have an in
+	// entity.
+	typ string
+}
+
+type condition struct {
+	unless bool
+	expr   expr
+}
+
+// Parse parses a policy set.
+func Parse(src string) (PolicySet, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	var ps PolicySet
+	ids := map[string]bool{}
+	for !p.peek().is(tokenEOF, "") {
+		policy, err := p.parsePolicy()
+		if err != nil {
+			return nil, err
+		}
+		if id, ok := policy.Annotations["id"]; ok {
+			policy.ID = id
+		} else {
+			policy.ID = "policy" + strconv.Itoa(len(ps))
+		}
+		if ids[policy.ID] {
+			return nil, fmt.Errorf("cedar: duplicate policy id: %s", policy.ID)
+		}
+		ids[policy.ID] = true
+		ps = append(ps, policy)
+	}
+	return ps, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("cedar: %d:%d: %s", t.line, t.col, fmt.Sprintf(format, args...))
+}
+
+// accept consumes the next token if it has the kind and text.
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if p.peek().is(kind, text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if t := p.next(); !t.is(kind, text) {
+		return p.errorf(t, "expected %q, got %s", text, t)
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return "", p.errorf(t, "expected identifier, got %s", t)
+	}
+	return t.text, nil
+}
+
+func (p *parser) expectString() (string, error) {
+	t := p.next()
+	if t.kind != tokenString {
+		return "", p.errorf(t, "expected string, got %s", t)
+	}
+	s, err := unescapeString(t.text)
+	if err != nil {
+		return "", p.errorf(t, "%s", err)
+	}
+	return s, nil
+}
+
+func (p *parser) parsePolicy() (*Policy, error) {
+	policy := &Policy{Annotations: map[string]string{}}
+	for p.accept(tokenOperator, "@") {
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenOperator, "("); err != nil {
+			return nil, err
+		}
+		value, err := p.expectString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenOperator, ")"); err != nil {
+			return nil, err
+		}
+		policy.Annotations[name] = value
+	}
+
+	t := p.next()
+	switch {
+	case t.is(tokenIdent, string(Permit)):
+		policy.Effect = Permit
+	case t.is(tokenIdent, string(Forbid)):
+		policy.Effect = Forbid
+	default:
+		return nil, p.errorf(t, "expected permit or forbid, got %s", t)
+	}
+
+	if err := p.expect(tokenOperator, "("); err != nil {
+		return nil, err
+	}
+	var err error
+	if policy.principal, err = p.parseScopeConstraint("principal"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenOperator, ","); err != nil {
+		return nil, err
+	}
+	if policy.action, err = p.parseScopeConstraint("action"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenOperator, ","); err != nil {
+		return nil, err
+	}
+	if policy.resource, err = p.parseScopeConstraint("resource"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenOperator, ")"); err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if !t.is(tokenIdent, "when") && !t.is(tokenIdent, "unless") {
+			break
+		}
+		p.next()
+		if err := p.expect(tokenOperator, "{"); err != nil {
+			return nil, err
+		}
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenOperator, "}"); err != nil {
+			return nil, err
+		}
+		policy.conditions = append(policy.conditions, condition{unless: t.text == "unless", expr: e})
+	}
+
+	if err := p.expect(tokenOperator, ";"); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *parser) parseScopeConstraint(variable string) (scopeConstraint, error) {
+	var c scopeConstraint
+	if err := p.expect(tokenIdent, variable); err != nil {
+		return c, err
+	}
+
+	switch t := p.peek(); {
+	case t.is(tokenOperator, "=="):
+		p.next()
+		uid, err := p.parseEntityUID()
+		if err != nil {
+			return c, err
+		}
+		c.op, c.entities = "==", []EntityUID{uid}
+	case t.is(tokenIdent, "in"):
+		p.next()
+		c.op = "in"
+		// actions may be in a set of entities
+		if variable == "action" && p.accept(tokenOperator, "[") {
+			for !p.accept(tokenOperator, "]") {
+				if len(c.entities) > 0 {
+					if err := p.expect(tokenOperator, ","); err != nil {
+						return c, err
+					}
+				}
+				uid, err := p.parseEntityUID()
+				if err != nil {
+					return c, err
+				}
+				c.entities = append(c.entities, uid)
+			}
+			return c, nil
+		}
+		uid, err := p.parseEntityUID()
+		if err != nil {
+			return c, err
+		}
+		c.entities = []EntityUID{uid}
+	case t.is(tokenIdent, "is") && variable != "action":
+		p.next()
+		typ, err := p.parsePath()
+		if err != nil {
+			return c, err
+		}
+		c.op, c.typ = "is", typ
+		if p.accept(tokenIdent, "in") {
+			uid, err := p.parseEntityUID()
+			if err != nil {
+				return c, err
+			}
+			c.entities = []EntityUID{uid}
+		}
+	}
+	return c, nil
+}
+
+// parsePath parses a possibly namespaced name, e.g. Example::User.
+func (p *parser) parsePath() (string, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	for p.peek().is(tokenOperator, "::") && p.tokens[p.pos+1].kind == tokenIdent {
+		p.next()
+		part, _ := p.expectIdent()
+		name += "::" + part
+	}
+	return name, nil
+}
+
+func (p *parser) parseEntityUID() (EntityUID, error) {
+	typ, err := p.parsePath()
+	if err != nil {
+		return EntityUID{}, err
+	}
+	if err := p.expect(tokenOperator, "::"); err != nil {
+		return EntityUID{}, err
+	}
+	id, err := p.expectString()
+	if err != nil {
+		return EntityUID{}, err
+	}
+	return EntityUID{Type: typ, ID: id}, nil
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	if !p.accept(tokenIdent, "if") {
+		return p.parseOr()
+	}
+
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenIdent, "then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenIdent, "else"); err != nil {
+		return nil, err
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return ifExpr{cond: cond, then: then, els: els}, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseRelation()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "&&") {
+		right, err := p.parseRelation()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseRelation() (expr, error) {
+	left, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokenOperator && (t.text == "==" || t.text == "!=" ||
+		t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="),
+		t.is(tokenIdent, "in"):
+		p.next()
+		right, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op: t.text, left: left, right: right}, nil
+	case t.is(tokenIdent, "has"):
+		p.next()
+		a := p.next()
+		switch a.kind {
+		case tokenIdent:
+			return hasExpr{expr: left, attr: a.text}, nil
+		case tokenString:
+			attr, err := unescapeString(a.text)
+			if err != nil {
+				return nil, p.errorf(a, "%s", err)
+			}
+			return hasExpr{expr: left, attr: attr}, nil
+		}
+		return nil, p.errorf(a, "expected attribute, got %s", a)
+	case t.is(tokenIdent, "like"):
+		p.next()
+		s := p.next()
+		if s.kind != tokenString {
+			return nil, p.errorf(s, "expected pattern, got %s", s)
+		}
+		pattern, err := unescape(s.text, true)
+		if err != nil {
+			return nil, p.errorf(s, "%s", err)
+		}
+		return likeExpr{expr: left, pattern: pattern}, nil
+	case t.is(tokenIdent, "is"):
+		p.next()
+		typ, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		e := isExpr{expr: left, typ: typ}
+		if p.accept(tokenIdent, "in") {
+			if e.in, err = p.parseAdd(); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdd() (expr, error) {
+	left, err := p.parseMult()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is(tokenOperator, "+") && !t.is(tokenOperator, "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMult()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMult() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "*") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "*", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	t := p.peek()
+	switch {
+	case t.is(tokenOperator, "!"):
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: e}, nil
+	case t.is(tokenOperator, "-"):
+		p.next()
+		// negative literals may be the minimum long
+		if n := p.peek(); n.kind == tokenInt {
+			p.next()
+			v, err := strconv.ParseInt("-"+n.text, 10, 64)
+			if err != nil {
+				return nil, p.errorf(n, "invalid long: -%s", n.text)
+			}
+			return p.parseAccess(literalExpr{value: Long(v)})
+		}
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{expr: e}, nil
+	}
+
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseAccess(e)
+}
+
+// parseAccess parses attribute accesses and method calls.
+func (p *parser) parseAccess(e expr) (expr, error) {
+	for {
+		switch {
+		case p.accept(tokenOperator, "."):
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(tokenOperator, "(") {
+				e = accessExpr{expr: e, attr: name}
+				continue
+			}
+			args, err := p.parseExprList(")")
+			if err != nil {
+				return nil, err
+			}
+			e = callExpr{name: name, receiver: e, args: args}
+		case p.accept(tokenOperator, "["):
+			attr, err := p.expectString()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(tokenOperator, "]"); err != nil {
+				return nil, err
+			}
+			e = accessExpr{expr: e, attr: attr}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// parseExprList parses expressions separated by commas up to the closing
+// operator.
+func (p *parser) parseExprList(closing string) ([]expr, error) {
+	var exprs []expr
+	for !p.accept(tokenOperator, closing) {
+		if len(exprs) > 0 {
+			if err := p.expect(tokenOperator, ","); err != nil {
+				return nil, err
+			}
+		}
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, nil
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenInt:
+		p.next()
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid long: %s", t.text)
+		}
+		return literalExpr{value: Long(v)}, nil
+	case tokenString:
+		s, err := p.expectString()
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr{value: String(s)}, nil
+	case tokenOperator:
+		p.next()
+		switch t.text {
+		case "(":
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(tokenOperator, ")")
+		case "[":
+			elements, err := p.parseExprList("]")
+			if err != nil {
+				return nil, err
+			}
+			return setExpr{elements: elements}, nil
+		case "{":
+			return p.parseRecord()
+		}
+		return nil, p.errorf(t, "unexpected %s", t)
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			p.next()
+			return literalExpr{value: Bool(t.text == "true")}, nil
+		case "principal", "action", "resource", "context":
+			p.next()
+			return variableExpr{name: t.text}, nil
+		}
+
+		if p.tokens[p.pos+1].is(tokenOperator, "(") {
+			p.next()
+			p.next()
+			args, err := p.parseExprList(")")
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := extensionFunctions[t.text]; !ok {
+				return nil, p.errorf(t, "unknown function: %s", t.text)
+			}
+			return extensionCallExpr{name: t.text, args: args}, nil
+		}
+
+		uid, err := p.parseEntityUID()
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr{value: uid}, nil
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+func (p *parser) parseRecord() (expr, error) {
+	e := recordExpr{}
+	for !p.accept(tokenOperator, "}") {
+		if len(e.keys) > 0 {
+			if err := p.expect(tokenOperator, ","); err != nil {
+				return nil, err
+			}
+		}
+		var key string
+		switch t := p.next(); t.kind {
+		case tokenIdent:
+			key = t.text
+		case tokenString:
+			var err error
+			if key, err = unescapeString(t.text); err != nil {
+				return nil, p.errorf(t, "%s", err)
+			}
+		default:
+			return nil, p.errorf(t, "expected record key, got %s", t)
+		}
+		if err := p.expect(tokenOperator, ":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		e.keys = append(e.keys, key)
+		e.values = append(e.values, value)
+	}
+	return e, nil
+}
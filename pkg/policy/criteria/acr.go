@@ -0,0 +1,58 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var acrBody = ast.Body{
+	ast.MustParseExpr(`
+		session := get_session(input.session.id)
+	`),
+	ast.MustParseExpr(`
+		acr := object.get(session, "acr", "")
+	`),
+}
+
+type acrCriterion struct {
+	g *Generator
+}
+
+func (acrCriterion) DataType() generator.CriterionDataType {
+	return CriterionDataTypeStringMatcher
+}
+
+func (acrCriterion) Name() string {
+	return "acr"
+}
+
+func (c acrCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var body ast.Body
+	body = append(body, acrBody...)
+
+	err := matchString(&body, ast.VarTerm("acr"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonACROK, ReasonACRUnauthorized,
+		body)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+	}, nil
+}
+
+// ACR returns a Criterion on a session's authentication context class
+// reference.
+func ACR(generator *Generator) Criterion {
+	return acrCriterion{g: generator}
+}
+
+func init() {
+	Register(ACR)
+}
@@ -0,0 +1,58 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var amrBody = ast.Body{
+	ast.MustParseExpr(`
+		session := get_session(input.session.id)
+	`),
+	ast.MustParseExpr(`
+		amr := object.get(session, "amr", [])
+	`),
+}
+
+type amrCriterion struct {
+	g *Generator
+}
+
+func (amrCriterion) DataType() generator.CriterionDataType {
+	return CriterionDataTypeStringListMatcher
+}
+
+func (amrCriterion) Name() string {
+	return "amr"
+}
+
+func (c amrCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var body ast.Body
+	body = append(body, amrBody...)
+
+	err := matchStringList(&body, ast.VarTerm("amr"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonAMROK, ReasonAMRUnauthorized,
+		body)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+	}, nil
+}
+
+// AMR returns a Criterion on a session's authentication methods references,
+// e.g. to require multi-factor authentication.
+func AMR(generator *Generator) Criterion {
+	return amrCriterion{g: generator}
+}
+
+func init() {
+	Register(AMR)
+}
@@ -0,0 +1,158 @@
+package criteria
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var clientCertificateBody = ast.Body{
+	ast.MustParseExpr(`
+		input.is_valid_client_certificate == true
+	`),
+	ast.MustParseExpr(`
+		cert := input.client_certificate
+	`),
+}
+
+// clientCertificateStringFields are the fields of the client certificate
+// which are matched with a string matcher.
+var clientCertificateStringFields = map[string]string{
+	"issuer":  "issuer",
+	"subject": "subject",
+}
+
+// clientCertificateListFields are the fields of the client certificate which
+// match if one of their values matches a string matcher.
+var clientCertificateListFields = map[string]string{
+	"organizational_unit": "organizational_units",
+	"san_dns":             "san_dns_names",
+	"san_email":           "san_emails",
+	"san_uri":             "san_uris",
+}
+
+// clientCertificateHexFields are the fields of the client certificate which
+// are hex strings, and match one of a list of values.
+var clientCertificateHexFields = map[string]string{
+	"fingerprint": "fingerprint",
+	"serial":      "serial",
+}
+
+type clientCertificateCriterion struct {
+	g *Generator
+}
+
+func (clientCertificateCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (clientCertificateCriterion) Name() string {
+	return "client_certificate"
+}
+
+func (c clientCertificateCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for client_certificate, got: %T", data)
+	}
+	if len(obj) == 0 {
+		return nil, nil, fmt.Errorf("client_certificate: at least one field is required")
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	body := append(ast.Body{}, clientCertificateBody...)
+	for _, k := range keys {
+		v := obj[k]
+		var err error
+		if field, ok := clientCertificateStringFields[k]; ok {
+			err = matchString(&body, ast.RefTerm(ast.VarTerm("cert"), ast.StringTerm(field)), v)
+		} else if field, ok := clientCertificateListFields[k]; ok {
+			err = matchStringListAny(&body, ast.RefTerm(ast.VarTerm("cert"), ast.StringTerm(field)), v)
+		} else if field, ok := clientCertificateHexFields[k]; ok {
+			// serial numbers are stored without leading zeros
+			err = matchHexStrings(&body, ast.RefTerm(ast.VarTerm("cert"), ast.StringTerm(field)), v, k == "serial")
+		} else {
+			err = fmt.Errorf("unknown field: %s", k)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("client_certificate: %w", err)
+		}
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonClientCertificateOK, ReasonClientCertificateUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// matchStringListAny matches if any of the strings of the list matches the
+// string matcher.
+func matchStringListAny(dst *ast.Body, left *ast.Term, right parser.Value) error {
+	body := ast.Body{
+		ast.MustParseExpr("some v"),
+		ast.Equality.Expr(ast.VarTerm("v"), ast.RefTerm(left, ast.VarTerm("$0"))),
+	}
+	err := matchString(&body, ast.VarTerm("v"), right)
+	if err != nil {
+		return err
+	}
+	*dst = append(*dst, ast.GreaterThan.Expr(
+		ast.Count.Call(
+			ast.ArrayComprehensionTerm(
+				ast.BooleanTerm(true),
+				body,
+			),
+		),
+		ast.IntNumberTerm(0),
+	))
+	return nil
+}
+
+// matchHexStrings matches one of a hex string or a list of hex strings, in
+// any case and with or without colons, like 3a:f2:...
+func matchHexStrings(dst *ast.Body, left *ast.Term, right parser.Value, trimZeros bool) error {
+	values, ok := right.(parser.Array)
+	if !ok {
+		values = parser.Array{right}
+	}
+	normalized := make(parser.Array, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(parser.String)
+		if !ok {
+			return fmt.Errorf("expected hex string or array of hex strings, got: %s", right)
+		}
+		h := strings.ToLower(strings.ReplaceAll(string(s), ":", ""))
+		if strings.Trim(h, "0123456789abcdef") != "" || h == "" {
+			return fmt.Errorf("invalid hex string: %s", s)
+		}
+		if trimZeros {
+			if h = strings.TrimLeft(h, "0"); h == "" {
+				h = "0"
+			}
+		}
+		normalized = append(normalized, parser.String(h))
+	}
+	return matchStringIn(dst, left, normalized)
+}
+
+// ClientCertificate returns a Criterion on the attributes of a verified
+// client certificate: its subject, issuer, organizational units, serial
+// number, SHA-256 fingerprint and subject alternative names.
+func ClientCertificate(generator *Generator) Criterion {
+	return clientCertificateCriterion{g: generator}
+}
+
+func init() {
+	Register(ClientCertificate)
+}
@@ -0,0 +1,62 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertificate(t *testing.T) {
+	valid, invalid := true, false
+	cert := M{
+		"subject":              "CN=billing,OU=payments",
+		"issuer":               "CN=Example CA",
+		"organizational_units": A{"payments"},
+		"serial":               "a1b",
+		"fingerprint":          "0b8b1e6dfe21f2ce582a8b9e337eaf664d6d86f50f6b9340ce6dd9de7ed7e199",
+		"san_uris":             A{"spiffe://example.com/ns/prod/sa/billing"},
+		"san_dns_names":        A{"billing.example.com"},
+		"san_emails":           A{},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		policy  string
+		isValid *bool
+		cert    M
+		allow   bool
+	}{
+		{"san uri", `{san_uri: {starts_with: "spiffe://example.com/ns/prod/"}}`, &valid, cert, true},
+		{"other san uri", `{san_uri: {starts_with: "spiffe://example.com/ns/dev/"}}`, &valid, cert, false},
+		{"no san emails", `{san_email: {ends_with: "@example.com"}}`, &valid, cert, false},
+		{"organizational unit and issuer", `{organizational_unit: {in: [payments, billing]}, issuer: {is: "CN=Example CA"}}`, &valid, cert, true},
+		{"subject", `{subject: {matches: "CN=billing,.*"}}`, &valid, cert, true},
+		{"serial", `{serial: ["00:0A:1B", "ff"]}`, &valid, cert, true},
+		{"fingerprint", `{fingerprint: "0B:8B:1E:6D:FE:21:F2:CE:58:2A:8B:9E:33:7E:AF:66:4D:6D:86:F5:0F:6B:93:40:CE:6D:D9:DE:7E:D7:E1:99"}`, &valid, cert, true},
+		{"other fingerprint", `{fingerprint: "b88b1e6dfe21f2ce582a8b9e337eaf664d6d86f50f6b9340ce6dd9de7ed7e199"}`, &valid, cert, false},
+		{"unverified", `{serial: a1b}`, &invalid, cert, false},
+		{"no certificate", `{serial: a1b}`, &valid, nil, false},
+	} {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - client_certificate: `+tc.policy, []dataBrokerRecord{}, Input{IsValidClientCertificate: tc.isValid, ClientCertificate: tc.cert})
+		require.NoError(t, err, tc.name)
+		if tc.allow {
+			assert.Equal(t, A{true, A{ReasonClientCertificateOK}, M{}}, res["allow"], tc.name)
+		} else {
+			assert.Equal(t, A{false, A{ReasonClientCertificateUnauthorized}, M{}}, res["allow"], tc.name)
+		}
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{"a1b", "{}", "{serial: xyz}", "{serial: [1]}", "{fingerprint: ''}", "{san_uri: spiffe://x}", "{issuer: {like: x}}", "{common_name: {is: x}}"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - client_certificate: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
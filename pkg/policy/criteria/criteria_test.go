@@ -12,6 +12,7 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/format"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/types"
 	"google.golang.org/protobuf/proto"
 
@@ -25,15 +26,61 @@ type M = map[string]interface{}
 
 var testingNow = time.Date(2021, 5, 11, 13, 43, 0, 0, time.Local)
 
+// testGeoIP are the results of geoip_lookup.
+var testGeoIP = map[string]M{
+	"1.1.1.1": {"country": "AU", "asn": 13335, "as_organization": "CLOUDFLARENET"},
+	"8.8.8.8": {"country": "US", "asn": 15169, "as_organization": "GOOGLE"},
+}
+
+// testExternalData are the documents of the external data sources.
+var testExternalData = M{
+	"oncall": M{
+		"engineers": A{"u1@example.com", "u2@example.com"},
+		"users":     A{"u1"},
+		"ips":       A{"1.1.1.1"},
+	},
+	"flags": M{"maintenance": false},
+}
+
+// testJWTs are the claims of the JWTs which verify_jwt verifies with the keys
+// at testJWKSURL.
+var testJWTs = map[string]M{
+	"partner-jwt": {"iss": "https://partner.example.com", "aud": A{"https://api.example.com"}, "scope": "orders:read orders:write"},
+	"other-jwt":   {"iss": "https://other.example.com", "scope": "orders:read"},
+}
+
+const testJWKSURL = "https://partner.example.com/jwks.json"
+
+// testGroupParents are the parents of groups in the group hierarchy which
+// get_group_ancestors follows.
+var testGroupParents = map[string]string{
+	"g-infra":    "g-platform",
+	"g-platform": "g-eng",
+}
+
+// testRateLimitCounts are the numbers of earlier requests counted by
+// rate_limit.
+var testRateLimitCounts = map[string]int{
+	"user:u1":    5,
+	"ip:1.1.1.1": 5,
+}
+
 type (
 	Input struct {
-		HTTP    InputHTTP    `json:"http"`
-		Session InputSession `json:"session"`
+		HTTP                     InputHTTP    `json:"http"`
+		Session                  InputSession `json:"session"`
+		IsValidClientCertificate *bool        `json:"is_valid_client_certificate,omitempty"`
+		ClientCertificate        M            `json:"client_certificate,omitempty"`
 	}
 	InputHTTP struct {
-		Method  string              `json:"method"`
-		Path    string              `json:"path"`
-		Headers map[string][]string `json:"headers"`
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+		IP      string            `json:"ip"`
+
+		Body          string `json:"body"`
+		BodySize      int64  `json:"body_size"`
+		BodyTruncated bool   `json:"body_truncated"`
 	}
 	InputSession struct {
 		ID string `json:"id"`
@@ -80,6 +127,7 @@ func evaluate(t *testing.T,
 
 	r := rego.New(
 		rego.Module("policy.rego", regoPolicy),
+		rego.Store(inmem.NewFromObject(M{"external": testExternalData})),
 		rego.Query("result = data.pomerium.policy"),
 		rego.Function2(&rego.Function{
 			Name: "get_databroker_record",
@@ -112,6 +160,87 @@ func evaluate(t *testing.T,
 
 			return nil, nil
 		}),
+		rego.Function1(&rego.Function{
+			Name: "geoip_lookup",
+			Decl: types.NewFunction([]types.Type{
+				types.S,
+			}, types.A),
+		}, func(bctx rego.BuiltinContext, op1 *ast.Term) (*ast.Term, error) {
+			ip, ok := op1.Value.(ast.String)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for ip: %T", op1)
+			}
+
+			result, ok := testGeoIP[string(ip)]
+			if !ok {
+				return ast.ObjectTerm(), nil
+			}
+			v, err := ast.InterfaceToValue(result)
+			if err != nil {
+				return nil, err
+			}
+			return ast.NewTerm(v), nil
+		}),
+		rego.Function3(&rego.Function{
+			Name: "rate_limit",
+			Decl: types.NewFunction([]types.Type{
+				types.S, types.N, types.N,
+			}, types.B),
+		}, func(bctx rego.BuiltinContext, op1, op2, op3 *ast.Term) (*ast.Term, error) {
+			subject, ok := op1.Value.(ast.String)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for subject: %T", op1)
+			}
+			limit, ok := op2.Value.(ast.Number).Int()
+			if !ok {
+				return nil, fmt.Errorf("invalid type for limit: %T", op2)
+			}
+			return ast.BooleanTerm(testRateLimitCounts[string(subject)]+1 <= limit), nil
+		}),
+		rego.Function2(&rego.Function{
+			Name: "verify_jwt",
+			Decl: types.NewFunction([]types.Type{
+				types.S, types.S,
+			}, types.A),
+		}, func(bctx rego.BuiltinContext, op1, op2 *ast.Term) (*ast.Term, error) {
+			rawJWT, ok := op1.Value.(ast.String)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for jwt: %T", op1)
+			}
+			claims, ok := testJWTs[string(rawJWT)]
+			if !ok || op2.Value.Compare(ast.String(testJWKSURL)) != 0 {
+				return nil, fmt.Errorf("invalid jwt")
+			}
+			v, err := ast.InterfaceToValue(claims)
+			if err != nil {
+				return nil, err
+			}
+			return ast.NewTerm(v), nil
+		}),
+		rego.Function2(&rego.Function{
+			Name: "get_group_ancestors",
+			Decl: types.NewFunction([]types.Type{
+				types.A, types.N,
+			}, types.A),
+		}, func(bctx rego.BuiltinContext, op1, op2 *ast.Term) (*ast.Term, error) {
+			groups, ok := op1.Value.(*ast.Array)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for groups: %T", op1)
+			}
+			maxDepth, ok := op2.Value.(ast.Number).Int()
+			if !ok {
+				return nil, fmt.Errorf("invalid type for max_depth: %T", op2)
+			}
+			var ancestors []*ast.Term
+			groups.Foreach(func(t *ast.Term) {
+				g, _ := t.Value.(ast.String)
+				for depth := 0; depth <= maxDepth && g != ""; depth++ {
+					ancestors = append(ancestors, ast.StringTerm(string(g)))
+					g = ast.String(testGroupParents[string(g)])
+				}
+			})
+			return ast.ArrayTerm(ancestors...), nil
+		}),
 		rego.Input(input),
 	)
 	preparedQuery, err := r.PrepareForEval(context.Background())
@@ -0,0 +1,56 @@
+package criteria
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+type dayOfWeekCriterion struct {
+	g *Generator
+}
+
+func (dayOfWeekCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (dayOfWeekCriterion) Name() string {
+	return "day_of_week"
+}
+
+func (c dayOfWeekCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for day_of_week, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "days", "timezone"); err != nil {
+		return nil, nil, fmt.Errorf("day_of_week: %w", err)
+	}
+
+	timezone, err := parseTimezone(obj["timezone"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("day_of_week: %w", err)
+	}
+	days, err := parseDays(obj["days"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("day_of_week: %w", err)
+	}
+
+	rule, additionalRules := newScheduleRule(c.g, c.Name(),
+		ReasonDayOfWeekOK, ReasonDayOfWeekUnauthorized,
+		timezone, newScheduleWindows(days, 0, minutesPerDay))
+	return rule, additionalRules, nil
+}
+
+// DayOfWeek returns a Criterion which matches when the current day of the
+// week is one of the given days.
+func DayOfWeek(generator *Generator) Criterion {
+	return dayOfWeekCriterion{g: generator}
+}
+
+func init() {
+	Register(DayOfWeek)
+}
@@ -0,0 +1,62 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDayOfWeek(t *testing.T) {
+	now := testingNow.UTC()
+	dayOfWeek := func(t *testing.T, days string) (A, error) {
+		res, err := evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - day_of_week:
+        days: %s
+`, days), []dataBrokerRecord{}, Input{})
+		if err != nil {
+			return nil, err
+		}
+		return res["allow"].(A), nil
+	}
+	day := func(d time.Weekday) string {
+		return strings.ToLower(d.String())
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		res, err := dayOfWeek(t, day(now.Weekday()))
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonDayOfWeekOK}, M{}}, res)
+	})
+	t.Run("list", func(t *testing.T) {
+		res, err := dayOfWeek(t, fmt.Sprintf("[%s, %s]", day(now.Weekday()+1), day(now.Weekday())[:3]))
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonDayOfWeekOK}, M{}}, res)
+	})
+	t.Run("range", func(t *testing.T) {
+		// ranges wrap around the end of the week
+		res, err := dayOfWeek(t, day((now.Weekday()+6)%7)+"-"+day((now.Weekday()+1)%7))
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonDayOfWeekOK}, M{}}, res)
+
+		res, err = dayOfWeek(t, day((now.Weekday()+1)%7)+"-"+day((now.Weekday()+6)%7))
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonDayOfWeekUnauthorized}, M{}}, res)
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := dayOfWeek(t, day((now.Weekday()+1)%7))
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonDayOfWeekUnauthorized}, M{}}, res)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, days := range []string{"someday", "mon-someday", "[]", "{}"} {
+			_, err := dayOfWeek(t, days)
+			assert.Error(t, err, days)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var devicePostureBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`user := get_user(session)`),
+	ast.MustParseExpr(`email := get_user_email(session, user)`),
+	ast.MustParseExpr(`email != ""`),
+	ast.MustParseExpr(`posture := get_device_posture(provider, email)`),
+	ast.MustParseExpr(`device := posture.devices[_]`),
+}
+
+type devicePostureCriterion struct {
+	g *Generator
+}
+
+func (devicePostureCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (devicePostureCriterion) Name() string {
+	return "device_posture"
+}
+
+func (c devicePostureCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for device_posture, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "provider", "managed", "compliant", "min_score", "max_age"); err != nil {
+		return nil, nil, fmt.Errorf("device_posture: %w", err)
+	}
+
+	provider, ok := obj["provider"].(parser.String)
+	if !ok || provider == "" {
+		return nil, nil, fmt.Errorf("device_posture: provider is required")
+	}
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("provider"), ast.StringTerm(string(provider))),
+	}, devicePostureBody...)
+
+	for _, field := range []string{"managed", "compliant"} {
+		v, ok := obj[field]
+		if !ok {
+			continue
+		}
+		b, ok := v.(parser.Boolean)
+		if !ok {
+			return nil, nil, fmt.Errorf("device_posture: expected boolean for %s, got: %T", field, v)
+		}
+		body = append(body, ast.MustParseExpr(fmt.Sprintf(`object.get(device, %q, false) == %t`, field, bool(b))))
+	}
+
+	if v, ok := obj["min_score"]; ok {
+		n, ok := v.(parser.Number)
+		if !ok {
+			return nil, nil, fmt.Errorf("device_posture: expected number for min_score, got: %T", v)
+		}
+		minScore, err := strconv.ParseUint(string(n), 10, 32)
+		if err != nil || minScore > 100 {
+			return nil, nil, fmt.Errorf("device_posture: min_score must be between 0 and 100: %s", n)
+		}
+		body = append(body,
+			ast.Assign.Expr(ast.VarTerm("min_score"), ast.UIntNumberTerm(minScore)),
+			ast.MustParseExpr(`object.get(device, "score", -1) >= min_score`))
+	}
+
+	if v, ok := obj["max_age"]; ok {
+		s, ok := v.(parser.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("device_posture: expected string for max_age, got: %T", v)
+		}
+		maxAge, err := time.ParseDuration(string(s))
+		if err != nil {
+			return nil, nil, fmt.Errorf("device_posture: invalid max_age: %w", err)
+		}
+		if maxAge < time.Second || maxAge%time.Second != 0 {
+			return nil, nil, fmt.Errorf("device_posture: max_age must be a whole number of seconds: %s", s)
+		}
+		body = append(body,
+			ast.Assign.Expr(ast.VarTerm("max_age"), ast.IntNumberTerm(int(maxAge/time.Second))),
+			ast.MustParseExpr(`last_seen_at := object.get(device, "last_seen_at", {})`),
+			ast.MustParseExpr(`time.now_ns() < (object.get(last_seen_at, "seconds", 0) + max_age) * 1000000000`))
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonDevicePostureOK, ReasonDevicePostureUnauthorized,
+		body)
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetUser(),
+		rules.GetUserEmail(),
+		rules.GetDevicePosture(),
+	}, nil
+}
+
+// DevicePosture returns a Criterion which matches if one of the user's
+// devices, as reported by a device posture provider, is managed, compliant,
+// has at least a health score or was seen recently.
+func DevicePosture(generator *Generator) Criterion {
+	return devicePostureCriterion{g: generator}
+}
+
+func init() {
+	Register(DevicePosture)
+}
@@ -0,0 +1,86 @@
+package criteria
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestDevicePosture(t *testing.T) {
+	records := []dataBrokerRecord{
+		&session.Session{Id: "SESSION_ID", UserId: "USER_ID"},
+		&user.User{Id: "USER_ID", Email: "User@Example.com"},
+		&device.Posture{
+			Id: "intune/user@example.com", Provider: "intune", Email: "user@example.com",
+			Devices: []*device.Posture_Device{
+				{Id: "1", Managed: true, LastSeenAt: timestamppb.New(testingNow.Add(-time.Hour))},
+				{Id: "2", Managed: true, Compliant: true, Score: proto.Int32(70), LastSeenAt: timestamppb.New(testingNow.Add(-48 * time.Hour))},
+			},
+		},
+	}
+	for _, tc := range []struct {
+		name   string
+		policy string
+		expect bool
+	}{
+		{"managed", "{provider: intune, managed: true}", true},
+		{"managed and compliant", "{provider: intune, managed: true, compliant: true}", true},
+		{"unmanaged", "{provider: intune, managed: false}", false},
+		{"min score", "{provider: intune, min_score: 70}", true},
+		{"min score not met", "{provider: intune, min_score: 80}", false},
+		{"recent", "{provider: intune, max_age: 24h}", true},
+		{"recent and compliant", "{provider: intune, compliant: true, max_age: 24h}", false},
+		{"other provider", "{provider: jamf}", false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := evaluate(t, `
+allow:
+  and:
+    - device_posture: `+tc.policy, records, Input{Session: InputSession{ID: "SESSION_ID"}})
+			require.NoError(t, err)
+			if tc.expect {
+				require.Equal(t, A{true, A{ReasonDevicePostureOK}, M{}}, res["allow"])
+			} else {
+				require.Equal(t, A{false, A{ReasonDevicePostureUnauthorized}, M{}}, res["allow"])
+			}
+			require.Equal(t, A{false, A{}}, res["deny"])
+		})
+	}
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - device_posture:
+        provider: intune
+`, records, Input{Session: InputSession{ID: "OTHER_SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, M{}}, res["allow"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{
+			"intune",
+			"{}",
+			"{managed: true}",
+			"{provider: intune, managed: yes}",
+			"{provider: intune, min_score: 101}",
+			"{provider: intune, min_score: -1}",
+			"{provider: intune, max_age: 500ms}",
+			"{provider: intune, healthy: true}",
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - device_posture: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
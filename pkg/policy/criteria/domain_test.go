@@ -65,4 +65,31 @@ allow:
 		require.Equal(t, A{true, A{ReasonDomainOK}, M{}}, res["allow"])
 		require.Equal(t, A{false, A{}}, res["deny"])
 	})
+	t.Run("by list", func(t *testing.T) {
+		for email, expect := range map[string]A{
+			"a@example.com":      {true, A{ReasonDomainOK}, M{}},
+			"b@labs.example.com": {true, A{ReasonDomainOK}, M{}},
+			"c@example.org":      {false, A{ReasonDomainUnauthorized}, M{}},
+		} {
+			res, err := evaluate(t, `
+allow:
+  and:
+    - domain:
+        in: [example.com, labs.example.com]
+`,
+				[]dataBrokerRecord{
+					&session.Session{
+						Id:     "SESSION_ID",
+						UserId: "USER_ID",
+					},
+					&user.User{
+						Id:    "USER_ID",
+						Email: email,
+					},
+				},
+				Input{Session: InputSession{ID: "SESSION_ID"}})
+			require.NoError(t, err)
+			require.Equal(t, expect, res["allow"], email)
+		}
+	})
 }
@@ -75,4 +75,32 @@ allow:
 		require.Equal(t, A{true, A{ReasonEmailOK}, M{}}, res["allow"])
 		require.Equal(t, A{false, A{}}, res["deny"])
 	})
+	t.Run("by regex", func(t *testing.T) {
+		for email, expect := range map[string]A{
+			"a@corp.example.com":          {true, A{ReasonEmailOK}, M{}},
+			"b@labs.example.com":          {true, A{ReasonEmailOK}, M{}},
+			"c@corp.example.com.evil.com": {false, A{ReasonEmailUnauthorized}, M{}},
+			"d@example.com":               {false, A{ReasonEmailUnauthorized}, M{}},
+		} {
+			res, err := evaluate(t, `
+allow:
+  and:
+    - email:
+        matches: .*@(corp|labs)\.example\.com
+`,
+				[]dataBrokerRecord{
+					&session.Session{
+						Id:     "SESSION_ID",
+						UserId: "USER_ID",
+					},
+					&user.User{
+						Id:    "USER_ID",
+						Email: email,
+					},
+				},
+				Input{Session: InputSession{ID: "SESSION_ID"}})
+			require.NoError(t, err)
+			require.Equal(t, expect, res["allow"], email)
+		}
+	})
 }
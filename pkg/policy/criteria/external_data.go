@@ -0,0 +1,131 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var externalDataValueBody = ast.Body{
+	ast.MustParseExpr(`
+		value := object.get(data.external, rule_path, null)
+	`),
+}
+
+// externalDataSubjects are the values external data may be checked to
+// contain.
+var externalDataSubjects = map[string]ast.Body{
+	"email": {
+		ast.MustParseExpr(`session := get_session(input.session.id)`),
+		ast.MustParseExpr(`user := get_user(session)`),
+		ast.MustParseExpr(`subject := get_user_email(session, user)`),
+		ast.MustParseExpr(`subject != ""`),
+	},
+	"user": {
+		ast.MustParseExpr(`session := get_session(input.session.id)`),
+		ast.MustParseExpr(`subject := session.user_id`),
+	},
+	"ip": {
+		ast.MustParseExpr(`subject := input.http.ip`),
+	},
+}
+
+type externalDataCriterion struct {
+	g *Generator
+}
+
+func (externalDataCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (externalDataCriterion) Name() string {
+	return "external_data"
+}
+
+func (c externalDataCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for external_data, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "source", "path", "contains", "is"); err != nil {
+		return nil, nil, fmt.Errorf("external_data: %w", err)
+	}
+
+	source, ok := obj["source"].(parser.String)
+	if !ok || source == "" {
+		return nil, nil, fmt.Errorf("external_data: source is required")
+	}
+	path := []*ast.Term{ast.StringTerm(string(source))}
+	if v, ok := obj["path"]; ok {
+		s, ok := v.(parser.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("external_data: expected string for path, got: %T", v)
+		}
+		for _, segment := range strings.Split(string(s), ".") {
+			if segment == "" {
+				return nil, nil, fmt.Errorf("external_data: invalid path: %s", s)
+			}
+			path = append(path, ast.StringTerm(segment))
+		}
+	}
+
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("rule_path"), ast.ArrayTerm(path...)),
+	}, externalDataValueBody...)
+
+	is, hasIs := obj["is"]
+	contains, hasContains := obj["contains"]
+	switch {
+	case hasIs && hasContains:
+		return nil, nil, fmt.Errorf("external_data: only one of is and contains may be set")
+	case hasIs:
+		body = append(body, ast.Equal.Expr(ast.VarTerm("value"), ast.NewTerm(is.RegoValue())))
+		rule := NewCriterionRule(c.g, c.Name(),
+			ReasonExternalDataOK, ReasonExternalDataUnauthorized,
+			body)
+		return rule, nil, nil
+	case hasContains:
+	default:
+		return nil, nil, fmt.Errorf("external_data: one of is or contains is required")
+	}
+
+	s, _ := contains.(parser.String)
+	subjectBody, ok := externalDataSubjects[string(s)]
+	if !ok {
+		return nil, nil, fmt.Errorf("external_data: contains must be one of email, user or ip, got: %s", contains)
+	}
+	body = append(body, subjectBody...)
+	body = append(body, ast.MustParseExpr(`value[_] == subject`))
+
+	if s == "ip" {
+		rule := NewCriterionRule(c.g, c.Name(),
+			ReasonExternalDataOK, ReasonExternalDataUnauthorized,
+			body)
+		return rule, nil, nil
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonExternalDataOK, ReasonExternalDataUnauthorized,
+		body)
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetUser(),
+		rules.GetUserEmail(),
+	}, nil
+}
+
+// ExternalData returns a Criterion which matches the document of an external
+// data source, either a value at a path in the document, or a list which
+// contains the user's email or id, or the client IP address.
+func ExternalData(generator *Generator) Criterion {
+	return externalDataCriterion{g: generator}
+}
+
+func init() {
+	Register(ExternalData)
+}
@@ -0,0 +1,112 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestExternalData(t *testing.T) {
+	records := []dataBrokerRecord{
+		&session.Session{Id: "SESSION1", UserId: "u1"},
+		&user.User{Id: "u1", Email: "u1@example.com"},
+		&session.Session{Id: "SESSION3", UserId: "u3"},
+		&user.User{Id: "u3", Email: "u3@example.com"},
+	}
+
+	t.Run("contains email", func(t *testing.T) {
+		policy := `
+allow:
+  and:
+    - external_data:
+        source: oncall
+        path: engineers
+        contains: email
+`
+		res, err := evaluate(t, policy, records, Input{Session: InputSession{ID: "SESSION1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonExternalDataOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+
+		res, err = evaluate(t, policy, records, Input{Session: InputSession{ID: "SESSION3"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonExternalDataUnauthorized}, M{}}, res["allow"])
+
+		res, err = evaluate(t, policy, records, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, M{}}, res["allow"])
+	})
+	t.Run("contains user", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - external_data:
+        source: oncall
+        path: users
+        contains: user
+`, records, Input{Session: InputSession{ID: "SESSION1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonExternalDataOK}, M{}}, res["allow"])
+	})
+	t.Run("contains ip", func(t *testing.T) {
+		policy := `
+allow:
+  and:
+    - external_data:
+        source: oncall
+        path: ips
+        contains: ip
+`
+		res, err := evaluate(t, policy, records, Input{HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonExternalDataOK}, M{}}, res["allow"])
+
+		res, err = evaluate(t, policy, records, Input{HTTP: InputHTTP{IP: "8.8.8.8"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonExternalDataUnauthorized}, M{}}, res["allow"])
+	})
+	t.Run("is", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  or:
+    - external_data:
+        source: flags
+        path: maintenance
+        is: true
+`, records, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonExternalDataUnauthorized}, M{}}, res["deny"])
+	})
+	t.Run("unknown source", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - external_data:
+        source: cmdb
+        contains: ip
+`, records, Input{HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonExternalDataUnauthorized}, M{}}, res["allow"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{
+			"oncall",
+			"{contains: email}",
+			"{source: oncall}",
+			"{source: oncall, contains: group}",
+			"{source: oncall, contains: email, is: true}",
+			"{source: oncall, path: a..b, is: true}",
+			"{source: oncall, url: x, is: true}",
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - external_data: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package criteria
+
+import (
+	"fmt"
+
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+// checkObjectFields returns an error if obj contains a field which is not in allowed.
+func checkObjectFields(obj parser.Object, allowed ...string) error {
+	for k := range obj {
+		known := false
+		for _, a := range allowed {
+			known = known || k == a
+		}
+		if !known {
+			return fmt.Errorf("unknown field: %s", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var geoIPASNBody = ast.Body{
+	ast.MustParseExpr(`
+		geoip := geoip_lookup(input.http.ip)
+	`),
+	ast.MustParseExpr(`
+		asn := object.get(geoip, "asn", 0)
+	`),
+	ast.MustParseExpr(`
+		rule_data[_] == asn
+	`),
+}
+
+type geoIPASNCriterion struct {
+	g *Generator
+}
+
+func (geoIPASNCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (geoIPASNCriterion) Name() string {
+	return "geoip_asn"
+}
+
+func (c geoIPASNCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var values []parser.Value
+	switch data := data.(type) {
+	case parser.Number:
+		values = append(values, data)
+	case parser.Array:
+		values = data
+	default:
+		return nil, nil, fmt.Errorf("expected number or array for geoip_asn, got: %T", data)
+	}
+
+	var asns []*ast.Term
+	for _, v := range values {
+		n, ok := v.(parser.Number)
+		if !ok {
+			return nil, nil, fmt.Errorf("geoip_asn: expected autonomous system number, got: %s", v)
+		}
+		asn, err := strconv.ParseUint(string(n), 10, 32)
+		if err != nil || asn == 0 {
+			return nil, nil, fmt.Errorf("geoip_asn: invalid autonomous system number: %s", n)
+		}
+		asns = append(asns, ast.UIntNumberTerm(asn))
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonGeoIPASNOK, ReasonGeoIPASNUnauthorized,
+		append(ast.Body{
+			ast.Assign.Expr(ast.VarTerm("rule_data"), ast.ArrayTerm(asns...)),
+		}, geoIPASNBody...))
+
+	return rule, nil, nil
+}
+
+// GeoIPASN returns a Criterion which matches the autonomous system the client
+// IP address belongs to.
+func GeoIPASN(generator *Generator) Criterion {
+	return geoIPASNCriterion{g: generator}
+}
+
+func init() {
+	Register(GeoIPASN)
+}
@@ -0,0 +1,40 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoIPASN(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - geoip_asn: [13335, 15169]
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonGeoIPASNOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - geoip_asn: 15169
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonGeoIPASNUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{"AS15169", "0", "1.5", "[-1]"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - geoip_asn: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var geoIPCountryBody = ast.Body{
+	ast.MustParseExpr(`
+		geoip := geoip_lookup(input.http.ip)
+	`),
+	ast.MustParseExpr(`
+		country := object.get(geoip, "country", "")
+	`),
+	ast.MustParseExpr(`
+		rule_data[_] == country
+	`),
+}
+
+type geoIPCountryCriterion struct {
+	g *Generator
+}
+
+func (geoIPCountryCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (geoIPCountryCriterion) Name() string {
+	return "geoip_country"
+}
+
+func (c geoIPCountryCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var values []parser.Value
+	switch data := data.(type) {
+	case parser.String:
+		values = append(values, data)
+	case parser.Array:
+		values = data
+	default:
+		return nil, nil, fmt.Errorf("expected string or array for geoip_country, got: %T", data)
+	}
+
+	var countries []*ast.Term
+	for _, v := range values {
+		s, ok := v.(parser.String)
+		if !ok || len(s) != 2 {
+			return nil, nil, fmt.Errorf("geoip_country: expected ISO 3166-1 alpha-2 country code, got: %s", v)
+		}
+		countries = append(countries, ast.StringTerm(strings.ToUpper(string(s))))
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonGeoIPCountryOK, ReasonGeoIPCountryUnauthorized,
+		append(ast.Body{
+			ast.Assign.Expr(ast.VarTerm("rule_data"), ast.ArrayTerm(countries...)),
+		}, geoIPCountryBody...))
+
+	return rule, nil, nil
+}
+
+// GeoIPCountry returns a Criterion which matches the country the client IP
+// address is located in.
+func GeoIPCountry(generator *Generator) Criterion {
+	return geoIPCountryCriterion{g: generator}
+}
+
+func init() {
+	Register(GeoIPCountry)
+}
@@ -0,0 +1,49 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoIPCountry(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - geoip_country: [us, ca]
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "8.8.8.8"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonGeoIPCountryOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - geoip_country: US
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonGeoIPCountryUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unknown ip", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  not:
+    - geoip_country: US
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "127.0.0.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonGeoIPCountryUnauthorized}, M{}}, res["deny"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{"USA", "[1]", "{is: US}"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - geoip_country: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+const (
+	defaultGroupsMaxDepth = 10
+	maxGroupsMaxDepth     = 32
+)
+
+var groupsBody = ast.Body{
+	ast.MustParseExpr(`
+		session := get_session(input.session.id)
+	`),
+	ast.MustParseExpr(`
+		session_claims := object.get(session, "claims", {})
+	`),
+	ast.MustParseExpr(`
+		user := get_user(session)
+	`),
+	ast.MustParseExpr(`
+		user_claims := object.get(user, "claims", {})
+	`),
+	ast.MustParseExpr(`
+		all_claims := object.union(session_claims, user_claims)
+	`),
+	ast.MustParseExpr(`
+		user_groups := object_get(all_claims, "groups", [])
+	`),
+}
+
+var nestedGroupsBody = ast.Body{
+	ast.MustParseExpr(`
+		rule_group == get_group_ancestors(user_groups, rule_max_depth)[_]
+	`),
+}
+
+type groupsCriterion struct {
+	g *Generator
+}
+
+func (groupsCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (groupsCriterion) Name() string {
+	return "groups"
+}
+
+func (c groupsCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for groups, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "has", "nested", "max_depth"); err != nil {
+		return nil, nil, fmt.Errorf("groups: %w", err)
+	}
+
+	group, ok := obj["has"].(parser.String)
+	if !ok || group == "" {
+		return nil, nil, fmt.Errorf("groups: has is required")
+	}
+
+	nested := false
+	if v, ok := obj["nested"]; ok {
+		b, ok := v.(parser.Boolean)
+		if !ok {
+			return nil, nil, fmt.Errorf("groups: expected boolean for nested, got: %T", v)
+		}
+		nested = bool(b)
+	}
+
+	maxDepth := uint64(defaultGroupsMaxDepth)
+	if v, ok := obj["max_depth"]; ok {
+		n, ok := v.(parser.Number)
+		if !ok {
+			return nil, nil, fmt.Errorf("groups: expected number for max_depth, got: %T", v)
+		}
+		var err error
+		maxDepth, err = strconv.ParseUint(string(n), 10, 64)
+		if err != nil || maxDepth > maxGroupsMaxDepth {
+			return nil, nil, fmt.Errorf("groups: max_depth must be between 0 and %d", maxGroupsMaxDepth)
+		}
+		if !nested {
+			return nil, nil, fmt.Errorf("groups: max_depth requires nested")
+		}
+	}
+
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("rule_group"), ast.StringTerm(string(group))),
+	}, groupsBody...)
+	if nested {
+		body = append(body, ast.Assign.Expr(ast.VarTerm("rule_max_depth"), ast.UIntNumberTerm(maxDepth)))
+		body = append(body, nestedGroupsBody...)
+	} else {
+		body = append(body, ast.MustParseExpr(`rule_group == user_groups[_]`))
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonGroupsOK, ReasonGroupsUnauthorized,
+		body)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetUser(),
+		rules.ObjectGet(),
+	}, nil
+}
+
+// Groups returns a Criterion on the groups of a user. Nested groups match
+// the group and all of its descendants in the group hierarchy, so granting
+// eng covers eng/platform and the groups synced as members of eng.
+func Groups(generator *Generator) Criterion {
+	return groupsCriterion{g: generator}
+}
+
+func init() {
+	Register(Groups)
+}
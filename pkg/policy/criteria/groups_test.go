@@ -0,0 +1,67 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestGroups(t *testing.T) {
+	records := []dataBrokerRecord{
+		&session.Session{
+			Id:     "SESSION_ID",
+			UserId: "USER_ID",
+		},
+		&user.User{
+			Id: "USER_ID",
+			Claims: map[string]*structpb.ListValue{
+				"groups": {Values: []*structpb.Value{structpb.NewStringValue("g-infra")}},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		policy string
+		expect A
+	}{
+		{"direct", `{has: g-infra}`, A{true, A{ReasonGroupsOK}, M{}}},
+		{"not nested", `{has: g-eng}`, A{false, A{ReasonGroupsUnauthorized}, M{}}},
+		{"nested", `{has: g-eng, nested: true}`, A{true, A{ReasonGroupsOK}, M{}}},
+		{"max depth", `{has: g-eng, nested: true, max_depth: 1}`, A{false, A{ReasonGroupsUnauthorized}, M{}}},
+	} {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - groups: `+tc.policy, records, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, res["allow"], tc.name)
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - groups:
+        has: g-eng
+        nested: true
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, M{}}, res["allow"])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{"g-eng", "{}", "{has: ''}", "{has: g-eng, nested: yes}", "{has: g-eng, nested: true, max_depth: 33}", "{has: g-eng, max_depth: 1}", "{group: g-eng}"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - groups: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
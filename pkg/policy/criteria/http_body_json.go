@@ -0,0 +1,87 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var httpBodyJSONBody = ast.Body{
+	ast.MustParseExpr(`
+		not input.http.body_truncated
+	`),
+	ast.MustParseExpr(`
+		json.is_valid(input.http.body)
+	`),
+	ast.MustParseExpr(`
+		request_body := json.unmarshal(input.http.body)
+	`),
+	ast.MustParseExpr(`
+		value := object.get(request_body, rule_path, null)
+	`),
+	ast.MustParseExpr(`
+		rule_data[_] == value
+	`),
+}
+
+type httpBodyJSONCriterion struct {
+	g *Generator
+}
+
+func (httpBodyJSONCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (httpBodyJSONCriterion) Name() string {
+	return "http_body_json"
+}
+
+func (c httpBodyJSONCriterion) GenerateRule(subPath string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	if subPath == "" {
+		return nil, nil, fmt.Errorf("http_body_json: a field is required, e.g. http_body_json/action")
+	}
+	var path []*ast.Term
+	for _, segment := range strings.Split(strings.ReplaceAll(subPath, "/", "."), ".") {
+		if segment == "" {
+			return nil, nil, fmt.Errorf("http_body_json: invalid field: %s", subPath)
+		}
+		path = append(path, ast.StringTerm(segment))
+	}
+
+	var values []*ast.Term
+	switch data := data.(type) {
+	case parser.Array:
+		for _, v := range data {
+			values = append(values, ast.NewTerm(v.RegoValue()))
+		}
+	case parser.Object:
+		return nil, nil, fmt.Errorf("http_body_json: expected value or array of values, got: %T", data)
+	default:
+		values = append(values, ast.NewTerm(data.RegoValue()))
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonHTTPBodyJSONOK, ReasonHTTPBodyJSONUnauthorized,
+		append(ast.Body{
+			ast.Assign.Expr(ast.VarTerm("rule_data"), ast.ArrayTerm(values...)),
+			ast.Assign.Expr(ast.VarTerm("rule_path"), ast.ArrayTerm(path...)),
+		}, httpBodyJSONBody...))
+
+	return rule, nil, nil
+}
+
+// HTTPBodyJSON returns a Criterion which matches a field of a JSON request
+// body, e.g. http_body_json/user.role, against a value or one of a list of
+// values. Truncated bodies never match, authorize rejects them before the
+// policy is evaluated so that they can't bypass deny rules.
+func HTTPBodyJSON(generator *Generator) Criterion {
+	return httpBodyJSONCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPBodyJSON)
+}
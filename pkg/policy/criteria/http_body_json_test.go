@@ -0,0 +1,46 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPBodyJSON(t *testing.T) {
+	policy := `
+allow:
+  and:
+    - http_body_json/request.action: [read, list]
+    - http_body_json/dry_run: true
+`
+	for _, tc := range []struct {
+		name      string
+		body      string
+		truncated bool
+		expect    A
+	}{
+		{"ok", `{"request": {"action": "list"}, "dry_run": true}`, false, A{true, A{ReasonHTTPBodyJSONOK}, M{}}},
+		{"unauthorized", `{"request": {"action": "delete"}, "dry_run": true}`, false, A{false, A{ReasonHTTPBodyJSONUnauthorized}, M{}}},
+		{"missing field", `{"request": {"action": "read"}}`, false, A{false, A{ReasonHTTPBodyJSONUnauthorized}, M{}}},
+		{"invalid json", `request.action=read`, false, A{false, A{ReasonHTTPBodyJSONUnauthorized}, M{}}},
+		{"truncated", `{"request": {"action": "read"}, "dry_run": true}`, true, A{false, A{ReasonHTTPBodyJSONUnauthorized}, M{}}},
+	} {
+		res, err := evaluate(t, policy, []dataBrokerRecord{}, Input{HTTP: InputHTTP{
+			Body:          tc.body,
+			BodyTruncated: tc.truncated,
+		}})
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, res["allow"], tc.name)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, criterion := range []string{"http_body_json: read", "http_body_json/a..b: read", "http_body_json/a: {is: read}"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - `+criterion, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, criterion)
+		}
+	})
+}
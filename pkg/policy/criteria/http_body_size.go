@@ -0,0 +1,80 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+type httpBodySizeCriterion struct {
+	g *Generator
+}
+
+func (httpBodySizeCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (httpBodySizeCriterion) Name() string {
+	return "http_body_size"
+}
+
+func (c httpBodySizeCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for http_body_size, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "min", "max"); err != nil {
+		return nil, nil, fmt.Errorf("http_body_size: %w", err)
+	}
+	if len(obj) == 0 {
+		return nil, nil, fmt.Errorf("http_body_size: min or max is required")
+	}
+
+	// the size is -1 when it's unknown, which never matches
+	body := ast.Body{
+		ast.MustParseExpr(`input.http.body_size >= 0`),
+	}
+	for _, k := range []string{"min", "max"} {
+		v, ok := obj[k]
+		if !ok {
+			continue
+		}
+		n, ok := v.(parser.Number)
+		if !ok {
+			return nil, nil, fmt.Errorf("http_body_size: expected number for %s, got: %T", k, v)
+		}
+		size, err := strconv.ParseUint(string(n), 10, 63)
+		if err != nil {
+			return nil, nil, fmt.Errorf("http_body_size: invalid %s: %s", k, n)
+		}
+
+		op := ast.LessThanEq
+		if k == "min" {
+			op = ast.GreaterThanEq
+		}
+		body = append(body, op.Expr(
+			ast.RefTerm(ast.VarTerm("input"), ast.StringTerm("http"), ast.StringTerm("body_size")),
+			ast.UIntNumberTerm(size),
+		))
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonHTTPBodySizeOK, ReasonHTTPBodySizeUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// HTTPBodySize returns a Criterion which matches the size of the request body
+// in bytes.
+func HTTPBodySize(generator *Generator) Criterion {
+	return httpBodySizeCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPBodySize)
+}
@@ -0,0 +1,42 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPBodySize(t *testing.T) {
+	policy := `
+allow:
+  and:
+    - http_body_size:
+        min: 1
+        max: 1024
+`
+	for _, tc := range []struct {
+		size   int64
+		expect A
+	}{
+		{0, A{false, A{ReasonHTTPBodySizeUnauthorized}, M{}}},
+		{1, A{true, A{ReasonHTTPBodySizeOK}, M{}}},
+		{1024, A{true, A{ReasonHTTPBodySizeOK}, M{}}},
+		{1025, A{false, A{ReasonHTTPBodySizeUnauthorized}, M{}}},
+		{-1, A{false, A{ReasonHTTPBodySizeUnauthorized}, M{}}},
+	} {
+		res, err := evaluate(t, policy, []dataBrokerRecord{}, Input{HTTP: InputHTTP{BodySize: tc.size}})
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, res["allow"], "size %d", tc.size)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{"1024", "{}", "{max: -1}", "{max: 1.5}", "{max: big}", "{limit: 10}"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - http_body_size: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
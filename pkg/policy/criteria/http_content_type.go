@@ -0,0 +1,51 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var httpContentTypeBody = ast.Body{
+	ast.MustParseExpr(`
+		content_type := lower(trim_space(split(object.get(input.http.headers, "Content-Type", ""), ";")[0]))
+	`),
+}
+
+type httpContentTypeCriterion struct {
+	g *Generator
+}
+
+func (httpContentTypeCriterion) DataType() CriterionDataType {
+	return CriterionDataTypeStringMatcher
+}
+
+func (httpContentTypeCriterion) Name() string {
+	return "http_content_type"
+}
+
+func (c httpContentTypeCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var body ast.Body
+	body = append(body, httpContentTypeBody...)
+
+	err := matchString(&body, ast.VarTerm("content_type"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonHTTPContentTypeOK, ReasonHTTPContentTypeUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// HTTPContentType returns a Criterion which matches the media type of the
+// request body, without any parameters, in lower case.
+func HTTPContentType(generator *Generator) Criterion {
+	return httpContentTypeCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPContentType)
+}
@@ -0,0 +1,46 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPContentType(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - http_content_type:
+        is: application/json
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Headers: map[string]string{
+			"Content-Type": "Application/JSON; charset=utf-8",
+		}}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonHTTPContentTypeOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - http_content_type:
+        is: application/json
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Headers: map[string]string{
+			"Content-Type": "text/plain",
+		}}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonHTTPContentTypeUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("missing", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - http_content_type:
+        is: application/json
+`, []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonHTTPContentTypeUnauthorized}, M{}}, res["allow"])
+	})
+}
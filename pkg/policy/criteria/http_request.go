@@ -0,0 +1,98 @@
+package criteria
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var httpMethodRE = regexp.MustCompile(`^[A-Z]+$`)
+
+type httpRequestCriterion struct {
+	g *Generator
+}
+
+func (httpRequestCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (httpRequestCriterion) Name() string {
+	return "http_request"
+}
+
+func (c httpRequestCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for http_request, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "methods", "path_regex"); err != nil {
+		return nil, nil, fmt.Errorf("http_request: %w", err)
+	}
+	if len(obj) == 0 {
+		return nil, nil, fmt.Errorf("http_request: methods or path_regex is required")
+	}
+
+	var body ast.Body
+	if v, ok := obj["methods"]; ok {
+		var values []parser.Value
+		if arr, ok := v.(parser.Array); ok {
+			values = arr
+		} else {
+			values = []parser.Value{v}
+		}
+		if len(values) == 0 {
+			return nil, nil, fmt.Errorf("http_request: methods must not be empty")
+		}
+
+		methods := make([]*ast.Term, 0, len(values))
+		for _, value := range values {
+			s, ok := value.(parser.String)
+			method := strings.ToUpper(string(s))
+			if !ok || !httpMethodRE.MatchString(method) {
+				return nil, nil, fmt.Errorf("http_request: invalid method: %s", value)
+			}
+			methods = append(methods, ast.StringTerm(method))
+		}
+		body = append(body,
+			ast.Assign.Expr(ast.VarTerm("rule_methods"), ast.SetTerm(methods...)),
+			ast.MustParseExpr(`rule_methods[input.http.method]`),
+		)
+	}
+
+	if v, ok := obj["path_regex"]; ok {
+		s, ok := v.(parser.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("http_request: expected string for path_regex, got: %T", v)
+		}
+		// rego regular expressions use the go (RE2) syntax
+		if _, err := regexp.Compile(string(s)); err != nil {
+			return nil, nil, fmt.Errorf("http_request: invalid path_regex: %w", err)
+		}
+		body = append(body, ast.RegexMatch.Expr(
+			ast.StringTerm(string(s)),
+			ast.RefTerm(ast.VarTerm("input"), ast.StringTerm("http"), ast.StringTerm("path")),
+		))
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonHTTPRequestOK, ReasonHTTPRequestUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// HTTPRequest returns a Criterion which matches both the HTTP method, one of
+// a set of methods, and the path, with an RE2 regular expression. Patterns
+// aren't anchored.
+func HTTPRequest(generator *Generator) Criterion {
+	return httpRequestCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPRequest)
+}
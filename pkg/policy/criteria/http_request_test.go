@@ -0,0 +1,59 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPRequest(t *testing.T) {
+	policy := `
+allow:
+  and:
+    - http_request:
+        methods: [get, HEAD]
+        path_regex: ^/api/v1/reports/.*
+deny:
+  or:
+    - http_request:
+        methods: DELETE
+        path_regex: ^/api/v1/reports/
+`
+	for _, tc := range []struct {
+		method, path string
+		allow, deny  A
+	}{
+		{"GET", "/api/v1/reports/1", A{true, A{ReasonHTTPRequestOK}, M{}}, A{false, A{ReasonHTTPRequestUnauthorized}, M{}}},
+		{"HEAD", "/api/v1/reports/", A{true, A{ReasonHTTPRequestOK}, M{}}, A{false, A{ReasonHTTPRequestUnauthorized}, M{}}},
+		{"POST", "/api/v1/reports/1", A{false, A{ReasonHTTPRequestUnauthorized}, M{}}, A{false, A{ReasonHTTPRequestUnauthorized}, M{}}},
+		{"GET", "/api/v2/reports/1", A{false, A{ReasonHTTPRequestUnauthorized}, M{}}, A{false, A{ReasonHTTPRequestUnauthorized}, M{}}},
+		{"DELETE", "/api/v1/reports/1", A{false, A{ReasonHTTPRequestUnauthorized}, M{}}, A{true, A{ReasonHTTPRequestOK}, M{}}},
+	} {
+		res, err := evaluate(t, policy, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Method: tc.method, Path: tc.path}})
+		require.NoError(t, err)
+		assert.Equal(t, tc.allow, res["allow"], "%s %s", tc.method, tc.path)
+		assert.Equal(t, tc.deny, res["deny"], "%s %s", tc.method, tc.path)
+	}
+
+	t.Run("path only", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - http_request:
+        path_regex: \.json$
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Method: "PUT", Path: "/a/b.json"}})
+		require.NoError(t, err)
+		assert.Equal(t, A{true, A{ReasonHTTPRequestOK}, M{}}, res["allow"])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{"GET", "{}", "{methods: []}", "{methods: [1]}", "{methods: G-T}", "{path_regex: 1}", "{path_regex: 'a(b'}", "{method: GET}"} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - http_request: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
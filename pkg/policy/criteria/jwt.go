@@ -0,0 +1,127 @@
+package criteria
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var jwtBody = ast.Body{
+	ast.MustParseExpr(`
+		raw_jwt := trim_prefix(object.get(input.http.headers, rule_header, ""), rule_prefix)
+	`),
+	ast.MustParseExpr(`
+		raw_jwt != ""
+	`),
+	ast.MustParseExpr(`
+		jwt_claims := verify_jwt(raw_jwt, rule_jwks_url)
+	`),
+}
+
+type jwtCriterion struct {
+	g *Generator
+}
+
+func (jwtCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (jwtCriterion) Name() string {
+	return "jwt"
+}
+
+func (c jwtCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for jwt, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "header", "jwks_url", "claims"); err != nil {
+		return nil, nil, fmt.Errorf("jwt: %w", err)
+	}
+
+	jwksURL, ok := obj["jwks_url"].(parser.String)
+	if !ok || jwksURL == "" {
+		return nil, nil, fmt.Errorf("jwt: jwks_url is required")
+	}
+	if u, err := url.Parse(string(jwksURL)); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, nil, fmt.Errorf("jwt: invalid jwks_url: %s", jwksURL)
+	}
+
+	header := "Authorization"
+	if v, ok := obj["header"]; ok {
+		s, ok := v.(parser.String)
+		if !ok || s == "" {
+			return nil, nil, fmt.Errorf("jwt: expected header name for header, got: %s", v)
+		}
+		header = http.CanonicalHeaderKey(string(s))
+	}
+	// bearer tokens are sent in the authorization header
+	prefix := ""
+	if header == "Authorization" {
+		prefix = "Bearer "
+	}
+
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("rule_header"), ast.StringTerm(header)),
+		ast.Assign.Expr(ast.VarTerm("rule_prefix"), ast.StringTerm(prefix)),
+		ast.Assign.Expr(ast.VarTerm("rule_jwks_url"), ast.StringTerm(string(jwksURL))),
+	}, jwtBody...)
+
+	if v, ok := obj["claims"]; ok {
+		claims, ok := v.(parser.Object)
+		if !ok {
+			return nil, nil, fmt.Errorf("jwt: expected object for claims, got: %T", v)
+		}
+		names := make([]string, 0, len(claims))
+		for name := range claims {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// every claim has to match each of its values
+		for _, name := range names {
+			var values []parser.Value
+			switch t := claims[name].(type) {
+			case parser.Array:
+				values = t
+			case parser.Object:
+				return nil, nil, fmt.Errorf("jwt: expected value or array of values for claim %s, got: %T", name, t)
+			default:
+				values = []parser.Value{t}
+			}
+			for _, value := range values {
+				body = append(body, ast.NewExpr([]*ast.Term{
+					ast.RefTerm(ast.VarTerm("jwt_claim_matches")),
+					ast.CallTerm(ast.RefTerm(ast.VarTerm("object"), ast.StringTerm("get")),
+						ast.VarTerm("jwt_claims"), ast.StringTerm(name), ast.NullTerm()),
+					ast.NewTerm(value.RegoValue()),
+				}))
+			}
+		}
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonJWTOK, ReasonJWTUnauthorized,
+		body)
+	return rule, []*ast.Rule{
+		rules.JWTClaimMatches(),
+	}, nil
+}
+
+// JWT returns a Criterion which matches a third-party JWT presented in a
+// request header, by default as a bearer token. The JWT has to be signed by a
+// key of the JWKS at jwks_url, and its claims have to match the given values.
+func JWT(generator *Generator) Criterion {
+	return jwtCriterion{g: generator}
+}
+
+func init() {
+	Register(JWT)
+}
@@ -0,0 +1,66 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWT(t *testing.T) {
+	policy := `
+allow:
+  and:
+    - jwt:
+        jwks_url: https://partner.example.com/jwks.json
+        claims:
+          iss: https://partner.example.com
+          aud: https://api.example.com
+          scope: [orders:read, orders:write]
+`
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		expect  A
+	}{
+		{"ok", map[string]string{"Authorization": "Bearer partner-jwt"}, A{true, A{ReasonJWTOK}, M{}}},
+		{"claims mismatch", map[string]string{"Authorization": "Bearer other-jwt"}, A{false, A{ReasonJWTUnauthorized}, M{}}},
+		{"invalid jwt", map[string]string{"Authorization": "Bearer invalid-jwt"}, A{false, A{ReasonJWTUnauthorized}, M{}}},
+		{"missing", map[string]string{}, A{false, A{ReasonJWTUnauthorized}, M{}}},
+	} {
+		res, err := evaluate(t, policy, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Headers: tc.headers}})
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, res["allow"], tc.name)
+	}
+
+	t.Run("header", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - jwt:
+        header: x-partner-token
+        jwks_url: https://partner.example.com/jwks.json
+        claims:
+          scope: orders:read
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Headers: map[string]string{"X-Partner-Token": "other-jwt"}}})
+		require.NoError(t, err)
+		assert.Equal(t, A{true, A{ReasonJWTOK}, M{}}, res["allow"])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, criterion := range []string{
+			"jwt: partner",
+			"jwt: {}",
+			"jwt: {jwks_url: partner.example.com}",
+			"jwt: {jwks_url: https://partner.example.com/jwks.json, claims: [iss]}",
+			"jwt: {jwks_url: https://partner.example.com/jwks.json, claims: {iss: {is: x}}}",
+			"jwt: {jwks_url: https://partner.example.com/jwks.json, issuer: x}",
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - `+criterion, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, criterion)
+		}
+	})
+}
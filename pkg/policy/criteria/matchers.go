@@ -2,6 +2,7 @@ package criteria
 
 import (
 	"fmt"
+	"regexp"
 
 	"github.com/open-policy-agent/opa/ast"
 
@@ -19,7 +20,9 @@ func matchString(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	lookup := map[string]matcher{
 		"contains":    matchStringContains,
 		"ends_with":   matchStringEndsWith,
+		"in":          matchStringIn,
 		"is":          matchStringIs,
+		"matches":     matchStringMatches,
 		"starts_with": matchStringStartsWith,
 	}
 	for k, v := range obj {
@@ -45,6 +48,42 @@ func matchStringEndsWith(dst *ast.Body, left *ast.Term, right parser.Value) erro
 	return nil
 }
 
+// matchStringIn matches any of a list of strings.
+func matchStringIn(dst *ast.Body, left *ast.Term, right parser.Value) error {
+	arr, ok := right.(parser.Array)
+	if !ok || len(arr) == 0 {
+		return fmt.Errorf("expected array of strings for in, got: %s", right)
+	}
+	values := make([]*ast.Term, 0, len(arr))
+	for _, v := range arr {
+		s, ok := v.(parser.String)
+		if !ok {
+			return fmt.Errorf("expected array of strings for in, got: %s", right)
+		}
+		values = append(values, ast.StringTerm(string(s)))
+	}
+	*dst = append(*dst, ast.GreaterThan.Expr(
+		ast.Count.Call(ast.And.Call(ast.SetTerm(left), ast.SetTerm(values...))),
+		ast.IntNumberTerm(0),
+	))
+	return nil
+}
+
+// matchStringMatches matches an RE2 regular expression, which has to match
+// the whole string.
+func matchStringMatches(dst *ast.Body, left *ast.Term, right parser.Value) error {
+	s, ok := right.(parser.String)
+	if !ok {
+		return fmt.Errorf("expected string for matches, got: %T", right)
+	}
+	pattern := "^(?:" + string(s) + ")$"
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid regular expression for matches: %w", err)
+	}
+	*dst = append(*dst, ast.RegexMatch.Expr(ast.StringTerm(pattern), left))
+	return nil
+}
+
 func matchStringIs(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	*dst = append(*dst, ast.Equal.Expr(left, ast.NewTerm(right.RegoValue())))
 	return nil
@@ -42,6 +42,30 @@ func TestStringMatcher(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, `example == "test"`, str(body))
 	})
+	t.Run("in", func(t *testing.T) {
+		var body ast.Body
+		err := matchString(&body, ast.VarTerm("example"), parser.Object{
+			"in": parser.Array{parser.String("a"), parser.String("b")},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `count({example} & {"a", "b"}) > 0`, str(body))
+
+		for _, v := range []parser.Value{parser.String("a"), parser.Array{}, parser.Array{parser.Number("1")}} {
+			err := matchString(&body, ast.VarTerm("example"), parser.Object{"in": v})
+			assert.Error(t, err)
+		}
+	})
+	t.Run("matches", func(t *testing.T) {
+		var body ast.Body
+		err := matchString(&body, ast.VarTerm("example"), parser.Object{
+			"matches": parser.String(`.*@(corp|labs)\.example\.com`),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `regex.match("^(?:.*@(corp|labs)\\.example\\.com)$", example)`, str(body))
+
+		err = matchString(&body, ast.VarTerm("example"), parser.Object{"matches": parser.String("a(b")})
+		assert.Error(t, err)
+	})
 	t.Run("starts_with", func(t *testing.T) {
 		var body ast.Body
 		err := matchString(&body, ast.VarTerm("example"), parser.Object{
@@ -0,0 +1,96 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+const defaultRateLimitWindow = time.Minute
+
+var rateLimitBody = ast.Body{
+	ast.MustParseExpr(`
+		session := get_session(input.session.id)
+	`),
+	ast.MustParseExpr(`
+		subject := get_rate_limit_subject(session)
+	`),
+	ast.MustParseExpr(`
+		rate_limit(subject, requests, window)
+	`),
+}
+
+type rateLimitCriterion struct {
+	g *Generator
+}
+
+func (rateLimitCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (rateLimitCriterion) Name() string {
+	return "rate_limit"
+}
+
+func (c rateLimitCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for rate_limit, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "requests", "window"); err != nil {
+		return nil, nil, fmt.Errorf("rate_limit: %w", err)
+	}
+
+	n, ok := obj["requests"].(parser.Number)
+	if !ok {
+		return nil, nil, fmt.Errorf("rate_limit: expected number for requests, got: %T", obj["requests"])
+	}
+	requests, err := strconv.ParseUint(string(n), 10, 32)
+	if err != nil || requests == 0 {
+		return nil, nil, fmt.Errorf("rate_limit: invalid number of requests: %s", n)
+	}
+
+	window := defaultRateLimitWindow
+	if v, ok := obj["window"]; ok {
+		s, ok := v.(parser.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("rate_limit: expected string for window, got: %T", v)
+		}
+		window, err = time.ParseDuration(string(s))
+		if err != nil {
+			return nil, nil, fmt.Errorf("rate_limit: invalid window: %w", err)
+		}
+		if window < time.Second || window%time.Second != 0 {
+			return nil, nil, fmt.Errorf("rate_limit: window must be a whole number of seconds: %s", s)
+		}
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonRateLimitOK, ReasonRateLimitExceeded,
+		append(ast.Body{
+			ast.Assign.Expr(ast.VarTerm("requests"), ast.UIntNumberTerm(requests)),
+			ast.Assign.Expr(ast.VarTerm("window"), ast.IntNumberTerm(int(window/time.Second))),
+		}, rateLimitBody...))
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetRateLimitSubject(),
+	}, nil
+}
+
+// RateLimit returns a Criterion which matches while the number of requests
+// a user, or without a session, a client IP address, makes to the route in a
+// fixed window is within the limit.
+func RateLimit(generator *Generator) Criterion {
+	return rateLimitCriterion{g: generator}
+}
+
+func init() {
+	Register(RateLimit)
+}
@@ -0,0 +1,87 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - rate_limit:
+        requests: 10
+        window: 1m
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "u1"},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonRateLimitOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("exceeded", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - rate_limit:
+        requests: 5
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "u1"},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonRateLimitExceeded}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("other user", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - rate_limit:
+        requests: 5
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "u2"},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}, HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonRateLimitOK}, M{}}, res["allow"])
+	})
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  not:
+    - rate_limit:
+        requests: 5
+        window: 10s
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "1.1.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonRateLimitExceeded}, M{}}, res["deny"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{
+			"5",
+			"{}",
+			"{requests: 0}",
+			"{requests: -1}",
+			"{requests: 5, window: 1}",
+			"{requests: 5, window: 500ms}",
+			"{requests: 5, window: 1.5s}",
+			"{requests: 5, burst: 10}",
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - rate_limit: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
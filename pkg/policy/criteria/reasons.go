@@ -8,26 +8,66 @@ type Reason string
 // Well-known reasons.
 const (
 	ReasonAccept                               = "accept"
+	ReasonAccessRequestApproved                = "access-request-approved"
+	ReasonACROK                                = "acr-ok"
+	ReasonACRUnauthorized                      = "acr-unauthorized"
+	ReasonAMROK                                = "amr-ok"
+	ReasonAMRUnauthorized                      = "amr-unauthorized"
+	ReasonCedarPolicyForbidden                 = "cedar-policy-forbidden"
+	ReasonCedarPolicyOK                        = "cedar-policy-ok"
+	ReasonCedarPolicyUnauthorized              = "cedar-policy-unauthorized"
 	ReasonClaimOK                              = "claim-ok"
 	ReasonClaimUnauthorized                    = "claim-unauthorized"
+	ReasonClientCertificateOK                  = "client-certificate-ok"
+	ReasonClientCertificateUnauthorized        = "client-certificate-unauthorized"
 	ReasonCORSRequest                          = "cors-request"
+	ReasonDayOfWeekOK                          = "day-of-week-ok"
+	ReasonDayOfWeekUnauthorized                = "day-of-week-unauthorized"
 	ReasonDeviceOK                             = "device-ok"
+	ReasonDevicePostureOK                      = "device-posture-ok"
+	ReasonDevicePostureUnauthorized            = "device-posture-unauthorized"
 	ReasonDeviceUnauthenticated                = "device-unauthenticated"
 	ReasonDeviceUnauthorized                   = "device-unauthorized"
 	ReasonDomainOK                             = "domain-ok"
 	ReasonDomainUnauthorized                   = "domain-unauthorized"
 	ReasonEmailOK                              = "email-ok"
 	ReasonEmailUnauthorized                    = "email-unauthorized"
+	ReasonExternalDataOK                       = "external-data-ok"
+	ReasonExternalDataUnauthorized             = "external-data-unauthorized"
+	ReasonGeoIPASNOK                           = "geoip-asn-ok"
+	ReasonGeoIPASNUnauthorized                 = "geoip-asn-unauthorized"
+	ReasonGeoIPCountryOK                       = "geoip-country-ok"
+	ReasonGeoIPCountryUnauthorized             = "geoip-country-unauthorized"
+	ReasonGroupsOK                             = "groups-ok"
+	ReasonGroupsUnauthorized                   = "groups-unauthorized"
+	ReasonHTTPBodyJSONOK                       = "http-body-json-ok"
+	ReasonHTTPBodyJSONUnauthorized             = "http-body-json-unauthorized"
+	ReasonHTTPBodySizeOK                       = "http-body-size-ok"
+	ReasonHTTPBodySizeUnauthorized             = "http-body-size-unauthorized"
+	ReasonHTTPContentTypeOK                    = "http-content-type-ok"
+	ReasonHTTPContentTypeUnauthorized          = "http-content-type-unauthorized"
 	ReasonHTTPMethodOK                         = "http-method-ok"
 	ReasonHTTPMethodUnauthorized               = "http-method-unauthorized"
 	ReasonHTTPPathOK                           = "http-path-ok"
 	ReasonHTTPPathUnauthorized                 = "http-path-unauthorized"
+	ReasonHTTPRequestOK                        = "http-request-ok"
+	ReasonHTTPRequestUnauthorized              = "http-request-unauthorized"
 	ReasonInvalidClientCertificate             = "invalid-client-certificate"
+	ReasonJWTOK                                = "jwt-ok"
+	ReasonJWTUnauthorized                      = "jwt-unauthorized"
 	ReasonNonCORSRequest                       = "non-cors-request"
 	ReasonNonPomeriumRoute                     = "non-pomerium-route"
 	ReasonPomeriumRoute                        = "pomerium-route"
+	ReasonRateLimitExceeded                    = "rate-limit-exceeded"
+	ReasonRateLimitOK                          = "rate-limit-ok"
 	ReasonReject                               = "reject"
 	ReasonRouteNotFound                        = "route-not-found"
+	ReasonScheduleOK                           = "schedule-ok"
+	ReasonScheduleUnauthorized                 = "schedule-unauthorized"
+	ReasonStepUpOK                             = "step-up-ok"
+	ReasonStepUpRequired                       = "step-up-required" // user needs to sign in again
+	ReasonTimeOfDayOK                          = "time-of-day-ok"
+	ReasonTimeOfDayUnauthorized                = "time-of-day-unauthorized"
 	ReasonUserOK                               = "user-ok"
 	ReasonUserUnauthenticated                  = "user-unauthenticated" // user needs to log in
 	ReasonUserUnauthorized                     = "user-unauthorized"    // user does not have access
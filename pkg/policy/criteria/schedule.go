@@ -0,0 +1,281 @@
+package criteria
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+const (
+	defaultTimezone = "UTC"
+	minutesPerDay   = 24 * 60
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// A scheduleWindow is a time window on some days of the week. after and
+// before are minutes of the day, and after < before.
+type scheduleWindow struct {
+	days          []time.Weekday
+	after, before int
+}
+
+// newScheduleWindows creates the windows for the days and times. A window
+// which ends before it starts, e.g. 22:00 to 02:00, continues on the next day.
+func newScheduleWindows(days []time.Weekday, after, before int) []scheduleWindow {
+	if after < before {
+		return []scheduleWindow{{days: days, after: after, before: before}}
+	}
+
+	nextDays := make([]time.Weekday, 0, len(days))
+	for _, d := range days {
+		nextDays = append(nextDays, (d+1)%7)
+	}
+	ws := []scheduleWindow{{days: days, after: after, before: minutesPerDay}}
+	if before > 0 {
+		ws = append(ws, scheduleWindow{days: nextDays, after: 0, before: before})
+	}
+	return ws
+}
+
+func scheduleWindowsTerm(windows []scheduleWindow) *ast.Term {
+	var terms []*ast.Term
+	for _, w := range windows {
+		var days []*ast.Term
+		for _, d := range w.days {
+			days = append(days, ast.StringTerm(d.String()))
+		}
+		terms = append(terms, ast.ObjectTerm(
+			[2]*ast.Term{ast.StringTerm("days"), ast.ArrayTerm(days...)},
+			[2]*ast.Term{ast.StringTerm("after"), ast.IntNumberTerm(w.after)},
+			[2]*ast.Term{ast.StringTerm("before"), ast.IntNumberTerm(w.before)},
+		))
+	}
+	return ast.ArrayTerm(terms...)
+}
+
+// newScheduleRule generates a criterion rule which passes when the current
+// time is within one of the windows.
+func newScheduleRule(
+	g *generator.Generator,
+	name string,
+	passReason, failReason Reason,
+	timezone string,
+	windows []scheduleWindow,
+) (*ast.Rule, []*ast.Rule) {
+	rule := NewCriterionRule(g, name,
+		passReason, failReason,
+		ast.Body{
+			ast.Assign.Expr(ast.VarTerm("windows"), scheduleWindowsTerm(windows)),
+			ast.Assign.Expr(ast.VarTerm("timezone"), ast.StringTerm(timezone)),
+			ast.MustParseExpr(`in_schedule(windows, timezone)`),
+		})
+	return rule, []*ast.Rule{
+		rules.InSchedule(),
+	}
+}
+
+func allWeekdays() []time.Weekday {
+	return []time.Weekday{
+		time.Sunday, time.Monday, time.Tuesday, time.Wednesday,
+		time.Thursday, time.Friday, time.Saturday,
+	}
+}
+
+// parseTimezone parses an IANA timezone, e.g. America/New_York.
+func parseTimezone(v parser.Value) (string, error) {
+	if v == nil {
+		return defaultTimezone, nil
+	}
+	s, ok := v.(parser.String)
+	if !ok {
+		return "", fmt.Errorf("expected string for timezone, got: %T", v)
+	}
+	if _, err := time.LoadLocation(string(s)); err != nil {
+		return "", fmt.Errorf("invalid timezone: %w", err)
+	}
+	return string(s), nil
+}
+
+// parseTimeOfDay parses a time of day in the form HH:MM into minutes. 24:00
+// is the end of the day.
+func parseTimeOfDay(v parser.Value) (int, error) {
+	s, ok := v.(parser.String)
+	if !ok {
+		return 0, fmt.Errorf("expected string for time of day, got: %T", v)
+	}
+	hh, mm, ok := strings.Cut(string(s), ":")
+	if !ok || len(hh) != 2 || len(mm) != 2 {
+		return 0, fmt.Errorf("invalid time of day, expected HH:MM: %s", s)
+	}
+	h, err := strconv.Atoi(hh)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day, expected HH:MM: %s", s)
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day, expected HH:MM: %s", s)
+	}
+	minutes := h*60 + m
+	if h < 0 || m < 0 || m > 59 || minutes > minutesPerDay {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	return minutes, nil
+}
+
+// parseTimeRange parses the after and before times of day of an object,
+// which default to the start and the end of the day.
+func parseTimeRange(obj parser.Object) (after, before int, err error) {
+	after, before = 0, minutesPerDay
+	if v, ok := obj["after"]; ok {
+		if after, err = parseTimeOfDay(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	if v, ok := obj["before"]; ok {
+		if before, err = parseTimeOfDay(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	if after == minutesPerDay {
+		return 0, 0, fmt.Errorf("invalid time range: after must be before 24:00")
+	}
+	if after == before {
+		return 0, 0, fmt.Errorf("empty time range: after and before are the same time")
+	}
+	return after, before, nil
+}
+
+// parseDays parses a day or a list of days. A day is the name of the day,
+// e.g. monday or mon, or a range of days, e.g. mon-fri.
+func parseDays(v parser.Value) ([]time.Weekday, error) {
+	var values []parser.Value
+	switch v := v.(type) {
+	case parser.String:
+		values = append(values, v)
+	case parser.Array:
+		values = v
+	default:
+		return nil, fmt.Errorf("expected string or array for days, got: %T", v)
+	}
+
+	seen := make(map[time.Weekday]bool)
+	var days []time.Weekday
+	for _, value := range values {
+		s, ok := value.(parser.String)
+		if !ok {
+			return nil, fmt.Errorf("expected string for day, got: %T", value)
+		}
+
+		first, last, isRange := strings.Cut(strings.ToLower(string(s)), "-")
+		start, ok := weekdayNames[strings.TrimSpace(first)]
+		if !ok {
+			return nil, fmt.Errorf("invalid day: %s", s)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdayNames[strings.TrimSpace(last)]; !ok {
+				return nil, fmt.Errorf("invalid day: %s", s)
+			}
+		}
+		// ranges may wrap around the end of the week, e.g. fri-mon
+		for d := start; ; d = (d + 1) % 7 {
+			if !seen[d] {
+				seen[d] = true
+				days = append(days, d)
+			}
+			if d == end {
+				break
+			}
+		}
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("at least one day is required")
+	}
+	return days, nil
+}
+
+type scheduleCriterion struct {
+	g *Generator
+}
+
+func (scheduleCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (scheduleCriterion) Name() string {
+	return "schedule"
+}
+
+func (c scheduleCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for schedule, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "timezone", "windows"); err != nil {
+		return nil, nil, fmt.Errorf("schedule: %w", err)
+	}
+
+	timezone, err := parseTimezone(obj["timezone"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("schedule: %w", err)
+	}
+
+	rawWindows, ok := obj["windows"].(parser.Array)
+	if !ok || len(rawWindows) == 0 {
+		return nil, nil, fmt.Errorf("schedule: expected a non-empty array of windows")
+	}
+	var windows []scheduleWindow
+	for _, rawWindow := range rawWindows {
+		w, ok := rawWindow.(parser.Object)
+		if !ok {
+			return nil, nil, fmt.Errorf("schedule: expected object for window, got: %T", rawWindow)
+		}
+		if err := checkObjectFields(w, "days", "after", "before"); err != nil {
+			return nil, nil, fmt.Errorf("schedule: %w", err)
+		}
+
+		days := allWeekdays()
+		if v, ok := w["days"]; ok {
+			if days, err = parseDays(v); err != nil {
+				return nil, nil, fmt.Errorf("schedule: %w", err)
+			}
+		}
+		after, before, err := parseTimeRange(w)
+		if err != nil {
+			return nil, nil, fmt.Errorf("schedule: %w", err)
+		}
+		windows = append(windows, newScheduleWindows(days, after, before)...)
+	}
+
+	rule, additionalRules := newScheduleRule(c.g, c.Name(),
+		ReasonScheduleOK, ReasonScheduleUnauthorized,
+		timezone, windows)
+	return rule, additionalRules, nil
+}
+
+// Schedule returns a Criterion which matches when the current time is within
+// one of a list of windows, each on some days of the week and between two
+// times of day.
+func Schedule(generator *Generator) Criterion {
+	return scheduleCriterion{g: generator}
+}
+
+func init() {
+	Register(Schedule)
+}
@@ -0,0 +1,72 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	now := testingNow.In(loc)
+	today := strings.ToLower(now.Weekday().String())
+	yesterday := strings.ToLower(((now.Weekday() + 6) % 7).String())
+
+	schedule := func(t *testing.T, windows string) A {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - schedule:
+        timezone: America/New_York
+        windows: `+windows, []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		return res["allow"].(A)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		res := schedule(t, fmt.Sprintf(`
+          - days: %s
+            after: "%s"
+            before: "%s"
+          - days: %s
+            after: "00:00"
+            before: "00:01"
+`, today, now.Add(-time.Minute).Format("15:04"), now.Add(time.Minute).Format("15:04"), yesterday))
+		require.Equal(t, A{true, A{ReasonScheduleOK}, M{}}, res)
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res := schedule(t, fmt.Sprintf(`
+          - days: %s
+            after: "%s"
+            before: "%s"
+`, yesterday, now.Add(-time.Minute).Format("15:04"), now.Add(time.Minute).Format("15:04")))
+		require.Equal(t, A{false, A{ReasonScheduleUnauthorized}, M{}}, res)
+	})
+	t.Run("continues on the next day", func(t *testing.T) {
+		// a window which ends before it starts continues on the next day, so
+		// one starting yesterday evening covers today until its end
+		res := schedule(t, fmt.Sprintf(`
+          - days: %s
+            after: "23:59"
+            before: "%s"
+`, yesterday, now.Add(time.Minute).Format("15:04")))
+		require.Equal(t, A{true, A{ReasonScheduleOK}, M{}}, res)
+
+		res = schedule(t, fmt.Sprintf(`
+          - days: %s
+            after: "23:59"
+            before: "%s"
+`, today, now.Add(time.Minute).Format("15:04")))
+		require.Equal(t, A{false, A{ReasonScheduleUnauthorized}, M{}}, res)
+	})
+	t.Run("all days", func(t *testing.T) {
+		res := schedule(t, fmt.Sprintf(`
+          - after: "%s"
+`, now.Add(-time.Minute).Format("15:04")))
+		require.Equal(t, A{true, A{ReasonScheduleOK}, M{}}, res)
+	})
+}
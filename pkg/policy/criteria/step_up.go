@@ -0,0 +1,151 @@
+package criteria
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+// stepUpSignals are the risk signals which may trigger a step-up.
+var stepUpSignals = map[string]bool{
+	"new_ip":         true,
+	"new_user_agent": true,
+}
+
+var stepUpLoginBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`session.id != ""`),
+	ast.MustParseExpr(`not step_up_login_required(session, signals, max_age)`),
+}
+
+var stepUpWebAuthnBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`session.id != ""`),
+	ast.MustParseExpr(`not step_up_webauthn_required(session, signals)`),
+}
+
+var stepUpLoginRequired = ast.MustParseRule(`
+step_up_login_required(session, signals, max_age) {
+	step_up_risk(session, signals)
+	not step_up_recent(session, max_age)
+}
+`)
+
+var stepUpWebAuthnRequired = ast.MustParseRule(`
+step_up_webauthn_required(session, signals) {
+	step_up_risk(session, signals)
+	count(object.get(session, "device_credentials", [])) == 0
+}
+`)
+
+type stepUpCriterion struct {
+	g *Generator
+}
+
+func (stepUpCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (stepUpCriterion) Name() string {
+	return "step_up"
+}
+
+func (c stepUpCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for step_up, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "max_age", "when", "method"); err != nil {
+		return nil, nil, fmt.Errorf("step_up: %w", err)
+	}
+
+	var signals []*ast.Term
+	if v, ok := obj["when"]; ok {
+		arr, ok := v.(parser.Array)
+		if !ok {
+			return nil, nil, fmt.Errorf("step_up: expected array for when, got: %T", v)
+		}
+		for _, e := range arr {
+			s, ok := e.(parser.String)
+			if !ok || !stepUpSignals[string(s)] {
+				return nil, nil, fmt.Errorf("step_up: unknown risk signal: %s", e)
+			}
+			signals = append(signals, ast.StringTerm(string(s)))
+		}
+		if len(signals) == 0 {
+			return nil, nil, fmt.Errorf("step_up: when must not be empty")
+		}
+	}
+	body := ast.Body{
+		ast.Assign.Expr(ast.VarTerm("signals"), ast.ArrayTerm(signals...)),
+	}
+
+	method := "login"
+	if v, ok := obj["method"]; ok {
+		s, ok := v.(parser.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("step_up: expected string for method, got: %T", v)
+		}
+		method = string(s)
+	}
+
+	switch method {
+	case "login":
+	case "webauthn":
+		if _, ok := obj["max_age"]; ok {
+			return nil, nil, fmt.Errorf("step_up: max_age is not supported for the webauthn method")
+		}
+		rule := NewCriterionSessionRule(c.g, c.Name(),
+			ReasonStepUpOK, ReasonDeviceUnauthenticated,
+			append(body, stepUpWebAuthnBody...))
+		return rule, []*ast.Rule{
+			rules.GetSession(),
+			rules.StepUpRisk(),
+			stepUpWebAuthnRequired,
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("step_up: method must be one of login or webauthn, got: %s", method)
+	}
+
+	s, ok := obj["max_age"].(parser.String)
+	if !ok {
+		return nil, nil, fmt.Errorf("step_up: expected string for max_age, got: %T", obj["max_age"])
+	}
+	maxAge, err := time.ParseDuration(string(s))
+	if err != nil {
+		return nil, nil, fmt.Errorf("step_up: invalid max_age: %w", err)
+	}
+	if maxAge < time.Second || maxAge%time.Second != 0 {
+		return nil, nil, fmt.Errorf("step_up: max_age must be a whole number of seconds: %s", s)
+	}
+	body = append(body, ast.Assign.Expr(ast.VarTerm("max_age"), ast.IntNumberTerm(int(maxAge/time.Second))))
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonStepUpOK, ReasonStepUpRequired,
+		append(body, stepUpLoginBody...))
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.StepUpRisk(),
+		rules.StepUpRecent(),
+		stepUpLoginRequired,
+	}, nil
+}
+
+// StepUp returns a Criterion which fails with "step-up-required" when one of
+// the risk signals is present for the session and the user hasn't signed in
+// within the max age, so that the user is asked to sign in again. Without risk
+// signals the step-up always applies, which is useful for high-value routes.
+// With the webauthn method the criterion fails with "device-unauthenticated"
+// instead, unless the session has a device credential.
+func StepUp(generator *Generator) Criterion {
+	return stepUpCriterion{g: generator}
+}
+
+func init() {
+	Register(StepUp)
+}
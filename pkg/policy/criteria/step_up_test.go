@@ -0,0 +1,159 @@
+package criteria
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestStepUp(t *testing.T) {
+	old := timestamppb.New(testingNow.Add(-time.Hour))
+	t.Run("no risk", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        max_age: 15m
+        when: [new_ip, new_user_agent]
+`,
+			[]dataBrokerRecord{
+				&session.Session{
+					Id: "SESSION_ID", UserId: "USER_ID", IssuedAt: old,
+					IpAddress: "1.1.1.1", UserAgent: "curl",
+				},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}, HTTP: InputHTTP{
+				IP:      "1.1.1.1",
+				Headers: map[string]string{"User-Agent": "curl"},
+			}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonStepUpOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("new ip", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        max_age: 15m
+        when: [new_ip]
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "USER_ID", IssuedAt: old, IpAddress: "1.1.1.1"},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}, HTTP: InputHTTP{IP: "2.2.2.2"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonStepUpRequired}, M{}}, res["allow"])
+	})
+	t.Run("new user agent", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        max_age: 15m
+        when: [new_user_agent]
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "USER_ID", IssuedAt: old, UserAgent: "curl"},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}, HTTP: InputHTTP{
+				Headers: map[string]string{"User-Agent": "firefox"},
+			}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonStepUpRequired}, M{}}, res["allow"])
+	})
+	t.Run("recent sign in", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        max_age: 15m
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "USER_ID", IssuedAt: timestamppb.New(testingNow.Add(-time.Minute))},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonStepUpOK}, M{}}, res["allow"])
+	})
+	t.Run("high-value route", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        max_age: 15m
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "USER_ID", IssuedAt: old},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonStepUpRequired}, M{}}, res["allow"])
+	})
+	t.Run("webauthn", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        method: webauthn
+        when: [new_ip]
+`,
+			[]dataBrokerRecord{
+				&session.Session{Id: "SESSION_ID", UserId: "USER_ID", IpAddress: "1.1.1.1"},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}, HTTP: InputHTTP{IP: "2.2.2.2"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonDeviceUnauthenticated}, M{}}, res["allow"])
+
+		res, err = evaluate(t, `
+allow:
+  and:
+    - step_up:
+        method: webauthn
+        when: [new_ip]
+`,
+			[]dataBrokerRecord{
+				&session.Session{
+					Id: "SESSION_ID", UserId: "USER_ID", IpAddress: "1.1.1.1",
+					DeviceCredentials: []*session.Session_DeviceCredential{{TypeId: "any", Credential: &session.Session_DeviceCredential_Id{Id: "DEVICE_ID"}}},
+				},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}, HTTP: InputHTTP{IP: "2.2.2.2"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonStepUpOK}, M{}}, res["allow"])
+	})
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - step_up:
+        max_age: 15m
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, M{}}, res["allow"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{
+			"15m",
+			"{}",
+			"{max_age: 15}",
+			"{max_age: 500ms}",
+			"{max_age: 15m, when: []}",
+			"{max_age: 15m, when: [new_country]}",
+			"{max_age: 15m, method: sms}",
+			"{max_age: 15m, method: webauthn}",
+			"{max_age: 15m, session: true}",
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - step_up: `+data, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package criteria
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+type timeOfDayCriterion struct {
+	g *Generator
+}
+
+func (timeOfDayCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (timeOfDayCriterion) Name() string {
+	return "time_of_day"
+}
+
+func (c timeOfDayCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for time_of_day, got: %T", data)
+	}
+	if err := checkObjectFields(obj, "after", "before", "timezone"); err != nil {
+		return nil, nil, fmt.Errorf("time_of_day: %w", err)
+	}
+
+	timezone, err := parseTimezone(obj["timezone"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("time_of_day: %w", err)
+	}
+	after, before, err := parseTimeRange(obj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("time_of_day: %w", err)
+	}
+
+	rule, additionalRules := newScheduleRule(c.g, c.Name(),
+		ReasonTimeOfDayOK, ReasonTimeOfDayUnauthorized,
+		timezone, newScheduleWindows(allWeekdays(), after, before))
+	return rule, additionalRules, nil
+}
+
+// TimeOfDay returns a Criterion which matches when the current time of day
+// is after and before the given times.
+func TimeOfDay(generator *Generator) Criterion {
+	return timeOfDayCriterion{g: generator}
+}
+
+func init() {
+	Register(TimeOfDay)
+}
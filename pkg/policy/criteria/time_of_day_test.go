@@ -0,0 +1,82 @@
+package criteria
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeOfDay(t *testing.T) {
+	now := testingNow.UTC()
+	timeOfDay := func(t *testing.T, after, before time.Time, timezone string) (A, error) {
+		res, err := evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        after: "%s"
+        before: "%s"
+        timezone: %s
+`, after.Format("15:04"), before.Format("15:04"), timezone), []dataBrokerRecord{}, Input{})
+		if err != nil {
+			return nil, err
+		}
+		return res["allow"].(A), nil
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		res, err := timeOfDay(t, now.Add(-time.Hour), now.Add(time.Hour), "UTC")
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonTimeOfDayOK}, M{}}, res)
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := timeOfDay(t, now.Add(time.Hour), now.Add(2*time.Hour), "UTC")
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res)
+	})
+	t.Run("overnight", func(t *testing.T) {
+		// the window wraps around midnight, so it includes everything but the
+		// hour after now
+		res, err := timeOfDay(t, now.Add(2*time.Hour), now, "UTC")
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res)
+
+		res, err = timeOfDay(t, now.Add(time.Hour), now.Add(-time.Minute*59), "UTC")
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res)
+
+		res, err = timeOfDay(t, now.Add(2*time.Hour), now.Add(time.Hour), "UTC")
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonTimeOfDayOK}, M{}}, res)
+	})
+	t.Run("timezone", func(t *testing.T) {
+		loc, err := time.LoadLocation("Asia/Tokyo")
+		require.NoError(t, err)
+		local := now.In(loc)
+
+		res, err := timeOfDay(t, local.Add(-time.Hour), local.Add(time.Hour), "Asia/Tokyo")
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonTimeOfDayOK}, M{}}, res)
+
+		res, err = timeOfDay(t, now.Add(-time.Hour), now.Add(time.Hour), "Asia/Tokyo")
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, policy := range []string{
+			`{after: "9am"}`,
+			`{after: "25:00"}`,
+			`{after: "09:00", before: "09:00"}`,
+			`{after: "09:00", timezone: "Mars/Olympus_Mons"}`,
+			`{after: "09:00", until: "17:00"}`,
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - time_of_day: `+policy, []dataBrokerRecord{}, Input{})
+			assert.Error(t, err, policy)
+		}
+	})
+}
@@ -36,7 +36,7 @@ func (g *Generator) generateAndRule(dst *ast.RuleSet, policyCriteria []parser.Cr
 		return rule, nil
 	}
 
-	terms, err := g.generateCriterionRules(dst, policyCriteria)
+	terms, err := g.generateCriterionRules(dst, "and", policyCriteria)
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +60,7 @@ func (g *Generator) generateNotRule(dst *ast.RuleSet, policyCriteria []parser.Cr
 
 	// NOT => (NOT A) AND (NOT B)
 
-	terms, err := g.generateCriterionRules(dst, policyCriteria)
+	terms, err := g.generateCriterionRules(dst, "not", policyCriteria)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +82,7 @@ func (g *Generator) generateOrRule(dst *ast.RuleSet, policyCriteria []parser.Cri
 		return rule, nil
 	}
 
-	terms, err := g.generateCriterionRules(dst, policyCriteria)
+	terms, err := g.generateCriterionRules(dst, "or", policyCriteria)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +106,7 @@ func (g *Generator) generateNorRule(dst *ast.RuleSet, policyCriteria []parser.Cr
 
 	// NOR => (NOT A) OR (NOT B)
 
-	terms, err := g.generateCriterionRules(dst, policyCriteria)
+	terms, err := g.generateCriterionRules(dst, "nor", policyCriteria)
 	if err != nil {
 		return nil, err
 	}
@@ -121,7 +121,7 @@ func (g *Generator) generateNorRule(dst *ast.RuleSet, policyCriteria []parser.Cr
 	return rule, nil
 }
 
-func (g *Generator) generateCriterionRules(dst *ast.RuleSet, policyCriteria []parser.Criterion) ([]*ast.Term, error) {
+func (g *Generator) generateCriterionRules(dst *ast.RuleSet, operator string, policyCriteria []parser.Criterion) ([]*ast.Term, error) {
 	var terms []*ast.Term
 	for _, policyCriterion := range policyCriteria {
 		criterion, ok := g.criteria[policyCriterion.Name]
@@ -134,6 +134,11 @@ func (g *Generator) generateCriterionRules(dst *ast.RuleSet, policyCriteria []pa
 		}
 		*dst = dst.Merge(additionalRules)
 		dst.Add(mainRule)
+		g.criterionRules = append(g.criterionRules, CriterionRule{
+			Name:      string(mainRule.Head.Name),
+			Operator:  operator,
+			Criterion: policyCriterion,
+		})
 
 		terms = append(terms, ast.VarTerm(string(mainRule.Head.Name)))
 	}
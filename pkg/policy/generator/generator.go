@@ -13,8 +13,19 @@ import (
 
 // A Generator generates a rego script from a policy.
 type Generator struct {
-	ids      map[string]int
-	criteria map[string]Criterion
+	ids            map[string]int
+	criteria       map[string]Criterion
+	criterionRules []CriterionRule
+}
+
+// A CriterionRule is the rule generated for a criterion of a policy.
+type CriterionRule struct {
+	// Name is the name of the rule.
+	Name   string
+	Action parser.Action
+	// Operator is the conditional the criterion is in: and, or, not or nor.
+	Operator  string
+	Criterion parser.Criterion
 }
 
 // An Option configures the Generator.
@@ -58,6 +69,7 @@ func (g *Generator) Generate(policy *parser.Policy) (*ast.Module, error) {
 	rs.Add(rules.MergeWithOr())
 
 	for _, action := range []parser.Action{parser.ActionAllow, parser.ActionDeny} {
+		start := len(g.criterionRules)
 		var terms []*ast.Term
 		for _, policyRule := range policy.Rules {
 			if policyRule.Action != action {
@@ -93,6 +105,9 @@ func (g *Generator) Generate(policy *parser.Policy) (*ast.Module, error) {
 				terms = append(terms, ast.VarTerm(string(subRule.Head.Name)))
 			}
 		}
+		for i := start; i < len(g.criterionRules); i++ {
+			g.criterionRules[i].Action = action
+		}
 		if len(terms) > 0 {
 			rule := &ast.Rule{
 				Head: &ast.Head{
@@ -133,6 +148,12 @@ func (g *Generator) Generate(policy *parser.Policy) (*ast.Module, error) {
 	return mod, nil
 }
 
+// CriterionRules returns the rules generated for the criteria of the
+// policies, in the order of the policies.
+func (g *Generator) CriterionRules() []CriterionRule {
+	return g.criterionRules
+}
+
 // NewRuleFromTemplate creates a new rule from a template rule.
 func (g *Generator) NewRuleFromTemplate(name string, template *ast.Rule) *ast.Rule {
 	id := g.ids[name]
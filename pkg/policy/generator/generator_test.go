@@ -237,4 +237,20 @@ else = [false, reasons, additional_data] {
 	additional_data := object_union({x | x := false_results[i][2]})
 }
 `, string(format.MustAst(mod)))
+
+	rules := g.CriterionRules()
+	if assert.Len(t, rules, 15) {
+		assert.Equal(t, CriterionRule{
+			Name:      "accept_4",
+			Action:    parser.ActionAllow,
+			Operator:  "or",
+			Criterion: parser.Criterion{Name: "accept"},
+		}, rules[4])
+		assert.Equal(t, CriterionRule{
+			Name:      "accept_14",
+			Action:    parser.ActionDeny,
+			Operator:  "nor",
+			Criterion: parser.Criterion{Name: "accept"},
+		}, rules[14])
+	}
 }
@@ -17,6 +17,8 @@ type (
 	Criterion = generator.Criterion
 	// A CriterionConstructor is a function which returns a Criterion for a Generator.
 	CriterionConstructor = generator.CriterionConstructor
+	// A CriterionRule is the rule generated for a criterion of a policy.
+	CriterionRule = generator.CriterionRule
 )
 
 // GenerateRegoFromReader generates a rego script from raw Pomerium Policy Language.
@@ -30,6 +32,14 @@ func GenerateRegoFromReader(r io.Reader) (string, error) {
 
 // GenerateRegoFromPolicy generates a rego script from a Pomerium Policy Language policy.
 func GenerateRegoFromPolicy(p *parser.Policy) (string, error) {
+	script, _, err := GenerateRegoAndCriterionRules(p)
+	return script, err
+}
+
+// GenerateRegoAndCriterionRules generates a rego script from a Pomerium Policy
+// Language policy, along with the rules generated for its criteria, so that
+// the result of each criterion can be looked up after evaluation.
+func GenerateRegoAndCriterionRules(p *parser.Policy) (string, []CriterionRule, error) {
 	var gOpts []generator.Option
 	for _, ctor := range criteria.All() {
 		gOpts = append(gOpts, generator.WithCriterion(ctor))
@@ -38,13 +48,13 @@ func GenerateRegoFromPolicy(p *parser.Policy) (string, error) {
 
 	mod, err := g.Generate(p)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	bs, err := format.Ast(mod)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return string(bs), err
+	return string(bs), g.CriterionRules(), nil
 }
@@ -49,6 +49,20 @@ get_user_email(session, user) = v {
 `)
 }
 
+// GetRateLimitSubject gets the subject requests are counted for by the
+// rate_limit criterion, either the user, or, without a session, the client IP
+// address.
+func GetRateLimitSubject() *ast.Rule {
+	return ast.MustParseRule(`
+get_rate_limit_subject(session) = v {
+	session.user_id != ""
+	v = concat(":", ["user", session.user_id])
+} else = v {
+	v = concat(":", ["ip", input.http.ip])
+}
+`)
+}
+
 // GetDeviceCredential gets the device credential for the given session.
 func GetDeviceCredential() *ast.Rule {
 	return ast.MustParseRule(`
@@ -74,6 +88,19 @@ get_device_enrollment(device_credential) = v {
 `)
 }
 
+// GetDevicePosture gets the device posture a provider reported for the given
+// email address.
+func GetDevicePosture() *ast.Rule {
+	return ast.MustParseRule(`
+get_device_posture(provider, email) = v {
+	v = get_databroker_record("type.googleapis.com/pomerium.device.Posture", concat("/", [provider, lower(email)]))
+	v != null
+} else = {} {
+	true
+}
+`)
+}
+
 // MergeWithAnd merges criterion results using `and`.
 func MergeWithAnd() *ast.Rule {
 	return ast.MustParseRule(`
@@ -190,3 +217,75 @@ object_union(xs) = merged {
 }
 `)
 }
+
+// InSchedule checks whether the current time, in the given timezone, falls
+// within one of the windows. A window is an object with the names of its
+// days, and the minutes of the day it starts at and ends before.
+func InSchedule() *ast.Rule {
+	return ast.MustParseRule(`
+in_schedule(windows, timezone) {
+	now := time.now_ns()
+	day := time.weekday([now, timezone])
+	clock := time.clock([now, timezone])
+	minute := (clock[0] * 60) + clock[1]
+	window := windows[_]
+	window.days[_] == day
+	minute >= window.after
+	minute < window.before
+}
+`)
+}
+
+// StepUpRisk checks whether one of the risk signals is present for the
+// session. With no signals, there is always a risk.
+func StepUpRisk() *ast.Rule {
+	return ast.MustParseRule(`
+step_up_risk(session, signals) = true {
+	count(signals) == 0
+}
+
+else = true {
+	signals[_] == "new_ip"
+	object.get(session, "ip_address", "") != ""
+	session.ip_address != input.http.ip
+}
+
+else = true {
+	signals[_] == "new_user_agent"
+	object.get(session, "user_agent", "") != ""
+	session.user_agent != object.get(input.http.headers, "User-Agent", "")
+}
+`)
+}
+
+// StepUpRecent checks whether the session was issued within the max age, in
+// seconds.
+func StepUpRecent() *ast.Rule {
+	return ast.MustParseRule(`
+step_up_recent(session, max_age) {
+	issued_at := object.get(session, "issued_at", {})
+	seconds := object.get(issued_at, "seconds", 0)
+	time.now_ns() < (seconds + max_age) * 1000000000
+}
+`)
+}
+
+// JWTClaimMatches checks whether a JWT claim is the expected value, or is an
+// array or a space-delimited string, like scope, which contains it.
+func JWTClaimMatches() *ast.Rule {
+	return ast.MustParseRule(`
+jwt_claim_matches(value, expected) = true {
+	value == expected
+}
+
+else = true {
+	is_array(value)
+	value[_] == expected
+}
+
+else = true {
+	is_string(value)
+	split(value, " ")[_] == expected
+}
+`)
+}
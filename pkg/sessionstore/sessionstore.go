@@ -0,0 +1,86 @@
+// Package sessionstore contains a registry of session stores, so that builds
+// of pomerium can supply their own session store implementation. A
+// registered session store is selected with the session_store option.
+package sessionstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/encoding"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+)
+
+// re-exported types
+type (
+	// A SessionStore loads, saves and clears sessions.
+	SessionStore = sessions.SessionStore
+	// An Encoder marshals and unmarshals sessions.
+	Encoder = encoding.MarshalUnmarshaler
+	// CookieOptions are the attributes of the session cookie.
+	CookieOptions = cookie.Options
+	// A GetCookieOptionsFunc returns the current attributes of the session
+	// cookie.
+	GetCookieOptionsFunc = cookie.GetOptionsFunc
+)
+
+// Options are the options passed to a Constructor.
+type Options struct {
+	// Name is the name of the session, as used for the session cookie.
+	Name string
+	// Expire is the lifetime of the session.
+	Expire time.Duration
+	// Encoder is the encoder used to sign and verify sessions.
+	Encoder Encoder
+	// URL is the URL of the server backing the session store, as given by
+	// the session_store_url option.
+	URL string
+	// GetCookieOptions returns the full set of session cookie attributes,
+	// including the Domain, Secure, SameSite and HTTPOnly settings, which a
+	// session store should use for any cookie it sets.
+	GetCookieOptions GetCookieOptionsFunc
+}
+
+// A Constructor creates a new SessionStore.
+type Constructor func(options Options) (SessionStore, error)
+
+var registry struct {
+	sync.Mutex
+	m map[string]Constructor
+}
+
+// Register registers a session store constructor under the given name. If a
+// session store is already registered with the name it is replaced.
+func Register(name string, constructor Constructor) {
+	registry.Lock()
+	m := make(map[string]Constructor, len(registry.m)+1)
+	for k, v := range registry.m {
+		m[k] = v
+	}
+	m[name] = constructor
+	registry.m = m
+	registry.Unlock()
+}
+
+// Get returns the session store constructor registered under the given name.
+func Get(name string) (Constructor, bool) {
+	registry.Lock()
+	constructor, ok := registry.m[name]
+	registry.Unlock()
+	return constructor, ok
+}
+
+// Names returns the names of all the registered session stores in sorted
+// order.
+func Names() []string {
+	registry.Lock()
+	names := make([]string, 0, len(registry.m))
+	for name := range registry.m {
+		names = append(names, name)
+	}
+	registry.Unlock()
+	sort.Strings(names)
+	return names
+}
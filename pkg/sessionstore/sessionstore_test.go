@@ -0,0 +1,29 @@
+package sessionstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/sessions/mock"
+)
+
+func TestRegister(t *testing.T) {
+	_, ok := Get("test-b")
+	assert.False(t, ok)
+
+	Register("test-b", func(options Options) (SessionStore, error) {
+		return &mock.Store{}, nil
+	})
+	Register("test-a", func(options Options) (SessionStore, error) {
+		return &mock.Store{ResponseSession: options.Name}, nil
+	})
+
+	constructor, ok := Get("test-a")
+	if assert.True(t, ok) {
+		store, err := constructor(Options{Name: "_pomerium"})
+		assert.NoError(t, err)
+		assert.Equal(t, "_pomerium", store.(*mock.Store).ResponseSession)
+	}
+	assert.Equal(t, []string{"test-a", "test-b"}, Names())
+}
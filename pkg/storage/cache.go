@@ -18,6 +18,7 @@ type Cache interface {
 		update func(ctx context.Context) ([]byte, error),
 	) ([]byte, error)
 	Invalidate(key []byte)
+	InvalidateAll()
 }
 
 type localCache struct {
@@ -78,6 +79,12 @@ func (cache *localCache) Invalidate(key []byte) {
 	cache.mu.Unlock()
 }
 
+func (cache *localCache) InvalidateAll() {
+	cache.mu.Lock()
+	cache.m = make(map[string][]byte)
+	cache.mu.Unlock()
+}
+
 type globalCache struct {
 	ttl time.Duration
 
@@ -130,6 +137,12 @@ func (cache *globalCache) Invalidate(key []byte) {
 	cache.mu.Unlock()
 }
 
+func (cache *globalCache) InvalidateAll() {
+	cache.mu.Lock()
+	cache.fastcache.Reset()
+	cache.mu.Unlock()
+}
+
 func (cache *globalCache) get(k []byte) (data []byte, expiry time.Time, ok bool) {
 	cache.mu.RLock()
 	item := cache.fastcache.Get(nil, k)
@@ -35,6 +35,13 @@ func TestLocalCache(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("v1"), v)
 	assert.Equal(t, 2, callCount)
+
+	c.InvalidateAll()
+
+	v, err = c.GetOrUpdate(ctx, []byte("k1"), update)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	assert.Equal(t, 3, callCount)
 }
 
 func TestGlobalCache(t *testing.T) {
@@ -64,6 +71,13 @@ func TestGlobalCache(t *testing.T) {
 	assert.Equal(t, []byte("v1"), v)
 	assert.Equal(t, 2, callCount)
 
+	c.InvalidateAll()
+
+	v, err = c.GetOrUpdate(ctx, []byte("k1"), update)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	assert.Equal(t, 3, callCount)
+
 	assert.Eventually(t, func() bool {
 		_, err := c.GetOrUpdate(ctx, []byte("k1"), func(ctx context.Context) ([]byte, error) {
 			return nil, fmt.Errorf("ERROR")
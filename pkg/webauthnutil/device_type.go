@@ -16,6 +16,11 @@ import (
 // DefaultDeviceType is the default device type when none is specified.
 const DefaultDeviceType = urlutil.DefaultDeviceType
 
+// PasskeyDeviceType is the device type of passkeys used to sign in with the
+// passkey identity provider. Passkeys are discoverable credentials which
+// verify the user.
+const PasskeyDeviceType = "passkey"
+
 var supportedPublicKeyCredentialParameters = []*device.WebAuthnOptions_PublicKeyCredentialParameters{
 	{Type: device.WebAuthnOptions_PUBLIC_KEY, Alg: int64(cose.AlgorithmES256)},
 	{Type: device.WebAuthnOptions_PUBLIC_KEY, Alg: int64(cose.AlgorithmRS256)},
@@ -38,6 +43,23 @@ var predefinedDeviceTypes = map[string]*device.Type{
 			},
 		},
 	},
+	PasskeyDeviceType: {
+		Id:   PasskeyDeviceType,
+		Name: "Passkey",
+		Specifier: &device.Type_Webauthn{
+			Webauthn: &device.Type_WebAuthn{
+				Options: &device.WebAuthnOptions{
+					Attestation: device.WebAuthnOptions_NONE.Enum(),
+					AuthenticatorSelection: &device.WebAuthnOptions_AuthenticatorSelectionCriteria{
+						UserVerification:       device.WebAuthnOptions_USER_VERIFICATION_REQUIRED.Enum(),
+						ResidentKeyRequirement: device.WebAuthnOptions_RESIDENT_KEY_REQUIRED.Enum(),
+						RequireResidentKey:     proto.Bool(true),
+					},
+					PubKeyCredParams: supportedPublicKeyCredentialParameters,
+				},
+			},
+		},
+	},
 	"enclave_only": {
 		Id:   "enclave_only",
 		Name: "Secure Enclave Only",
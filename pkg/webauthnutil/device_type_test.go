@@ -48,3 +48,15 @@ func TestGetDeviceType(t *testing.T) {
 		assert.Equal(t, "Any", deviceType.GetName())
 	})
 }
+
+func TestGetDeviceType_passkey(t *testing.T) {
+	client := &mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			return nil, status.Error(codes.NotFound, "not found")
+		},
+	}
+	deviceType := GetDeviceType(context.Background(), client, PasskeyDeviceType)
+	selection := deviceType.GetWebauthn().GetOptions().GetAuthenticatorSelection()
+	assert.Equal(t, device.WebAuthnOptions_RESIDENT_KEY_REQUIRED, selection.GetResidentKeyRequirement())
+	assert.Equal(t, device.WebAuthnOptions_USER_VERIFICATION_REQUIRED, selection.GetUserVerification())
+}
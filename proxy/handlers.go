@@ -7,14 +7,18 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/gorilla/mux"
 	"google.golang.org/protobuf/encoding/protojson"
 
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/dpop"
 	"github.com/pomerium/pomerium/internal/handlers"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/middleware"
+	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/identity"
@@ -32,6 +36,7 @@ func (p *Proxy) registerDashboardHandlers(r *mux.Router) *mux.Router {
 	h.Path("/").Handler(httputil.HandlerFunc(p.userInfo)).Methods(http.MethodGet)
 	h.Path("/device-enrolled").Handler(httputil.HandlerFunc(p.deviceEnrolled))
 	h.Path("/jwt").Handler(httputil.HandlerFunc(p.jwtAssertion)).Methods(http.MethodGet)
+	h.Path("/refresh").Handler(httputil.HandlerFunc(p.Refresh)).Methods(http.MethodGet, http.MethodPost)
 	h.Path("/sign_out").Handler(httputil.HandlerFunc(p.SignOut)).Methods(http.MethodGet, http.MethodPost)
 	h.Path("/webauthn").Handler(p.webauthn)
 
@@ -141,16 +146,34 @@ func (p *Proxy) Callback(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	ss := newSessionStateFromProfile(profile)
+	if email, ok := getVerifiedEmail(profile); options.IDPAccountLinking && ok {
+		userID, err := user.LinkAccount(r.Context(), state.dataBrokerClient, email, ss.UserID())
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("proxy: error linking account: %w", err))
+		}
+		if userID != ss.UserID() {
+			ss.LinkedUserID = userID
+		}
+	}
 	s, err := session.Get(r.Context(), state.dataBrokerClient, ss.ID)
 	if err != nil {
 		s = &session.Session{Id: ss.ID}
 	}
 	populateSessionFromProfile(s, profile, ss, options.CookieExpire)
+	s.UserAgent = r.UserAgent()
+	s.IpAddress = httputil.GetClientIPAddress(r)
+	getSessionBinding(r, options).Apply(s)
+	// programmatic logins with a DPoP proof bind the session to its key
+	s.DpopJkt = values.Get(urlutil.QueryDPoPJKT)
 	u, err := user.Get(r.Context(), state.dataBrokerClient, ss.UserID())
 	if err != nil {
 		u = &user.User{Id: ss.UserID()}
 	}
-	populateUserFromProfile(u, profile, ss)
+	attributes, err := options.GetUserAttributes()
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	populateUserFromProfile(u, profile, ss, attributes)
 
 	redirectURI, err := getRedirectURIFromValues(values)
 	if err != nil {
@@ -167,6 +190,12 @@ func (p *Proxy) Callback(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("proxy: error saving databroker records: %w", err))
 	}
+	if options.SessionMaxPerUser > 0 {
+		err = p.enforceSessionLimit(r.Context(), s.GetUserId(), s.GetId(), options.SessionMaxPerUser)
+		if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("proxy: error enforcing session limit: %w", err))
+		}
+	}
 	ss.DatabrokerServerVersion = res.GetServerVersion()
 	for _, record := range res.GetRecords() {
 		if record.GetVersion() > ss.DatabrokerRecordVersion {
@@ -215,6 +244,16 @@ func (p *Proxy) ProgrammaticLogin(w http.ResponseWriter, r *http.Request) error
 		return httputil.NewError(http.StatusInternalServerError, err)
 	}
 
+	// apps may request identity provider parameters, e.g. to force reauthentication
+	requestedAuthParams, err := config.NewIDPAuthParamsOptionsFromQuery(r.Form)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	authParams, err := options.GetIDPAuthParamsForRequestURL(urlutil.GetAbsoluteURL(r).String())
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+
 	hpkeAuthenticateKey, err := state.authenticateKeyFetcher.FetchPublicKey(r.Context())
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError, err)
@@ -223,9 +262,27 @@ func (p *Proxy) ProgrammaticLogin(w http.ResponseWriter, r *http.Request) error
 	signinURL := *state.authenticateSigninURL
 	callbackURI := urlutil.GetAbsoluteURL(r)
 	callbackURI.Path = dashboardPath + "/callback/"
+	// the session is bound to the key of the login request's DPoP proof. The
+	// callback uri is encrypted for the authenticate service, which passes it
+	// back to the callback with the profile.
+	callbackURI.RawQuery = ""
+	if proof := r.Header.Get(dpop.HeaderName); proof != "" {
+		jkt, err := dpop.Verify(r.Context(), proof, dpop.Request{
+			Method:           r.Method,
+			URL:              *urlutil.GetAbsoluteURL(r),
+			DataBrokerClient: state.dataBrokerClient,
+		})
+		if errors.Is(err, dpop.ErrInvalidProof) {
+			return httputil.NewError(http.StatusBadRequest, err)
+		} else if err != nil {
+			return httputil.NewError(http.StatusInternalServerError, err)
+		}
+		callbackURI.RawQuery = url.Values{urlutil.QueryDPoPJKT: {jkt}}.Encode()
+	}
 	q := signinURL.Query()
 	q.Set(urlutil.QueryCallbackURI, callbackURI.String())
 	q.Set(urlutil.QueryIsProgrammatic, "true")
+	authParams.Merge(requestedAuthParams).SetQuery(q)
 	signinURL.RawQuery = q.Encode()
 
 	rawURL, err := urlutil.SignInURL(state.hpkePrivateKey, hpkeAuthenticateKey, &signinURL, redirectURI, idp.GetId())
@@ -264,6 +321,57 @@ func (p *Proxy) jwtAssertion(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// A refreshResponse is returned by the refresh endpoint.
+type refreshResponse struct {
+	ExpiresAt     time.Time  `json:"expires_at"`
+	IdleExpiresAt *time.Time `json:"idle_expires_at,omitempty"`
+}
+
+// Refresh extends the session of the current request without a redirect,
+// so that single page applications can keep a session alive. It returns the
+// session's expiry so that users can be warned before they are signed out.
+func (p *Proxy) Refresh(w http.ResponseWriter, r *http.Request) error {
+	state := p.state.Load()
+	options := p.currentOptions.Load()
+
+	ss, err := p.getSessionState(r)
+	if err != nil {
+		return httputil.NewError(http.StatusUnauthorized, err)
+	}
+	if ss.IsIdle(options.SessionIdleTimeout) {
+		return httputil.NewError(http.StatusUnauthorized, sessions.ErrIdleTimeout)
+	}
+
+	s, err := session.Get(r.Context(), state.dataBrokerClient, ss.ID)
+	if err != nil {
+		return httputil.NewError(http.StatusUnauthorized, fmt.Errorf("proxy: session not found: %w", err))
+	}
+	now := time.Now()
+	if s.GetExpiresAt().AsTime().Before(now) {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("proxy: session expired"))
+	}
+
+	ss.Touch()
+	rawJWT, err := state.encoder.Marshal(&ss)
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("proxy: error marshaling session state: %w", err))
+	}
+	if err = state.sessionStore.SaveSession(w, r, rawJWT); err != nil {
+		return httputil.NewError(http.StatusInternalServerError, fmt.Errorf("proxy: error saving session state: %w", err))
+	}
+
+	res := refreshResponse{ExpiresAt: s.GetExpiresAt().AsTime()}
+	if options.SessionIdleTimeout > 0 {
+		idleExpiresAt := now.Add(options.SessionIdleTimeout)
+		if idleExpiresAt.Before(res.ExpiresAt) {
+			res.IdleExpiresAt = &idleExpiresAt
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.RenderJSON(w, http.StatusOK, res)
+	return nil
+}
+
 func (p *Proxy) validateSenderPublicKey(ctx context.Context, senderPublicKey *hpke.PublicKey) error {
 	state := p.state.Load()
 
@@ -2,18 +2,34 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
 	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/protoutil"
 
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestProxy_RobotsTxt(t *testing.T) {
@@ -128,6 +144,14 @@ func TestProxy_ProgrammaticLogin(t *testing.T) {
 			http.StatusBadRequest,
 			"{\"Status\":400}\n",
 		},
+		{
+			"bad dpop proof",
+			opts, http.MethodGet, "https", "corp.example.example", "/.pomerium/api/v1/login",
+			map[string]string{"DPoP": "not-a-proof"},
+			map[string]string{urlutil.QueryRedirectURI: "http://localhost"},
+			http.StatusBadRequest,
+			"{\"Status\":400}\n",
+		},
 		{
 			"bad http method",
 			opts, http.MethodPost, "https", "corp.example.example", "/.pomerium/api/v1/login", nil,
@@ -151,6 +175,9 @@ func TestProxy_ProgrammaticLogin(t *testing.T) {
 
 			r := httptest.NewRequest(tt.method, redirectURI.String(), nil)
 			r.Header.Set("Accept", "application/json")
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
 
 			w := httptest.NewRecorder()
 			router := httputil.NewRouter()
@@ -197,3 +224,105 @@ func TestProxy_jwt(t *testing.T) {
 	assert.Equal(t, "application/jwt", w.Header().Get("Content-Type"))
 	assert.Equal(t, w.Body.String(), rawJWT)
 }
+
+type mockDataBrokerServiceClient struct {
+	databroker.DataBrokerServiceClient
+	sessions map[string]*session.Session
+}
+
+func (m mockDataBrokerServiceClient) Get(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+	s, ok := m.sessions[in.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &databroker.GetResponse{Record: &databroker.Record{
+		Type: in.GetType(),
+		Id:   in.GetId(),
+		Data: protoutil.NewAny(s),
+	}}, nil
+}
+
+func TestProxy_Refresh(t *testing.T) {
+	sharedKey := cryptutil.NewKey()
+	encoder, err := jws.NewHS256Signer(sharedKey)
+	require.NoError(t, err)
+	getCookieOptions := func() cookie.Options {
+		return cookie.Options{Name: "_pomerium", Expire: time.Hour}
+	}
+	sessionStore, err := cookie.NewStore(getCookieOptions, encoder)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	options := config.NewDefaultOptions()
+	options.SessionIdleTimeout = 10 * time.Minute
+	proxy := &Proxy{
+		state: atomicutil.NewValue(&proxyState{
+			sharedKey:    sharedKey,
+			encoder:      encoder,
+			sessionStore: sessionStore,
+			dataBrokerClient: mockDataBrokerServiceClient{sessions: map[string]*session.Session{
+				"s1": {Id: "s1", ExpiresAt: timestamppb.New(expiresAt)},
+				"s2": {Id: "s2", ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute))},
+			}},
+		}),
+		currentOptions: atomicutil.NewValue(options),
+	}
+
+	refresh := func(t *testing.T, state *sessions.State) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, "https://www.example.com/.pomerium/refresh", nil)
+		if state != nil {
+			rawJWT, err := encoder.Marshal(state)
+			require.NoError(t, err)
+			r.AddCookie(&http.Cookie{Name: "_pomerium", Value: string(rawJWT)})
+		}
+		w := httptest.NewRecorder()
+		return w, proxy.Refresh(w, r)
+	}
+	assertStatus := func(t *testing.T, expect int, err error) {
+		var httpErr *httputil.HTTPError
+		if assert.ErrorAs(t, err, &httpErr) {
+			assert.Equal(t, expect, httpErr.Status)
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		w, err := refresh(t, &sessions.State{
+			ID:           "s1",
+			LastActivity: jwt.NewNumericDate(time.Now().Add(-5 * time.Minute)),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res refreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.True(t, expiresAt.Equal(res.ExpiresAt))
+		if assert.NotNil(t, res.IdleExpiresAt) {
+			assert.WithinDuration(t, time.Now().Add(10*time.Minute), *res.IdleExpiresAt, time.Minute)
+		}
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		var refreshed sessions.State
+		require.NoError(t, encoder.Unmarshal([]byte(cookies[0].Value), &refreshed))
+		assert.False(t, refreshed.IsIdle(time.Minute), "should update the last activity")
+	})
+	t.Run("no session", func(t *testing.T) {
+		_, err := refresh(t, nil)
+		assertStatus(t, http.StatusUnauthorized, err)
+	})
+	t.Run("idle", func(t *testing.T) {
+		_, err := refresh(t, &sessions.State{
+			ID:           "s1",
+			LastActivity: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		})
+		assertStatus(t, http.StatusUnauthorized, err)
+	})
+	t.Run("expired", func(t *testing.T) {
+		_, err := refresh(t, &sessions.State{ID: "s2"})
+		assertStatus(t, http.StatusUnauthorized, err)
+	})
+	t.Run("missing", func(t *testing.T) {
+		_, err := refresh(t, &sessions.State{ID: "s3"})
+		assertStatus(t, http.StatusUnauthorized, err)
+	})
+}
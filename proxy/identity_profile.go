@@ -10,6 +10,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/claimmap"
 	"github.com/pomerium/pomerium/internal/identity/manager"
 	"github.com/pomerium/pomerium/internal/sessions"
 	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
@@ -34,9 +35,39 @@ func newSessionStateFromProfile(p *identitypb.Profile) *sessions.State {
 		ss.OID = fmt.Sprint(v)
 	}
 
+	// set the authentication context
+	if v, ok := claims["acr"]; ok {
+		ss.ACR = fmt.Sprint(v)
+	}
+	switch v := claims["amr"].(type) {
+	case string:
+		ss.AMR = sessions.AuthenticationMethods{v}
+	case []any:
+		for _, vv := range v {
+			ss.AMR = append(ss.AMR, fmt.Sprint(vv))
+		}
+	}
+
 	return ss
 }
 
+// getVerifiedEmail returns the email address of a profile, if the identity
+// provider verified it.
+func getVerifiedEmail(p *identitypb.Profile) (string, bool) {
+	claims := p.GetClaims().AsMap()
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", false
+	}
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		return email, v
+	case string:
+		return email, v == "true"
+	}
+	return "", false
+}
+
 func populateSessionFromProfile(s *session.Session, p *identitypb.Profile, ss *sessions.State, cookieExpire time.Duration) {
 	claims := p.GetClaims().AsMap()
 	oauthToken := new(oauth2.Token)
@@ -54,6 +85,9 @@ func populateSessionFromProfile(s *session.Session, p *identitypb.Profile, ss *s
 		Raw:       string(p.GetIdToken()),
 	}
 	s.OauthToken = manager.ToOAuthToken(oauthToken)
+	s.Acr = ss.ACR
+	s.Amr = ss.AMR
+	s.IdentityProviderId = p.GetProviderId()
 	if s.Claims == nil {
 		s.Claims = make(map[string]*structpb.ListValue)
 	}
@@ -62,7 +96,7 @@ func populateSessionFromProfile(s *session.Session, p *identitypb.Profile, ss *s
 	}
 }
 
-func populateUserFromProfile(u *user.User, p *identitypb.Profile, ss *sessions.State) {
+func populateUserFromProfile(u *user.User, p *identitypb.Profile, ss *sessions.State, attributes *claimmap.Mapping) {
 	claims := p.GetClaims().AsMap()
 	if v, ok := claims["name"]; ok {
 		u.Name = fmt.Sprint(v)
@@ -76,4 +110,9 @@ func populateUserFromProfile(u *user.User, p *identitypb.Profile, ss *sessions.S
 	for k, vs := range identity.Claims(claims).Flatten().ToPB() {
 		u.Claims[k] = vs
 	}
+	// attributes are set last, so that they take precedence over the
+	// identity provider's claims, and are kept when they evaluate to nothing
+	for k, vs := range identity.Claims(attributes.Evaluate(claims)).Flatten().ToPB() {
+		u.Claims[k] = vs
+	}
 }
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/claimmap"
+	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestPopulateUserFromProfile(t *testing.T) {
+	t.Parallel()
+
+	attributes, err := claimmap.Compile(map[string]string{
+		"department":  `default(department, regex(dn, "OU=([^,]+)"))`,
+		"employee_id": `"E" + employee.id`,
+	})
+	require.NoError(t, err)
+
+	newProfile := func(claims map[string]any) *identitypb.Profile {
+		s, err := structpb.NewStruct(claims)
+		require.NoError(t, err)
+		return &identitypb.Profile{Claims: s}
+	}
+
+	u := &user.User{Id: "USER"}
+	populateUserFromProfile(u, newProfile(map[string]any{
+		"name":     "Alice",
+		"email":    "alice@example.com",
+		"dn":       "CN=Alice,OU=Engineering,DC=example,DC=com",
+		"employee": map[string]any{"id": 1234},
+	}), nil, attributes)
+	assert.Equal(t, "Alice", u.GetName())
+	assert.Equal(t, "alice@example.com", u.GetEmail())
+	claims := identity.NewFlattenedClaimsFromPB(u.GetClaims())
+	assert.Equal(t, []any{"Engineering"}, claims["department"])
+	assert.Equal(t, []any{"E1234"}, claims["employee_id"])
+
+	// attributes which evaluate to nothing keep their previous value
+	populateUserFromProfile(u, newProfile(map[string]any{
+		"name":  "Alice",
+		"email": "alice@example.com",
+		"dn":    "CN=Alice,OU=Sales,DC=example,DC=com",
+	}), nil, attributes)
+	claims = identity.NewFlattenedClaimsFromPB(u.GetClaims())
+	assert.Equal(t, []any{"Sales"}, claims["department"])
+	assert.Equal(t, []any{"E1234"}, claims["employee_id"])
+}
+
+func TestGetVerifiedEmail(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		claims map[string]any
+		email  string
+		ok     bool
+	}{
+		{map[string]any{"email": "alice@example.com", "email_verified": true}, "alice@example.com", true},
+		{map[string]any{"email": "alice@example.com", "email_verified": "true"}, "alice@example.com", true},
+		{map[string]any{"email": "alice@example.com", "email_verified": false}, "", false},
+		{map[string]any{"email": "alice@example.com"}, "", false},
+		{map[string]any{"email_verified": true}, "", false},
+	} {
+		s, err := structpb.NewStruct(tc.claims)
+		require.NoError(t, err)
+		email, ok := getVerifiedEmail(&identitypb.Profile{Claims: s})
+		assert.Equal(t, tc.ok, ok, tc.claims)
+		if ok {
+			assert.Equal(t, tc.email, email)
+		}
+	}
+}
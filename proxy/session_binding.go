@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/clientcert"
+	"github.com/pomerium/pomerium/internal/sessionbinding"
+)
+
+// getSessionBinding returns the attributes a session created by the callback
+// request is bound to.
+func getSessionBinding(r *http.Request, options *config.Options) sessionbinding.Binding {
+	var clientCertificate []byte
+	cert, err := clientcert.ParseForwardedClientCert(r.Header.Get(httputil.HeaderForwardedClientCert))
+	if err == nil && cert != nil {
+		clientCertificate = cert.Raw
+	}
+	return sessionbinding.Get(options, clientCertificate,
+		getTrustedClientIPAddress(r, options.XffNumTrustedHops), r.UserAgent())
+}
+
+// getTrustedClientIPAddress returns the client address the same way envoy
+// determines the source address it sends to authorize: the address
+// numTrustedHops entries before the end of the x-forwarded-for header, which
+// ends with the address of the downstream connection.
+func getTrustedClientIPAddress(r *http.Request, numTrustedHops uint32) string {
+	var addrs []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			addrs = append(addrs, strings.TrimSpace(addr))
+		}
+	}
+	if idx := len(addrs) - 1 - int(numTrustedHops); idx >= 0 && addrs[idx] != "" {
+		return addrs[idx]
+	}
+	return httputil.GetClientIPAddress(r)
+}
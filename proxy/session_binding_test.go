@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTrustedClientIPAddress(t *testing.T) {
+	for _, tc := range []struct {
+		xff            []string
+		numTrustedHops uint32
+		expect         string
+	}{
+		{nil, 0, "10.0.0.9"},
+		{[]string{"1.1.1.1"}, 0, "1.1.1.1"},
+		{[]string{"1.1.1.1, 2.2.2.2"}, 0, "2.2.2.2"},
+		{[]string{"1.1.1.1, 2.2.2.2"}, 1, "1.1.1.1"},
+		{[]string{"1.1.1.1", "2.2.2.2, 3.3.3.3"}, 2, "1.1.1.1"},
+		{[]string{"1.1.1.1"}, 1, "10.0.0.9"},
+	} {
+		r := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.9:1234"}
+		for _, value := range tc.xff {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		assert.Equal(t, tc.expect, getTrustedClientIPAddress(r, tc.numTrustedHops), "xff=%v hops=%d", tc.xff, tc.numTrustedHops)
+	}
+}
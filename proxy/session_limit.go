@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// enforceSessionLimit revokes the oldest sessions of the given user so that
+// no more than maxSessions sessions remain, including the current session.
+func (p *Proxy) enforceSessionLimit(ctx context.Context, userID, currentSessionID string, maxSessions int) error {
+	state := p.state.Load()
+
+	res, err := state.sessionServiceClient.ListUserSessions(ctx, &session.ListUserSessionsRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range getSessionsToRevoke(res.GetSessions(), currentSessionID, maxSessions) {
+		_, err := state.sessionServiceClient.RevokeSessions(ctx, &session.RevokeSessionsRequest{
+			Target: &session.RevokeSessionsRequest_SessionId{SessionId: sessionID},
+		})
+		if err != nil {
+			return err
+		}
+		log.Info(ctx).
+			Str("user-id", userID).
+			Str("session-id", sessionID).
+			Msg("proxy: revoked session exceeding the per-user session limit")
+	}
+	return nil
+}
+
+// getSessionsToRevoke returns the ids of the oldest sessions which exceed the
+// session limit. The current session is never revoked.
+func getSessionsToRevoke(userSessions []*session.SessionInfo, currentSessionID string, maxSessions int) []string {
+	var others []*session.SessionInfo
+	for _, s := range userSessions {
+		if s.GetId() != currentSessionID {
+			others = append(others, s)
+		}
+	}
+
+	// the current session counts towards the limit
+	excess := len(others) - (maxSessions - 1)
+	if excess <= 0 {
+		return nil
+	}
+
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].GetIssuedAt().AsTime().Before(others[j].GetIssuedAt().AsTime())
+	})
+
+	ids := make([]string, 0, excess)
+	for _, s := range others[:excess] {
+		ids = append(ids, s.GetId())
+	}
+	return ids
+}
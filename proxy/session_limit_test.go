@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestGetSessionsToRevoke(t *testing.T) {
+	now := time.Now()
+	newSession := func(id string, age time.Duration) *session.SessionInfo {
+		return &session.SessionInfo{Id: id, IssuedAt: timestamppb.New(now.Add(-age))}
+	}
+	userSessions := []*session.SessionInfo{
+		newSession("s1", time.Hour),
+		newSession("s2", 3*time.Hour),
+		newSession("s3", 2*time.Hour),
+		newSession("current", 0),
+	}
+
+	assert.Nil(t, getSessionsToRevoke(userSessions, "current", 4))
+	assert.Nil(t, getSessionsToRevoke(userSessions, "current", 10))
+	assert.Equal(t, []string{"s2"}, getSessionsToRevoke(userSessions, "current", 3))
+	assert.Equal(t, []string{"s2", "s3", "s1"}, getSessionsToRevoke(userSessions, "current", 1))
+	assert.Equal(t, []string{"s2", "s3"}, getSessionsToRevoke(userSessions[:3], "current", 2),
+		"current session should count towards the limit even if not stored yet")
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/hpke"
 )
 
@@ -35,7 +36,8 @@ type proxyState struct {
 	hpkePrivateKey         *hpke.PrivateKey
 	authenticateKeyFetcher hpke.KeyFetcher
 
-	dataBrokerClient databroker.DataBrokerServiceClient
+	dataBrokerClient     databroker.DataBrokerServiceClient
+	sessionServiceClient session.SessionServiceClient
 
 	programmaticRedirectDomainWhitelist []string
 }
@@ -91,19 +93,6 @@ func newProxyStateFromConfig(cfg *config.Config) (*proxyState, error) {
 	state.authenticateSigninURL = state.authenticateURL.ResolveReference(&url.URL{Path: signinURL})
 	state.authenticateRefreshURL = state.authenticateURL.ResolveReference(&url.URL{Path: refreshURL})
 
-	state.sessionStore, err = cookie.NewStore(func() cookie.Options {
-		return cookie.Options{
-			Name:     cfg.Options.CookieName,
-			Domain:   cfg.Options.CookieDomain,
-			Secure:   cfg.Options.CookieSecure,
-			HTTPOnly: cfg.Options.CookieHTTPOnly,
-			Expire:   cfg.Options.CookieExpire,
-		}
-	}, state.encoder)
-	if err != nil {
-		return nil, err
-	}
-
 	dataBrokerConn, err := outboundGRPCConnection.Get(context.Background(), &grpc.OutboundOptions{
 		OutboundPort:   cfg.OutboundPort,
 		InstallationID: cfg.Options.InstallationID,
@@ -115,6 +104,46 @@ func newProxyStateFromConfig(cfg *config.Config) (*proxyState, error) {
 	}
 
 	state.dataBrokerClient = databroker.NewDataBrokerServiceClient(dataBrokerConn)
+	state.sessionServiceClient = session.NewSessionServiceClient(dataBrokerConn)
+
+	cookieSameSite := cfg.Options.GetCookieSameSite()
+	cookieOptionsByHost := cfg.Options.GetCookieOptionsByHost()
+	getCookieOptions := func() cookie.Options {
+		return cookie.Options{
+			Name:        cfg.Options.CookieName,
+			Domain:      cfg.Options.CookieDomain,
+			Secure:      cfg.Options.CookieSecure,
+			HTTPOnly:    cfg.Options.CookieHTTPOnly,
+			Expire:      cfg.Options.CookieExpire,
+			Partitioned: cfg.Options.CookiePartitioned,
+			SameSite:    cookieSameSite,
+			ByHost:      cookieOptionsByHost,
+			SharedKey:   state.sharedKey,
+		}
+	}
+	var sessionStoreType string
+	if cfg.Options.SessionStore != "" {
+		sessionStoreType = cfg.Options.SessionStore
+		state.sessionStore, err = cfg.Options.NewRegisteredSessionStore(getCookieOptions, state.encoder)
+	} else if cfg.Options.CookieOpaque {
+		sessionStoreType = "cookie_opaque"
+		state.sessionStore, err = cookie.NewOpaqueStore(getCookieOptions, state.encoder, state.dataBrokerClient)
+	} else if cfg.Options.CookieEncrypted {
+		sessionStoreType = "cookie_encrypted"
+		var encrypter encoding.MarshalUnmarshaler
+		encrypter, err = cfg.Options.GetCookieEncrypter()
+		if err != nil {
+			return nil, err
+		}
+		state.sessionStore, err = cookie.NewEncryptedStore(getCookieOptions, state.encoder, encrypter)
+	} else {
+		sessionStoreType = "cookie"
+		state.sessionStore, err = cookie.NewStore(getCookieOptions, state.encoder)
+	}
+	if err != nil {
+		return nil, err
+	}
+	state.sessionStore = sessions.NewInstrumentedStore(sessionStoreType, state.sessionStore)
 
 	state.programmaticRedirectDomainWhitelist = cfg.Options.ProgrammaticRedirectDomainWhitelist
 
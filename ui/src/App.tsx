@@ -3,9 +3,14 @@ import CssBaseline from "@mui/material/CssBaseline";
 import { ThemeProvider } from "@mui/material/styles";
 import React, {FC, useLayoutEffect} from "react";
 
+import AccessRequestPage from "./components/AccessRequestPage";
+import DeviceAuthorizationPage from "./components/DeviceAuthorizationPage";
 import ErrorPage from "./components/ErrorPage";
 import Footer from "./components/Footer";
 import Header from "./components/Header";
+import PasskeySignInPage from "./components/PasskeySignInPage";
+import SelectIdentityProviderPage from "./components/SelectIdentityProviderPage";
+import SignInPage from "./components/SignInPage";
 import SignOutConfirmPage from "./components/SignOutConfirmPage";
 import { ToolbarOffset } from "./components/ToolbarOffset";
 import UserInfoPage from "./components/UserInfoPage";
@@ -24,6 +29,21 @@ const App: FC = () => {
     case "Error":
       body = <ErrorPage data={data} />;
       break;
+    case "AccessRequest":
+      body = <AccessRequestPage data={data} />;
+      break;
+    case "DeviceAuthorization":
+      body = <DeviceAuthorizationPage data={data} />;
+      break;
+    case "PasskeySignIn":
+      body = <PasskeySignInPage data={data} />;
+      break;
+    case "SelectIdentityProvider":
+      body = <SelectIdentityProviderPage data={data} />;
+      break;
+    case "SignIn":
+      body = <SignInPage data={data} />;
+      break;
     case "SignOutConfirm":
       body = <SignOutConfirmPage data={data} />;
       break;
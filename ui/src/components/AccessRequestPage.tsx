@@ -0,0 +1,128 @@
+import Alert from "@mui/material/Alert";
+import Button from "@mui/material/Button";
+import Container from "@mui/material/Container";
+import MenuItem from "@mui/material/MenuItem";
+import Paper from "@mui/material/Paper";
+import Stack from "@mui/material/Stack";
+import TextField from "@mui/material/TextField";
+import Typography from "@mui/material/Typography";
+import React, { FC } from "react";
+
+import { AccessRequest, AccessRequestPageData } from "../types";
+import CsrfInput from "./CsrfInput";
+
+type AccessRequestDetailsProps = {
+  accessRequest: AccessRequest;
+};
+const AccessRequestDetails: FC<AccessRequestDetailsProps> = ({
+  accessRequest,
+}) => {
+  return (
+    <Stack spacing={1}>
+      <Typography>
+        <strong>User:</strong> {accessRequest.email || accessRequest.userId}
+      </Typography>
+      <Typography>
+        <strong>Route:</strong> {accessRequest.routeUrl}
+      </Typography>
+      <Typography>
+        <strong>Duration:</strong> {accessRequest.duration}
+      </Typography>
+      {accessRequest.reason ? (
+        <Typography>
+          <strong>Reason:</strong> {accessRequest.reason}
+        </Typography>
+      ) : null}
+      <Typography>
+        <strong>Status:</strong> {accessRequest.state.toLowerCase()}
+        {accessRequest.expiresAt
+          ? `, expires at ${new Date(accessRequest.expiresAt).toLocaleString()}`
+          : ""}
+      </Typography>
+    </Stack>
+  );
+};
+
+type AccessRequestPageProps = {
+  data: AccessRequestPageData;
+};
+const AccessRequestPage: FC<AccessRequestPageProps> = ({ data }) => {
+  if (data?.accessRequest) {
+    return (
+      <Container maxWidth="sm">
+        <Paper sx={{ padding: "16px" }}>
+          <form method="post">
+            <CsrfInput csrfToken={data?.csrfToken} />
+            <Stack spacing={2}>
+              <Typography variant="h5">Access request</Typography>
+              <AccessRequestDetails accessRequest={data.accessRequest} />
+              {data?.canDecide ? (
+                <Stack direction="row" spacing={2}>
+                  <Button
+                    type="submit"
+                    name="action"
+                    value="approve"
+                    variant="contained"
+                  >
+                    Approve
+                  </Button>
+                  <Button
+                    type="submit"
+                    name="action"
+                    value="deny"
+                    variant="outlined"
+                    color="error"
+                  >
+                    Deny
+                  </Button>
+                </Stack>
+              ) : null}
+            </Stack>
+          </form>
+        </Paper>
+      </Container>
+    );
+  }
+
+  return (
+    <Container maxWidth="sm">
+      <Paper sx={{ padding: "16px" }}>
+        <form method="post">
+          <CsrfInput csrfToken={data?.csrfToken} />
+          <Stack spacing={2}>
+            <Typography variant="h5">Request access</Typography>
+            <Typography>
+              Request temporary access to {data?.routeUrl}. An approver will
+              review your request.
+            </Typography>
+            {data?.error ? <Alert severity="error">{data.error}</Alert> : null}
+            <TextField
+              name="reason"
+              label="Reason"
+              multiline
+              minRows={2}
+              inputProps={{ maxLength: 1000 }}
+              required
+            />
+            <TextField
+              name="duration"
+              label="Duration"
+              select
+              defaultValue={data?.defaultDuration}
+            >
+              {data?.durations?.map((duration) => (
+                <MenuItem key={duration} value={duration}>
+                  {duration}
+                </MenuItem>
+              ))}
+            </TextField>
+            <Button type="submit" variant="contained">
+              Request Access
+            </Button>
+          </Stack>
+        </form>
+      </Paper>
+    </Container>
+  );
+};
+export default AccessRequestPage;
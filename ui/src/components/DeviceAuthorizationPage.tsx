@@ -0,0 +1,48 @@
+import Alert from "@mui/material/Alert";
+import Button from "@mui/material/Button";
+import Container from "@mui/material/Container";
+import Paper from "@mui/material/Paper";
+import Stack from "@mui/material/Stack";
+import TextField from "@mui/material/TextField";
+import Typography from "@mui/material/Typography";
+import React, { FC } from "react";
+
+import { DeviceAuthorizationPageData } from "../types";
+import CsrfInput from "./CsrfInput";
+
+type DeviceAuthorizationPageProps = {
+  data: DeviceAuthorizationPageData;
+};
+const DeviceAuthorizationPage: FC<DeviceAuthorizationPageProps> = ({
+  data,
+}) => {
+  return (
+    <Container maxWidth="xs">
+      <Paper sx={{ padding: "16px" }}>
+        <form method="post">
+          <CsrfInput csrfToken={data?.csrfToken} />
+          <Stack spacing={2}>
+            <Typography variant="h5">Connect a device</Typography>
+            <Typography>
+              Enter the code displayed on your device. Only enter a code that
+              you requested yourself.
+            </Typography>
+            {data?.error ? <Alert severity="error">{data.error}</Alert> : null}
+            <TextField
+              name="user_code"
+              label="Code"
+              autoComplete="off"
+              defaultValue={data?.userCode}
+              autoFocus
+              required
+            />
+            <Button type="submit" variant="contained">
+              Continue
+            </Button>
+          </Stack>
+        </form>
+      </Paper>
+    </Container>
+  );
+};
+export default DeviceAuthorizationPage;
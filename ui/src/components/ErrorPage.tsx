@@ -2,6 +2,7 @@ import { ListItemProps, TableCell } from "@mui/material";
 import Alert from "@mui/material/Alert";
 import AlertTitle from "@mui/material/AlertTitle";
 import Box from "@mui/material/Box";
+import Button from "@mui/material/Button";
 import Container from "@mui/material/Container";
 import Paper from "@mui/material/Paper";
 import Stack from "@mui/material/Stack";
@@ -90,6 +91,15 @@ export const ErrorPage: FC<ErrorPageProps> = ({ data }) => {
               </Table>
             </Container>
           )}
+          {data?.accessRequestUrl ? (
+            <Box sx={{ paddingX: "16px", paddingBottom: "16px" }}>
+              <Button variant="contained" href={data.accessRequestUrl}>
+                Request Access
+              </Button>
+            </Box>
+          ) : (
+            <></>
+          )}
           {data?.requestId ? (
             <SectionFooter>
               <Typography variant="caption">
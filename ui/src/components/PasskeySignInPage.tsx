@@ -0,0 +1,115 @@
+import Alert from "@mui/material/Alert";
+import Button from "@mui/material/Button";
+import Container from "@mui/material/Container";
+import Divider from "@mui/material/Divider";
+import Paper from "@mui/material/Paper";
+import Stack from "@mui/material/Stack";
+import TextField from "@mui/material/TextField";
+import Typography from "@mui/material/Typography";
+import React, { FC } from "react";
+
+import { PasskeySignInPageData } from "../types";
+import CsrfInput from "./CsrfInput";
+import { authenticate } from "./WebAuthnAuthenticateButton";
+import WebAuthnButton from "./WebAuthnButton";
+import { register } from "./WebAuthnRegisterButton";
+
+type PasskeySignInPageProps = {
+  data: PasskeySignInPageData;
+};
+const PasskeySignInPage: FC<PasskeySignInPageProps> = ({ data }) => {
+  if (data?.recoveryCodes?.length > 0) {
+    return (
+      <Container maxWidth="xs">
+        <Paper sx={{ padding: "16px" }}>
+          <Stack spacing={2}>
+            <Typography variant="h5">Recovery codes</Typography>
+            <Typography variant="body2">
+              Store these codes somewhere safe. Each code can be used once to
+              register a new passkey if you lose access to yours. They will not
+              be shown again.
+            </Typography>
+            <Typography
+              component="pre"
+              sx={{ fontFamily: "monospace", textAlign: "center" }}
+            >
+              {data.recoveryCodes.join("\n")}
+            </Typography>
+            <Button variant="contained" href={data?.continueUrl}>
+              Continue
+            </Button>
+          </Stack>
+        </Paper>
+      </Container>
+    );
+  }
+
+  return (
+    <Container maxWidth="xs">
+      <Paper sx={{ padding: "16px" }}>
+        <Stack spacing={2}>
+          <Typography variant="h5">Sign in</Typography>
+          {data?.error ? <Alert severity="error">{data.error}</Alert> : null}
+          <WebAuthnButton
+            action="authenticate"
+            csrfToken={data?.csrfToken}
+            enable={!!data?.requestOptions}
+            onClick={() => authenticate(data?.requestOptions)}
+            text="Sign in with a passkey"
+            url={data?.selfUrl}
+          />
+          <Divider />
+          {data?.creationOptions ? (
+            <>
+              <Typography variant="body2">
+                Create a passkey for {data?.username}.
+              </Typography>
+              <WebAuthnButton
+                action="register"
+                csrfToken={data?.csrfToken}
+                enable={true}
+                fields={{
+                  username: data?.username,
+                  recovery_code: data?.recoveryCode || "",
+                }}
+                onClick={() => register(data?.creationOptions)}
+                text="Create passkey"
+                url={data?.selfUrl}
+              />
+            </>
+          ) : (
+            <form method="post" action={data?.selfUrl}>
+              <CsrfInput csrfToken={data?.csrfToken} />
+              <input type="hidden" name="state" value={data?.state} />
+              <input type="hidden" name="action" value="begin_register" />
+              <Stack spacing={2}>
+                <Typography variant="body2">
+                  {data?.registrationEnabled
+                    ? "New here, or lost your passkey? Register a passkey."
+                    : "Lost your passkey? Register a new one with a recovery code."}
+                </Typography>
+                <TextField
+                  name="username"
+                  label="Username"
+                  autoComplete="username webauthn"
+                  defaultValue={data?.username}
+                  required
+                />
+                <TextField
+                  name="recovery_code"
+                  label="Recovery code"
+                  autoComplete="off"
+                  required={!data?.registrationEnabled}
+                />
+                <Button type="submit" variant="outlined">
+                  Register
+                </Button>
+              </Stack>
+            </form>
+          )}
+        </Stack>
+      </Paper>
+    </Container>
+  );
+};
+export default PasskeySignInPage;
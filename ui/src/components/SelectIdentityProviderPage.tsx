@@ -0,0 +1,31 @@
+import Button from "@mui/material/Button";
+import Container from "@mui/material/Container";
+import Paper from "@mui/material/Paper";
+import Stack from "@mui/material/Stack";
+import Typography from "@mui/material/Typography";
+import React, { FC } from "react";
+
+import { SelectIdentityProviderPageData } from "../types";
+
+type SelectIdentityProviderPageProps = {
+  data: SelectIdentityProviderPageData;
+};
+const SelectIdentityProviderPage: FC<SelectIdentityProviderPageProps> = ({
+  data,
+}) => {
+  return (
+    <Container maxWidth="xs">
+      <Paper sx={{ padding: "16px" }}>
+        <Stack spacing={2}>
+          <Typography variant="h5">Sign in with</Typography>
+          {data?.identityProviders?.map((idp) => (
+            <Button key={idp.url} href={idp.url} variant="contained">
+              {idp.name}
+            </Button>
+          ))}
+        </Stack>
+      </Paper>
+    </Container>
+  );
+};
+export default SelectIdentityProviderPage;
@@ -0,0 +1,51 @@
+import Alert from "@mui/material/Alert";
+import Button from "@mui/material/Button";
+import Container from "@mui/material/Container";
+import Paper from "@mui/material/Paper";
+import Stack from "@mui/material/Stack";
+import TextField from "@mui/material/TextField";
+import Typography from "@mui/material/Typography";
+import React, { FC } from "react";
+
+import { SignInPageData } from "../types";
+import CsrfInput from "./CsrfInput";
+
+type SignInPageProps = {
+  data: SignInPageData;
+};
+const SignInPage: FC<SignInPageProps> = ({ data }) => {
+  return (
+    <Container maxWidth="xs">
+      <Paper sx={{ padding: "16px" }}>
+        <form method="post">
+          <CsrfInput csrfToken={data?.csrfToken} />
+          <input type="hidden" name="state" value={data?.state} />
+          <Stack spacing={2}>
+            <Typography variant="h5">Sign in</Typography>
+            {data?.error ? <Alert severity="error">{data.error}</Alert> : null}
+            <TextField
+              name="username"
+              label="Username"
+              autoComplete="username"
+              defaultValue={data?.username}
+              autoFocus={!data?.username}
+              required
+            />
+            <TextField
+              name="password"
+              label="Password"
+              type="password"
+              autoComplete="current-password"
+              autoFocus={!!data?.username}
+              required
+            />
+            <Button type="submit" variant="contained">
+              Sign in
+            </Button>
+          </Stack>
+        </form>
+      </Paper>
+    </Container>
+  );
+};
+export default SignInPage;
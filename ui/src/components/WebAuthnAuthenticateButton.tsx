@@ -40,29 +40,34 @@ export type WebAuthnAuthenticateButtonProps = Omit<
 > & {
   requestOptions: WebAuthnRequestOptions;
 };
+// authenticate runs the authentication ceremony and returns the response to
+// post to the server.
+export async function authenticate(
+  requestOptions: WebAuthnRequestOptions
+): Promise<unknown> {
+  const credential = await authenticateCredential(requestOptions);
+  return {
+    id: credential.id,
+    type: credential.type,
+    rawId: encodeUrl(credential.rawId),
+    response: {
+      authenticatorData: encodeUrl(credential.response.authenticatorData),
+      clientDataJSON: encodeUrl(credential.response.clientDataJSON),
+      signature: encodeUrl(credential.response.signature),
+      userHandle: encodeUrl(credential.response.userHandle),
+    },
+  };
+}
+
 export const WebAuthnAuthenticateButton: FC<
   WebAuthnAuthenticateButtonProps
 > = ({ requestOptions, ...props }) => {
-  async function authenticate(): Promise<unknown> {
-    const credential = await authenticateCredential(requestOptions);
-    return {
-      id: credential.id,
-      type: credential.type,
-      rawId: encodeUrl(credential.rawId),
-      response: {
-        authenticatorData: encodeUrl(credential.response.authenticatorData),
-        clientDataJSON: encodeUrl(credential.response.clientDataJSON),
-        signature: encodeUrl(credential.response.signature),
-        userHandle: encodeUrl(credential.response.userHandle),
-      },
-    };
-  }
 
   return (
     <WebAuthnButton
       action="authenticate"
       enable={requestOptions?.allowCredentials?.length > 0}
-      onClick={authenticate}
+      onClick={() => authenticate(requestOptions)}
       text={"Authenticate Existing Device"}
       {...props}
     />
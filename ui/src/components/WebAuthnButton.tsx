@@ -7,6 +7,7 @@ export type WebAuthnButtonProps = Omit<ButtonProps, "action"> & {
   action: string;
   csrfToken: string;
   enable: boolean;
+  fields?: Record<string, string>;
   onClick: () => Promise<unknown>;
   text: string;
   url: string;
@@ -15,6 +16,7 @@ export const WebAuthnButton: FC<WebAuthnButtonProps> = ({
   action,
   csrfToken,
   enable,
+  fields,
   onClick,
   text,
   url,
@@ -55,6 +57,9 @@ export const WebAuthnButton: FC<WebAuthnButtonProps> = ({
       <form ref={formRef} method="post" action={url}>
         <input type="hidden" name="_pomerium_csrf" value={csrfToken} />
         <input type="hidden" name="action" value={action} />
+        {Object.entries(fields || {}).map(([name, value]) => (
+          <input key={name} type="hidden" name={name} value={value} />
+        ))}
         <input type="hidden" name={action + "_response"} ref={responseRef} />
       </form>
       <AlertDialog
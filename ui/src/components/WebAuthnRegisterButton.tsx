@@ -60,28 +60,33 @@ export type WebAuthnRegisterButtonProps = Omit<
   csrfToken: string;
   url: string;
 };
+// register runs the registration ceremony and returns the response to post to
+// the server.
+export async function register(
+  creationOptions: WebAuthnCreationOptions
+): Promise<unknown> {
+  const credential = await createCredential(creationOptions);
+  return {
+    id: credential.id,
+    type: credential.type,
+    rawId: encodeUrl(credential.rawId),
+    response: {
+      attestationObject: encodeUrl(credential.response.attestationObject),
+      clientDataJSON: encodeUrl(credential.response.clientDataJSON),
+    },
+  };
+}
+
 export const WebAuthnRegisterButton: FC<WebAuthnRegisterButtonProps> = ({
   creationOptions,
   ...props
 }) => {
-  async function register(): Promise<unknown> {
-    const credential = await createCredential(creationOptions);
-    return {
-      id: credential.id,
-      type: credential.type,
-      rawId: encodeUrl(credential.rawId),
-      response: {
-        attestationObject: encodeUrl(credential.response.attestationObject),
-        clientDataJSON: encodeUrl(credential.response.clientDataJSON),
-      },
-    };
-  }
 
   return (
     <WebAuthnButton
       action="register"
       enable={!!creationOptions}
-      onClick={register}
+      onClick={() => register(creationOptions)}
       text={"Register New Device"}
       {...props}
     />
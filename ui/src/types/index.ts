@@ -107,6 +107,7 @@ export type ErrorPageData = BasePageData & {
   description?: string;
   errorMessageFirstParagraph?: string;
   policyEvaluationTraces?: PolicyEvaluationTrace[];
+  accessRequestUrl?: string;
 };
 
 export type UserInfoData = {
@@ -122,11 +123,74 @@ export type UserInfoData = {
   webAuthnUrl?: string;
 };
 
+export type AccessRequest = {
+  id: string;
+  userId: string;
+  email?: string;
+  routeUrl: string;
+  reason?: string;
+  duration: string;
+  state: "PENDING" | "APPROVED" | "DENIED";
+  createdAt: string;
+  decidedAt?: string;
+  expiresAt?: string;
+};
+
+export type AccessRequestPageData = BasePageData & {
+  page: "AccessRequest";
+  routeUrl?: string;
+  durations?: string[];
+  defaultDuration?: string;
+  accessRequest?: AccessRequest;
+  canDecide?: boolean;
+  error?: string;
+};
+
 export type DeviceEnrolledPageData = BasePageData &
   UserInfoData & {
     page: "DeviceEnrolled";
   };
 
+export type DeviceAuthorizationPageData = BasePageData & {
+  page: "DeviceAuthorization";
+  userCode?: string;
+  error?: string;
+};
+
+export type IdentityProviderChoice = {
+  name: string;
+  url: string;
+};
+
+export type SelectIdentityProviderPageData = BasePageData & {
+  page: "SelectIdentityProvider";
+  identityProviders: IdentityProviderChoice[];
+};
+
+export type PasskeySignInPageData = BasePageData & {
+  page: "PasskeySignIn";
+  state: string;
+  selfUrl: string;
+  csrfToken: string;
+  error?: string;
+  registrationEnabled?: boolean;
+  requestOptions?: WebAuthnRequestOptions;
+
+  username?: string;
+  recoveryCode?: string;
+  creationOptions?: WebAuthnCreationOptions;
+
+  recoveryCodes?: string[];
+  continueUrl?: string;
+};
+
+export type SignInPageData = BasePageData & {
+  page: "SignIn";
+  state: string;
+  username?: string;
+  error?: string;
+};
+
 export type SignOutConfirmPageData = BasePageData & {
   page: "SignOutConfirm";
   url: string;
@@ -148,7 +212,12 @@ export type WebAuthnRegistrationPageData = BasePageData & {
 
 export type PageData =
   | ErrorPageData
+  | AccessRequestPageData
+  | DeviceAuthorizationPageData
   | DeviceEnrolledPageData
+  | PasskeySignInPageData
+  | SelectIdentityProviderPageData
+  | SignInPageData
   | SignOutConfirmPageData
   | UserInfoPageData
   | WebAuthnRegistrationPageData;